@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/opening"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+func bookSource(cmd *cobra.Command) (opening.Format, string, error) {
+	readFile := func(name string) (string, error) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("read: %w", err)
+		}
+		return string(data), nil
+	}
+	switch {
+	case cmd.Flags().Lookup("fen-book").Changed:
+		src, err := readFile(aFENBook)
+		if err != nil {
+			return 0, "", fmt.Errorf("fen book: %w", err)
+		}
+		return opening.FormatFEN, src, nil
+	case cmd.Flags().Lookup("pgn-book").Changed:
+		src, err := readFile(aPGNBook)
+		if err != nil {
+			return 0, "", fmt.Errorf("pgn book: %w", err)
+		}
+		return opening.FormatPGNLine, src, nil
+	default:
+		switch aBuiltinBook {
+		case "gb2014":
+			return opening.FormatPGNLine, opening.Graham20141FData(), nil
+		case "gb2020":
+			return opening.FormatPGNLine, opening.GBSelect2020Data(), nil
+		default:
+			return 0, "", fmt.Errorf("unknown built-in opening book %q", aBuiltinBook)
+		}
+	}
+}
+
+// filterBook drops the positions which are not balanced according to the evaluation engine. If no
+// evaluation engine is specified, the first engine in the match is used.
+func filterBook(
+	ctx context.Context,
+	format opening.Format,
+	src string,
+	engines *enginesConfig,
+	defaultEngine string,
+) (string, error) {
+	window, err := opening.EvalWindowFromString(aBookEvalWindow)
+	if err != nil {
+		return "", fmt.Errorf("bad window: %w", err)
+	}
+	name := aBookEvalEngine
+	if name == "" {
+		name = defaultEngine
+	}
+	poolOpts, err := engines.PoolOptions(name)
+	if err != nil {
+		return "", fmt.Errorf("engine options: %w", err)
+	}
+	pool, err := battle.NewEnginePool(ctx, slogx.DiscardLogger(), poolOpts)
+	if err != nil {
+		return "", fmt.Errorf("init engine: %w", err)
+	}
+	defer pool.Close()
+	ev := battle.NewEvaluator(pool, battle.EvaluatorOptions{Time: aBookEvalTime})
+	src, stats, err := opening.Filter(ctx, format, src, ev, opening.FilterOptions{
+		Window: window,
+		Jobs:   aJobs,
+		Lines:  lineOptions(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("filter: %w", err)
+	}
+	fmt.Fprintf(stderr, "Opening book: kept %v positions, dropped %v outside %v\n", stats.Kept, stats.Dropped, window)
+	return src, nil
+}
+
+func lineOptions() opening.PGNLineBookOptions {
+	return opening.PGNLineBookOptions{
+		MaxPlies: aBookMaxPlies,
+		Dedup:    aBookDedup,
+	}
+}
+
+func loadBook(
+	ctx context.Context,
+	cmd *cobra.Command,
+	source rand.Source,
+	engines *enginesConfig,
+	defaultEngine string,
+) (opening.Book, error) {
+	filter := cmd.Flags().Lookup("book-eval-window").Changed
+	if !filter && !cmd.Flags().Lookup("fen-book").Changed && !cmd.Flags().Lookup("pgn-book").Changed {
+		// Built-in books are already parsed, so avoid parsing them again.
+		switch aBuiltinBook {
+		case "gb2014":
+			return opening.Graham20141FBook(source, lineOptions())
+		case "gb2020":
+			return opening.GBSelect2020Book(source, lineOptions())
+		}
+	}
+	format, src, err := bookSource(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if filter {
+		src, err = filterBook(ctx, format, src, engines, defaultEngine)
+		if err != nil {
+			return nil, fmt.Errorf("eval: %w", err)
+		}
+	}
+	var book opening.Book
+	switch format {
+	case opening.FormatFEN:
+		book, err = opening.NewFENBook(strings.NewReader(src), source)
+	case opening.FormatPGNLine:
+		book, err = opening.NewPGNLineBook(strings.NewReader(src), source, lineOptions())
+	default:
+		panic("must not happen")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	return book, nil
+}
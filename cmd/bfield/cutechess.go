@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex65536/day20/internal/enginemap"
+	"github.com/alex65536/day20/internal/util/style"
+)
+
+// Cutechess-cli uses single-dash long flags, which cannot be parsed by cobra. So, such command lines
+// are translated into the native bfield flags before parsing.
+
+type cutechessEngine struct {
+	name    string
+	cmd     string
+	dir     string
+	args    []string
+	options map[string]any
+	tc      string
+	st      string
+}
+
+// apply sets the key from cutechess engine specification (i.e. "-engine" or "-each" flag).
+func (e *cutechessEngine) apply(key, value string, warn func(string, ...any)) error {
+	switch {
+	case key == "cmd":
+		e.cmd = value
+	case key == "name":
+		e.name = value
+	case key == "dir":
+		e.dir = value
+	case key == "arg":
+		e.args = append(e.args, value)
+	case key == "proto":
+		if value != "uci" {
+			return fmt.Errorf("unsupported protocol %q", value)
+		}
+	case key == "tc":
+		tc, err := cutechessTC(value)
+		if err != nil {
+			return fmt.Errorf("bad tc: %w", err)
+		}
+		e.tc = tc
+	case key == "st":
+		secs, err := strconv.ParseFloat(value, 64)
+		if err != nil || secs <= 0 {
+			return fmt.Errorf("bad st %q", value)
+		}
+		e.st = time.Duration(secs * float64(time.Second)).String()
+	case strings.HasPrefix(key, "option."):
+		if e.options == nil {
+			e.options = make(map[string]any)
+		}
+		e.options[strings.TrimPrefix(key, "option.")] = cutechessOptionValue(value)
+	default:
+		warn("ignoring unsupported engine setting %q", key)
+	}
+	return nil
+}
+
+// merge fills the settings which are not specified for e from the settings given in "-each".
+func (e *cutechessEngine) merge(each *cutechessEngine) {
+	if e.cmd == "" {
+		e.cmd = each.cmd
+	}
+	if e.dir == "" {
+		e.dir = each.dir
+	}
+	e.args = append(slices.Clone(each.args), e.args...)
+	for k, v := range each.options {
+		if _, ok := e.options[k]; !ok {
+			if e.options == nil {
+				e.options = make(map[string]any)
+			}
+			e.options[k] = v
+		}
+	}
+	if e.tc == "" && e.st == "" {
+		e.tc = each.tc
+		e.st = each.st
+	}
+}
+
+func (e *cutechessEngine) exeName() string {
+	if e.dir == "" || strings.ContainsRune(e.cmd, '/') {
+		return e.cmd
+	}
+	return strings.TrimSuffix(e.dir, "/") + "/" + e.cmd
+}
+
+func cutechessOptionValue(s string) any {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
+
+// cutechessTC converts time control from cutechess-cli format ("[moves/]time[+inc]", where time
+// is either in seconds or in "minutes:seconds") into the bfield format.
+func cutechessTC(s string) (string, error) {
+	if s == "inf" || s == "infinite" {
+		return "", fmt.Errorf("infinite time control is not supported")
+	}
+	moves := ""
+	if pos := strings.IndexByte(s, '/'); pos >= 0 {
+		moves, s = s[:pos+1], s[pos+1:]
+	}
+	inc := ""
+	if pos := strings.IndexByte(s, '+'); pos >= 0 {
+		inc, s = s[pos:], s[:pos]
+	}
+	if pos := strings.IndexByte(s, ':'); pos >= 0 {
+		mins, err := strconv.ParseFloat(s[:pos], 64)
+		if err != nil {
+			return "", fmt.Errorf("bad minutes: %w", err)
+		}
+		secs, err := strconv.ParseFloat(s[pos+1:], 64)
+		if err != nil {
+			return "", fmt.Errorf("bad seconds: %w", err)
+		}
+		s = strconv.FormatFloat(mins*60+secs, 'f', -1, 64)
+	}
+	return moves + s + inc, nil
+}
+
+func isCutechessArgs(args []string) bool {
+	return slices.Contains(args, "-engine") || slices.Contains(args, "-each")
+}
+
+type cutechessArgs struct {
+	Args    []string
+	Engines *enginesConfig
+}
+
+// translateCutechessArgs converts cutechess-cli command line into bfield command line. Unsupported
+// options which do not affect the results are ignored with a warning.
+func translateCutechessArgs(args []string, warnOut io.Writer) (*cutechessArgs, error) {
+	warn := func(format string, a ...any) {
+		fmt.Fprintf(warnOut, "%v %v\n", style.WithSE("warning:", 33, 1), fmt.Sprintf(format, a...))
+	}
+	isFlag := func(s string) bool {
+		return strings.HasPrefix(s, "-") && !strings.ContainsRune(s, '=')
+	}
+
+	var (
+		engines []*cutechessEngine
+		each    cutechessEngine
+		res     []string
+		rounds  = 1
+		games   = 1
+	)
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		if !isFlag(flag) {
+			return nil, fmt.Errorf("unexpected argument %q", flag)
+		}
+		// Values which follow the flag.
+		var values []string
+		for i+1 < len(args) && !isFlag(args[i+1]) {
+			i++
+			values = append(values, args[i])
+		}
+		keyValues := func(f func(key, value string) error) error {
+			for _, v := range values {
+				key, value, ok := strings.Cut(v, "=")
+				if !ok {
+					return fmt.Errorf("%v: expected key=value, got %q", flag, v)
+				}
+				if err := f(key, value); err != nil {
+					return fmt.Errorf("%v: %w", flag, err)
+				}
+			}
+			return nil
+		}
+		single := func() (string, error) {
+			if len(values) != 1 {
+				return "", fmt.Errorf("%v: expected one value", flag)
+			}
+			return values[0], nil
+		}
+		positive := func() (int, error) {
+			v, err := single()
+			if err != nil {
+				return 0, err
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%v: expected positive number, got %q", flag, v)
+			}
+			return n, nil
+		}
+
+		switch flag {
+		case "-engine":
+			e := &cutechessEngine{}
+			if err := keyValues(func(key, value string) error {
+				return e.apply(key, value, warn)
+			}); err != nil {
+				return nil, err
+			}
+			engines = append(engines, e)
+		case "-each":
+			if err := keyValues(func(key, value string) error {
+				return each.apply(key, value, warn)
+			}); err != nil {
+				return nil, err
+			}
+		case "-rounds":
+			n, err := positive()
+			if err != nil {
+				return nil, err
+			}
+			rounds = n
+		case "-games":
+			n, err := positive()
+			if err != nil {
+				return nil, err
+			}
+			games = n
+		case "-repeat":
+			if len(values) > 1 || (len(values) == 1 && values[0] != "2") {
+				return nil, fmt.Errorf("-repeat: only repeating each opening twice is supported")
+			}
+			res = append(res, "--repeat")
+		case "-concurrency":
+			n, err := positive()
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, "-j", strconv.Itoa(n))
+		case "-pgnout":
+			if len(values) == 0 {
+				return nil, fmt.Errorf("-pgnout: expected file name")
+			}
+			if len(values) > 1 {
+				warn("ignoring -pgnout modifiers %q", values[1:])
+			}
+			res = append(res, "-o", values[0])
+		case "-tournament":
+			v, err := single()
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, "--mode", v)
+		case "-openings":
+			var file, format = "", "pgn"
+			if err := keyValues(func(key, value string) error {
+				switch key {
+				case "file":
+					file = value
+				case "format":
+					format = value
+				case "order":
+					if value != "random" {
+						warn("openings are always chosen randomly, ignoring order=%v", value)
+					}
+				default:
+					warn("ignoring unsupported openings setting %q", key)
+				}
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+			if file == "" {
+				return nil, fmt.Errorf("-openings: no file specified")
+			}
+			switch format {
+			case "epd":
+				res = append(res, "-f", file)
+			case "pgn":
+				res = append(res, "-p", file)
+			default:
+				return nil, fmt.Errorf("-openings: unsupported format %q", format)
+			}
+		case "-resign":
+			if err := keyValues(func(key, value string) error {
+				if key != "score" {
+					warn("ignoring unsupported resign setting %q", key)
+					return nil
+				}
+				res = append(res, "-s", value)
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		case "-srand":
+			v, err := single()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := strconv.ParseUint(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("-srand: expected non-negative number, got %q", v)
+			}
+			res = append(res, "--seed", v)
+		case "-draw", "-recover", "-ratinginterval", "-outcomeinterval", "-wait",
+			"-event", "-site", "-maxmoves", "-debug", "-sprt", "-tb", "-tbpieces":
+			warn("ignoring unsupported option %v", flag)
+		default:
+			return nil, fmt.Errorf("unknown option %v", flag)
+		}
+	}
+
+	if len(engines) < 2 {
+		return nil, fmt.Errorf("at least two engines required")
+	}
+	config := &enginesConfig{Engines: make(map[string]enginemap.EngineOptions, len(engines))}
+	var names []string
+	for i, e := range engines {
+		e.merge(&each)
+		if e.cmd == "" {
+			return nil, fmt.Errorf("engine #%v: no cmd specified", i+1)
+		}
+		if e.name == "" {
+			e.name = e.cmd
+		}
+		if _, ok := config.Engines[e.name]; ok {
+			return nil, fmt.Errorf("engine #%v: duplicate name %q", i+1, e.name)
+		}
+		config.Engines[e.name] = enginemap.EngineOptions{
+			Name:    e.exeName(),
+			Args:    e.args,
+			Options: e.options,
+		}
+		names = append(names, e.name)
+	}
+
+	// Time control is common for all the games, so it may differ between engines only if there are
+	// just two of them.
+	first, second := engines[0], engines[1]
+	for _, e := range engines[2:] {
+		if e.tc != first.tc || e.st != first.st {
+			return nil, fmt.Errorf("different time controls are supported only for two engines")
+		}
+	}
+	switch {
+	case first.st != "" && second.st != "":
+		if first.st != second.st {
+			return nil, fmt.Errorf("different fixed time per move is not supported")
+		}
+		res = append(res, "-T", first.st)
+	case first.tc != "" && second.tc != "":
+		tc := first.tc
+		if second.tc != first.tc {
+			tc += "|" + second.tc
+		}
+		res = append(res, "-c", tc)
+	case first.tc != "" || second.tc != "" || first.st != "" || second.st != "":
+		return nil, fmt.Errorf("time control must be specified in the same way for all engines")
+	}
+
+	res = append(res, "-g", strconv.Itoa(rounds*games), "--cutechess-output", "--")
+	res = append(res, names...)
+	return &cutechessArgs{Args: res, Engines: config}, nil
+}
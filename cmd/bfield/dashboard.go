@@ -0,0 +1,291 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alex65536/go-chess/chess"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/delta"
+	"github.com/alex65536/day20/internal/field"
+)
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTempl = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// dashboard is a minimal web server which shows the progress of the match and the games which are
+// currently running. Running games are tracked with the same watchers as the ones used by the room
+// client.
+type dashboard struct {
+	mu      sync.Mutex
+	start   time.Time
+	table   *field.Crosstable
+	games   map[int]*delta.Watcher
+	server  *http.Server
+	serveCh chan error
+}
+
+func newDashboard() *dashboard {
+	d := &dashboard{
+		start: time.Now(),
+		games: make(map[int]*delta.Watcher),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", d.handlePage)
+	mux.HandleFunc("GET /state", d.handleState)
+	d.server = &http.Server{Handler: mux}
+	return d
+}
+
+// Serve starts the server in background.
+func (d *dashboard) Serve(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	d.serveCh = make(chan error, 1)
+	go func() {
+		d.serveCh <- d.server.Serve(ln)
+	}()
+	return nil
+}
+
+func (d *dashboard) Shutdown(ctx context.Context) error {
+	if err := d.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-d.serveCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve: %w", err)
+	}
+	return nil
+}
+
+func (d *dashboard) SetCrosstable(t *field.Crosstable) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.table = t
+}
+
+func (d *dashboard) BattleWatcher(index int) battle.Watcher {
+	w, _ := delta.NewWatcher(delta.WatcherOptions{})
+	d.mu.Lock()
+	d.games[index] = w
+	d.mu.Unlock()
+	go func() {
+		<-w.Done()
+		d.mu.Lock()
+		delete(d.games, index)
+		d.mu.Unlock()
+	}()
+	return w
+}
+
+type dashboardGame struct {
+	Index int             `json:"index"`
+	State *delta.JobState `json:"state"`
+}
+
+type dashboardSnapshot struct {
+	Elapsed time.Duration
+	Table   *field.Crosstable // May be nil if the match is not started yet.
+	Games   []dashboardGame
+}
+
+func (d *dashboard) snapshot() (*dashboardSnapshot, error) {
+	d.mu.Lock()
+	table := d.table
+	watchers := make(map[int]*delta.Watcher, len(d.games))
+	for i, w := range d.games {
+		watchers[i] = w
+	}
+	d.mu.Unlock()
+
+	res := &dashboardSnapshot{
+		Elapsed: time.Since(d.start),
+		Table:   table,
+	}
+	for index, w := range watchers {
+		diff, _, err := w.StateDelta(delta.JobCursor{})
+		if err != nil {
+			return nil, fmt.Errorf("game %v: %w", index, err)
+		}
+		state := delta.NewJobState()
+		if err := state.ApplyDelta(diff); err != nil {
+			return nil, fmt.Errorf("game %v: apply delta: %w", index, err)
+		}
+		if state.Info == nil {
+			// The game is not started yet.
+			continue
+		}
+		res.Games = append(res.Games, dashboardGame{Index: index, State: state})
+	}
+	slices.SortFunc(res.Games, func(a, b dashboardGame) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+	return res, nil
+}
+
+func (d *dashboard) handleState(w http.ResponseWriter, _ *http.Request) {
+	snap, err := d.snapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Elapsed   float64         `json:"elapsed"`
+		Completed int             `json:"completed"`
+		Total     int             `json:"total"`
+		Pairs     []jsonPair      `json:"pairs"`
+		Standings []jsonStanding  `json:"standings,omitempty"`
+		Games     []dashboardGame `json:"games"`
+	}{
+		Elapsed: snap.Elapsed.Seconds(),
+		Games:   snap.Games,
+	}
+	if t := snap.Table; t != nil {
+		jd := &jsonDisplay{}
+		data.Completed = t.Completed()
+		data.Total = t.Total
+		data.Pairs = jd.pairs(t, false)
+		if len(t.Pairs) > 1 {
+			data.Standings = jd.standings(t)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func (d *dashboard) handlePage(w http.ResponseWriter, _ *http.Request) {
+	snap, err := d.snapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type pair struct {
+		First  string
+		Second string
+		Win    int
+		Draw   int
+		Lose   int
+		Score  string
+		LOS    string
+		Elo    string
+	}
+	type standing struct {
+		Rank   int
+		Name   string
+		Points string
+		Games  int
+		Score  string
+	}
+	type player struct {
+		Name   string
+		Clock  string
+		Score  string
+		Depth  int64
+		PV     string
+		Active bool
+	}
+	type game struct {
+		Index  int
+		Move   int
+		Board  string
+		Status string
+		White  player
+		Black  player
+	}
+	data := struct {
+		Elapsed   string
+		Completed int
+		Total     int
+		Pairs     []pair
+		Standings []standing
+		Games     []game
+	}{
+		Elapsed: snap.Elapsed.Round(time.Second).String(),
+	}
+
+	if t := snap.Table; t != nil {
+		data.Completed = t.Completed()
+		data.Total = t.Total
+		for k, p := range t.Pairs {
+			status := t.Status[k]
+			elo := status.EloDiff(0.95)
+			los := "N/A"
+			if l := status.LOS(); !math.IsNaN(l) {
+				los = fmt.Sprintf("%.2f", l)
+			}
+			data.Pairs = append(data.Pairs, pair{
+				First:  t.Names[p.First],
+				Second: t.Names[p.Second],
+				Win:    status.Win,
+				Draw:   status.Draw,
+				Lose:   status.Lose,
+				Score:  status.ScoreString(),
+				LOS:    los,
+				Elo: fmt.Sprintf(
+					"%v / %v / %v",
+					cutechessFloat(elo.Low),
+					cutechessFloat(elo.Avg),
+					cutechessFloat(elo.High),
+				),
+			})
+		}
+		if len(t.Pairs) > 1 {
+			for i, s := range t.Standings() {
+				data.Standings = append(data.Standings, standing{
+					Rank:   i + 1,
+					Name:   s.Name,
+					Points: formatPoints(s),
+					Games:  s.Status.Total(),
+					Score:  s.Status.ScoreString(),
+				})
+			}
+		}
+	}
+
+	nowTs := delta.NowTimestamp()
+	makePlayer := func(name string, pl *delta.Player) player {
+		res := player{Name: name, Depth: pl.Depth, PV: pl.PVS, Active: pl.Active}
+		if clk, ok := pl.ClockFrom(nowTs).TryGet(); ok {
+			res.Clock = max(clk, 0).Round(100 * time.Millisecond).String()
+		}
+		if score, ok := pl.Score.TryGet(); ok {
+			res.Score = score.String()
+		}
+		return res
+	}
+	for _, g := range snap.Games {
+		st := g.State
+		status := "running"
+		if st.Position.Status != chess.StatusRunning {
+			status = st.Position.Status.String()
+		}
+		data.Games = append(data.Games, game{
+			Index:  g.Index,
+			Move:   st.Position.MoveNumber(),
+			Board:  st.Position.Board.Pretty(chess.PrettyStyleFancy),
+			Status: status,
+			White:  makePlayer(st.Info.WhiteName, st.White),
+			Black:  makePlayer(st.Info.BlackName, st.Black),
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = dashboardTempl.Execute(w, data)
+}
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/alex65536/day20/internal/battle"
 	"github.com/alex65536/day20/internal/field"
 	"github.com/alex65536/day20/internal/stat"
+	"github.com/alex65536/day20/internal/util/randutil"
 	"github.com/alex65536/day20/internal/util/style"
 )
 
@@ -133,48 +135,64 @@ func formatEloDiff(d stat.EloDiff) string {
 }
 
 type display interface {
-	Display(status stat.Status, warn battle.Warnings) error
-	FinalDisplay(status stat.Status) error
+	// Header is called once before the match starts. The seed is shown, so the run can be
+	// reproduced.
+	Header(seed uint64) error
+	Display(t *field.Crosstable, warn battle.Warnings) error
+	FinalDisplay(t *field.Crosstable) error
 }
 
 func makeWatcher(d display) field.Watcher {
-	return func(status stat.Status, warn battle.Warnings) {
-		if err := d.Display(status, warn); err != nil {
+	return func(t *field.Crosstable, warn battle.Warnings) {
+		if err := d.Display(t, warn); err != nil {
 			panic(err)
 		}
 	}
 }
 
 type displayImpl struct {
-	out   *bufio.Writer
-	err   *bufio.Writer
-	start time.Time
-	total int
-	first bool
-	quiet bool
-	fancy bool
+	out       *bufio.Writer
+	err       *bufio.Writer
+	start     time.Time
+	resumed   int
+	lines     int
+	quiet     bool
+	fancy     bool
+	bootstrap int
+	seed      uint64
 }
 
-func newDisplay(out io.Writer, err io.Writer, total int, quiet bool) display {
+func newDisplay(out io.Writer, err io.Writer, resumed int, quiet bool, bootstrap int) display {
 	return &displayImpl{
-		out:   bufio.NewWriter(out),
-		err:   bufio.NewWriter(err),
-		start: time.Now(),
-		total: total,
-		first: true,
-		quiet: quiet,
-		fancy: style.IsStdoutTTY(),
+		out:       bufio.NewWriter(out),
+		err:       bufio.NewWriter(err),
+		start:     time.Now(),
+		resumed:   resumed,
+		quiet:     quiet,
+		fancy:     style.IsStdoutTTY(),
+		bootstrap: bootstrap,
 	}
 }
 
 func (d *displayImpl) erase() error {
-	if d.first {
-		d.first = false
+	if d.lines == 0 {
 		return nil
 	}
-	if _, err := d.out.WriteString("\r\033[A\033[2K\033[A\033[2K\033[A\033[2K\033[A\033[2K"); err != nil {
+	if _, err := d.out.WriteString("\r" + strings.Repeat("\033[A\033[2K", d.lines)); err != nil {
 		return fmt.Errorf("erase: %w", err)
 	}
+	d.lines = 0
+	return nil
+}
+
+func (d *displayImpl) Header(seed uint64) error {
+	d.seed = seed
+	if _, err := fmt.Fprintf(d.out, "Seed: %v\n", seed); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := d.out.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
 	return nil
 }
 
@@ -207,13 +225,131 @@ func (d *displayImpl) displayResult(status stat.Status) error {
 	return nil
 }
 
-func (d *displayImpl) displayProgress(status stat.Status, fancy bool) error {
+func formatPoints(s field.Standing) string {
+	return strconv.FormatFloat(s.Points(), 'f', -1, 64)
+}
+
+func (d *displayImpl) displayStandings(t *field.Crosstable) (int, error) {
+	standings := t.Standings()
+	width := 0
+	for _, s := range standings {
+		width = max(width, len(s.Name))
+	}
+	for i, s := range standings {
+		if _, err := fmt.Fprintf(
+			d.out,
+			"%2d. %-*v %v/%v, Score: %v\n",
+			i+1,
+			width,
+			s.Name,
+			style.WithS(formatPoints(s), 1),
+			s.Status.Total(),
+			s.Status.ScoreString(),
+		); err != nil {
+			return 0, fmt.Errorf("write: %w", err)
+		}
+	}
+	return len(standings), nil
+}
+
+func (d *displayImpl) displayCrosstable(t *field.Crosstable) error {
+	standings := t.Standings()
+	rows := [][]string{{"#", "Engine", "Points", "Games"}}
+	for i := range standings {
+		rows[0] = append(rows[0], strconv.Itoa(i+1))
+	}
+	for i, s := range standings {
+		row := []string{
+			strconv.Itoa(i + 1),
+			s.Name,
+			formatPoints(s),
+			strconv.Itoa(s.Status.Total()),
+		}
+		for j, o := range standings {
+			switch status, ok := t.Cell(s.Engine, o.Engine); {
+			case i == j:
+				row = append(row, "-")
+			case !ok:
+				row = append(row, "")
+			default:
+				row = append(row, formatPoints(field.Standing{Status: status})+"/"+strconv.Itoa(status.Total()))
+			}
+		}
+		rows = append(rows, row)
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+	if _, err := d.out.WriteString("Crosstable:\n"); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	for _, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			if i != 0 {
+				_, _ = b.WriteString("  ")
+			}
+			_, _ = fmt.Fprintf(&b, "%-*v", widths[i], cell)
+		}
+		if _, err := fmt.Fprintln(d.out, strings.TrimRight(b.String(), " ")); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *displayImpl) displayPairs(t *field.Crosstable) error {
+	if _, err := d.out.WriteString("Pairs:\n"); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	for k, p := range t.Pairs {
+		status := t.Status[k]
+		if _, err := fmt.Fprintf(
+			d.out,
+			"%v vs %v: Win: %v, Draw: %v, Lose: %v, Score: %v, LOS: %v\n"+
+				"  Elo Diff: %v (low/avg/high, at p = 0.95)\n",
+			t.Names[p.First],
+			t.Names[p.Second],
+			status.Win,
+			status.Draw,
+			status.Lose,
+			status.ScoreString(),
+			formatLOS(status.LOS()),
+			formatEloDiff(status.EloDiff(0.95)),
+		); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+		if d.bootstrap > 0 {
+			if _, err := d.out.WriteString("  "); err != nil {
+				return fmt.Errorf("write: %w", err)
+			}
+			if err := d.displayBootstrap(status, t.Penta[k]); err != nil {
+				return fmt.Errorf("bootstrap: %w", err)
+			}
+		}
+		if penta := t.Penta[k]; penta.Pairs() != 0 {
+			if _, err := d.out.WriteString("  "); err != nil {
+				return fmt.Errorf("write: %w", err)
+			}
+			if err := d.displayPenta(penta); err != nil {
+				return fmt.Errorf("pentanomial: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *displayImpl) displayProgress(t *field.Crosstable, fancy bool) (int, error) {
 	elapsed := time.Since(d.start)
-	completed, total := status.Total(), d.total
+	completed, total := t.Completed(), t.Total
 	ratio := 1.0
 	if total != 0 {
 		ratio = float64(completed) / float64(total)
 	}
+	single := len(t.Pairs) == 1
 
 	if fancy {
 		if _, err := fmt.Fprintf(
@@ -224,32 +360,50 @@ func (d *displayImpl) displayProgress(status stat.Status, fancy bool) error {
 			completed,
 			total,
 			formatDuration(elapsed),
-			formatDuration(predictTime(completed, total, elapsed)),
+			formatDuration(predictTime(completed-d.resumed, total-d.resumed, elapsed)),
 		); err != nil {
-			return fmt.Errorf("write: %w", err)
+			return 0, fmt.Errorf("write: %w", err)
 		}
-		if err := d.displayResult(status); err != nil {
-			return fmt.Errorf("result: %w", err)
+		if single {
+			if err := d.displayResult(t.Status[0]); err != nil {
+				return 0, fmt.Errorf("result: %w", err)
+			}
+			return 4, nil
 		}
-	} else {
-		if _, err := fmt.Fprintf(
-			d.out,
-			"Games: %v/%v, Time: %v/%v, Score: %v, Winner: %v\n",
-			completed,
-			total,
-			formatDuration(elapsed),
-			formatDuration(predictTime(completed, total, elapsed)),
-			status.ScoreString(),
-			formatWinner(status.Winner(0.9, 0.95, 0.97, 0.99)),
-		); err != nil {
-			return fmt.Errorf("write: %w", err)
+		lines, err := d.displayStandings(t)
+		if err != nil {
+			return 0, fmt.Errorf("standings: %w", err)
 		}
+		return lines + 1, nil
 	}
 
-	return nil
+	var result string
+	if single {
+		status := t.Status[0]
+		result = fmt.Sprintf(
+			"Score: %v, Winner: %v",
+			status.ScoreString(),
+			formatWinner(status.Winner(0.9, 0.95, 0.97, 0.99)),
+		)
+	} else {
+		leader := t.Standings()[0]
+		result = fmt.Sprintf("Leader: %v (%v/%v)", leader.Name, formatPoints(leader), leader.Status.Total())
+	}
+	if _, err := fmt.Fprintf(
+		d.out,
+		"Games: %v/%v, Time: %v/%v, %v\n",
+		completed,
+		total,
+		formatDuration(elapsed),
+		formatDuration(predictTime(completed-d.resumed, total-d.resumed, elapsed)),
+		result,
+	); err != nil {
+		return 0, fmt.Errorf("write: %w", err)
+	}
+	return 1, nil
 }
 
-func (d *displayImpl) Display(status stat.Status, warn battle.Warnings) error {
+func (d *displayImpl) Display(t *field.Crosstable, warn battle.Warnings) error {
 	if d.fancy && !d.quiet {
 		if err := d.erase(); err != nil {
 			return fmt.Errorf("erase: %w", err)
@@ -274,9 +428,13 @@ func (d *displayImpl) Display(status stat.Status, warn battle.Warnings) error {
 		return nil
 	}
 
-	if err := d.displayProgress(status, d.fancy); err != nil {
+	lines, err := d.displayProgress(t, d.fancy)
+	if err != nil {
 		return fmt.Errorf("progress: %w", err)
 	}
+	if d.fancy {
+		d.lines = lines
+	}
 	if err := d.out.Flush(); err != nil {
 		return fmt.Errorf("flush: %w", err)
 	}
@@ -284,13 +442,67 @@ func (d *displayImpl) Display(status stat.Status, warn battle.Warnings) error {
 	return nil
 }
 
-func (d *displayImpl) FinalDisplay(status stat.Status) error {
-	if d.fancy && !d.quiet {
-		return nil
+// eloDiffBootstrap resamples game pairs if the games were played in pairs, as the games of a pair
+// share the opening and thus are not independent. Otherwise, single games are resampled.
+func eloDiffBootstrap(status stat.Status, penta stat.Pentanomial, iters int, seed uint64) (stat.EloDiff, string) {
+	if penta.Pairs() != 0 {
+		return penta.EloDiffBootstrap(0.95, iters, randutil.NewSeededSource(seed)), "game pairs"
 	}
+	return status.EloDiffBootstrap(0.95, iters, randutil.NewSeededSource(seed)), "games"
+}
 
-	if err := d.displayResult(status); err != nil {
-		return fmt.Errorf("result: %w", err)
+func (d *displayImpl) displayBootstrap(status stat.Status, penta stat.Pentanomial) error {
+	elo, unit := eloDiffBootstrap(status, penta, d.bootstrap, d.seed)
+	if _, err := fmt.Fprintf(
+		d.out,
+		"Elo Diff: %v (low/avg/high, at p = 0.95, bootstrap over %v with %v iterations)\n",
+		formatEloDiff(elo),
+		unit,
+		d.bootstrap,
+	); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+func (d *displayImpl) displayPenta(penta stat.Pentanomial) error {
+	if _, err := fmt.Fprintf(
+		d.out,
+		"Pentanomial: %v (game pairs by score 0, 0.5, 1, 1.5, 2)\n"+
+			"Elo Diff: %v (low/avg/high, at p = 0.95, by game pairs)\n",
+		penta,
+		formatEloDiff(penta.EloDiff(0.95)),
+	); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+func (d *displayImpl) FinalDisplay(t *field.Crosstable) error {
+	if len(t.Pairs) == 1 {
+		status := t.Status[0]
+		if !d.fancy || d.quiet {
+			if err := d.displayResult(status); err != nil {
+				return fmt.Errorf("result: %w", err)
+			}
+		}
+		if penta := t.Penta[0]; penta.Pairs() != 0 {
+			if err := d.displayPenta(penta); err != nil {
+				return fmt.Errorf("pentanomial: %w", err)
+			}
+		}
+		if d.bootstrap > 0 {
+			if err := d.displayBootstrap(status, t.Penta[0]); err != nil {
+				return fmt.Errorf("bootstrap: %w", err)
+			}
+		}
+	} else {
+		if err := d.displayCrosstable(t); err != nil {
+			return fmt.Errorf("crosstable: %w", err)
+		}
+		if err := d.displayPairs(t); err != nil {
+			return fmt.Errorf("pairs: %w", err)
+		}
 	}
 	if err := d.out.Flush(); err != nil {
 		return fmt.Errorf("flush: %w", err)
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/field"
+	"github.com/alex65536/day20/internal/stat"
+)
+
+// cutechessDisplay prints the progress in the same format as cutechess-cli does, so the tools which
+// parse cutechess-cli output can be used with bfield.
+type cutechessDisplay struct {
+	mu     sync.Mutex
+	out    *bufio.Writer
+	err    io.Writer
+	names  []string
+	byPool map[string]string
+	total  int
+	prev   *field.Crosstable // Accessed only from Display.
+}
+
+var _ field.GameWatcher = (*cutechessDisplay)(nil)
+
+// newCutechessDisplay creates the display. Engines are shown under the names given by the user
+// instead of pool names, which also include the engine name reported by UCI.
+func newCutechessDisplay(
+	out io.Writer,
+	err io.Writer,
+	names []string,
+	pools []battle.EnginePool,
+	total int,
+) *cutechessDisplay {
+	byPool := make(map[string]string, len(pools))
+	for i, p := range pools {
+		byPool[p.Name()] = names[i]
+	}
+	return &cutechessDisplay{
+		out:    bufio.NewWriter(out),
+		err:    err,
+		names:  names,
+		byPool: byPool,
+		total:  total,
+	}
+}
+
+func (d *cutechessDisplay) name(pool string) string {
+	if name, ok := d.byPool[pool]; ok {
+		return name
+	}
+	return pool
+}
+
+func (d *cutechessDisplay) printf(format string, a ...any) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := fmt.Fprintf(d.out, format, a...); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := d.out.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	return nil
+}
+
+func (d *cutechessDisplay) Header(seed uint64) error {
+	return d.printf("Seed: %v\n", seed)
+}
+
+func (d *cutechessDisplay) OnGameStarted(index int, white, black string) {
+	if err := d.printf("Started game %v of %v (%v vs %v)\n", index, d.total, d.name(white), d.name(black)); err != nil {
+		panic(err)
+	}
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+func (d *cutechessDisplay) OnGameFinished(index int, game *battle.GameExt, _ battle.Warnings) {
+	outcome := game.Game.Outcome()
+	if err := d.printf(
+		"Finished game %v (%v vs %v): %v {%v}\n",
+		index,
+		d.name(game.WhiteName),
+		d.name(game.BlackName),
+		outcome.Status(),
+		capitalize(outcome.String()),
+	); err != nil {
+		panic(err)
+	}
+}
+
+func (d *cutechessDisplay) Display(t *field.Crosstable, warn battle.Warnings) error {
+	for _, w := range warn {
+		if _, err := fmt.Fprintf(d.err, "Warning: %v\n", w); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+	}
+	prev := d.prev
+	d.prev = t
+	if prev == nil {
+		return nil
+	}
+	for k, p := range t.Pairs {
+		status := t.Status[k]
+		if status == prev.Status[k] {
+			continue
+		}
+		if err := d.printf(
+			"Score of %v vs %v: %v - %v - %v  [%.3f] %v\n",
+			d.names[p.First],
+			d.names[p.Second],
+			status.Win,
+			status.Lose,
+			status.Draw,
+			cutechessScore(status),
+			status.Total(),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cutechessScore(s stat.Status) float64 {
+	if s.Total() == 0 {
+		return 0
+	}
+	return (float64(s.Win) + 0.5*float64(s.Draw)) / float64(s.Total())
+}
+
+func cutechessFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, +1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	default:
+		return fmt.Sprintf("%.1f", f)
+	}
+}
+
+func cutechessElo(s stat.Status) (string, string) {
+	d := s.EloDiff(0.95)
+	return cutechessFloat(d.Avg), cutechessFloat((d.High - d.Low) / 2)
+}
+
+func (d *cutechessDisplay) FinalDisplay(t *field.Crosstable) error {
+	if len(t.Pairs) == 1 {
+		status := t.Status[0]
+		elo, margin := cutechessElo(status)
+		drawRatio := 0.0
+		if status.Total() != 0 {
+			drawRatio = float64(status.Draw) / float64(status.Total())
+		}
+		if err := d.printf(
+			"Elo difference: %v +/- %v, LOS: %.1f %%, DrawRatio: %.1f %%\n",
+			elo,
+			margin,
+			status.LOS()*100,
+			drawRatio*100,
+		); err != nil {
+			return err
+		}
+	} else {
+		var b strings.Builder
+		_, _ = fmt.Fprintf(&b, "%4v %-25v %7v %7v %8v %7v %7v\n", "Rank", "Name", "Elo", "+/-", "nGames", "Score", "Draw")
+		for i, s := range t.Standings() {
+			elo, margin := cutechessElo(s.Status)
+			drawRatio := 0.0
+			if s.Status.Total() != 0 {
+				drawRatio = float64(s.Status.Draw) / float64(s.Status.Total())
+			}
+			_, _ = fmt.Fprintf(
+				&b,
+				"%4v %-25v %7v %7v %8v %6.1f%% %6.1f%%\n",
+				i+1,
+				d.names[s.Engine],
+				elo,
+				margin,
+				s.Status.Total(),
+				cutechessScore(s.Status)*100,
+				drawRatio*100,
+			)
+		}
+		if err := d.printf("%v", b.String()); err != nil {
+			return err
+		}
+	}
+	return d.printf("Finished match\n")
+}
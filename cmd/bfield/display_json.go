@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/field"
+	"github.com/alex65536/day20/internal/stat"
+)
+
+const (
+	sprtAlpha = 0.05
+	sprtBeta  = 0.05
+)
+
+type sprtOptions struct {
+	Elo0 float64
+	Elo1 float64
+}
+
+// jsonFloat converts infinite and NaN values to null, since they cannot be represented in JSON.
+func jsonFloat(f float64) *float64 {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil
+	}
+	return &f
+}
+
+type jsonEloDiff struct {
+	Low  *float64 `json:"low"`
+	Avg  *float64 `json:"avg"`
+	High *float64 `json:"high"`
+}
+
+func makeJSONEloDiff(d stat.EloDiff) jsonEloDiff {
+	return jsonEloDiff{
+		Low:  jsonFloat(d.Low),
+		Avg:  jsonFloat(d.Avg),
+		High: jsonFloat(d.High),
+	}
+}
+
+type jsonSPRT struct {
+	Elo0  float64  `json:"elo0"`
+	Elo1  float64  `json:"elo1"`
+	Alpha float64  `json:"alpha"`
+	Beta  float64  `json:"beta"`
+	LLR   *float64 `json:"llr"`
+	Lower float64  `json:"lower"`
+	Upper float64  `json:"upper"`
+	State string   `json:"state"`
+}
+
+func makeJSONSPRT(status stat.Status, o sprtOptions) jsonSPRT {
+	llr := status.LLR(o.Elo0, o.Elo1)
+	lower, upper := stat.SPRTBounds(sprtAlpha, sprtBeta)
+	state := "running"
+	switch {
+	case llr >= upper:
+		state = "h1"
+	case llr <= lower:
+		state = "h0"
+	}
+	return jsonSPRT{
+		Elo0:  o.Elo0,
+		Elo1:  o.Elo1,
+		Alpha: sprtAlpha,
+		Beta:  sprtBeta,
+		LLR:   jsonFloat(llr),
+		Lower: lower,
+		Upper: upper,
+		State: state,
+	}
+}
+
+type jsonScore struct {
+	Win   int         `json:"win"`
+	Draw  int         `json:"draw"`
+	Lose  int         `json:"lose"`
+	Games int         `json:"games"`
+	Total int         `json:"total"`
+	Score string      `json:"score"`
+	LOS   *float64    `json:"los"`
+	Elo   jsonEloDiff `json:"elo"`
+}
+
+type jsonPenta struct {
+	Counts  stat.Pentanomial `json:"counts"`
+	Elo     jsonEloDiff      `json:"elo"`
+	NormElo jsonEloDiff      `json:"norm_elo"`
+}
+
+// makeJSONPenta returns nil if no game pairs were played.
+func makeJSONPenta(p stat.Pentanomial) *jsonPenta {
+	if p.Pairs() == 0 {
+		return nil
+	}
+	return &jsonPenta{
+		Counts:  p,
+		Elo:     makeJSONEloDiff(p.EloDiff(0.95)),
+		NormElo: makeJSONEloDiff(p.NormalizedEloDiff(0.95)),
+	}
+}
+
+type jsonPair struct {
+	First  string `json:"first"`
+	Second string `json:"second"`
+	jsonScore
+	Penta        *jsonPenta   `json:"pentanomial,omitempty"`
+	EloBootstrap *jsonEloDiff `json:"elo_bootstrap,omitempty"`
+}
+
+type jsonStanding struct {
+	Name   string  `json:"name"`
+	Points float64 `json:"points"`
+	Games  int     `json:"games"`
+	Score  string  `json:"score"`
+}
+
+type jsonDisplay struct {
+	mu        sync.Mutex
+	enc       *json.Encoder
+	start     time.Time
+	bootstrap int
+	sprt      sprtOptions
+	seed      uint64
+}
+
+var _ field.GameWatcher = (*jsonDisplay)(nil)
+
+func newJSONDisplay(out io.Writer, bootstrap int, sprt sprtOptions) *jsonDisplay {
+	return &jsonDisplay{
+		enc:       json.NewEncoder(out),
+		start:     time.Now(),
+		bootstrap: bootstrap,
+		sprt:      sprt,
+	}
+}
+
+func (d *jsonDisplay) emit(event string, data any) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.enc.Encode(struct {
+		Event   string  `json:"event"`
+		Elapsed float64 `json:"elapsed"`
+		Data    any     `json:"data"`
+	}{
+		Event:   event,
+		Elapsed: time.Since(d.start).Seconds(),
+		Data:    data,
+	}); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+func (d *jsonDisplay) score(status stat.Status, total int) jsonScore {
+	return jsonScore{
+		Win:   status.Win,
+		Draw:  status.Draw,
+		Lose:  status.Lose,
+		Games: status.Total(),
+		Total: total,
+		Score: status.ScoreString(),
+		LOS:   jsonFloat(status.LOS()),
+		Elo:   makeJSONEloDiff(status.EloDiff(0.95)),
+	}
+}
+
+func (d *jsonDisplay) Header(seed uint64) error {
+	d.seed = seed
+	return d.emit("started", struct {
+		Seed uint64 `json:"seed"`
+	}{
+		Seed: seed,
+	})
+}
+
+func (d *jsonDisplay) OnGameStarted(index int, white, black string) {
+	if err := d.emit("game_started", struct {
+		Index int    `json:"index"`
+		White string `json:"white"`
+		Black string `json:"black"`
+	}{
+		Index: index,
+		White: white,
+		Black: black,
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func (d *jsonDisplay) OnGameFinished(index int, game *battle.GameExt, warn battle.Warnings) {
+	outcome := game.Game.Outcome()
+	if err := d.emit("game_finished", struct {
+		Index    int      `json:"index"`
+		Round    int      `json:"round"`
+		White    string   `json:"white"`
+		Black    string   `json:"black"`
+		Result   string   `json:"result"`
+		Outcome  string   `json:"outcome"`
+		Plies    int      `json:"plies"`
+		Warnings []string `json:"warnings,omitempty"`
+	}{
+		Index:    index,
+		Round:    game.Round,
+		White:    game.WhiteName,
+		Black:    game.BlackName,
+		Result:   outcome.Status().String(),
+		Outcome:  outcome.String(),
+		Plies:    game.Game.Len(),
+		Warnings: warn,
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func (d *jsonDisplay) pairs(t *field.Crosstable, bootstrap bool) []jsonPair {
+	pairTotal := t.Total / len(t.Pairs)
+	res := make([]jsonPair, len(t.Pairs))
+	for k, p := range t.Pairs {
+		res[k] = jsonPair{
+			First:     t.Names[p.First],
+			Second:    t.Names[p.Second],
+			jsonScore: d.score(t.Status[k], pairTotal),
+			Penta:     makeJSONPenta(t.Penta[k]),
+		}
+		if bootstrap && d.bootstrap > 0 {
+			elo, _ := eloDiffBootstrap(t.Status[k], t.Penta[k], d.bootstrap, d.seed)
+			e := makeJSONEloDiff(elo)
+			res[k].EloBootstrap = &e
+		}
+	}
+	return res
+}
+
+func (d *jsonDisplay) standings(t *field.Crosstable) []jsonStanding {
+	standings := t.Standings()
+	res := make([]jsonStanding, len(standings))
+	for i, s := range standings {
+		res[i] = jsonStanding{
+			Name:   s.Name,
+			Points: s.Points(),
+			Games:  s.Status.Total(),
+			Score:  s.Status.ScoreString(),
+		}
+	}
+	return res
+}
+
+func (d *jsonDisplay) Display(t *field.Crosstable, _ battle.Warnings) error {
+	if len(t.Pairs) == 1 {
+		return d.emit("score", d.score(t.Status[0], t.Total))
+	}
+	return d.emit("score", struct {
+		Games int        `json:"games"`
+		Total int        `json:"total"`
+		Pairs []jsonPair `json:"pairs"`
+	}{
+		Games: t.Completed(),
+		Total: t.Total,
+		Pairs: d.pairs(t, false),
+	})
+}
+
+func (d *jsonDisplay) FinalDisplay(t *field.Crosstable) error {
+	if len(t.Pairs) != 1 {
+		return d.emit("finished", struct {
+			Games     int            `json:"games"`
+			Total     int            `json:"total"`
+			Standings []jsonStanding `json:"standings"`
+			Pairs     []jsonPair     `json:"pairs"`
+		}{
+			Games:     t.Completed(),
+			Total:     t.Total,
+			Standings: d.standings(t),
+			Pairs:     d.pairs(t, true),
+		})
+	}
+	status := t.Status[0]
+	p, winner := status.Winner(0.9, 0.95, 0.97, 0.99)
+	data := struct {
+		jsonScore
+		Winner       string       `json:"winner"`
+		WinnerP      *float64     `json:"winner_p,omitempty"`
+		SPRT         jsonSPRT     `json:"sprt"`
+		Penta        *jsonPenta   `json:"pentanomial,omitempty"`
+		EloBootstrap *jsonEloDiff `json:"elo_bootstrap,omitempty"`
+	}{
+		jsonScore: d.score(status, t.Total),
+		Winner:    winner.String(),
+		SPRT:      makeJSONSPRT(status, d.sprt),
+		Penta:     makeJSONPenta(t.Penta[0]),
+	}
+	if winner != stat.WinnerUnclear {
+		data.WinnerP = &p
+	}
+	if d.bootstrap > 0 {
+		elo, _ := eloDiffBootstrap(status, t.Penta[0], d.bootstrap, d.seed)
+		e := makeJSONEloDiff(elo)
+		data.EloBootstrap = &e
+	}
+	return d.emit("finished", data)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/enginemap"
+)
+
+type enginesConfig struct {
+	Engines map[string]enginemap.EngineOptions `toml:"engines"`
+}
+
+func loadEnginesConfig(path string) (*enginesConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	var c enginesConfig
+	if err := toml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return &c, nil
+}
+
+// PoolOptions returns the options for the engine with given name. If the engine is not found in the
+// config, then its name is considered to be the executable name.
+func (c *enginesConfig) PoolOptions(name string) (battle.EnginePoolOptions, error) {
+	if c != nil {
+		if e, ok := c.Engines[name]; ok {
+			if e.Name == "" {
+				e.Name = name
+			}
+			return e.PoolOptions(name)
+		}
+	}
+	return battle.EnginePoolOptions{ExeName: name}, nil
+}
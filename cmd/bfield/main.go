@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"os"
 	"runtime"
 	"time"
@@ -16,7 +17,6 @@ import (
 
 	"github.com/alex65536/day20/internal/battle"
 	"github.com/alex65536/day20/internal/field"
-	"github.com/alex65536/day20/internal/opening"
 	"github.com/alex65536/day20/internal/util/randutil"
 	"github.com/alex65536/day20/internal/util/sigutil"
 	"github.com/alex65536/day20/internal/util/slogx"
@@ -41,12 +41,36 @@ var (
 	aBuiltinBook       string
 	aScoreThreshold    int
 	aTimeMargin        time.Duration
+	aMoveOverhead      time.Duration
 	aQuiet             bool
 	aNoFlushAfterWrite bool
+	aBootstrap         int
+	aJSON              bool
+	aSPRTElo0          float64
+	aSPRTElo1          float64
+	aEnginesConfig     string
+	aResume            string
+	aMode              string
+	aRepeat            bool
+	aCutechessOutput   bool
+	aDebugDir          string
+	aServe             string
+	aSeed              uint64
+	aOrdered           bool
+	aFlushEvery        int
+	aSync              bool
+	aBookEvalWindow    string
+	aBookEvalEngine    string
+	aBookEvalTime      time.Duration
+	aBookMaxPlies      int
+	aBookDedup         bool
 )
 
+// compatEngines contains the engines specified in cutechess-cli command line.
+var compatEngines *enginesConfig
+
 var cmd = cobra.Command{
-	Use:   "bfield engine1 engine2",
+	Use:   "bfield engine1 engine2 [engine...]",
 	Short: "Runs matches between chess engines",
 	Long: `"Clear the battlefield and let me see..."
 
@@ -57,8 +81,15 @@ Battlefield is a tool to run matches between chess engines.
 		ctx, cancel := sigutil.NotifyContext(context.Background(), os.Interrupt)
 		defer cancel()
 
-		if len(args) != 2 {
-			return fmt.Errorf("engine names required")
+		if len(args) < 2 {
+			return fmt.Errorf("at least two engine names required")
+		}
+		mode, err := field.ModeFromString(aMode)
+		if err != nil {
+			return fmt.Errorf("bad mode: %w", err)
+		}
+		if len(args) > 2 && cmd.Flags().Lookup("resume").Changed {
+			return fmt.Errorf("resume is supported only for two engines")
 		}
 		if aGames <= 0 {
 			return fmt.Errorf("non-positive games")
@@ -72,13 +103,29 @@ Battlefield is a tool to run matches between chess engines.
 		if aTimeMargin <= 0 {
 			return fmt.Errorf("non-positive time-margin")
 		}
+		if aMoveOverhead < 0 {
+			return fmt.Errorf("negative move-overhead")
+		}
+		if aFlushEvery <= 0 {
+			return fmt.Errorf("non-positive flush-every")
+		}
+		if aBookMaxPlies < 0 {
+			return fmt.Errorf("negative book-max-plies")
+		}
+		if aBookEvalTime <= 0 {
+			return fmt.Errorf("non-positive book-eval-time")
+		}
 
 		o := field.Options{
-			Jobs:  aJobs,
-			Games: aGames,
+			Jobs:     aJobs,
+			Games:    aGames,
+			Repeat:   aRepeat,
+			Ordered:  aOrdered,
+			DebugDir: aDebugDir,
 			Battle: battle.Options{
 				DeadlineMargin: maybe.Some(aTimeMargin),
 				ScoreThreshold: int32(aScoreThreshold),
+				MoveOverhead:   aMoveOverhead,
 			},
 		}
 
@@ -102,54 +149,76 @@ Battlefield is a tool to run matches between chess engines.
 			return fmt.Errorf("no time control specified (use -t, -T or -c flags)")
 		}
 
-		var book opening.Book
-		if cmd.Flags().Lookup("fen-book").Changed {
-			if err := func() error {
-				f, err := os.Open(aFENBook)
-				if err != nil {
-					return fmt.Errorf("open: %w", err)
-				}
-				defer f.Close()
-				book, err = opening.NewFENBook(f, randutil.DefaultSource())
-				if err != nil {
-					return fmt.Errorf("parse: %w", err)
-				}
-				return nil
-			}(); err != nil {
-				return fmt.Errorf("fen book: %w", err)
+		seed := aSeed
+		if !cmd.Flags().Lookup("seed").Changed {
+			seed = rand.Uint64()
+		}
+		source := randutil.NewSeededSource(seed)
+
+		engines := compatEngines
+		if cmd.Flags().Lookup("engines-config").Changed {
+			var err error
+			engines, err = loadEnginesConfig(aEnginesConfig)
+			if err != nil {
+				return fmt.Errorf("engines config: %w", err)
 			}
-		} else if cmd.Flags().Lookup("pgn-book").Changed {
+		}
+		book, err := loadBook(ctx, cmd, source, engines, args[0])
+		if err != nil {
+			return fmt.Errorf("opening book: %w", err)
+		}
+
+		pools := make([]battle.EnginePool, 0, len(args))
+		for i, name := range args {
+			poolOpts, err := engines.PoolOptions(name)
+			if err != nil {
+				return fmt.Errorf("engine #%v options: %w", i+1, err)
+			}
+			poolOpts.Trace = aDebugDir != ""
+			pool, err := battle.NewEnginePool(ctx, slogx.DiscardLogger(), poolOpts)
+			if err != nil {
+				return fmt.Errorf("init engine #%v: %w", i+1, err)
+			}
+			defer pool.Close()
+			pools = append(pools, pool)
+		}
+
+		if cmd.Flags().Lookup("resume").Changed {
 			if err := func() error {
-				f, err := os.Open(aPGNBook)
+				f, err := os.Open(aResume)
 				if err != nil {
+					if errors.Is(err, os.ErrNotExist) {
+						// Nothing was played yet, so start from scratch.
+						return nil
+					}
 					return fmt.Errorf("open: %w", err)
 				}
 				defer f.Close()
-				book, err = opening.NewPGNLineBook(f, randutil.DefaultSource())
+				o.Resume, err = field.ResumeFromPGN(f, pools[0].Name(), pools[1].Name())
 				if err != nil {
 					return fmt.Errorf("parse: %w", err)
 				}
 				return nil
 			}(); err != nil {
-				return fmt.Errorf("pgn book: %w", err)
+				return fmt.Errorf("resume: %w", err)
 			}
-		} else {
-			switch aBuiltinBook {
-			case "gb2014":
-				book = opening.Graham20141FBook()
-			case "gb2020":
-				book = opening.GBSelect2020Book()
-			default:
-				return fmt.Errorf("unknown built-in opening book %q", aBuiltinBook)
+			if !cmd.Flags().Lookup("pgn-output").Changed {
+				aPGNOut = aResume
 			}
 		}
 
+		openOutput := func(name string) (*os.File, error) {
+			if cmd.Flags().Lookup("resume").Changed {
+				return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+			}
+			return os.Create(name)
+		}
 		var (
 			pgnOut io.Writer
 			sgsOut io.Writer
 		)
-		if cmd.Flags().Lookup("pgn-output").Changed {
-			f, err := os.Create(aPGNOut)
+		if aPGNOut != "" {
+			f, err := openOutput(aPGNOut)
 			if err != nil {
 				return fmt.Errorf("create pgn output: %w", err)
 			}
@@ -157,47 +226,74 @@ Battlefield is a tool to run matches between chess engines.
 			pgnOut = f
 		}
 		if cmd.Flags().Lookup("sgs-output").Changed {
-			f, err := os.Create(aSGSOut)
+			f, err := openOutput(aSGSOut)
 			if err != nil {
 				return fmt.Errorf("create sgs output: %w", err)
 			}
 			defer f.Close()
 			sgsOut = f
 		}
-
-		first, err := battle.NewEnginePool(ctx, slogx.DiscardLogger(), battle.EnginePoolOptions{
-			ExeName: args[0],
-		})
-		if err != nil {
-			return fmt.Errorf("init first engine: %w", err)
-		}
-		defer first.Close()
-		second, err := battle.NewEnginePool(ctx, slogx.DiscardLogger(), battle.EnginePoolOptions{
-			ExeName: args[1],
-		})
-		if err != nil {
-			return fmt.Errorf("init second engine: %w", err)
-		}
-		defer second.Close()
-
 		cmd.SilenceUsage = true
 
-		display := newDisplay(stdout, stderr, o.Games, aQuiet)
+		var (
+			display     display
+			gameWatcher field.GameWatcher
+		)
+		if aJSON {
+			jd := newJSONDisplay(os.Stdout, aBootstrap, sprtOptions{
+				Elo0: aSPRTElo0,
+				Elo1: aSPRTElo1,
+			})
+			display, gameWatcher = jd, jd
+		} else if aCutechessOutput {
+			total := o.Games * len(mode.Pairs(len(pools)))
+			cd := newCutechessDisplay(os.Stdout, os.Stderr, args, pools, total)
+			display, gameWatcher = cd, cd
+		} else {
+			display = newDisplay(stdout, stderr, o.Resume.Games, aQuiet, aBootstrap)
+		}
 		c := field.Config{
 			Writer: field.WriterConfig{
 				PGN: pgnOut,
 				SGS: sgsOut,
 				Opts: field.WriterOptions{
 					NoFlushAfterWrite: aNoFlushAfterWrite,
+					FlushEvery:        aFlushEvery,
+					Sync:              aSync,
+					Append:            o.Resume.Games != 0,
 				},
 			},
-			Book:    book,
-			First:   first,
-			Second:  second,
-			Watcher: makeWatcher(display),
+			Book:        book,
+			Engines:     pools,
+			Mode:        mode,
+			Watcher:     makeWatcher(display),
+			GameWatcher: gameWatcher,
+		}
+		if aServe != "" {
+			dash := newDashboard()
+			if err := dash.Serve(aServe); err != nil {
+				return fmt.Errorf("dashboard: %w", err)
+			}
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = dash.Shutdown(ctx)
+			}()
+			watcher := c.Watcher
+			c.Watcher = func(t *field.Crosstable, warn battle.Warnings) {
+				dash.SetCrosstable(t)
+				watcher(t, warn)
+			}
+			c.BattleWatcher = dash.BattleWatcher
 		}
-		status, err := field.Fight(ctx, o, c)
-		if err := display.FinalDisplay(status); err != nil {
+		if err := display.Header(seed); err != nil {
+			panic(err)
+		}
+		table, err := field.Fight(ctx, o, c)
+		if table == nil {
+			return fmt.Errorf("fight: %w", err)
+		}
+		if err := display.FinalDisplay(table); err != nil {
 			panic(err)
 		}
 		if err != nil {
@@ -239,7 +335,38 @@ engines with "|".
   For example, "40/900+5:900+5" means 15 minutes for 40 moves plus 5 seconds
 each move. After 40 moves pass, you are given 15 minutes for the rest of the
 game plus 5 seconds for each move. And "300|240" means 5 minutes per game for
-first, and 4 minutes per game for second.
+first, and 4 minutes per game for second. If more than two engines are given,
+the first time control applies to the engine listed earlier in each pair.
+
+` + style.WithS("Engines Config Format", 4) + `
+
+  Engines config is a TOML file which maps engine names to their options. If
+an engine name given on the command line is found in the config, the options
+from the config are used. Otherwise, the name is treated as the path to engine
+executable. For example:
+
+  [engines.sf-hash]
+  name = "stockfish"
+  args = []
+  init-timeout = "10s"
+  [engines.sf-hash.options]
+  Hash = 256
+  Threads = 2
+  EvalFile = "/path/to/nn.nnue"
+
+` + style.WithS("Cutechess-cli Compatibility", 4) + `
+
+  If -engine or -each option is given, the command line is parsed as the one
+of cutechess-cli. The following options are supported: -engine, -each (with
+cmd, name, dir, arg, proto=uci, tc, st and option.* settings), -rounds, -games,
+-repeat, -concurrency, -pgnout, -tournament, -openings, -srand and -resign (only
+its score setting). Options which do not affect the games (like -recover or -wait)
+are ignored with a warning. The progress and the results are reported in the
+cutechess-cli format. For example:
+
+  bfield -engine cmd=./new name=new -engine cmd=./base name=base \
+    -each proto=uci tc=10+0.1 option.Hash=16 -rounds 500 -repeat \
+    -concurrency 4 -openings file=book.pgn format=pgn -pgnout out.pgn
 
 ` + style.WithS("SoFGameSet Format", 4) + `
 
@@ -258,7 +385,7 @@ first, and 4 minutes per game for second.
 		"file where to write games in SoFGameSet format\n(see also \"SoFGameSet Format\" section in extra help)")
 	cmd.Flags().IntVarP(
 		&aGames, "games", "g", 0,
-		"number of games to run",
+		"number of games to run (for each pair of engines)",
 	)
 	if err := cmd.MarkFlagRequired("games"); err != nil {
 		panic(err)
@@ -290,6 +417,27 @@ first, and 4 minutes per game for second.
 			"the built-in opening books are made by Graham Banks <gbanksnz at gmail.com>\n"+
 			"(available: \"gb2020\", \"gb2014\")",
 	)
+	cmd.Flags().IntVar(
+		&aBookMaxPlies, "book-max-plies", 0,
+		"truncate PGN lines in the opening book to the given number of plies (0 for no limit)",
+	)
+	cmd.Flags().BoolVar(
+		&aBookDedup, "book-dedup", false,
+		"keep only one of the PGN lines in the opening book which reach the same position",
+	)
+	cmd.Flags().StringVar(
+		&aBookEvalWindow, "book-eval-window", "",
+		"evaluate each opening with an engine first and keep only the positions with score\n"+
+			"within the window (in centipawns, from White's perspective), e.g. \"-50:50\"",
+	)
+	cmd.Flags().StringVar(
+		&aBookEvalEngine, "book-eval-engine", "",
+		"engine used to evaluate the openings (the first engine in the match if not given)",
+	)
+	cmd.Flags().DurationVar(
+		&aBookEvalTime, "book-eval-time", 100*time.Millisecond,
+		"time to evaluate each opening",
+	)
 	cmd.Flags().IntVarP(
 		&aScoreThreshold, "score-threshold", "s", 0,
 		"end the game when both sides agree that the score is larger than the threshold (in centipawns)",
@@ -298,6 +446,10 @@ first, and 4 minutes per game for second.
 		&aTimeMargin, "time-margin", "M", 20*time.Millisecond,
 		"extra time for engine to think after deadline\n(increase this if your engine times out in fixed-time mode)",
 	)
+	cmd.Flags().DurationVar(
+		&aMoveOverhead, "move-overhead", 0,
+		"time subtracted from the clock reported to engines\n(increase this if your engine flags because of slow communication)",
+	)
 	cmd.Flags().BoolVarP(
 		&aQuiet, "quiet", "q", false,
 		"do not report progress, show only warnings and the final result",
@@ -306,6 +458,85 @@ first, and 4 minutes per game for second.
 		&aNoFlushAfterWrite, "no-flush", "F", false,
 		"do not flush data into PGN or SGS file after each game",
 	)
+	cmd.Flags().IntVar(
+		&aFlushEvery, "flush-every", 1,
+		"flush data into PGN or SGS file after every N games",
+	)
+	cmd.Flags().BoolVar(
+		&aSync, "fsync", false,
+		"also fsync PGN or SGS file after each flush, so the games survive a system crash",
+	)
+	cmd.MarkFlagsMutuallyExclusive("no-flush", "flush-every")
+	cmd.MarkFlagsMutuallyExclusive("no-flush", "fsync")
+	cmd.Flags().BoolVar(
+		&aOrdered, "ordered", false,
+		"write games strictly in the order they were started, holding the games which finished\n"+
+			"early, so an interrupted run leaves an ordered PGN file without gaps",
+	)
+	cmd.Flags().IntVar(
+		&aBootstrap, "bootstrap", 0,
+		"also show Elo difference confidence interval estimated by bootstrap\nwith the given number of iterations in the final result",
+	)
+	cmd.Flags().StringVarP(
+		&aEnginesConfig, "engines-config", "e", "",
+		"TOML file with engine options (args, UCI options and timeouts)\n"+
+			"(see also \"Engines Config Format\" section in extra help)",
+	)
+	cmd.Flags().StringVar(
+		&aMode, "mode", "round-robin",
+		"how to pair engines if more than two are given\n"+
+			"(\"round-robin\": everyone plays everyone, \"gauntlet\": the first engine plays everyone else)",
+	)
+	cmd.Flags().StringVar(
+		&aResume, "resume", "",
+		"continue an interrupted match: count the games already played in the given PGN file\n"+
+			"and append new games to it (or to the file given by -o)",
+	)
+	cmd.Flags().BoolVar(
+		&aJSON, "json", false,
+		"emit events and results as JSON lines instead of human-readable output",
+	)
+	cmd.Flags().BoolVar(
+		&aCutechessOutput, "cutechess-output", false,
+		"report progress and results in the same format as cutechess-cli",
+	)
+	cmd.MarkFlagsMutuallyExclusive("json", "quiet", "cutechess-output")
+	cmd.Flags().StringVar(
+		&aDebugDir, "debug-dir", "",
+		"directory where to store UCI transcript of each game (game-N.log)\n"+
+			"and a report for each game ended by engine error (crash-N.txt)",
+	)
+	cmd.Flags().StringVar(
+		&aServe, "serve", "",
+		"serve a live web dashboard with progress, score and running games on the given address\n"+
+			"(for example, \":8081\")",
+	)
+	cmd.Flags().BoolVar(
+		&aRepeat, "repeat", false,
+		"play each opening twice, with colors reversed",
+	)
+	cmd.Flags().Uint64Var(
+		&aSeed, "seed", 0,
+		"seed for opening selection and other randomness, to reproduce the run exactly\n"+
+			"(chosen randomly if not given; the seed is always shown in the output)",
+	)
+	cmd.Flags().Float64Var(
+		&aSPRTElo0, "sprt-elo0", 0,
+		"Elo difference for null hypothesis of SPRT reported in JSON output",
+	)
+	cmd.Flags().Float64Var(
+		&aSPRTElo1, "sprt-elo1", 5,
+		"Elo difference for alternative hypothesis of SPRT reported in JSON output",
+	)
+	if args := os.Args[1:]; isCutechessArgs(args) {
+		compat, err := translateCutechessArgs(args, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v %v\n", style.WithSE("error:", 31, 1), err)
+			os.Exit(1)
+		}
+		compatEngines = compat.Engines
+		cmd.SetArgs(compat.Args)
+	}
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
 	}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/alex65536/day20/internal/configcheck"
+)
+
+func newCheckConfigCmd(optsPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "check-config",
+		Args:  cobra.ExactArgs(0),
+		Short: "Validate options file",
+		Long: `Validate options file and report all the problems found.
+
+All the engines listed in the engine map are started to check that they respond.
+`,
+		RunE: func(cmd *cobra.Command, _args []string) error {
+			cmd.SilenceUsage = true
+			var r configcheck.Report
+			var opts Options
+			if configcheck.DecodeFile(&r, *optsPath, &opts) {
+				opts.FillDefaults()
+				if opts.Rooms <= 0 {
+					r.Fail("rooms", fmt.Errorf("non-positive number of rooms"))
+				} else {
+					r.OK("rooms", fmt.Sprint(opts.Rooms))
+				}
+				if opts.URL == "" {
+					r.Fail("url", fmt.Errorf("room api url not specified"))
+				} else if u, err := url.Parse(opts.URL); err != nil {
+					r.Fail("url", err)
+				} else if u.Scheme != "http" && u.Scheme != "https" {
+					r.Fail("url", fmt.Errorf("unsupported scheme %q", u.Scheme))
+				} else {
+					r.OK("url", opts.URL)
+				}
+				token, err := readToken(&opts)
+				if err == nil && token == "" {
+					err = fmt.Errorf("token is empty")
+				}
+				r.Check("token", err)
+				if opts.Engines == nil {
+					r.Fail("engines", fmt.Errorf("engine map not specified"))
+				} else {
+					configcheck.CheckEngineMap(cmd.Context(), &r, opts.Engines)
+				}
+			}
+			if err := r.Write(os.Stdout); err != nil {
+				return fmt.Errorf("write report: %w", err)
+			}
+			return r.Err()
+		},
+	}
+}
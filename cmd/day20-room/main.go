@@ -11,6 +11,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/alex65536/day20/internal/enginemap"
+	"github.com/alex65536/day20/internal/logging"
 	"github.com/alex65536/day20/internal/room"
 	"github.com/alex65536/day20/internal/roomapi"
 	"github.com/alex65536/day20/internal/util/slogx"
@@ -30,26 +31,55 @@ This command runs Day20 room client.
 `,
 }
 
+func loadOptions(path string) (Options, error) {
+	var opts Options
+	optsData, err := os.ReadFile(path)
+	if err != nil {
+		return Options{}, fmt.Errorf("read options file: %w", err)
+	}
+	if err := toml.Unmarshal(optsData, &opts); err != nil {
+		return Options{}, fmt.Errorf("unmarshal options file: %w", err)
+	}
+	opts.FillDefaults()
+	return opts, nil
+}
+
+func readToken(opts *Options) (string, error) {
+	if env := os.Getenv("DAY20_ROOM_TOKEN"); env != "" && opts.TokenFile == "" {
+		return strings.TrimSpace(env), nil
+	}
+	tokenFile := opts.TokenFile
+	if tokenFile == "" {
+		confDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("could not locate token")
+		}
+		tokenFile = filepath.Join(confDir, "day20", "token")
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("read token file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 func main() {
-	p := roomCmd.Flags()
+	p := roomCmd.PersistentFlags()
 	optsPath := p.StringP(
 		"options", "o", "",
 		"options file",
 	)
-	if err := roomCmd.MarkFlagRequired("options"); err != nil {
+	if err := roomCmd.MarkPersistentFlagRequired("options"); err != nil {
 		panic(err)
 	}
+	roomCmd.AddCommand(newCheckConfigCmd(optsPath))
+	roomCmd.AddCommand(newTestEngineCmd(optsPath))
 
 	roomCmd.RunE = func(cmd *cobra.Command, _args []string) error {
-		var opts Options
-		optsData, err := os.ReadFile(*optsPath)
+		opts, err := loadOptions(*optsPath)
 		if err != nil {
-			return fmt.Errorf("read options file: %w", err)
-		}
-		if err := toml.Unmarshal(optsData, &opts); err != nil {
-			return fmt.Errorf("unmarshal options file: %w", err)
+			return err
 		}
-		opts.FillDefaults()
 
 		if opts.Rooms <= 0 {
 			return fmt.Errorf("non-positive number of rooms")
@@ -61,22 +91,9 @@ func main() {
 			return fmt.Errorf("engine map not specified in options")
 		}
 
-		var token string
-		if env := os.Getenv("DAY20_ROOM_TOKEN"); env != "" && opts.TokenFile == "" {
-			token = strings.TrimSpace(env)
-		} else {
-			if opts.TokenFile == "" {
-				confDir, err := os.UserConfigDir()
-				if err != nil {
-					return fmt.Errorf("could not locate token")
-				}
-				opts.TokenFile = filepath.Join(confDir, "day20", "token")
-			}
-			data, err := os.ReadFile(opts.TokenFile)
-			if err != nil {
-				return fmt.Errorf("read token file: %w", err)
-			}
-			token = strings.TrimSpace(string(data))
+		token, err := readToken(&opts)
+		if err != nil {
+			return err
 		}
 
 		roomCmd.SilenceUsage = true
@@ -84,17 +101,25 @@ func main() {
 		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 		defer cancel()
 
-		// TODO: write neat colorful logs
-		log := slog.Default()
+		log, logCloser, err := logging.New(opts.Log)
+		if err != nil {
+			return fmt.Errorf("create logger: %w", err)
+		}
+		defer logCloser.Close()
+		slog.SetDefault(log)
 
 		group, gctx := errgroup.WithContext(ctx)
 		for range opts.Rooms {
 			group.Go(func() error {
-				return room.Loop(gctx, log, room.Options{
+				return room.Loop(gctx, logging.Module(log, "room"), room.Options{
 					Client: roomapi.ClientOptions{
 						Endpoint: opts.URL,
 						Token:    token,
 					},
+					Hardware: roomapi.Hardware{
+						Cores: opts.Cores,
+						NPS:   opts.NPS,
+					},
 				}, room.Config{
 					EngineMap: enginemap.New(*opts.Engines),
 				})
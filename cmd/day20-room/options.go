@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/alex65536/day20/internal/enginemap"
+	"github.com/alex65536/day20/internal/logging"
 	"github.com/alex65536/day20/internal/util/clone"
 )
 
@@ -10,10 +11,16 @@ type Options struct {
 	URL       string             `toml:"url"`
 	TokenFile string             `toml:"token-file"`
 	Engines   *enginemap.Options `toml:"engines"`
+	Log       logging.Options    `toml:"log"`
+	// Cores and NPS are reported to the server as the hardware of each room. If Cores is zero, the
+	// number of CPUs is reported. Zero NPS means unknown.
+	Cores int   `toml:"cores"`
+	NPS   int64 `toml:"nps"`
 }
 
 func (o Options) Clone() Options {
 	o.Engines = clone.Ptr(o.Engines)
+	o.Log = o.Log.Clone()
 	return o
 }
 
@@ -21,4 +28,5 @@ func (o *Options) FillDefaults() {
 	if o.Rooms == 0 {
 		o.Rooms = 1
 	}
+	o.Log.FillDefaults()
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/uci"
+	"github.com/alex65536/go-chess/util/maybe"
+	"github.com/spf13/cobra"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/enginemap"
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type testEngineStats struct {
+	plies      int
+	searchTime time.Duration
+	nodes      int64
+	maxDepth   int
+	maxMove    time.Duration
+}
+
+// selfPlay plays a game of the engine against itself, searching each position to the given depth.
+func selfPlay(ctx context.Context, e *uci.Engine, depth int64, maxPlies int, moveTimeout time.Duration) (*chess.Game, testEngineStats, error) {
+	var stats testEngineStats
+	game := chess.NewGame()
+	if err := e.UCINewGame(ctx, true); err != nil {
+		return nil, stats, fmt.Errorf("ucinewgame: %w", err)
+	}
+	for game.Len() < maxPlies {
+		if game.SetAutoOutcome(chess.VerdictFilterRelaxed).IsFinished() {
+			break
+		}
+		err := func() error {
+			ctx, cancel := context.WithTimeout(ctx, moveTimeout)
+			defer cancel()
+			if err := e.SetPosition(ctx, game); err != nil {
+				return fmt.Errorf("set position: %w", err)
+			}
+			start := time.Now()
+			search, err := e.Go(ctx, uci.GoOptions{Depth: maybe.Some(depth)}, nil)
+			if err != nil {
+				return fmt.Errorf("go: %w", err)
+			}
+			if err := search.Wait(ctx); err != nil {
+				return fmt.Errorf("wait: %w", err)
+			}
+			elapsed := time.Since(start)
+			mv, err := search.BestMove()
+			if err != nil {
+				return fmt.Errorf("bestmove: %w", err)
+			}
+			if err := game.PushMove(mv); err != nil {
+				return fmt.Errorf("push move: %w", err)
+			}
+			status := search.Status()
+			stats.plies++
+			stats.searchTime += elapsed
+			stats.nodes += status.Nodes
+			stats.maxDepth = max(stats.maxDepth, status.Depth)
+			stats.maxMove = max(stats.maxMove, elapsed)
+			return nil
+		}()
+		if err != nil {
+			return nil, stats, fmt.Errorf("ply %v: %w", game.Len()+1, err)
+		}
+	}
+	return game, stats, nil
+}
+
+func newTestEngineCmd(optsPath *string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test-engine name",
+		Args:  cobra.ExactArgs(1),
+		Short: "Run a short self-play game with the engine",
+		Long: `Run a short self-play game with the engine and print diagnostics.
+
+The engine is looked up in the engine map from the options file, exactly as it would be for a job
+received from the server. Use this command to validate the setup before connecting to the server.
+`,
+	}
+	p := cmd.Flags()
+	depth := p.Int64P("depth", "d", 8, "search depth for each move")
+	maxPlies := p.IntP("max-plies", "n", 40, "maximum number of plies to play")
+	moveTimeout := p.Duration("move-timeout", 30*time.Second, "maximum time to wait for each move")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if *depth <= 0 {
+			return fmt.Errorf("non-positive depth")
+		}
+		if *maxPlies <= 0 {
+			return fmt.Errorf("non-positive number of plies")
+		}
+		opts, err := loadOptions(*optsPath)
+		if err != nil {
+			return err
+		}
+		if opts.Engines == nil {
+			return fmt.Errorf("engine map not specified in options")
+		}
+		poolOpts, err := enginemap.New(*opts.Engines).GetOptions(roomapi.JobEngine{Name: args[0]})
+		if err != nil {
+			return fmt.Errorf("get engine options: %w", err)
+		}
+		poolOpts.Prewarm = 0
+
+		cmd.SilenceUsage = true
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		start := time.Now()
+		pool, err := battle.NewEnginePool(ctx, slogx.DiscardLogger(), poolOpts)
+		if err != nil {
+			return fmt.Errorf("start engine: %w", err)
+		}
+		defer pool.Close()
+		startup := time.Since(start)
+		fmt.Printf("Engine:      %v\n", pool.EngineName())
+		fmt.Printf("Executable:  %v\n", poolOpts.ExeName)
+		fmt.Printf("Startup:     %v\n", startup.Round(time.Millisecond))
+
+		e, err := pool.AcquireEngine(ctx)
+		if err != nil {
+			return fmt.Errorf("acquire engine: %w", err)
+		}
+		game, stats, err := selfPlay(ctx, e, *depth, *maxPlies, *moveTimeout)
+		if err != nil {
+			e.Close()
+			return err
+		}
+		pool.ReleaseEngine(e)
+
+		fmt.Printf("Plies:       %v\n", stats.plies)
+		fmt.Printf("Search time: %v\n", stats.searchTime.Round(time.Millisecond))
+		if stats.plies != 0 {
+			fmt.Printf("Per move:    %v avg, %v max\n",
+				(stats.searchTime / time.Duration(stats.plies)).Round(time.Microsecond),
+				stats.maxMove.Round(time.Microsecond))
+		}
+		fmt.Printf("Max depth:   %v\n", stats.maxDepth)
+		fmt.Printf("Nodes:       %v\n", stats.nodes)
+		if secs := stats.searchTime.Seconds(); secs > 0 {
+			fmt.Printf("NPS:         %.0f\n", float64(stats.nodes)/secs)
+		}
+		fmt.Printf("Outcome:     %v\n", game.Outcome())
+		fmt.Printf("Moves:       %v\n", game.UCIList())
+		return nil
+	}
+	return cmd
+}
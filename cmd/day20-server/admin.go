@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/alex65536/day20/internal/database"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/idgen"
+)
+
+// adminEnv is the environment for admin subcommands. They operate directly on the database, so they
+// can be used to recover access when logging in via the web interface is not possible.
+type adminEnv struct {
+	opts Options
+	db   *database.DB
+}
+
+func withAdminEnv(optsPath *string, f func(ctx context.Context, env *adminEnv, args []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		opts, err := loadOptions(*optsPath)
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+		log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+		db, err := database.New(log, opts.DB)
+		if err != nil {
+			return fmt.Errorf("open db: %w", err)
+		}
+		defer db.Close()
+		return f(cmd.Context(), &adminEnv{opts: opts, db: db}, args)
+	}
+}
+
+func (e *adminEnv) setPassword(u *userauth.User) error {
+	fmt.Fprintf(os.Stderr, "Enter password for user %q: ", u.Username)
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && password != "") {
+		return fmt.Errorf("read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if err := userauth.ValidatePassword(password); err != nil {
+		return err
+	}
+	if err := u.SetPassword([]byte(password), e.opts.Users.Password); err != nil {
+		return fmt.Errorf("set password: %w", err)
+	}
+	return nil
+}
+
+func parsePerm(s string) (userauth.PermKind, error) {
+	for k := range userauth.PermMax {
+		if k.String() == s {
+			return k, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown permission %q", s)
+}
+
+func setPerm(optsPath *string, value bool) func(*cobra.Command, []string) error {
+	return withAdminEnv(optsPath, func(ctx context.Context, env *adminEnv, args []string) error {
+		perm, err := parsePerm(args[1])
+		if err != nil {
+			return err
+		}
+		user, err := env.db.GetUserByUsername(ctx, args[0])
+		if err != nil {
+			return fmt.Errorf("get user: %w", err)
+		}
+		*user.Perms.GetMut(perm) = value
+		if err := env.db.UpdateUser(ctx, user, userauth.UpdateUserOptions{InvalidatePerms: true}); err != nil {
+			return fmt.Errorf("update user: %w", err)
+		}
+		return nil
+	})
+}
+
+func newAdminCmd(optsPath *string) *cobra.Command {
+	adminCmd := &cobra.Command{
+		Use:   "admin",
+		Short: "Manage users directly in the database",
+		Long: `Manage users directly in the database.
+
+These commands are intended for recovery, when logging in via the web interface is not possible.
+Passwords are read from standard input.
+`,
+	}
+
+	adminCmd.AddCommand(&cobra.Command{
+		Use:   "create-owner username",
+		Args:  cobra.ExactArgs(1),
+		Short: "Create a new user with owner permissions",
+		RunE: withAdminEnv(optsPath, func(ctx context.Context, env *adminEnv, args []string) error {
+			if err := userauth.ValidateUsername(args[0]); err != nil {
+				return err
+			}
+			user := userauth.User{
+				ID:       idgen.ID(),
+				Username: args[0],
+				Perms:    userauth.OwnerPerms(),
+			}
+			if err := env.setPassword(&user); err != nil {
+				return err
+			}
+			if err := env.db.CreateUserWithoutInvite(ctx, user); err != nil {
+				return fmt.Errorf("create user: %w", err)
+			}
+			return nil
+		}),
+	})
+
+	adminCmd.AddCommand(&cobra.Command{
+		Use:   "reset-password username",
+		Args:  cobra.ExactArgs(1),
+		Short: "Set a new password for the user",
+		Long: `Set a new password for the user.
+
+All the existing sessions of the user are invalidated.
+`,
+		RunE: withAdminEnv(optsPath, func(ctx context.Context, env *adminEnv, args []string) error {
+			user, err := env.db.GetUserByUsername(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("get user: %w", err)
+			}
+			if err := env.setPassword(&user); err != nil {
+				return err
+			}
+			if err := env.db.UpdateUser(ctx, user); err != nil {
+				return fmt.Errorf("update user: %w", err)
+			}
+			return nil
+		}),
+	})
+
+	permNames := make([]string, 0, int(userauth.PermMax))
+	for k := range userauth.PermMax {
+		permNames = append(permNames, k.String())
+	}
+	permHelp := "Known permissions: " + strings.Join(permNames, ", ") + ".\n"
+
+	adminCmd.AddCommand(&cobra.Command{
+		Use:   "grant username perm",
+		Args:  cobra.ExactArgs(2),
+		Short: "Grant a permission to the user",
+		Long:  "Grant a permission to the user.\n\n" + permHelp,
+		RunE:  setPerm(optsPath, true),
+	})
+
+	adminCmd.AddCommand(&cobra.Command{
+		Use:   "revoke username perm",
+		Args:  cobra.ExactArgs(2),
+		Short: "Revoke a permission from the user",
+		Long:  "Revoke a permission from the user.\n\n" + permHelp,
+		RunE:  setPerm(optsPath, false),
+	})
+
+	adminCmd.AddCommand(&cobra.Command{
+		Use:   "delete-user username",
+		Args:  cobra.ExactArgs(1),
+		Short: "Delete the user",
+		Long: `Delete the user together with their sessions, tokens and invite links.
+
+Contests and comments created by the user are kept.
+`,
+		RunE: withAdminEnv(optsPath, func(ctx context.Context, env *adminEnv, args []string) error {
+			user, err := env.db.GetUserByUsername(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("get user: %w", err)
+			}
+			if err := env.db.DeleteUser(ctx, user.ID); err != nil {
+				return fmt.Errorf("delete user: %w", err)
+			}
+			return nil
+		}),
+	})
+
+	return adminCmd
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alex65536/day20/internal/configcheck"
+	"github.com/alex65536/day20/internal/database"
+)
+
+// analyzeDB reports the plans of the hot queries and fails if some of them scan the whole table.
+// The missing indexes are created by the migration, which is already done when db is opened.
+func analyzeDB(ctx context.Context, db *database.DB) error {
+	plans, err := db.AnalyzeQueries(ctx)
+	if err != nil {
+		return fmt.Errorf("analyze queries: %w", err)
+	}
+	var r configcheck.Report
+	for _, p := range plans {
+		steps := strings.Join(p.Steps, "; ")
+		if len(p.Scans) != 0 {
+			r.Fail(p.Name, fmt.Errorf("full scan of %v, missing index? (%v)", strings.Join(p.Scans, ", "), steps))
+			continue
+		}
+		r.OK(p.Name, steps)
+	}
+	if err := r.Write(os.Stdout); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return r.Err()
+}
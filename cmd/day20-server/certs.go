@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+// certReloader serves the certificate from the files specified in the options. The files are
+// re-read when they change, so external tools (like certbot with a DNS-01 plugin) can renew the
+// certificate without restarting the server.
+type certReloader struct {
+	log      *slog.Logger
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+
+	mu       sync.Mutex
+	modTimes [2]time.Time
+}
+
+func newCertReloader(log *slog.Logger, o *HTTPSOptions) (*certReloader, error) {
+	r := &certReloader{
+		log:      log,
+		certFile: o.CertFile,
+		keyFile:  o.KeyFile,
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) stat() ([2]time.Time, error) {
+	var res [2]time.Time
+	for i, path := range []string{r.certFile, r.keyFile} {
+		st, err := os.Stat(path)
+		if err != nil {
+			return res, fmt.Errorf("stat: %w", err)
+		}
+		res[i] = st.ModTime()
+	}
+	return res, nil
+}
+
+// Reload re-reads the certificate if the files have changed since the last load. Returns true if
+// the certificate was replaced.
+func (r *certReloader) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	modTimes, err := r.stat()
+	if err != nil {
+		return false, err
+	}
+	if r.cert.Load() != nil && modTimes == r.modTimes {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load certificate: %w", err)
+	}
+	r.cert.Store(&cert)
+	r.modTimes = modTimes
+	return true, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+func (r *certReloader) Loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.Reload()
+			if err != nil {
+				r.log.Warn("could not reload certificate", slogx.Err(err))
+				continue
+			}
+			if changed {
+				r.log.Info("certificate reloaded")
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+
+	"github.com/alex65536/day20/internal/configcheck"
+	"github.com/alex65536/day20/internal/extauth"
+	"github.com/alex65536/day20/internal/mailer"
+	"github.com/alex65536/day20/internal/util/httputil"
+)
+
+// checkSecrets validates the secrets file without modifying it. A missing file is fine, as it is
+// generated on the first start.
+func checkSecrets(o *Options) (string, error) {
+	if o.SecretsPath == "" {
+		return "", fmt.Errorf("secrets path not specified")
+	}
+	rawSecrets, err := os.ReadFile(o.SecretsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(filepath.Dir(o.SecretsPath)); err != nil {
+			return "", fmt.Errorf("cannot create secrets file: %w", err)
+		}
+		return "missing, will be generated on start", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read secrets: %w", err)
+	}
+	var secrets Secrets
+	if err := toml.Unmarshal(rawSecrets, &secrets); err != nil {
+		return "", fmt.Errorf("unmarshal secrets: %w", err)
+	}
+	if secrets.SessionKey == "" || secrets.CSRFKey == "" {
+		return "some keys missing, will be generated on start", nil
+	}
+	if err := o.MixSecrets(&secrets); err != nil {
+		return "", err
+	}
+	if len(o.WebUI.CSRFKey) != 32 {
+		return "", fmt.Errorf("csrf key must have 32 bytes, got %v", len(o.WebUI.CSRFKey))
+	}
+	return o.SecretsPath, nil
+}
+
+func newCheckConfigCmd(optsPath *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "check-config",
+		Args:  cobra.ExactArgs(0),
+		Short: "Validate options file",
+		Long: `Validate options file and report all the problems found.
+
+The book evaluation engine, if configured, is started to check that it responds. Secrets file is
+only checked and never written.
+`,
+		RunE: func(cmd *cobra.Command, _args []string) error {
+			cmd.SilenceUsage = true
+			var r configcheck.Report
+			var opts Options
+			if configcheck.DecodeFile(&r, *optsPath, &opts) {
+				checkServerOptions(cmd, &r, &opts)
+			}
+			if err := r.Write(os.Stdout); err != nil {
+				return fmt.Errorf("write report: %w", err)
+			}
+			return r.Err()
+		},
+	}
+}
+
+func checkServerOptions(cmd *cobra.Command, r *configcheck.Report, opts *Options) {
+	if detail, err := checkSecrets(opts); err != nil {
+		r.Fail("secrets", err)
+	} else {
+		r.OK("secrets", detail)
+	}
+
+	opts.FillDefaults()
+
+	if opts.DB.Path == "" {
+		r.Fail("db", fmt.Errorf("no path to db"))
+	} else if _, err := os.Stat(filepath.Dir(opts.DB.Path)); err != nil {
+		r.Fail("db", err)
+	} else {
+		r.OK("db", opts.DB.Path)
+	}
+
+	if opts.HTTPS != nil {
+		if err := opts.HTTPS.Validate(); err != nil {
+			r.Fail("https", err)
+		} else if opts.HTTPS.ManualCert() {
+			_, err := tls.LoadX509KeyPair(opts.HTTPS.CertFile, opts.HTTPS.KeyFile)
+			r.Check("https: certificate", err)
+		} else {
+			r.OK("https", fmt.Sprintf("domains %v", opts.HTTPS.AllowedSecureDomains))
+		}
+	}
+
+	_, err := httputil.ParseTrustedProxies(opts.TrustedProxies)
+	r.Check("trusted proxies", err)
+	for _, msg := range opts.Deprecations() {
+		r.Warn("deprecated", msg)
+	}
+
+	if opts.Mail != nil {
+		_, err := mailer.New(*opts.Mail)
+		r.Check("mail", err)
+	}
+
+	names := make([]string, 0, len(opts.OAuth))
+	for name := range opts.OAuth {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		_, err := extauth.NewProvider(name, opts.OAuth[name])
+		r.Check("oauth: "+name, err)
+	}
+
+	if opts.BookEval != nil {
+		if opts.BookEval.Time <= 0 {
+			r.Fail("book eval", fmt.Errorf("non-positive time"))
+		}
+		if opts.BookEval.Jobs <= 0 {
+			r.Fail("book eval", fmt.Errorf("non-positive number of jobs"))
+		}
+		configcheck.CheckEngine(cmd.Context(), r, "book eval: engine", opts.BookEval.Engine)
+	}
+}
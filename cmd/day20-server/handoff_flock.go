@@ -0,0 +1,50 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const handoffPollInterval = 100 * time.Millisecond
+
+// acquireHandoff waits until the previous server process using the same database exits, so only one
+// process serves the rooms and writes the database at a time. The lock is released when the process
+// exits, or when the returned function is called.
+func acquireHandoff(ctx context.Context, log *slog.Logger, path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+	waiting := false
+	for {
+		err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != unix.EWOULDBLOCK {
+			_ = f.Close()
+			return nil, fmt.Errorf("lock: %w", err)
+		}
+		if !waiting {
+			log.Info("waiting for the previous server process to stop", slog.String("lock", path))
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, ctx.Err()
+		case <-time.After(handoffPollInterval):
+		}
+	}
+	if waiting {
+		log.Info("previous server process stopped")
+	}
+	return func() { _ = f.Close() }, nil
+}
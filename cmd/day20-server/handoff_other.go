@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// acquireHandoff does nothing, as the listening sockets cannot be shared between processes on this
+// platform, and the new process cannot start before the old one exits anyway.
+func acquireHandoff(_ context.Context, _ *slog.Logger, _ string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdListenFDsStart is the first file descriptor passed by systemd socket activation.
+const systemdListenFDsStart = 3
+
+// systemdListeners returns the sockets passed by systemd socket activation, keyed by their names. If
+// the names are not specified via FileDescriptorName=, the sockets are named "insecure" and "secure"
+// in the order of passing. Returns nil if the server is not socket-activated.
+func systemdListeners() (map[string]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("bad LISTEN_FDS: %w", err)
+	}
+	var names []string
+	if rawNames := os.Getenv("LISTEN_FDNAMES"); rawNames != "" {
+		names = strings.Split(rawNames, ":")
+	}
+	defaultNames := []string{"insecure", "secure"}
+	res := make(map[string]net.Listener, count)
+	for i := range count {
+		var name string
+		switch {
+		case i < len(names) && names[i] != "" && names[i] != "unknown":
+			name = names[i]
+		case i < len(defaultNames):
+			name = defaultNames[i]
+		default:
+			return nil, fmt.Errorf("too many sockets passed")
+		}
+		f := os.NewFile(uintptr(systemdListenFDsStart+i), name)
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %q: %w", name, err)
+		}
+		if _, ok := res[name]; ok {
+			return nil, fmt.Errorf("duplicate socket %q", name)
+		}
+		res[name] = ln
+	}
+	return res, nil
+}
+
+// listen creates a listener on addr. With reusePort, the socket is created with SO_REUSEPORT, so
+// the new server process can start listening before the old one stops.
+func listen(ctx context.Context, addr string, reusePort bool) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+	return lc.Listen(ctx, "tcp", addr)
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func reusePortControl(_network, _address string, _c syscall.RawConn) error {
+	return fmt.Errorf("SO_REUSEPORT is not supported on this platform")
+}
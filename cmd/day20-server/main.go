@@ -4,14 +4,26 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"syscall"
 
 	"github.com/BurntSushi/toml"
 	"github.com/spf13/cobra"
 
+	"github.com/alex65536/day20/internal/archiver"
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/broadcast"
 	"github.com/alex65536/day20/internal/database"
+	"github.com/alex65536/day20/internal/discuss"
+	"github.com/alex65536/day20/internal/extauth"
+	"github.com/alex65536/day20/internal/logging"
+	"github.com/alex65536/day20/internal/mailer"
+	"github.com/alex65536/day20/internal/notify"
+	"github.com/alex65536/day20/internal/rater"
 	"github.com/alex65536/day20/internal/roomapi"
 	"github.com/alex65536/day20/internal/roomkeeper"
 	"github.com/alex65536/day20/internal/scheduler"
@@ -31,79 +43,192 @@ This command runs Day20 server.
 `,
 }
 
+func loadOptions(path string) (Options, error) {
+	rawOpts, err := os.ReadFile(path)
+	if err != nil {
+		return Options{}, fmt.Errorf("read options: %w", err)
+	}
+	var opts Options
+	if err := toml.Unmarshal(rawOpts, &opts); err != nil {
+		return Options{}, fmt.Errorf("unmarshal options: %w", err)
+	}
+	if err := opts.MixSecretsFromFile(); err != nil {
+		return Options{}, fmt.Errorf("mix secrets into options: %w", err)
+	}
+	opts.FillDefaults()
+	return opts, nil
+}
+
 func main() {
-	p := serverCmd.Flags()
+	p := serverCmd.PersistentFlags()
 	optsPath := p.StringP(
 		"options", "o", "",
 		"options file",
 	)
-	if err := serverCmd.MarkFlagRequired("options"); err != nil {
+	if err := serverCmd.MarkPersistentFlagRequired("options"); err != nil {
 		panic(err)
 	}
+	analyze := serverCmd.Flags().Bool(
+		"analyze-db", false,
+		"migrate db, report plans of hot queries and exit",
+	)
+	serverCmd.AddCommand(newAdminCmd(optsPath))
+	serverCmd.AddCommand(newCheckConfigCmd(optsPath))
 
 	serverCmd.RunE = func(cmd *cobra.Command, _args []string) error {
-		rawOpts, err := os.ReadFile(*optsPath)
+		opts, err := loadOptions(*optsPath)
 		if err != nil {
-			return fmt.Errorf("read options: %w", err)
+			return err
 		}
-		var opts Options
-		if err := toml.Unmarshal(rawOpts, &opts); err != nil {
-			return fmt.Errorf("unmarshal options: %w", err)
-		}
-		if err := opts.MixSecretsFromFile(); err != nil {
-			return fmt.Errorf("mix secrets into options: %w", err)
-		}
-		opts.FillDefaults()
 
 		serverCmd.SilenceUsage = true
 
-		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 		defer cancel()
 
-		// TODO: write neat colorful logs
-		log := slog.Default()
+		log, logCloser, err := logging.New(opts.Log)
+		if err != nil {
+			return fmt.Errorf("create logger: %w", err)
+		}
+		defer logCloser.Close()
+		slog.SetDefault(log)
+		for _, msg := range opts.Deprecations() {
+			log.Warn(msg)
+		}
+
+		// During the restart, the new process listens alongside the old one, but neither serves the
+		// requests nor loads the state until the old process writes everything to the database and
+		// exits. Meanwhile, the new connections are queued.
+		var listeners map[string]net.Listener
+		if !*analyze {
+			listeners, err = openListeners(ctx, log, &opts)
+			if err != nil {
+				return fmt.Errorf("listen: %w", err)
+			}
+			defer closeListeners(listeners)
+			release, err := acquireHandoff(ctx, log, opts.DB.Path+".lock")
+			if err != nil {
+				return fmt.Errorf("wait for previous process: %w", err)
+			}
+			defer release()
+		}
 
-		db, err := database.New(log, opts.DB)
+		db, err := database.New(logging.Module(log, "db"), opts.DB)
 		if err != nil {
 			return fmt.Errorf("open db: %w", err)
 		}
 		defer db.Close()
-		userMgr, err := userauth.NewManager(log, db, opts.Users)
+		if *analyze {
+			return analyzeDB(ctx, db)
+		}
+		var mail *mailer.Mailer
+		if opts.Mail != nil {
+			mail, err = mailer.New(*opts.Mail)
+			if err != nil {
+				return fmt.Errorf("create mailer: %w", err)
+			}
+		}
+		userMgr, err := userauth.NewManager(logging.Module(log, "users"), db, mail, opts.Users)
 		if err != nil {
 			return fmt.Errorf("create user manager: %w", err)
 		}
 		defer userMgr.Close()
-		scheduler, err := scheduler.New(ctx, log, db, opts.Scheduler)
+		notifier, err := notify.New(logging.Module(log, "notify"), db, mail, opts.Notify)
+		if err != nil {
+			return fmt.Errorf("create notifier: %w", err)
+		}
+		defer notifier.Close()
+		scheduler, err := scheduler.New(ctx, logging.Module(log, "scheduler"), db, notifier, opts.Scheduler)
 		if err != nil {
 			return fmt.Errorf("create scheduler: %w", err)
 		}
-		keeper, err := roomkeeper.New(ctx, log, db, scheduler, opts.RoomKeeper)
+		defer scheduler.Close()
+		archiver, err := archiver.New(logging.Module(log, "archiver"), db, opts.Archiver)
+		if err != nil {
+			return fmt.Errorf("create archiver: %w", err)
+		}
+		defer archiver.Close()
+		rater := rater.New(logging.Module(log, "rater"), db, opts.Rater)
+		defer rater.Close()
+		keeper, err := roomkeeper.New(ctx, logging.Module(log, "roomkeeper"), db, scheduler, notifier, opts.RoomKeeper)
 		if err != nil {
 			return fmt.Errorf("create roomkeeper: %w", err)
 		}
 		defer keeper.Close()
+		broadcaster := broadcast.New(logging.Module(log, "broadcast"), db, keeper, scheduler, opts.Broadcast)
+		defer broadcaster.Close()
 		tokenChecker := userauth.NewTokenChecker(opts.TokenChecker, db)
 		defer tokenChecker.Close()
+		loginThrottler := userauth.NewLoginThrottler(opts.LoginLimit)
+		defer loginThrottler.Close()
+		extNames := make([]string, 0, len(opts.OAuth))
+		for name := range opts.OAuth {
+			extNames = append(extNames, name)
+		}
+		slices.Sort(extNames)
+		var extProviders []*extauth.Provider
+		for _, name := range extNames {
+			p, err := extauth.NewProvider(name, opts.OAuth[name])
+			if err != nil {
+				return fmt.Errorf("create oauth provider %q: %w", name, err)
+			}
+			extProviders = append(extProviders, p)
+		}
+		var bookEval *webui.BookEvalConfig
+		if opts.BookEval != nil {
+			poolOpts, err := opts.BookEval.Engine.PoolOptions("book-eval")
+			if err != nil {
+				return fmt.Errorf("book eval engine options: %w", err)
+			}
+			pool, err := battle.NewEnginePool(ctx, logging.Module(log, "bookeval"), poolOpts)
+			if err != nil {
+				return fmt.Errorf("create book eval engine pool: %w", err)
+			}
+			defer pool.Close()
+			bookEval = &webui.BookEvalConfig{
+				Evaluator: battle.NewEvaluator(pool, battle.EvaluatorOptions{Time: opts.BookEval.Time}),
+				Jobs:      opts.BookEval.Jobs,
+			}
+		}
 		mux := http.NewServeMux()
-		if err := roomapi.HandleServer(log, mux, "/api/room", keeper, roomapi.ServerConfig{
+		if err := roomapi.HandleServer(logging.Module(log, "roomapi"), mux, "/api/room", keeper, roomapi.ServerConfig{
 			TokenChecker: tokenChecker.Check,
 		}); err != nil {
 			return fmt.Errorf("handle server: %w", err)
 		}
-		webui.Handle(ctx, log, mux, "", webui.Config{
+		rateLimiter := webui.Handle(ctx, logging.Module(log, "webui"), mux, "", webui.Config{
 			Keeper:              keeper,
 			UserManager:         userMgr,
 			SessionStoreFactory: db,
 			Scheduler:           scheduler,
+			Rater:               rater,
+			Notifier:            notifier,
+			Broadcaster:         broadcaster,
+			Discussion:          discuss.NewBoard(db),
+			LoginThrottler:      loginThrottler,
+			ExternalAuth:        extProviders,
+			AuditLog:            logging.Module(log, "audit"),
+			BookEval:            bookEval,
 		}, opts.WebUI)
 
-		servers, err := newServers(ctx, log, &opts, mux)
+		servers, err := newServers(ctx, log, &opts, mux, listeners)
 		if err != nil {
 			return fmt.Errorf("create servers: %w", err)
 		}
 		servers.Go()
 		defer servers.Shutdown()
 
+		reloader := &reloader{
+			log:            log,
+			optsPath:       *optsPath,
+			keeper:         keeper,
+			scheduler:      scheduler,
+			loginThrottler: loginThrottler,
+			rateLimiter:    rateLimiter,
+			certs:          servers.certs,
+		}
+		go reloader.Loop(ctx)
+
 		<-ctx.Done()
 		return nil
 	}
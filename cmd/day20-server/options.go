@@ -7,41 +7,112 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/alex65536/day20/internal/archiver"
+	"github.com/alex65536/day20/internal/broadcast"
 	"github.com/alex65536/day20/internal/database"
+	"github.com/alex65536/day20/internal/enginemap"
+	"github.com/alex65536/day20/internal/extauth"
+	"github.com/alex65536/day20/internal/logging"
+	"github.com/alex65536/day20/internal/mailer"
+	"github.com/alex65536/day20/internal/notify"
+	"github.com/alex65536/day20/internal/rater"
 	"github.com/alex65536/day20/internal/roomkeeper"
 	"github.com/alex65536/day20/internal/scheduler"
 	"github.com/alex65536/day20/internal/userauth"
 	"github.com/alex65536/day20/internal/webui"
 )
 
+// HTTPSOptions configures the secure server. By default, the certificates are obtained from Let's
+// Encrypt via autocert. If CertFile and KeyFile are set, the certificate is loaded from these files
+// instead and reloaded when they change. This is useful for wildcard certificates or servers behind
+// a firewall, which are issued by external tools (e.g. via DNS-01 challenge).
 type HTTPSOptions struct {
-	Port                 uint16   `toml:"port"`
-	ExposeInsecure       bool     `toml:"expose-insecure"`
-	AllowedSecureDomains []string `toml:"allowed-secure-domains"`
-	CachePath            string   `toml:"cache-path"`
+	Port                 uint16        `toml:"port"`
+	ExposeInsecure       bool          `toml:"expose-insecure"`
+	AllowedSecureDomains []string      `toml:"allowed-secure-domains"`
+	CachePath            string        `toml:"cache-path"`
+	CertFile             string        `toml:"cert-file"`
+	KeyFile              string        `toml:"key-file"`
+	CertReloadInterval   time.Duration `toml:"cert-reload-interval"`
 }
 
-func (o *HTTPSOptions) FillDefaults() {}
+func (o *HTTPSOptions) FillDefaults() {
+	if o.CertReloadInterval == 0 {
+		o.CertReloadInterval = time.Minute
+	}
+}
+
+func (o *HTTPSOptions) ManualCert() bool {
+	return o.CertFile != "" || o.KeyFile != ""
+}
+
+func (o *HTTPSOptions) Validate() error {
+	if o.ManualCert() {
+		if o.CertFile == "" || o.KeyFile == "" {
+			return fmt.Errorf("both cert file and key file must be specified")
+		}
+		if o.CachePath != "" {
+			return fmt.Errorf("certificate cache path cannot be used with cert file")
+		}
+		return nil
+	}
+	if o.CachePath == "" {
+		return fmt.Errorf("certificate cache path not specified")
+	}
+	return nil
+}
+
+// BookEvalOptions configures the engine which evaluates the opening books on contest creation, so
+// the unbalanced positions can be filtered out. The engine runs on the server itself.
+type BookEvalOptions struct {
+	Engine enginemap.EngineOptions `toml:"engine"`
+	Time   time.Duration           `toml:"time"`
+	Jobs   int                     `toml:"jobs"`
+}
+
+func (o *BookEvalOptions) FillDefaults() {
+	if o.Time == 0 {
+		o.Time = 100 * time.Millisecond
+	}
+	if o.Jobs == 0 {
+		o.Jobs = 1
+	}
+}
 
 type Options struct {
-	Addr         string                       `toml:"addr"`
-	Port         uint16                       `toml:"port"`
-	Host         string                       `toml:"host"`
-	DB           database.Options             `toml:"db"`
-	WebUI        webui.Options                `toml:"webui"`
-	RoomKeeper   roomkeeper.Options           `toml:"roomkeeper"`
-	Users        userauth.ManagerOptions      `toml:"users"`
-	Scheduler    scheduler.Options            `toml:"scheduler"`
-	TokenChecker userauth.TokenCheckerOptions `toml:"token-checker"`
-	SecretsPath  string                       `toml:"secrets-path"`
-	HTTPS        *HTTPSOptions                `toml:"https"`
+	Addr            string                             `toml:"addr"`
+	Port            uint16                             `toml:"port"`
+	Host            string                             `toml:"host"`
+	DB              database.Options                   `toml:"db"`
+	WebUI           webui.Options                      `toml:"webui"`
+	RoomKeeper      roomkeeper.Options                 `toml:"roomkeeper"`
+	Users           userauth.ManagerOptions            `toml:"users"`
+	Scheduler       scheduler.Options                  `toml:"scheduler"`
+	Archiver        archiver.Options                   `toml:"archiver"`
+	Rater           rater.Options                      `toml:"rater"`
+	Notify          notify.Options                     `toml:"notify"`
+	Mail            *mailer.Options                    `toml:"mail"`
+	Broadcast       broadcast.Options                  `toml:"broadcast"`
+	TokenChecker    userauth.TokenCheckerOptions       `toml:"token-checker"`
+	LoginLimit      userauth.LoginThrottlerOptions     `toml:"login-limit"`
+	OAuth           map[string]extauth.ProviderOptions `toml:"oauth"`
+	SecretsPath     string                             `toml:"secrets-path"`
+	HTTPS           *HTTPSOptions                      `toml:"https"`
+	BookEval        *BookEvalOptions                   `toml:"book-eval"`
+	TrustedProxies  []string                           `toml:"trusted-proxies"`
+	ProxyHTTPS      bool                               `toml:"proxy-https"`
+	ReusePort       bool                               `toml:"reuse-port"`
+	ShutdownTimeout time.Duration                      `toml:"shutdown-timeout"`
+	Log             logging.Options                    `toml:"log"`
 }
 
 func (o *Options) urlRoot() string {
 	schema := "http"
-	if o.HTTPS != nil {
+	if o.HTTPS != nil || o.ProxyHTTPS {
 		schema = "https"
 	}
 	return fmt.Sprintf("%v://%v", schema, o.Host)
@@ -76,15 +147,46 @@ func (o *Options) FillDefaults() {
 	if o.Host == "" {
 		o.Host = o.AddrWithPort()
 	}
+	if o.ShutdownTimeout == 0 {
+		o.ShutdownTimeout = 30 * time.Second
+	}
+	if len(o.TrustedProxies) == 0 {
+		o.TrustedProxies = slices.Clone(o.WebUI.TrustedProxies)
+	}
 	o.DB.FillDefaults()
 	o.WebUI.FillDefaults()
 	o.RoomKeeper.FillDefaults()
 	o.Users.FillDefaults()
 	o.Scheduler.FillDefaults()
+	o.Archiver.FillDefaults()
+	o.Rater.FillDefaults()
+	o.Notify.FillDefaults()
+	o.Broadcast.FillDefaults()
+	o.Log.FillDefaults()
 	if o.Users.LinkPrefix == "" {
 		o.Users.LinkPrefix = o.urlRoot() + "/invite/"
 	}
+	if o.Users.VerifyLinkPrefix == "" {
+		o.Users.VerifyLinkPrefix = o.urlRoot() + "/verify-email/"
+	}
+	if o.Users.ResetLinkPrefix == "" {
+		o.Users.ResetLinkPrefix = o.urlRoot() + "/reset-password/"
+	}
+	if o.Notify.LinkPrefix == "" {
+		o.Notify.LinkPrefix = o.urlRoot() + "/contest/"
+	}
 	o.TokenChecker.FillDefaults()
+	o.LoginLimit.FillDefaults()
+	for name, p := range o.OAuth {
+		p.FillDefaults()
+		if p.RedirectURL == "" {
+			p.RedirectURL = o.urlRoot() + "/oauth/" + name + "/callback"
+		}
+		o.OAuth[name] = p
+	}
+	if o.BookEval != nil {
+		o.BookEval.FillDefaults()
+	}
 	if o.HTTPS != nil {
 		o.HTTPS.FillDefaults()
 		if o.HTTPS.AllowedSecureDomains == nil {
@@ -93,6 +195,19 @@ func (o *Options) FillDefaults() {
 	}
 }
 
+// Deprecations returns the warnings about the options set in their deprecated locations.
+func (o *Options) Deprecations() []string {
+	var res []string
+	if len(o.WebUI.TrustedProxies) != 0 {
+		if slices.Equal(o.TrustedProxies, o.WebUI.TrustedProxies) {
+			res = append(res, "webui.trusted-proxies is deprecated, move it to the top level")
+		} else {
+			res = append(res, "webui.trusted-proxies is deprecated and ignored, as trusted-proxies is set")
+		}
+	}
+	return res
+}
+
 func (o *Options) MixSecretsFromFile() error {
 	rawSecrets, err := os.ReadFile(o.SecretsPath)
 	if err != nil {
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alex65536/day20/internal/logging"
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/webui"
+)
+
+// reloader re-reads the options file on SIGHUP and applies the options which can be changed at
+// runtime: log levels, rate limits, scheduler limits and roomkeeper timeouts. The TLS certificate
+// is also re-read if it's loaded from files. Other changes require restart.
+type reloader struct {
+	log            *slog.Logger
+	optsPath       string
+	keeper         *roomkeeper.Keeper
+	scheduler      *scheduler.Scheduler
+	loginThrottler *userauth.LoginThrottler
+	rateLimiter    *webui.RateLimiter
+	certs          *certReloader
+}
+
+func (r *reloader) reload() error {
+	opts, err := loadOptions(r.optsPath)
+	if err != nil {
+		return err
+	}
+	if err := opts.Log.Validate(); err != nil {
+		return fmt.Errorf("log options: %w", err)
+	}
+	if err := r.keeper.SetOptions(opts.RoomKeeper); err != nil {
+		return fmt.Errorf("roomkeeper options: %w", err)
+	}
+	if err := logging.SetLevels(r.log, opts.Log); err != nil {
+		return fmt.Errorf("log options: %w", err)
+	}
+	r.scheduler.SetOptions(opts.Scheduler)
+	r.loginThrottler.SetOptions(opts.LoginLimit)
+	r.rateLimiter.SetOptions(opts.WebUI.RateLimit)
+	if r.certs != nil {
+		if _, err := r.certs.Reload(); err != nil {
+			return fmt.Errorf("reload certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *reloader) Loop(ctx context.Context) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+			if err := r.reload(); err != nil {
+				r.log.Warn("could not reload options", slogx.Err(err))
+				continue
+			}
+			r.log.Info("options reloaded")
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -9,55 +10,145 @@ import (
 	"net/http"
 	"slices"
 	"sync"
+	"time"
 
+	"github.com/alex65536/day20/internal/util/httputil"
 	"github.com/alex65536/day20/internal/util/slogx"
 	"golang.org/x/crypto/acme/autocert"
 )
 
 type servers struct {
-	insecure *http.Server
-	secure   *http.Server
-	wg       sync.WaitGroup
-	ctx      context.Context
-	cancel   func()
-	log      *slog.Logger
+	insecure        *http.Server
+	secure          *http.Server
+	listeners       map[string]net.Listener
+	certs           *certReloader
+	drainer         *httputil.Drainer
+	shutdownTimeout time.Duration
+	wg              sync.WaitGroup
+	ctx             context.Context
+	cancel          func()
+	log             *slog.Logger
 }
 
-func newServers(parentCtx context.Context, log *slog.Logger, o *Options, mux *http.ServeMux) (*servers, error) {
+// newServers creates the servers. They take ownership of the listeners created by openListeners.
+func newServers(parentCtx context.Context, log *slog.Logger, o *Options, mux *http.ServeMux, listeners map[string]net.Listener) (*servers, error) {
 	if o.HTTPS != nil {
-		if o.HTTPS.CachePath == "" {
-			return nil, fmt.Errorf("certificate cache path not specified")
+		if err := o.HTTPS.Validate(); err != nil {
+			return nil, fmt.Errorf("https options: %w", err)
 		}
 	}
+	proxies, err := httputil.ParseTrustedProxies(o.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("parse trusted proxies: %w", err)
+	}
+	handler := proxies.Wrap(mux)
+	drainer := httputil.NewDrainer()
 	ctx, cancel := context.WithCancel(parentCtx)
+	baseCtx := drainer.WrapContext(ctx)
 	s := &servers{
-		ctx:    ctx,
-		cancel: cancel,
-		log:    log,
+		listeners:       listeners,
+		drainer:         drainer,
+		shutdownTimeout: o.ShutdownTimeout,
+		ctx:             ctx,
+		cancel:          cancel,
+		log:             log,
 	}
 	if o.HTTPS == nil || o.HTTPS.ExposeInsecure {
 		s.insecure = &http.Server{
 			Addr:        o.AddrWithPort(),
-			Handler:     mux,
-			BaseContext: func(net.Listener) context.Context { return ctx },
+			Handler:     handler,
+			BaseContext: func(net.Listener) context.Context { return baseCtx },
 		}
 	}
 	if o.HTTPS != nil {
-		m := &autocert.Manager{
-			Prompt:     autocert.AcceptTOS,
-			HostPolicy: autocert.HostWhitelist(slices.Clone(o.HTTPS.AllowedSecureDomains)...),
-			Cache:      autocert.DirCache(o.HTTPS.CachePath),
+		var tlsConfig *tls.Config
+		if o.HTTPS.ManualCert() {
+			certs, err := newCertReloader(log, o.HTTPS)
+			if err != nil {
+				cancel()
+				return nil, fmt.Errorf("create cert reloader: %w", err)
+			}
+			s.certs = certs
+			tlsConfig = &tls.Config{GetCertificate: certs.GetCertificate}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				certs.Loop(ctx, o.HTTPS.CertReloadInterval)
+			}()
+		} else {
+			m := &autocert.Manager{
+				Prompt:     autocert.AcceptTOS,
+				HostPolicy: autocert.HostWhitelist(slices.Clone(o.HTTPS.AllowedSecureDomains)...),
+				Cache:      autocert.DirCache(o.HTTPS.CachePath),
+			}
+			tlsConfig = m.TLSConfig()
 		}
 		s.secure = &http.Server{
 			Addr:        o.SecureAddrWithPort(),
-			TLSConfig:   m.TLSConfig(),
-			Handler:     mux,
-			BaseContext: func(net.Listener) context.Context { return ctx },
+			TLSConfig:   tlsConfig,
+			Handler:     handler,
+			BaseContext: func(net.Listener) context.Context { return baseCtx },
 		}
 	}
 	return s, nil
 }
 
+// serverAddrs returns the addresses of the servers to run, keyed by their names.
+func serverAddrs(o *Options) map[string]string {
+	res := make(map[string]string)
+	if o.HTTPS == nil || o.HTTPS.ExposeInsecure {
+		res["insecure"] = o.AddrWithPort()
+	}
+	if o.HTTPS != nil {
+		res["secure"] = o.SecureAddrWithPort()
+	}
+	return res
+}
+
+// openListeners creates the listeners for all the servers, or takes them from socket activation.
+// It is called before waiting for the previous server process to stop, so the new connections are
+// queued instead of being refused during the restart.
+func openListeners(ctx context.Context, log *slog.Logger, o *Options) (map[string]net.Listener, error) {
+	listeners, err := systemdListeners()
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	if listeners == nil {
+		listeners = make(map[string]net.Listener)
+	}
+	addrs := serverAddrs(o)
+	for name, ln := range listeners {
+		if _, ok := addrs[name]; !ok {
+			log.Warn("unused activated socket", slog.String("name", name))
+			_ = ln.Close()
+			delete(listeners, name)
+		}
+	}
+	for _, name := range []string{"insecure", "secure"} {
+		addr, ok := addrs[name]
+		if !ok {
+			continue
+		}
+		if _, ok := listeners[name]; ok {
+			log.Info("using activated socket", slog.String("name", name))
+			continue
+		}
+		ln, err := listen(ctx, addr, o.ReusePort)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("listen %v: %w", name, err)
+		}
+		listeners[name] = ln
+	}
+	return listeners, nil
+}
+
+func closeListeners(listeners map[string]net.Listener) {
+	for _, ln := range listeners {
+		_ = ln.Close()
+	}
+}
+
 func (s *servers) iterServers(f func(name string, serv *http.Server)) {
 	if s.insecure != nil {
 		f("insecure", s.insecure)
@@ -77,11 +168,12 @@ func (s *servers) Go() {
 			defer s.wg.Done()
 			log := s.log.With(slog.String("name", name))
 			log.Info("starting http server")
+			ln := s.listeners[name]
 			var err error
 			if name == "secure" {
-				err = serv.ListenAndServeTLS("", "")
+				err = serv.ServeTLS(ln, "", "")
 			} else {
-				err = serv.ListenAndServe()
+				err = serv.Serve(ln)
 			}
 			if err != nil {
 				if !errors.Is(err, http.ErrServerClosed) {
@@ -96,14 +188,26 @@ func (s *servers) Go() {
 	})
 }
 
+// Shutdown stops accepting new connections and waits for the in-flight requests to finish. Websocket
+// and event stream clients are told to reconnect, so they will switch to the new server instance.
+// Room API requests are canceled, so the rooms retry them against the new instance once it starts
+// serving.
 func (s *servers) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	s.log.Info("draining http servers")
+	s.drainer.Drain()
 	s.iterServers(func(name string, serv *http.Server) {
 		log := s.log.With(slog.String("name", name))
 		log.Info("stopping http server")
-		if err := serv.Shutdown(context.Background()); err != nil {
-			log.Warn("could not shut down server", slogx.Err(err))
+		if err := serv.Shutdown(ctx); err != nil {
+			log.Warn("could not shut down server gracefully", slogx.Err(err))
+			_ = serv.Close()
 		}
 	})
+	if err := s.drainer.Wait(ctx); err != nil {
+		s.log.Warn("could not wait for streams to finish", slogx.Err(err))
+	}
 	s.cancel()
 	s.wg.Wait()
 }
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex65536/day20/internal/util/httputil"
+)
+
+type contestSummary struct {
+	FirstWins    int64    `json:"first_wins"`
+	Draws        int64    `json:"draws"`
+	SecondWins   int64    `json:"second_wins"`
+	Played       int64    `json:"played"`
+	Total        int64    `json:"total"`
+	Wins         int64    `json:"wins,omitempty"`
+	FailedJobs   int64    `json:"failed_jobs"`
+	IllegalMoves int64    `json:"illegal_moves"`
+	Score        string   `json:"score"`
+	LOS          *float64 `json:"los,omitempty"`
+	EloLow       *float64 `json:"elo_low,omitempty"`
+	EloAvg       *float64 `json:"elo_avg,omitempty"`
+	EloHigh      *float64 `json:"elo_high,omitempty"`
+}
+
+// GamesString returns the number of games played, along with the match length.
+func (s *contestSummary) GamesString() string {
+	if s.Wins > 0 {
+		return fmt.Sprintf("%v (first to %v wins)", s.Played, s.Wins)
+	}
+	return fmt.Sprintf("%v/%v", s.Played, s.Total)
+}
+
+type contest struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Kind       string          `json:"kind"`
+	OwnerID    string          `json:"owner_id,omitempty"`
+	Visibility string          `json:"visibility"`
+	Status     string          `json:"status"`
+	Reason     string          `json:"reason,omitempty"`
+	Players    []string        `json:"players"`
+	Summary    *contestSummary `json:"summary,omitempty"`
+}
+
+func (c *contest) IsFinished() bool {
+	return c.Status != "running"
+}
+
+type client struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newClient(serverURL, token string) *client {
+	return &client{
+		url:    strings.TrimSuffix(serverURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (c *client) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("marshal json: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rsp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	return rsp, nil
+}
+
+func (c *client) decodeError(rsp *http.Response) error {
+	if 200 <= rsp.StatusCode && rsp.StatusCode <= 299 {
+		return nil
+	}
+	if rsp.Header.Get("Content-Type") == "application/json" {
+		var apiErr struct {
+			Errors []string `json:"errors"`
+		}
+		if err := json.NewDecoder(rsp.Body).Decode(&apiErr); err != nil {
+			return fmt.Errorf("unmarshal json: %w", err)
+		}
+		return httputil.MakeError(rsp.StatusCode, strings.Join(apiErr.Errors, "; "))
+	}
+	return httputil.ErrorFromResponse(rsp)
+}
+
+func (c *client) do(ctx context.Context, method, path string, body any, out any) error {
+	rsp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		_ = rsp.Body.Close()
+	}()
+	if err := c.decodeError(rsp); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unmarshal json: %w", err)
+	}
+	return nil
+}
+
+func (c *client) CreateContest(ctx context.Context, fields map[string]any) (contest, error) {
+	var res contest
+	if err := c.do(ctx, http.MethodPost, "/api/contests", fields, &res); err != nil {
+		return contest{}, err
+	}
+	return res, nil
+}
+
+// maxListLimit is the maximum number of contests the server returns at once.
+const maxListLimit = 1000
+
+// ListContests lists the contests matching the query. At most limit contests are returned, zero
+// limit means no limit.
+func (c *client) ListContests(ctx context.Context, query url.Values, limit int) ([]contest, error) {
+	var contests []contest
+	query = maps.Clone(query)
+	if query == nil {
+		query = make(url.Values)
+	}
+	for {
+		if limit != 0 {
+			query.Set("limit", strconv.Itoa(min(limit-len(contests), maxListLimit)))
+		}
+		var res struct {
+			Contests   []contest `json:"contests"`
+			NextOffset *int      `json:"next_offset"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/api/contests?"+query.Encode(), nil, &res); err != nil {
+			return nil, err
+		}
+		contests = append(contests, res.Contests...)
+		if res.NextOffset == nil || (limit != 0 && len(contests) >= limit) {
+			return contests, nil
+		}
+		query.Set("offset", strconv.Itoa(*res.NextOffset))
+	}
+}
+
+func (c *client) GetContest(ctx context.Context, contestID string) (contest, error) {
+	var res contest
+	if err := c.do(ctx, http.MethodGet, "/api/contest/"+url.PathEscape(contestID), nil, &res); err != nil {
+		return contest{}, err
+	}
+	return res, nil
+}
+
+func (c *client) AbortContest(ctx context.Context, contestID string) (contest, error) {
+	var res contest
+	if err := c.do(ctx, http.MethodPost, "/api/contest/"+url.PathEscape(contestID)+"/abort", nil, &res); err != nil {
+		return contest{}, err
+	}
+	return res, nil
+}
+
+func (c *client) WriteContestPGN(ctx context.Context, contestID string, w io.Writer) error {
+	rsp, err := c.send(ctx, http.MethodGet, "/contest/"+url.PathEscape(contestID)+"/pgn", nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		_ = rsp.Body.Close()
+	}()
+	if err := c.decodeError(rsp); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, rsp.Body); err != nil {
+		return fmt.Errorf("read pgn: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func newContestCmd(o *clientOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "contest",
+		Short: "Manage contests",
+	}
+	cmd.AddCommand(newContestCreateCmd(o))
+	cmd.AddCommand(newContestListCmd(o))
+	cmd.AddCommand(newContestStatusCmd(o))
+	cmd.AddCommand(newContestAbortCmd(o))
+	cmd.AddCommand(newContestPGNCmd(o))
+	return cmd
+}
+
+// runWithClient is the common part of all the contest subcommands.
+func runWithClient(cmd *cobra.Command, o *clientOptions, f func(ctx context.Context, c *client) error) error {
+	c, err := o.newClient()
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	return f(ctx, c)
+}
+
+func newContestCreateCmd(o *clientOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Args:  cobra.ExactArgs(0),
+		Short: "Create a new match",
+		Long: `Create a new match between two engines and print its id.
+
+Exactly one of --time-control and --fixed-time must be specified.
+`,
+	}
+	p := cmd.Flags()
+	name := p.StringP("name", "n", "", "contest name")
+	first := p.String("first", "", "first engine")
+	second := p.String("second", "", "second engine")
+	games := p.Int64P("games", "g", 100, "number of games")
+	wins := p.Int64("wins", 0, "play until one of the engines reaches this number of wins instead of a fixed number of games")
+	timeControl := p.StringP("time-control", "c", "", "time control, e.g. \"40/60+1\"")
+	fixedTime := p.Duration("fixed-time", 0, "fixed time per move")
+	openings := p.String("openings", "gb20", "opening book kind (gb20, gb14, fen, pgn-line or stored)")
+	openingsData := p.String("openings-data", "", "FEN or PGN lines for fen and pgn-line books, book id for stored books")
+	openingsFile := p.String("openings-file", "", "read FEN or PGN lines from this file")
+	openingsMaxPlies := p.Int("openings-max-plies", 0, "truncate openings to this number of plies")
+	openingsDedup := p.Bool("openings-dedup", false, "remove duplicate openings")
+	openingsPinned := p.Bool("openings-pinned", false, "pin openings to game slots, so retried games replay the same opening")
+	openingsEval := p.String("openings-eval", "", "keep only the openings evaluated within this window")
+	scoreThreshold := p.Int32("score-threshold", 0, "adjudication score threshold in centipawns")
+	moveOverhead := p.Duration("move-overhead", 0, "move overhead")
+	event := p.String("event", "", "event id")
+	visibility := p.String("visibility", "public", "visibility (public, unlisted or private)")
+	asJSON := p.Bool("json", false, "print the created contest as JSON")
+	for _, f := range []string{"name", "first", "second"} {
+		if err := cmd.MarkFlagRequired(f); err != nil {
+			panic(err)
+		}
+	}
+	cmd.MarkFlagsMutuallyExclusive("time-control", "fixed-time")
+	cmd.MarkFlagsOneRequired("time-control", "fixed-time")
+	cmd.MarkFlagsMutuallyExclusive("openings-data", "openings-file")
+	cmd.MarkFlagsMutuallyExclusive("games", "wins")
+
+	cmd.RunE = func(cmd *cobra.Command, _args []string) error {
+		fields := map[string]any{
+			"name":               *name,
+			"first":              *first,
+			"second":             *second,
+			"games":              *games,
+			"openings":           *openings,
+			"openings-max-plies": *openingsMaxPlies,
+			"openings-dedup":     *openingsDedup,
+			"openings-pinned":    *openingsPinned,
+			"score-threshold":    *scoreThreshold,
+			"move-overhead":      moveOverhead.Milliseconds(),
+			"visibility":         *visibility,
+		}
+		if *wins != 0 {
+			fields["length"] = "wins"
+			fields["wins"] = *wins
+		}
+		if *timeControl != "" {
+			fields["time"] = "control"
+			fields["time-control-value"] = *timeControl
+		} else {
+			fields["time"] = "fixed"
+			fields["time-fixed-value"] = fixedTime.Milliseconds()
+		}
+		data := *openingsData
+		if *openingsFile != "" {
+			raw, err := os.ReadFile(*openingsFile)
+			if err != nil {
+				return fmt.Errorf("read openings file: %w", err)
+			}
+			data = string(raw)
+		}
+		if *openings == "stored" {
+			fields["openings-stored"] = data
+		} else {
+			fields["openings-value"] = data
+		}
+		if *openingsEval != "" {
+			fields["openings-eval"] = *openingsEval
+		}
+		if *event != "" {
+			fields["event"] = *event
+		}
+		return runWithClient(cmd, o, func(ctx context.Context, c *client) error {
+			res, err := c.CreateContest(ctx, fields)
+			if err != nil {
+				return fmt.Errorf("create contest: %w", err)
+			}
+			if *asJSON {
+				return printJSON(&res)
+			}
+			fmt.Println(res.ID)
+			return nil
+		})
+	}
+	return cmd
+}
+
+func newContestListCmd(o *clientOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Args:  cobra.ExactArgs(0),
+		Short: "List contests",
+	}
+	p := cmd.Flags()
+	mine := p.BoolP("mine", "m", false, "list only the contests owned by you")
+	statuses := p.StringSliceP("status", "s", nil, "list only the contests with these statuses (running, success, abort or fail)")
+	name := p.StringP("name", "n", "", "list only the contests with names containing this string")
+	limit := p.IntP("limit", "l", 100, "maximum number of contests to list, 0 means no limit")
+	asJSON := p.Bool("json", false, "print contests as JSON")
+
+	cmd.RunE = func(cmd *cobra.Command, _args []string) error {
+		if *limit < 0 {
+			return fmt.Errorf("negative limit")
+		}
+		query := make(url.Values)
+		if *mine {
+			query.Set("mine", "true")
+		}
+		if len(*statuses) != 0 {
+			query.Set("status", strings.Join(*statuses, ","))
+		}
+		if *name != "" {
+			query.Set("name", *name)
+		}
+		return runWithClient(cmd, o, func(ctx context.Context, c *client) error {
+			contests, err := c.ListContests(ctx, query, *limit)
+			if err != nil {
+				return fmt.Errorf("list contests: %w", err)
+			}
+			if *asJSON {
+				return printJSON(contests)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tSTATUS\tGAMES\tSCORE\tNAME")
+			for _, c := range contests {
+				games, score := "-", "-"
+				if c.Summary != nil {
+					games = c.Summary.GamesString()
+					score = c.Summary.Score
+				}
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", c.ID, c.Status, games, score, c.Name)
+			}
+			return w.Flush()
+		})
+	}
+	return cmd
+}
+
+func printContest(c *contest) {
+	fmt.Printf("ID:       %v\n", c.ID)
+	fmt.Printf("Name:     %v\n", c.Name)
+	fmt.Printf("Players:  %v\n", c.Players)
+	fmt.Printf("Status:   %v\n", c.Status)
+	if c.Reason != "" {
+		fmt.Printf("Reason:   %v\n", c.Reason)
+	}
+	if s := c.Summary; s != nil {
+		fmt.Printf("Games:    %v\n", s.GamesString())
+		fmt.Printf("Result:   +%v =%v -%v\n", s.FirstWins, s.Draws, s.SecondWins)
+		fmt.Printf("Score:    %v\n", s.Score)
+		if s.EloLow != nil && s.EloAvg != nil && s.EloHigh != nil {
+			fmt.Printf("Elo diff: %.1f [%.1f, %.1f]\n", *s.EloAvg, *s.EloLow, *s.EloHigh)
+		}
+		if s.LOS != nil {
+			fmt.Printf("LOS:      %.1f%%\n", *s.LOS*100)
+		}
+		if s.FailedJobs != 0 {
+			fmt.Printf("Failed:   %v\n", s.FailedJobs)
+		}
+	}
+}
+
+func newContestStatusCmd(o *clientOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status id",
+		Args:  cobra.ExactArgs(1),
+		Short: "Show contest status",
+		Long: `Show contest status.
+
+With --wait, the command waits until the contest finishes, and exits with non-zero code if the
+contest did not succeed. This is useful in CI pipelines.
+`,
+	}
+	p := cmd.Flags()
+	wait := p.BoolP("wait", "w", false, "wait until the contest finishes")
+	pollInterval := p.Duration("poll-interval", 30*time.Second, "how often to check the status when waiting")
+	asJSON := p.Bool("json", false, "print contest as JSON")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if *pollInterval <= 0 {
+			return fmt.Errorf("non-positive poll interval")
+		}
+		return runWithClient(cmd, o, func(ctx context.Context, c *client) error {
+			res, err := c.GetContest(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("get contest: %w", err)
+			}
+			for *wait && !res.IsFinished() {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(*pollInterval):
+				}
+				res, err = c.GetContest(ctx, args[0])
+				if err != nil {
+					return fmt.Errorf("get contest: %w", err)
+				}
+			}
+			if *asJSON {
+				if err := printJSON(&res); err != nil {
+					return err
+				}
+			} else {
+				printContest(&res)
+			}
+			if *wait && res.Status != "success" {
+				cmd.SilenceErrors = true
+				return fmt.Errorf("contest finished with status %q", res.Status)
+			}
+			return nil
+		})
+	}
+	return cmd
+}
+
+func newContestAbortCmd(o *clientOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "abort id",
+		Args:  cobra.ExactArgs(1),
+		Short: "Abort the running contest",
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return runWithClient(cmd, o, func(ctx context.Context, c *client) error {
+			res, err := c.AbortContest(ctx, args[0])
+			if err != nil {
+				return fmt.Errorf("abort contest: %w", err)
+			}
+			fmt.Printf("Contest %v: %v\n", res.ID, res.Status)
+			return nil
+		})
+	}
+	return cmd
+}
+
+func newContestPGNCmd(o *clientOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pgn id",
+		Args:  cobra.ExactArgs(1),
+		Short: "Download the games of the contest in PGN",
+	}
+	p := cmd.Flags()
+	output := p.StringP("output", "o", "", "output file, stdout if not specified")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return runWithClient(cmd, o, func(ctx context.Context, c *client) error {
+			var w io.Writer = os.Stdout
+			if *output != "" {
+				f, err := os.Create(*output)
+				if err != nil {
+					return fmt.Errorf("create output file: %w", err)
+				}
+				defer f.Close()
+				w = f
+			}
+			if err := c.WriteContestPGN(ctx, args[0], w); err != nil {
+				return fmt.Errorf("get pgn: %w", err)
+			}
+			return nil
+		})
+	}
+	return cmd
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/alex65536/day20/internal/version"
+)
+
+var rootCmd = &cobra.Command{
+	Use:     "day20",
+	Version: version.Version,
+	Short:   "Day20 client",
+	Long: `Day20 is a toolkit to run and display confrontations between chess engines.
+
+This command manages Day20 server remotely via its JSON API. Create an API token in your
+profile in the web UI first.
+`,
+}
+
+type clientOptions struct {
+	url       string
+	tokenFile string
+}
+
+func (o *clientOptions) readToken() (string, error) {
+	if env := os.Getenv("DAY20_API_TOKEN"); env != "" && o.tokenFile == "" {
+		return strings.TrimSpace(env), nil
+	}
+	tokenFile := o.tokenFile
+	if tokenFile == "" {
+		confDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("could not locate token")
+		}
+		tokenFile = filepath.Join(confDir, "day20", "api_token")
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file is empty")
+	}
+	return token, nil
+}
+
+func (o *clientOptions) newClient() (*client, error) {
+	url := o.url
+	if url == "" {
+		url = os.Getenv("DAY20_URL")
+	}
+	if url == "" {
+		return nil, fmt.Errorf("server url not specified")
+	}
+	token, err := o.readToken()
+	if err != nil {
+		return nil, err
+	}
+	return newClient(url, token), nil
+}
+
+func main() {
+	var o clientOptions
+	p := rootCmd.PersistentFlags()
+	p.StringVarP(&o.url, "url", "u", "", "server url, DAY20_URL environment variable is used if not set")
+	p.StringVarP(&o.tokenFile, "token-file", "t", "", "file with API token")
+	rootCmd.AddCommand(newContestCmd(&o))
+
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
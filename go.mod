@@ -4,12 +4,13 @@ go 1.22.1
 
 require (
 	github.com/BurntSushi/toml v1.4.0
-	github.com/NYTimes/gziphandler v1.1.1
 	github.com/alex65536/go-chess v0.9.3
+	github.com/andybalholm/brotli v1.2.0
 	github.com/dustinkirkland/golang-petname v0.0.0-20240428194347-eebcea082ee0
 	github.com/gorilla/csrf v1.7.2
 	github.com/gorilla/sessions v1.3.0
 	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.18.0
 	github.com/lucasb-eyer/go-colorful v1.2.0
 	github.com/mattn/go-colorable v0.1.13
 	github.com/mattn/go-isatty v0.0.20
@@ -17,6 +18,7 @@ require (
 	github.com/wader/gormstore/v2 v2.0.3
 	golang.org/x/crypto v0.27.0
 	golang.org/x/sync v0.8.0
+	golang.org/x/sys v0.25.0
 	golang.org/x/time v0.6.0
 	gorm.io/driver/sqlite v1.5.6
 	gorm.io/gorm v1.25.12
@@ -30,6 +32,5 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.22 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/net v0.21.0 // indirect
-	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
 )
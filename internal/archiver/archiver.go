@@ -0,0 +1,201 @@
+package archiver
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+type Options struct {
+	Interval        time.Duration `toml:"interval"`
+	ArchiveAfter    time.Duration `toml:"archive-after"`
+	ExportDir       string        `toml:"export-dir"`
+	PruneFailedJobs bool          `toml:"prune-failed-jobs"`
+	PrunePGN        bool          `toml:"prune-pgn"`
+}
+
+func (o Options) Clone() Options {
+	return o
+}
+
+func (o *Options) FillDefaults() {
+	if o.Interval == 0 {
+		o.Interval = 1 * time.Hour
+	}
+}
+
+func (o *Options) Enabled() bool {
+	return o.ArchiveAfter > 0
+}
+
+func (o *Options) Validate() error {
+	if o.ArchiveAfter < 0 {
+		return fmt.Errorf("negative archive-after")
+	}
+	if o.PrunePGN && o.ExportDir == "" {
+		return fmt.Errorf("pruning pgn requires export dir, otherwise games will be lost")
+	}
+	return nil
+}
+
+type Archiver struct {
+	o      *Options
+	db     DB
+	log    *slog.Logger
+	ctx    context.Context
+	cancel func()
+	done   chan struct{}
+}
+
+func New(log *slog.Logger, db DB, o Options) (*Archiver, error) {
+	o = o.Clone()
+	o.FillDefaults()
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("bad options: %w", err)
+	}
+	if o.ExportDir != "" {
+		if err := os.MkdirAll(o.ExportDir, 0755); err != nil {
+			return nil, fmt.Errorf("create export dir: %w", err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Archiver{
+		o:      &o,
+		db:     db,
+		log:    log,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if !o.Enabled() {
+		log.Info("contest archival disabled")
+		close(a.done)
+		return a, nil
+	}
+	go a.loop()
+	return a, nil
+}
+
+func (a *Archiver) Close() {
+	a.cancel()
+	<-a.done
+}
+
+func (a *Archiver) exportPath(contestID string) string {
+	return filepath.Join(a.o.ExportDir, "contest_"+contestID+".pgn.gz")
+}
+
+func (a *Archiver) export(ctx context.Context, contestID string) (err error) {
+	jobs, err := a.db.ListContestSucceededJobs(ctx, contestID)
+	if err != nil {
+		return fmt.Errorf("list jobs: %w", err)
+	}
+
+	path := a.exportPath(contestID)
+	f, err := os.CreateTemp(a.o.ExportDir, ".contest_"+contestID+"_*.tmp")
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	w := gzip.NewWriter(f)
+	first := true
+	for _, job := range jobs {
+		if job.PGN == nil {
+			continue
+		}
+		if !first {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return fmt.Errorf("write pgn: %w", err)
+			}
+		}
+		first = false
+		if _, err := io.WriteString(w, *job.PGN); err != nil {
+			return fmt.Errorf("write pgn: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("finish gzip: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("rename file: %w", err)
+	}
+	return nil
+}
+
+func (a *Archiver) archive(ctx context.Context, contestID string) error {
+	if a.o.ExportDir != "" {
+		if err := a.export(ctx, contestID); err != nil {
+			return fmt.Errorf("export pgn: %w", err)
+		}
+	}
+	err := a.db.ArchiveContest(ctx, contestID, timeutil.NowUTC(), ArchiveOptions{
+		PruneFailedJobs: a.o.PruneFailedJobs,
+		PrunePGN:        a.o.PrunePGN,
+	})
+	if err != nil {
+		return fmt.Errorf("archive in db: %w", err)
+	}
+	return nil
+}
+
+func (a *Archiver) RunOnce(ctx context.Context) error {
+	contests, err := a.db.ListContestsToArchive(ctx, timeutil.NowUTC().Add(-a.o.ArchiveAfter))
+	if err != nil {
+		return fmt.Errorf("list contests: %w", err)
+	}
+	for _, c := range contests {
+		contestID := c.Info.ID
+		if err := a.archive(ctx, contestID); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			a.log.Warn("could not archive contest", slog.String("contest_id", contestID), slogx.Err(err))
+			continue
+		}
+		a.log.Info("archived contest", slog.String("contest_id", contestID))
+	}
+	return nil
+}
+
+func (a *Archiver) loop() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.o.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		default:
+			err := a.RunOnce(a.ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				a.log.Warn("could not archive contests", slogx.Err(err))
+			}
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package archiver
+
+import (
+	"context"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+type ArchiveOptions struct {
+	PruneFailedJobs bool
+	PrunePGN        bool
+}
+
+type DB interface {
+	ListContestsToArchive(ctx context.Context, finishedBefore timeutil.UTCTime) ([]scheduler.ContestFullData, error)
+	ListContestSucceededJobs(ctx context.Context, contestID string) ([]scheduler.FinishedJob, error)
+	ArchiveContest(ctx context.Context, contestID string, now timeutil.UTCTime, o ArchiveOptions) error
+}
@@ -2,6 +2,7 @@ package battle
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -18,7 +19,7 @@ type Watcher interface {
 	OnGameInited(game *GameExt)
 	OnGameUpdated(game *GameExt, clk maybe.Maybe[clock.Clock])
 	OnGameFinished(game *GameExt, warn Warnings)
-	OnEngineInfo(color chess.Color, status uci.SearchStatus)
+	OnEngineInfo(color chess.Color, status uci.SearchStatus, info uci.Info)
 }
 
 type Options struct {
@@ -30,6 +31,10 @@ type Options struct {
 	MaxWaitStop      maybe.Maybe[time.Duration]
 	OutcomeFilter    maybe.Maybe[chess.VerdictFilter]
 
+	// MoveOverhead is subtracted from the time reported to the engines, to compensate for the lag
+	// between the engine and us. Unlike DeadlineMargin, it doesn't affect the deadlines.
+	MoveOverhead time.Duration
+
 	// Terminate the game when both sides agree that one of them wins with Score >= ScoreThreshold.
 	// Must be set to zero for no threshold.
 	ScoreThreshold int32
@@ -65,6 +70,66 @@ type Battle struct {
 	Black   EnginePool
 	Book    opening.Book
 	Options Options
+
+	// Transcript records UCI communication during the game. Optional. Only the pools which implement
+	// TracingEnginePool and have tracing enabled are recorded.
+	Transcript *Transcript
+}
+
+func (b *Battle) setTracer(c chess.Color, e *uci.Engine, enable bool) {
+	if b.Transcript == nil {
+		return
+	}
+	p, ok := b.pool(c).(TracingEnginePool)
+	if !ok {
+		return
+	}
+	if enable {
+		p.SetEngineTracer(e, b.Transcript.logger(c))
+	} else {
+		p.SetEngineTracer(e, nil)
+	}
+}
+
+// killedBy describes the signal which killed the engine process. Empty string is returned if the
+// process wasn't killed by a signal or the pool cannot tell it.
+func (b *Battle) killedBy(c chess.Color, e *uci.Engine) string {
+	p, ok := b.pool(c).(SignaledEnginePool)
+	if !ok {
+		return ""
+	}
+	sig, ok := p.EngineKillSignal(e)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("killed by signal %d (%v)", int(sig), sig)
+}
+
+// illegalMove returns the best move reported by the engine if it's illegal or cannot be parsed.
+// Null moves are not reported, as engines use them to indicate that they cannot move.
+func (b *Battle) illegalMove(c chess.Color, e *uci.Engine, board *chess.Board) (string, bool) {
+	p, ok := b.pool(c).(MoveRecordingEnginePool)
+	if !ok {
+		return "", false
+	}
+	move, ok := p.LastBestMove(e)
+	if !ok || move == "0000" {
+		return "", false
+	}
+	if u, err := chess.UCIMoveFromString(move); err == nil {
+		if _, err := chess.LegalMoveFromUCIMove(u, board); err == nil {
+			return "", false
+		}
+	}
+	return move, true
+}
+
+type illegalMoveError struct {
+	move string
+}
+
+func (e *illegalMoveError) Error() string {
+	return fmt.Sprintf("illegal move %q", e.move)
 }
 
 func (b *Battle) pool(c chess.Color) EnginePool {
@@ -108,6 +173,29 @@ func (b *Battle) uciNewGame(ctx context.Context, e *uci.Engine) error {
 	return nil
 }
 
+func (b *Battle) goOptions(game *clock.Game) uci.GoOptions {
+	opts := uci.GoOptions{
+		TimeSpec: maybe.Pack(game.UCITimeSpec()),
+		Movetime: b.Options.FixedTime,
+	}
+	if b.Options.MoveOverhead == 0 {
+		return opts
+	}
+	// The engine must still get some positive time to think.
+	sub := func(d time.Duration) time.Duration {
+		return max(d-b.Options.MoveOverhead, time.Millisecond)
+	}
+	if spec, ok := opts.TimeSpec.TryGet(); ok {
+		spec.Wtime = sub(spec.Wtime)
+		spec.Btime = sub(spec.Btime)
+		opts.TimeSpec = maybe.Some(spec)
+	}
+	if t, ok := opts.Movetime.TryGet(); ok {
+		opts.Movetime = maybe.Some(sub(t))
+	}
+	return opts
+}
+
 type Warnings []string
 
 func (b *Battle) predictWin(score maybe.Maybe[uci.Score]) int {
@@ -164,8 +252,12 @@ func (b *Battle) doImpl(ctx context.Context, watcher Watcher) (gameExt *GameExt,
 	gameExt = &GameExt{
 		Game:        opening,
 		Scores:      make([]maybe.Maybe[uci.Score], 0, opening.Len()),
+		Times:       make([]maybe.Maybe[time.Duration], 0, opening.Len()),
+		Clocks:      make([]maybe.Maybe[time.Duration], 0, opening.Len()),
 		WhiteName:   b.White.Name(),
 		BlackName:   b.Black.Name(),
+		WhiteEngine: b.White.EngineName(),
+		BlackEngine: b.Black.EngineName(),
 		Round:       0, // Not specified.
 		TimeControl: clone.Maybe(b.Options.TimeControl),
 		FixedTime:   b.Options.FixedTime,
@@ -174,6 +266,8 @@ func (b *Battle) doImpl(ctx context.Context, watcher Watcher) (gameExt *GameExt,
 	}
 	for range opening.Len() {
 		gameExt.Scores = append(gameExt.Scores, maybe.None[uci.Score]())
+		gameExt.Times = append(gameExt.Times, maybe.None[time.Duration]())
+		gameExt.Clocks = append(gameExt.Clocks, maybe.None[time.Duration]())
 	}
 	if watcher != nil {
 		watcher.OnGameInited(gameExt)
@@ -188,6 +282,7 @@ func (b *Battle) doImpl(ctx context.Context, watcher Watcher) (gameExt *GameExt,
 	defer func() {
 		for c, e := range engines {
 			if e != nil {
+				b.setTracer(chess.Color(c), e, false)
 				b.doReleaseEngine(b.pool(chess.Color(c)), e)
 			}
 		}
@@ -198,8 +293,15 @@ func (b *Battle) doImpl(ctx context.Context, watcher Watcher) (gameExt *GameExt,
 			if err != nil {
 				return fmt.Errorf("acquire: %w", err)
 			}
+			b.setTracer(c, e, true)
 			if err := b.uciNewGame(ctx, e); err != nil {
+				b.setTracer(c, e, false)
+				// Check the signal before closing the engine, as the engine is killed on close.
+				killed := b.killedBy(c, e)
 				e.Close()
+				if killed != "" {
+					return fmt.Errorf("start game: %v: %w", killed, err)
+				}
 				return fmt.Errorf("start game: %w", err)
 			}
 			engines[c] = e
@@ -241,6 +343,7 @@ func (b *Battle) doImpl(ctx context.Context, watcher Watcher) (gameExt *GameExt,
 			deadline = time.Now().Add(b.Options.FixedTime.Get())
 		}
 		deadline = deadline.Add(b.Options.DeadlineMargin.Get())
+		started := time.Now()
 		if err := func() error {
 			ctx, cancel := context.WithDeadline(ctx, deadline)
 			defer cancel()
@@ -250,21 +353,22 @@ func (b *Battle) doImpl(ctx context.Context, watcher Watcher) (gameExt *GameExt,
 			}
 			var consumer uci.InfoConsumer
 			if watcher != nil {
-				consumer = func(search *uci.Search, _ uci.Info) {
-					watcher.OnEngineInfo(side, search.Status())
+				consumer = func(search *uci.Search, info uci.Info) {
+					watcher.OnEngineInfo(side, search.Status(), info)
 				}
 			}
 			var search *uci.Search
-			search, err := engine.Go(ctx, uci.GoOptions{
-				TimeSpec: maybe.Pack(game.UCITimeSpec()),
-				Movetime: b.Options.FixedTime,
-			}, consumer)
+			search, err := engine.Go(ctx, b.goOptions(game), consumer)
 			if err != nil {
 				game.UpdateTimer()
 				return fmt.Errorf("go: %w", err)
 			}
 			if err := search.Wait(ctx); err != nil {
 				game.UpdateTimer()
+				if move, ok := b.illegalMove(side, engine, game.CurBoard()); ok {
+					_ = game.Finish(chess.MustWinOutcome(chess.VerdictInvalidMove, side.Inv()))
+					return &illegalMoveError{move: move}
+				}
 				if !game.HasTimer() && !time.Now().Before(deadline) {
 					_ = game.Finish(chess.MustWinOutcome(chess.VerdictTimeForfeit, side.Inv()))
 				}
@@ -279,11 +383,27 @@ func (b *Battle) doImpl(ctx context.Context, watcher Watcher) (gameExt *GameExt,
 			}
 			if game.Inner().Len() != len(gameExt.Scores) {
 				gameExt.Scores = append(gameExt.Scores, search.Status().Score)
+				gameExt.Times = append(gameExt.Times, maybe.Some(time.Since(started)))
+				clk := maybe.None[time.Duration]()
+				if c, ok := game.Clock(); ok {
+					clk = maybe.Some(*c.Side(side))
+				}
+				gameExt.Clocks = append(gameExt.Clocks, clk)
 			}
 			b.checkResign(game, gameExt.Scores)
 			return nil
 		}(); err != nil {
-			warn = append(warn, fmt.Sprintf("engine %q: error: %v", b.pool(side).Name(), err))
+			var illegal *illegalMoveError
+			switch {
+			case errors.As(err, &illegal):
+				warn = append(warn, fmt.Sprintf("engine %q: %v", b.pool(side).Name(), err))
+			default:
+				if killed := b.killedBy(side, engine); killed != "" {
+					warn = append(warn, fmt.Sprintf("engine %q: %v: %v", b.pool(side).Name(), killed, err))
+				} else {
+					warn = append(warn, fmt.Sprintf("engine %q: error: %v", b.pool(side).Name(), err))
+				}
+			}
 			if !game.IsFinished() {
 				_ = game.Finish(chess.MustWinOutcome(chess.VerdictEngineError, side.Inv()))
 			}
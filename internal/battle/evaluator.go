@@ -0,0 +1,78 @@
+package battle
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/uci"
+	"github.com/alex65536/go-chess/util/maybe"
+
+	"github.com/alex65536/day20/internal/opening"
+)
+
+type EvaluatorOptions struct {
+	// Time is the time given to the engine to think on each position.
+	Time time.Duration
+	// Margin is the extra time for the engine to finish the search after Time passes.
+	Margin time.Duration
+}
+
+func (o *EvaluatorOptions) FillDefaults() {
+	if o.Time == 0 {
+		o.Time = 100 * time.Millisecond
+	}
+	if o.Margin == 0 {
+		o.Margin = 1 * time.Second
+	}
+}
+
+type engineEvaluator struct {
+	pool EnginePool
+	o    EvaluatorOptions
+}
+
+var _ opening.Evaluator = (*engineEvaluator)(nil)
+
+// NewEvaluator returns the evaluator which runs searches on the engines from the pool. Multiple
+// positions may be evaluated concurrently.
+func NewEvaluator(pool EnginePool, o EvaluatorOptions) opening.Evaluator {
+	o.FillDefaults()
+	return &engineEvaluator{pool: pool, o: o}
+}
+
+func (v *engineEvaluator) Evaluate(ctx context.Context, game *chess.Game) (uci.Score, error) {
+	e, err := v.pool.AcquireEngine(ctx)
+	if err != nil {
+		return uci.Score{}, fmt.Errorf("acquire engine: %w", err)
+	}
+	score, err := func() (uci.Score, error) {
+		ctx, cancel := context.WithTimeout(ctx, v.o.Time+v.o.Margin)
+		defer cancel()
+		if err := e.UCINewGame(ctx, true); err != nil {
+			return uci.Score{}, fmt.Errorf("ucinewgame: %w", err)
+		}
+		if err := e.SetPosition(ctx, game); err != nil {
+			return uci.Score{}, fmt.Errorf("set position: %w", err)
+		}
+		search, err := e.Go(ctx, uci.GoOptions{Movetime: maybe.Some(v.o.Time)}, nil)
+		if err != nil {
+			return uci.Score{}, fmt.Errorf("go: %w", err)
+		}
+		if err := search.Wait(ctx); err != nil {
+			return uci.Score{}, fmt.Errorf("wait: %w", err)
+		}
+		score, ok := search.Status().Score.TryGet()
+		if !ok {
+			return uci.Score{}, fmt.Errorf("no score reported")
+		}
+		return score, nil
+	}()
+	if err != nil {
+		e.Close()
+		return uci.Score{}, err
+	}
+	v.pool.ReleaseEngine(e)
+	return score, nil
+}
@@ -23,6 +23,16 @@ type GameExt struct {
 	FixedTime   maybe.Maybe[time.Duration]
 	StartTime   time.Time
 	Event       string
+
+	// WhiteEngine and BlackEngine are the names reported by the engines themselves. May be empty if
+	// unknown.
+	WhiteEngine string
+	BlackEngine string
+
+	// Times contains the time spent on each move, and Clocks contains the time left on the clock of
+	// the side which made the move. Both have the same length as Scores.
+	Times  []maybe.Maybe[time.Duration]
+	Clocks []maybe.Maybe[time.Duration]
 }
 
 func sgsSanitize(s string) string {
@@ -71,6 +81,41 @@ func invScore(s uci.Score) uci.Score {
 	panic("must not happen")
 }
 
+// WhiteScores converts the scores of the moves made by each side into white's point of view.
+func WhiteScores(startSide chess.Color, scores []maybe.Maybe[uci.Score]) []maybe.Maybe[uci.Score] {
+	res := make([]maybe.Maybe[uci.Score], len(scores))
+	side := startSide
+	for i, sc := range scores {
+		if s, ok := sc.TryGet(); ok && side == chess.ColorBlack {
+			sc = maybe.Some(invScore(s))
+		}
+		res[i] = sc
+		side = side.Inv()
+	}
+	return res
+}
+
+func (g *GameExt) WhiteScores() []maybe.Maybe[uci.Score] {
+	return WhiteScores(g.Game.StartPos().Side, g.Scores)
+}
+
+// formatPGNDuration formats the duration as h:mm:ss with optional fractional part, as expected
+// by %clk and %emt commands.
+func formatPGNDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Round(time.Millisecond)
+	h := int64(d / time.Hour)
+	m := int64(d/time.Minute) % 60
+	sec := int64(d/time.Second) % 60
+	res := fmt.Sprintf("%d:%02d:%02d", h, m, sec)
+	if ms := int64(d/time.Millisecond) % 1000; ms != 0 {
+		res += strings.TrimRight(fmt.Sprintf(".%03d", ms), "0")
+	}
+	return res
+}
+
 func pgnDoWordWrap(b *strings.Builder, s string, maxLineLen int) {
 	var words []string
 	r := 0
@@ -158,11 +203,13 @@ func (g *GameExt) PGN() (string, error) {
 		_, _ = b.WriteString(makePGNTag("Termination", "adjudication"))
 	case chess.VerdictEngineError:
 		_, _ = b.WriteString(makePGNTag("Termination", "rules infraction"))
+	case chess.VerdictInvalidMove:
+		_, _ = b.WriteString(makePGNTag("Termination", "illegal move"))
 	}
 	_ = b.WriteByte('\n')
 
 	glen := g.Game.Len()
-	comments := make([][]string, glen+1)
+	commands := make([][]string, glen+1)
 	side := g.Game.StartPos().Side
 	for i, maybeSc := range g.Scores {
 		if maybeSc.IsSome() {
@@ -170,10 +217,26 @@ func (g *GameExt) PGN() (string, error) {
 			if side == chess.ColorBlack {
 				sc = invScore(sc)
 			}
-			comments[i+1] = append(comments[i+1], fmt.Sprintf("[%%eval %v]", sc))
+			commands[i+1] = append(commands[i+1], fmt.Sprintf("[%%eval %v]", sc))
 		}
 		side = side.Inv()
 	}
+	for i, maybeClk := range g.Clocks {
+		if clk, ok := maybeClk.TryGet(); ok {
+			commands[i+1] = append(commands[i+1], fmt.Sprintf("[%%clk %v]", formatPGNDuration(clk)))
+		}
+	}
+	for i, maybeTime := range g.Times {
+		if t, ok := maybeTime.TryGet(); ok {
+			commands[i+1] = append(commands[i+1], fmt.Sprintf("[%%emt %v]", formatPGNDuration(t)))
+		}
+	}
+	comments := make([][]string, glen+1)
+	for i, cmds := range commands {
+		if len(cmds) != 0 {
+			comments[i] = append(comments[i], strings.Join(cmds, " "))
+		}
+	}
 	if g.Game.IsFinished() {
 		s := g.Game.Outcome().String()
 		s = strings.ToUpper(s[:1]) + s[1:]
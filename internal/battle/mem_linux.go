@@ -0,0 +1,25 @@
+//go:build linux
+
+package battle
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+const memoryLimitSupported = true
+
+// memoryLimitedCommand returns the command which runs the engine with its address space limited to
+// limit bytes. The limit is set by the shell in the child process, which then executes the engine
+// in place, so the limit is in effect before the engine starts and the process ID is the same.
+func memoryLimitedCommand(limit int64, name string, args ...string) (*exec.Cmd, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("find engine: %w", err)
+	}
+	// "ulimit -v" accepts the limit in kilobytes.
+	kb := strconv.FormatInt(max(limit>>10, 1), 10)
+	shArgs := append([]string{"-c", `ulimit -v "$0" && exec "$@"`, kb, path}, args...)
+	return exec.Command("/bin/sh", shArgs...), nil
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package battle
+
+import (
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestMemoryLimitedCommand(t *testing.T) {
+	cmd, err := memoryLimitedCommand(64<<20, "sh", "-c", `echo "$(ulimit -v) $0 $1"`, "a b", "c")
+	if err != nil {
+		t.Fatalf("create command: %v", err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("run command: %v", err)
+	}
+	if got, expected := strings.TrimSpace(string(out)), "65536 a b c"; got != expected {
+		t.Fatalf("bad output: expected = %q, got = %q", expected, got)
+	}
+}
+
+func TestExitSignal(t *testing.T) {
+	err := exec.Command("sh", "-c", "kill -9 $$").Run()
+	sig, ok := exitSignal(err)
+	if !ok || sig != syscall.SIGKILL {
+		t.Fatalf("bad signal: expected = %v, got = %v (ok = %v)", syscall.SIGKILL, sig, ok)
+	}
+	if _, ok := exitSignal(exec.Command("sh", "-c", "exit 3").Run()); ok {
+		t.Fatalf("signal reported for normal exit")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package battle
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+const memoryLimitSupported = false
+
+func memoryLimitedCommand(_ int64, _ string, _ ...string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("memory limit not supported")
+}
@@ -0,0 +1,216 @@
+package battle
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/clock"
+	"github.com/alex65536/go-chess/uci"
+	"github.com/alex65536/go-chess/util/maybe"
+)
+
+var (
+	pgnTagRegex      = regexp.MustCompile(`^\[([A-Za-z0-9_]+)\s+"((?:[^"\\]|\\.)*)"\]$`)
+	pgnMoveNumRegex  = regexp.MustCompile(`^[0-9]+\.+$`)
+	pgnEvalRegex     = regexp.MustCompile(`\[%eval\s+([^\]\s]+)\]`)
+	pgnClockRegex    = regexp.MustCompile(`\[%clk\s+([^\]\s]+)\]`)
+	pgnEmtRegex      = regexp.MustCompile(`\[%emt\s+([^\]\s]+)\]`)
+	pgnUnescapeRegex = regexp.MustCompile(`\\(.)`)
+)
+
+func parsePGNScore(s string) (uci.Score, error) {
+	if m, ok := strings.CutPrefix(s, "#"); ok {
+		v, err := strconv.ParseInt(m, 10, 32)
+		if err != nil {
+			return uci.Score{}, fmt.Errorf("bad mate score: %w", err)
+		}
+		return uci.ScoreMate(int32(v)), nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return uci.Score{}, fmt.Errorf("bad score: %w", err)
+	}
+	cp := v * 100
+	if cp < 0 {
+		cp -= 0.5
+	} else {
+		cp += 0.5
+	}
+	return uci.ScoreCentipawns(int32(cp)), nil
+}
+
+func parsePGNDuration(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("bad duration %q", s)
+	}
+	secs := 0.0
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 || (i != len(parts)-1 && strings.Contains(part, ".")) {
+			return 0, fmt.Errorf("bad duration %q", s)
+		}
+		secs = secs*60 + v
+	}
+	return time.Duration(secs*float64(time.Second) + 0.5), nil
+}
+
+func pgnVerdict(termination string, status chess.Status) chess.Verdict {
+	switch termination {
+	case "time forfeit":
+		return chess.VerdictTimeForfeit
+	case "adjudication":
+		return chess.VerdictResign
+	case "rules infraction":
+		return chess.VerdictEngineError
+	case "illegal move":
+		return chess.VerdictInvalidMove
+	}
+	if status == chess.StatusDraw {
+		return chess.VerdictDrawUnknown
+	}
+	return chess.VerdictWinUnknown
+}
+
+// GameExtFromPGN parses a single game in the format produced by GameExt.PGN(). It is not a
+// general-purpose PGN parser: variations and NAGs are not supported.
+func GameExtFromPGN(pgn string) (*GameExt, error) {
+	tags := make(map[string]string)
+	lines := strings.Split(pgn, "\n")
+	i := 0
+	for ; i < len(lines); i++ {
+		ln := strings.TrimSpace(lines[i])
+		if ln == "" {
+			if len(tags) != 0 {
+				break
+			}
+			continue
+		}
+		m := pgnTagRegex.FindStringSubmatch(ln)
+		if m == nil {
+			break
+		}
+		tags[m[1]] = pgnUnescapeRegex.ReplaceAllString(m[2], "$1")
+	}
+
+	g := &GameExt{
+		WhiteName: tags["White"],
+		BlackName: tags["Black"],
+		Event:     tags["Event"],
+	}
+	if r, err := strconv.Atoi(tags["Round"]); err == nil {
+		g.Round = r
+	}
+	if d, err := time.Parse(time.DateOnly, strings.ReplaceAll(tags["Date"], ".", "-")); err == nil {
+		g.StartTime = d
+	}
+	if s, ok := tags["TimeControl"]; ok {
+		if c, err := clock.ControlFromString(s); err == nil {
+			g.TimeControl = maybe.Some(c)
+		}
+	}
+
+	if fen, ok := tags["FEN"]; ok {
+		game, err := chess.NewGameWithFEN(fen)
+		if err != nil {
+			return nil, fmt.Errorf("bad fen: %w", err)
+		}
+		g.Game = game
+	} else {
+		g.Game = chess.NewGame()
+	}
+
+	text := strings.Join(lines[i:], "\n")
+	var status chess.Status
+	for len(text) != 0 {
+		text = strings.TrimLeftFunc(text, func(r rune) bool { return r == ' ' || r == '\n' || r == '\r' || r == '\t' })
+		if text == "" {
+			break
+		}
+		if text[0] == '{' {
+			end := strings.IndexByte(text, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			comment := text[1:end]
+			text = text[end+1:]
+			if len(g.Scores) == 0 {
+				continue
+			}
+			ply := len(g.Scores) - 1
+			if m := pgnEvalRegex.FindStringSubmatch(comment); m != nil {
+				score, err := parsePGNScore(m[1])
+				if err != nil {
+					return nil, fmt.Errorf("ply %v: %w", ply+1, err)
+				}
+				if ply%2 == 1 != (g.Game.StartPos().Side == chess.ColorBlack) {
+					score = invScore(score)
+				}
+				g.Scores[ply] = maybe.Some(score)
+			}
+			if m := pgnClockRegex.FindStringSubmatch(comment); m != nil {
+				clk, err := parsePGNDuration(m[1])
+				if err != nil {
+					return nil, fmt.Errorf("ply %v: clock: %w", ply+1, err)
+				}
+				g.Clocks[ply] = maybe.Some(clk)
+			}
+			if m := pgnEmtRegex.FindStringSubmatch(comment); m != nil {
+				t, err := parsePGNDuration(m[1])
+				if err != nil {
+					return nil, fmt.Errorf("ply %v: elapsed time: %w", ply+1, err)
+				}
+				g.Times[ply] = maybe.Some(t)
+			}
+			continue
+		}
+		end := strings.IndexAny(text, " \n\r\t{")
+		if end < 0 {
+			end = len(text)
+		}
+		tok := text[:end]
+		text = text[end:]
+		if pgnMoveNumRegex.MatchString(tok) {
+			continue
+		}
+		if s, err := chess.StatusFromString(tok); err == nil {
+			status = s
+			break
+		}
+		if err := g.Game.PushMoveSAN(tok); err != nil {
+			return nil, fmt.Errorf("ply %v: bad move %q: %w", g.Game.Len()+1, tok, err)
+		}
+		g.Scores = append(g.Scores, maybe.None[uci.Score]())
+		g.Times = append(g.Times, maybe.None[time.Duration]())
+		g.Clocks = append(g.Clocks, maybe.None[time.Duration]())
+	}
+
+	if r, ok := tags["Result"]; ok {
+		if s, err := chess.StatusFromString(r); err == nil {
+			status = s
+		}
+	}
+	if status.IsFinished() && !g.Game.IsFinished() {
+		// Prefer the verdict from the rules of chess, like checkmate or stalemate, if it agrees with
+		// the result.
+		if outcome := g.Game.CalcOutcome(); outcome.Status() == status &&
+			outcome.Verdict().Passes(chess.VerdictFilterStrict) {
+			g.Game.SetOutcome(outcome)
+			return g, nil
+		}
+		verdict := pgnVerdict(tags["Termination"], status)
+		var outcome chess.Outcome
+		if winner, ok := status.Winner(); ok {
+			outcome = chess.MustWinOutcome(verdict, winner)
+		} else {
+			outcome = chess.MustDrawOutcome(verdict)
+		}
+		g.Game.SetOutcome(outcome)
+	}
+
+	return g, nil
+}
@@ -0,0 +1,223 @@
+package battle
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/clock"
+	"github.com/alex65536/go-chess/uci"
+	"github.com/alex65536/go-chess/util/maybe"
+)
+
+func TestParsePGNScore(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		expected uci.Score
+	}{
+		{"0.25", uci.ScoreCentipawns(25)},
+		{"-1.07", uci.ScoreCentipawns(-107)},
+		{"0.00", uci.ScoreCentipawns(0)},
+		{"12", uci.ScoreCentipawns(1200)},
+		{"#3", uci.ScoreMate(3)},
+		{"#-2", uci.ScoreMate(-2)},
+	} {
+		got, err := parsePGNScore(tc.s)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.s, err)
+		}
+		if got != tc.expected {
+			t.Fatalf("bad score for %q: expected = %v, got = %v", tc.s, tc.expected, got)
+		}
+	}
+	for _, s := range []string{"", "#", "#x", "abc"} {
+		if _, err := parsePGNScore(s); err == nil {
+			t.Fatalf("no error for %q", s)
+		}
+	}
+}
+
+func TestParsePGNDuration(t *testing.T) {
+	for _, tc := range []struct {
+		s        string
+		expected time.Duration
+	}{
+		{"0:00:00", 0},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"0:01:02.5", time.Minute + 2500*time.Millisecond},
+		{"3:04", 3*time.Minute + 4*time.Second},
+		{"1.25", 1250 * time.Millisecond},
+	} {
+		got, err := parsePGNDuration(tc.s)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.s, err)
+		}
+		if got != tc.expected {
+			t.Fatalf("bad duration for %q: expected = %v, got = %v", tc.s, tc.expected, got)
+		}
+		// Formatting and parsing must round-trip.
+		if got, err := parsePGNDuration(formatPGNDuration(tc.expected)); err != nil || got != tc.expected {
+			t.Fatalf("bad round-trip for %v: got = %v, err = %v", tc.expected, got, err)
+		}
+	}
+	for _, s := range []string{"", "x", "-1", "1.5:00", "1:2:3:4"} {
+		if _, err := parsePGNDuration(s); err == nil {
+			t.Fatalf("no error for %q", s)
+		}
+	}
+}
+
+func TestGameExtPGNRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		fen   string
+		moves []string
+	}{
+		{
+			fen:   chess.InitialRawBoard().FEN(),
+			moves: []string{"e4", "d5", "exd5", "Qxd5"},
+		},
+		{
+			// Black to move, so the scores of the even plies are from White's point of view.
+			fen:   "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1",
+			moves: []string{"d5", "exd5", "Qxd5", "Nc3"},
+		},
+	} {
+		fen := tc.fen
+		game, err := chess.NewGameWithFEN(fen)
+		if err != nil {
+			t.Fatalf("bad fen: %v", err)
+		}
+		for _, mv := range tc.moves {
+			if err := game.PushMoveSAN(mv); err != nil {
+				t.Fatalf("push %v: %v", mv, err)
+			}
+		}
+		game.SetOutcome(chess.MustWinOutcome(chess.VerdictTimeForfeit, chess.ColorWhite))
+		control, err := clock.ControlFromString("40/60+1")
+		if err != nil {
+			t.Fatalf("bad control: %v", err)
+		}
+		src := &GameExt{
+			Game: game,
+			Scores: []maybe.Maybe[uci.Score]{
+				maybe.Some(uci.ScoreCentipawns(-30)),
+				maybe.Some(uci.ScoreCentipawns(45)),
+				maybe.None[uci.Score](),
+				maybe.Some(uci.ScoreMate(-3)),
+			},
+			WhiteName:   "white \"engine\"",
+			BlackName:   "black",
+			Round:       7,
+			TimeControl: maybe.Some(control),
+			StartTime:   time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC),
+			Event:       "test",
+			Times: []maybe.Maybe[time.Duration]{
+				maybe.Some(1500 * time.Millisecond),
+				maybe.Some(2 * time.Second),
+				maybe.None[time.Duration](),
+				maybe.Some(1250 * time.Millisecond),
+			},
+			Clocks: []maybe.Maybe[time.Duration]{
+				maybe.Some(time.Minute),
+				maybe.Some(58 * time.Second),
+				maybe.None[time.Duration](),
+				maybe.Some(time.Hour + 30*time.Second),
+			},
+		}
+		pgn, err := src.PGN()
+		if err != nil {
+			t.Fatalf("format pgn: %v", err)
+		}
+		got, err := GameExtFromPGN(pgn)
+		if err != nil {
+			t.Fatalf("parse pgn: %v", err)
+		}
+
+		if got.WhiteName != src.WhiteName || got.BlackName != src.BlackName || got.Event != src.Event ||
+			got.Round != src.Round || !got.StartTime.Equal(src.StartTime) {
+			t.Fatalf("bad tags: expected = %+v, got = %+v", src, got)
+		}
+		if c, ok := got.TimeControl.TryGet(); !ok || c.String() != control.String() {
+			t.Fatalf("bad time control: expected = %v, got = %v", control, got.TimeControl)
+		}
+		if gotFEN := got.Game.StartPos().FEN(); gotFEN != fen {
+			t.Fatalf("bad start position: expected = %v, got = %v", fen, gotFEN)
+		}
+		if got.Game.Len() != game.Len() || got.Game.CurBoard().FEN() != game.CurBoard().FEN() {
+			t.Fatalf("bad moves: expected = %v, got = %v", game.CurBoard().FEN(), got.Game.CurBoard().FEN())
+		}
+		if got.Game.Outcome() != game.Outcome() {
+			t.Fatalf("bad outcome: expected = %v, got = %v", game.Outcome(), got.Game.Outcome())
+		}
+		if !slices.Equal(got.Scores, src.Scores) {
+			t.Fatalf("bad scores: expected = %v, got = %v", src.Scores, got.Scores)
+		}
+		if !slices.Equal(got.Times, src.Times) {
+			t.Fatalf("bad times: expected = %v, got = %v", src.Times, got.Times)
+		}
+		if !slices.Equal(got.Clocks, src.Clocks) {
+			t.Fatalf("bad clocks: expected = %v, got = %v", src.Clocks, got.Clocks)
+		}
+	}
+}
+
+func TestGameExtFromPGNOutcome(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		pgn      string
+		expected chess.Outcome
+	}{
+		{
+			name:     "unfinished",
+			pgn:      "[Result \"*\"]\n\n1. e4 e5 *\n",
+			expected: chess.RunningOutcome(),
+		},
+		{
+			name:     "no result tag",
+			pgn:      "1. e4 e5 1/2-1/2\n",
+			expected: chess.MustDrawOutcome(chess.VerdictDrawUnknown),
+		},
+		{
+			name:     "adjudication",
+			pgn:      "[Result \"0-1\"]\n[Termination \"adjudication\"]\n\n1. e4 e5 0-1\n",
+			expected: chess.MustWinOutcome(chess.VerdictResign, chess.ColorBlack),
+		},
+		{
+			name:     "illegal move",
+			pgn:      "[Result \"1-0\"]\n[Termination \"illegal move\"]\n\n1. e4 e5 1-0\n",
+			expected: chess.MustWinOutcome(chess.VerdictInvalidMove, chess.ColorWhite),
+		},
+		{
+			name:     "checkmate",
+			pgn:      "[Result \"0-1\"]\n\n1. f3 e5 2. g4 Qh4# {Black checkmates} 0-1\n",
+			expected: chess.MustWinOutcome(chess.VerdictCheckmate, chess.ColorBlack),
+		},
+		{
+			name:     "unknown win",
+			pgn:      "[Result \"1-0\"]\n\n1. e4 e5 1-0\n",
+			expected: chess.MustWinOutcome(chess.VerdictWinUnknown, chess.ColorWhite),
+		},
+	} {
+		game, err := GameExtFromPGN(tc.pgn)
+		if err != nil {
+			t.Fatalf("%v: parse pgn: %v", tc.name, err)
+		}
+		if got := game.Game.Outcome(); got != tc.expected {
+			t.Fatalf("%v: bad outcome: expected = %v, got = %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestGameExtFromPGNErrors(t *testing.T) {
+	for _, pgn := range []string{
+		"1. e4 e5 2. Ke3 *\n",
+		"1. e4 {[%eval 0.2] *\n",
+		"1. e4 {[%clk 1:x]} *\n",
+		"[FEN \"bad\"]\n\n*\n",
+	} {
+		if _, err := GameExtFromPGN(pgn); err == nil {
+			t.Fatalf("no error for %q", pgn)
+		}
+	}
+}
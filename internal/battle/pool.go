@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"log/slog"
 	"maps"
+	"os/exec"
 	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/alex65536/day20/internal/cecp"
 	"github.com/alex65536/day20/internal/util/idgen"
 	"github.com/alex65536/day20/internal/util/slogx"
 	"github.com/alex65536/go-chess/uci"
@@ -29,9 +34,135 @@ type EnginePool interface {
 	AcquireEngine(ctx context.Context) (*uci.Engine, error)
 	ReleaseEngine(e *uci.Engine)
 	Name() string
+	// EngineName returns the name reported by the engine itself via "id name".
+	EngineName() string
 	Close()
 }
 
+// TracingEnginePool is implemented by engine pools which can redirect UCI communication of their
+// engines into a given logger. Nothing is recorded unless tracing is enabled in pool options.
+type TracingEnginePool interface {
+	EnginePool
+	SetEngineTracer(e *uci.Engine, l uci.Logger)
+}
+
+// switchLogger forwards messages to the tracer which is currently attached to the engine, or to the
+// base logger if there is no such tracer.
+type switchLogger struct {
+	mu     sync.Mutex
+	base   uci.Logger
+	tracer uci.Logger
+}
+
+func (l *switchLogger) Printf(msg string, args ...any) {
+	l.mu.Lock()
+	dst := l.tracer
+	l.mu.Unlock()
+	if dst == nil {
+		dst = l.base
+	}
+	dst.Printf(msg, args...)
+}
+
+func (l *switchLogger) SetTracer(t uci.Logger) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tracer = t
+}
+
+// SignaledEnginePool is implemented by engine pools which can tell whether the engine process was
+// killed by a signal not sent by the pool, e.g. after a crash or by the OOM killer.
+type SignaledEnginePool interface {
+	EnginePool
+	EngineKillSignal(e *uci.Engine) (syscall.Signal, bool)
+}
+
+// MoveRecordingEnginePool is implemented by engine pools which remember the best move reported by
+// the engine in its last search as is, even if the move cannot be parsed.
+type MoveRecordingEnginePool interface {
+	EnginePool
+	LastBestMove(e *uci.Engine) (string, bool)
+}
+
+// watchedProcess remembers whether the process was killed by us, to tell such kills apart from the
+// ones made by the system. It also records the raw best move sent by the engine.
+type watchedProcess struct {
+	uci.Process
+	killed atomic.Bool
+
+	mu       sync.Mutex
+	bestMove maybe.Maybe[string]
+}
+
+func (p *watchedProcess) Send(s string) error {
+	if cmd, _, _ := strings.Cut(s, " "); cmd == "go" {
+		p.mu.Lock()
+		p.bestMove = maybe.None[string]()
+		p.mu.Unlock()
+	}
+	return p.Process.Send(s)
+}
+
+func (p *watchedProcess) Recv() (string, error) {
+	s, err := p.Process.Recv()
+	if err != nil {
+		return s, err
+	}
+	if fields := strings.Fields(s); len(fields) != 0 && fields[0] == "bestmove" {
+		move := ""
+		if len(fields) >= 2 {
+			move = fields[1]
+		}
+		p.mu.Lock()
+		p.bestMove = maybe.Some(move)
+		p.mu.Unlock()
+	}
+	return s, nil
+}
+
+func (p *watchedProcess) lastBestMove() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.bestMove.TryGet()
+}
+
+func (p *watchedProcess) Kill() {
+	p.killed.Store(true)
+	p.Process.Kill()
+}
+
+// killSignal returns the signal which killed the process, unless the process is still running or
+// was killed by us.
+func (p *watchedProcess) killSignal() (syscall.Signal, bool) {
+	select {
+	case <-p.Done():
+	default:
+		return 0, false
+	}
+	if p.killed.Load() {
+		return 0, false
+	}
+	return exitSignal(p.Err())
+}
+
+type Protocol string
+
+const (
+	ProtocolUCI  Protocol = "uci"
+	ProtocolCECP Protocol = "cecp"
+)
+
+func ProtocolFromString(s string) (Protocol, bool) {
+	switch s {
+	case "", "uci":
+		return ProtocolUCI, true
+	case "cecp", "xboard":
+		return ProtocolCECP, true
+	default:
+		return "", false
+	}
+}
+
 type EnginePoolOptions struct {
 	ShortName     string
 	ExeName       string
@@ -39,12 +170,51 @@ type EnginePoolOptions struct {
 	Options       map[string]uci.OptValue
 	EngineOptions uci.EngineOptions
 	CreateTimeout maybe.Maybe[time.Duration]
+	Trace         bool
+	// Protocol spoken by the engine. Engines speaking CECP are wrapped, so they look like UCI ones.
+	// Empty means UCI.
+	Protocol Protocol
+	// MaxEngines limits the number of engines running simultaneously. If the limit is reached,
+	// AcquireEngine waits until some engine is released. Zero means no limit. Note that the engine
+	// playing against itself needs two engines from the same pool.
+	MaxEngines int
+	// IdleTimeout is the time after which idle engines are closed. Zero means that idle engines are
+	// kept forever.
+	IdleTimeout time.Duration
+	// Prewarm is the number of engines spawned on pool creation. At least one engine is always
+	// spawned.
+	Prewarm int
+	// MemoryLimit is the maximum size of the address space of the engine process, in bytes. The
+	// limit is applied before the engine is executed. Zero means no limit. Supported only on Linux.
+	MemoryLimit int64
 }
 
 func (o *EnginePoolOptions) FillDefaults() {
 	o.CreateTimeout = maybe.Some(o.CreateTimeout.GetOr(5 * time.Second))
 }
 
+func (o *EnginePoolOptions) Validate() error {
+	if o.MaxEngines < 0 {
+		return fmt.Errorf("negative max engines")
+	}
+	if o.IdleTimeout < 0 {
+		return fmt.Errorf("negative idle timeout")
+	}
+	if o.Prewarm < 0 {
+		return fmt.Errorf("negative prewarm")
+	}
+	if o.MaxEngines != 0 && o.Prewarm > o.MaxEngines {
+		return fmt.Errorf("prewarm %v exceeds max engines %v", o.Prewarm, o.MaxEngines)
+	}
+	if o.MemoryLimit < 0 {
+		return fmt.Errorf("negative memory limit")
+	}
+	if o.MemoryLimit != 0 && !memoryLimitSupported {
+		return fmt.Errorf("memory limit is not supported on this platform")
+	}
+	return nil
+}
+
 func (o EnginePoolOptions) Clone() EnginePoolOptions {
 	o.Args = slices.Clone(o.Args)
 	o.Options = maps.Clone(o.Options)
@@ -55,6 +225,9 @@ func (o EnginePoolOptions) Clone() EnginePoolOptions {
 func NewEnginePool(ctx context.Context, log *slog.Logger, o EnginePoolOptions) (EnginePool, error) {
 	o = o.Clone()
 	o.FillDefaults()
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("bad options: %w", err)
+	}
 
 	if !slogx.IsDiscard(log) {
 		log = log.With(slog.String("pool_id", idgen.ID()))
@@ -62,11 +235,12 @@ func NewEnginePool(ctx context.Context, log *slog.Logger, o EnginePoolOptions) (
 
 	poolCtx, cancel := context.WithCancel(context.Background())
 	pool := &enginePool{
-		o:      o,
-		ctx:    poolCtx,
-		cancel: cancel,
-		es:     nil,
-		log:    log,
+		o:       o,
+		ctx:     poolCtx,
+		cancel:  cancel,
+		es:      nil,
+		changed: make(chan struct{}),
+		log:     log,
 	}
 
 	e, err := pool.AcquireEngine(ctx)
@@ -74,6 +248,19 @@ func NewEnginePool(ctx context.Context, log *slog.Logger, o EnginePoolOptions) (
 		pool.Close()
 		return nil, fmt.Errorf("create first engine: %w", err)
 	}
+	// Hold all the engines until they are created, so the pool doesn't reuse them.
+	es := []*uci.Engine{e}
+	for len(es) < o.Prewarm {
+		e, err := pool.AcquireEngine(ctx)
+		if err != nil {
+			for _, e := range es {
+				pool.ReleaseEngine(e)
+			}
+			pool.Close()
+			return nil, fmt.Errorf("prewarm engine: %w", err)
+		}
+		es = append(es, e)
+	}
 	info, ok := e.Info()
 	if !ok {
 		panic("must not happen")
@@ -83,10 +270,26 @@ func NewEnginePool(ctx context.Context, log *slog.Logger, o EnginePoolOptions) (
 		name = o.ExeName
 	}
 	pool.name = fmt.Sprintf("%v at %v", info.Name, name)
-	pool.ReleaseEngine(e)
+	pool.engineName = info.Name
+	for _, e := range es {
+		pool.ReleaseEngine(e)
+	}
+	if o.IdleTimeout != 0 {
+		go pool.expireLoop()
+	}
+
+	return pool, nil
 
-	return pool, err
+}
+
+type engineExtra struct {
+	tracer *switchLogger
+	proc   *watchedProcess
+}
 
+type idleEngine struct {
+	e     *uci.Engine
+	since time.Time
 }
 
 type enginePool struct {
@@ -94,21 +297,100 @@ type enginePool struct {
 	ctx    context.Context
 	cancel func()
 	mu     sync.Mutex
-	es     []*uci.Engine
-	name   string
-	log    *slog.Logger
+	// Idle engines, ordered by the time they were released.
+	es []idleEngine
+	// Number of engines which are not terminated yet, including the ones being created.
+	live int
+	// Closed and replaced each time an engine is released or terminated.
+	changed    chan struct{}
+	extras     map[*uci.Engine]engineExtra
+	name       string
+	engineName string
+	log        *slog.Logger
+}
+
+var (
+	_ TracingEnginePool       = (*enginePool)(nil)
+	_ SignaledEnginePool      = (*enginePool)(nil)
+	_ MoveRecordingEnginePool = (*enginePool)(nil)
+)
+
+func (p *enginePool) notifyUnlocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
 }
 
 func (p *enginePool) AcquireEngine(ctx context.Context) (*uci.Engine, error) {
-	p.mu.Lock()
-	if len(p.es) != 0 {
-		e := p.es[len(p.es)-1]
-		p.es = p.es[:len(p.es)-1]
+	for {
+		p.mu.Lock()
+		for len(p.es) != 0 {
+			e := p.es[len(p.es)-1].e
+			p.es = p.es[:len(p.es)-1]
+			if !e.Terminated() {
+				p.mu.Unlock()
+				return e, nil
+			}
+		}
+		if p.o.MaxEngines == 0 || p.live < p.o.MaxEngines {
+			p.live++
+			p.mu.Unlock()
+			break
+		}
+		changed := p.changed
 		p.mu.Unlock()
-		return e, nil
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for engine: %w", ctx.Err())
+		case <-p.ctx.Done():
+			return nil, fmt.Errorf("pool closed")
+		}
 	}
-	p.mu.Unlock()
 
+	e, err := p.createEngine(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.live--
+		p.notifyUnlocked()
+		p.mu.Unlock()
+		return nil, err
+	}
+	go func() {
+		<-e.Done()
+		p.mu.Lock()
+		p.live--
+		p.notifyUnlocked()
+		p.mu.Unlock()
+	}()
+	return e, nil
+}
+
+// expireLoop closes the engines which stay idle for longer than IdleTimeout.
+func (p *enginePool) expireLoop() {
+	ticker := time.NewTicker(max(p.o.IdleTimeout/4, 100*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.ctx.Done():
+			return
+		}
+		deadline := time.Now().Add(-p.o.IdleTimeout)
+		p.mu.Lock()
+		n := 0
+		for n < len(p.es) && p.es[n].since.Before(deadline) {
+			n++
+		}
+		expired := slices.Clone(p.es[:n])
+		p.es = slices.Delete(p.es, 0, n)
+		p.mu.Unlock()
+		for _, ie := range expired {
+			ie.e.Close()
+		}
+	}
+}
+
+func (p *enginePool) createEngine(ctx context.Context) (*uci.Engine, error) {
 	ctx, cancel := context.WithTimeout(ctx, p.o.CreateTimeout.Get())
 	defer cancel()
 
@@ -121,17 +403,32 @@ func (p *enginePool) AcquireEngine(ctx context.Context) (*uci.Engine, error) {
 		}
 	}
 
-	e, err := uci.NewEasyEngine(p.ctx, uci.EasyEngineOptions{
-		Name:            p.o.ExeName,
-		Args:            p.o.Args,
-		SysProcAttr:     engineSysProcAttr(),
-		Options:         p.o.EngineOptions,
-		WaitInitialized: false,
-		Logger:          logger,
-	})
+	var tracer *switchLogger
+	if p.o.Trace {
+		tracer = &switchLogger{base: logger}
+		logger = tracer
+	}
+
+	processName := p.o.ShortName
+	if processName == "" {
+		processName = p.o.ExeName
+	}
+	e, proc, err := p.newEngine(logger, processName)
 	if err != nil {
 		return nil, fmt.Errorf("create: %w", err)
 	}
+	p.mu.Lock()
+	if p.extras == nil {
+		p.extras = make(map[*uci.Engine]engineExtra)
+	}
+	// Forget about the engines which are already terminated.
+	for old := range p.extras {
+		if old.Terminated() {
+			delete(p.extras, old)
+		}
+	}
+	p.extras[e] = engineExtra{tracer: tracer, proc: proc}
+	p.mu.Unlock()
 	if err := e.WaitInitialized(ctx); err != nil {
 		e.Close()
 		return nil, fmt.Errorf("wait init: %w", err)
@@ -146,6 +443,38 @@ func (p *enginePool) AcquireEngine(ctx context.Context) (*uci.Engine, error) {
 	return e, nil
 }
 
+func (p *enginePool) newEngine(logger uci.Logger, processName string) (*uci.Engine, *watchedProcess, error) {
+	var cmd *exec.Cmd
+	if p.o.MemoryLimit != 0 {
+		var err error
+		cmd, err = memoryLimitedCommand(p.o.MemoryLimit, p.o.ExeName, p.o.Args...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("limit memory: %w", err)
+		}
+	} else {
+		cmd = exec.Command(p.o.ExeName, p.o.Args...)
+	}
+	cmd.SysProcAttr = engineSysProcAttr()
+	cmdProc, err := uci.NewCmdProcess(cmd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create process: %w", err)
+	}
+	res := cmdProc
+	// For CECP engines, trace the communication in xboard protocol, as it's what the engine really
+	// receives.
+	if p.o.Trace {
+		res = uci.NewTracingProcess(res, logger, uci.TracingProcessOptions{
+			ProcessName: processName,
+		})
+	}
+	if p.o.Protocol == ProtocolCECP {
+		res = cecp.NewProcess(res, cecp.Options{})
+	}
+	// Wrap the process last, so it sees the best moves in UCI format and all the kills.
+	proc := &watchedProcess{Process: res}
+	return uci.NewEngine(p.ctx, proc, logger, p.o.EngineOptions), proc, nil
+}
+
 func (p *enginePool) ReleaseEngine(e *uci.Engine) {
 	if e.Terminated() {
 		return
@@ -155,21 +484,55 @@ func (p *enginePool) ReleaseEngine(e *uci.Engine) {
 		return
 	}
 	p.mu.Lock()
-	p.es = append(p.es, e)
+	p.es = append(p.es, idleEngine{e: e, since: time.Now()})
+	p.notifyUnlocked()
+	p.mu.Unlock()
+}
+
+func (p *enginePool) SetEngineTracer(e *uci.Engine, l uci.Logger) {
+	p.mu.Lock()
+	extra, ok := p.extras[e]
+	p.mu.Unlock()
+	if ok && extra.tracer != nil {
+		extra.tracer.SetTracer(l)
+	}
+}
+
+func (p *enginePool) EngineKillSignal(e *uci.Engine) (syscall.Signal, bool) {
+	p.mu.Lock()
+	extra, ok := p.extras[e]
 	p.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	return extra.proc.killSignal()
+}
+
+func (p *enginePool) LastBestMove(e *uci.Engine) (string, bool) {
+	p.mu.Lock()
+	extra, ok := p.extras[e]
+	p.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	return extra.proc.lastBestMove()
 }
 
 func (p *enginePool) Name() string {
 	return p.name
 }
 
+func (p *enginePool) EngineName() string {
+	return p.engineName
+}
+
 func (p *enginePool) Close() {
 	p.cancel()
 	p.mu.Lock()
 	es := p.es
 	p.es = nil
 	p.mu.Unlock()
-	for _, e := range es {
-		<-e.Done()
+	for _, ie := range es {
+		<-ie.e.Done()
 	}
 }
@@ -3,9 +3,24 @@
 package battle
 
 import (
+	"errors"
+	"os/exec"
 	"syscall"
 )
 
 func engineSysProcAttr() *syscall.SysProcAttr {
 	return &syscall.SysProcAttr{Setpgid: true}
 }
+
+// exitSignal returns the signal which killed the process exited with err.
+func exitSignal(err error) (syscall.Signal, bool) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return 0, false
+	}
+	return status.Signal(), true
+}
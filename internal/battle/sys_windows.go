@@ -9,3 +9,9 @@ import (
 func engineSysProcAttr() *syscall.SysProcAttr {
 	return &syscall.SysProcAttr{}
 }
+
+// exitSignal returns the signal which killed the process exited with err. Processes are not killed
+// by signals on Windows.
+func exitSignal(_ error) (syscall.Signal, bool) {
+	return 0, false
+}
@@ -0,0 +1,46 @@
+package battle
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/uci"
+)
+
+// Transcript records the UCI communication with the engines during a single game. It is safe for
+// concurrent use.
+type Transcript struct {
+	mu    sync.Mutex
+	start time.Time
+	b     strings.Builder
+}
+
+func NewTranscript() *Transcript {
+	return &Transcript{start: time.Now()}
+}
+
+type transcriptLogger struct {
+	t      *Transcript
+	prefix string
+}
+
+func (l transcriptLogger) Printf(msg string, args ...any) {
+	l.t.mu.Lock()
+	defer l.t.mu.Unlock()
+	_, _ = fmt.Fprintf(&l.t.b, "[%10.3f] %v: ", time.Since(l.t.start).Seconds(), l.prefix)
+	_, _ = fmt.Fprintf(&l.t.b, msg, args...)
+	_ = l.t.b.WriteByte('\n')
+}
+
+func (t *Transcript) logger(c chess.Color) uci.Logger {
+	return transcriptLogger{t: t, prefix: c.LongString()}
+}
+
+func (t *Transcript) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.b.String()
+}
@@ -0,0 +1,20 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrNoToken     = errors.New("no lichess token")
+	ErrNoBroadcast = errors.New("no broadcast")
+)
+
+type DB interface {
+	SetLichessToken(ctx context.Context, token LichessToken) error
+	DeleteLichessToken(ctx context.Context, userID string) error
+	GetLichessToken(ctx context.Context, userID string) (LichessToken, error)
+	SetBroadcast(ctx context.Context, b Broadcast) error
+	DeleteBroadcast(ctx context.Context, contestID string) error
+	GetBroadcast(ctx context.Context, contestID string) (Broadcast, error)
+}
@@ -0,0 +1,36 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alex65536/day20/internal/util/httputil"
+)
+
+func (w *Watcher) pushPGN(ctx context.Context, token string, roundID string, pgn string) error {
+	endpoint := fmt.Sprintf("%v/api/broadcast/round/%v/push", w.o.APIURL, url.PathEscape(roundID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(pgn))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	rsp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		_ = rsp.Body.Close()
+	}()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		var b strings.Builder
+		_, _ = io.Copy(&b, io.LimitReader(rsp.Body, 1024))
+		return fmt.Errorf("status: %w", httputil.MakeError(rsp.StatusCode, b.String()))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package broadcast
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+const TokenMaxLen = 256
+
+var (
+	tokenRegex   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	roundIDRegex = regexp.MustCompile(`^[A-Za-z0-9]{8}$`)
+)
+
+func ValidateToken(token string) error {
+	if token == "" {
+		return fmt.Errorf("empty token")
+	}
+	if len(token) > TokenMaxLen {
+		return fmt.Errorf("token exceeds %v bytes", TokenMaxLen)
+	}
+	if !tokenRegex.MatchString(token) {
+		return fmt.Errorf("token contains bad characters")
+	}
+	return nil
+}
+
+func ValidateRoundID(roundID string) error {
+	if !roundIDRegex.MatchString(roundID) {
+		return fmt.Errorf("round id must consist of 8 letters or digits")
+	}
+	return nil
+}
+
+// LichessToken is a Lichess API token with "study:write" scope, used to push games on behalf of
+// the user.
+type LichessToken struct {
+	UserID    string `gorm:"primaryKey"`
+	Token     string
+	UpdatedAt timeutil.UTCTime
+}
+
+// Broadcast links a contest to a Lichess broadcast round. The games are pushed using the token of
+// the user who created the link.
+type Broadcast struct {
+	ContestID string `gorm:"primaryKey"`
+	UserID    string `gorm:"index"`
+	RoundID   string
+	CreatedAt timeutil.UTCTime
+}
@@ -0,0 +1,382 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+type Keeper interface {
+	ListRooms() []roomkeeper.RoomState
+	Subscribe(roomID string) (ch <-chan struct{}, cancel func(), ok bool)
+	RoomGameExt(roomID string) (*battle.GameExt, error)
+}
+
+type Scheduler interface {
+	GetRunningJob(jobID string) (scheduler.RunningJob, bool)
+	GetContest(ctx context.Context, contestID string) (scheduler.ContestInfo, scheduler.ContestData, error)
+	GetContestFinishedJob(ctx context.Context, contestID string, jobID string) (scheduler.FinishedJob, error)
+}
+
+type Options struct {
+	PushInterval time.Duration `toml:"push-interval"`
+	ScanInterval time.Duration `toml:"scan-interval"`
+	Timeout      time.Duration `toml:"timeout"`
+	APIURL       string        `toml:"api-url"`
+}
+
+func (o Options) Clone() Options {
+	return o
+}
+
+func (o *Options) FillDefaults() {
+	if o.PushInterval == 0 {
+		o.PushInterval = 3 * time.Second
+	}
+	if o.ScanInterval == 0 {
+		o.ScanInterval = 10 * time.Second
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 30 * time.Second
+	}
+	if o.APIURL == "" {
+		o.APIURL = "https://lichess.org"
+	}
+}
+
+type roomJob struct {
+	jobID     string
+	contestID string
+	event     string
+}
+
+// Watcher subscribes to all the rooms and pushes the games of contests linked to Lichess
+// broadcast rounds.
+type Watcher struct {
+	o      *Options
+	db     DB
+	keeper Keeper
+	sched  Scheduler
+	log    *slog.Logger
+	client *http.Client
+	ctx    context.Context
+	cancel func()
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	watched map[string]struct{}
+	dirty   map[string]struct{}
+
+	// Accessed only from loop().
+	jobs map[string]roomJob
+}
+
+func New(log *slog.Logger, db DB, keeper Keeper, sched Scheduler, o Options) *Watcher {
+	o = o.Clone()
+	o.FillDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watcher{
+		o:       &o,
+		db:      db,
+		keeper:  keeper,
+		sched:   sched,
+		log:     log,
+		client:  &http.Client{Timeout: o.Timeout},
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		watched: make(map[string]struct{}),
+		dirty:   make(map[string]struct{}),
+		jobs:    make(map[string]roomJob),
+	}
+	go w.loop()
+	return w
+}
+
+func (w *Watcher) Close() {
+	w.cancel()
+	<-w.done
+	w.wg.Wait()
+}
+
+func (w *Watcher) SetToken(ctx context.Context, userID string, token string) error {
+	if err := ValidateToken(token); err != nil {
+		return fmt.Errorf("bad token: %w", err)
+	}
+	err := w.db.SetLichessToken(ctx, LichessToken{
+		UserID:    userID,
+		Token:     token,
+		UpdatedAt: timeutil.NowUTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("set token: %w", err)
+	}
+	return nil
+}
+
+func (w *Watcher) DeleteToken(ctx context.Context, userID string) error {
+	return w.db.DeleteLichessToken(ctx, userID)
+}
+
+func (w *Watcher) HasToken(ctx context.Context, userID string) (bool, error) {
+	_, err := w.db.GetLichessToken(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNoToken) {
+			return false, nil
+		}
+		return false, fmt.Errorf("get token: %w", err)
+	}
+	return true, nil
+}
+
+func (w *Watcher) Link(ctx context.Context, userID string, contestID string, roundID string) error {
+	if err := ValidateRoundID(roundID); err != nil {
+		return fmt.Errorf("bad round: %w", err)
+	}
+	if ok, err := w.HasToken(ctx, userID); err != nil {
+		return err
+	} else if !ok {
+		return ErrNoToken
+	}
+	err := w.db.SetBroadcast(ctx, Broadcast{
+		ContestID: contestID,
+		UserID:    userID,
+		RoundID:   roundID,
+		CreatedAt: timeutil.NowUTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("set broadcast: %w", err)
+	}
+	w.markAllDirty()
+	return nil
+}
+
+func (w *Watcher) Unlink(ctx context.Context, contestID string) error {
+	return w.db.DeleteBroadcast(ctx, contestID)
+}
+
+func (w *Watcher) Get(ctx context.Context, contestID string) (Broadcast, error) {
+	return w.db.GetBroadcast(ctx, contestID)
+}
+
+func (w *Watcher) RoundURL(roundID string) string {
+	return fmt.Sprintf("%v/broadcast/-/-/%v", w.o.APIURL, roundID)
+}
+
+func (w *Watcher) markDirty(roomID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dirty[roomID] = struct{}{}
+}
+
+func (w *Watcher) markAllDirty() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for roomID := range w.watched {
+		w.dirty[roomID] = struct{}{}
+	}
+}
+
+func (w *Watcher) watchRoom(roomID string, ch <-chan struct{}, unsub func()) {
+	defer w.wg.Done()
+	defer unsub()
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.watched, roomID)
+		w.dirty[roomID] = struct{}{}
+	}()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+			w.markDirty(roomID)
+		}
+	}
+}
+
+func (w *Watcher) scanRooms() {
+	for _, r := range w.keeper.ListRooms() {
+		roomID := r.Info.ID
+		isNew := func() bool {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if _, ok := w.watched[roomID]; ok {
+				return false
+			}
+			w.watched[roomID] = struct{}{}
+			w.dirty[roomID] = struct{}{}
+			return true
+		}()
+		if !isNew {
+			continue
+		}
+		ch, unsub, ok := w.keeper.Subscribe(roomID)
+		if !ok {
+			w.mu.Lock()
+			delete(w.watched, roomID)
+			w.mu.Unlock()
+			continue
+		}
+		w.wg.Add(1)
+		go w.watchRoom(roomID, ch, unsub)
+	}
+}
+
+func (w *Watcher) livePGN(roomID string, rj roomJob) (string, error) {
+	game, err := w.keeper.RoomGameExt(roomID)
+	if err != nil {
+		return "", fmt.Errorf("get game: %w", err)
+	}
+	game.Event = rj.event
+	return game.PGN()
+}
+
+func (w *Watcher) finishedPGN(ctx context.Context, rj roomJob) (string, error) {
+	job, err := w.sched.GetContestFinishedJob(ctx, rj.contestID, rj.jobID)
+	if err != nil {
+		return "", fmt.Errorf("get job: %w", err)
+	}
+	if job.PGN == nil {
+		return "", fmt.Errorf("no pgn")
+	}
+	game, err := battle.GameExtFromPGN(*job.PGN)
+	if err != nil {
+		return "", fmt.Errorf("parse pgn: %w", err)
+	}
+	// Keep the tags the same as in live games, so Lichess updates the existing game instead of
+	// creating a new one.
+	game.Event = rj.event
+	game.Round = 0
+	return game.PGN()
+}
+
+func (w *Watcher) pushDirty(ctx context.Context) {
+	dirty := func() map[string]struct{} {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		dirty := w.dirty
+		w.dirty = make(map[string]struct{})
+		return dirty
+	}()
+	if len(dirty) == 0 {
+		return
+	}
+
+	roomJobIDs := make(map[string]string)
+	for _, r := range w.keeper.ListRooms() {
+		if jobID, ok := r.JobID.TryGet(); ok {
+			roomJobIDs[r.Info.ID] = jobID
+		}
+	}
+
+	broadcasts := make(map[string]*Broadcast)
+	getBroadcast := func(contestID string) *Broadcast {
+		if b, ok := broadcasts[contestID]; ok {
+			return b
+		}
+		b, err := w.db.GetBroadcast(ctx, contestID)
+		if err != nil {
+			if !errors.Is(err, ErrNoBroadcast) {
+				w.log.Warn("could not get broadcast", slog.String("contest_id", contestID), slogx.Err(err))
+			}
+			broadcasts[contestID] = nil
+			return nil
+		}
+		broadcasts[contestID] = &b
+		return &b
+	}
+
+	games := make(map[string][]string)
+	addGame := func(rj roomJob, getPGN func() (string, error)) {
+		if getBroadcast(rj.contestID) == nil {
+			return
+		}
+		pgn, err := getPGN()
+		if err != nil {
+			if !errors.Is(err, roomkeeper.ErrGameNotReady) {
+				w.log.Info("could not build pgn", slog.String("job_id", rj.jobID), slogx.Err(err))
+			}
+			return
+		}
+		games[rj.contestID] = append(games[rj.contestID], pgn)
+	}
+
+	for roomID := range dirty {
+		jobID := roomJobIDs[roomID]
+		if prev, ok := w.jobs[roomID]; ok && prev.jobID != jobID {
+			delete(w.jobs, roomID)
+			addGame(prev, func() (string, error) { return w.finishedPGN(ctx, prev) })
+		}
+		if jobID == "" {
+			continue
+		}
+		rj, ok := w.jobs[roomID]
+		if !ok {
+			job, ok := w.sched.GetRunningJob(jobID)
+			if !ok {
+				continue
+			}
+			info, _, err := w.sched.GetContest(ctx, job.ContestID)
+			if err != nil {
+				w.log.Warn("could not get contest", slog.String("contest_id", job.ContestID), slogx.Err(err))
+				continue
+			}
+			rj = roomJob{jobID: jobID, contestID: job.ContestID, event: info.Name}
+			w.jobs[roomID] = rj
+		}
+		addGame(rj, func() (string, error) { return w.livePGN(roomID, rj) })
+	}
+
+	for contestID, pgns := range games {
+		b := broadcasts[contestID]
+		token, err := w.db.GetLichessToken(ctx, b.UserID)
+		if err != nil {
+			w.log.Warn("could not get lichess token", slog.String("contest_id", contestID), slogx.Err(err))
+			continue
+		}
+		if err := w.pushPGN(ctx, token.Token, b.RoundID, strings.Join(pgns, "\n\n")); err != nil {
+			w.log.Warn("could not push games to lichess",
+				slog.String("contest_id", contestID),
+				slog.String("round_id", b.RoundID),
+				slogx.Err(err),
+			)
+			continue
+		}
+	}
+}
+
+func (w *Watcher) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.o.PushInterval)
+	defer ticker.Stop()
+	var lastScan time.Time
+	for {
+		if now := time.Now(); now.Sub(lastScan) >= w.o.ScanInterval {
+			w.scanRooms()
+			lastScan = now
+		}
+		w.pushDirty(w.ctx)
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package cecp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseFeatures splits the arguments of "feature" command into key-value pairs. Values may be
+// quoted.
+func parseFeatures(s string) ([][2]string, error) {
+	var res [][2]string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return res, nil
+		}
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return res, fmt.Errorf("bad feature %q", s)
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return res, fmt.Errorf("unterminated quote in feature %q", key)
+			}
+			value, s = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			value, s = rest[:end], rest[end:]
+		}
+		res = append(res, [2]string{key, value})
+	}
+}
+
+type optionKind int
+
+const (
+	optionButton optionKind = iota
+	optionCheck
+	optionSpin
+	optionString
+	optionCombo
+)
+
+type option struct {
+	name string
+	kind optionKind
+	// uci is the option declaration in UCI format, without the leading "option".
+	uci string
+}
+
+// parseOption parses the option declaration from "feature option", e.g. "Depth -spin 10 1 100".
+func parseOption(s string) (option, error) {
+	idx := strings.Index(s, " -")
+	if idx <= 0 {
+		return option{}, fmt.Errorf("no option type")
+	}
+	name := strings.TrimSpace(s[:idx])
+	typ, rest, _ := strings.Cut(s[idx+2:], " ")
+	args := strings.Fields(rest)
+	switch typ {
+	case "button", "save", "reset":
+		return option{
+			name: name,
+			kind: optionButton,
+			uci:  fmt.Sprintf("name %v type button", name),
+		}, nil
+	case "check":
+		if len(args) != 1 {
+			return option{}, fmt.Errorf("bad check option %q", name)
+		}
+		def := "false"
+		if args[0] == "1" {
+			def = "true"
+		}
+		return option{
+			name: name,
+			kind: optionCheck,
+			uci:  fmt.Sprintf("name %v type check default %v", name, def),
+		}, nil
+	case "spin", "slider":
+		if len(args) != 3 {
+			return option{}, fmt.Errorf("bad spin option %q", name)
+		}
+		return option{
+			name: name,
+			kind: optionSpin,
+			uci:  fmt.Sprintf("name %v type spin default %v min %v max %v", name, args[0], args[1], args[2]),
+		}, nil
+	case "string", "file", "path":
+		return option{
+			name: name,
+			kind: optionString,
+			uci:  fmt.Sprintf("name %v type string default %v", name, strings.TrimSpace(rest)),
+		}, nil
+	case "combo":
+		var (
+			def  string
+			vars []string
+		)
+		for _, v := range strings.Split(rest, "///") {
+			v = strings.TrimSpace(v)
+			if strings.HasPrefix(v, "*") {
+				v = v[1:]
+				def = v
+			}
+			if v != "" {
+				vars = append(vars, v)
+			}
+		}
+		if len(vars) == 0 {
+			return option{}, fmt.Errorf("no choices in combo option %q", name)
+		}
+		if def == "" {
+			def = vars[0]
+		}
+		var b strings.Builder
+		_, _ = fmt.Fprintf(&b, "name %v type combo default %v", name, def)
+		for _, v := range vars {
+			_, _ = fmt.Fprintf(&b, " var %v", v)
+		}
+		return option{
+			name: name,
+			kind: optionCombo,
+			uci:  b.String(),
+		}, nil
+	default:
+		return option{}, fmt.Errorf("unsupported type %q of option %q", typ, name)
+	}
+}
+
+// command returns the CECP command which sets the option to the value given in UCI format.
+func (o option) command(value string) string {
+	switch o.kind {
+	case optionButton:
+		return "option " + o.name
+	case optionCheck:
+		if value == "true" {
+			value = "1"
+		} else {
+			value = "0"
+		}
+	}
+	return fmt.Sprintf("option %v=%v", o.name, value)
+}
@@ -0,0 +1,581 @@
+package cecp
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/uci"
+)
+
+type Options struct {
+	// FeatureTimeout is the time to wait for the features after "protover 2" if the engine doesn't
+	// ask for more time with "feature done=0".
+	FeatureTimeout time.Duration
+}
+
+func (o *Options) FillDefaults() {
+	if o.FeatureTimeout == 0 {
+		o.FeatureTimeout = 2 * time.Second
+	}
+}
+
+func (o Options) Clone() Options {
+	return o
+}
+
+// lineQueue is an unbounded queue of lines, so pushing to it never blocks. This is important, as
+// uci.Engine sends the commands and receives the lines from the same goroutine.
+type lineQueue struct {
+	mu     sync.Mutex
+	lines  []string
+	notify chan struct{}
+	err    error
+}
+
+func newLineQueue() *lineQueue {
+	return &lineQueue{notify: make(chan struct{}, 1)}
+}
+
+func (q *lineQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *lineQueue) Push(lines ...string) {
+	q.mu.Lock()
+	q.lines = append(q.lines, lines...)
+	q.mu.Unlock()
+	q.wake()
+}
+
+func (q *lineQueue) Close(err error) {
+	q.mu.Lock()
+	if q.err == nil {
+		q.err = err
+	}
+	q.mu.Unlock()
+	q.wake()
+}
+
+func (q *lineQueue) Pop() (string, error) {
+	for {
+		q.mu.Lock()
+		if len(q.lines) != 0 {
+			ln := q.lines[0]
+			q.lines = q.lines[1:]
+			q.mu.Unlock()
+			return ln, nil
+		}
+		err := q.err
+		q.mu.Unlock()
+		if err != nil {
+			q.wake()
+			return "", err
+		}
+		<-q.notify
+	}
+}
+
+type process struct {
+	p uci.Process
+	o Options
+	q *lineQueue
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	inited   bool
+	features map[string]string
+	options  []option
+	pingID   int
+
+	// Position requested via "position" command.
+	reqFEN   string
+	reqMoves []string
+	// Position known to the engine. The engine is always kept in force mode when it doesn't search.
+	synced    bool
+	syncFEN   string
+	syncMoves []string
+	level     string
+
+	searching bool
+	board     *chess.Board
+}
+
+var _ uci.Process = (*process)(nil)
+
+// NewProcess wraps the process speaking xboard protocol (also known as CECP), so it looks like a
+// UCI engine from the outside. Only the subset of UCI needed to play games is supported: pondering,
+// infinite searches and searches limited by nodes are not.
+func NewProcess(p uci.Process, o Options) uci.Process {
+	o = o.Clone()
+	o.FillDefaults()
+	res := &process{
+		p:        p,
+		o:        o,
+		q:        newLineQueue(),
+		features: make(map[string]string),
+		reqFEN:   chess.InitialBoard().FEN(),
+	}
+	go res.readLoop()
+	return res
+}
+
+func (p *process) send(cmds ...string) error {
+	for _, c := range cmds {
+		if err := p.p.Send(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *process) Send(s string) error {
+	cmd, rest, _ := strings.Cut(strings.TrimSpace(s), " ")
+	switch cmd {
+	case "uci":
+		return p.startInit()
+	case "debug", "ponderhit":
+		return nil
+	case "isready":
+		return p.isReady()
+	case "setoption":
+		return p.setOption(rest)
+	case "ucinewgame":
+		return p.newGame()
+	case "position":
+		return p.setPosition(rest)
+	case "go":
+		return p.startSearch(rest)
+	case "stop":
+		return p.send("?")
+	case "quit":
+		return p.send("quit")
+	default:
+		return fmt.Errorf("command %q not supported over xboard protocol", cmd)
+	}
+}
+
+func (p *process) Recv() (string, error) { return p.q.Pop() }
+func (p *process) Done() <-chan struct{} { return p.p.Done() }
+func (p *process) Err() error            { return p.p.Err() }
+func (p *process) Kill()                 { p.p.Kill() }
+
+func (p *process) startInit() error {
+	if err := p.send("xboard", "protover 2"); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.inited && p.timer == nil {
+		p.timer = time.AfterFunc(p.o.FeatureTimeout, p.finishInit)
+	}
+	return nil
+}
+
+func (p *process) finishInit() {
+	p.mu.Lock()
+	if p.inited {
+		p.mu.Unlock()
+		return
+	}
+	p.inited = true
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	name := p.features["myname"]
+	if name == "" {
+		name = "xboard engine"
+	}
+	lines := []string{"id name " + name}
+	if p.features["memory"] == "1" {
+		lines = append(lines, "option name Hash type spin default 16 min 1 max 1048576")
+	}
+	if p.features["smp"] == "1" {
+		lines = append(lines, "option name Threads type spin default 1 min 1 max 1024")
+	}
+	for _, o := range p.options {
+		lines = append(lines, "option "+o.uci)
+	}
+	lines = append(lines, "uciok")
+	p.mu.Unlock()
+
+	if err := p.send("new", "force", "post", "easy"); err != nil {
+		p.q.Close(fmt.Errorf("init: %w", err))
+		return
+	}
+	p.q.Push(lines...)
+}
+
+func (p *process) isReady() error {
+	p.mu.Lock()
+	if p.features["ping"] != "1" {
+		p.mu.Unlock()
+		p.q.Push("readyok")
+		return nil
+	}
+	p.pingID++
+	id := p.pingID
+	p.mu.Unlock()
+	return p.send(fmt.Sprintf("ping %v", id))
+}
+
+func (p *process) setOption(s string) error {
+	s = strings.TrimPrefix(s, "name ")
+	name, value, _ := strings.Cut(s, " value ")
+	name = strings.TrimSpace(name)
+	value = strings.TrimSpace(value)
+	p.mu.Lock()
+	var cmd string
+	switch {
+	case name == "Hash" && p.features["memory"] == "1":
+		cmd = "memory " + value
+	case name == "Threads" && p.features["smp"] == "1":
+		cmd = "cores " + value
+	default:
+		idx := slices.IndexFunc(p.options, func(o option) bool { return o.name == name })
+		if idx >= 0 {
+			cmd = p.options[idx].command(value)
+		}
+	}
+	p.mu.Unlock()
+	if cmd == "" {
+		return fmt.Errorf("unknown option %q", name)
+	}
+	return p.send(cmd)
+}
+
+func (p *process) newGame() error {
+	p.mu.Lock()
+	p.synced = false
+	p.level = ""
+	p.mu.Unlock()
+	return p.send("new", "force", "post", "easy")
+}
+
+func (p *process) setPosition(s string) error {
+	fields := strings.Fields(s)
+	var fen string
+	switch {
+	case len(fields) >= 1 && fields[0] == "startpos":
+		fen = chess.InitialBoard().FEN()
+		fields = fields[1:]
+	case len(fields) >= 7 && fields[0] == "fen":
+		fen = strings.Join(fields[1:7], " ")
+		fields = fields[7:]
+	default:
+		return fmt.Errorf("bad position %q", s)
+	}
+	var moves []string
+	if len(fields) != 0 {
+		if fields[0] != "moves" {
+			return fmt.Errorf("bad position %q", s)
+		}
+		moves = slices.Clone(fields[1:])
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reqFEN = fen
+	p.reqMoves = moves
+	return nil
+}
+
+func (p *process) moveCmd(mv string) string {
+	if p.features["usermove"] == "1" {
+		return "usermove " + mv
+	}
+	return mv
+}
+
+// centis converts milliseconds to centiseconds, as used in "time" and "otim".
+func centis(ms int64) int64 {
+	return max(ms/10, 0)
+}
+
+func (p *process) startSearch(s string) error {
+	args := make(map[string]int64)
+	fields := strings.Fields(s)
+	for i := 0; i < len(fields); i++ {
+		switch key := fields[i]; key {
+		case "wtime", "btime", "winc", "binc", "movestogo", "depth", "movetime":
+			if i+1 >= len(fields) {
+				return fmt.Errorf("no value for %q", key)
+			}
+			v, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("bad value for %q: %w", key, err)
+			}
+			args[key] = v
+			i++
+		default:
+			return fmt.Errorf("%q is not supported over xboard protocol", key)
+		}
+	}
+
+	p.mu.Lock()
+	board, err := chess.BoardFromFEN(p.reqFEN)
+	if err != nil {
+		p.mu.Unlock()
+		return fmt.Errorf("bad fen: %w", err)
+	}
+	for _, mv := range p.reqMoves {
+		if _, err := board.MakeMoveUCI(mv); err != nil {
+			p.mu.Unlock()
+			return fmt.Errorf("bad move %q: %w", mv, err)
+		}
+	}
+
+	var cmds []string
+	if p.synced && p.syncFEN == p.reqFEN && len(p.syncMoves) <= len(p.reqMoves) &&
+		slices.Equal(p.syncMoves, p.reqMoves[:len(p.syncMoves)]) {
+		for _, mv := range p.reqMoves[len(p.syncMoves):] {
+			cmds = append(cmds, p.moveCmd(mv))
+		}
+	} else {
+		cmds = append(cmds, "new", "force", "post", "easy")
+		p.level = ""
+		if p.reqFEN != chess.InitialBoard().FEN() {
+			if p.features["setboard"] != "1" {
+				p.mu.Unlock()
+				return fmt.Errorf("engine cannot start from arbitrary position without setboard")
+			}
+			cmds = append(cmds, "setboard "+p.reqFEN)
+		}
+		for _, mv := range p.reqMoves {
+			cmds = append(cmds, p.moveCmd(mv))
+		}
+	}
+	p.synced = true
+	p.syncFEN = p.reqFEN
+	p.syncMoves = slices.Clone(p.reqMoves)
+
+	if mt, ok := args["movetime"]; ok {
+		cmds = append(cmds, fmt.Sprintf("st %v", max(int64(math.Ceil(float64(mt)/1000)), 1)))
+	} else if _, ok := args["wtime"]; ok {
+		my, opp, inc := args["wtime"], args["btime"], args["winc"]
+		if board.Side() == chess.ColorBlack {
+			my, opp, inc = opp, my, args["binc"]
+		}
+		// Base time in "level" doesn't matter much, as the engine receives the remaining time on
+		// each move.
+		// The engine receives the remaining time before each move, so "level" is sent only when the
+		// increment or the number of moves to go change.
+		mtg := args["movestogo"]
+		incStr := strconv.FormatFloat(float64(inc)/1000, 'f', -1, 64)
+		if level := fmt.Sprintf("%v %v", mtg, incStr); level != p.level {
+			base := max(my/1000, 1)
+			cmds = append(cmds, fmt.Sprintf("level %v %v:%02d %v", mtg, base/60, base%60, incStr))
+			p.level = level
+		}
+		cmds = append(cmds, fmt.Sprintf("time %v", centis(my)), fmt.Sprintf("otim %v", centis(opp)))
+	}
+	if d, ok := args["depth"]; ok {
+		cmds = append(cmds, fmt.Sprintf("sd %v", d))
+	}
+	cmds = append(cmds, "go")
+	p.searching = true
+	p.board = board
+	p.mu.Unlock()
+
+	return p.send(cmds...)
+}
+
+func (p *process) readLoop() {
+	for {
+		ln, err := p.p.Recv()
+		if err != nil {
+			p.q.Close(err)
+			return
+		}
+		if err := p.handleLine(strings.TrimSpace(ln)); err != nil {
+			p.q.Close(err)
+			return
+		}
+	}
+}
+
+func (p *process) handleLine(ln string) error {
+	if ln == "" || strings.HasPrefix(ln, "#") {
+		return nil
+	}
+	fields := strings.Fields(ln)
+	switch {
+	case fields[0] == "feature":
+		return p.handleFeatures(strings.TrimPrefix(ln, "feature"))
+	case fields[0] == "pong":
+		p.q.Push("readyok")
+		return nil
+	case fields[0] == "move" && len(fields) >= 2:
+		return p.handleMove(fields[1])
+	case len(fields) >= 3 && strings.HasSuffix(fields[0], ".") && fields[1] == "...":
+		// Protocol version 1 style move, e.g. "1. ... e7e5".
+		return p.handleMove(fields[2])
+	case fields[0] == "resign" || fields[0] == "1-0" || fields[0] == "0-1" || fields[0] == "1/2-1/2":
+		p.q.Push("info string " + ln)
+		return p.handleMove("")
+	}
+	if len(fields) >= 4 {
+		if info, ok := p.thinkingInfo(fields); ok {
+			p.q.Push(info)
+			return nil
+		}
+	}
+	p.q.Push("info string " + ln)
+	return nil
+}
+
+func (p *process) handleFeatures(s string) error {
+	features, err := parseFeatures(s)
+	if err != nil {
+		p.q.Push("info string " + err.Error())
+	}
+	var (
+		replies []string
+		done    bool
+	)
+	p.mu.Lock()
+	for _, f := range features {
+		key, value := f[0], f[1]
+		switch key {
+		case "san":
+			if value == "1" {
+				// Coordinate notation is used in both directions.
+				replies = append(replies, "rejected san")
+				continue
+			}
+		case "option":
+			o, err := parseOption(value)
+			if err != nil {
+				p.q.Push("info string bad option: " + err.Error())
+				replies = append(replies, "rejected option")
+				continue
+			}
+			p.options = append(p.options, o)
+		case "done":
+			if value == "0" {
+				if p.timer != nil {
+					p.timer.Stop()
+				}
+			} else {
+				done = true
+			}
+		}
+		p.features[key] = value
+		replies = append(replies, "accepted "+key)
+	}
+	p.mu.Unlock()
+	if err := p.send(replies...); err != nil {
+		return err
+	}
+	if done {
+		p.finishInit()
+	}
+	return nil
+}
+
+// handleMove reports the move made by the engine as the best move. Empty move means that the engine
+// resigned or claimed the result, which is reported as a null move.
+func (p *process) handleMove(s string) error {
+	p.mu.Lock()
+	if !p.searching {
+		p.mu.Unlock()
+		p.q.Push("info string unexpected move " + s)
+		return nil
+	}
+	p.searching = false
+	best := "0000"
+	if s != "" {
+		if mv, err := parseMove(s, p.board); err == nil {
+			best = mv.UCI()
+			// Unlike UCI engines, the engine has already applied the move to its board.
+			p.syncMoves = append(p.syncMoves, best)
+		} else {
+			p.q.Push("info string bad move from engine: " + err.Error())
+			p.synced = false
+		}
+	} else {
+		p.synced = false
+	}
+	p.mu.Unlock()
+	if err := p.send("force"); err != nil {
+		return err
+	}
+	p.q.Push("bestmove " + best)
+	return nil
+}
+
+func parseMove(s string, b *chess.Board) (chess.Move, error) {
+	if mv, err := chess.LegalMoveFromUCI(s, b); err == nil {
+		return mv, nil
+	}
+	mv, err := chess.LegalMoveFromSAN(s, b)
+	if err != nil {
+		return chess.Move{}, fmt.Errorf("parse move %q: %w", s, err)
+	}
+	return mv, nil
+}
+
+// mateScore is the base of mate scores in thinking output. Mate in N moves is reported as
+// mateScore+N, and being mated in N moves is reported as -mateScore-N.
+const mateScore = 100000
+
+// uciScore converts the score from thinking output into UCI form.
+func uciScore(v int64) string {
+	switch {
+	case v >= mateScore:
+		return fmt.Sprintf("mate %v", v-mateScore)
+	case v <= -mateScore:
+		return fmt.Sprintf("mate %v", v+mateScore)
+	default:
+		return fmt.Sprintf("cp %v", v)
+	}
+}
+
+// thinkingInfo converts thinking output in form "ply score time nodes pv" into UCI "info" line.
+// Score is in centipawns and time is in centiseconds.
+func (p *process) thinkingInfo(fields []string) (string, bool) {
+	var nums [4]int64
+	for i := range nums {
+		v, err := strconv.ParseInt(strings.TrimRight(fields[i], "&.+-"), 10, 64)
+		if err != nil {
+			return "", false
+		}
+		nums[i] = v
+	}
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "info depth %v score %v time %v nodes %v", nums[0], uciScore(nums[1]), nums[2]*10, nums[3])
+
+	p.mu.Lock()
+	var board *chess.Board
+	if p.searching {
+		board = p.board.Clone()
+	}
+	p.mu.Unlock()
+	if board == nil {
+		return "", false
+	}
+	var pv []string
+	for _, tok := range fields[4:] {
+		tok = strings.TrimRight(tok, "!?+#")
+		if tok == "" || strings.HasSuffix(tok, ".") || tok == "..." {
+			continue
+		}
+		mv, err := parseMove(tok, board)
+		if err != nil {
+			break
+		}
+		board.MakeLegalMove(mv)
+		pv = append(pv, mv.UCI())
+	}
+	if len(pv) != 0 {
+		_, _ = fmt.Fprintf(&b, " pv %v", strings.Join(pv, " "))
+	}
+	return b.String(), true
+}
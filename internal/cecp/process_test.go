@@ -0,0 +1,183 @@
+package cecp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEngine plays the role of the xboard engine. The commands sent to it are read by the test, and
+// the lines written by the test are received by the wrapper.
+type fakeEngine struct {
+	sent chan string
+	out  chan string
+	done chan struct{}
+	once sync.Once
+}
+
+func newFakeEngine() *fakeEngine {
+	return &fakeEngine{
+		sent: make(chan string, 100),
+		out:  make(chan string, 100),
+		done: make(chan struct{}),
+	}
+}
+
+func (e *fakeEngine) Send(s string) error {
+	e.sent <- s
+	return nil
+}
+
+func (e *fakeEngine) Recv() (string, error) {
+	select {
+	case ln := <-e.out:
+		return ln, nil
+	case <-e.done:
+		return "", errors.New("killed")
+	}
+}
+
+func (e *fakeEngine) Done() <-chan struct{} { return e.done }
+func (e *fakeEngine) Err() error            { return nil }
+func (e *fakeEngine) Kill()                 { e.once.Do(func() { close(e.done) }) }
+
+func (e *fakeEngine) expectSent(t *testing.T, cmds ...string) {
+	t.Helper()
+	for _, expected := range cmds {
+		select {
+		case got := <-e.sent:
+			if got != expected {
+				t.Fatalf("bad command: expected = %q, got = %q", expected, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("command %q not sent", expected)
+		}
+	}
+}
+
+type recvResult struct {
+	ln  string
+	err error
+}
+
+func expectRecv(t *testing.T, p interface{ Recv() (string, error) }, lines ...string) {
+	t.Helper()
+	for _, expected := range lines {
+		ch := make(chan recvResult, 1)
+		go func() {
+			ln, err := p.Recv()
+			ch <- recvResult{ln: ln, err: err}
+		}()
+		select {
+		case res := <-ch:
+			if res.err != nil {
+				t.Fatalf("recv %q: %v", expected, res.err)
+			}
+			if res.ln != expected {
+				t.Fatalf("bad line: expected = %q, got = %q", expected, res.ln)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("line %q not received", expected)
+		}
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	e := newFakeEngine()
+	p := NewProcess(e, Options{FeatureTimeout: time.Minute})
+	defer p.Kill()
+	send := func(s string) {
+		t.Helper()
+		if err := p.Send(s); err != nil {
+			t.Fatalf("send %q: %v", s, err)
+		}
+	}
+
+	send("uci")
+	e.expectSent(t, "xboard", "protover 2")
+	e.out <- `feature myname="Test Engine" ping=1 setboard=1 usermove=1 done=1`
+	e.expectSent(t,
+		"accepted myname", "accepted ping", "accepted setboard", "accepted usermove", "accepted done",
+		"new", "force", "post", "easy",
+	)
+	expectRecv(t, p, "id name Test Engine", "uciok")
+
+	send("isready")
+	e.expectSent(t, "ping 1")
+	e.out <- "pong 1"
+	expectRecv(t, p, "readyok")
+
+	send("ucinewgame")
+	e.expectSent(t, "new", "force", "post", "easy")
+	send("position startpos moves e2e4")
+	send("go wtime 60000 btime 50000 winc 1000 binc 1000")
+	e.expectSent(t,
+		"new", "force", "post", "easy", "usermove e2e4",
+		"level 0 0:50 1", "time 5000", "otim 6000", "go",
+	)
+	e.out <- "5 37 150 12345 e7e5 g1f3"
+	e.out <- "6 100003 210 23456 e7e5 g1f3"
+	e.out <- "7 -100002 320 34567 e5 Nf3 Nc6"
+	e.out <- "move e7e5"
+	expectRecv(t, p,
+		"info depth 5 score cp 37 time 1500 nodes 12345 pv e7e5 g1f3",
+		"info depth 6 score mate 3 time 2100 nodes 23456 pv e7e5 g1f3",
+		"info depth 7 score mate -2 time 3200 nodes 34567 pv e7e5 g1f3 b8c6",
+		"bestmove e7e5",
+	)
+	e.expectSent(t, "force")
+
+	// The engine already knows the moves up to its own one, so only the new moves are sent.
+	send("position startpos moves e2e4 e7e5 g1f3")
+	send("go wtime 59000 btime 49000 winc 1000 binc 1000")
+	e.expectSent(t, "usermove g1f3", "time 4900", "otim 5900", "go")
+	e.out <- "Telling you about the search"
+	e.out <- "move Nc6"
+	expectRecv(t, p, "info string Telling you about the search", "bestmove b8c6")
+	e.expectSent(t, "force")
+
+	// The engine doesn't follow the requested position, so it's set up again.
+	send("position startpos moves d2d4")
+	send("go movetime 1500")
+	e.expectSent(t, "new", "force", "post", "easy", "usermove d2d4", "st 2", "go")
+	e.out <- "resign"
+	expectRecv(t, p, "info string resign", "bestmove 0000")
+	e.expectSent(t, "force")
+}
+
+func TestFeatureTimeout(t *testing.T) {
+	e := newFakeEngine()
+	p := NewProcess(e, Options{FeatureTimeout: 10 * time.Millisecond})
+	defer p.Kill()
+	if err := p.Send("uci"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	e.expectSent(t, "xboard", "protover 2", "new", "force", "post", "easy")
+	expectRecv(t, p, "id name xboard engine", "uciok")
+
+	// Without "ping" feature, the engine is assumed to be always ready.
+	if err := p.Send("isready"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	expectRecv(t, p, "readyok")
+}
+
+func TestUCIScore(t *testing.T) {
+	for _, tc := range []struct {
+		score    int64
+		expected string
+	}{
+		{0, "cp 0"},
+		{-250, "cp -250"},
+		{99999, "cp 99999"},
+		{100001, "mate 1"},
+		{100015, "mate 15"},
+		{-100001, "mate -1"},
+		{-100015, "mate -15"},
+	} {
+		if got := uciScore(tc.score); got != tc.expected {
+			t.Fatalf("bad score for %v: expected = %q, got = %q", tc.score, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package configcheck validates options files of Day20 binaries and reports all the problems found.
+package configcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/enginemap"
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type item struct {
+	what   string
+	detail string
+	warn   bool
+	err    error
+}
+
+// Report collects the results of individual checks.
+type Report struct {
+	items  []item
+	failed int
+}
+
+func (r *Report) OK(what, detail string) {
+	r.items = append(r.items, item{what: what, detail: detail})
+}
+
+// Warn adds an item which doesn't fail the check, but needs attention.
+func (r *Report) Warn(what, detail string) {
+	r.items = append(r.items, item{what: what, detail: detail, warn: true})
+}
+
+func (r *Report) Fail(what string, err error) {
+	r.items = append(r.items, item{what: what, err: err})
+	r.failed++
+}
+
+// Check adds a successful item if err is nil, and a failed one otherwise.
+func (r *Report) Check(what string, err error) {
+	if err != nil {
+		r.Fail(what, err)
+		return
+	}
+	r.OK(what, "")
+}
+
+func (r *Report) Write(w io.Writer) error {
+	for _, it := range r.items {
+		var err error
+		switch {
+		case it.err != nil:
+			_, err = fmt.Fprintf(w, "[FAIL] %v: %v\n", it.what, it.err)
+		case it.warn:
+			_, err = fmt.Fprintf(w, "[WARN] %v: %v\n", it.what, it.detail)
+		case it.detail != "":
+			_, err = fmt.Fprintf(w, "[ OK ] %v: %v\n", it.what, it.detail)
+		default:
+			_, err = fmt.Fprintf(w, "[ OK ] %v\n", it.what)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Err returns a non-nil error if at least one check failed.
+func (r *Report) Err() error {
+	if r.failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%v check(s) failed", r.failed)
+}
+
+// DecodeFile reads the TOML options file into v. Keys which do not correspond to any option are
+// reported as errors, since they are most likely typos. Returns false if the file cannot be used.
+func DecodeFile(r *Report, path string, v any) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		r.Fail("read options", err)
+		return false
+	}
+	meta, err := toml.Decode(string(data), v)
+	if err != nil {
+		r.Fail("parse options", err)
+		return false
+	}
+	r.OK("parse options", path)
+	for _, key := range meta.Undecoded() {
+		r.Fail("options", fmt.Errorf("unknown key %q", key.String()))
+	}
+	return true
+}
+
+// ProbeEngine starts the engine and waits for the protocol handshake to complete. Returns the name
+// reported by the engine.
+func ProbeEngine(ctx context.Context, o battle.EnginePoolOptions) (string, error) {
+	o.Prewarm = 0
+	o.IdleTimeout = 0
+	pool, err := battle.NewEnginePool(ctx, slogx.DiscardLogger(), o)
+	if err != nil {
+		return "", err
+	}
+	defer pool.Close()
+	return pool.EngineName(), nil
+}
+
+// CheckEngine validates the engine options and probes the engine.
+func CheckEngine(ctx context.Context, r *Report, what string, o enginemap.EngineOptions) {
+	poolOpts, err := o.PoolOptions(what)
+	if err != nil {
+		r.Fail(what, err)
+		return
+	}
+	name, err := ProbeEngine(ctx, poolOpts)
+	if err != nil {
+		r.Fail(what, fmt.Errorf("probe %q: %w", o.Name, err))
+		return
+	}
+	r.OK(what, name)
+}
+
+// CheckEngineMap validates the engine map. All the explicitly listed engines are probed. Engines from
+// allowed dirs and PATH are not, as they are only known when a contest requests them.
+func CheckEngineMap(ctx context.Context, r *Report, o *enginemap.Options) {
+	for _, dir := range o.AllowDirs {
+		what := fmt.Sprintf("engines: allowed dir %q", dir)
+		if dir == "" {
+			dir = "."
+		}
+		st, err := os.Stat(dir)
+		switch {
+		case err != nil:
+			r.Fail(what, err)
+		case !st.IsDir():
+			r.Fail(what, fmt.Errorf("not a directory"))
+		default:
+			r.OK(what, "")
+		}
+	}
+	if len(o.AllowDirs) != 0 || o.AllowPathDangerous {
+		_, err := o.Default.PoolOptions("default")
+		r.Check("engines: default options", err)
+	}
+
+	names := make([]string, 0, len(o.Engines))
+	for name := range o.Engines {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	m := enginemap.New(*o)
+	for _, name := range names {
+		what := "engines: " + name
+		if _, err := m.GetOptions(roomapi.JobEngine{Name: name}); err != nil {
+			r.Fail(what, err)
+			continue
+		}
+		CheckEngine(ctx, r, what, o.Engines[name])
+	}
+	if len(names) == 0 && len(o.AllowDirs) == 0 && !o.AllowPathDangerous {
+		r.Fail("engines", fmt.Errorf("no engines available"))
+	}
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/userauth"
+)
+
+// QueryPlan is the plan of one of the hot queries, as reported by EXPLAIN QUERY PLAN.
+type QueryPlan struct {
+	Name  string
+	SQL   string
+	Steps []string
+	// Scans are the tables which are read fully by the query. Such queries become slow as the
+	// tables grow, so they likely miss an index.
+	Scans []string
+}
+
+type hotQuery struct {
+	name string
+	// fullTable is the table which the query reads fully by design, so scanning it is expected.
+	fullTable string
+	build     func(tx *gorm.DB) *gorm.DB
+}
+
+// hotQueries are the queries which are run often or on large tables. They must follow the queries
+// in db.go, so keep them in sync.
+var hotQueries = []hotQuery{
+	{"list active rooms", "rooms", func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&Room{}).Joins("Job").Find(&[]Room{})
+	}},
+	{"update room", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&Room{}).Where("id = ?", "").Select("job_id", "state").Updates(&Room{})
+	}},
+	{"delete running job", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id = ?", "").Delete(&scheduler.RunningJob{})
+	}},
+	{"list contest succeeded jobs", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("contest_id = ? AND status_kind = ?", "", roomkeeper.JobSucceeded).
+			Order("`index`, id").Find(&[]scheduler.FinishedJob{})
+	}},
+	{"list contest finished jobs", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("contest_id = ?", "").Offset(1).Limit(1).Order("id DESC").Find(&[]scheduler.FinishedJob{})
+	}},
+	{"get contest finished job", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("contest_id = ? AND id = ?", "", "").Limit(1).Find(&[]scheduler.FinishedJob{})
+	}},
+	{"get contest succeeded job", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("contest_id = ? AND status_kind = ? AND `index` = ?", "", roomkeeper.JobSucceeded, 0).
+			Limit(1).Find(&[]scheduler.FinishedJob{})
+	}},
+	{"list failed jobs", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("status_kind IN ?", []roomkeeper.JobStatusKind{roomkeeper.JobAborted, roomkeeper.JobFailed}).
+			Offset(1).Limit(1).Order("id DESC").Find(&[]scheduler.FinishedJob{})
+	}},
+	{"list games", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Model(&scheduler.Game{}).Offset(1).Limit(1).Order("finished_at DESC, job_id DESC").
+			Find(&[]scheduler.Game{})
+	}},
+	{"list contests", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("visibility = ?", scheduler.ContestPublic).Order("id DESC").Offset(1).Limit(1).
+			Find(&[]Contest{})
+	}},
+	{"list running contests", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("status_kind = ?", scheduler.ContestRunning).Find(&[]Contest{})
+	}},
+	{"get room token", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("hash = ?", "").Limit(1).Find(&[]userauth.RoomToken{})
+	}},
+	{"get api token", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("hash = ?", "").Limit(1).Find(&[]userauth.APIToken{})
+	}},
+	{"list user room tokens", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("user_id = ?", "").Find(&[]userauth.RoomToken{})
+	}},
+	{"list user sessions", "", func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("user_id = ?", "").Order("last_seen_at DESC").Find(&[]userauth.Session{})
+	}},
+}
+
+// AnalyzeQueries runs EXPLAIN QUERY PLAN on the hot queries.
+func (d *DB) AnalyzeQueries(ctx context.Context) ([]QueryPlan, error) {
+	plans := make([]QueryPlan, 0, len(hotQueries))
+	for _, q := range hotQueries {
+		stmt := q.build(d.db.WithContext(ctx).Session(&gorm.Session{DryRun: true})).Statement
+		sql := stmt.SQL.String()
+		plan := QueryPlan{Name: q.name, SQL: sql}
+		rows, err := d.db.WithContext(ctx).Raw("EXPLAIN QUERY PLAN "+sql, stmt.Vars...).Rows()
+		if err != nil {
+			return nil, fmt.Errorf("explain %q: %w", q.name, err)
+		}
+		err = func() error {
+			defer rows.Close()
+			for rows.Next() {
+				var (
+					id, parent, notUsed int
+					detail              string
+				)
+				if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+					return fmt.Errorf("scan: %w", err)
+				}
+				plan.Steps = append(plan.Steps, detail)
+				table, ok := strings.CutPrefix(detail, "SCAN ")
+				if ok && !strings.Contains(table, " USING ") && table != q.fullTable {
+					plan.Scans = append(plan.Scans, table)
+				}
+			}
+			return rows.Err()
+		}()
+		if err != nil {
+			return nil, fmt.Errorf("explain %q: %w", q.name, err)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
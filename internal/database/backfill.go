@@ -0,0 +1,133 @@
+package database
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/alex65536/day20/internal/rater"
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+	"gorm.io/gorm"
+)
+
+const backfillBatchSize = 200
+
+// backfill fills the columns which were added after the rows had been written. It runs on each start
+// after the migration, so all the steps must be cheap when there is nothing left to fill. The steps
+// which are not cheap run only once and are recorded in the backfills table.
+func (d *DB) backfill() error {
+	if err := d.backfillOnce("games", d.backfillGames); err != nil {
+		return fmt.Errorf("games: %w", err)
+	}
+	if err := d.backfillOnce("ratings-public-only", d.resetRatings); err != nil {
+		return fmt.Errorf("ratings: %w", err)
+	}
+	if err := d.backfillContestFinishedAt(); err != nil {
+		return fmt.Errorf("contest finished_at: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) backfillOnce(name string, step func() error) error {
+	var count int64
+	if err := d.db.Model(&Backfill{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return fmt.Errorf("check backfill: %w", err)
+	}
+	if count != 0 {
+		return nil
+	}
+	if err := step(); err != nil {
+		return err
+	}
+	if err := d.db.Create(&Backfill{Name: name, AppliedAt: timeutil.NowUTC()}).Error; err != nil {
+		return fmt.Errorf("record backfill: %w", err)
+	}
+	return nil
+}
+
+// backfillGames creates the games for the jobs which finished before the games were recorded, and
+// fills the ECO codes for the games recorded before they were classified. Both are rebuilt from the
+// stored PGN. The jobs with broken PGN are skipped.
+func (d *DB) backfillGames() error {
+	var (
+		jobs    []scheduler.FinishedJob
+		created int
+		updated int
+	)
+	res := d.db.Preload("Game").
+		Where("status_kind = ? AND pgn IS NOT NULL", roomkeeper.JobSucceeded).
+		FindInBatches(&jobs, backfillBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range jobs {
+				job := &jobs[i]
+				if job.Game != nil && job.Game.ECO != "" {
+					continue
+				}
+				game, err := scheduler.GameFromPGN(job)
+				if err != nil {
+					d.log.Warn("cannot backfill game",
+						slog.String("job_id", job.Job.ID),
+						slogx.Err(err),
+					)
+					continue
+				}
+				if job.Game != nil {
+					if game.ECO == "" {
+						continue
+					}
+					err := d.db.Model(&scheduler.Game{}).Where("job_id = ?", job.Job.ID).
+						Update("eco", game.ECO).Error
+					if err != nil {
+						return fmt.Errorf("update game: %w", err)
+					}
+					updated++
+					continue
+				}
+				if err := d.db.Create(game).Error; err != nil {
+					return fmt.Errorf("create game: %w", err)
+				}
+				created++
+			}
+			return nil
+		})
+	if err := res.Error; err != nil {
+		return fmt.Errorf("list jobs: %w", err)
+	}
+	d.log.Info("backfilled games", slog.Int("created", created), slog.Int("updated", updated))
+	return nil
+}
+
+// resetRatings removes all the rating results, so the rater computes them again from scratch. It is
+// needed since the contests which are not public were rated before.
+func (d *DB) resetRatings() error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&rater.PairResult{}).Error; err != nil {
+			return fmt.Errorf("delete pair results: %w", err)
+		}
+		if err := tx.Where("1 = 1").Delete(&rater.RatedContest{}).Error; err != nil {
+			return fmt.Errorf("delete rated contests: %w", err)
+		}
+		return nil
+	})
+}
+
+// backfillContestFinishedAt sets finished_at of the contests which finished before the column
+// existed. The time of the last game is used if known, otherwise the current time, so such contests
+// are archived after the usual delay instead of never.
+func (d *DB) backfillContestFinishedAt() error {
+	res := d.db.Exec(
+		"UPDATE `contests` SET `finished_at` = COALESCE("+
+			"(SELECT MAX(`games`.`finished_at`) FROM `games` WHERE `games`.`contest_id` = `contests`.`id`), ?"+
+			") WHERE `finished_at` IS NULL AND `status_kind` IN ?",
+		timeutil.NowUTC(),
+		[]scheduler.ContestStatusKind{scheduler.ContestSucceeded, scheduler.ContestAborted, scheduler.ContestFailed},
+	)
+	if err := res.Error; err != nil {
+		return fmt.Errorf("update contests: %w", err)
+	}
+	if res.RowsAffected != 0 {
+		d.log.Info("backfilled contest finish times", slog.Int64("contests", res.RowsAffected))
+	}
+	return nil
+}
@@ -8,16 +8,23 @@ import (
 	"sync"
 	"time"
 
+	"github.com/alex65536/day20/internal/archiver"
+	"github.com/alex65536/day20/internal/broadcast"
+	"github.com/alex65536/day20/internal/delta"
+	"github.com/alex65536/day20/internal/discuss"
+	"github.com/alex65536/day20/internal/notify"
+	"github.com/alex65536/day20/internal/rater"
 	"github.com/alex65536/day20/internal/roomapi"
 	"github.com/alex65536/day20/internal/roomkeeper"
 	"github.com/alex65536/day20/internal/scheduler"
 	"github.com/alex65536/day20/internal/userauth"
 	_ "github.com/alex65536/day20/internal/util/gormutil"
+	"github.com/alex65536/day20/internal/util/idgen"
 	"github.com/alex65536/day20/internal/util/sliceutil"
 	"github.com/alex65536/day20/internal/util/slogx"
 	"github.com/alex65536/day20/internal/util/timeutil"
 	"github.com/alex65536/day20/internal/webui"
-	"github.com/alex65536/go-chess/util/maybe"
+	"github.com/alex65536/go-chess/chess"
 	"github.com/gorilla/sessions"
 	"github.com/wader/gormstore/v2"
 	"gorm.io/driver/sqlite"
@@ -47,8 +54,14 @@ type DB struct {
 	db  *gorm.DB
 	log *slog.Logger
 
-	contestDataCols []string
-	matchDataCols   []string
+	contestDataCols      []string
+	matchDataCols        []string
+	swissDataCols        []string
+	knockoutDataCols     []string
+	contestSettingsCols  []string
+	matchSettingsCols    []string
+	swissSettingsCols    []string
+	knockoutSettingsCols []string
 }
 
 var (
@@ -56,8 +69,17 @@ var (
 	_ userauth.DB               = (*DB)(nil)
 	_ webui.SessionStoreFactory = (*DB)(nil)
 	_ scheduler.DB              = (*DB)(nil)
+	_ archiver.DB               = (*DB)(nil)
+	_ rater.DB                  = (*DB)(nil)
+	_ notify.DB                 = (*DB)(nil)
+	_ discuss.DB                = (*DB)(nil)
+	_ broadcast.DB              = (*DB)(nil)
 )
 
+// likeEscaper escapes the special characters of LIKE patterns. The patterns must use '\' as the
+// escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 func (d *DB) Close() {
 	db, err := d.db.DB()
 	if err != nil {
@@ -107,9 +129,76 @@ func (d *DB) parseColumns() error {
 	if err != nil {
 		return fmt.Errorf("parse MatchData: %w", err)
 	}
+	d.swissDataCols, err = d.doParseColumns(&scheduler.SwissData{}, store)
+	if err != nil {
+		return fmt.Errorf("parse SwissData: %w", err)
+	}
+	d.knockoutDataCols, err = d.doParseColumns(&scheduler.KnockoutData{}, store)
+	if err != nil {
+		return fmt.Errorf("parse KnockoutData: %w", err)
+	}
+	d.contestSettingsCols, err = d.doParseColumns(&scheduler.ContestSettings{}, store)
+	if err != nil {
+		return fmt.Errorf("parse ContestSettings: %w", err)
+	}
+	d.matchSettingsCols, err = d.doParseColumns(&scheduler.MatchSettings{}, store)
+	if err != nil {
+		return fmt.Errorf("parse MatchSettings: %w", err)
+	}
+	d.swissSettingsCols, err = d.doParseColumns(&scheduler.SwissSettings{}, store)
+	if err != nil {
+		return fmt.Errorf("parse SwissSettings: %w", err)
+	}
+	d.knockoutSettingsCols, err = d.doParseColumns(&scheduler.KnockoutSettings{}, store)
+	if err != nil {
+		return fmt.Errorf("parse KnockoutSettings: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) createIndexes() error {
+	for _, idx := range compositeIndexes {
+		cols := make([]string, len(idx.Columns))
+		for i, c := range idx.Columns {
+			cols[i] = "`" + c + "`"
+		}
+		err := d.db.Exec(fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS `%s` ON `%s` (%s)",
+			idx.Name, idx.Table, strings.Join(cols, ", "),
+		)).Error
+		if err != nil {
+			return fmt.Errorf("create index %q: %w", idx.Name, err)
+		}
+	}
 	return nil
 }
 
+// dropContestKindConstraints removes the foreign keys from contests to the tables of contest kinds,
+// which older versions created. The table is recreated by the migrator, so the foreign keys are
+// disabled meanwhile, as other tables reference contests.
+func (d *DB) dropContestKindConstraints() error {
+	return d.db.Connection(func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if !m.HasTable(&Contest{}) {
+			return nil
+		}
+		if err := tx.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return fmt.Errorf("disable foreign keys: %w", err)
+		}
+		defer tx.Exec("PRAGMA foreign_keys = ON")
+		for _, name := range []string{"fk_contests_match", "fk_contests_swiss", "fk_contests_knockout"} {
+			if !m.HasConstraint(&Contest{}, name) {
+				continue
+			}
+			if err := m.DropConstraint(&Contest{}, name); err != nil {
+				return fmt.Errorf("drop %q: %w", name, err)
+			}
+			d.log.Info("dropped contest constraint", slog.String("name", name))
+		}
+		return nil
+	})
+}
+
 func New(log *slog.Logger, o Options) (*DB, error) {
 	o.FillDefaults()
 
@@ -132,10 +221,22 @@ func New(log *slog.Logger, o Options) (*DB, error) {
 	}
 
 	log.Info("migrating db")
+	if err := d.dropContestKindConstraints(); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("drop contest constraints: %w", err)
+	}
 	if err := db.AutoMigrate(models...); err != nil {
 		d.Close()
 		return nil, fmt.Errorf("migrate db: %w", err)
 	}
+	if err := d.createIndexes(); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("create indexes: %w", err)
+	}
+	if err := d.backfill(); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("backfill db: %w", err)
+	}
 
 	log.Info("db opened")
 	return d, nil
@@ -148,13 +249,18 @@ func (d *DB) ListActiveRooms(ctx context.Context) ([]roomkeeper.RoomFullData, er
 		return nil, fmt.Errorf("list active rooms: %w", err)
 	}
 	data := sliceutil.Map(res, func(r Room) roomkeeper.RoomFullData {
-		var job *roomapi.Job
+		var (
+			job   *roomapi.Job
+			state *delta.JobState
+		)
 		if r.JobID != nil {
 			job = &r.Job.Job
+			state = r.State
 		}
 		return roomkeeper.RoomFullData{
-			Info: r.Info,
-			Job:  job,
+			Info:  r.Info,
+			Job:   job,
+			State: state,
 		}
 	})
 	return data, nil
@@ -171,14 +277,31 @@ func (d *DB) CreateRoom(ctx context.Context, info roomkeeper.RoomInfo) error {
 	return nil
 }
 
-func (d *DB) UpdateRoom(ctx context.Context, roomID string, jobID maybe.Maybe[string]) error {
-	var jobIDPtr *string
-	if j, ok := jobID.TryGet(); ok {
-		jobIDPtr = &j
-	}
-	err := d.db.WithContext(ctx).Model(&Room{}).Where("id = ?", roomID).Update("job_id", jobIDPtr).Error
+func (d *DB) UpdateRooms(ctx context.Context, rooms map[string]roomkeeper.RoomUpdate) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for roomID, upd := range rooms {
+			var jobIDPtr *string
+			if j, ok := upd.JobID.TryGet(); ok {
+				jobIDPtr = &j
+			}
+			err := tx.Model(&Room{}).Where("id = ?", roomID).Select("job_id", "state").Updates(&Room{
+				JobID: jobIDPtr,
+				State: upd.State,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("update room: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *DB) UpdateRoomBenchmark(ctx context.Context, roomID string, nps int64, timeScale float64) error {
+	err := d.db.WithContext(ctx).Model(&Room{}).Where("id = ?", roomID).Select("benchmark_nps", "time_scale").Updates(&Room{
+		Info: roomkeeper.RoomInfo{BenchmarkNPS: nps, TimeScale: timeScale},
+	}).Error
 	if err != nil {
-		return fmt.Errorf("update room: %w", err)
+		return fmt.Errorf("update room benchmark: %w", err)
 	}
 	return nil
 }
@@ -193,23 +316,54 @@ func (d *DB) StopRoom(ctx context.Context, roomID string) error {
 	return nil
 }
 
+func createUserTx(tx *gorm.DB, user *userauth.User) error {
+	var result []userauth.User
+	err := tx.Where("username = ?", user.Username).Limit(1).Find(&result).Error
+	if err != nil {
+		return fmt.Errorf("search for user: %w", err)
+	}
+	if len(result) != 0 {
+		return userauth.ErrUserAlreadyExists
+	}
+	for _, acc := range user.ExternalAccounts {
+		var accounts []userauth.ExternalAccount
+		err := tx.Where("provider = ? AND subject = ?", acc.Provider, acc.Subject).Limit(1).Find(&accounts).Error
+		if err != nil {
+			return fmt.Errorf("search for external account: %w", err)
+		}
+		if len(accounts) != 0 {
+			return userauth.ErrExternalTaken
+		}
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return fmt.Errorf("create user: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) CreateUserWithoutInvite(ctx context.Context, user userauth.User) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return createUserTx(tx, &user)
+	})
+}
+
 func (d *DB) CreateUser(ctx context.Context, user userauth.User, link userauth.InviteLink) error {
 	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		var result []userauth.User
-		err := tx.Where("username = ?", user.Username).Limit(1).Find(&result).Error
-		if err != nil {
-			return fmt.Errorf("search for user: %w", err)
+		if err := createUserTx(tx, &user); err != nil {
+			return err
 		}
-		if len(result) != 0 {
-			return userauth.ErrUserAlreadyExists
+		// Multi-use links are decremented, and the link is deleted when the last use is taken.
+		decTx := tx.Model(&userauth.InviteLink{}).
+			Where("hash = ? AND uses_left > 1", link.Hash).
+			Update("uses_left", gorm.Expr("uses_left - 1"))
+		if err := decTx.Error; err != nil {
+			return fmt.Errorf("decrement link uses: %w", err)
 		}
-		err = tx.Create(&user).Error
-		if err != nil {
-			return fmt.Errorf("create user: %w", err)
+		if decTx.RowsAffected != 0 {
+			return nil
 		}
-		delTx := tx.Delete(link)
-		err = delTx.Error
-		if err != nil {
+		delTx := tx.Delete(&userauth.InviteLink{Hash: link.Hash})
+		if err := delTx.Error; err != nil {
 			return fmt.Errorf("delete link: %w", err)
 		}
 		if delTx.RowsAffected == 0 {
@@ -231,6 +385,9 @@ func (d *DB) applyUserOptions(tx *gorm.DB, os ...userauth.GetUserOptions) *gorm.
 		if o.WithRoomTokens {
 			tx = tx.Preload("RoomTokens")
 		}
+		if o.WithAPITokens {
+			tx = tx.Preload("APITokens")
+		}
 	}
 	return tx
 }
@@ -261,39 +418,106 @@ func (d *DB) GetUserByUsername(ctx context.Context, username string, o ...userau
 	return users[0], nil
 }
 
-func (d *DB) UpdateUser(ctx context.Context, user userauth.User, srcO ...userauth.UpdateUserOptions) error {
-	var o userauth.UpdateUserOptions
+func (d *DB) GetUserByVerifiedEmail(ctx context.Context, email string) (userauth.User, error) {
+	var users []userauth.User
+	err := d.db.WithContext(ctx).Where("email = ? AND email_verified", email).Limit(1).Find(&users).Error
+	if err != nil {
+		return userauth.User{}, fmt.Errorf("get user: %w", err)
+	}
+	if len(users) == 0 {
+		return userauth.User{}, userauth.ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+func getUpdateUserOptions(srcO []userauth.UpdateUserOptions) userauth.UpdateUserOptions {
 	if len(srcO) > 1 {
 		panic("too many options")
 	}
 	if len(srcO) == 1 {
-		o = srcO[0]
+		return srcO[0]
 	}
+	return userauth.UpdateUserOptions{}
+}
 
-	if o == (userauth.UpdateUserOptions{}) {
-		err := d.db.WithContext(ctx).Select("*").Updates(&user).Error
+func updateUserTx(tx *gorm.DB, user *userauth.User, o userauth.UpdateUserOptions) error {
+	if err := tx.Select("*").Updates(user).Error; err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+	if !o.InvalidatePerms {
+		return nil
+	}
+	if !user.Perms.Get(userauth.PermInvite) {
+		err := tx.Where("owner_user_id = ?", user.ID).Delete(&userauth.InviteLink{}).Error
 		if err != nil {
-			return fmt.Errorf("update user: %w", err)
+			return fmt.Errorf("delete invite links: %w", err)
+		}
+	}
+	if !user.Perms.Get(userauth.PermHostRooms) {
+		err := tx.Where("user_id = ?", user.ID).Delete(&userauth.RoomToken{}).Error
+		if err != nil {
+			return fmt.Errorf("delete room tokens: %w", err)
+		}
+	}
+	if !user.Perms.Get(userauth.PermRunContests) {
+		err := tx.Where("user_id = ?", user.ID).Delete(&userauth.APIToken{}).Error
+		if err != nil {
+			return fmt.Errorf("delete api tokens: %w", err)
 		}
-		return nil
 	}
+	return nil
+}
 
+func (d *DB) UpdateUser(ctx context.Context, user userauth.User, srcO ...userauth.UpdateUserOptions) error {
+	o := getUpdateUserOptions(srcO)
+	if o == (userauth.UpdateUserOptions{}) {
+		return updateUserTx(d.db.WithContext(ctx), &user, o)
+	}
 	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Select("*").Updates(&user).Error; err != nil {
-			return fmt.Errorf("update user: %w", err)
-		}
-		if !user.Perms.Get(userauth.PermInvite) {
-			err := tx.Where("owner_user_id = ?", user.ID).Delete(&userauth.InviteLink{}).Error
-			if err != nil {
-				return fmt.Errorf("delete invite links: %w", err)
+		return updateUserTx(tx, &user, o)
+	})
+}
+
+func (d *DB) UpdateUsers(ctx context.Context, users []userauth.User, srcO ...userauth.UpdateUserOptions) error {
+	o := getUpdateUserOptions(srcO)
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range users {
+			if err := updateUserTx(tx, &users[i], o); err != nil {
+				return fmt.Errorf("user %q: %w", users[i].Username, err)
 			}
 		}
-		if !user.Perms.Get(userauth.PermHostRooms) {
-			err := tx.Where("user_id = ?", user.ID).Delete(&userauth.RoomToken{}).Error
-			if err != nil {
-				return fmt.Errorf("delete room tokens: %w", err)
+		return nil
+	})
+}
+
+// DeleteUser removes the user together with their credentials, sessions and notification targets.
+// Contests and comments created by the user are kept.
+func (d *DB) DeleteUser(ctx context.Context, userID string) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, m := range []struct {
+			model any
+			cond  string
+		}{
+			{&userauth.InviteLink{}, "owner_user_id = ?"},
+			{&userauth.RoomToken{}, "user_id = ?"},
+			{&userauth.APIToken{}, "user_id = ?"},
+			{&userauth.EmailToken{}, "user_id = ?"},
+			{&userauth.Session{}, "user_id = ?"},
+			{&userauth.ExternalAccount{}, "user_id = ?"},
+			{&notify.Target{}, "user_id = ?"},
+			{&broadcast.LichessToken{}, "user_id = ?"},
+		} {
+			if err := tx.Where(m.cond, userID).Delete(m.model).Error; err != nil {
+				return fmt.Errorf("delete %T: %w", m.model, err)
 			}
 		}
+		res := tx.Delete(&userauth.User{ID: userID})
+		if err := res.Error; err != nil {
+			return fmt.Errorf("delete user: %w", err)
+		}
+		if res.RowsAffected == 0 {
+			return userauth.ErrUserNotFound
+		}
 		return nil
 	})
 }
@@ -377,6 +601,178 @@ func (d *DB) DeleteRoomToken(ctx context.Context, tokenHash string, userID strin
 	return nil
 }
 
+func (d *DB) CreateAPIToken(ctx context.Context, token userauth.APIToken) error {
+	err := d.db.WithContext(ctx).Create(&token).Error
+	if err != nil {
+		return fmt.Errorf("create api token: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetAPIToken(ctx context.Context, hash string) (userauth.APIToken, error) {
+	var tokens []userauth.APIToken
+	err := d.db.WithContext(ctx).Where("hash = ?", hash).Limit(1).Find(&tokens).Error
+	if err != nil {
+		return userauth.APIToken{}, fmt.Errorf("get api token: %w", err)
+	}
+	if len(tokens) == 0 {
+		return userauth.APIToken{}, userauth.ErrAPITokenNotFound
+	}
+	return tokens[0], nil
+}
+
+func (d *DB) DeleteAPIToken(ctx context.Context, tokenHash string, userID string) error {
+	err := d.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&userauth.APIToken{Hash: tokenHash}).Error
+	if err != nil {
+		return fmt.Errorf("delete api token: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) CreateEmailToken(ctx context.Context, token userauth.EmailToken) error {
+	err := d.db.WithContext(ctx).Create(&token).Error
+	if err != nil {
+		return fmt.Errorf("create email token: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetEmailToken(ctx context.Context, hash string, now timeutil.UTCTime) (userauth.EmailToken, error) {
+	var tokens []userauth.EmailToken
+	err := d.db.WithContext(ctx).Where("hash = ? AND expires_at >= ?", hash, now).Limit(1).Find(&tokens).Error
+	if err != nil {
+		return userauth.EmailToken{}, fmt.Errorf("get email token: %w", err)
+	}
+	if len(tokens) == 0 {
+		return userauth.EmailToken{}, userauth.ErrEmailTokenInvalid
+	}
+	return tokens[0], nil
+}
+
+func (d *DB) DeleteEmailTokens(ctx context.Context, userID string, kind userauth.EmailTokenKind) error {
+	err := d.db.WithContext(ctx).Where("user_id = ? AND kind = ?", userID, kind).Delete(&userauth.EmailToken{}).Error
+	if err != nil {
+		return fmt.Errorf("delete email tokens: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) PruneEmailTokens(ctx context.Context, now timeutil.UTCTime) error {
+	err := d.db.WithContext(ctx).Delete(&userauth.EmailToken{}, "expires_at < ?", now).Error
+	if err != nil {
+		return fmt.Errorf("prune email tokens: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) CreateSession(ctx context.Context, session userauth.Session) error {
+	err := d.db.WithContext(ctx).Create(&session).Error
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetSession(ctx context.Context, sessionID string) (userauth.Session, error) {
+	var sessions []userauth.Session
+	err := d.db.WithContext(ctx).Where("id = ?", sessionID).Limit(1).Find(&sessions).Error
+	if err != nil {
+		return userauth.Session{}, fmt.Errorf("get session: %w", err)
+	}
+	if len(sessions) == 0 {
+		return userauth.Session{}, userauth.ErrSessionNotFound
+	}
+	return sessions[0], nil
+}
+
+func (d *DB) TouchSession(ctx context.Context, sessionID string, now timeutil.UTCTime, ip string) error {
+	err := d.db.WithContext(ctx).Model(&userauth.Session{}).Where("id = ?", sessionID).
+		Updates(map[string]any{"last_seen_at": now, "ip": ip}).Error
+	if err != nil {
+		return fmt.Errorf("touch session: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) ListUserSessions(ctx context.Context, userID string) ([]userauth.Session, error) {
+	var sessions []userauth.Session
+	err := d.db.WithContext(ctx).Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (d *DB) DeleteSession(ctx context.Context, sessionID string, userID string) error {
+	err := d.db.WithContext(ctx).Delete(&userauth.Session{}, "id = ? AND user_id = ?", sessionID, userID).Error
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) PruneSessions(ctx context.Context, lastSeenBefore timeutil.UTCTime) error {
+	err := d.db.WithContext(ctx).Delete(&userauth.Session{}, "last_seen_at < ?", lastSeenBefore).Error
+	if err != nil {
+		return fmt.Errorf("prune sessions: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) CreateExternalAccount(ctx context.Context, account userauth.ExternalAccount) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var result []userauth.ExternalAccount
+		err := tx.Where("(provider = ? AND subject = ?) OR (provider = ? AND user_id = ?)",
+			account.Provider, account.Subject, account.Provider, account.UserID).
+			Limit(1).Find(&result).Error
+		if err != nil {
+			return fmt.Errorf("search for account: %w", err)
+		}
+		if len(result) != 0 {
+			return userauth.ErrExternalTaken
+		}
+		if err := tx.Create(&account).Error; err != nil {
+			return fmt.Errorf("create account: %w", err)
+		}
+		return nil
+	})
+}
+
+func (d *DB) GetExternalAccount(ctx context.Context, provider string, subject string) (userauth.ExternalAccount, error) {
+	var accounts []userauth.ExternalAccount
+	err := d.db.WithContext(ctx).
+		Where("provider = ? AND subject = ?", provider, subject).
+		Limit(1).
+		Find(&accounts).
+		Error
+	if err != nil {
+		return userauth.ExternalAccount{}, fmt.Errorf("get external account: %w", err)
+	}
+	if len(accounts) == 0 {
+		return userauth.ExternalAccount{}, userauth.ErrExternalNotFound
+	}
+	return accounts[0], nil
+}
+
+func (d *DB) ListUserExternalAccounts(ctx context.Context, userID string) ([]userauth.ExternalAccount, error) {
+	var accounts []userauth.ExternalAccount
+	err := d.db.WithContext(ctx).Where("user_id = ?", userID).Find(&accounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("list external accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+func (d *DB) DeleteExternalAccount(ctx context.Context, provider string, userID string) error {
+	err := d.db.WithContext(ctx).
+		Delete(&userauth.ExternalAccount{}, "provider = ? AND user_id = ?", provider, userID).
+		Error
+	if err != nil {
+		return fmt.Errorf("delete external account: %w", err)
+	}
+	return nil
+}
+
 func (d *DB) NewSessionStore(ctx context.Context, opts webui.SessionOptions) sessions.Store {
 	s := gormstore.New(d.db, opts.Key)
 	opts.AssignSessionOptions(s.SessionOpts)
@@ -389,6 +785,14 @@ func (d *DB) buildContestFullData(c Contest) scheduler.ContestFullData {
 		c.Info.Match = &c.Match.Settings
 		c.Data.Match = &c.Match.Data
 	}
+	if c.Swiss != nil {
+		c.Info.Swiss = &c.Swiss.Settings
+		c.Data.Swiss = &c.Swiss.Data
+	}
+	if c.Knockout != nil {
+		c.Info.Knockout = &c.Knockout.Settings
+		c.Data.Knockout = &c.Knockout.Data
+	}
 	return scheduler.ContestFullData{
 		Info: c.Info,
 		Data: c.Data,
@@ -397,16 +801,69 @@ func (d *DB) buildContestFullData(c Contest) scheduler.ContestFullData {
 
 func (d *DB) ListContests(ctx context.Context) ([]scheduler.ContestFullData, error) {
 	var contests []Contest
-	err := d.db.WithContext(ctx).Preload("Match").Find(&contests).Error
+	err := d.db.WithContext(ctx).Preload("Match").Preload("Swiss").Preload("Knockout").Find(&contests).Error
 	if err != nil {
 		return nil, fmt.Errorf("list running contests: %w", err)
 	}
 	return sliceutil.Map(contests, d.buildContestFullData), nil
 }
 
+func (d *DB) ListContestsFiltered(ctx context.Context, filter scheduler.ContestFilter) ([]scheduler.ContestFullData, error) {
+	tx := d.db.WithContext(ctx).Preload("Match").Preload("Swiss").Preload("Knockout")
+	if !filter.Viewer.Admin {
+		if filter.Viewer.UserID != "" {
+			tx = tx.Where("(visibility = ? OR owner_id = ?)", scheduler.ContestPublic, filter.Viewer.UserID)
+		} else {
+			tx = tx.Where("visibility = ?", scheduler.ContestPublic)
+		}
+	}
+	if len(filter.Statuses) != 0 {
+		tx = tx.Where("status_kind IN ?", filter.Statuses)
+	}
+	if filter.Name != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Name) + "%"
+		tx = tx.Where(`name LIKE ? ESCAPE '\'`, pattern)
+	}
+	if filter.OwnerID != "" {
+		tx = tx.Where("owner_id = ?", filter.OwnerID)
+	}
+	// Contest IDs start with the creation time, so the ranges by creation time are ranges by ID.
+	if !filter.CreatedSince.IsZero() {
+		tx = tx.Where("id >= ?", idgen.TimePrefix(filter.CreatedSince))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		tx = tx.Where("id < ?", idgen.TimePrefix(filter.CreatedBefore))
+	}
+	if !filter.FinishedSince.IsZero() {
+		tx = tx.Where("finished_at >= ?", timeutil.UTCTime(filter.FinishedSince.UTC()))
+	}
+	if !filter.FinishedBefore.IsZero() {
+		tx = tx.Where("finished_at < ?", timeutil.UTCTime(filter.FinishedBefore.UTC()))
+	}
+	switch filter.Sort {
+	case scheduler.ContestSortCreated:
+		tx = tx.Order("id DESC")
+	case scheduler.ContestSortFinished:
+		tx = tx.Order("finished_at IS NULL, finished_at DESC, id DESC")
+	default:
+		panic("must not happen")
+	}
+	if filter.Offset != 0 {
+		tx = tx.Offset(filter.Offset)
+	}
+	if filter.Limit != 0 {
+		tx = tx.Limit(filter.Limit)
+	}
+	var contests []Contest
+	if err := tx.Find(&contests).Error; err != nil {
+		return nil, fmt.Errorf("list contests: %w", err)
+	}
+	return sliceutil.Map(contests, d.buildContestFullData), nil
+}
+
 func (d *DB) ListRunningContestsFull(ctx context.Context) ([]scheduler.ContestFullData, error) {
 	var contests []Contest
-	err := d.db.WithContext(ctx).Preload("Match").
+	err := d.db.WithContext(ctx).Preload("Match").Preload("Swiss").Preload("Knockout").
 		Where("status_kind = ?", scheduler.ContestRunning).
 		Find(&contests).Error
 	if err != nil {
@@ -438,10 +895,36 @@ func (d *DB) CreateContest(ctx context.Context, info scheduler.ContestInfo, data
 				return fmt.Errorf("create match: %w", err)
 			}
 		}
+		var swiss *Swiss
+		if info.Swiss != nil {
+			swiss = &Swiss{
+				ContestID: info.ID,
+				Settings:  *info.Swiss,
+				Data:      *data.Swiss,
+			}
+			err := tx.Create(swiss).Error
+			if err != nil {
+				return fmt.Errorf("create swiss: %w", err)
+			}
+		}
+		var knockout *Knockout
+		if info.Knockout != nil {
+			knockout = &Knockout{
+				ContestID: info.ID,
+				Settings:  *info.Knockout,
+				Data:      *data.Knockout,
+			}
+			err := tx.Create(knockout).Error
+			if err != nil {
+				return fmt.Errorf("create knockout: %w", err)
+			}
+		}
 		err := tx.Create(&Contest{
-			Info:  info,
-			Data:  data,
-			Match: match,
+			Info:     info,
+			Data:     data,
+			Match:    match,
+			Swiss:    swiss,
+			Knockout: knockout,
 		}).Error
 		if err != nil {
 			return fmt.Errorf("create contest: %w", err)
@@ -458,6 +941,20 @@ func (d *DB) doUpdateContest(tx *gorm.DB, contestID string, data scheduler.Conte
 			return fmt.Errorf("update match: %w", err)
 		}
 	}
+	if data.Swiss != nil {
+		err := tx.Select(d.swissDataCols).Where("contest_id = ?", contestID).
+			Updates(&Swiss{Data: *data.Swiss}).Error
+		if err != nil {
+			return fmt.Errorf("update swiss: %w", err)
+		}
+	}
+	if data.Knockout != nil {
+		err := tx.Select(d.knockoutDataCols).Where("contest_id = ?", contestID).
+			Updates(&Knockout{Data: *data.Knockout}).Error
+		if err != nil {
+			return fmt.Errorf("update knockout: %w", err)
+		}
+	}
 	err := tx.Select(d.contestDataCols).Where("id = ?", contestID).
 		Updates(&Contest{Data: data}).Error
 	if err != nil {
@@ -472,44 +969,117 @@ func (d *DB) UpdateContest(ctx context.Context, contestID string, data scheduler
 	})
 }
 
-func (d *DB) GetContest(ctx context.Context, contestID string) (scheduler.ContestInfo, scheduler.ContestData, error) {
-	var contests []Contest
-	err := d.db.WithContext(ctx).Preload("Match").Where("id = ?", contestID).Limit(1).Find(&contests).Error
-	if err != nil {
-		return scheduler.ContestInfo{}, scheduler.ContestData{}, fmt.Errorf("get contest: %w", err)
-	}
-	if len(contests) == 0 {
-		return scheduler.ContestInfo{}, scheduler.ContestData{}, scheduler.ErrNoSuchContest
-	}
-	fullData := d.buildContestFullData(contests[0])
-	return fullData.Info, fullData.Data, nil
-}
-
-func (d *DB) CreateRunningJob(ctx context.Context, job *scheduler.RunningJob) error {
-	err := d.db.WithContext(ctx).Create(job).Error
-	if err != nil {
-		return fmt.Errorf("create running job: %w", err)
-	}
-	return nil
+func (d *DB) UpdateContestSettings(ctx context.Context, contestID string, settings scheduler.ContestSettings) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if settings.Match != nil {
+			err := tx.Select(d.matchSettingsCols).Where("contest_id = ?", contestID).
+				Updates(&Match{Settings: *settings.Match}).Error
+			if err != nil {
+				return fmt.Errorf("update match: %w", err)
+			}
+		}
+		if settings.Swiss != nil {
+			err := tx.Select(d.swissSettingsCols).Where("contest_id = ?", contestID).
+				Updates(&Swiss{Settings: *settings.Swiss}).Error
+			if err != nil {
+				return fmt.Errorf("update swiss: %w", err)
+			}
+		}
+		if settings.Knockout != nil {
+			err := tx.Select(d.knockoutSettingsCols).Where("contest_id = ?", contestID).
+				Updates(&Knockout{Settings: *settings.Knockout}).Error
+			if err != nil {
+				return fmt.Errorf("update knockout: %w", err)
+			}
+		}
+		res := tx.Select(d.contestSettingsCols).Where("id = ?", contestID).
+			Updates(&Contest{Info: scheduler.ContestInfo{ContestSettings: settings}})
+		if err := res.Error; err != nil {
+			return fmt.Errorf("update contest: %w", err)
+		}
+		if res.RowsAffected == 0 {
+			return scheduler.ErrNoSuchContest
+		}
+		return nil
+	})
 }
 
-func (d *DB) FinishRunningJob(ctx context.Context, data *scheduler.ContestData, job *scheduler.FinishedJob) error {
+func (d *DB) UpdateContestQueuePositions(ctx context.Context, positions map[string]uint64) error {
 	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		delTx := tx.Where("id = ?", job.Job.ID).Delete(&scheduler.RunningJob{})
-		if delTx.RowsAffected == 0 {
-			d.log.Warn("trying to finish the job that was never running",
-				slog.String("job_id", job.Job.ID),
-			)
+		for contestID, pos := range positions {
+			err := tx.Model(&Contest{}).Where("id = ?", contestID).Update("pos_in_queue", pos).Error
+			if err != nil {
+				return fmt.Errorf("update contest %q: %w", contestID, err)
+			}
 		}
-		if err := delTx.Error; err != nil {
-			return fmt.Errorf("delete running job: %w", err)
+		return nil
+	})
+}
+
+func (d *DB) GetContest(ctx context.Context, contestID string) (scheduler.ContestInfo, scheduler.ContestData, error) {
+	var contests []Contest
+	err := d.db.WithContext(ctx).Preload("Match").Preload("Swiss").Preload("Knockout").Where("id = ?", contestID).Limit(1).Find(&contests).Error
+	if err != nil {
+		return scheduler.ContestInfo{}, scheduler.ContestData{}, fmt.Errorf("get contest: %w", err)
+	}
+	if len(contests) == 0 {
+		return scheduler.ContestInfo{}, scheduler.ContestData{}, scheduler.ErrNoSuchContest
+	}
+	fullData := d.buildContestFullData(contests[0])
+	return fullData.Info, fullData.Data, nil
+}
+
+func (d *DB) CreateRunningJob(ctx context.Context, job *scheduler.RunningJob) error {
+	err := d.db.WithContext(ctx).Create(job).Error
+	if err != nil {
+		return fmt.Errorf("create running job: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) finishRunningJobTx(tx *gorm.DB, data *scheduler.ContestData, job *scheduler.FinishedJob) error {
+	delTx := tx.Where("id = ?", job.Job.ID).Delete(&scheduler.RunningJob{})
+	if delTx.RowsAffected == 0 {
+		d.log.Warn("trying to finish the job that was never running",
+			slog.String("job_id", job.Job.ID),
+		)
+	}
+	if err := delTx.Error; err != nil {
+		return fmt.Errorf("delete running job: %w", err)
+	}
+	if err := tx.Create(job).Error; err != nil {
+		return fmt.Errorf("create finished job: %w", err)
+	}
+	if data != nil {
+		if err := d.doUpdateContest(tx, job.ContestID, *data); err != nil {
+			return fmt.Errorf("update contest: %w", err)
 		}
-		if err := tx.Create(job).Error; err != nil {
-			return fmt.Errorf("create finished job: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) FinishRunningJob(ctx context.Context, data *scheduler.ContestData, job *scheduler.FinishedJob) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return d.finishRunningJobTx(tx, data, job)
+	})
+}
+
+func (d *DB) FinishRunningJobs(ctx context.Context, jobs []scheduler.JobFinish) error {
+	// Only the latest state of each contest needs to be saved.
+	lastData := make(map[string]int)
+	for i, j := range jobs {
+		if j.Data != nil {
+			lastData[j.Job.ContestID] = i
 		}
-		if data != nil {
-			if err := d.doUpdateContest(tx, job.ContestID, *data); err != nil {
-				return fmt.Errorf("update contest: %w", err)
+	}
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i, j := range jobs {
+			data := j.Data
+			if lastData[j.Job.ContestID] != i {
+				data = nil
+			}
+			if err := d.finishRunningJobTx(tx, data, j.Job); err != nil {
+				return fmt.Errorf("job %v: %w", j.Job.Job.ID, err)
 			}
 		}
 		return nil
@@ -521,10 +1091,521 @@ func (d *DB) ListContestSucceededJobs(ctx context.Context, contestID string) ([]
 	err := d.db.WithContext(ctx).Where("contest_id = ? AND status_kind = ?", contestID, roomkeeper.JobSucceeded).
 		Order([]clause.OrderByColumn{
 			{Column: clause.Column{Name: "index"}},
-			{Column: clause.Column{Name: "job_id"}},
+			{Column: clause.Column{Name: "id"}},
 		}).Find(&jobs).Error
 	if err != nil {
 		return nil, fmt.Errorf("list jobs: %w", err)
 	}
 	return jobs, nil
 }
+
+func (d *DB) ListContestFinishedJobs(ctx context.Context, contestID string, offset, limit int) ([]scheduler.FinishedJob, error) {
+	var jobs []scheduler.FinishedJob
+	tx := d.db.WithContext(ctx).Preload("Game").Where("contest_id = ?", contestID)
+	if offset != 0 {
+		tx = tx.Offset(offset)
+	}
+	if limit != 0 {
+		tx = tx.Limit(limit)
+	}
+	err := tx.Order("id DESC").Find(&jobs).Error
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (d *DB) GetContestFinishedJob(ctx context.Context, contestID string, jobID string) (scheduler.FinishedJob, error) {
+	var jobs []scheduler.FinishedJob
+	err := d.db.WithContext(ctx).Preload("Game").
+		Where("contest_id = ? AND id = ?", contestID, jobID).
+		Limit(1).Find(&jobs).Error
+	if err != nil {
+		return scheduler.FinishedJob{}, fmt.Errorf("get job: %w", err)
+	}
+	if len(jobs) == 0 {
+		return scheduler.FinishedJob{}, scheduler.ErrNoSuchJob
+	}
+	return jobs[0], nil
+}
+
+func (d *DB) GetContestSucceededJob(ctx context.Context, contestID string, index int64) (scheduler.FinishedJob, error) {
+	var jobs []scheduler.FinishedJob
+	err := d.db.WithContext(ctx).Preload("Game").
+		Where("contest_id = ? AND status_kind = ? AND `index` = ?", contestID, roomkeeper.JobSucceeded, index).
+		Limit(1).Find(&jobs).Error
+	if err != nil {
+		return scheduler.FinishedJob{}, fmt.Errorf("get job: %w", err)
+	}
+	if len(jobs) == 0 {
+		return scheduler.FinishedJob{}, scheduler.ErrNoSuchJob
+	}
+	return jobs[0], nil
+}
+
+func (d *DB) GetFinishedJob(ctx context.Context, jobID string) (scheduler.FinishedJob, error) {
+	var jobs []scheduler.FinishedJob
+	err := d.db.WithContext(ctx).Preload("Game").
+		Where("id = ?", jobID).
+		Limit(1).Find(&jobs).Error
+	if err != nil {
+		return scheduler.FinishedJob{}, fmt.Errorf("get job: %w", err)
+	}
+	if len(jobs) == 0 {
+		return scheduler.FinishedJob{}, scheduler.ErrNoSuchJob
+	}
+	return jobs[0], nil
+}
+
+func (d *DB) ListFailedJobs(ctx context.Context, roomID string, offset, limit int) ([]scheduler.FinishedJob, error) {
+	var jobs []scheduler.FinishedJob
+	tx := d.db.WithContext(ctx).Where("status_kind IN ?", []roomkeeper.JobStatusKind{roomkeeper.JobAborted, roomkeeper.JobFailed})
+	if roomID != "" {
+		tx = tx.Where("room_id = ?", roomID)
+	}
+	if offset != 0 {
+		tx = tx.Offset(offset)
+	}
+	if limit != 0 {
+		tx = tx.Limit(limit)
+	}
+	err := tx.Order("id DESC").Find(&jobs).Error
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (d *DB) ListGames(ctx context.Context, filter scheduler.GameFilter) ([]scheduler.Game, error) {
+	tx := d.db.WithContext(ctx).Model(&scheduler.Game{})
+	if filter.ContestID != "" {
+		tx = tx.Where("contest_id = ?", filter.ContestID)
+	}
+	if !filter.Viewer.Admin {
+		// Unlisted contests are hidden unless the games are requested for the given contest.
+		hidden := []scheduler.ContestVisibility{scheduler.ContestPrivate}
+		if filter.ContestID == "" {
+			hidden = append(hidden, scheduler.ContestUnlisted)
+		}
+		visible := d.db.Model(&Contest{}).Select("id").Where("visibility NOT IN ?", hidden)
+		if filter.Viewer.UserID != "" {
+			visible = visible.Or("owner_id = ?", filter.Viewer.UserID)
+		}
+		tx = tx.Where("contest_id IN (?)", visible)
+	}
+	if filter.Engine != "" {
+		switch filter.EngineResult {
+		case scheduler.GameEngineAnyResult:
+			tx = tx.Where("(white = ? OR black = ?)", filter.Engine, filter.Engine)
+		case scheduler.GameEngineWin:
+			tx = tx.Where("((white = ? AND result = ?) OR (black = ? AND result = ?))",
+				filter.Engine, chess.StatusWhiteWins.String(), filter.Engine, chess.StatusBlackWins.String())
+		case scheduler.GameEngineDraw:
+			tx = tx.Where("(white = ? OR black = ?) AND result = ?",
+				filter.Engine, filter.Engine, chess.StatusDraw.String())
+		case scheduler.GameEngineLoss:
+			tx = tx.Where("((white = ? AND result = ?) OR (black = ? AND result = ?))",
+				filter.Engine, chess.StatusBlackWins.String(), filter.Engine, chess.StatusWhiteWins.String())
+		default:
+			panic("must not happen")
+		}
+	}
+	if r, ok := filter.Result.TryGet(); ok {
+		tx = tx.Where("result = ?", r.String())
+	}
+	if v, ok := filter.Verdict.TryGet(); ok {
+		tx = tx.Where("verdict = ?", v)
+	}
+	if filter.MinPlies != 0 {
+		tx = tx.Where("plies >= ?", filter.MinPlies)
+	}
+	if filter.MaxPlies != 0 {
+		tx = tx.Where("plies <= ?", filter.MaxPlies)
+	}
+	if filter.Offset != 0 {
+		tx = tx.Offset(filter.Offset)
+	}
+	if filter.Limit != 0 {
+		tx = tx.Limit(filter.Limit)
+	}
+	var games []scheduler.Game
+	err := tx.Order("finished_at DESC, job_id DESC").Find(&games).Error
+	if err != nil {
+		return nil, fmt.Errorf("list games: %w", err)
+	}
+	return games, nil
+}
+
+func (d *DB) ListContestsToArchive(ctx context.Context, finishedBefore timeutil.UTCTime) ([]scheduler.ContestFullData, error) {
+	var contests []Contest
+	err := d.db.WithContext(ctx).Preload("Match").Preload("Swiss").Preload("Knockout").
+		Where("status_kind <> ? AND archived_at IS NULL AND finished_at < ?", scheduler.ContestRunning, finishedBefore).
+		Find(&contests).Error
+	if err != nil {
+		return nil, fmt.Errorf("list contests to archive: %w", err)
+	}
+	return sliceutil.Map(contests, d.buildContestFullData), nil
+}
+
+func (d *DB) ArchiveContest(ctx context.Context, contestID string, now timeutil.UTCTime, o archiver.ArchiveOptions) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if o.PruneFailedJobs {
+			err := tx.Where("contest_id = ? AND status_kind <> ?", contestID, roomkeeper.JobSucceeded).
+				Delete(&scheduler.FinishedJob{}).Error
+			if err != nil {
+				return fmt.Errorf("prune failed jobs: %w", err)
+			}
+		}
+		if o.PrunePGN {
+			err := tx.Model(&scheduler.FinishedJob{}).Where("contest_id = ?", contestID).
+				Update("pgn", nil).Error
+			if err != nil {
+				return fmt.Errorf("prune pgn: %w", err)
+			}
+		}
+		upd := map[string]any{"archived_at": now}
+		if o.PrunePGN {
+			upd["pgn_pruned"] = true
+		}
+		err := tx.Model(&Contest{}).Where("id = ?", contestID).Updates(upd).Error
+		if err != nil {
+			return fmt.Errorf("mark contest archived: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListContestsToRate returns the finished contests which are not rated yet. Only public contests are
+// rated, as the ratings are shown to everyone.
+func (d *DB) ListContestsToRate(ctx context.Context) ([]scheduler.ContestFullData, error) {
+	var contests []Contest
+	err := d.db.WithContext(ctx).Preload("Match").Preload("Swiss").Preload("Knockout").
+		Where("status_kind <> ? AND visibility = ? AND id NOT IN (?)", scheduler.ContestRunning, scheduler.ContestPublic,
+			d.db.Model(&rater.RatedContest{}).Select("contest_id")).
+		Order("finished_at").
+		Find(&contests).Error
+	if err != nil {
+		return nil, fmt.Errorf("list contests to rate: %w", err)
+	}
+	return sliceutil.Map(contests, d.buildContestFullData), nil
+}
+
+func (d *DB) AddRatedContest(ctx context.Context, contestID string, results []rater.PairResult, now timeutil.UTCTime) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&rater.RatedContest{ContestID: contestID, RatedAt: now}).Error
+		if err != nil {
+			return fmt.Errorf("mark contest rated: %w", err)
+		}
+		for _, r := range results {
+			err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "first"}, {Name: "second"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"win":  gorm.Expr("win + ?", r.Win),
+					"draw": gorm.Expr("draw + ?", r.Draw),
+					"lose": gorm.Expr("lose + ?", r.Lose),
+				}),
+			}).Create(&r).Error
+			if err != nil {
+				return fmt.Errorf("update pair results: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (d *DB) ListPairResults(ctx context.Context) ([]rater.PairResult, error) {
+	var results []rater.PairResult
+	if err := d.db.WithContext(ctx).Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("list pair results: %w", err)
+	}
+	return results, nil
+}
+
+func (d *DB) ReplaceRatings(ctx context.Context, ratings []rater.Rating) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&rater.Rating{}).Error; err != nil {
+			return fmt.Errorf("delete ratings: %w", err)
+		}
+		if len(ratings) == 0 {
+			return nil
+		}
+		if err := tx.Create(&ratings).Error; err != nil {
+			return fmt.Errorf("create ratings: %w", err)
+		}
+		return nil
+	})
+}
+
+func (d *DB) ListRatings(ctx context.Context) ([]rater.Rating, error) {
+	var ratings []rater.Rating
+	if err := d.db.WithContext(ctx).Order("elo DESC, engine").Find(&ratings).Error; err != nil {
+		return nil, fmt.Errorf("list ratings: %w", err)
+	}
+	return ratings, nil
+}
+
+func (d *DB) CreateNotifyTarget(ctx context.Context, target notify.Target) error {
+	if err := d.db.WithContext(ctx).Create(&target).Error; err != nil {
+		return fmt.Errorf("create notify target: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) DeleteNotifyTarget(ctx context.Context, targetID string) error {
+	err := d.db.WithContext(ctx).Delete(&notify.Target{ID: targetID}).Error
+	if err != nil {
+		return fmt.Errorf("delete notify target: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetNotifyTarget(ctx context.Context, targetID string) (notify.Target, error) {
+	var targets []notify.Target
+	err := d.db.WithContext(ctx).Where("id = ?", targetID).Limit(1).Find(&targets).Error
+	if err != nil {
+		return notify.Target{}, fmt.Errorf("get notify target: %w", err)
+	}
+	if len(targets) == 0 {
+		return notify.Target{}, notify.ErrNoSuchTarget
+	}
+	return targets[0], nil
+}
+
+func (d *DB) ListContestNotifyTargets(ctx context.Context, contestID string) ([]notify.Target, error) {
+	var targets []notify.Target
+	err := d.db.WithContext(ctx).Where("contest_id = ?", contestID).Order("created_at").Find(&targets).Error
+	if err != nil {
+		return nil, fmt.Errorf("list notify targets: %w", err)
+	}
+	return targets, nil
+}
+
+func (d *DB) ListUserNotifyTargets(ctx context.Context, userID string) ([]notify.Target, error) {
+	var targets []notify.Target
+	err := d.db.WithContext(ctx).Where("user_id = ? AND contest_id IS NULL", userID).
+		Order("created_at").Find(&targets).Error
+	if err != nil {
+		return nil, fmt.Errorf("list notify targets: %w", err)
+	}
+	return targets, nil
+}
+
+func (d *DB) ListGlobalNotifyTargets(ctx context.Context) ([]notify.Target, error) {
+	var targets []notify.Target
+	err := d.db.WithContext(ctx).Where("contest_id IS NULL").Order("created_at").Find(&targets).Error
+	if err != nil {
+		return nil, fmt.Errorf("list notify targets: %w", err)
+	}
+	return targets, nil
+}
+
+func (d *DB) SetLichessToken(ctx context.Context, token broadcast.LichessToken) error {
+	err := d.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&token).Error
+	if err != nil {
+		return fmt.Errorf("set lichess token: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) DeleteLichessToken(ctx context.Context, userID string) error {
+	err := d.db.WithContext(ctx).Delete(&broadcast.LichessToken{UserID: userID}).Error
+	if err != nil {
+		return fmt.Errorf("delete lichess token: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetLichessToken(ctx context.Context, userID string) (broadcast.LichessToken, error) {
+	var tokens []broadcast.LichessToken
+	err := d.db.WithContext(ctx).Where("user_id = ?", userID).Limit(1).Find(&tokens).Error
+	if err != nil {
+		return broadcast.LichessToken{}, fmt.Errorf("get lichess token: %w", err)
+	}
+	if len(tokens) == 0 {
+		return broadcast.LichessToken{}, broadcast.ErrNoToken
+	}
+	return tokens[0], nil
+}
+
+func (d *DB) SetBroadcast(ctx context.Context, b broadcast.Broadcast) error {
+	err := d.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&b).Error
+	if err != nil {
+		return fmt.Errorf("set broadcast: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) DeleteBroadcast(ctx context.Context, contestID string) error {
+	err := d.db.WithContext(ctx).Delete(&broadcast.Broadcast{ContestID: contestID}).Error
+	if err != nil {
+		return fmt.Errorf("delete broadcast: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetBroadcast(ctx context.Context, contestID string) (broadcast.Broadcast, error) {
+	var bs []broadcast.Broadcast
+	err := d.db.WithContext(ctx).Where("contest_id = ?", contestID).Limit(1).Find(&bs).Error
+	if err != nil {
+		return broadcast.Broadcast{}, fmt.Errorf("get broadcast: %w", err)
+	}
+	if len(bs) == 0 {
+		return broadcast.Broadcast{}, broadcast.ErrNoBroadcast
+	}
+	return bs[0], nil
+}
+
+func (d *DB) CreateEvent(ctx context.Context, event scheduler.Event) error {
+	if err := d.db.WithContext(ctx).Create(&event).Error; err != nil {
+		return fmt.Errorf("create event: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetEvent(ctx context.Context, eventID string) (scheduler.Event, error) {
+	var events []scheduler.Event
+	err := d.db.WithContext(ctx).Where("id = ?", eventID).Limit(1).Find(&events).Error
+	if err != nil {
+		return scheduler.Event{}, fmt.Errorf("get event: %w", err)
+	}
+	if len(events) == 0 {
+		return scheduler.Event{}, scheduler.ErrNoSuchEvent
+	}
+	return events[0], nil
+}
+
+func (d *DB) ListEvents(ctx context.Context) ([]scheduler.Event, error) {
+	var events []scheduler.Event
+	if err := d.db.WithContext(ctx).Order("created_at DESC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("list events: %w", err)
+	}
+	return events, nil
+}
+
+func (d *DB) ListEventContests(ctx context.Context, eventID string) ([]scheduler.ContestFullData, error) {
+	var contests []Contest
+	err := d.db.WithContext(ctx).Preload("Match").Preload("Swiss").Preload("Knockout").Where("event_id = ?", eventID).Order("id").Find(&contests).Error
+	if err != nil {
+		return nil, fmt.Errorf("list event contests: %w", err)
+	}
+	return sliceutil.Map(contests, d.buildContestFullData), nil
+}
+
+func (d *DB) ListGroupContests(ctx context.Context, groupID string) ([]scheduler.ContestFullData, error) {
+	var contests []Contest
+	err := d.db.WithContext(ctx).Preload("Match").Preload("Swiss").Preload("Knockout").Where("group_id = ?", groupID).Order("id").Find(&contests).Error
+	if err != nil {
+		return nil, fmt.Errorf("list group contests: %w", err)
+	}
+	return sliceutil.Map(contests, d.buildContestFullData), nil
+}
+
+func (d *DB) CreateStoredBook(ctx context.Context, book scheduler.StoredBook) error {
+	if err := d.db.WithContext(ctx).Create(&book).Error; err != nil {
+		return fmt.Errorf("create book: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetStoredBook(ctx context.Context, bookID string) (scheduler.StoredBook, error) {
+	var books []scheduler.StoredBook
+	err := d.db.WithContext(ctx).Where("id = ?", bookID).Limit(1).Find(&books).Error
+	if err != nil {
+		return scheduler.StoredBook{}, fmt.Errorf("get book: %w", err)
+	}
+	if len(books) == 0 {
+		return scheduler.StoredBook{}, scheduler.ErrNoSuchBook
+	}
+	return books[0], nil
+}
+
+func (d *DB) ListStoredBooks(ctx context.Context) ([]scheduler.StoredBook, error) {
+	var books []scheduler.StoredBook
+	err := d.db.WithContext(ctx).Omit("data").Order("created_at DESC").Find(&books).Error
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+	return books, nil
+}
+
+func (d *DB) CreateContestPreset(ctx context.Context, preset scheduler.ContestPreset) error {
+	if err := d.db.WithContext(ctx).Create(&preset).Error; err != nil {
+		return fmt.Errorf("create preset: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetContestPreset(ctx context.Context, presetID string) (scheduler.ContestPreset, error) {
+	var presets []scheduler.ContestPreset
+	err := d.db.WithContext(ctx).Where("id = ?", presetID).Limit(1).Find(&presets).Error
+	if err != nil {
+		return scheduler.ContestPreset{}, fmt.Errorf("get preset: %w", err)
+	}
+	if len(presets) == 0 {
+		return scheduler.ContestPreset{}, scheduler.ErrNoSuchPreset
+	}
+	return presets[0], nil
+}
+
+func (d *DB) ListContestPresets(ctx context.Context) ([]scheduler.ContestPreset, error) {
+	var presets []scheduler.ContestPreset
+	err := d.db.WithContext(ctx).Order("name").Find(&presets).Error
+	if err != nil {
+		return nil, fmt.Errorf("list presets: %w", err)
+	}
+	return presets, nil
+}
+
+func (d *DB) DeleteContestPreset(ctx context.Context, presetID string) error {
+	res := d.db.WithContext(ctx).Delete(&scheduler.ContestPreset{ID: presetID})
+	if err := res.Error; err != nil {
+		return fmt.Errorf("delete preset: %w", err)
+	}
+	if res.RowsAffected == 0 {
+		return scheduler.ErrNoSuchPreset
+	}
+	return nil
+}
+
+func (d *DB) CreateComment(ctx context.Context, comment discuss.Comment) error {
+	if err := d.db.WithContext(ctx).Create(&comment).Error; err != nil {
+		return fmt.Errorf("create comment: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetComment(ctx context.Context, commentID string) (discuss.Comment, error) {
+	var comments []discuss.Comment
+	err := d.db.WithContext(ctx).Where("id = ?", commentID).Limit(1).Find(&comments).Error
+	if err != nil {
+		return discuss.Comment{}, fmt.Errorf("get comment: %w", err)
+	}
+	if len(comments) == 0 {
+		return discuss.Comment{}, discuss.ErrNoSuchComment
+	}
+	return comments[0], nil
+}
+
+func (d *DB) UpdateComment(ctx context.Context, comment discuss.Comment) error {
+	if err := d.db.WithContext(ctx).Select("*").Updates(&comment).Error; err != nil {
+		return fmt.Errorf("update comment: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) DeleteComment(ctx context.Context, commentID string) error {
+	err := d.db.WithContext(ctx).Delete(&discuss.Comment{ID: commentID}).Error
+	if err != nil {
+		return fmt.Errorf("delete comment: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) ListContestComments(ctx context.Context, contestID string) ([]discuss.Comment, error) {
+	var comments []discuss.Comment
+	err := d.db.WithContext(ctx).Where("contest_id = ?", contestID).Order("created_at").Find(&comments).Error
+	if err != nil {
+		return nil, fmt.Errorf("list comments: %w", err)
+	}
+	return comments, nil
+}
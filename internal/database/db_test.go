@@ -0,0 +1,288 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T, path string) *DB {
+	t.Helper()
+	d, err := New(slogx.DiscardLogger(), Options{Path: path})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(d.Close)
+	return d
+}
+
+func testPlayers(n int) []roomapi.JobEngine {
+	players := make([]roomapi.JobEngine, n)
+	for i := range players {
+		players[i] = roomapi.JobEngine{Name: fmt.Sprintf("engine%v", i)}
+	}
+	return players
+}
+
+func testContestInfo(id string, kind scheduler.ContestKind) scheduler.ContestInfo {
+	info := scheduler.ContestInfo{
+		ID: id,
+		ContestSettings: scheduler.ContestSettings{
+			Name: id,
+			Kind: kind,
+		},
+	}
+	switch kind {
+	case scheduler.ContestMatch:
+		info.Players = testPlayers(2)
+		info.Match = &scheduler.MatchSettings{Games: 2}
+	case scheduler.ContestSwiss:
+		info.Players = testPlayers(4)
+		info.Swiss = &scheduler.SwissSettings{Rounds: 3}
+	case scheduler.ContestKnockout:
+		info.Players = testPlayers(4)
+		info.Knockout = &scheduler.KnockoutSettings{GamesPerTie: 2}
+	}
+	return info
+}
+
+func createTestContests(t *testing.T, d *DB) {
+	t.Helper()
+	for _, kind := range []scheduler.ContestKind{scheduler.ContestMatch, scheduler.ContestSwiss, scheduler.ContestKnockout} {
+		id := fmt.Sprintf("contest-%v", kind)
+		info := testContestInfo(id, kind)
+		if err := d.CreateContest(context.Background(), info, info.NewData()); err != nil {
+			t.Fatalf("create contest %v: %v", id, err)
+		}
+		gotInfo, _, err := d.GetContest(context.Background(), id)
+		if err != nil {
+			t.Fatalf("get contest %v: %v", id, err)
+		}
+		if gotInfo.Kind != kind {
+			t.Fatalf("bad kind: expected = %v, got = %v", kind, gotInfo.Kind)
+		}
+	}
+}
+
+func TestCreateContestKinds(t *testing.T) {
+	d := newTestDB(t, filepath.Join(t.TempDir(), "day20.db"))
+	createTestContests(t, d)
+}
+
+func TestDropContestKindConstraints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "day20.db")
+	d, err := New(slogx.DiscardLogger(), Options{Path: path})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	d.Close()
+
+	// Older versions created the foreign key from contests to matches.
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open raw db: %v", err)
+	}
+	var ddl string
+	if err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'contests'").Scan(&ddl).Error; err != nil {
+		t.Fatalf("get ddl: %v", err)
+	}
+	ddl = strings.TrimSuffix(strings.TrimSpace(ddl), ")") +
+		",CONSTRAINT `fk_contests_match` FOREIGN KEY (`id`) REFERENCES `matches`(`contest_id`))"
+	if err := db.Exec("DROP TABLE `contests`").Error; err != nil {
+		t.Fatalf("drop table: %v", err)
+	}
+	if err := db.Exec(ddl).Error; err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	if !db.Migrator().HasConstraint(&Contest{}, "fk_contests_match") {
+		t.Fatalf("legacy constraint not created")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("get raw db: %v", err)
+	}
+	_ = sqlDB.Close()
+
+	d = newTestDB(t, path)
+	if d.db.Migrator().HasConstraint(&Contest{}, "fk_contests_match") {
+		t.Fatalf("legacy constraint not dropped")
+	}
+	createTestContests(t, d)
+}
+
+func createFinishedContest(t *testing.T, d *DB, id string, status scheduler.ContestStatus, finishedAt, archivedAt *timeutil.UTCTime) {
+	t.Helper()
+	info := testContestInfo(id, scheduler.ContestMatch)
+	data := info.NewData()
+	data.Status = status
+	data.FinishedAt = finishedAt
+	data.ArchivedAt = archivedAt
+	if err := d.CreateContest(context.Background(), info, data); err != nil {
+		t.Fatalf("create contest %v: %v", id, err)
+	}
+}
+
+func contestIDs(contests []scheduler.ContestFullData) []string {
+	ids := make([]string, len(contests))
+	for i, c := range contests {
+		ids[i] = c.Info.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestListContestsToArchive(t *testing.T) {
+	d := newTestDB(t, filepath.Join(t.TempDir(), "day20.db"))
+	ctx := context.Background()
+	now := timeutil.NowUTC()
+	old := now.Add(-48 * time.Hour)
+	recent := now.Add(-1 * time.Hour)
+
+	createFinishedContest(t, d, "running", scheduler.NewStatusRunning(), nil, nil)
+	createFinishedContest(t, d, "old", scheduler.NewStatusSucceeded(), &old, nil)
+	createFinishedContest(t, d, "old-aborted", scheduler.NewStatusAborted("test"), &old, nil)
+	createFinishedContest(t, d, "recent", scheduler.NewStatusSucceeded(), &recent, nil)
+	createFinishedContest(t, d, "archived", scheduler.NewStatusSucceeded(), &old, &old)
+
+	contests, err := d.ListContestsToArchive(ctx, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("list contests: %v", err)
+	}
+	expected := []string{"old", "old-aborted"}
+	if got := contestIDs(contests); !slices.Equal(got, expected) {
+		t.Fatalf("bad contests: expected = %v, got = %v", expected, got)
+	}
+}
+
+func TestBackfillContestFinishedAt(t *testing.T) {
+	d := newTestDB(t, filepath.Join(t.TempDir(), "day20.db"))
+	ctx := context.Background()
+
+	// Contests which finished before finished_at was recorded have it unset.
+	createFinishedContest(t, d, "legacy", scheduler.NewStatusSucceeded(), nil, nil)
+	createFinishedContest(t, d, "running", scheduler.NewStatusRunning(), nil, nil)
+	if err := d.backfill(); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+
+	_, data, err := d.GetContest(ctx, "legacy")
+	if err != nil {
+		t.Fatalf("get contest: %v", err)
+	}
+	if data.FinishedAt == nil {
+		t.Fatalf("finished_at not backfilled")
+	}
+	_, data, err = d.GetContest(ctx, "running")
+	if err != nil {
+		t.Fatalf("get contest: %v", err)
+	}
+	if data.FinishedAt != nil {
+		t.Fatalf("finished_at backfilled for running contest")
+	}
+
+	contests, err := d.ListContestsToArchive(ctx, timeutil.NowUTC().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("list contests: %v", err)
+	}
+	expected := []string{"legacy"}
+	if got := contestIDs(contests); !slices.Equal(got, expected) {
+		t.Fatalf("bad contests: expected = %v, got = %v", expected, got)
+	}
+}
+
+func TestBackfillGames(t *testing.T) {
+	d := newTestDB(t, filepath.Join(t.TempDir(), "day20.db"))
+	ctx := context.Background()
+	createFinishedContest(t, d, "contest", scheduler.NewStatusSucceeded(), nil, nil)
+
+	pgn := "[White \"engine0\"]\n[Black \"engine1\"]\n[Result \"1-0\"]\n\n" +
+		"1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 a6 6. Be3 e5 1-0\n"
+	job := scheduler.FinishedJob{
+		JobInfo: scheduler.JobInfo{
+			Job:       roomapi.Job{ID: "job", White: roomapi.JobEngine{Name: "engine0"}, Black: roomapi.JobEngine{Name: "engine1"}},
+			ContestID: "contest",
+		},
+		Status: roomkeeper.NewStatusSucceeded(),
+		PGN:    &pgn,
+	}
+	if err := d.db.Create(&job).Error; err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	// Pretend that the database comes from the version which didn't record games.
+	if err := d.db.Where("name = ?", "games").Delete(&Backfill{}).Error; err != nil {
+		t.Fatalf("delete backfill: %v", err)
+	}
+	if err := d.backfill(); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+
+	games, err := d.ListGames(ctx, scheduler.GameFilter{ContestID: "contest", Viewer: scheduler.Viewer{Admin: true}})
+	if err != nil {
+		t.Fatalf("list games: %v", err)
+	}
+	if len(games) != 1 {
+		t.Fatalf("bad number of games: expected = 1, got = %v", len(games))
+	}
+	if games[0].ECO != "B90" || games[0].Plies != 12 || games[0].White != "engine0" {
+		t.Fatalf("bad game: %+v", games[0])
+	}
+
+	// The backfill runs only once.
+	if err := d.db.Where("job_id = ?", "job").Delete(&scheduler.Game{}).Error; err != nil {
+		t.Fatalf("delete game: %v", err)
+	}
+	if err := d.backfill(); err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	var count int64
+	if err := d.db.Model(&scheduler.Game{}).Count(&count).Error; err != nil {
+		t.Fatalf("count games: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("backfill run twice")
+	}
+}
+
+func TestListContestsToRate(t *testing.T) {
+	d := newTestDB(t, filepath.Join(t.TempDir(), "day20.db"))
+	ctx := context.Background()
+	for _, c := range []struct {
+		id         string
+		visibility scheduler.ContestVisibility
+		status     scheduler.ContestStatus
+	}{
+		{"public", scheduler.ContestPublic, scheduler.NewStatusSucceeded()},
+		{"public-running", scheduler.ContestPublic, scheduler.NewStatusRunning()},
+		{"unlisted", scheduler.ContestUnlisted, scheduler.NewStatusSucceeded()},
+		{"private", scheduler.ContestPrivate, scheduler.NewStatusSucceeded()},
+	} {
+		info := testContestInfo(c.id, scheduler.ContestMatch)
+		info.Visibility = c.visibility
+		data := info.NewData()
+		data.Status = c.status
+		if err := d.CreateContest(ctx, info, data); err != nil {
+			t.Fatalf("create contest %v: %v", c.id, err)
+		}
+	}
+
+	contests, err := d.ListContestsToRate(ctx)
+	if err != nil {
+		t.Fatalf("list contests: %v", err)
+	}
+	expected := []string{"public"}
+	if got := contestIDs(contests); !slices.Equal(got, expected) {
+		t.Fatalf("bad contests: expected = %v, got = %v", expected, got)
+	}
+}
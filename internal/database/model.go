@@ -1,15 +1,23 @@
 package database
 
 import (
+	"github.com/alex65536/day20/internal/broadcast"
+	"github.com/alex65536/day20/internal/delta"
+	"github.com/alex65536/day20/internal/discuss"
+	"github.com/alex65536/day20/internal/notify"
+	"github.com/alex65536/day20/internal/rater"
 	"github.com/alex65536/day20/internal/roomkeeper"
 	"github.com/alex65536/day20/internal/scheduler"
 	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/timeutil"
 )
 
 type Room struct {
-	Info  roomkeeper.RoomInfo `gorm:"embedded"`
-	JobID *string
+	Info  roomkeeper.RoomInfo   `gorm:"embedded"`
+	JobID *string               `gorm:"index"`
 	Job   *scheduler.RunningJob `gorm:"foreignKey:JobID"`
+	// State is the snapshot of the running job state.
+	State *delta.JobState `gorm:"serializer:json"`
 }
 
 type Contest struct {
@@ -17,7 +25,11 @@ type Contest struct {
 	Data         scheduler.ContestData   `gorm:"embedded"`
 	RunningJobs  []scheduler.RunningJob  `gorm:"foreignKey:ContestID"`
 	FinishedJobs []scheduler.FinishedJob `gorm:"foreignKey:ContestID"`
-	Match        *Match                  `gorm:"foreignKey:ID;references:ContestID"`
+	// Only one of Match, Swiss and Knockout is present, so the relations must not create foreign keys
+	// on contests, otherwise a contest of one kind would require the rows of all the other kinds.
+	Match    *Match    `gorm:"foreignKey:ID;references:ContestID;constraint:-"`
+	Swiss    *Swiss    `gorm:"foreignKey:ID;references:ContestID;constraint:-"`
+	Knockout *Knockout `gorm:"foreignKey:ID;references:ContestID;constraint:-"`
 }
 
 type Match struct {
@@ -26,6 +38,24 @@ type Match struct {
 	Data      scheduler.MatchData     `gorm:"embedded"`
 }
 
+type Swiss struct {
+	ContestID string                  `gorm:"primaryKey"`
+	Settings  scheduler.SwissSettings `gorm:"embedded"`
+	Data      scheduler.SwissData     `gorm:"embedded"`
+}
+
+type Knockout struct {
+	ContestID string                     `gorm:"primaryKey"`
+	Settings  scheduler.KnockoutSettings `gorm:"embedded"`
+	Data      scheduler.KnockoutData     `gorm:"embedded"`
+}
+
+// Backfill records a one-off backfill step which has already been applied.
+type Backfill struct {
+	Name      string `gorm:"primaryKey"`
+	AppliedAt timeutil.UTCTime
+}
+
 type FinishedJobData struct {
 	Status roomkeeper.JobStatus `gorm:"embedded;embeddedPrefix:status_"`
 	PGN    *string
@@ -35,9 +65,58 @@ var models = []any{
 	&Room{},
 	&Contest{},
 	&Match{},
+	&Swiss{},
+	&Knockout{},
 	&scheduler.RunningJob{},
 	&scheduler.FinishedJob{},
+	&scheduler.Game{},
+	&scheduler.Event{},
+	&scheduler.StoredBook{},
+	&scheduler.ContestPreset{},
+	&rater.PairResult{},
+	&rater.RatedContest{},
+	&rater.Rating{},
+	&notify.Target{},
+	&broadcast.LichessToken{},
+	&broadcast.Broadcast{},
+	&discuss.Comment{},
 	&userauth.User{},
 	&userauth.InviteLink{},
 	&userauth.RoomToken{},
+	&userauth.APIToken{},
+	&userauth.EmailToken{},
+	&userauth.Session{},
+	&userauth.ExternalAccount{},
+	&Backfill{},
+}
+
+// compositeIndex is an index over several columns. Such indexes cannot be declared via gorm tags on
+// the models shared between the tables, so they are created separately after the migration.
+type compositeIndex struct {
+	Name    string
+	Table   string
+	Columns []string
+}
+
+var compositeIndexes = []compositeIndex{
+	{
+		Name:    "idx_finished_jobs_contest_status_index",
+		Table:   "finished_jobs",
+		Columns: []string{"contest_id", "status_kind", "index"},
+	},
+	{
+		Name:    "idx_finished_jobs_contest_id_id",
+		Table:   "finished_jobs",
+		Columns: []string{"contest_id", "id"},
+	},
+	{
+		Name:    "idx_games_finished_at_job_id",
+		Table:   "games",
+		Columns: []string{"finished_at", "job_id"},
+	},
+	{
+		Name:    "idx_sessions_user_id_last_seen_at",
+		Table:   "sessions",
+		Columns: []string{"user_id", "last_seen_at"},
+	},
 }
@@ -20,6 +20,8 @@ type Info struct {
 	TimeControl maybe.Maybe[clock.Control] `json:"time_control"`
 	FixedTime   maybe.Maybe[time.Duration] `json:"fixed_time"`
 	StartTime   time.Time                  `json:"start_time"`
+	WhiteEngine string                     `json:"white_engine,omitempty"`
+	BlackEngine string                     `json:"black_engine,omitempty"`
 }
 
 func (i *Info) PlayerInfo(col chess.Color) string {
@@ -54,10 +56,44 @@ func (p *Position) Clone() *Position {
 	return &res
 }
 
+var pieceValues = [...]struct {
+	piece chess.Piece
+	value int
+}{
+	{chess.PiecePawn, 1},
+	{chess.PieceKnight, 3},
+	{chess.PieceBishop, 3},
+	{chess.PieceRook, 5},
+	{chess.PieceQueen, 9},
+}
+
+// Material returns the material balance in pawns. It is positive if White has more material.
+func (p *Position) Material() int {
+	if p == nil || p.Board == nil {
+		return 0
+	}
+	res := 0
+	for _, pv := range pieceValues {
+		res += pv.value * p.Board.BbPiece(chess.ColorWhite, pv.piece).Len()
+		res -= pv.value * p.Board.BbPiece(chess.ColorBlack, pv.piece).Len()
+	}
+	return res
+}
+
+// MoveNumber returns the full-move number of the current position.
+func (p *Position) MoveNumber() int {
+	if p == nil || p.Board == nil {
+		return 0
+	}
+	return int(p.Board.MoveNumber())
+}
+
 type Moves struct {
-	Moves   []chess.UCIMove          `json:"moves"`
-	Scores  []maybe.Maybe[uci.Score] `json:"scores"`
-	Version int64                    `json:"v"`
+	Moves   []chess.UCIMove              `json:"moves"`
+	Scores  []maybe.Maybe[uci.Score]     `json:"scores"`
+	Times   []maybe.Maybe[time.Duration] `json:"times,omitempty"`
+	Clocks  []maybe.Maybe[time.Duration] `json:"clocks,omitempty"`
+	Version int64                        `json:"v"`
 }
 
 func (m *Moves) Clone() *Moves {
@@ -67,6 +103,8 @@ func (m *Moves) Clone() *Moves {
 	res := *m
 	res.Moves = slices.Clone(res.Moves)
 	res.Scores = slices.Clone(res.Scores)
+	res.Times = slices.Clone(res.Times)
+	res.Clocks = slices.Clone(res.Clocks)
 	return &res
 }
 
@@ -80,6 +118,8 @@ func (m *Moves) Delta(old int64) *Moves {
 	return &Moves{
 		Moves:   slices.Clone(m.Moves[old:m.Version]),
 		Scores:  slices.Clone(m.Scores[old:m.Version]),
+		Times:   slices.Clone(m.Times[old:m.Version]),
+		Clocks:  slices.Clone(m.Clocks[old:m.Version]),
 		Version: m.Version,
 	}
 }
@@ -91,12 +131,30 @@ func (m *Moves) ApplyDelta(d *Moves) error {
 	if m.Version+int64(len(d.Moves)) != d.Version || m.Version+int64(len(d.Scores)) != d.Version {
 		return fmt.Errorf("bad delta length")
 	}
+	if (len(d.Times) != 0 && len(d.Times) != len(d.Moves)) ||
+		(len(d.Clocks) != 0 && len(d.Clocks) != len(d.Moves)) {
+		return fmt.Errorf("bad delta times length")
+	}
 	m.Moves = append(m.Moves, d.Moves...)
 	m.Scores = append(m.Scores, d.Scores...)
+	m.Times = appendDurations(m.Times, d.Times, len(d.Moves))
+	m.Clocks = appendDurations(m.Clocks, d.Clocks, len(d.Moves))
 	m.Version = d.Version
 	return nil
 }
 
+// appendDurations appends per-move durations from the delta. Older clients don't send them, so
+// they are filled with empty values in this case.
+func appendDurations(dst, src []maybe.Maybe[time.Duration], n int) []maybe.Maybe[time.Duration] {
+	if len(src) == 0 {
+		for range n {
+			dst = append(dst, maybe.None[time.Duration]())
+		}
+		return dst
+	}
+	return append(dst, src...)
+}
+
 type Warnings struct {
 	Warn    []string `json:"warn"`
 	Version int64    `json:"v"`
@@ -136,6 +194,18 @@ func (w *Warnings) ApplyDelta(d *Warnings) error {
 	return nil
 }
 
+// PVLine is one of the lines reported by the engine in MultiPV mode.
+type PVLine struct {
+	Score maybe.Maybe[uci.Score] `json:"score"`
+	PV    []chess.UCIMove        `json:"pv"`
+	PVS   string                 `json:"pvs"`
+}
+
+func (l PVLine) Clone() PVLine {
+	l.PV = slices.Clone(l.PV)
+	return l
+}
+
 type Player struct {
 	Active   bool                       `json:"active"`
 	Clock    maybe.Maybe[time.Duration] `json:"clock"`
@@ -143,10 +213,17 @@ type Player struct {
 	Score    maybe.Maybe[uci.Score]     `json:"score"`
 	PV       []chess.UCIMove            `json:"pv"`
 	PVS      string                     `json:"pvs"`
+	Lines    []PVLine                   `json:"lines,omitempty"`
 	Depth    int64                      `json:"depth"`
+	SelDepth int64                      `json:"seldepth"`
 	Nodes    int64                      `json:"nodes"`
 	NPS      int64                      `json:"nps"`
-	Version  int64                      `json:"v"`
+	HashFull maybe.Maybe[float64]       `json:"hashfull"`
+	TBHits   int64                      `json:"tbhits"`
+	CurMove  string                     `json:"curmove"`
+	// CurMoveNumber is the index (starting from 1) of CurMove among the moves searched by the engine.
+	CurMoveNumber int64 `json:"curmovenumber"`
+	Version       int64 `json:"v"`
 }
 
 func (p *Player) ClockFrom(nowTs Timestamp) maybe.Maybe[time.Duration] {
@@ -162,6 +239,12 @@ func (p *Player) Clone() *Player {
 	}
 	res := *p
 	res.PV = slices.Clone(res.PV)
+	if res.Lines != nil {
+		res.Lines = make([]PVLine, len(p.Lines))
+		for i, l := range p.Lines {
+			res.Lines[i] = l.Clone()
+		}
+	}
 	return &res
 }
 
@@ -382,6 +465,8 @@ func (s *JobState) GameExt() (*battle.GameExt, error) {
 	return &battle.GameExt{
 		Game:        game,
 		Scores:      slices.Clone(s.Moves.Scores),
+		Times:       slices.Clone(s.Moves.Times),
+		Clocks:      slices.Clone(s.Moves.Clocks),
 		WhiteName:   s.Info.WhiteName,
 		BlackName:   s.Info.BlackName,
 		Round:       0,
@@ -389,17 +474,27 @@ func (s *JobState) GameExt() (*battle.GameExt, error) {
 		FixedTime:   s.Info.FixedTime,
 		StartTime:   s.Info.StartTime,
 		Event:       "",
+		WhiteEngine: s.Info.WhiteEngine,
+		BlackEngine: s.Info.BlackEngine,
 	}, nil
 }
 
 type RoomCursor struct {
-	JobID string    `json:"job_id"`
-	State JobCursor `json:"s"`
+	JobID      string    `json:"job_id"`
+	State      JobCursor `json:"s"`
+	Spectators int64     `json:"spectators"`
+	LastJobID  string    `json:"last_job_id,omitempty"`
 }
 
 type RoomState struct {
 	JobID string    `json:"job_id"`
 	State *JobState `json:"s"`
+	// Spectators is the number of clients currently watching the room. It is not versioned and is
+	// always sent in full.
+	Spectators int64 `json:"spectators"`
+	// LastJobID is the ID of the job which was finished most recently in this room. The finished
+	// game can be viewed by this ID after the room state is reset. It is not versioned either.
+	LastJobID string `json:"last_job_id,omitempty"`
 }
 
 func NewRoomState() *RoomState {
@@ -414,8 +509,10 @@ func (s *RoomState) Cursor() RoomCursor {
 		state = s.State.Cursor()
 	}
 	return RoomCursor{
-		JobID: s.JobID,
-		State: state,
+		JobID:      s.JobID,
+		State:      state,
+		Spectators: s.Spectators,
+		LastJobID:  s.LastJobID,
 	}
 }
 
@@ -424,8 +521,10 @@ func (s *RoomState) Clone() *RoomState {
 		return nil
 	}
 	return &RoomState{
-		JobID: s.JobID,
-		State: s.State.Clone(),
+		JobID:      s.JobID,
+		State:      s.State.Clone(),
+		Spectators: s.Spectators,
+		LastJobID:  s.LastJobID,
 	}
 }
 
@@ -461,14 +560,18 @@ func (s *RoomState) Delta(old RoomCursor) (*RoomState, error) {
 	}
 	if s.JobID != old.JobID {
 		return &RoomState{
-			JobID: s.JobID,
-			State: s.State.Clone(),
+			JobID:      s.JobID,
+			State:      s.State.Clone(),
+			Spectators: s.Spectators,
+			LastJobID:  s.LastJobID,
 		}, nil
 	}
 	if s.State == nil {
 		return &RoomState{
-			JobID: s.JobID,
-			State: nil,
+			JobID:      s.JobID,
+			State:      nil,
+			Spectators: s.Spectators,
+			LastJobID:  s.LastJobID,
 		}, nil
 	}
 	d, err := s.State.Delta(old.State)
@@ -476,8 +579,10 @@ func (s *RoomState) Delta(old RoomCursor) (*RoomState, error) {
 		return nil, fmt.Errorf("job delta: %w", err)
 	}
 	return &RoomState{
-		JobID: s.JobID,
-		State: d,
+		JobID:      s.JobID,
+		State:      d,
+		Spectators: s.Spectators,
+		LastJobID:  s.LastJobID,
 	}, nil
 }
 
@@ -488,6 +593,8 @@ func (s *RoomState) ApplyDelta(d *RoomState) error {
 	if err := d.ValidateDelta(); err != nil {
 		return fmt.Errorf("invalid delta: %w", err)
 	}
+	s.Spectators = d.Spectators
+	s.LastJobID = d.LastJobID
 	if s.JobID != d.JobID {
 		if d.State != nil {
 			if err := d.State.ValidateFull(); err != nil {
@@ -39,3 +39,40 @@ func (t Timestamp) Sub(u Timestamp) time.Duration {
 func (t Timestamp) ToTime() time.Time {
 	return timestampBase.Add(time.Duration(t))
 }
+
+// ClockSample is the result of a single clock synchronization exchange with the remote side. Sent and
+// Received are our timestamps of sending the request and receiving the response, and Remote is the
+// timestamp reported by the remote side.
+type ClockSample struct {
+	Sent     Timestamp
+	Received Timestamp
+	Remote   Timestamp
+}
+
+func (s ClockSample) RTT() time.Duration {
+	return s.Received.Sub(s.Sent)
+}
+
+// Offset returns the estimated difference between the remote clock and ours, assuming that the
+// request and the response took the same time to travel.
+func (s ClockSample) Offset() time.Duration {
+	return s.Remote.Sub(s.Sent.Add(s.RTT() / 2))
+}
+
+// EstimateClockOffset estimates the difference between the remote clock and ours from multiple
+// samples. The sample with the smallest round-trip time is the most precise one, so it is used.
+func EstimateClockOffset(samples []ClockSample) (offset time.Duration, rtt time.Duration, ok bool) {
+	best := -1
+	for i, s := range samples {
+		if s.RTT() < 0 {
+			continue
+		}
+		if best < 0 || s.RTT() < samples[best].RTT() {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, 0, false
+	}
+	return samples[best].Offset(), samples[best].RTT(), true
+}
@@ -25,12 +25,16 @@ type WatcherOptions struct {
 	NoBuildPVS bool
 	PassRawPV  bool
 	MaxPVLen   int
+	MaxMultiPV int
 }
 
 func (o *WatcherOptions) FillDefaults() {
 	if o.MaxPVLen == 0 {
 		o.MaxPVLen = 16
 	}
+	if o.MaxMultiPV == 0 {
+		o.MaxMultiPV = 5
+	}
 }
 
 var _ battle.Watcher = (*Watcher)(nil)
@@ -78,6 +82,8 @@ func (w *Watcher) OnGameInited(game *battle.GameExt) {
 		TimeControl: game.TimeControl,
 		FixedTime:   game.FixedTime,
 		StartTime:   game.StartTime,
+		WhiteEngine: game.WhiteEngine,
+		BlackEngine: game.BlackEngine,
 	}
 
 	board, err := chess.NewBoard(game.Game.StartPos())
@@ -95,11 +101,24 @@ func (w *Watcher) OnGameInited(game *battle.GameExt) {
 }
 
 func (w *Watcher) updateGameUnlocked(game *battle.GameExt) {
-	if len(game.Scores) != game.Game.Len() {
+	if len(game.Scores) != game.Game.Len() ||
+		len(game.Times) != len(game.Scores) ||
+		len(game.Clocks) != len(game.Scores) {
 		panic("must not happen")
 	}
 
 	oldLen, newLen := int(w.state.Moves.Version), len(game.Scores)
+	if newLen != oldLen {
+		// MultiPV lines and current move belong to the previous search, so they are obsolete now.
+		for _, pl := range []*Player{w.state.White, w.state.Black} {
+			if pl.Lines != nil || pl.CurMove != "" {
+				pl.Lines = nil
+				pl.CurMove = ""
+				pl.CurMoveNumber = 0
+				pl.Version++
+			}
+		}
+	}
 	for i := oldLen; i < newLen; i++ {
 		move := game.Game.MoveAt(i)
 		w.state.Moves.Moves = append(w.state.Moves.Moves, move.UCIMove())
@@ -107,6 +126,8 @@ func (w *Watcher) updateGameUnlocked(game *battle.GameExt) {
 		w.state.Position.Version++
 	}
 	w.state.Moves.Scores = append(w.state.Moves.Scores, game.Scores[oldLen:newLen]...)
+	w.state.Moves.Times = append(w.state.Moves.Times, game.Times[oldLen:newLen]...)
+	w.state.Moves.Clocks = append(w.state.Moves.Clocks, game.Clocks[oldLen:newLen]...)
 	w.state.Moves.Version = int64(newLen)
 
 	status := game.Game.Outcome().Status()
@@ -172,7 +193,7 @@ func buildPVS(b *chess.Board, pv []chess.UCIMove) string {
 	return pvs
 }
 
-func (w *Watcher) OnEngineInfo(color chess.Color, status uci.SearchStatus) {
+func (w *Watcher) OnEngineInfo(color chess.Color, status uci.SearchStatus, info uci.Info) {
 	cursor := w.startTx()
 	defer w.endTx(cursor)
 
@@ -190,6 +211,7 @@ func (w *Watcher) OnEngineInfo(color chess.Color, status uci.SearchStatus) {
 		panic("must not happen")
 	}
 
+	changed := false
 	pvChanged := !slices.Equal(status.PV, pl.PV)
 	if status.Score != pl.Score ||
 		pvChanged ||
@@ -204,10 +226,100 @@ func (w *Watcher) OnEngineInfo(color chess.Color, status uci.SearchStatus) {
 		pl.Depth = int64(status.Depth)
 		pl.Nodes = status.Nodes
 		pl.NPS = status.NPS
+		changed = true
+	}
+	if w.updateStatsUnlocked(pl, status, info) {
+		changed = true
+	}
+	if w.updateLineUnlocked(pl, info) {
+		changed = true
+	}
+	if changed {
 		pl.Version++
 	}
 }
 
+func buildMoveString(b *chess.Board, m chess.UCIMove) string {
+	if b == nil {
+		return m.String()
+	}
+	mv, err := m.ToMove(b)
+	if err != nil {
+		return m.String()
+	}
+	s, err := mv.Styled(b, chess.MoveStyleFancySAN)
+	if err != nil {
+		return m.String()
+	}
+	return s
+}
+
+// updateStatsUnlocked updates the search stats which are reported only from time to time, so the last
+// reported value is kept.
+func (w *Watcher) updateStatsUnlocked(pl *Player, status uci.SearchStatus, info uci.Info) bool {
+	changed := false
+	if status.HashFull != pl.HashFull {
+		pl.HashFull = status.HashFull
+		changed = true
+	}
+	if d, ok := info.Seldepth.TryGet(); ok && int64(d) != pl.SelDepth {
+		pl.SelDepth = int64(d)
+		changed = true
+	}
+	if h, ok := info.TBHits.TryGet(); ok && h != pl.TBHits {
+		pl.TBHits = h
+		changed = true
+	}
+	if m, ok := info.CurMove.TryGet(); ok {
+		s := m.String()
+		if !w.o.NoBuildPVS {
+			s = buildMoveString(w.state.Position.Board, m)
+		}
+		if s != pl.CurMove {
+			pl.CurMove = s
+			changed = true
+		}
+	}
+	if n, ok := info.CurMoveNumber.TryGet(); ok && int64(n) != pl.CurMoveNumber {
+		pl.CurMoveNumber = int64(n)
+		changed = true
+	}
+	return changed
+}
+
+// updateLineUnlocked stores the line reported in MultiPV mode. The first line is also stored in the
+// Score and PV fields of the player, so the lines are kept only if there is more than one.
+func (w *Watcher) updateLineUnlocked(pl *Player, info uci.Info) bool {
+	idx, ok := info.MultiPV.TryGet()
+	if !ok || idx < 1 || idx > w.o.MaxMultiPV || info.PV == nil {
+		return false
+	}
+	if idx == 1 && len(pl.Lines) == 0 {
+		return false
+	}
+	pv := info.PV
+	if len(pv) > w.o.MaxPVLen {
+		pv = pv[:w.o.MaxPVLen]
+	}
+	for len(pl.Lines) < idx {
+		pl.Lines = append(pl.Lines, PVLine{})
+	}
+	line := &pl.Lines[idx-1]
+	changed := false
+	if sc, ok := info.Score.TryGet(); ok && sc.Bound == uci.ScoreExact && line.Score != maybe.Some(sc.Score) {
+		line.Score = maybe.Some(sc.Score)
+		changed = true
+	}
+	if !slices.Equal(pv, line.PV) {
+		line.PV = slices.Clone(pv)
+		if !w.o.NoBuildPVS {
+			line.PVS = buildPVS(w.state.Position.Board, line.PV)
+		}
+		changed = true
+	}
+	return changed
+}
+
 func (w *Watcher) OnGameUpdated(game *battle.GameExt, clk maybe.Maybe[clock.Clock]) {
 	nowTs := NowTimestamp()
 	makeDeadline := func(ticking bool, d time.Duration) maybe.Maybe[Timestamp] {
@@ -243,11 +355,14 @@ func (w *Watcher) StateDelta(old JobCursor) (*JobState, JobCursor, error) {
 		return nil, JobCursor{}, fmt.Errorf("delta: %w", err)
 	}
 	if !w.o.PassRawPV {
-		if d.White != nil {
-			d.White.PV = nil
-		}
-		if d.Black != nil {
-			d.Black.PV = nil
+		for _, pl := range []*Player{d.White, d.Black} {
+			if pl == nil {
+				continue
+			}
+			pl.PV = nil
+			for i := range pl.Lines {
+				pl.Lines[i].PV = nil
+			}
 		}
 	}
 	return d, w.state.Cursor(), nil
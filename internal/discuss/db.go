@@ -0,0 +1,16 @@
+package discuss
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNoSuchComment = errors.New("no such comment")
+
+type DB interface {
+	CreateComment(ctx context.Context, comment Comment) error
+	GetComment(ctx context.Context, commentID string) (Comment, error)
+	UpdateComment(ctx context.Context, comment Comment) error
+	DeleteComment(ctx context.Context, commentID string) error
+	ListContestComments(ctx context.Context, contestID string) ([]Comment, error)
+}
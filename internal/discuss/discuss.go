@@ -0,0 +1,102 @@
+package discuss
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/idgen"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+func CanPost(user *userauth.User) bool {
+	return user != nil && user.Perms.Get(userauth.PermDiscuss)
+}
+
+func CanModerate(user *userauth.User) bool {
+	return user != nil && user.Perms.Get(userauth.PermAdmin)
+}
+
+func CanEdit(user *userauth.User, c *Comment) bool {
+	return CanPost(user) && c.AuthorID == user.ID && !c.Hidden
+}
+
+func CanDelete(user *userauth.User, c *Comment) bool {
+	return CanModerate(user) || CanEdit(user, c)
+}
+
+type Board struct {
+	db DB
+}
+
+func NewBoard(db DB) *Board {
+	return &Board{db: db}
+}
+
+func (b *Board) Post(ctx context.Context, contestID string, authorID string, text string) (Comment, error) {
+	text = strings.TrimSpace(text)
+	if err := ValidateText(text); err != nil {
+		return Comment{}, fmt.Errorf("bad text: %w", err)
+	}
+	comment := Comment{
+		ID:        idgen.ID(),
+		ContestID: contestID,
+		AuthorID:  authorID,
+		Text:      text,
+		CreatedAt: timeutil.NowUTC(),
+	}
+	if err := b.db.CreateComment(ctx, comment); err != nil {
+		return Comment{}, fmt.Errorf("create comment: %w", err)
+	}
+	return comment, nil
+}
+
+func (b *Board) Get(ctx context.Context, commentID string) (Comment, error) {
+	return b.db.GetComment(ctx, commentID)
+}
+
+func (b *Board) Edit(ctx context.Context, c Comment, text string) error {
+	text = strings.TrimSpace(text)
+	if err := ValidateText(text); err != nil {
+		return fmt.Errorf("bad text: %w", err)
+	}
+	c.Text = text
+	now := timeutil.NowUTC()
+	c.EditedAt = &now
+	if err := b.db.UpdateComment(ctx, c); err != nil {
+		return fmt.Errorf("update comment: %w", err)
+	}
+	return nil
+}
+
+func (b *Board) SetHidden(ctx context.Context, c Comment, hidden bool) error {
+	c.Hidden = hidden
+	if err := b.db.UpdateComment(ctx, c); err != nil {
+		return fmt.Errorf("update comment: %w", err)
+	}
+	return nil
+}
+
+func (b *Board) Delete(ctx context.Context, commentID string) error {
+	return b.db.DeleteComment(ctx, commentID)
+}
+
+// List returns the contest comments in chronological order. Hidden comments are included only if
+// withHidden is set.
+func (b *Board) List(ctx context.Context, contestID string, withHidden bool) ([]Comment, error) {
+	comments, err := b.db.ListContestComments(ctx, contestID)
+	if err != nil {
+		return nil, fmt.Errorf("list comments: %w", err)
+	}
+	if !withHidden {
+		res := comments[:0]
+		for _, c := range comments {
+			if !c.Hidden {
+				res = append(res, c)
+			}
+		}
+		comments = res
+	}
+	return comments, nil
+}
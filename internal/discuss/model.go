@@ -0,0 +1,36 @@
+package discuss
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+const CommentMaxLen = 4000
+
+func ValidateText(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("empty comment")
+	}
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("comment is not valid utf-8")
+	}
+	if utf8.RuneCountInString(text) > CommentMaxLen {
+		return fmt.Errorf("comment exceeds %v characters", CommentMaxLen)
+	}
+	return nil
+}
+
+// Comment is a message in the contest discussion thread. Hidden comments are removed by
+// moderators and are only shown to them.
+type Comment struct {
+	ID        string `gorm:"primaryKey"`
+	ContestID string `gorm:"index"`
+	AuthorID  string `gorm:"index"`
+	Text      string
+	Hidden    bool
+	CreatedAt timeutil.UTCTime `gorm:"index"`
+	EditedAt  *timeutil.UTCTime
+}
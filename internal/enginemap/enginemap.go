@@ -28,6 +28,16 @@ type EngineOptions struct {
 	InitTimeout                 *time.Duration `toml:"init-timeout,omitempty"`
 	WaitOnCancelTimeout         *time.Duration `toml:"wait-on-cancel-timeout,omitempty"`
 	CreateTimeout               *time.Duration `toml:"create-timeout,omitempty"`
+	// Protocol is either "uci" (default) or "xboard" (also known as "cecp").
+	Protocol string `toml:"protocol,omitempty"`
+	// MaxEngines limits the number of simultaneously running engine processes. Zero means no limit.
+	MaxEngines int `toml:"max-engines,omitempty"`
+	// IdleTimeout closes the engine processes which stay idle for too long.
+	IdleTimeout *time.Duration `toml:"idle-timeout,omitempty"`
+	// Prewarm is the number of engine processes spawned beforehand.
+	Prewarm int `toml:"prewarm,omitempty"`
+	// MemoryLimitMB limits the address space of each engine process, in megabytes. Linux only.
+	MemoryLimitMB int64 `toml:"memory-limit-mb,omitempty"`
 }
 
 func cloneTrivial[T any](a *T) *T {
@@ -44,6 +54,7 @@ func (o EngineOptions) Clone() EngineOptions {
 	o.InitTimeout = cloneTrivial(o.InitTimeout)
 	o.WaitOnCancelTimeout = cloneTrivial(o.WaitOnCancelTimeout)
 	o.CreateTimeout = cloneTrivial(o.CreateTimeout)
+	o.IdleTimeout = cloneTrivial(o.IdleTimeout)
 	return o
 }
 
@@ -63,6 +74,16 @@ func (o EngineOptions) PoolOptions(shortName string) (battle.EnginePoolOptions,
 		}
 	}
 
+	idleTimeout := time.Duration(0)
+	if o.IdleTimeout != nil {
+		idleTimeout = *o.IdleTimeout
+	}
+
+	protocol, ok := battle.ProtocolFromString(o.Protocol)
+	if !ok {
+		return battle.EnginePoolOptions{}, fmt.Errorf("unknown protocol %q", o.Protocol)
+	}
+
 	createTimeout := maybe.None[time.Duration]()
 	if o.CreateTimeout != nil {
 		createTimeout = maybe.Some(*o.CreateTimeout)
@@ -107,6 +128,11 @@ func (o EngineOptions) PoolOptions(shortName string) (battle.EnginePoolOptions,
 			WaitOnCancelTimeout:         waitOnCancelTimeout,
 		},
 		CreateTimeout: createTimeout,
+		Protocol:      protocol,
+		MaxEngines:    o.MaxEngines,
+		IdleTimeout:   idleTimeout,
+		Prewarm:       o.Prewarm,
+		MemoryLimit:   o.MemoryLimitMB << 20,
 	}, nil
 }
 
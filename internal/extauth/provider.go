@@ -0,0 +1,304 @@
+package extauth
+
+import (
+	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex65536/day20/internal/util/httputil"
+)
+
+const (
+	KindGitHub = "github"
+	KindGoogle = "google"
+	KindOIDC   = "oidc"
+)
+
+type ProviderOptions struct {
+	Kind         string        `toml:"kind"`
+	Title        string        `toml:"title"`
+	ClientID     string        `toml:"client-id"`
+	ClientSecret string        `toml:"client-secret"`
+	Issuer       string        `toml:"issuer"`
+	Scopes       []string      `toml:"scopes"`
+	RedirectURL  string        `toml:"redirect-url"`
+	Timeout      time.Duration `toml:"timeout"`
+}
+
+func (o ProviderOptions) Clone() ProviderOptions {
+	o.Scopes = slices.Clone(o.Scopes)
+	return o
+}
+
+func (o *ProviderOptions) FillDefaults() {
+	switch o.Kind {
+	case KindGitHub:
+		if o.Title == "" {
+			o.Title = "GitHub"
+		}
+		if o.Scopes == nil {
+			o.Scopes = []string{"read:user"}
+		}
+	case KindGoogle:
+		if o.Title == "" {
+			o.Title = "Google"
+		}
+		if o.Issuer == "" {
+			o.Issuer = "https://accounts.google.com"
+		}
+	}
+	if o.Scopes == nil {
+		o.Scopes = []string{"openid", "profile", "email"}
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 30 * time.Second
+	}
+}
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+func ValidateName(name string) error {
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("bad provider name %q", name)
+	}
+	return nil
+}
+
+func (o *ProviderOptions) Validate() error {
+	switch o.Kind {
+	case KindGitHub:
+	case KindGoogle, KindOIDC:
+		if o.Issuer == "" {
+			return fmt.Errorf("no issuer")
+		}
+	default:
+		return fmt.Errorf("unknown provider kind %q", o.Kind)
+	}
+	if o.ClientID == "" {
+		return fmt.Errorf("no client id")
+	}
+	if o.RedirectURL == "" {
+		return fmt.Errorf("no redirect url")
+	}
+	return nil
+}
+
+// Identity is the user identity as reported by the provider. Subject is stable and unique within
+// a provider, while Username is only a suggestion and can be empty.
+type Identity struct {
+	Subject  string
+	Username string
+}
+
+type endpoints struct {
+	AuthURL     string `json:"authorization_endpoint"`
+	TokenURL    string `json:"token_endpoint"`
+	UserInfoURL string `json:"userinfo_endpoint"`
+}
+
+var githubEndpoints = endpoints{
+	AuthURL:     "https://github.com/login/oauth/authorize",
+	TokenURL:    "https://github.com/login/oauth/access_token",
+	UserInfoURL: "https://api.github.com/user",
+}
+
+type Provider struct {
+	name   string
+	o      *ProviderOptions
+	client *http.Client
+
+	mu        sync.Mutex
+	endpoints *endpoints
+}
+
+func NewProvider(name string, o ProviderOptions) (*Provider, error) {
+	o = o.Clone()
+	o.FillDefaults()
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("validate options: %w", err)
+	}
+	p := &Provider{
+		name:   name,
+		o:      &o,
+		client: &http.Client{Timeout: o.Timeout},
+	}
+	if o.Kind == KindGitHub {
+		p.endpoints = &githubEndpoints
+	}
+	return p, nil
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+func (p *Provider) Title() string {
+	return p.o.Title
+}
+
+// NewSecret generates a random value suitable for OAuth state or PKCE code verifier.
+func NewSecret() string {
+	var b [32]byte
+	if _, err := io.ReadFull(crand.Reader, b[:]); err != nil {
+		panic(fmt.Sprintf("crypto rand failed: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+func (p *Provider) doRequest(req *http.Request, dst any) error {
+	req.Header.Set("Accept", "application/json")
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		_ = rsp.Body.Close()
+	}()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		var b strings.Builder
+		_, _ = io.Copy(&b, io.LimitReader(rsp.Body, 1024))
+		return fmt.Errorf("status: %w", httputil.MakeError(rsp.StatusCode, b.String()))
+	}
+	if err := json.NewDecoder(io.LimitReader(rsp.Body, 1<<20)).Decode(dst); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+func (p *Provider) getEndpoints(ctx context.Context) (*endpoints, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+	discoveryURL := strings.TrimSuffix(p.o.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	var e endpoints
+	if err := p.doRequest(req, &e); err != nil {
+		return nil, fmt.Errorf("discover: %w", err)
+	}
+	if e.AuthURL == "" || e.TokenURL == "" || e.UserInfoURL == "" {
+		return nil, fmt.Errorf("discover: missing endpoints")
+	}
+	p.endpoints = &e
+	return p.endpoints, nil
+}
+
+// AuthCodeURL returns the URL to redirect the user to. The verifier is used for PKCE and must be
+// passed to Identify later.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, verifier string) (string, error) {
+	e, err := p.getEndpoints(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.o.ClientID)
+	q.Set("redirect_uri", p.o.RedirectURL)
+	q.Set("scope", strings.Join(p.o.Scopes, " "))
+	q.Set("state", state)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(e.AuthURL, "?") {
+		sep = "&"
+	}
+	return e.AuthURL + sep + q.Encode(), nil
+}
+
+// Identify exchanges the authorization code for the access token and fetches the user identity.
+// The identity is fetched from the userinfo endpoint over TLS, so no ID token validation is needed.
+func (p *Provider) Identify(ctx context.Context, code string, verifier string) (Identity, error) {
+	e, err := p.getEndpoints(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.o.RedirectURL)
+	form.Set("client_id", p.o.ClientID)
+	form.Set("client_secret", p.o.ClientSecret)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, fmt.Errorf("create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+		ErrorDesc   string `json:"error_description"`
+	}
+	if err := p.doRequest(req, &tok); err != nil {
+		return Identity{}, fmt.Errorf("exchange code: %w", err)
+	}
+	if tok.Error != "" {
+		return Identity{}, fmt.Errorf("exchange code: %v: %v", tok.Error, tok.ErrorDesc)
+	}
+	if tok.AccessToken == "" {
+		return Identity{}, fmt.Errorf("exchange code: no access token")
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, e.UserInfoURL, nil)
+	if err != nil {
+		return Identity{}, fmt.Errorf("create userinfo request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	if p.o.Kind == KindGitHub {
+		var info struct {
+			ID    int64  `json:"id"`
+			Login string `json:"login"`
+		}
+		if err := p.doRequest(req, &info); err != nil {
+			return Identity{}, fmt.Errorf("fetch user: %w", err)
+		}
+		if info.ID == 0 {
+			return Identity{}, fmt.Errorf("fetch user: no user id")
+		}
+		return Identity{
+			Subject:  strconv.FormatInt(info.ID, 10),
+			Username: info.Login,
+		}, nil
+	}
+	var info struct {
+		Subject           string `json:"sub"`
+		PreferredUsername string `json:"preferred_username"`
+		Email             string `json:"email"`
+	}
+	if err := p.doRequest(req, &info); err != nil {
+		return Identity{}, fmt.Errorf("fetch userinfo: %w", err)
+	}
+	if info.Subject == "" {
+		return Identity{}, fmt.Errorf("fetch userinfo: no subject")
+	}
+	username := info.PreferredUsername
+	if username == "" {
+		username, _, _ = strings.Cut(info.Email, "@")
+	}
+	return Identity{
+		Subject:  info.Subject,
+		Username: username,
+	}, nil
+}
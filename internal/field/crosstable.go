@@ -0,0 +1,151 @@
+package field
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/alex65536/day20/internal/stat"
+)
+
+type Mode int
+
+const (
+	// ModeRoundRobin plays each engine against every other engine.
+	ModeRoundRobin Mode = iota
+	// ModeGauntlet plays the first engine against every other engine.
+	ModeGauntlet
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeRoundRobin:
+		return "round-robin"
+	case ModeGauntlet:
+		return "gauntlet"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+func ModeFromString(s string) (Mode, error) {
+	switch s {
+	case "round-robin":
+		return ModeRoundRobin, nil
+	case "gauntlet":
+		return ModeGauntlet, nil
+	default:
+		return 0, fmt.Errorf("unknown mode %q", s)
+	}
+}
+
+// Pair contains the indices of two engines which play against each other.
+type Pair struct {
+	First  int
+	Second int
+}
+
+// Pairs returns all the pairs of engines which play against each other. If there are only two
+// engines, all the modes produce a single pair.
+func (m Mode) Pairs(engines int) []Pair {
+	var pairs []Pair
+	switch m {
+	case ModeRoundRobin:
+		for i := range engines {
+			for j := i + 1; j < engines; j++ {
+				pairs = append(pairs, Pair{First: i, Second: j})
+			}
+		}
+	case ModeGauntlet:
+		for j := 1; j < engines; j++ {
+			pairs = append(pairs, Pair{First: 0, Second: j})
+		}
+	default:
+		panic("bad mode")
+	}
+	return pairs
+}
+
+// Crosstable contains the results of the games played between the engines.
+type Crosstable struct {
+	Names []string
+	Pairs []Pair
+	// Status[i] contains the results of Pairs[i] from the perspective of its first engine.
+	Status []stat.Status
+	// Penta[i] contains the pentanomial statistics of Pairs[i] from the perspective of its first
+	// engine. It is filled only if each opening is played twice with colors reversed, and only the
+	// game pairs fully played in the current run are counted.
+	Penta []stat.Pentanomial
+	// Total is the number of games to be played in the entire match.
+	Total int
+}
+
+func NewCrosstable(names []string, pairs []Pair, total int) *Crosstable {
+	return &Crosstable{
+		Names:  slices.Clone(names),
+		Pairs:  slices.Clone(pairs),
+		Status: make([]stat.Status, len(pairs)),
+		Penta:  make([]stat.Pentanomial, len(pairs)),
+		Total:  total,
+	}
+}
+
+func (t *Crosstable) Clone() *Crosstable {
+	return &Crosstable{
+		Names:  slices.Clone(t.Names),
+		Pairs:  slices.Clone(t.Pairs),
+		Status: slices.Clone(t.Status),
+		Penta:  slices.Clone(t.Penta),
+		Total:  t.Total,
+	}
+}
+
+// Completed returns the number of games played so far.
+func (t *Crosstable) Completed() int {
+	res := 0
+	for _, s := range t.Status {
+		res += s.Total()
+	}
+	return res
+}
+
+// Cell returns the results of the engine i against the engine j from the perspective of i. The
+// second return value is false if these engines do not play against each other.
+func (t *Crosstable) Cell(i, j int) (stat.Status, bool) {
+	for k, p := range t.Pairs {
+		switch {
+		case p.First == i && p.Second == j:
+			return t.Status[k], true
+		case p.First == j && p.Second == i:
+			return t.Status[k].Inv(), true
+		}
+	}
+	return stat.Status{}, false
+}
+
+type Standing struct {
+	Engine int
+	Name   string
+	Status stat.Status
+}
+
+func (s Standing) Points() float64 {
+	return float64(s.Status.Win) + 0.5*float64(s.Status.Draw)
+}
+
+// Standings returns the results of each engine against all its opponents, from the best engine to
+// the worst one.
+func (t *Crosstable) Standings() []Standing {
+	res := make([]Standing, len(t.Names))
+	for i, name := range t.Names {
+		res[i] = Standing{Engine: i, Name: name}
+	}
+	for k, p := range t.Pairs {
+		res[p.First].Status = res[p.First].Status.Add(t.Status[k])
+		res[p.Second].Status = res[p.Second].Status.Add(t.Status[k].Inv())
+	}
+	slices.SortStableFunc(res, func(a, b Standing) int {
+		return cmp.Compare(b.Points(), a.Points())
+	})
+	return res
+}
@@ -0,0 +1,59 @@
+package field
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alex65536/go-chess/chess"
+
+	"github.com/alex65536/day20/internal/battle"
+)
+
+// writeDebugArtifacts stores the UCI transcript of the game into the debug directory. If the game
+// ended due to engine error, it also stores everything needed to reproduce the problem: the
+// warnings, the position history and the transcript.
+func writeDebugArtifacts(
+	dir string,
+	index int,
+	game *battle.GameExt,
+	warn battle.Warnings,
+	transcript *battle.Transcript,
+) error {
+	log := transcript.String()
+	logName := filepath.Join(dir, fmt.Sprintf("game-%06d.log", index))
+	if err := os.WriteFile(logName, []byte(log), 0o666); err != nil {
+		return fmt.Errorf("write log: %w", err)
+	}
+	if game.Game.Outcome().Verdict() != chess.VerdictEngineError {
+		return nil
+	}
+
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "Game: %v\n", index)
+	_, _ = fmt.Fprintf(&b, "White: %v\n", game.WhiteName)
+	_, _ = fmt.Fprintf(&b, "Black: %v\n", game.BlackName)
+	_, _ = fmt.Fprintf(&b, "Outcome: %v\n", game.Game.Outcome())
+	for _, w := range warn {
+		_, _ = fmt.Fprintf(&b, "Warning: %v\n", w)
+	}
+	startPos := game.Game.StartPos()
+	_, _ = fmt.Fprintf(&b, "Start FEN: %v\n", startPos.FEN())
+	_, _ = fmt.Fprintf(&b, "Final FEN: %v\n", game.Game.CurBoard().FEN())
+	_, _ = fmt.Fprintf(&b, "UCI position: position fen %v moves %v\n", startPos.FEN(), game.Game.UCIList())
+	_, _ = b.WriteString("\nPGN:\n")
+	if pgn, err := game.PGN(); err != nil {
+		_, _ = fmt.Fprintf(&b, "cannot convert to PGN: %v\n", err)
+	} else {
+		_, _ = b.WriteString(pgn)
+	}
+	_, _ = b.WriteString("\nUCI transcript:\n")
+	_, _ = b.WriteString(log)
+
+	crashName := filepath.Join(dir, fmt.Sprintf("crash-%06d.txt", index))
+	if err := os.WriteFile(crashName, []byte(b.String()), 0o666); err != nil {
+		return fmt.Errorf("write crash report: %w", err)
+	}
+	return nil
+}
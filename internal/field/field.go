@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"slices"
 
 	"github.com/alex65536/go-chess/chess"
 	"github.com/alex65536/go-chess/util/maybe"
@@ -11,30 +13,72 @@ import (
 
 	"github.com/alex65536/day20/internal/battle"
 	"github.com/alex65536/day20/internal/opening"
-	"github.com/alex65536/day20/internal/stat"
 )
 
 type Options struct {
-	Jobs   int
+	Jobs int
+	// Games is the number of games played by each pair of engines.
 	Games  int
 	Battle battle.Options
+	Resume Resume // Supported only when there is a single pair of engines.
+	// Repeat makes each pair of engines play each opening twice, with colors reversed. The results
+	// of such game pairs are collected into pentanomial statistics.
+	Repeat bool
+	// Ordered makes the games written strictly in the order they were started, with round equal to
+	// game index. Games which finish earlier than the preceding ones are held until all the
+	// preceding games are written, so an interrupted run leaves an ordered output without gaps.
+	Ordered bool
+	// DebugDir is the directory where UCI transcripts of games and crash reports are stored. Engine
+	// pools must have tracing enabled to record the transcripts. Optional.
+	DebugDir string
 }
 
-type Watcher func(s stat.Status, warn battle.Warnings)
+type Watcher func(t *Crosstable, warn battle.Warnings)
+
+// GameWatcher receives events about individual games. Games are numbered by index in the order
+// they are started. OnGameStarted may be called concurrently from multiple goroutines.
+type GameWatcher interface {
+	OnGameStarted(index int, white, black string)
+	OnGameFinished(index int, game *battle.GameExt, warn battle.Warnings)
+}
 
 type Config struct {
-	Writer  WriterConfig
-	Book    opening.Book
-	First   battle.EnginePool
-	Second  battle.EnginePool
-	Watcher Watcher
+	Writer      WriterConfig
+	Book        opening.Book
+	Engines     []battle.EnginePool
+	Mode        Mode
+	Watcher     Watcher
+	GameWatcher GameWatcher // Optional.
+	// BattleWatcher creates a watcher for the game with the given index, which receives the updates
+	// while the game is running. Optional.
+	BattleWatcher func(index int) battle.Watcher
 }
 
-func Fight(ctx context.Context, o Options, c Config) (stat.Status, error) {
+func Fight(ctx context.Context, o Options, c Config) (*Crosstable, error) {
+	if len(c.Engines) < 2 {
+		return nil, fmt.Errorf("at least two engines required")
+	}
+	pairs := c.Mode.Pairs(len(c.Engines))
+	if o.Resume.Games != 0 && len(pairs) != 1 {
+		return nil, fmt.Errorf("resume is supported only for two engines")
+	}
+	names := make([]string, len(c.Engines))
+	for i, e := range c.Engines {
+		names[i] = e.Name()
+	}
+	total := o.Games * len(pairs)
+	if o.DebugDir != "" {
+		if err := os.MkdirAll(o.DebugDir, 0o777); err != nil {
+			return nil, fmt.Errorf("create debug dir: %w", err)
+		}
+	}
+
 	eg, gctx := errgroup.WithContext(ctx)
 	eg.SetLimit(o.Jobs)
 
 	type output struct {
+		index  int
+		pair   int
 		game   *battle.GameExt
 		warn   battle.Warnings
 		invert bool
@@ -44,19 +88,43 @@ func Fight(ctx context.Context, o Options, c Config) (stat.Status, error) {
 	launched := make(chan struct{})
 	go func() {
 		defer close(launched)
-		for i := range o.Games {
+		lastOpenings := make([]*chess.Game, len(pairs))
+		// Pairs are interleaved, so all of them progress evenly.
+		for i := range total {
 			select {
 			case <-gctx.Done():
 				return
 			default:
 			}
-			invert := i%2 == 1
+			pairIdx := i % len(pairs)
+			pair := pairs[pairIdx]
+			invert := (i/len(pairs))%2 == 1
+			// Openings are chosen here in the order of games and not by the running games, so the
+			// same seed always gives the same openings regardless of the order in which the games
+			// start. The openings for the already played games are drawn as well, so the resumed
+			// match continues with the same openings as the uninterrupted one.
+			if !o.Repeat || !invert || lastOpenings[pairIdx] == nil {
+				lastOpenings[pairIdx] = c.Book.Opening()
+			}
+			if i < o.Resume.Games {
+				continue
+			}
+			book := opening.NewSingleGameBook(lastOpenings[pairIdx])
 			eg.Go(func() error {
+				var transcript *battle.Transcript
+				if o.DebugDir != "" {
+					transcript = battle.NewTranscript()
+				}
+				var watcher battle.Watcher
+				if c.BattleWatcher != nil {
+					watcher = c.BattleWatcher(i + 1)
+				}
 				battle := battle.Battle{
-					White:   c.First,
-					Black:   c.Second,
-					Book:    c.Book,
-					Options: o.Battle.Clone(),
+					White:      c.Engines[pair.First],
+					Black:      c.Engines[pair.Second],
+					Book:       book,
+					Options:    o.Battle.Clone(),
+					Transcript: transcript,
 				}
 				if invert {
 					battle.White, battle.Black = battle.Black, battle.White
@@ -65,17 +133,25 @@ func Fight(ctx context.Context, o Options, c Config) (stat.Status, error) {
 						battle.Options.TimeControl = maybe.Some(ctrl)
 					}
 				}
-				game, warn, err := battle.Do(gctx, nil)
+				if c.GameWatcher != nil {
+					c.GameWatcher.OnGameStarted(i+1, battle.White.Name(), battle.Black.Name())
+				}
+				game, warn, err := battle.Do(gctx, watcher)
 				if err != nil {
 					return fmt.Errorf("battle: %w", err)
 				}
+				if transcript != nil {
+					if err := writeDebugArtifacts(o.DebugDir, i+1, game, warn, transcript); err != nil {
+						return fmt.Errorf("debug: %w", err)
+					}
+				}
 				select {
 				case <-gctx.Done():
 					return gctx.Err()
 				default:
 				}
 				select {
-				case outputs <- output{game: game, warn: warn, invert: invert}:
+				case outputs <- output{index: i + 1, pair: pairIdx, game: game, warn: warn, invert: invert}:
 				case <-gctx.Done():
 					return gctx.Err()
 				}
@@ -85,36 +161,92 @@ func Fight(ctx context.Context, o Options, c Config) (stat.Status, error) {
 	}()
 
 	writer := NewWriter(c.Writer)
-	status := stat.Status{Win: 0, Draw: 0, Lose: 0}
-	c.Watcher(status, nil)
-	for i := range o.Games {
+	table := NewCrosstable(names, pairs, total)
+	if o.Resume.Games != 0 {
+		table.Status[0] = o.Resume.Status
+	}
+	c.Watcher(table.Clone(), nil)
+	pending := make(map[int]*battle.GameExt)
+	halfPairs := make(map[int]int)
+	nextIndex := o.Resume.Games + 1
+	for i := o.Resume.Games; i < total; i++ {
 		select {
 		case out := <-outputs:
-			out.game.Round = i + 1
+			if o.Ordered {
+				out.game.Round = out.index
+			} else {
+				out.game.Round = i + 1
+			}
+			status := &table.Status[out.pair]
+			// Score of the first engine in the pair, in half-points.
+			var score int
 			switch out.game.Game.Outcome().Status() {
 			case chess.StatusWhiteWins:
 				if out.invert {
 					status.Lose++
 				} else {
 					status.Win++
+					score = 2
 				}
 			case chess.StatusBlackWins:
 				if out.invert {
 					status.Win++
+					score = 2
 				} else {
 					status.Lose++
 				}
 			case chess.StatusDraw:
 				status.Draw++
+				score = 1
 			default:
 				panic("must not happen")
 			}
-			c.Watcher(status, out.warn)
-			writer.WriteGame(out.game)
+			if o.Repeat {
+				// Both games on the same opening are keyed by the index of the game which is played
+				// first.
+				key := out.index - 1
+				if out.invert {
+					key -= len(pairs)
+				}
+				if other, ok := halfPairs[key]; ok {
+					table.Penta[out.pair][other+score]++
+					delete(halfPairs, key)
+				} else {
+					halfPairs[key] = score
+				}
+			}
+			if c.GameWatcher != nil {
+				c.GameWatcher.OnGameFinished(out.index, out.game, out.warn)
+			}
+			c.Watcher(table.Clone(), out.warn)
+			if !o.Ordered {
+				writer.WriteGame(out.game)
+				break
+			}
+			pending[out.index] = out.game
+			for {
+				game, ok := pending[nextIndex]
+				if !ok {
+					break
+				}
+				writer.WriteGame(game)
+				delete(pending, nextIndex)
+				nextIndex++
+			}
 		case <-gctx.Done():
 			break
 		}
 	}
+	// If the match was interrupted, some of the games may still wait for the preceding ones. Write
+	// them anyway, as they are played already.
+	indices := make([]int, 0, len(pending))
+	for index := range pending {
+		indices = append(indices, index)
+	}
+	slices.Sort(indices)
+	for _, index := range indices {
+		writer.WriteGame(pending[index])
+	}
 	wErr := writer.Finish()
 	if wErr != nil {
 		wErr = fmt.Errorf("writer: %w", wErr)
@@ -122,7 +254,7 @@ func Fight(ctx context.Context, o Options, c Config) (stat.Status, error) {
 
 	<-launched
 	if err := eg.Wait(); err != nil {
-		return status, errors.Join(fmt.Errorf("wait: %w", err), wErr)
+		return table, errors.Join(fmt.Errorf("wait: %w", err), wErr)
 	}
-	return status, wErr
+	return table, wErr
 }
@@ -0,0 +1,104 @@
+package field
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alex65536/go-chess/chess"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/stat"
+)
+
+// Resume describes the games played in the previous runs of the match.
+type Resume struct {
+	Games  int
+	Status stat.Status
+}
+
+func splitPGN(r io.Reader) ([]string, error) {
+	var (
+		games    []string
+		cur      strings.Builder
+		hasMoves bool
+	)
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			games = append(games, s+"\n")
+		}
+		cur.Reset()
+		hasMoves = false
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		ln := sc.Text()
+		trimmed := strings.TrimSpace(ln)
+		if strings.HasPrefix(trimmed, "[") && hasMoves {
+			flush()
+		}
+		if trimmed != "" && !strings.HasPrefix(trimmed, "[") {
+			hasMoves = true
+		}
+		_, _ = cur.WriteString(ln)
+		_ = cur.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+	flush()
+	return games, nil
+}
+
+// ResumeFromPGN counts the finished games in PGN produced by the previous runs of the match.
+// Results are attributed to the engines by their names. Unfinished games are skipped.
+func ResumeFromPGN(r io.Reader, firstName, secondName string) (Resume, error) {
+	pgns, err := splitPGN(r)
+	if err != nil {
+		return Resume{}, fmt.Errorf("split pgn: %w", err)
+	}
+	var res Resume
+	for i, pgn := range pgns {
+		game, err := battle.GameExtFromPGN(pgn)
+		if err != nil {
+			return Resume{}, fmt.Errorf("game %v: %w", i+1, err)
+		}
+		status := game.Game.Outcome().Status()
+		if !status.IsFinished() {
+			continue
+		}
+		var invert bool
+		switch {
+		case firstName == secondName:
+			// Cannot distinguish engines by name, so rely on color alternation.
+			invert = res.Games%2 == 1
+		case game.WhiteName == firstName && game.BlackName == secondName:
+			invert = false
+		case game.WhiteName == secondName && game.BlackName == firstName:
+			invert = true
+		default:
+			return Resume{}, fmt.Errorf("game %v: played by %q and %q, not by the given engines",
+				i+1, game.WhiteName, game.BlackName)
+		}
+		switch status {
+		case chess.StatusWhiteWins:
+			if invert {
+				res.Status.Lose++
+			} else {
+				res.Status.Win++
+			}
+		case chess.StatusBlackWins:
+			if invert {
+				res.Status.Win++
+			} else {
+				res.Status.Lose++
+			}
+		case chess.StatusDraw:
+			res.Status.Draw++
+		}
+		res.Games++
+	}
+	return res, nil
+}
@@ -0,0 +1,57 @@
+package field
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alex65536/day20/internal/stat"
+)
+
+func testPGN(white, black, result string) string {
+	return "[White \"" + white + "\"]\n[Black \"" + black + "\"]\n[Result \"" + result + "\"]\n\n" +
+		"1. e4 e5 2. Nf3 {[%eval 0.25]} Nc6 " + result + "\n\n"
+}
+
+func TestResumeFromPGN(t *testing.T) {
+	pgn := testPGN("first", "second", "1-0") +
+		testPGN("second", "first", "1-0") +
+		testPGN("first", "second", "1/2-1/2") +
+		testPGN("second", "first", "0-1") +
+		// The last game was interrupted, so it is skipped.
+		testPGN("first", "second", "*")
+	res, err := ResumeFromPGN(strings.NewReader(pgn), "first", "second")
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	expected := Resume{Games: 4, Status: stat.Status{Win: 2, Draw: 1, Lose: 1}}
+	if res != expected {
+		t.Fatalf("bad resume: expected = %+v, got = %+v", expected, res)
+	}
+}
+
+func TestResumeFromPGNSameNames(t *testing.T) {
+	// The engines alternate colors, so the result of each second game is inverted.
+	pgn := testPGN("engine", "engine", "1-0") +
+		testPGN("engine", "engine", "*") +
+		testPGN("engine", "engine", "1-0") +
+		testPGN("engine", "engine", "0-1")
+	res, err := ResumeFromPGN(strings.NewReader(pgn), "engine", "engine")
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	expected := Resume{Games: 3, Status: stat.Status{Win: 1, Lose: 2}}
+	if res != expected {
+		t.Fatalf("bad resume: expected = %+v, got = %+v", expected, res)
+	}
+}
+
+func TestResumeFromPGNNameMismatch(t *testing.T) {
+	pgn := testPGN("first", "second", "1-0") + testPGN("first", "third", "0-1")
+	_, err := ResumeFromPGN(strings.NewReader(pgn), "first", "second")
+	if err == nil {
+		t.Fatalf("no error on name mismatch")
+	}
+	if !strings.Contains(err.Error(), "game 2") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
@@ -11,6 +11,15 @@ import (
 
 type WriterOptions struct {
 	NoFlushAfterWrite bool
+	// FlushEvery is the number of games after which the outputs are flushed. Zero means flushing
+	// after each game. Ignored if NoFlushAfterWrite is set.
+	FlushEvery int
+	// Sync makes the writer also call Sync() on the outputs after each flush, if they support it
+	// (like *os.File does). This ensures the games are on disk if the system crashes.
+	Sync bool
+	// Append indicates that the games are appended to the output which already contains games, so
+	// a separator must be written before the first game.
+	Append bool
 }
 
 type WriterConfig struct {
@@ -20,15 +29,22 @@ type WriterConfig struct {
 }
 
 type Writer struct {
-	pgn   *bufio.Writer
-	sgs   *bufio.Writer
-	errs  []error
-	first bool
-	opts  WriterOptions
+	pgn     *bufio.Writer
+	sgs     *bufio.Writer
+	pgnRaw  io.Writer
+	sgsRaw  io.Writer
+	errs    []error
+	first   bool
+	unflush int
+	opts    WriterOptions
+}
+
+type syncer interface {
+	Sync() error
 }
 
 func NewWriter(c WriterConfig) *Writer {
-	w := &Writer{first: true, opts: c.Opts}
+	w := &Writer{first: !c.Opts.Append, opts: c.Opts, pgnRaw: c.PGN, sgsRaw: c.SGS}
 	if c.PGN != nil {
 		w.pgn = bufio.NewWriter(c.PGN)
 	}
@@ -38,12 +54,18 @@ func NewWriter(c WriterConfig) *Writer {
 	return w
 }
 
-func (w *Writer) flush(b *bufio.Writer, name string) *bufio.Writer {
+func (w *Writer) flush(b *bufio.Writer, raw io.Writer, name string) *bufio.Writer {
 	if b != nil {
 		if err := b.Flush(); err != nil {
 			w.errs = append(w.errs, fmt.Errorf("flush %v: %w", name, err))
 			return nil
 		}
+		if s, ok := raw.(syncer); ok && w.opts.Sync {
+			if err := s.Sync(); err != nil {
+				w.errs = append(w.errs, fmt.Errorf("sync %v: %w", name, err))
+				return nil
+			}
+		}
 	}
 	return b
 }
@@ -68,12 +90,9 @@ func (w *Writer) WriteGame(g *battle.GameExt) {
 			return nil
 		}(); err != nil {
 			w.errs = append(w.errs, err)
-			w.flush(w.pgn, "pgn")
+			w.flush(w.pgn, w.pgnRaw, "pgn")
 			w.pgn = nil
 		}
-		if !w.opts.NoFlushAfterWrite {
-			w.pgn = w.flush(w.pgn, "pgn")
-		}
 	}
 	if w.sgs != nil {
 		if err := func() error {
@@ -89,19 +108,25 @@ func (w *Writer) WriteGame(g *battle.GameExt) {
 			return nil
 		}(); err != nil {
 			w.errs = append(w.errs, err)
-			w.flush(w.sgs, "sgs")
+			w.flush(w.sgs, w.sgsRaw, "sgs")
 			w.sgs = nil
 		}
-		if !w.opts.NoFlushAfterWrite {
-			w.sgs = w.flush(w.sgs, "sgs")
-		}
+	}
+	if w.opts.NoFlushAfterWrite {
+		return
+	}
+	w.unflush++
+	if w.unflush >= max(w.opts.FlushEvery, 1) {
+		w.unflush = 0
+		w.pgn = w.flush(w.pgn, w.pgnRaw, "pgn")
+		w.sgs = w.flush(w.sgs, w.sgsRaw, "sgs")
 	}
 }
 
 func (w *Writer) Finish() error {
-	w.flush(w.pgn, "pgn")
+	w.flush(w.pgn, w.pgnRaw, "pgn")
 	w.pgn = nil
-	w.flush(w.sgs, "sgs")
+	w.flush(w.sgs, w.sgsRaw, "sgs")
 	w.sgs = nil
 	return errors.Join(w.errs...)
 }
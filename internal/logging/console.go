@@ -0,0 +1,141 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type consoleHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	color  bool
+	prefix string
+	attrs  string
+}
+
+func newConsoleHandler(w io.Writer, color bool) *consoleHandler {
+	return &consoleHandler{
+		mu:    &sync.Mutex{},
+		w:     w,
+		color: color,
+	}
+}
+
+func (h *consoleHandler) style(s string, ms string) string {
+	if !h.color {
+		return s
+	}
+	return "\033[" + ms + "m" + s + "\033[0m"
+}
+
+func (h *consoleHandler) levelString(l slog.Level) string {
+	switch {
+	case l >= slog.LevelError:
+		return h.style("ERR", "31;1")
+	case l >= slog.LevelWarn:
+		return h.style("WRN", "33;1")
+	case l >= slog.LevelInfo:
+		return h.style("INF", "32")
+	default:
+		return h.style("DBG", "90")
+	}
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *consoleHandler) appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, sub := range attrs {
+			h.appendAttr(b, prefix, sub)
+		}
+		return
+	}
+	var val string
+	if a.Value.Kind() == slog.KindTime {
+		val = a.Value.Time().Format(time.RFC3339Nano)
+	} else {
+		val = a.Value.String()
+	}
+	if needsQuoting(val) {
+		val = strconv.Quote(val)
+	}
+	_ = b.WriteByte(' ')
+	_, _ = b.WriteString(h.style(prefix+a.Key+"=", "36"))
+	_, _ = b.WriteString(val)
+}
+
+func (h *consoleHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if !r.Time.IsZero() {
+		_, _ = b.WriteString(h.style(r.Time.Format("2006-01-02 15:04:05.000"), "90"))
+		_ = b.WriteByte(' ')
+	}
+	_, _ = b.WriteString(h.levelString(r.Level))
+	_ = b.WriteByte(' ')
+	_, _ = b.WriteString(r.Message)
+	_, _ = b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		h.appendAttr(&b, h.prefix, a)
+		return true
+	})
+	_ = b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := io.WriteString(h.w, b.String()); err != nil {
+		return fmt.Errorf("write log: %w", err)
+	}
+	return nil
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	_, _ = b.WriteString(h.attrs)
+	for _, a := range attrs {
+		h.appendAttr(&b, h.prefix, a)
+	}
+	res := *h
+	res.attrs = b.String()
+	return &res
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	res := *h
+	res.prefix += name + "."
+	return &res
+}
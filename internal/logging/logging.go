@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+
+	"github.com/alex65536/day20/internal/util/style"
+)
+
+const ModuleKey = "module"
+
+// Module returns a logger for the given module. Its level can be overridden in Options.Modules.
+func Module(log *slog.Logger, name string) *slog.Logger {
+	return log.With(slog.String(ModuleKey, name))
+}
+
+type levelSet struct {
+	level   slog.Level
+	modules map[string]slog.Level
+}
+
+// levels are shared between all the handlers derived from the same logger, so they can be changed
+// at runtime with SetLevels.
+type levels struct {
+	cur atomic.Pointer[levelSet]
+	min slog.LevelVar
+}
+
+func (l *levels) set(o *Options) {
+	level, err := parseLevel(o.Level)
+	if err != nil {
+		panic("must not happen")
+	}
+	minLevel := level
+	modules := make(map[string]slog.Level, len(o.Modules))
+	for m, s := range o.Modules {
+		l, err := parseLevel(s)
+		if err != nil {
+			panic("must not happen")
+		}
+		modules[m] = l
+		minLevel = min(minLevel, l)
+	}
+	l.cur.Store(&levelSet{level: level, modules: modules})
+	l.min.Set(minLevel)
+}
+
+type moduleHandler struct {
+	h      slog.Handler
+	levels *levels
+	module string
+}
+
+func (h *moduleHandler) Enabled(_ context.Context, l slog.Level) bool {
+	ls := h.levels.cur.Load()
+	level := ls.level
+	if h.module != "" {
+		if ml, ok := ls.modules[h.module]; ok {
+			level = ml
+		}
+	}
+	return l >= level
+}
+
+func (h *moduleHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.h.Handle(ctx, r)
+}
+
+func (h *moduleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	module := h.module
+	for _, a := range attrs {
+		if a.Key == ModuleKey {
+			module = a.Value.String()
+		}
+	}
+	return &moduleHandler{
+		h:      h.h.WithAttrs(attrs),
+		levels: h.levels,
+		module: module,
+	}
+}
+
+func (h *moduleHandler) WithGroup(name string) slog.Handler {
+	return &moduleHandler{
+		h:      h.h.WithGroup(name),
+		levels: h.levels,
+		module: h.module,
+	}
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// New creates a logger according to the options. The returned closer must be closed after the
+// logger is no longer used.
+func New(o Options) (*slog.Logger, io.Closer, error) {
+	o = o.Clone()
+	o.FillDefaults()
+	if err := o.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("bad options: %w", err)
+	}
+
+	lv := &levels{}
+	lv.set(&o)
+
+	var w io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+	tty, color := style.IsStderrTTY(), style.StderrSupportsColor()
+	if o.File != "" {
+		f, err := openRotatingFile(o.File, o.MaxSize*1024*1024, o.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, closer = f, f
+		tty, color = false, false
+	}
+
+	format := o.Format
+	if format == FormatAuto {
+		format = FormatJSON
+		if tty {
+			format = FormatConsole
+		}
+	}
+	var h slog.Handler
+	handlerOpts := &slog.HandlerOptions{Level: &lv.min}
+	switch format {
+	case FormatConsole:
+		h = newConsoleHandler(w, color)
+	case FormatText:
+		h = slog.NewTextHandler(w, handlerOpts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		panic("must not happen")
+	}
+
+	return slog.New(&moduleHandler{
+		h:      h,
+		levels: lv,
+	}), closer, nil
+}
+
+// SetLevels changes the levels of the logger created with New, and of all the loggers derived from
+// it. Other options are not applied, as they require reopening the output.
+func SetLevels(log *slog.Logger, o Options) error {
+	h, ok := log.Handler().(*moduleHandler)
+	if !ok {
+		return fmt.Errorf("logger not created by this package")
+	}
+	o = o.Clone()
+	o.FillDefaults()
+	if err := o.Validate(); err != nil {
+		return fmt.Errorf("bad options: %w", err)
+	}
+	h.levels.set(&o)
+	return nil
+}
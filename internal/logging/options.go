@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+)
+
+type Format string
+
+const (
+	FormatAuto    Format = "auto"
+	FormatConsole Format = "console"
+	FormatText    Format = "text"
+	FormatJSON    Format = "json"
+)
+
+type Options struct {
+	// Level is one of "debug", "info", "warn" or "error".
+	Level string `toml:"level"`
+	// Modules overrides the level for loggers created with Module().
+	Modules map[string]string `toml:"modules"`
+	// Format is "auto" by default, which means "console" if output is a terminal and "json"
+	// otherwise.
+	Format Format `toml:"format"`
+	// File is the path to the log file. If empty, logs are written to stderr.
+	File string `toml:"file"`
+	// MaxSize is the size of the log file in megabytes after which it gets rotated. Zero means that
+	// the file is never rotated.
+	MaxSize int64 `toml:"max-size"`
+	// MaxBackups is the number of rotated log files to keep.
+	MaxBackups int `toml:"max-backups"`
+}
+
+func (o Options) Clone() Options {
+	o.Modules = maps.Clone(o.Modules)
+	return o
+}
+
+func (o *Options) FillDefaults() {
+	if o.Level == "" {
+		o.Level = "info"
+	}
+	if o.Format == "" {
+		o.Format = FormatAuto
+	}
+	if o.MaxBackups == 0 {
+		o.MaxBackups = 5
+	}
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return 0, fmt.Errorf("bad level %q", s)
+	}
+	return l, nil
+}
+
+func (o *Options) Validate() error {
+	if _, err := parseLevel(o.Level); err != nil {
+		return err
+	}
+	for m, l := range o.Modules {
+		if _, err := parseLevel(l); err != nil {
+			return fmt.Errorf("module %q: %w", m, err)
+		}
+	}
+	switch o.Format {
+	case FormatAuto, FormatConsole, FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("bad format %q", o.Format)
+	}
+	if o.MaxSize < 0 {
+		return fmt.Errorf("negative max-size")
+	}
+	if o.MaxBackups < 0 {
+		return fmt.Errorf("negative max-backups")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Options struct {
+	Host     string        `toml:"host"`
+	Port     uint16        `toml:"port"`
+	Username string        `toml:"username"`
+	Password string        `toml:"password"`
+	From     string        `toml:"from"`
+	Timeout  time.Duration `toml:"timeout"`
+}
+
+func (o Options) Clone() Options {
+	return o
+}
+
+func (o *Options) FillDefaults() {
+	if o.Port == 0 {
+		o.Port = 587
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 30 * time.Second
+	}
+}
+
+func (o *Options) Validate() error {
+	if o.Host == "" {
+		return fmt.Errorf("no smtp host")
+	}
+	if err := ValidateAddress(o.From); err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	return nil
+}
+
+// ValidateAddress checks that the address is a bare email address, without display name.
+func ValidateAddress(address string) error {
+	a, err := mail.ParseAddress(address)
+	if err != nil || a.Name != "" || a.Address != address {
+		return fmt.Errorf("bad email address")
+	}
+	return nil
+}
+
+type Mailer struct {
+	o *Options
+}
+
+func New(o Options) (*Mailer, error) {
+	o = o.Clone()
+	o.FillDefaults()
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("validate options: %w", err)
+	}
+	return &Mailer{o: &o}, nil
+}
+
+func buildMail(from, to, subject, text string) []byte {
+	var b bytes.Buffer
+	_, _ = fmt.Fprintf(&b, "From: %v\r\n", from)
+	_, _ = fmt.Fprintf(&b, "To: %v\r\n", to)
+	_, _ = fmt.Fprintf(&b, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", subject))
+	_, _ = fmt.Fprintf(&b, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	_, _ = fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	_, _ = fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\n")
+	_, _ = fmt.Fprintf(&b, "Content-Transfer-Encoding: 8bit\r\n")
+	_, _ = fmt.Fprintf(&b, "\r\n")
+	_, _ = b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+func (m *Mailer) Send(ctx context.Context, to, subject, text string) error {
+	o := m.o
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+	addr := net.JoinHostPort(o.Host, strconv.Itoa(int(o.Port)))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("dial: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, o.Host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("create client: %w", err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: o.Host}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if o.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", o.Username, o.Password, o.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := c.Mail(o.From); err != nil {
+		return fmt.Errorf("mail: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("rcpt: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if _, err := w.Write(buildMail(o.From, to, subject, text)); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("finish data: %w", err)
+	}
+	if err := c.Quit(); err != nil {
+		return fmt.Errorf("quit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package notify
+
+import (
+	"context"
+	"errors"
+
+	"github.com/alex65536/day20/internal/userauth"
+)
+
+var ErrNoSuchTarget = errors.New("no such target")
+
+type DB interface {
+	CreateNotifyTarget(ctx context.Context, target Target) error
+	DeleteNotifyTarget(ctx context.Context, targetID string) error
+	GetNotifyTarget(ctx context.Context, targetID string) (Target, error)
+	ListContestNotifyTargets(ctx context.Context, contestID string) ([]Target, error)
+	ListUserNotifyTargets(ctx context.Context, userID string) ([]Target, error)
+	ListGlobalNotifyTargets(ctx context.Context) ([]Target, error)
+	GetUser(ctx context.Context, userID string, o ...userauth.GetUserOptions) (userauth.User, error)
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// isPublicAddr reports whether the webhook is allowed to connect to the address. The webhook URLs
+// come from users, so the addresses inside the server network are refused, otherwise the users can
+// reach the services which are not exposed to the internet.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsUnspecified() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast()
+}
+
+func checkDialAddr(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("bad address %q: %w", address, err)
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("address %v is not public", addrPort.Addr())
+	}
+	return nil
+}
+
+// newWebhookClient creates the client for user webhooks. The address is checked at dial time, after
+// the name is resolved, so neither DNS records nor redirects can point the webhook inside the server
+// network. Proxies are not used, as the dialer would check the proxy address instead.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: checkDialAddr,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          16,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	for _, tc := range []struct {
+		addr   string
+		public bool
+	}{
+		{"1.1.1.1", true},
+		{"8.8.8.8", true},
+		{"2a00:1450:4010:c05::8a", true},
+		{"0.0.0.0", false},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"224.0.0.1", false},
+		{"::", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:1.1.1.1", true},
+	} {
+		if got := isPublicAddr(netip.MustParseAddr(tc.addr)); got != tc.public {
+			t.Fatalf("bad result for %v: expected = %v, got = %v", tc.addr, tc.public, got)
+		}
+	}
+}
+
+func TestCheckDialAddr(t *testing.T) {
+	if err := checkDialAddr("tcp", "1.1.1.1:443", nil); err != nil {
+		t.Fatalf("public address refused: %v", err)
+	}
+	if err := checkDialAddr("tcp", "127.0.0.1:8080", nil); err == nil {
+		t.Fatalf("loopback address allowed")
+	}
+	if err := checkDialAddr("tcp", "[fe80::1%eth0]:80", nil); err == nil {
+		t.Fatalf("link-local address allowed")
+	}
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alex65536/day20/internal/scheduler"
+)
+
+type matchPayload struct {
+	First     string `json:"first"`
+	Second    string `json:"second"`
+	FirstWin  int64  `json:"first_win"`
+	Draw      int64  `json:"draw"`
+	SecondWin int64  `json:"second_win"`
+	Score     string `json:"score"`
+}
+
+// payload is sent as is to webhooks and is used to render text messages for other targets.
+type payload struct {
+	ContestID  string        `json:"contest_id"`
+	Name       string        `json:"name"`
+	Status     string        `json:"status"`
+	Reason     string        `json:"reason,omitempty"`
+	URL        string        `json:"url,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Match      *matchPayload `json:"match,omitempty"`
+}
+
+func buildPayload(o *Options, info scheduler.ContestInfo, data scheduler.ContestData) *payload {
+	p := &payload{
+		ContestID: info.ID,
+		Name:      info.Name,
+		Status:    data.Status.Kind.String(),
+		Reason:    data.Status.Reason,
+	}
+	if o.LinkPrefix != "" {
+		p.URL = o.LinkPrefix + info.ID
+	}
+	if data.FinishedAt != nil {
+		t := data.FinishedAt.UTC()
+		p.FinishedAt = &t
+	}
+	if info.Kind == scheduler.ContestMatch && data.Match != nil && len(info.Players) == 2 {
+		p.Match = &matchPayload{
+			First:     info.Players[0].Name,
+			Second:    info.Players[1].Name,
+			FirstWin:  data.Match.FirstWin,
+			Draw:      data.Match.Draw,
+			SecondWin: data.Match.SecondWin,
+			Score:     data.Match.Status().ScoreString(),
+		}
+	}
+	return p
+}
+
+func (p *payload) Subject() string {
+	var status string
+	switch p.Status {
+	case scheduler.ContestSucceeded.String():
+		status = "finished"
+	case scheduler.ContestAborted.String():
+		status = "aborted"
+	case scheduler.ContestFailed.String():
+		status = "failed"
+	default:
+		status = p.Status
+	}
+	return fmt.Sprintf("Contest %q %v", p.Name, status)
+}
+
+func (p *payload) Text() string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "%v\n", p.Subject())
+	if p.Reason != "" {
+		_, _ = fmt.Fprintf(&b, "Reason: %v\n", p.Reason)
+	}
+	if m := p.Match; m != nil {
+		_, _ = fmt.Fprintf(&b, "\n%v vs %v\n", m.First, m.Second)
+		_, _ = fmt.Fprintf(&b, "+%v =%v -%v (score %v)\n", m.FirstWin, m.Draw, m.SecondWin, m.Score)
+	}
+	if p.URL != "" {
+		_, _ = fmt.Fprintf(&b, "\n%v\n", p.URL)
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/alex65536/day20/internal/mailer"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+const AddressMaxLen = 512
+
+type TargetKind int
+
+const (
+	TargetUnknown TargetKind = iota
+	TargetWebhook
+	TargetEmail
+	TargetTelegram
+)
+
+func (k TargetKind) String() string {
+	switch k {
+	case TargetWebhook:
+		return "webhook"
+	case TargetEmail:
+		return "email"
+	case TargetTelegram:
+		return "telegram"
+	default:
+		return "?"
+	}
+}
+
+func (k TargetKind) PrettyString() string {
+	switch k {
+	case TargetWebhook:
+		return "Webhook"
+	case TargetEmail:
+		return "Email"
+	case TargetTelegram:
+		return "Telegram"
+	default:
+		return "?"
+	}
+}
+
+func TargetKindFromString(s string) (TargetKind, bool) {
+	for k := TargetWebhook; k <= TargetTelegram; k++ {
+		if k.String() == s {
+			return k, true
+		}
+	}
+	return TargetUnknown, false
+}
+
+var telegramChatRegex = regexp.MustCompile(`^(-?[0-9]+|@[A-Za-z0-9_]{5,32})$`)
+
+func (k TargetKind) ValidateAddress(address string) error {
+	if address == "" {
+		return fmt.Errorf("empty address")
+	}
+	if utf8.RuneCountInString(address) > AddressMaxLen {
+		return fmt.Errorf("address exceeds %v runes", AddressMaxLen)
+	}
+	switch k {
+	case TargetWebhook:
+		u, err := url.Parse(address)
+		if err != nil {
+			return fmt.Errorf("bad url")
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("url must be http or https")
+		}
+		if u.Host == "" {
+			return fmt.Errorf("url has no host")
+		}
+		return nil
+	case TargetEmail:
+		return mailer.ValidateAddress(address)
+	case TargetTelegram:
+		if !telegramChatRegex.MatchString(address) {
+			return fmt.Errorf("telegram chat must be a numeric id or @channel")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown target kind")
+	}
+}
+
+// Target is a single destination for contest notifications. If ContestID is nil, then the target
+// receives notifications about all the contests. UserID is the user who created the target.
+type Target struct {
+	ID        string  `gorm:"primaryKey"`
+	ContestID *string `gorm:"index"`
+	UserID    string  `gorm:"index"`
+	Kind      TargetKind
+	Address   string
+	CreatedAt timeutil.UTCTime
+}
@@ -0,0 +1,325 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alex65536/day20/internal/mailer"
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/clone"
+	"github.com/alex65536/day20/internal/util/idgen"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+type TelegramOptions struct {
+	BotToken string `toml:"bot-token"`
+	APIURL   string `toml:"api-url"`
+}
+
+func (o *TelegramOptions) FillDefaults() {
+	if o.APIURL == "" {
+		o.APIURL = "https://api.telegram.org"
+	}
+}
+
+type Options struct {
+	Timeout      time.Duration        `toml:"timeout"`
+	QueueSize    int                  `toml:"queue-size"`
+	LinkPrefix   string               `toml:"link-prefix"`
+	Telegram     *TelegramOptions     `toml:"telegram"`
+	RoomWebhooks []RoomWebhookOptions `toml:"room-webhooks"`
+	// AllowPrivateWebhooks lets the user webhooks connect to loopback, link-local and private
+	// addresses. Enable it only if all the users are trusted.
+	AllowPrivateWebhooks bool `toml:"allow-private-webhooks"`
+}
+
+func (o Options) Clone() Options {
+	o.Telegram = clone.TrivialPtr(o.Telegram)
+	o.RoomWebhooks = clone.DeepSlice(o.RoomWebhooks)
+	return o
+}
+
+func (o *Options) FillDefaults() {
+	if o.Timeout == 0 {
+		o.Timeout = 30 * time.Second
+	}
+	if o.QueueSize == 0 {
+		o.QueueSize = 64
+	}
+	if o.Telegram != nil {
+		o.Telegram.FillDefaults()
+	}
+}
+
+func (o *Options) Validate() error {
+	if o.Telegram != nil {
+		if o.Telegram.BotToken == "" {
+			return fmt.Errorf("no telegram bot token")
+		}
+	}
+	for i := range o.RoomWebhooks {
+		if err := o.RoomWebhooks[i].Validate(); err != nil {
+			return fmt.Errorf("room webhook #%v: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+type event struct {
+	info scheduler.ContestInfo
+	data scheduler.ContestData
+}
+
+type Notifier struct {
+	o          *Options
+	db         DB
+	log        *slog.Logger
+	mailer     *mailer.Mailer
+	client     *http.Client
+	webhooks   *http.Client
+	events     chan event
+	roomEvents chan roomkeeper.Event
+	ctx        context.Context
+	cancel     func()
+	done       chan struct{}
+}
+
+var _ scheduler.Notifier = (*Notifier)(nil)
+
+// New creates a notifier. If mailer is nil, email notifications are disabled.
+func New(log *slog.Logger, db DB, mailer *mailer.Mailer, o Options) (*Notifier, error) {
+	o = o.Clone()
+	o.FillDefaults()
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("validate options: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{
+		o:          &o,
+		db:         db,
+		log:        log,
+		mailer:     mailer,
+		client:     &http.Client{Timeout: o.Timeout},
+		webhooks:   newWebhookClient(o.Timeout),
+		events:     make(chan event, o.QueueSize),
+		roomEvents: make(chan roomkeeper.Event, o.QueueSize),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	if o.AllowPrivateWebhooks {
+		n.webhooks = n.client
+	}
+	go n.loop()
+	return n, nil
+}
+
+func (n *Notifier) Close() {
+	n.cancel()
+	<-n.done
+}
+
+// Kinds returns the target kinds which can be used with the current configuration.
+func (n *Notifier) Kinds() []TargetKind {
+	kinds := []TargetKind{TargetWebhook}
+	if n.mailer != nil {
+		kinds = append(kinds, TargetEmail)
+	}
+	if n.o.Telegram != nil {
+		kinds = append(kinds, TargetTelegram)
+	}
+	return kinds
+}
+
+func (n *Notifier) isKindEnabled(kind TargetKind) bool {
+	for _, k := range n.Kinds() {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *Notifier) AddTarget(ctx context.Context, userID string, contestID *string, kind TargetKind, address string) error {
+	if !n.isKindEnabled(kind) {
+		return fmt.Errorf("notifications of kind %q are not enabled", kind.String())
+	}
+	if err := kind.ValidateAddress(address); err != nil {
+		return fmt.Errorf("bad address: %w", err)
+	}
+	target := Target{
+		ID:        idgen.ID(),
+		ContestID: clone.TrivialPtr(contestID),
+		UserID:    userID,
+		Kind:      kind,
+		Address:   address,
+		CreatedAt: timeutil.NowUTC(),
+	}
+	if err := n.db.CreateNotifyTarget(ctx, target); err != nil {
+		return fmt.Errorf("create target: %w", err)
+	}
+	return nil
+}
+
+func (n *Notifier) GetTarget(ctx context.Context, targetID string) (Target, error) {
+	return n.db.GetNotifyTarget(ctx, targetID)
+}
+
+func (n *Notifier) DeleteTarget(ctx context.Context, targetID string) error {
+	return n.db.DeleteNotifyTarget(ctx, targetID)
+}
+
+func (n *Notifier) ListContestTargets(ctx context.Context, contestID string) ([]Target, error) {
+	targets, err := n.db.ListContestNotifyTargets(ctx, contestID)
+	if err != nil {
+		return nil, fmt.Errorf("list targets: %w", err)
+	}
+	return targets, nil
+}
+
+func (n *Notifier) ListUserTargets(ctx context.Context, userID string) ([]Target, error) {
+	targets, err := n.db.ListUserNotifyTargets(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list targets: %w", err)
+	}
+	return targets, nil
+}
+
+func (n *Notifier) OnContestFinished(info scheduler.ContestInfo, data scheduler.ContestData) {
+	select {
+	case n.events <- event{info: info, data: data}:
+	default:
+		n.log.Warn("notification queue is full, dropping event", slog.String("contest_id", info.ID))
+	}
+}
+
+// viewer returns the viewer for the owner of the target. Blocked and deleted users can see nothing.
+func (n *Notifier) viewer(ctx context.Context, userID string) (scheduler.Viewer, bool, error) {
+	user, err := n.db.GetUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, userauth.ErrUserNotFound) {
+			return scheduler.Viewer{}, false, nil
+		}
+		return scheduler.Viewer{}, false, fmt.Errorf("get user: %w", err)
+	}
+	if user.Perms.IsBlocked {
+		return scheduler.Viewer{}, false, nil
+	}
+	return scheduler.Viewer{UserID: user.ID, Admin: user.Perms.Get(userauth.PermAdmin)}, true, nil
+}
+
+// filterTargets leaves only the targets whose owners may learn about the contest. Contest targets
+// need the contest to be viewable, as its visibility could change after the target was added. Global
+// targets need the contest to be listed, so they don't reveal unlisted and private contests.
+func (n *Notifier) filterTargets(ctx context.Context, info *scheduler.ContestInfo, contestTargets, globalTargets []Target) ([]Target, error) {
+	viewers := make(map[string]scheduler.Viewer)
+	allowed := func(userID string, check func(scheduler.Viewer) bool) (bool, error) {
+		viewer, ok := viewers[userID]
+		if !ok {
+			v, found, err := n.viewer(ctx, userID)
+			if err != nil {
+				return false, err
+			}
+			if !found {
+				return false, nil
+			}
+			viewer = v
+			viewers[userID] = viewer
+		}
+		return check(viewer), nil
+	}
+	var res []Target
+	for _, group := range []struct {
+		targets []Target
+		check   func(scheduler.Viewer) bool
+	}{
+		{contestTargets, func(v scheduler.Viewer) bool { return v.CanView(info) }},
+		{globalTargets, func(v scheduler.Viewer) bool { return v.CanList(info) }},
+	} {
+		for _, target := range group.targets {
+			ok, err := allowed(target.UserID, group.check)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				res = append(res, target)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (n *Notifier) process(ev event) error {
+	ctx, cancel := context.WithTimeout(n.ctx, n.o.Timeout)
+	defer cancel()
+	contestTargets, err := n.db.ListContestNotifyTargets(ctx, ev.info.ID)
+	if err != nil {
+		return fmt.Errorf("list contest targets: %w", err)
+	}
+	globalTargets, err := n.db.ListGlobalNotifyTargets(ctx)
+	if err != nil {
+		return fmt.Errorf("list global targets: %w", err)
+	}
+	targets, err := n.filterTargets(ctx, &ev.info, contestTargets, globalTargets)
+	if err != nil {
+		return fmt.Errorf("filter targets: %w", err)
+	}
+	p := buildPayload(n.o, ev.info, ev.data)
+	for _, target := range targets {
+		if !n.isKindEnabled(target.Kind) {
+			continue
+		}
+		err := func() error {
+			ctx, cancel := context.WithTimeout(n.ctx, n.o.Timeout)
+			defer cancel()
+			return n.send(ctx, target, p)
+		}()
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			n.log.Warn("could not send notification",
+				slog.String("contest_id", ev.info.ID),
+				slog.String("target_id", target.ID),
+				slog.String("kind", target.Kind.String()),
+				slogx.Err(err),
+			)
+			continue
+		}
+		n.log.Info("sent notification",
+			slog.String("contest_id", ev.info.ID),
+			slog.String("target_id", target.ID),
+			slog.String("kind", target.Kind.String()),
+		)
+	}
+	return nil
+}
+
+func (n *Notifier) loop() {
+	defer close(n.done)
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case ev := <-n.events:
+			err := n.process(ev)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				n.log.Warn("could not process notification",
+					slog.String("contest_id", ev.info.ID), slogx.Err(err))
+			}
+		case ev := <-n.roomEvents:
+			err := n.processRoomEvent(ev)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				n.log.Warn("could not process room notification",
+					slog.String("room_id", ev.Room.ID), slogx.Err(err))
+			}
+		}
+	}
+}
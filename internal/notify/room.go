@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+// RoomWebhookOptions is a webhook which receives the room lifecycle events, so the room fleet can be
+// monitored. If Events is empty, all the events are sent.
+type RoomWebhookOptions struct {
+	URL    string   `toml:"url"`
+	Events []string `toml:"events"`
+}
+
+func (o RoomWebhookOptions) Clone() RoomWebhookOptions {
+	o.Events = slices.Clone(o.Events)
+	return o
+}
+
+func (o *RoomWebhookOptions) Validate() error {
+	if err := TargetWebhook.ValidateAddress(o.URL); err != nil {
+		return fmt.Errorf("bad url: %w", err)
+	}
+	for _, e := range o.Events {
+		if _, ok := roomkeeper.EventKindFromString(e); !ok {
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+	return nil
+}
+
+func (o *RoomWebhookOptions) wants(kind roomkeeper.EventKind) bool {
+	return len(o.Events) == 0 || slices.Contains(o.Events, kind.String())
+}
+
+type roomPayload struct {
+	Event         string    `json:"event"`
+	RoomID        string    `json:"room_id"`
+	RoomName      string    `json:"room_name"`
+	ClientVersion string    `json:"client_version,omitempty"`
+	JobID         string    `json:"job_id,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+func buildRoomPayload(ev roomkeeper.Event) *roomPayload {
+	p := &roomPayload{
+		Event:         ev.Kind.String(),
+		RoomID:        ev.Room.ID,
+		RoomName:      ev.Room.Name,
+		ClientVersion: ev.Room.ClientVersion,
+		JobID:         ev.JobID,
+		Time:          ev.Time.UTC(),
+	}
+	if ev.JobID != "" {
+		p.Status = ev.Status.Kind.String()
+		p.Reason = ev.Status.Reason
+	}
+	return p
+}
+
+var _ roomkeeper.Notifier = (*Notifier)(nil)
+
+func (n *Notifier) OnRoomEvent(ev roomkeeper.Event) {
+	if len(n.o.RoomWebhooks) == 0 {
+		return
+	}
+	select {
+	case n.roomEvents <- ev:
+	default:
+		n.log.Warn("notification queue is full, dropping room event",
+			slog.String("room_id", ev.Room.ID),
+			slog.String("event", ev.Kind.String()),
+		)
+	}
+}
+
+func (n *Notifier) processRoomEvent(ev roomkeeper.Event) error {
+	p := buildRoomPayload(ev)
+	for i, hook := range n.o.RoomWebhooks {
+		if !hook.wants(ev.Kind) {
+			continue
+		}
+		err := func() error {
+			ctx, cancel := context.WithTimeout(n.ctx, n.o.Timeout)
+			defer cancel()
+			return postJSON(ctx, n.client, hook.URL, p)
+		}()
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			n.log.Warn("could not send room webhook",
+				slog.String("room_id", ev.Room.ID),
+				slog.String("event", ev.Kind.String()),
+				slog.Int("webhook", i),
+				slogx.Err(err),
+			)
+			continue
+		}
+		n.log.Info("sent room webhook",
+			slog.String("room_id", ev.Room.ID),
+			slog.String("event", ev.Kind.String()),
+			slog.Int("webhook", i),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/alex65536/day20/internal/util/httputil"
+)
+
+func postJSON(ctx context.Context, client *http.Client, url string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal json: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, rsp.Body)
+		_ = rsp.Body.Close()
+	}()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		var b strings.Builder
+		_, _ = io.Copy(&b, io.LimitReader(rsp.Body, 1024))
+		return fmt.Errorf("status: %w", httputil.MakeError(rsp.StatusCode, b.String()))
+	}
+	return nil
+}
+
+func (n *Notifier) sendWebhook(ctx context.Context, url string, p *payload) error {
+	return postJSON(ctx, n.webhooks, url, p)
+}
+
+func (n *Notifier) sendTelegram(ctx context.Context, chatID string, p *payload) error {
+	o := n.o.Telegram
+	if o == nil {
+		return fmt.Errorf("telegram not configured")
+	}
+	url := fmt.Sprintf("%v/bot%v/sendMessage", o.APIURL, o.BotToken)
+	err := postJSON(ctx, n.client, url, struct {
+		ChatID string `json:"chat_id"`
+		Text   string `json:"text"`
+	}{
+		ChatID: chatID,
+		Text:   p.Text(),
+	})
+	if err != nil {
+		// Do not leak the bot token into logs.
+		return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), o.BotToken, "<token>"))
+	}
+	return nil
+}
+
+func (n *Notifier) sendEmail(ctx context.Context, to string, p *payload) error {
+	if n.mailer == nil {
+		return fmt.Errorf("email not configured")
+	}
+	return n.mailer.Send(ctx, to, p.Subject(), p.Text())
+}
+
+func (n *Notifier) send(ctx context.Context, target Target, p *payload) error {
+	switch target.Kind {
+	case TargetWebhook:
+		return n.sendWebhook(ctx, target.Address, p)
+	case TargetEmail:
+		return n.sendEmail(ctx, target.Address, p)
+	case TargetTelegram:
+		return n.sendTelegram(ctx, target.Address, p)
+	default:
+		return fmt.Errorf("unknown target kind")
+	}
+}
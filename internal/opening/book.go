@@ -18,7 +18,11 @@ import (
 var moveNumRegex = regexp.MustCompile(`^[0-9]+\.$`)
 
 type Book interface {
+	// Opening returns a random opening from the book.
 	Opening() *chess.Game
+	// OpeningAt returns the opening selected by the key. The same key always yields the same
+	// opening.
+	OpeningAt(key uint64) *chess.Game
 }
 
 var (
@@ -34,6 +38,10 @@ func (*emptyBook) Opening() *chess.Game {
 	return chess.NewGame()
 }
 
+func (*emptyBook) OpeningAt(uint64) *chess.Game {
+	return chess.NewGame()
+}
+
 func NewEmptyBook() Book {
 	return &emptyBook{}
 }
@@ -48,6 +56,10 @@ func (b *fenBook) Opening() *chess.Game {
 	return chess.NewGameWithPosition(board)
 }
 
+func (b *fenBook) OpeningAt(key uint64) *chess.Game {
+	return chess.NewGameWithPosition(b.boards[key%uint64(len(b.boards))])
+}
+
 func NewFENBook(r io.Reader, source rand.Source) (Book, error) {
 	var boards []*chess.Board
 	br := bufio.NewReader(r)
@@ -90,6 +102,10 @@ func (b *singleBook) Opening() *chess.Game {
 	return b.game.Clone()
 }
 
+func (b *singleBook) OpeningAt(uint64) *chess.Game {
+	return b.game.Clone()
+}
+
 func NewSingleGameBook(game *chess.Game) Book {
 	return &singleBook{game: game.Clone()}
 }
@@ -103,8 +119,82 @@ func (b *pgnLineBook) Opening() *chess.Game {
 	return b.games[b.rnd.IntN(len(b.games))].Clone()
 }
 
-func NewPGNLineBook(r io.Reader, source rand.Source) (Book, error) {
+func (b *pgnLineBook) OpeningAt(key uint64) *chess.Game {
+	return b.games[key%uint64(len(b.games))].Clone()
+}
+
+type PGNLineBookOptions struct {
+	// MaxPlies truncates each line to the given number of plies. Zero means no limit.
+	MaxPlies int
+	// Dedup keeps only the first of the lines which reach the same position.
+	Dedup bool
+}
+
+func (o PGNLineBookOptions) Validate() error {
+	if o.MaxPlies < 0 {
+		return fmt.Errorf("negative max plies")
+	}
+	return nil
+}
+
+// truncatePGNLine leaves only the first plies moves in the line. Zero plies means no limit.
+func truncatePGNLine(ln string, plies int) string {
+	if plies == 0 {
+		return ln
+	}
+	toks := strings.Fields(ln)
+	moveNo := 0
+	for i, tok := range toks {
+		if moveNumRegex.MatchString(tok) {
+			continue
+		}
+		moveNo++
+		if moveNo == plies {
+			return strings.Join(toks[:i+1], " ")
+		}
+	}
+	return ln
+}
+
+func parsePGNLine(ln string) (*chess.Game, error) {
+	g := chess.NewGame()
+	moveNo := 0
+	for _, tok := range strings.Fields(ln) {
+		if moveNumRegex.MatchString(tok) {
+			continue
+		}
+		moveNo++
+		if err := g.PushMoveSAN(tok); err != nil {
+			return nil, fmt.Errorf("parse move %d: %w", moveNo, err)
+		}
+	}
+	return g, nil
+}
+
+// positionKey identifies the position regardless of move counters, so the transpositions have the
+// same key. En passant square is taken into account only if en passant capture is legal.
+func positionKey(g *chess.Game) string {
+	b := g.CurBoard()
+	fields := strings.Fields(b.FEN())[:4]
+	hasEnpassant := false
+	for _, mv := range b.GenLegalMoves(chess.MoveGenCapture, nil) {
+		if mv.Kind() == chess.MoveEnpassant {
+			hasEnpassant = true
+			break
+		}
+	}
+	if !hasEnpassant {
+		fields[3] = "-"
+	}
+	return strings.Join(fields, " ")
+}
+
+func NewPGNLineBook(r io.Reader, source rand.Source, o PGNLineBookOptions) (Book, error) {
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("bad options: %w", err)
+	}
 	var games []*chess.Game
+	seen := make(map[string]struct{})
 	br := bufio.NewReader(r)
 	lineNo := 0
 	for {
@@ -122,16 +212,16 @@ func NewPGNLineBook(r io.Reader, source rand.Source) (Book, error) {
 		if ln == "" || strings.HasPrefix(ln, "#") {
 			continue
 		}
-		g := chess.NewGame()
-		moveNo := 0
-		for _, tok := range strings.Fields(ln) {
-			if moveNumRegex.MatchString(tok) {
+		g, err := parsePGNLine(truncatePGNLine(ln, o.MaxPlies))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if o.Dedup {
+			key := positionKey(g)
+			if _, ok := seen[key]; ok {
 				continue
 			}
-			moveNo++
-			if err := g.PushMoveSAN(tok); err != nil {
-				return nil, fmt.Errorf("line %d: parse move %d: %w", lineNo, moveNo, err)
-			}
+			seen[key] = struct{}{}
 		}
 		games = append(games, g)
 	}
@@ -144,12 +234,28 @@ func NewPGNLineBook(r io.Reader, source rand.Source) (Book, error) {
 	}, nil
 }
 
-func builtinPGNLineBook(s string) Book {
-	b, err := NewPGNLineBook(strings.NewReader(s), randutil.DefaultSource())
+func builtinPGNLineBook(s string) *pgnLineBook {
+	b, err := NewPGNLineBook(strings.NewReader(s), randutil.DefaultSource(), PGNLineBookOptions{})
 	if err != nil {
 		panic(err)
 	}
-	return b
+	return b.(*pgnLineBook)
+}
+
+func (b *pgnLineBook) withOptions(data string, source rand.Source, o PGNLineBookOptions) (Book, error) {
+	if o == (PGNLineBookOptions{}) {
+		return b.withSource(source), nil
+	}
+	// Already parsed lines cannot be truncated, so parse the book again.
+	return NewPGNLineBook(strings.NewReader(data), source, o)
+}
+
+// withSource returns the book with the same openings, but which uses another source of randomness.
+func (b *pgnLineBook) withSource(source rand.Source) Book {
+	return &pgnLineBook{
+		games: b.games,
+		rnd:   rand.New(randutil.NewConcurrentSource(source)),
+	}
 }
 
 //go:embed data/Graham2014-1F.txt
@@ -163,13 +269,23 @@ var (
 	gbSelect2020Book = builtinPGNLineBook(gbSelect2020)
 )
 
+// Graham20141FData returns the source of Graham20141FBook in PGN line format.
+func Graham20141FData() string {
+	return graham20141F
+}
+
+// GBSelect2020Data returns the source of GBSelect2020Book in PGN line format.
+func GBSelect2020Data() string {
+	return gbSelect2020
+}
+
 // Graham2014-1F.cgb opening book by Graham Banks <gbanksnz at gmail.com>.
 // Source URL: https://www.talkchess.com/forum3/viewtopic.php?t=50541#p549216
-func Graham20141FBook() Book {
-	return graham20141FBook
+func Graham20141FBook(source rand.Source, o PGNLineBookOptions) (Book, error) {
+	return graham20141FBook.withOptions(graham20141F, source, o)
 }
 
 // GBSelect2020.pgn opening book by Graham Banks <gbanksnz at gmail.com>.
-func GBSelect2020Book() Book {
-	return gbSelect2020Book
+func GBSelect2020Book(source rand.Source, o PGNLineBookOptions) (Book, error) {
+	return gbSelect2020Book.withOptions(gbSelect2020, source, o)
 }
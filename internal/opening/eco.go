@@ -0,0 +1,93 @@
+package opening
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/alex65536/go-chess/chess"
+)
+
+// ECO is the classification of the opening by the Encyclopaedia of Chess Openings.
+type ECO struct {
+	Code string
+	Name string
+}
+
+type ecoTable struct {
+	byPos    map[string]ECO
+	byCode   map[string]ECO
+	maxPlies int
+}
+
+//go:embed data/eco.txt
+var ecoData string
+
+var ecoTab = mustParseECOTable(ecoData)
+
+func parseECOTable(data string) (*ecoTable, error) {
+	t := &ecoTable{
+		byPos:  make(map[string]ECO),
+		byCode: make(map[string]ECO),
+	}
+	for i, ln := range strings.Split(data, "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		fields := strings.Split(ln, "\t")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected 3 fields, got %d", i+1, len(fields))
+		}
+		eco := ECO{Code: fields[0], Name: fields[1]}
+		g, err := parsePGNLine(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		key := positionKey(g)
+		if _, ok := t.byPos[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate position", i+1)
+		}
+		t.byPos[key] = eco
+		if _, ok := t.byCode[eco.Code]; !ok {
+			t.byCode[eco.Code] = eco
+		}
+		t.maxPlies = max(t.maxPlies, g.Len())
+	}
+	return t, nil
+}
+
+func mustParseECOTable(data string) *ecoTable {
+	t, err := parseECOTable(data)
+	if err != nil {
+		panic(fmt.Sprintf("bad eco table: %v", err))
+	}
+	return t
+}
+
+// ClassifyECO returns the classification of the opening played in the game. The position after
+// each move is looked up, so the transpositions are recognized. The last recognized position wins.
+// If no position is recognized, ok is false.
+func ClassifyECO(g *chess.Game) (eco ECO, ok bool) {
+	board, err := chess.NewBoard(g.StartPos())
+	if err != nil {
+		return ECO{}, false
+	}
+	walk := chess.NewGameWithPosition(board)
+	// Transpositions may take a few more moves than the longest line in the table.
+	limit := min(g.Len(), 2*ecoTab.maxPlies)
+	for i := 0; i < limit; i++ {
+		walk.PushLegalMove(g.MoveAt(i))
+		if e, found := ecoTab.byPos[positionKey(walk)]; found {
+			eco, ok = e, true
+		}
+	}
+	return eco, ok
+}
+
+// ECOByCode returns the main opening with the given ECO code. Many openings share the same code, so
+// the name is the most general one.
+func ECOByCode(code string) (ECO, bool) {
+	eco, ok := ecoTab.byCode[code]
+	return eco, ok
+}
@@ -0,0 +1,46 @@
+package opening
+
+import (
+	"testing"
+
+	"github.com/alex65536/go-chess/chess"
+)
+
+func TestClassifyECO(t *testing.T) {
+	for _, tc := range []struct {
+		moves string
+		code  string
+	}{
+		{"1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 a6 6. h3", "B90"},
+		{"1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Ba4 Nf6 5. O-O Be7 6. Re1 b5 7. Bb3 O-O 8. c3 d5 9. exd5", "C89"},
+		// Grunfeld Defense reached by transposition.
+		{"1. Nf3 Nf6 2. c4 g6 3. Nc3 d5 4. d4", "D90"},
+		{"1. d4 Nf6 2. c4 e6 3. Nc3 Bb4 4. e3 O-O 5. Bd3 d5 6. Nf3 c5 7. O-O Nc6 8. a3 Bxc3 9. bxc3", "E48"},
+		{"1. g4 d5 2. h3 e5", "A00"},
+	} {
+		g, err := parsePGNLine(tc.moves)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.moves, err)
+		}
+		eco, ok := ClassifyECO(g)
+		if !ok {
+			t.Fatalf("classify %q: not classified", tc.moves)
+		}
+		if eco.Code != tc.code {
+			t.Fatalf("classify %q: expected = %v, got = %v (%v)", tc.moves, tc.code, eco.Code, eco.Name)
+		}
+	}
+}
+
+func TestClassifyECOUnknown(t *testing.T) {
+	g, err := chess.NewGameWithFEN("4k3/8/8/8/8/8/4P3/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("parse fen: %v", err)
+	}
+	if err := g.PushMoveSAN("e4"); err != nil {
+		t.Fatalf("push move: %v", err)
+	}
+	if eco, ok := ClassifyECO(g); ok {
+		t.Fatalf("unexpected classification: %v", eco)
+	}
+}
@@ -0,0 +1,50 @@
+package opening
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alex65536/go-chess/chess"
+)
+
+// EPDToFEN converts the book in EPD format into the book in FEN format. Move counters are taken from
+// "hmvc" and "fmvn" opcodes if present, other opcodes are ignored. Empty lines and comments are
+// removed.
+func EPDToFEN(src string) (string, error) {
+	var b strings.Builder
+	for lineNo, ln := range strings.Split(src, "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		fields := strings.Fields(ln)
+		if len(fields) < 4 {
+			return "", fmt.Errorf("line %d: expected at least 4 fields", lineNo+1)
+		}
+		hmvc, fmvn := "0", "1"
+		for _, op := range strings.Split(strings.Join(fields[4:], " "), ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(op), " ")
+			value = strings.TrimSpace(value)
+			switch name {
+			case "hmvc":
+				if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+					return "", fmt.Errorf("line %d: bad hmvc: %w", lineNo+1, err)
+				}
+				hmvc = value
+			case "fmvn":
+				if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+					return "", fmt.Errorf("line %d: bad fmvn: %w", lineNo+1, err)
+				}
+				fmvn = value
+			}
+		}
+		fen := strings.Join(append(fields[:4:4], hmvc, fmvn), " ")
+		if _, err := chess.BoardFromFEN(fen); err != nil {
+			return "", fmt.Errorf("line %d: parse board: %w", lineNo+1, err)
+		}
+		_, _ = b.WriteString(fen)
+		_ = b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,195 @@
+package opening
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/uci"
+	"golang.org/x/sync/errgroup"
+)
+
+type Format int
+
+const (
+	FormatFEN Format = iota
+	FormatPGNLine
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatFEN:
+		return "fen"
+	case FormatPGNLine:
+		return "pgn_line"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// Evaluator runs a quick engine search to estimate the position.
+type Evaluator interface {
+	// Evaluate returns the score of the current position in the game from the perspective of the
+	// side to move.
+	Evaluate(ctx context.Context, game *chess.Game) (uci.Score, error)
+}
+
+// EvalWindow is the range of scores (in centipawns, from White's perspective) which are considered
+// balanced. Both bounds are inclusive.
+type EvalWindow struct {
+	Min int32
+	Max int32
+}
+
+// EvalWindowFromString parses the window in "MIN:MAX" format, e.g. "-50:50".
+func EvalWindowFromString(s string) (EvalWindow, error) {
+	lo, hi, ok := strings.Cut(s, ":")
+	if !ok {
+		return EvalWindow{}, fmt.Errorf("expected MIN:MAX, got %q", s)
+	}
+	minV, err := strconv.ParseInt(lo, 10, 32)
+	if err != nil {
+		return EvalWindow{}, fmt.Errorf("bad min: %w", err)
+	}
+	maxV, err := strconv.ParseInt(hi, 10, 32)
+	if err != nil {
+		return EvalWindow{}, fmt.Errorf("bad max: %w", err)
+	}
+	w := EvalWindow{Min: int32(minV), Max: int32(maxV)}
+	if err := w.Validate(); err != nil {
+		return EvalWindow{}, err
+	}
+	return w, nil
+}
+
+func (w EvalWindow) Validate() error {
+	if w.Min > w.Max {
+		return fmt.Errorf("min %v is greater than max %v", w.Min, w.Max)
+	}
+	return nil
+}
+
+func (w EvalWindow) String() string {
+	return fmt.Sprintf("%v:%v", w.Min, w.Max)
+}
+
+// Contains checks whether the score from the perspective of the given side fits into the window.
+// Mate scores never fit.
+func (w EvalWindow) Contains(score uci.Score, side chess.Color) bool {
+	cp, ok := score.Centipawns()
+	if !ok {
+		return false
+	}
+	if side == chess.ColorBlack {
+		cp = -cp
+	}
+	return w.Min <= cp && cp <= w.Max
+}
+
+type FilterOptions struct {
+	Window EvalWindow
+	// Jobs is the number of positions evaluated simultaneously. Zero means one.
+	Jobs int
+	// Lines are applied to the books in PGN line format before evaluation, so the truncated lines
+	// are evaluated and written.
+	Lines PGNLineBookOptions
+}
+
+type FilterStats struct {
+	Kept    int
+	Dropped int
+}
+
+// Filter evaluates each position in the book source with the evaluator and returns the source
+// containing only the positions whose score fits into the window. Empty lines and comments are
+// removed.
+func Filter(
+	ctx context.Context,
+	format Format,
+	src string,
+	ev Evaluator,
+	o FilterOptions,
+) (string, FilterStats, error) {
+	if err := o.Window.Validate(); err != nil {
+		return "", FilterStats{}, fmt.Errorf("bad window: %w", err)
+	}
+	if err := o.Lines.Validate(); err != nil {
+		return "", FilterStats{}, fmt.Errorf("bad line options: %w", err)
+	}
+
+	type entry struct {
+		line string
+		game *chess.Game
+		keep bool
+	}
+	var entries []*entry
+	seen := make(map[string]struct{})
+	for lineNo, ln := range strings.Split(src, "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "#") {
+			continue
+		}
+		var game *chess.Game
+		switch format {
+		case FormatFEN:
+			b, err := chess.BoardFromFEN(ln)
+			if err != nil {
+				return "", FilterStats{}, fmt.Errorf("line %d: parse board: %w", lineNo+1, err)
+			}
+			game = chess.NewGameWithPosition(b)
+		case FormatPGNLine:
+			ln = truncatePGNLine(ln, o.Lines.MaxPlies)
+			var err error
+			game, err = parsePGNLine(ln)
+			if err != nil {
+				return "", FilterStats{}, fmt.Errorf("line %d: %w", lineNo+1, err)
+			}
+			if o.Lines.Dedup {
+				key := positionKey(game)
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+		default:
+			return "", FilterStats{}, fmt.Errorf("bad format %v", format)
+		}
+		entries = append(entries, &entry{line: ln, game: game})
+	}
+
+	eg, gctx := errgroup.WithContext(ctx)
+	eg.SetLimit(max(o.Jobs, 1))
+	for _, e := range entries {
+		eg.Go(func() error {
+			score, err := ev.Evaluate(gctx, e.game)
+			if err != nil {
+				return fmt.Errorf("evaluate %q: %w", e.line, err)
+			}
+			e.keep = o.Window.Contains(score, e.game.CurBoard().Side())
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return "", FilterStats{}, err
+	}
+
+	var (
+		b     strings.Builder
+		stats FilterStats
+	)
+	for _, e := range entries {
+		if !e.keep {
+			stats.Dropped++
+			continue
+		}
+		stats.Kept++
+		_, _ = b.WriteString(e.line)
+		_ = b.WriteByte('\n')
+	}
+	if stats.Kept == 0 {
+		return "", stats, fmt.Errorf("all %v positions are outside the window", stats.Dropped)
+	}
+	return b.String(), stats, nil
+}
@@ -0,0 +1,117 @@
+package rater
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+const (
+	// Each pair of engines that met gets this many virtual draws, so ratings stay finite even for
+	// engines that won or lost all their games.
+	priorDraws = 1.0
+
+	maxIterations = 10000
+	precision     = 1e-9
+	eloScale      = 400.0 / math.Ln10
+	errorZ        = 1.96
+)
+
+func logistic(x float64) float64 {
+	return 1.0 / (1.0 + math.Exp(-x))
+}
+
+// ComputeRatings finds maximum likelihood ratings in Bradley-Terry model, with draws counted as half
+// a win. Average rating is zero. Error is the half-width of 95% confidence interval.
+func ComputeRatings(pairs []PairResult, now timeutil.UTCTime) []Rating {
+	idx := make(map[string]int)
+	var ratings []Rating
+	engine := func(name string) int {
+		if i, ok := idx[name]; ok {
+			return i
+		}
+		idx[name] = len(ratings)
+		ratings = append(ratings, Rating{Engine: name, UpdatedAt: now})
+		return len(ratings) - 1
+	}
+
+	type edge struct {
+		a, b  int
+		games float64
+		score float64
+	}
+	edges := make([]edge, 0, len(pairs))
+	for _, p := range pairs {
+		if p.Total() == 0 || p.First == p.Second {
+			continue
+		}
+		a, b := engine(p.First), engine(p.Second)
+		ratings[a].Win += p.Win
+		ratings[a].Draw += p.Draw
+		ratings[a].Lose += p.Lose
+		ratings[b].Win += p.Lose
+		ratings[b].Draw += p.Draw
+		ratings[b].Lose += p.Win
+		edges = append(edges, edge{
+			a:     a,
+			b:     b,
+			games: float64(p.Total()) + priorDraws,
+			score: float64(p.Win) + 0.5*float64(p.Draw) + 0.5*priorDraws,
+		})
+	}
+	if len(ratings) == 0 {
+		return nil
+	}
+
+	adj := make([][]edge, len(ratings))
+	for _, e := range edges {
+		adj[e.a] = append(adj[e.a], e)
+		adj[e.b] = append(adj[e.b], edge{a: e.b, b: e.a, games: e.games, score: e.games - e.score})
+	}
+
+	x := make([]float64, len(ratings))
+	hess := make([]float64, len(ratings))
+	for range maxIterations {
+		maxDelta := 0.0
+		for i := range x {
+			grad, h := 0.0, 0.0
+			for _, e := range adj[i] {
+				p := logistic(x[i] - x[e.b])
+				grad += e.score - e.games*p
+				h += e.games * p * (1 - p)
+			}
+			hess[i] = h
+			if h == 0 {
+				continue
+			}
+			delta := grad / h
+			x[i] += delta
+			maxDelta = max(maxDelta, math.Abs(delta))
+		}
+		if maxDelta < precision {
+			break
+		}
+	}
+
+	mean := 0.0
+	for _, v := range x {
+		mean += v
+	}
+	mean /= float64(len(x))
+	for i := range ratings {
+		ratings[i].Elo = (x[i] - mean) * eloScale
+		if hess[i] > 0 {
+			ratings[i].Error = errorZ * eloScale / math.Sqrt(hess[i])
+		}
+	}
+
+	slices.SortFunc(ratings, func(a, b Rating) int {
+		if c := cmp.Compare(b.Elo, a.Elo); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Engine, b.Engine)
+	})
+	return ratings
+}
@@ -0,0 +1,113 @@
+package rater
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+func findRating(t *testing.T, ratings []Rating, engine string) Rating {
+	t.Helper()
+	for _, r := range ratings {
+		if r.Engine == engine {
+			return r
+		}
+	}
+	t.Fatalf("no rating for %q", engine)
+	return Rating{}
+}
+
+func TestComputeRatingsEmpty(t *testing.T) {
+	now := timeutil.NowUTC()
+	if got := ComputeRatings(nil, now); got != nil {
+		t.Fatalf("bad ratings: expected = nil, got = %v", got)
+	}
+	// Empty pairs and games against itself are ignored.
+	pairs := []PairResult{
+		{First: "a", Second: "b"},
+		{First: "c", Second: "c", Win: 3},
+	}
+	if got := ComputeRatings(pairs, now); got != nil {
+		t.Fatalf("bad ratings: expected = nil, got = %v", got)
+	}
+}
+
+func TestComputeRatingsTwoEngines(t *testing.T) {
+	ratings := ComputeRatings([]PairResult{{First: "a", Second: "b", Win: 30, Draw: 4, Lose: 6}}, timeutil.NowUTC())
+	if len(ratings) != 2 {
+		t.Fatalf("bad number of ratings: expected = 2, got = %v", len(ratings))
+	}
+	a, b := ratings[0], ratings[1]
+	if a.Engine != "a" || b.Engine != "b" {
+		t.Fatalf("bad order: %v, %v", a.Engine, b.Engine)
+	}
+
+	// With two engines, the maximum likelihood estimate is the logit of the score rate, including
+	// the prior draw.
+	score := (30 + 0.5*4 + 0.5*priorDraws) / (40 + priorDraws)
+	expected := eloScale * math.Log(score/(1-score))
+	if got := a.Elo - b.Elo; math.Abs(got-expected) > 1e-6 {
+		t.Fatalf("bad rating difference: expected = %v, got = %v", expected, got)
+	}
+	if got := a.Elo + b.Elo; math.Abs(got) > 1e-6 {
+		t.Fatalf("bad average rating: expected = 0, got = %v", got/2)
+	}
+	if a.Error <= 0 || math.Abs(a.Error-b.Error) > 1e-6 {
+		t.Fatalf("bad errors: %v, %v", a.Error, b.Error)
+	}
+
+	if a.Win != 30 || a.Draw != 4 || a.Lose != 6 {
+		t.Fatalf("bad results for a: %+v", a)
+	}
+	if b.Win != 6 || b.Draw != 4 || b.Lose != 30 {
+		t.Fatalf("bad results for b: %+v", b)
+	}
+}
+
+func TestComputeRatingsAllWins(t *testing.T) {
+	ratings := ComputeRatings([]PairResult{{First: "a", Second: "b", Win: 10}}, timeutil.NowUTC())
+	for _, r := range ratings {
+		if math.IsInf(r.Elo, 0) || math.IsNaN(r.Elo) || math.IsInf(r.Error, 0) || math.IsNaN(r.Error) {
+			t.Fatalf("rating is not finite: %+v", r)
+		}
+	}
+	if ratings[0].Engine != "a" || ratings[0].Elo <= 0 {
+		t.Fatalf("bad leader: %+v", ratings[0])
+	}
+}
+
+func TestComputeRatingsTransitive(t *testing.T) {
+	// Engines "a" and "c" never met, but "a" is stronger than "b" and "b" is stronger than "c".
+	pairs := []PairResult{
+		{First: "a", Second: "b", Win: 20, Draw: 10, Lose: 10},
+		{First: "b", Second: "c", Win: 20, Draw: 10, Lose: 10},
+		{First: "c", Second: "d", Win: 10, Draw: 20, Lose: 10},
+	}
+	ratings := ComputeRatings(pairs, timeutil.NowUTC())
+	if len(ratings) != 4 {
+		t.Fatalf("bad number of ratings: expected = 4, got = %v", len(ratings))
+	}
+	if ratings[0].Engine != "a" || ratings[1].Engine != "b" {
+		t.Fatalf("bad order: %v", ratings)
+	}
+	// Equal ratings are sorted by name.
+	c, d := findRating(t, ratings, "c"), findRating(t, ratings, "d")
+	if math.Abs(c.Elo-d.Elo) > 1e-6 {
+		t.Fatalf("bad ratings for equal engines: %v, %v", c.Elo, d.Elo)
+	}
+	if ratings[2].Engine != "c" || ratings[3].Engine != "d" {
+		t.Fatalf("bad order: %v", ratings)
+	}
+	// The engine with more games has smaller error.
+	if b := findRating(t, ratings, "b"); b.Error >= ratings[0].Error {
+		t.Fatalf("bad errors: a = %v, b = %v", ratings[0].Error, b.Error)
+	}
+	sum := 0.0
+	for _, r := range ratings {
+		sum += r.Elo
+	}
+	if math.Abs(sum) > 1e-6 {
+		t.Fatalf("bad average rating: expected = 0, got = %v", sum/4)
+	}
+}
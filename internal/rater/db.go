@@ -0,0 +1,17 @@
+package rater
+
+import (
+	"context"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+type DB interface {
+	ListContestsToRate(ctx context.Context) ([]scheduler.ContestFullData, error)
+	ListContestSucceededJobs(ctx context.Context, contestID string) ([]scheduler.FinishedJob, error)
+	AddRatedContest(ctx context.Context, contestID string, results []PairResult, now timeutil.UTCTime) error
+	ListPairResults(ctx context.Context) ([]PairResult, error)
+	ReplaceRatings(ctx context.Context, ratings []Rating) error
+	ListRatings(ctx context.Context) ([]Rating, error)
+}
@@ -0,0 +1,45 @@
+package rater
+
+import (
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+// PairResult holds aggregated results between two engines. First is always lexicographically less
+// than Second, and Win/Lose are from the point of view of First.
+type PairResult struct {
+	First  string `gorm:"primaryKey"`
+	Second string `gorm:"primaryKey"`
+	Win    int64
+	Draw   int64
+	Lose   int64
+}
+
+func (r PairResult) Total() int64 {
+	return r.Win + r.Draw + r.Lose
+}
+
+type RatedContest struct {
+	ContestID string `gorm:"primaryKey"`
+	RatedAt   timeutil.UTCTime
+}
+
+type Rating struct {
+	Engine    string `gorm:"primaryKey"`
+	Elo       float64
+	Error     float64
+	Win       int64
+	Draw      int64
+	Lose      int64
+	UpdatedAt timeutil.UTCTime
+}
+
+func (r Rating) Games() int64 {
+	return r.Win + r.Draw + r.Lose
+}
+
+func (r Rating) ScoreRate() float64 {
+	if r.Games() == 0 {
+		return 0
+	}
+	return float64(2*r.Win+r.Draw) / float64(2*r.Games())
+}
@@ -0,0 +1,186 @@
+package rater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+	"github.com/alex65536/go-chess/chess"
+)
+
+type Options struct {
+	Interval time.Duration `toml:"interval"`
+}
+
+func (o Options) Clone() Options {
+	return o
+}
+
+func (o *Options) FillDefaults() {
+	if o.Interval == 0 {
+		o.Interval = 1 * time.Minute
+	}
+}
+
+type Rater struct {
+	o        *Options
+	db       DB
+	log      *slog.Logger
+	ctx      context.Context
+	cancel   func()
+	done     chan struct{}
+	computed bool
+}
+
+func New(log *slog.Logger, db DB, o Options) *Rater {
+	o = o.Clone()
+	o.FillDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Rater{
+		o:      &o,
+		db:     db,
+		log:    log,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+func (r *Rater) Close() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *Rater) List(ctx context.Context) ([]Rating, error) {
+	ratings, err := r.db.ListRatings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list ratings: %w", err)
+	}
+	return ratings, nil
+}
+
+func buildPairResults(jobs []scheduler.FinishedJob) []PairResult {
+	type key struct{ first, second string }
+	res := make(map[key]*PairResult)
+	var order []key
+	for _, job := range jobs {
+		if job.Status.Kind != roomkeeper.JobSucceeded {
+			continue
+		}
+		first, second := job.Job.White.Name, job.Job.Black.Name
+		if first == second {
+			continue
+		}
+		swapped := first > second
+		if swapped {
+			first, second = second, first
+		}
+		k := key{first: first, second: second}
+		p, ok := res[k]
+		if !ok {
+			p = &PairResult{First: first, Second: second}
+			res[k] = p
+			order = append(order, k)
+		}
+		switch job.GameResult {
+		case chess.StatusWhiteWins:
+			if swapped {
+				p.Lose++
+			} else {
+				p.Win++
+			}
+		case chess.StatusBlackWins:
+			if swapped {
+				p.Win++
+			} else {
+				p.Lose++
+			}
+		case chess.StatusDraw:
+			p.Draw++
+		}
+	}
+	pairs := make([]PairResult, 0, len(order))
+	for _, k := range order {
+		pairs = append(pairs, *res[k])
+	}
+	return pairs
+}
+
+func (r *Rater) ingest(ctx context.Context, contestID string) error {
+	jobs, err := r.db.ListContestSucceededJobs(ctx, contestID)
+	if err != nil {
+		return fmt.Errorf("list jobs: %w", err)
+	}
+	if err := r.db.AddRatedContest(ctx, contestID, buildPairResults(jobs), timeutil.NowUTC()); err != nil {
+		return fmt.Errorf("add results: %w", err)
+	}
+	return nil
+}
+
+func (r *Rater) recompute(ctx context.Context) error {
+	pairs, err := r.db.ListPairResults(ctx)
+	if err != nil {
+		return fmt.Errorf("list pair results: %w", err)
+	}
+	if err := r.db.ReplaceRatings(ctx, ComputeRatings(pairs, timeutil.NowUTC())); err != nil {
+		return fmt.Errorf("save ratings: %w", err)
+	}
+	return nil
+}
+
+func (r *Rater) RunOnce(ctx context.Context) error {
+	contests, err := r.db.ListContestsToRate(ctx)
+	if err != nil {
+		return fmt.Errorf("list contests: %w", err)
+	}
+	changed := false
+	for _, c := range contests {
+		contestID := c.Info.ID
+		if err := r.ingest(ctx, contestID); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			r.log.Warn("could not rate contest", slog.String("contest_id", contestID), slogx.Err(err))
+			continue
+		}
+		r.log.Info("rated contest", slog.String("contest_id", contestID))
+		changed = true
+	}
+	if changed || !r.computed {
+		if err := r.recompute(ctx); err != nil {
+			return fmt.Errorf("recompute: %w", err)
+		}
+		r.computed = true
+	}
+	return nil
+}
+
+func (r *Rater) loop() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.o.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		default:
+			err := r.RunOnce(r.ctx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				r.log.Warn("could not update ratings", slogx.Err(err))
+			}
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
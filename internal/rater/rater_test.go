@@ -0,0 +1,46 @@
+package rater
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alex65536/go-chess/chess"
+
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+)
+
+func testJob(white, black string, result chess.Status, status roomkeeper.JobStatus) scheduler.FinishedJob {
+	return scheduler.FinishedJob{
+		JobInfo: scheduler.JobInfo{
+			Job: roomapi.Job{
+				White: roomapi.JobEngine{Name: white},
+				Black: roomapi.JobEngine{Name: black},
+			},
+		},
+		Status:     status,
+		GameResult: result,
+	}
+}
+
+func TestBuildPairResults(t *testing.T) {
+	ok := roomkeeper.NewStatusSucceeded()
+	jobs := []scheduler.FinishedJob{
+		testJob("b", "a", chess.StatusWhiteWins, ok),
+		testJob("a", "b", chess.StatusWhiteWins, ok),
+		testJob("a", "b", chess.StatusDraw, ok),
+		testJob("b", "a", chess.StatusBlackWins, ok),
+		testJob("a", "c", chess.StatusBlackWins, ok),
+		// Games against itself and unsuccessful jobs are ignored.
+		testJob("a", "a", chess.StatusWhiteWins, ok),
+		testJob("a", "c", chess.StatusWhiteWins, roomkeeper.JobStatus{Kind: roomkeeper.JobAborted}),
+	}
+	expected := []PairResult{
+		{First: "a", Second: "b", Win: 2, Draw: 1, Lose: 1},
+		{First: "a", Second: "c", Lose: 1},
+	}
+	if got := buildPairResults(jobs); !slices.Equal(got, expected) {
+		t.Fatalf("bad pairs: expected = %+v, got = %+v", expected, got)
+	}
+}
@@ -0,0 +1,80 @@
+package room
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/enginemap"
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/uci"
+	"github.com/alex65536/go-chess/util/maybe"
+)
+
+// measureNPS searches the start position with the engine for the duration requested by the server
+// and returns the speed of the engine in nodes per second.
+func measureNPS(ctx context.Context, log *slog.Logger, mp enginemap.Map, b *roomapi.Benchmark, timeout time.Duration) (int64, error) {
+	opts, err := mp.GetOptions(b.Engine)
+	if err != nil {
+		return 0, fmt.Errorf("get engine options: %w", err)
+	}
+	opts.Prewarm = 0
+	pool, err := battle.NewEnginePool(ctx, log, opts)
+	if err != nil {
+		return 0, fmt.Errorf("start engine: %w", err)
+	}
+	defer pool.Close()
+	e, err := pool.AcquireEngine(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("acquire engine: %w", err)
+	}
+	defer pool.ReleaseEngine(e)
+
+	ctx, cancel := context.WithTimeout(ctx, b.Duration+timeout)
+	defer cancel()
+	if err := e.UCINewGame(ctx, true); err != nil {
+		return 0, fmt.Errorf("ucinewgame: %w", err)
+	}
+	if err := e.SetPosition(ctx, chess.NewGame()); err != nil {
+		return 0, fmt.Errorf("set position: %w", err)
+	}
+	start := time.Now()
+	search, err := e.Go(ctx, uci.GoOptions{Movetime: maybe.Some(b.Duration)}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("go: %w", err)
+	}
+	if err := search.Wait(ctx); err != nil {
+		return 0, fmt.Errorf("wait: %w", err)
+	}
+	elapsed := time.Since(start)
+	status := search.Status()
+	if status.NPS > 0 {
+		return status.NPS, nil
+	}
+	if status.Nodes <= 0 || elapsed <= 0 {
+		return 0, fmt.Errorf("engine reported no nodes")
+	}
+	return int64(float64(status.Nodes) / elapsed.Seconds()), nil
+}
+
+// benchmark measures the speed of the room and reports it to the server. Failures are not fatal,
+// as the server then scales the time controls as for the slowest room.
+func (r *room) benchmark(ctx context.Context, log *slog.Logger) {
+	log.Info("running benchmark", slog.String("engine", r.bench.Engine.Name), slog.Duration("duration", r.bench.Duration))
+	req := &roomapi.BenchmarkRequest{RoomID: r.roomID}
+	nps, err := measureNPS(ctx, log, r.cfg.EngineMap, r.bench, r.o.RequestTimeout)
+	if err != nil {
+		log.Warn("benchmark failed", slogx.Err(err))
+		req.Error = err.Error()
+	} else {
+		log.Info("benchmark finished", slog.Int64("nps", nps))
+		req.NPS = nps
+	}
+	if _, err := requestWithTimeout(ctx, r.o.RequestTimeout, r.client.Benchmark, req); err != nil {
+		log.Warn("error reporting benchmark", slogx.Err(err))
+	}
+}
@@ -0,0 +1,81 @@
+package room
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/alex65536/day20/internal/delta"
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type clockSync struct {
+	client roomapi.API
+	o      *Options
+	roomID string
+	log    *slog.Logger
+	offset atomic.Pointer[time.Duration]
+}
+
+func newClockSync(client roomapi.API, o *Options, roomID string, log *slog.Logger) *clockSync {
+	return &clockSync{
+		client: client,
+		o:      o,
+		roomID: roomID,
+		log:    log,
+	}
+}
+
+// Offset returns the estimated difference between the server clock and ours, or nil if it is unknown.
+func (c *clockSync) Offset() *time.Duration {
+	return c.offset.Load()
+}
+
+func (c *clockSync) Sync(ctx context.Context) {
+	samples := make([]delta.ClockSample, 0, c.o.ClockSyncSamples)
+	for range c.o.ClockSyncSamples {
+		sent := delta.NowTimestamp()
+		rsp, err := requestWithTimeout(ctx, c.o.RequestTimeout, c.client.TimeSync, &roomapi.TimeSyncRequest{
+			RoomID: c.roomID,
+		})
+		if err != nil {
+			c.log.Info("error synchronizing clock", slogx.Err(err))
+			break
+		}
+		samples = append(samples, delta.ClockSample{
+			Sent:     sent,
+			Received: delta.NowTimestamp(),
+			Remote:   rsp.Timestamp,
+		})
+	}
+	offset, rtt, ok := delta.EstimateClockOffset(samples)
+	if !ok {
+		return
+	}
+	if old := c.offset.Load(); old == nil || (*old-offset).Abs() > time.Millisecond {
+		c.log.Info("clock synchronized",
+			slog.Duration("offset", offset),
+			slog.Duration("rtt", rtt),
+			slog.Int("samples", len(samples)),
+		)
+	}
+	c.offset.Store(&offset)
+}
+
+func (c *clockSync) Loop(ctx context.Context) {
+	if c.o.ClockSyncInterval < 0 {
+		return
+	}
+	ticker := time.NewTicker(c.o.ClockSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Sync(ctx)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	"reflect"
+	"runtime"
 	"slices"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/alex65536/day20/internal/roomapi"
 	"github.com/alex65536/day20/internal/util/backoff"
 	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/version"
 	"github.com/alex65536/go-chess/chess"
 	"github.com/alex65536/go-chess/util/maybe"
 )
@@ -29,6 +31,17 @@ type Options struct {
 	Watcher         delta.WatcherOptions
 	PingInterval    time.Duration
 	RoomFailBackoff backoff.Options
+	// ClockSyncInterval is the interval between clock synchronizations with the server. Negative value
+	// means that the clock is synchronized only once, when the room starts.
+	ClockSyncInterval time.Duration
+	// ClockSyncSamples is the number of exchanges made during each clock synchronization.
+	ClockSyncSamples int
+	// Hardware is reported to the server, so it can avoid assigning too heavy jobs to the room. If
+	// Cores is zero, the number of CPUs is reported.
+	Hardware roomapi.Hardware
+	// KeepaliveInterval is the interval between pings which tell the server that the room is alive,
+	// even if it is idle. Negative value disables the pings.
+	KeepaliveInterval time.Duration
 }
 
 type Config struct {
@@ -51,6 +64,18 @@ func (o *Options) FillDefaults() {
 		o.PingInterval = 3 * time.Second
 	}
 	o.RoomFailBackoff.FillDefaults()
+	if o.ClockSyncInterval == 0 {
+		o.ClockSyncInterval = 1 * time.Minute
+	}
+	if o.ClockSyncSamples <= 0 {
+		o.ClockSyncSamples = 5
+	}
+	if o.Hardware.Cores == 0 {
+		o.Hardware.Cores = runtime.NumCPU()
+	}
+	if o.KeepaliveInterval == 0 {
+		o.KeepaliveInterval = 15 * time.Second
+	}
 }
 
 func requestWithTimeout[Req, Rsp any](
@@ -95,6 +120,7 @@ type job struct {
 	log    *slog.Logger
 	mp     enginemap.Map
 	seq    *sequencer
+	clock  *clockSync
 }
 
 func newJob(
@@ -105,6 +131,7 @@ func newJob(
 	roomID string,
 	log *slog.Logger,
 	seq *sequencer,
+	clock *clockSync,
 ) *job {
 	return &job{
 		client: client,
@@ -114,6 +141,7 @@ func newJob(
 		log:    log.With(slog.String("job_id", desc.ID)),
 		mp:     cfg.EngineMap,
 		seq:    seq,
+		clock:  clock,
 	}
 }
 
@@ -160,6 +188,9 @@ func (j *job) makeBattle(ctx context.Context) (*battle.Battle, error) {
 	if j.desc.TimeMargin != nil {
 		opts.DeadlineMargin = maybe.Some(*j.desc.TimeMargin)
 	}
+	if j.desc.MoveOverhead != nil {
+		opts.MoveOverhead = *j.desc.MoveOverhead
+	}
 	if j.desc.FixedTime != nil {
 		opts.FixedTime = maybe.Some(*j.desc.FixedTime)
 	}
@@ -240,12 +271,13 @@ func (j *job) watchUpdates(ctx context.Context, watcher *delta.Watcher, upd <-ch
 					}
 					if err := j.update(ctx, &roomapi.UpdateRequest{
 						// SeqIndex is filled later.
-						RoomID:    j.roomID,
-						JobID:     j.desc.ID,
-						From:      cursor,
-						Delta:     dd,
-						Timestamp: delta.NowTimestamp(),
-						Status:    status,
+						RoomID:      j.roomID,
+						JobID:       j.desc.ID,
+						From:        cursor,
+						Delta:       dd,
+						Timestamp:   delta.NowTimestamp(),
+						Status:      status,
+						ClockOffset: j.clock.Offset(),
 					}); err != nil {
 						if roomapi.MatchesError(err, roomapi.ErrNeedsResync) && cursor != emptyCursor {
 							cursor = emptyCursor
@@ -359,6 +391,8 @@ type room struct {
 	o      *Options
 	cfg    *Config
 	roomID string
+	// bench is the benchmark requested by the server, or nil if none.
+	bench *roomapi.Benchmark
 }
 
 func (r *room) Do(ctx context.Context, log *slog.Logger) error {
@@ -374,6 +408,13 @@ func (r *room) Do(ctx context.Context, log *slog.Logger) error {
 		return fmt.Errorf("create backoff: %w", err)
 	}
 	seq := newSequencer()
+	clock := newClockSync(r.client, r.o, r.roomID, log)
+	clock.Sync(ctx)
+	go clock.Loop(ctx)
+	go r.keepalive(ctx, log, r.roomID)
+	if r.bench != nil {
+		r.benchmark(ctx, log)
+	}
 	for {
 		rsp, err := func() (*roomapi.JobResponse, error) {
 			rsp, err := requestWithTimeout(
@@ -414,7 +455,7 @@ func (r *room) Do(ctx context.Context, log *slog.Logger) error {
 		backoff.Reset()
 
 		if err := func() error {
-			job := newJob(r.client, r.o, r.cfg, &rsp.Job, r.roomID, log, &seq)
+			job := newJob(r.client, r.o, r.cfg, &rsp.Job, r.roomID, log, &seq, clock)
 			if err := job.Do(ctx); err != nil {
 				return fmt.Errorf("do job: %w", err)
 			}
@@ -434,6 +475,28 @@ func (r *room) Do(ctx context.Context, log *slog.Logger) error {
 	}
 }
 
+// keepalive takes roomID explicitly, as r.roomID is reset by the main loop when the room expires.
+func (r *room) keepalive(ctx context.Context, log *slog.Logger, roomID string) {
+	if r.o.KeepaliveInterval < 0 {
+		return
+	}
+	ticker := time.NewTicker(r.o.KeepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Errors are not fatal here, the main loop learns about the expired room by itself.
+			if _, err := requestWithTimeout(ctx, r.o.RequestTimeout, r.client.Ping, &roomapi.PingRequest{
+				RoomID: roomID,
+			}); err != nil && ctx.Err() == nil {
+				log.Info("error pinging server", slogx.Err(err))
+			}
+		}
+	}
+}
+
 func (r *room) bye(log *slog.Logger) {
 	if r.roomID == "" {
 		return
@@ -478,6 +541,8 @@ func Loop(ctx context.Context, log *slog.Logger, o Options, cfg Config) error {
 			client.Hello,
 			&roomapi.HelloRequest{
 				SupportedProtoVersions: []int32{roomapi.ProtoVersion},
+				ClientVersion:          version.Version,
+				Hardware:               &o.Hardware,
 			},
 		)
 		if err != nil {
@@ -495,6 +560,7 @@ func Loop(ctx context.Context, log *slog.Logger, o Options, cfg Config) error {
 			o:      &o,
 			cfg:    &cfg,
 			roomID: rsp.RoomID,
+			bench:  rsp.Benchmark,
 		}
 		if err := r.Do(ctx, log); err != nil {
 			select {
@@ -30,6 +30,7 @@ const (
 	ErrLocked
 	ErrTemporarilyUnavailable
 	ErrOutOfSequence
+	ErrClientOutdated
 )
 
 func MatchesError(err error, code ErrorCode) bool {
@@ -76,6 +77,9 @@ type UpdateRequest struct {
 	Timestamp delta.Timestamp `json:"ts"`
 	Status    UpdateStatus    `json:"status,omitempty"`
 	Error     string          `json:"error,omitempty"`
+	// ClockOffset is the difference between the server clock and the room clock, as estimated by the
+	// room via TimeSync. If not set, the server assumes that Timestamp corresponds to its current time.
+	ClockOffset *time.Duration `json:"clock_offset,omitempty"`
 }
 
 type UpdateResponse struct{}
@@ -96,6 +100,7 @@ type Job struct {
 	StartMoves     []chess.UCIMove `json:"start_moves,omitempty" gorm:"serializer:json"`
 	ScoreThreshold int32           `json:"score_threshold,omitempty"`
 	TimeMargin     *time.Duration  `json:"time_margin,omitempty"`
+	MoveOverhead   *time.Duration  `json:"move_overhead,omitempty"`
 	White          JobEngine       `json:"white" gorm:"serializer:json"`
 	Black          JobEngine       `json:"black" gorm:"serializer:json"`
 }
@@ -106,6 +111,7 @@ func (j Job) Clone() Job {
 	j.StartBoard = clone.TrivialPtr(j.StartBoard)
 	j.StartMoves = slices.Clone(j.StartMoves)
 	j.TimeMargin = clone.TrivialPtr(j.TimeMargin)
+	j.MoveOverhead = clone.TrivialPtr(j.MoveOverhead)
 	j.White = j.White.Clone()
 	j.Black = j.Black.Clone()
 	return j
@@ -121,13 +127,31 @@ type JobResponse struct {
 	Job Job `json:"job"`
 }
 
+// Hardware describes the machine the room runs on. Zero values mean that the value is unknown.
+type Hardware struct {
+	Cores int `json:"cores,omitempty"`
+	// NPS is the speed of the machine in nodes per second, as measured by the room owner.
+	NPS int64 `json:"nps,omitempty"`
+}
+
 type HelloRequest struct {
-	SupportedProtoVersions []int32 `json:"supported_proto_versions"`
+	SupportedProtoVersions []int32   `json:"supported_proto_versions"`
+	ClientVersion          string    `json:"client_version,omitempty"`
+	Hardware               *Hardware `json:"hardware,omitempty"`
 }
 
 type HelloResponse struct {
 	RoomID       string `json:"room_id"`
 	ProtoVersion int32  `json:"proto_version"`
+	// Benchmark is set if the server wants the room to measure its speed before running any jobs.
+	Benchmark *Benchmark `json:"benchmark,omitempty"`
+}
+
+// Benchmark asks the room to search the start position with the engine for the given duration. The
+// measured speed is reported back via BenchmarkRequest.
+type Benchmark struct {
+	Engine   JobEngine     `json:"engine"`
+	Duration time.Duration `json:"duration"`
 }
 
 type ByeRequest struct {
@@ -136,9 +160,38 @@ type ByeRequest struct {
 
 type ByeResponse struct{}
 
+type TimeSyncRequest struct {
+	RoomID string `json:"room_id"`
+}
+
+type TimeSyncResponse struct {
+	Timestamp delta.Timestamp `json:"ts"`
+}
+
+// BenchmarkRequest reports the result of the benchmark. If the benchmark failed, Error is set and
+// NPS is zero.
+type BenchmarkRequest struct {
+	RoomID string `json:"room_id"`
+	NPS    int64  `json:"nps"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BenchmarkResponse struct{}
+
+// PingRequest only reports that the room is alive. Unlike other requests, it is allowed while the room
+// is waiting for a job or sending updates.
+type PingRequest struct {
+	RoomID string `json:"room_id"`
+}
+
+type PingResponse struct{}
+
 type API interface {
 	Update(ctx context.Context, req *UpdateRequest) (*UpdateResponse, error)
 	Job(ctx context.Context, req *JobRequest) (*JobResponse, error)
 	Hello(ctx context.Context, req *HelloRequest) (*HelloResponse, error)
 	Bye(ctx context.Context, req *ByeRequest) (*ByeResponse, error)
+	TimeSync(ctx context.Context, req *TimeSyncRequest) (*TimeSyncResponse, error)
+	Ping(ctx context.Context, req *PingRequest) (*PingResponse, error)
+	Benchmark(ctx context.Context, req *BenchmarkRequest) (*BenchmarkResponse, error)
 }
@@ -99,3 +99,15 @@ func (c *client) Hello(ctx context.Context, req *HelloRequest) (*HelloResponse,
 func (c *client) Bye(ctx context.Context, req *ByeRequest) (*ByeResponse, error) {
 	return doClientRequest[ByeRequest, ByeResponse](ctx, c, "/bye", req)
 }
+
+func (c *client) TimeSync(ctx context.Context, req *TimeSyncRequest) (*TimeSyncResponse, error) {
+	return doClientRequest[TimeSyncRequest, TimeSyncResponse](ctx, c, "/time-sync", req)
+}
+
+func (c *client) Ping(ctx context.Context, req *PingRequest) (*PingResponse, error) {
+	return doClientRequest[PingRequest, PingResponse](ctx, c, "/ping", req)
+}
+
+func (c *client) Benchmark(ctx context.Context, req *BenchmarkRequest) (*BenchmarkResponse, error) {
+	return doClientRequest[BenchmarkRequest, BenchmarkResponse](ctx, c, "/benchmark", req)
+}
@@ -31,7 +31,29 @@ func makeHandler[Req any, Rsp any](
 
 		log := log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
 
+		// When the server drains, the requests are canceled and the room retries them, so they reach
+		// the new server instance. Job long-polls would otherwise hold the old instance until they time
+		// out.
+		drainCh, release := httputil.TrackDrain(ctx)
+		defer release()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-drainCh:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
 		if err := func() error {
+			select {
+			case <-drainCh:
+				log.Info("server is draining, refusing roomapi request")
+				return &Error{Code: ErrTemporarilyUnavailable, Message: "server is restarting"}
+			default:
+			}
+
 			log.Info("handle roomapi request",
 				slog.String("method", hReq.Method),
 				slog.String("addr", hReq.RemoteAddr),
@@ -189,6 +211,12 @@ func HandleServer(log *slog.Logger, mux *http.ServeMux, prefix string, a API, cf
 		makeHandler(log.With(slog.String("handler", "hello")), &cfg, a.Hello))
 	mux.HandleFunc(prefix+"/bye",
 		makeHandler(log.With(slog.String("handler", "bye")), &cfg, a.Bye))
+	mux.HandleFunc(prefix+"/time-sync",
+		makeHandler(log.With(slog.String("handler", "time-sync")), &cfg, a.TimeSync))
+	mux.HandleFunc(prefix+"/ping",
+		makeHandler(log.With(slog.String("handler", "ping")), &cfg, a.Ping))
+	mux.HandleFunc(prefix+"/benchmark",
+		makeHandler(log.With(slog.String("handler", "benchmark")), &cfg, a.Benchmark))
 	mux.HandleFunc(prefix+"/", make404Handler(log))
 	return nil
 }
@@ -7,7 +7,10 @@ import (
 	"time"
 
 	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/delta"
 	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/util/writeq"
+	"github.com/alex65536/day20/internal/version"
 	"github.com/alex65536/go-chess/util/maybe"
 )
 
@@ -72,8 +75,18 @@ func NewStatusFailed(reason string) JobStatus {
 }
 
 type RoomInfo struct {
-	ID   string `gorm:"primaryKey"`
-	Name string
+	ID            string `gorm:"primaryKey"`
+	Name          string
+	ClientVersion string
+	// Cores and NPS describe the hardware reported by the room. Zero means unknown.
+	Cores int
+	NPS   int64
+	// BenchmarkNPS is the speed of the benchmark engine measured by the room, or zero if the room
+	// was not benchmarked.
+	BenchmarkNPS int64
+	// TimeScale is the factor applied to the time controls of the jobs run by the room, as measured
+	// by the benchmark. Zero means that the room was not benchmarked.
+	TimeScale float64
 }
 
 type RoomState struct {
@@ -84,26 +97,180 @@ type RoomState struct {
 type RoomFullData struct {
 	Info RoomInfo
 	Job  *roomapi.Job
+	// State is the last saved snapshot of the job state. It is nil if no snapshot was saved.
+	State *delta.JobState
+}
+
+// RoomUpdate is the state of the room saved into the database.
+type RoomUpdate struct {
+	JobID maybe.Maybe[string]
+	State *delta.JobState
 }
 
 type DB interface {
 	ListActiveRooms(ctx context.Context) ([]RoomFullData, error)
 	CreateRoom(ctx context.Context, info RoomInfo) error
-	UpdateRoom(ctx context.Context, roomID string, jobID maybe.Maybe[string]) error
+	UpdateRooms(ctx context.Context, rooms map[string]RoomUpdate) error
 	StopRoom(ctx context.Context, roomID string) error
+	UpdateRoomBenchmark(ctx context.Context, roomID string, nps int64, timeScale float64) error
 }
 
 type Scheduler interface {
 	IsJobAborted(jobID string) (string, bool)
-	NextJob(ctx context.Context) (*roomapi.Job, error)
-	OnJobFinished(jobID string, status JobStatus, game *battle.GameExt)
+	NextJob(ctx context.Context, room RoomInfo) (*roomapi.Job, error)
+	OnJobFinished(roomID, jobID string, status JobStatus, game *battle.GameExt)
+}
+
+type EventKind int
+
+const (
+	EventUnknown EventKind = iota
+	EventRoomConnected
+	EventRoomDisconnected
+	EventRoomTimedOut
+	EventJobFailed
+	EventJobAborted
+	EventMax
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventRoomConnected:
+		return "room-connected"
+	case EventRoomDisconnected:
+		return "room-disconnected"
+	case EventRoomTimedOut:
+		return "room-timed-out"
+	case EventJobFailed:
+		return "job-failed"
+	case EventJobAborted:
+		return "job-aborted"
+	default:
+		return "?"
+	}
+}
+
+func EventKindFromString(s string) (EventKind, bool) {
+	for k := EventUnknown + 1; k < EventMax; k++ {
+		if k.String() == s {
+			return k, true
+		}
+	}
+	return EventUnknown, false
+}
+
+// Event is a change in the room lifecycle. JobID and Status are set only for job events.
+type Event struct {
+	Kind   EventKind
+	Room   RoomInfo
+	JobID  string
+	Status JobStatus
+	Time   time.Time
+}
+
+// Notifier receives the room events. OnRoomEvent is called synchronously from the keeper, so it
+// must not block.
+type Notifier interface {
+	OnRoomEvent(ev Event)
 }
 
 type Options struct {
-	MaxJobFetchTimeout  time.Duration `toml:"max-job-fetch-timeout"`
+	MaxJobFetchTimeout time.Duration `toml:"max-job-fetch-timeout"`
+	// RoomLivenessTimeout is how long the room may stay silent before it is considered dead. Rooms
+	// ping the server periodically even when idle, so it must be well above the client ping
+	// interval, but doesn't need to cover the job fetch timeout.
 	RoomLivenessTimeout time.Duration `toml:"room-liveness-timeout"`
 	GCInterval          time.Duration `toml:"gc-interval"`
 	DBSaveTimeout       time.Duration `toml:"db-save-timeout"`
+
+	// SnapshotMoves is how often, in moves, the state of the running job is saved into the
+	// database. After restart, the saved state is shown until the room resyncs, and the game is not
+	// lost completely if the room doesn't return. Negative value disables the snapshots.
+	SnapshotMoves int64 `toml:"snapshot-moves"`
+
+	// DBQueue configures the queue which saves the room jobs into the database in background. It
+	// cannot be changed at runtime.
+	DBQueue writeq.Options `toml:"db-queue"`
+
+	// MinClientVersion is the minimum room client version considered up to date. Rooms which don't
+	// report their version are considered outdated, while the ones reporting a version which cannot be
+	// parsed (e.g. development builds) are not. Empty means that all the clients are up to date.
+	MinClientVersion string `toml:"min-client-version"`
+	// RefuseOutdatedClients makes the server refuse the outdated clients instead of just warning.
+	RefuseOutdatedClients bool `toml:"refuse-outdated-clients"`
+
+	// Benchmark configures the speed measurement done by the rooms on connect.
+	Benchmark BenchmarkOptions `toml:"benchmark"`
+}
+
+// BenchmarkOptions make the rooms measure the speed of the engine before running any jobs. The time
+// controls of the jobs are then multiplied by ReferenceNPS divided by the measured speed, so the
+// engines search roughly the same number of nodes on any hardware. The jobs of the rooms which were
+// not benchmarked are not scaled. Empty Engine disables the benchmark.
+type BenchmarkOptions struct {
+	Engine       string        `toml:"engine"`
+	Duration     time.Duration `toml:"duration"`
+	ReferenceNPS int64         `toml:"reference-nps"`
+	// MaxScale limits the time scale factor from both sides, i.e. it stays between 1/MaxScale and
+	// MaxScale.
+	MaxScale float64 `toml:"max-scale"`
+}
+
+func (o *BenchmarkOptions) validate() error {
+	if o.Engine == "" {
+		return nil
+	}
+	if o.Duration <= 0 {
+		return fmt.Errorf("non-positive duration")
+	}
+	if o.ReferenceNPS <= 0 {
+		return fmt.Errorf("non-positive reference nps")
+	}
+	if o.MaxScale < 1 {
+		return fmt.Errorf("max scale is less than one")
+	}
+	return nil
+}
+
+func (o *BenchmarkOptions) FillDefaults() {
+	if o.Duration == 0 {
+		o.Duration = 5 * time.Second
+	}
+	if o.MaxScale == 0 {
+		o.MaxScale = 4
+	}
+}
+
+// timeScale returns the time scale factor for the room with the given benchmark speed.
+func (o *BenchmarkOptions) timeScale(nps int64) float64 {
+	if o.Engine == "" || nps <= 0 {
+		return 0
+	}
+	scale := float64(o.ReferenceNPS) / float64(nps)
+	return min(max(scale, 1/o.MaxScale), o.MaxScale)
+}
+
+// jobTimeScale returns the time scale factor for the jobs given to the room, or zero if they must not
+// be scaled. The second return value is false if the benchmark is enabled, but the room hasn't
+// reported its speed yet or its benchmark failed.
+func (o *BenchmarkOptions) jobTimeScale(info RoomInfo) (float64, bool) {
+	if info.TimeScale > 0 {
+		return info.TimeScale, true
+	}
+	return 0, o.Engine == ""
+}
+
+func (o *Options) validate() error {
+	if o.MinClientVersion != "" && !version.IsValid(o.MinClientVersion) {
+		return fmt.Errorf("bad min client version %q", o.MinClientVersion)
+	}
+	if err := o.DBQueue.Validate(); err != nil {
+		return fmt.Errorf("db queue: %w", err)
+	}
+	if err := o.Benchmark.validate(); err != nil {
+		return fmt.Errorf("benchmark: %w", err)
+	}
+	return nil
 }
 
 func (o *Options) FillDefaults() {
@@ -111,7 +278,7 @@ func (o *Options) FillDefaults() {
 		o.MaxJobFetchTimeout = 3 * time.Minute
 	}
 	if o.RoomLivenessTimeout == 0 {
-		o.RoomLivenessTimeout = 2 * time.Minute
+		o.RoomLivenessTimeout = 1 * time.Minute
 	}
 	if o.GCInterval == 0 {
 		o.GCInterval = max(500*time.Millisecond, o.RoomLivenessTimeout/5)
@@ -119,4 +286,12 @@ func (o *Options) FillDefaults() {
 	if o.DBSaveTimeout == 0 {
 		o.DBSaveTimeout = 10 * time.Second
 	}
+	if o.SnapshotMoves == 0 {
+		o.SnapshotMoves = 10
+	}
+	if o.DBQueue.Timeout == 0 {
+		o.DBQueue.Timeout = o.DBSaveTimeout
+	}
+	o.DBQueue.FillDefaults()
+	o.Benchmark.FillDefaults()
 }
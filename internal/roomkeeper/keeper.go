@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alex65536/day20/internal/battle"
@@ -16,6 +17,9 @@ import (
 	"github.com/alex65536/day20/internal/util/httputil"
 	"github.com/alex65536/day20/internal/util/idgen"
 	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/writeq"
+	"github.com/alex65536/day20/internal/version"
+	"github.com/alex65536/go-chess/clock"
 	"github.com/alex65536/go-chess/util/maybe"
 	"github.com/dustinkirkland/golang-petname"
 )
@@ -51,6 +55,13 @@ func (r *roomExt) CheckSeq(seqIndex uint64) error {
 	return nil
 }
 
+// Touch marks the room as alive without acquiring it.
+func (r *roomExt) Touch() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastSeen = time.Now()
+}
+
 func (r *roomExt) Release() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -59,10 +70,12 @@ func (r *roomExt) Release() {
 }
 
 type Keeper struct {
-	db    DB
-	sched Scheduler
-	opts  Options
-	log   *slog.Logger
+	db     DB
+	sched  Scheduler
+	notify Notifier
+	opts   atomic.Pointer[Options]
+	log    *slog.Logger
+	dbq    *writeq.Queue[string, RoomUpdate]
 
 	gctx   context.Context
 	cancel func()
@@ -74,14 +87,19 @@ type Keeper struct {
 
 var _ roomapi.API = (*Keeper)(nil)
 
+// New creates the keeper. If notifier is nil, room events are not reported.
 func New(
 	ctx context.Context,
 	log *slog.Logger,
 	db DB,
 	sched Scheduler,
+	notifier Notifier,
 	opts Options,
 ) (*Keeper, error) {
 	opts.FillDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
 	rooms, err := db.ListActiveRooms(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("list active rooms: %w", err)
@@ -90,12 +108,18 @@ func New(
 	k := &Keeper{
 		db:     db,
 		sched:  sched,
-		opts:   opts,
+		notify: notifier,
 		log:    log,
 		gctx:   gctx,
 		cancel: cancel,
 		rooms:  make(map[string]*roomExt, len(rooms)),
 	}
+	k.opts.Store(&opts)
+	k.dbq, err = writeq.New(log, opts.DBQueue, k.saveRoomsDB)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("create db queue: %w", err)
+	}
 	for _, desc := range rooms {
 		k.rooms[desc.Info.ID] = newRoomExt(desc)
 	}
@@ -104,13 +128,29 @@ func New(
 	return k, nil
 }
 
+// SetOptions replaces the options of the running keeper. The new options apply to the subsequent
+// requests and GC runs.
+func (k *Keeper) SetOptions(opts Options) error {
+	opts.FillDefaults()
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	k.opts.Store(&opts)
+	return nil
+}
+
 func (k *Keeper) gc() {
 	defer k.wg.Done()
-	ticker := time.NewTicker(k.opts.GCInterval)
+	gcInterval := k.opts.Load().GCInterval
+	ticker := time.NewTicker(gcInterval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
+			if d := k.opts.Load().GCInterval; d != gcInterval {
+				gcInterval = d
+				ticker.Reset(gcInterval)
+			}
 			var roomsToStop []*roomExt
 			now := time.Now()
 			func() {
@@ -123,7 +163,7 @@ func (k *Keeper) gc() {
 						if r.locked {
 							return false
 						}
-						if now.Sub(r.lastSeen) <= k.opts.RoomLivenessTimeout {
+						if now.Sub(r.lastSeen) <= k.opts.Load().RoomLivenessTimeout {
 							return false
 						}
 						r.locked = true
@@ -135,7 +175,9 @@ func (k *Keeper) gc() {
 				}
 			}()
 			for _, room := range roomsToStop {
+				k.log.Info("room timed out", slog.String("room_id", room.room.ID()))
 				k.stop(k.log, room)
+				k.emit(Event{Kind: EventRoomTimedOut, Room: room.room.Info()})
 			}
 		case <-k.gctx.Done():
 			return
@@ -143,11 +185,51 @@ func (k *Keeper) gc() {
 	}
 }
 
-func (k *Keeper) saveRoomDB(log *slog.Logger, roomID string, jobID maybe.Maybe[string]) {
-	ctx, cancel := context.WithTimeout(context.Background(), k.opts.DBSaveTimeout)
-	defer cancel()
-	if err := k.db.UpdateRoom(ctx, roomID, jobID); err != nil {
-		log.Error("cannot save room in db", slogx.Err(err))
+func (k *Keeper) saveRoomsDB(ctx context.Context, items []writeq.Item[string, RoomUpdate]) error {
+	rooms := make(map[string]RoomUpdate, len(items))
+	for _, it := range items {
+		rooms[it.Key] = it.Value
+	}
+	if err := k.db.UpdateRooms(ctx, rooms); err != nil {
+		return fmt.Errorf("save rooms: %w", err)
+	}
+	return nil
+}
+
+// saveRoomDB schedules saving the room job into the database. The write is done in background, so
+// bursts of updates from many rooms are batched together.
+func (k *Keeper) saveRoomDB(roomID string, jobID maybe.Maybe[string]) {
+	k.dbq.Put(roomID, RoomUpdate{JobID: jobID})
+}
+
+func (k *Keeper) saveSnapshotDB(r *roomExt, jobID string) {
+	moves := k.opts.Load().SnapshotMoves
+	if moves < 0 {
+		return
+	}
+	if state, ok := r.room.Snapshot(moves); ok {
+		k.dbq.Put(r.room.ID(), RoomUpdate{JobID: maybe.Some(jobID), State: state})
+	}
+}
+
+func (k *Keeper) emit(ev Event) {
+	if k.notify == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	k.notify.OnRoomEvent(ev)
+}
+
+// finishJob passes the finished job to the scheduler and reports the unsuccessful jobs as events.
+func (k *Keeper) finishJob(r *roomExt, jobID string, status JobStatus, game *battle.GameExt) {
+	k.sched.OnJobFinished(r.room.ID(), jobID, status, game)
+	switch status.Kind {
+	case JobFailed:
+		k.emit(Event{Kind: EventJobFailed, Room: r.room.Info(), JobID: jobID, Status: status})
+	case JobAborted:
+		k.emit(Event{Kind: EventJobAborted, Room: r.room.Info(), JobID: jobID, Status: status})
 	}
 }
 
@@ -160,7 +242,7 @@ func (k *Keeper) abortRoomJob(log *slog.Logger, r *roomExt, reason string) {
 	game, err := r.room.GameExt()
 	if err != nil {
 		if !errors.Is(err, ErrGameNotReady) {
-			k.log.Warn("cannot extract game from aborted job",
+			log.Warn("cannot extract game from aborted job",
 				slog.String("room_id", r.room.ID()),
 				slog.String("job_id", curJobID),
 			)
@@ -168,8 +250,8 @@ func (k *Keeper) abortRoomJob(log *slog.Logger, r *roomExt, reason string) {
 		game = nil
 	}
 	r.room.SetJob(nil)
-	k.saveRoomDB(log, r.room.ID(), maybe.None[string]())
-	k.sched.OnJobFinished(curJobID, NewStatusAborted(reason), game)
+	k.saveRoomDB(r.room.ID(), maybe.None[string]())
+	k.finishJob(r, curJobID, NewStatusAborted(reason), game)
 }
 
 func (k *Keeper) stop(log *slog.Logger, r *roomExt) {
@@ -182,7 +264,7 @@ func (k *Keeper) stop(log *slog.Logger, r *roomExt) {
 	roomID := r.room.ID()
 	k.abortRoomJob(log, r, "room stopped")
 	r.room.Stop(log)
-	ctx, cancel := context.WithTimeout(context.Background(), k.opts.DBSaveTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), k.opts.Load().DBSaveTimeout)
 	defer cancel()
 	if err := k.db.StopRoom(ctx, roomID); err != nil {
 		log.Error("cannot stop room in db", slog.String("room_id", roomID), slogx.Err(err))
@@ -195,6 +277,7 @@ func (k *Keeper) Close() {
 	default:
 		k.cancel()
 		k.wg.Wait()
+		k.dbq.Close()
 	}
 }
 
@@ -228,9 +311,15 @@ func (k *Keeper) Update(ctx context.Context, req *roomapi.UpdateRequest) (*rooma
 	log := k.logFromCtx(ctx).With(slog.String("room_id", req.RoomID))
 
 	if req.Delta != nil {
+		ourNow := delta.NowTimestamp()
+		if req.ClockOffset != nil {
+			// The room knows its clock offset, which is more precise than the time of receiving the
+			// request, as the latter depends on network delays.
+			ourNow = req.Timestamp.Add(*req.ClockOffset)
+		}
 		req.Delta.FixTimestamps(delta.TimestampDiff{
 			TheirNow: req.Timestamp,
-			OurNow:   delta.NowTimestamp(),
+			OurNow:   ourNow,
 		})
 		// Do not re-assign req.Timestamp = delta.NowTimestamp() to simplify double fix detection.
 	}
@@ -299,8 +388,10 @@ func (k *Keeper) Update(ctx context.Context, req *roomapi.UpdateRequest) (*rooma
 	}()
 
 	if status.Kind.IsFinished() {
-		k.saveRoomDB(log, room.room.ID(), room.room.JobID())
-		k.sched.OnJobFinished(jobID, status, game)
+		k.saveRoomDB(room.room.ID(), room.room.JobID())
+		k.finishJob(room, jobID, status, game)
+	} else if updErr == nil {
+		k.saveSnapshotDB(room, jobID)
 	}
 
 	if updErr != nil {
@@ -311,6 +402,26 @@ func (k *Keeper) Update(ctx context.Context, req *roomapi.UpdateRequest) (*rooma
 	return &roomapi.UpdateResponse{}, nil
 }
 
+// scaleJobTime multiplies the time limits of the job by scale. The job must not be shared, as it is
+// modified in place.
+func scaleJobTime(job *roomapi.Job, scale float64) {
+	scaleDur := func(d time.Duration) time.Duration {
+		return time.Duration(float64(d) * scale)
+	}
+	if job.FixedTime != nil {
+		t := scaleDur(*job.FixedTime)
+		job.FixedTime = &t
+	}
+	if job.TimeControl != nil {
+		for _, side := range []clock.ControlSide{job.TimeControl.White, job.TimeControl.Black} {
+			for i := range side {
+				side[i].Time = scaleDur(side[i].Time)
+				side[i].Inc = scaleDur(side[i].Inc)
+			}
+		}
+	}
+}
+
 func (k *Keeper) Job(ctx context.Context, req *roomapi.JobRequest) (*roomapi.JobResponse, error) {
 	log := k.logFromCtx(ctx).With(slog.String("room_id", req.RoomID))
 
@@ -321,7 +432,7 @@ func (k *Keeper) Job(ctx context.Context, req *roomapi.JobRequest) (*roomapi.Job
 			Message: "non-positive timeout",
 		}
 	}
-	timeout = min(timeout, k.opts.MaxJobFetchTimeout)
+	timeout = min(timeout, k.opts.Load().MaxJobFetchTimeout)
 
 	room, err := k.getAndAcquireRoom(req.RoomID)
 	if err != nil {
@@ -339,7 +450,7 @@ func (k *Keeper) Job(ctx context.Context, req *roomapi.JobRequest) (*roomapi.Job
 
 	subctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	job, err := k.sched.NextJob(subctx)
+	job, err := k.sched.NextJob(subctx, room.room.Info())
 	if err != nil {
 		select {
 		case <-ctx.Done():
@@ -359,8 +470,15 @@ func (k *Keeper) Job(ctx context.Context, req *roomapi.JobRequest) (*roomapi.Job
 	}
 
 	log.Info("found job for room", slog.String("job_id", job.ID))
+	scale, ok := k.opts.Load().Benchmark.jobTimeScale(room.room.Info())
+	if !ok {
+		log.Warn("room is not benchmarked, not scaling job time", slog.String("job_id", job.ID))
+	}
+	if scale > 0 {
+		scaleJobTime(job, scale)
+	}
 	room.room.SetJob(job)
-	k.saveRoomDB(log, room.room.ID(), maybe.Some(job.ID))
+	k.saveRoomDB(room.room.ID(), maybe.Some(job.ID))
 
 	return &roomapi.JobResponse{
 		Job: job.Clone(),
@@ -377,6 +495,17 @@ func (k *Keeper) Hello(ctx context.Context, req *roomapi.HelloRequest) (*roomapi
 		}
 	}
 
+	if k.ClientOutdated(req.ClientVersion) {
+		if opts := k.opts.Load(); opts.RefuseOutdatedClients {
+			log.Info("refusing outdated room client", slog.String("client_version", req.ClientVersion))
+			return nil, &roomapi.Error{
+				Code:    roomapi.ErrClientOutdated,
+				Message: fmt.Sprintf("client version %q is older than %q", req.ClientVersion, opts.MinClientVersion),
+			}
+		}
+		log.Warn("room client is outdated", slog.String("client_version", req.ClientVersion))
+	}
+
 	var (
 		roomID string
 		data   RoomFullData
@@ -390,11 +519,16 @@ func (k *Keeper) Hello(ctx context.Context, req *roomapi.HelloRequest) (*roomapi
 		}
 		data = RoomFullData{
 			Info: RoomInfo{
-				ID:   roomID,
-				Name: petname.Generate(3, "-"),
+				ID:            roomID,
+				Name:          petname.Generate(3, "-"),
+				ClientVersion: req.ClientVersion,
 			},
 			Job: nil,
 		}
+		if hw := req.Hardware; hw != nil {
+			data.Info.Cores = max(hw.Cores, 0)
+			data.Info.NPS = max(hw.NPS, 0)
+		}
 		k.rooms[roomID] = newRoomExt(data)
 	}()
 
@@ -407,10 +541,33 @@ func (k *Keeper) Hello(ctx context.Context, req *roomapi.HelloRequest) (*roomapi
 		return nil, fmt.Errorf("create room in db: %w", err)
 	}
 
-	return &roomapi.HelloResponse{
+	k.emit(Event{Kind: EventRoomConnected, Room: data.Info})
+
+	rsp := &roomapi.HelloResponse{
 		RoomID:       roomID,
 		ProtoVersion: roomapi.ProtoVersion,
-	}, nil
+	}
+	if b := k.opts.Load().Benchmark; b.Engine != "" {
+		rsp.Benchmark = &roomapi.Benchmark{
+			Engine:   roomapi.JobEngine{Name: b.Engine},
+			Duration: b.Duration,
+		}
+	}
+	return rsp, nil
+}
+
+// ClientOutdated reports whether the room client with the given version is older than the minimum
+// version.
+func (k *Keeper) ClientOutdated(clientVersion string) bool {
+	minVersion := k.opts.Load().MinClientVersion
+	if minVersion == "" {
+		return false
+	}
+	if clientVersion == "" {
+		return true
+	}
+	c, ok := version.Compare(clientVersion, minVersion)
+	return ok && c < 0
 }
 
 func (k *Keeper) Bye(ctx context.Context, req *roomapi.ByeRequest) (*roomapi.ByeResponse, error) {
@@ -428,10 +585,104 @@ func (k *Keeper) Bye(ctx context.Context, req *roomapi.ByeRequest) (*roomapi.Bye
 	k.mu.Unlock()
 
 	k.stop(log, room)
+	k.emit(Event{Kind: EventRoomDisconnected, Room: room.room.Info()})
 
 	return &roomapi.ByeResponse{}, nil
 }
 
+func (k *Keeper) TimeSync(ctx context.Context, req *roomapi.TimeSyncRequest) (*roomapi.TimeSyncResponse, error) {
+	// Do not acquire the room, as the room may be waiting for a job or sending updates concurrently.
+	if _, err := k.doGetRoom(req.RoomID); err != nil {
+		return nil, err
+	}
+	return &roomapi.TimeSyncResponse{Timestamp: delta.NowTimestamp()}, nil
+}
+
+func (k *Keeper) Benchmark(ctx context.Context, req *roomapi.BenchmarkRequest) (*roomapi.BenchmarkResponse, error) {
+	log := k.logFromCtx(ctx).With(slog.String("room_id", req.RoomID))
+
+	room, err := k.getAndAcquireRoom(req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	defer room.Release()
+
+	if req.Error != "" {
+		log.Warn("room benchmark failed", slog.String("err", req.Error))
+		return &roomapi.BenchmarkResponse{}, nil
+	}
+	if req.NPS <= 0 {
+		return nil, &roomapi.Error{
+			Code:    roomapi.ErrBadRequest,
+			Message: "non-positive nps",
+		}
+	}
+
+	opts := k.opts.Load()
+	scale := opts.Benchmark.timeScale(req.NPS)
+	log.Info("room benchmarked", slog.Int64("nps", req.NPS), slog.Float64("time_scale", scale))
+	room.room.SetBenchmark(req.NPS, scale)
+
+	ctx, cancel := context.WithTimeout(ctx, opts.DBSaveTimeout)
+	defer cancel()
+	if err := k.db.UpdateRoomBenchmark(ctx, req.RoomID, req.NPS, scale); err != nil {
+		log.Warn("cannot save room benchmark in db", slogx.Err(err))
+	}
+
+	return &roomapi.BenchmarkResponse{}, nil
+}
+
+func (k *Keeper) Ping(ctx context.Context, req *roomapi.PingRequest) (*roomapi.PingResponse, error) {
+	// Do not acquire the room, as pings are sent while the room is waiting for a job.
+	room, err := k.doGetRoom(req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	room.Touch()
+	return &roomapi.PingResponse{}, nil
+}
+
+// AbortJob aborts the running job with the given ID. The scheduler is notified about the abort, so it
+// can re-queue the game, while the room running the job learns about the abort on its next request.
+func (k *Keeper) AbortJob(jobID string, reason string) error {
+	var r *roomExt
+	func() {
+		k.mu.RLock()
+		defer k.mu.RUnlock()
+		for _, room := range k.rooms {
+			if curJobID, ok := room.room.JobID().TryGet(); ok && curJobID == jobID {
+				r = room
+				return
+			}
+		}
+	}()
+	if r == nil {
+		return &roomapi.Error{
+			Code:    roomapi.ErrNoJobRunning,
+			Message: "no such job",
+		}
+	}
+
+	room, err := k.getAndAcquireRoom(r.room.ID())
+	if err != nil {
+		return err
+	}
+	defer room.Release()
+
+	// The job may have finished while we were acquiring the room.
+	if curJobID, ok := room.room.JobID().TryGet(); !ok || curJobID != jobID {
+		return &roomapi.Error{
+			Code:    roomapi.ErrNoJobRunning,
+			Message: "no such job",
+		}
+	}
+
+	log := k.log.With(slog.String("room_id", room.room.ID()), slog.String("job_id", jobID))
+	log.Info("aborting job", slog.String("reason", reason))
+	k.abortRoomJob(log, room, reason)
+	return nil
+}
+
 func (k *Keeper) ListRooms() []RoomState {
 	k.mu.RLock()
 	defer k.mu.RUnlock()
@@ -481,6 +732,22 @@ func (k *Keeper) RoomInfo(roomID string) (RoomInfo, error) {
 	return room.room.Info(), nil
 }
 
+func (k *Keeper) RoomJobID(roomID string) (maybe.Maybe[string], error) {
+	room, err := k.doGetRoom(roomID)
+	if err != nil {
+		return maybe.None[string](), err
+	}
+	return room.room.JobID(), nil
+}
+
+func (k *Keeper) RoomLastJobID(roomID string) (maybe.Maybe[string], error) {
+	room, err := k.doGetRoom(roomID)
+	if err != nil {
+		return maybe.None[string](), err
+	}
+	return room.room.LastJobID(), nil
+}
+
 func (k *Keeper) Subscribe(roomID string) (ch <-chan struct{}, cancel func(), ok bool) {
 	room, err := k.doGetRoom(roomID)
 	if err != nil {
@@ -19,6 +19,8 @@ type room struct {
 	state   *delta.RoomState
 	subs    map[string]chan struct{}
 	stopped bool
+	// snapMoves is the number of moves in the last saved snapshot.
+	snapMoves int64
 }
 
 func newRoom(data RoomFullData) *room {
@@ -30,11 +32,16 @@ func newRoom(data RoomFullData) *room {
 		stopped: false,
 	}
 	r.onJobReset()
+	if data.Job != nil && data.State != nil && data.State.ValidateFull() == nil {
+		r.state.State = data.State.Clone()
+		r.snapMoves = data.State.Moves.Version
+	}
 	return r
 }
 
 func (r *room) onJobReset() {
 	job := r.job
+	r.snapMoves = 0
 	if job == nil {
 		r.state.JobID = ""
 		r.state.State = nil
@@ -45,6 +52,7 @@ func (r *room) onJobReset() {
 }
 
 func (r *room) Subscribe() (<-chan struct{}, func()) {
+	defer r.onUpdate()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if r.stopped {
@@ -58,11 +66,14 @@ func (r *room) Subscribe() (<-chan struct{}, func()) {
 	}
 	ch := make(chan struct{}, 1)
 	r.subs[id] = ch
+	r.state.Spectators = int64(len(r.subs))
 	return ch, func() {
+		defer r.onUpdate()
 		r.mu.Lock()
 		defer r.mu.Unlock()
 		if !r.stopped {
 			delete(r.subs, id)
+			r.state.Spectators = int64(len(r.subs))
 		}
 	}
 }
@@ -97,8 +108,20 @@ func (r *room) GameExt() (*battle.GameExt, error) {
 	return g, nil
 }
 
-func (r *room) Info() RoomInfo { return r.info }
-func (r *room) ID() string     { return r.info.ID }
+func (r *room) ID() string { return r.info.ID }
+
+func (r *room) Info() RoomInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.info
+}
+
+func (r *room) SetBenchmark(nps int64, timeScale float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.info.BenchmarkNPS = nps
+	r.info.TimeScale = timeScale
+}
 
 func (r *room) JobID() maybe.Maybe[string] {
 	r.mu.RLock()
@@ -109,14 +132,42 @@ func (r *room) JobID() maybe.Maybe[string] {
 	return maybe.Some(r.job.ID)
 }
 
+func (r *room) LastJobID() maybe.Maybe[string] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.state.LastJobID == "" {
+		return maybe.None[string]()
+	}
+	return maybe.Some(r.state.LastJobID)
+}
+
 func (r *room) SetJob(job *roomapi.Job) {
 	defer r.onUpdate()
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if r.job != nil && (job == nil || job.ID != r.job.ID) {
+		r.state.LastJobID = r.job.ID
+	}
 	r.job = job
 	r.onJobReset()
 }
 
+// Snapshot returns the state of the running job if at least the given number of moves was made
+// since the last snapshot.
+func (r *room) Snapshot(moves int64) (*delta.JobState, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.job == nil || r.state.State == nil || r.state.State.Info == nil {
+		return nil, false
+	}
+	cur := r.state.State.Moves.Version
+	if cur-r.snapMoves < moves {
+		return nil, false
+	}
+	r.snapMoves = cur
+	return r.state.State.Clone(), true
+}
+
 func (r *room) StateDelta(old delta.RoomCursor) (*delta.RoomState, delta.RoomCursor, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -148,6 +199,7 @@ func (r *room) Update(log *slog.Logger, req *roomapi.UpdateRequest) (JobStatus,
 	status := NewStatusRunning()
 	defer func() {
 		if status.Kind.IsFinished() {
+			r.state.LastJobID = r.job.ID
 			r.job = nil
 			r.onJobReset()
 		}
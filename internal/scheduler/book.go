@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alex65536/day20/internal/opening"
+	"github.com/alex65536/day20/internal/util/idgen"
+	"github.com/alex65536/day20/internal/util/randutil"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+const (
+	StoredBookNameMaxLen        = 128
+	StoredBookDescriptionMaxLen = 4096
+	StoredBookDataMaxSize       = 8 << 20
+)
+
+type StoredBookFormat string
+
+const (
+	StoredBookFEN     StoredBookFormat = "fen"
+	StoredBookEPD     StoredBookFormat = "epd"
+	StoredBookPGNLine StoredBookFormat = "pgn_line"
+)
+
+// StoredBook is an opening book uploaded by users, so it can be used by multiple contests. Books in
+// EPD format are converted into FEN on upload, so Kind is either OpeningsFEN or OpeningsPGNLine.
+type StoredBook struct {
+	ID          string `gorm:"primaryKey"`
+	Name        string
+	Description string
+	Kind        OpeningBookKind
+	Data        string
+	Positions   int
+	OwnerID     string
+	CreatedAt   timeutil.UTCTime
+}
+
+func (b *StoredBook) Validate() error {
+	if b.Name == "" {
+		return fmt.Errorf("no book name")
+	}
+	if utf8.RuneCountInString(b.Name) > StoredBookNameMaxLen {
+		return fmt.Errorf("book name exceeds %v runes", StoredBookNameMaxLen)
+	}
+	if utf8.RuneCountInString(b.Description) > StoredBookDescriptionMaxLen {
+		return fmt.Errorf("book description exceeds %v runes", StoredBookDescriptionMaxLen)
+	}
+	if len(b.Data) > StoredBookDataMaxSize {
+		return fmt.Errorf("book exceeds %v bytes", StoredBookDataMaxSize)
+	}
+	switch b.Kind {
+	case OpeningsFEN, OpeningsPGNLine:
+	default:
+		return fmt.Errorf("bad book kind %q", b.Kind)
+	}
+	if _, err := b.OpeningBook().Book(randutil.DefaultSource()); err != nil {
+		return fmt.Errorf("bad book: %w", err)
+	}
+	return nil
+}
+
+// OpeningBook returns the book with the stored data inlined.
+func (b *StoredBook) OpeningBook() OpeningBook {
+	return OpeningBook{Kind: b.Kind, Data: b.Data}
+}
+
+func countPositions(data string) int {
+	count := 0
+	for _, ln := range strings.Split(data, "\n") {
+		ln = strings.TrimSpace(ln)
+		if ln != "" && !strings.HasPrefix(ln, "#") {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Scheduler) CreateStoredBook(
+	ctx context.Context,
+	ownerID, name, description string,
+	format StoredBookFormat,
+	data string,
+) (StoredBook, error) {
+	if len(data) > StoredBookDataMaxSize {
+		return StoredBook{}, fmt.Errorf("book exceeds %v bytes", StoredBookDataMaxSize)
+	}
+	var kind OpeningBookKind
+	switch format {
+	case StoredBookFEN:
+		kind = OpeningsFEN
+	case StoredBookEPD:
+		var err error
+		data, err = opening.EPDToFEN(data)
+		if err != nil {
+			return StoredBook{}, fmt.Errorf("convert epd: %w", err)
+		}
+		kind = OpeningsFEN
+	case StoredBookPGNLine:
+		kind = OpeningsPGNLine
+	default:
+		return StoredBook{}, fmt.Errorf("bad book format %q", format)
+	}
+	book := StoredBook{
+		ID:          idgen.ID(),
+		Name:        name,
+		Description: description,
+		Kind:        kind,
+		Data:        data,
+		Positions:   countPositions(data),
+		OwnerID:     ownerID,
+		CreatedAt:   timeutil.NowUTC(),
+	}
+	if err := book.Validate(); err != nil {
+		return StoredBook{}, fmt.Errorf("invalid book: %w", err)
+	}
+	if err := s.db.CreateStoredBook(ctx, book); err != nil {
+		return StoredBook{}, fmt.Errorf("create book: %w", err)
+	}
+	return book, nil
+}
+
+func (s *Scheduler) GetStoredBook(ctx context.Context, bookID string) (StoredBook, error) {
+	return s.db.GetStoredBook(ctx, bookID)
+}
+
+// ListStoredBooks returns all the stored books without their data.
+func (s *Scheduler) ListStoredBooks(ctx context.Context) ([]StoredBook, error) {
+	books, err := s.db.ListStoredBooks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list books: %w", err)
+	}
+	return books, nil
+}
+
+func resolveBook(ctx context.Context, db DB, b OpeningBook) (OpeningBook, error) {
+	if b.Kind != OpeningsStored {
+		return b, nil
+	}
+	stored, err := db.GetStoredBook(ctx, b.Data)
+	if err != nil {
+		return OpeningBook{}, fmt.Errorf("get stored book: %w", err)
+	}
+	res := stored.OpeningBook()
+	res.MaxPlies = b.MaxPlies
+	res.Dedup = b.Dedup
+	res.Pinned = b.Pinned
+	return res, nil
+}
+
+// ResolveBook replaces the reference to a stored book with the book contents. Other books are
+// returned as is.
+func (s *Scheduler) ResolveBook(ctx context.Context, b OpeningBook) (OpeningBook, error) {
+	return resolveBook(ctx, s.db, b)
+}
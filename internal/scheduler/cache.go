@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// contestsCache keeps the list of all the contests loaded from the database. The scheduler knows
+// the latest state of running contests anyway, so the cache needs to be invalidated only when
+// contests are created or finished.
+type contestsCache struct {
+	mu       sync.Mutex
+	gen      uint64
+	valid    bool
+	loadedAt time.Time
+	contests []ContestFullData
+}
+
+func (c *contestsCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.valid = false
+	c.contests = nil
+}
+
+// Get returns the cached contests if they are not older than ttl, or loads them otherwise. The
+// returned slice may be modified by the caller, but not the contests themselves.
+func (c *contestsCache) Get(
+	ctx context.Context,
+	ttl time.Duration,
+	load func(ctx context.Context) ([]ContestFullData, error),
+) ([]ContestFullData, error) {
+	if ttl < 0 {
+		return load(ctx)
+	}
+
+	c.mu.Lock()
+	if c.valid && time.Since(c.loadedAt) < ttl {
+		res := slices.Clone(c.contests)
+		c.mu.Unlock()
+		return res, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	now := time.Now()
+	contests, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Do not store the contests if the cache was invalidated during loading, as they may be stale.
+	if c.gen == gen {
+		c.valid = true
+		c.loadedAt = now
+		c.contests = contests
+	}
+	return slices.Clone(contests), nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 
 	"github.com/alex65536/day20/internal/battle"
 	"github.com/alex65536/day20/internal/opening"
@@ -14,6 +15,7 @@ import (
 	"github.com/alex65536/day20/internal/util/clone"
 	"github.com/alex65536/day20/internal/util/idgen"
 	"github.com/alex65536/day20/internal/util/randutil"
+	"github.com/alex65536/day20/internal/util/timeutil"
 	"github.com/alex65536/go-chess/chess"
 )
 
@@ -23,7 +25,7 @@ type contestScheduler struct {
 	log  *slog.Logger
 	info *ContestInfo
 	book opening.Book
-	opts *Options
+	opts *atomic.Pointer[Options]
 
 	mu     sync.RWMutex
 	data   ContestData
@@ -35,10 +37,11 @@ type contestScheduler struct {
 
 func newContestScheduler(
 	log *slog.Logger,
-	opts *Options,
+	opts *atomic.Pointer[Options],
 	info *ContestInfo,
 	data ContestData,
 	jobs []*RunningJob,
+	openingBook OpeningBook,
 ) (*contestScheduler, error) {
 	data = data.Clone()
 	if data.Status.Kind.IsFinished() {
@@ -52,18 +55,22 @@ func newContestScheduler(
 		return nil, fmt.Errorf("bad schedule: %w", err)
 	}
 
-	book, err := info.OpeningBook.Book(randutil.DefaultSource())
+	book, err := openingBook.Book(randutil.DefaultSource())
 	if err != nil {
 		return nil, fmt.Errorf("bad opening book: %w", err)
 	}
 
+	openEnded := info.Kind == ContestMatch && info.Match.IsFirstTo()
 	jobMap := make(map[string]*RunningJob, len(jobs))
 	for _, j := range jobs {
-		if !sched.Dec(j.ScheduleKey()) {
+		if !openEnded && !sched.Dec(j.ScheduleKey()) {
 			log.Warn("found extraneous job", slog.String("job_id", j.Job.ID))
 			continue
 		}
 		jobMap[j.Job.ID] = j
+		if j.OpeningSlot != nil {
+			data.reserveOpeningSlot(info.Kind, *j.OpeningSlot)
+		}
 	}
 
 	cs := &contestScheduler{
@@ -78,6 +85,7 @@ func newContestScheduler(
 		notify: make(chan struct{}, 1),
 		closed: false,
 	}
+	cs.extendScheduleUnlocked()
 	cs.onUpdatedUnlocked()
 	return cs, nil
 }
@@ -86,6 +94,55 @@ func (s *contestScheduler) isFinishedUnlocked() bool {
 	return s.data.Status.Kind.IsFinished()
 }
 
+// extendScheduleUnlocked tops up the open-ended schedule of a first-to-N match, so that the running
+// and scheduled games are enough to finish the match if the leader wins all of them. The colors are
+// kept balanced between the players.
+func (s *contestScheduler) extendScheduleUnlocked() {
+	if s.info.Kind != ContestMatch || !s.info.Match.IsFirstTo() {
+		return
+	}
+	direct := ScheduleKey{WhiteID: 0, BlackID: 1}
+	inverted := ScheduleKey{WhiteID: 1, BlackID: 0}
+	numInverted := s.data.Match.Inverted + s.sched.Count(inverted)
+	numDirect := s.data.Match.Played() - s.data.Match.Inverted + s.sched.Count(direct)
+	for _, j := range s.jobs {
+		if j.ScheduleKey() == inverted {
+			numInverted++
+		} else {
+			numDirect++
+		}
+	}
+	need := s.info.Match.Wins - s.data.Match.MaxWins()
+	for have := int64(len(s.jobs)) + s.sched.Total(); have < need; have++ {
+		if numDirect <= numInverted {
+			s.sched.Inc(direct)
+			numDirect++
+		} else {
+			s.sched.Inc(inverted)
+			numInverted++
+		}
+	}
+}
+
+// nextSwissRoundUnlocked starts the next round of a Swiss tournament once the current one is
+// finished. It returns false if there are no more rounds to play.
+func (s *contestScheduler) nextSwissRoundUnlocked() bool {
+	if s.info.Kind != ContestSwiss {
+		return false
+	}
+	if !s.data.Swiss.Current().IsFinished() {
+		s.log.Warn("swiss round has unscheduled games", slog.Int("round", s.data.Swiss.Round()))
+		return false
+	}
+	if !s.data.Swiss.nextRound(len(s.info.Players), s.info.Swiss.Rounds) {
+		return false
+	}
+	for _, p := range s.data.Swiss.Current().Pairings {
+		s.sched.Inc(ScheduleKey{WhiteID: p.White, BlackID: p.Black})
+	}
+	return true
+}
+
 func (s *contestScheduler) onUpdatedUnlocked() {
 	if s.isFinishedUnlocked() {
 		if !s.closed {
@@ -113,7 +170,13 @@ func (s *contestScheduler) getJob() (*RunningJob, bool, error) {
 		return nil, false, nil
 	}
 	_ = s.sched.Dec(k)
-	opening := s.book.Opening()
+	slot := s.data.takeOpeningSlot(s.info.Kind, k)
+	var opening *chess.Game
+	if s.info.OpeningBook.Pinned || s.info.Kind == ContestMatch {
+		opening = s.book.OpeningAt(slotOpeningKey(s.info, slot))
+	} else {
+		opening = s.book.Opening()
+	}
 	startMoves := make([]chess.UCIMove, opening.Len())
 	for i := range opening.Len() {
 		startMoves[i] = opening.MoveAt(i).UCIMove()
@@ -127,6 +190,7 @@ func (s *contestScheduler) getJob() (*RunningJob, bool, error) {
 	if timeControl != nil && s.info.Kind == ContestMatch && k.WhiteID == 1 {
 		timeControl.White, timeControl.Black = timeControl.Black, timeControl.White
 	}
+	now := timeutil.NowUTC()
 	job := &RunningJob{
 		JobInfo: JobInfo{
 			Job: roomapi.Job{
@@ -137,12 +201,15 @@ func (s *contestScheduler) getJob() (*RunningJob, bool, error) {
 				StartMoves:     startMoves,
 				ScoreThreshold: s.info.ScoreThreshold,
 				TimeMargin:     clone.TrivialPtr(s.info.TimeMargin),
+				MoveOverhead:   clone.TrivialPtr(s.info.MoveOverhead),
 				White:          s.info.Players[k.WhiteID].Clone(),
 				Black:          s.info.Players[k.BlackID].Clone(),
 			},
-			ContestID: s.info.ID,
-			WhiteID:   k.WhiteID,
-			BlackID:   k.BlackID,
+			ContestID:   s.info.ID,
+			WhiteID:     k.WhiteID,
+			BlackID:     k.BlackID,
+			StartedAt:   &now,
+			OpeningSlot: &slot,
 		},
 	}
 	s.jobs[job.Job.ID] = job
@@ -157,9 +224,63 @@ func (s *contestScheduler) IsFinished() bool {
 }
 
 func (s *contestScheduler) Info() *ContestInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.info
 }
 
+// SetPosInQueue changes the position of the contest in the queue. As with Edit, the old info is not
+// modified.
+func (s *contestScheduler) SetPosInQueue(pos uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := s.info.Clone()
+	info.PosInQueue = pos
+	s.info = &info
+}
+
+// Edit replaces the contest settings, provided that the contest has not started yet. The new info is
+// persisted with save before being applied. The old info is not modified, so the pointers returned by
+// Info() remain valid.
+func (s *contestScheduler) Edit(
+	settings ContestSettings,
+	openingBook OpeningBook,
+	save func(info *ContestInfo) error,
+) (*ContestInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isFinishedUnlocked() {
+		return nil, errContestFinished
+	}
+	if len(s.jobs) != 0 || s.data.LastIndex != 0 || s.data.FailedJobs != 0 {
+		return nil, ErrContestStarted
+	}
+	if settings.Kind != s.info.Kind {
+		return nil, fmt.Errorf("cannot change contest kind")
+	}
+
+	info := s.info.Clone()
+	info.ContestSettings = settings.Clone()
+	sched, err := info.BuildSchedule(&s.data)
+	if err != nil {
+		return nil, fmt.Errorf("bad schedule: %w", err)
+	}
+	book, err := openingBook.Book(randutil.DefaultSource())
+	if err != nil {
+		return nil, fmt.Errorf("bad opening book: %w", err)
+	}
+	if err := save(&info); err != nil {
+		return nil, err
+	}
+
+	s.info = &info
+	s.sched = sched
+	s.book = book
+	s.extendScheduleUnlocked()
+	s.onUpdatedUnlocked()
+	return &info, nil
+}
+
 func (s *contestScheduler) Status() ContestStatus {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -179,7 +300,7 @@ func (s *contestScheduler) Abort(reason string) {
 		return
 	}
 	s.jobs = make(map[string]*RunningJob)
-	s.data.Status = NewStatusAborted(reason)
+	s.data.SetStatus(NewStatusAborted(reason))
 	s.onUpdatedUnlocked()
 }
 
@@ -216,7 +337,22 @@ func (s *contestScheduler) NextJob(ctx context.Context) (*RunningJob, error) {
 	}
 }
 
+// whiteScore returns the score of White in half-points.
+func whiteScore(result chess.Status) int64 {
+	switch result {
+	case chess.StatusWhiteWins:
+		return 2
+	case chess.StatusBlackWins:
+		return 0
+	case chess.StatusDraw:
+		return 1
+	default:
+		panic("must not happen")
+	}
+}
+
 func (s *contestScheduler) FinalizeJob(
+	roomID string,
 	jobID string,
 	srcStatus roomkeeper.JobStatus,
 	game *battle.GameExt,
@@ -272,48 +408,72 @@ func (s *contestScheduler) FinalizeJob(
 
 	addPGNToJobOrAbort(s.log, job, game)
 
+	if job.Status.Kind != roomkeeper.JobSucceeded && job.OpeningSlot != nil {
+		s.data.freeOpeningSlot(job.ScheduleKey(), *job.OpeningSlot)
+	}
+	s.data.addRetryAttempt(job, roomID)
+
 	switch job.Status.Kind {
 	case roomkeeper.JobAborted:
 		s.sched.Inc(job.ScheduleKey())
 	case roomkeeper.JobFailed:
 		s.sched.Inc(job.ScheduleKey())
 		s.data.FailedJobs++
-		if s.data.FailedJobs > int64(s.opts.MaxFailedJobs) {
+		if s.data.FailedJobs > s.opts.Load().MaxFailedJobs {
 			s.jobs = make(map[string]*RunningJob)
-			s.data.Status = NewStatusFailed(fmt.Sprintf("too many failed jobs (%v)", s.data.FailedJobs))
+			s.data.SetStatus(NewStatusFailed(fmt.Sprintf("too many failed jobs (%v)", s.data.FailedJobs)))
 		}
 	case roomkeeper.JobSucceeded:
 		s.data.LastIndex++
 		job.Index = s.data.LastIndex
+		if game != nil && game.Game.Outcome().Verdict() == chess.VerdictInvalidMove {
+			s.data.IllegalMoves++
+		}
 		switch s.info.Kind {
 		case ContestMatch:
 			inv := job.WhiteID == 1
 			if inv {
 				s.data.Match.Inverted++
 			}
-			switch job.GameResult {
-			case chess.StatusWhiteWins:
-				if inv {
-					s.data.Match.SecondWin++
-				} else {
-					s.data.Match.FirstWin++
-				}
-			case chess.StatusBlackWins:
-				if inv {
-					s.data.Match.FirstWin++
-				} else {
-					s.data.Match.SecondWin++
-				}
-			case chess.StatusDraw:
+			score := whiteScore(job.GameResult)
+			if inv {
+				score = 2 - score
+			}
+			switch score {
+			case 2:
+				s.data.Match.FirstWin++
+			case 1:
 				s.data.Match.Draw++
-			default:
-				panic("must not happen")
+			case 0:
+				s.data.Match.SecondWin++
+			}
+			if job.OpeningSlot != nil {
+				s.data.Match.addPairGame(*job.OpeningSlot/2, score)
+			}
+		case ContestSwiss:
+			if !s.data.Swiss.addResult(job.WhiteID, job.BlackID, int(whiteScore(job.GameResult))) {
+				s.log.Warn("game not found in swiss round", slog.String("job_id", jobID))
+			}
+		case ContestKnockout:
+			score := whiteScore(job.GameResult)
+			if !s.data.Knockout.addResult(job.WhiteID, job.BlackID, score, &s.sched, s.info.Knockout) {
+				s.log.Warn("game not found in knockout bracket", slog.String("job_id", jobID))
 			}
 		default:
 			panic("bad contest kind")
 		}
-		if len(s.jobs) == 0 && s.sched.Empty() {
-			s.data.Status = NewStatusSucceeded()
+		if game != nil {
+			job.Game = buildGame(job, game, timeutil.NowUTC())
+		}
+		if s.info.Kind == ContestMatch && s.info.Match.IsFirstTo() && s.data.Match.MaxWins() >= s.info.Match.Wins {
+			// The remaining games are not needed anymore.
+			s.jobs = make(map[string]*RunningJob)
+			s.data.SetStatus(NewStatusSucceeded())
+			break
+		}
+		s.extendScheduleUnlocked()
+		if len(s.jobs) == 0 && s.sched.Empty() && !s.nextSwissRoundUnlocked() {
+			s.data.SetStatus(NewStatusSucceeded())
 		}
 	default:
 		panic("bad job kind")
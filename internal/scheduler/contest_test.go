@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alex65536/go-chess/chess"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/stat"
+)
+
+// finishTestJob finishes the match job with the given score of the first player in half-points.
+func finishTestJob(t *testing.T, s *contestScheduler, j *RunningJob, score int64) {
+	t.Helper()
+	if j.WhiteID == 1 {
+		score = 2 - score
+	}
+	game := chess.NewGame()
+	switch score {
+	case 2:
+		game.SetOutcome(chess.MustWinOutcome(chess.VerdictResign, chess.ColorWhite))
+	case 1:
+		game.SetOutcome(chess.MustDrawOutcome(chess.VerdictDrawAgreement))
+	case 0:
+		game.SetOutcome(chess.MustWinOutcome(chess.VerdictResign, chess.ColorBlack))
+	}
+	job, err := s.FinalizeJob("room", j.Job.ID, roomkeeper.NewStatusSucceeded(), &battle.GameExt{Game: game})
+	if err != nil {
+		t.Fatalf("finish job: %v", err)
+	}
+	if job.Status.Kind != roomkeeper.JobSucceeded {
+		t.Fatalf("job not succeeded: %v", job.Status)
+	}
+}
+
+func TestMatchPentanomialPairs(t *testing.T) {
+	s := newTestMatch(t, 6, OpeningBook{Kind: OpeningsPGNLine, Data: testBookLines})
+	bySlot := make([]*RunningJob, 6)
+	for range 6 {
+		j := nextTestJob(t, s)
+		bySlot[*j.OpeningSlot] = j
+	}
+
+	// Both games of a pair are played on the same opening with colors reversed.
+	for pair := range 3 {
+		a, b := bySlot[2*pair], bySlot[2*pair+1]
+		if a.WhiteID != 0 || b.WhiteID != 1 {
+			t.Fatalf("bad colors in pair %v", pair)
+		}
+		if !slices.Equal(a.Job.StartMoves, b.Job.StartMoves) {
+			t.Fatalf("different openings in pair %v: %v and %v", pair, a.Job.StartMoves, b.Job.StartMoves)
+		}
+	}
+
+	// The games are finished out of order, so only the games of the same pair are paired.
+	for _, tc := range []struct {
+		slot     int64
+		score    int64
+		expected stat.Pentanomial
+	}{
+		{slot: 0, score: 2, expected: stat.Pentanomial{}},
+		{slot: 2, score: 1, expected: stat.Pentanomial{}},
+		{slot: 4, score: 2, expected: stat.Pentanomial{}},
+		{slot: 1, score: 0, expected: stat.Pentanomial{0, 0, 1, 0, 0}},
+		{slot: 3, score: 1, expected: stat.Pentanomial{0, 0, 2, 0, 0}},
+		{slot: 5, score: 2, expected: stat.Pentanomial{0, 0, 2, 0, 1}},
+	} {
+		finishTestJob(t, s, bySlot[tc.slot], tc.score)
+		penta, ok := s.Data().Match.Pentanomial()
+		if !ok {
+			t.Fatalf("no pentanomial after slot %v", tc.slot)
+		}
+		if penta != tc.expected {
+			t.Fatalf("bad pentanomial after slot %v: expected = %v, got = %v", tc.slot, tc.expected, penta)
+		}
+	}
+	if got, expected := s.Data().Match.Status(), (stat.Status{Win: 3, Draw: 2, Lose: 1}); got != expected {
+		t.Fatalf("bad status: expected = %+v, got = %+v", expected, got)
+	}
+}
@@ -7,17 +7,59 @@ import (
 	"github.com/alex65536/day20/internal/roomkeeper"
 )
 
-var ErrNoSuchContest = errors.New("no such contest")
+var (
+	ErrNoSuchContest = errors.New("no such contest")
+	ErrNoSuchJob     = errors.New("no such job")
+	ErrNoSuchEvent   = errors.New("no such event")
+	ErrNoSuchBook    = errors.New("no such book")
+	ErrNoSuchPreset  = errors.New("no such preset")
+
+	ErrContestStarted = errors.New("contest already started")
+	ErrQuotaExceeded  = errors.New("quota exceeded")
+)
+
+// JobFinish is a finished job to be saved, along with the contest state after the job. Data is nil
+// if the contest state must not be updated.
+type JobFinish struct {
+	Data *ContestData
+	Job  *FinishedJob
+}
 
 type DB interface {
 	ListActiveRooms(ctx context.Context) ([]roomkeeper.RoomFullData, error)
 	ListRunningContestsFull(ctx context.Context) ([]ContestFullData, error)
 	ListRunningJobs(ctx context.Context) ([]RunningJob, error)
 	ListContests(ctx context.Context) ([]ContestFullData, error)
+	ListContestsFiltered(ctx context.Context, filter ContestFilter) ([]ContestFullData, error)
 	CreateContest(ctx context.Context, info ContestInfo, data ContestData) error
 	UpdateContest(ctx context.Context, contestID string, data ContestData) error
+	UpdateContestSettings(ctx context.Context, contestID string, settings ContestSettings) error
+	UpdateContestQueuePositions(ctx context.Context, positions map[string]uint64) error
 	GetContest(ctx context.Context, contestID string) (ContestInfo, ContestData, error)
 	CreateRunningJob(ctx context.Context, job *RunningJob) error
 	FinishRunningJob(ctx context.Context, data *ContestData, job *FinishedJob) error
+	FinishRunningJobs(ctx context.Context, jobs []JobFinish) error
 	ListContestSucceededJobs(ctx context.Context, contestID string) ([]FinishedJob, error)
+	ListContestFinishedJobs(ctx context.Context, contestID string, offset, limit int) ([]FinishedJob, error)
+	GetContestFinishedJob(ctx context.Context, contestID string, jobID string) (FinishedJob, error)
+	GetContestSucceededJob(ctx context.Context, contestID string, index int64) (FinishedJob, error)
+	GetFinishedJob(ctx context.Context, jobID string) (FinishedJob, error)
+	ListFailedJobs(ctx context.Context, roomID string, offset, limit int) ([]FinishedJob, error)
+	ListGames(ctx context.Context, filter GameFilter) ([]Game, error)
+	CreateEvent(ctx context.Context, event Event) error
+	GetEvent(ctx context.Context, eventID string) (Event, error)
+	ListEvents(ctx context.Context) ([]Event, error)
+	ListEventContests(ctx context.Context, eventID string) ([]ContestFullData, error)
+	ListGroupContests(ctx context.Context, groupID string) ([]ContestFullData, error)
+	CreateStoredBook(ctx context.Context, book StoredBook) error
+	GetStoredBook(ctx context.Context, bookID string) (StoredBook, error)
+	ListStoredBooks(ctx context.Context) ([]StoredBook, error)
+	CreateContestPreset(ctx context.Context, preset ContestPreset) error
+	GetContestPreset(ctx context.Context, presetID string) (ContestPreset, error)
+	ListContestPresets(ctx context.Context) ([]ContestPreset, error)
+	DeleteContestPreset(ctx context.Context, presetID string) error
+}
+
+type Notifier interface {
+	OnContestFinished(info ContestInfo, data ContestData)
 }
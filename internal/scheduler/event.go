@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/alex65536/day20/internal/util/idgen"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+const (
+	EventNameMaxLen        = 128
+	EventDescriptionMaxLen = 4096
+)
+
+// Event groups related contests, e.g. all the matches played to test a single engine release.
+type Event struct {
+	ID          string `gorm:"primaryKey"`
+	Name        string
+	Description string
+	CreatedAt   timeutil.UTCTime
+}
+
+func (e *Event) Validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("no event name")
+	}
+	if utf8.RuneCountInString(e.Name) > EventNameMaxLen {
+		return fmt.Errorf("event name exceeds %v runes", EventNameMaxLen)
+	}
+	if utf8.RuneCountInString(e.Description) > EventDescriptionMaxLen {
+		return fmt.Errorf("event description exceeds %v runes", EventDescriptionMaxLen)
+	}
+	return nil
+}
+
+func (s *Scheduler) CreateEvent(ctx context.Context, name, description string) (Event, error) {
+	event := Event{
+		ID:          idgen.ID(),
+		Name:        name,
+		Description: description,
+		CreatedAt:   timeutil.NowUTC(),
+	}
+	if err := event.Validate(); err != nil {
+		return Event{}, fmt.Errorf("invalid event: %w", err)
+	}
+	if err := s.db.CreateEvent(ctx, event); err != nil {
+		return Event{}, fmt.Errorf("create event: %w", err)
+	}
+	return event, nil
+}
+
+func (s *Scheduler) GetEvent(ctx context.Context, eventID string) (Event, error) {
+	return s.db.GetEvent(ctx, eventID)
+}
+
+func (s *Scheduler) ListEvents(ctx context.Context) ([]Event, error) {
+	events, err := s.db.ListEvents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list events: %w", err)
+	}
+	return events, nil
+}
+
+func (s *Scheduler) ListEventContests(ctx context.Context, eventID string, viewer Viewer) ([]ContestFullData, error) {
+	contests, err := s.db.ListEventContests(ctx, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("list contests: %w", err)
+	}
+	return filterListed(contests, viewer), nil
+}
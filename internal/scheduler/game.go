@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/opening"
+	"github.com/alex65536/day20/internal/util/timeutil"
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/util/maybe"
+)
+
+func buildGame(job *FinishedJob, game *battle.GameExt, finishedAt timeutil.UTCTime) *Game {
+	var startFEN *string
+	if job.Job.StartBoard != nil {
+		fen := job.Job.StartBoard.FEN()
+		startFEN = &fen
+	}
+	openingMoves := make([]string, len(job.Job.StartMoves))
+	for i, mv := range job.Job.StartMoves {
+		openingMoves[i] = mv.String()
+	}
+	startedAt := finishedAt
+	if !game.StartTime.IsZero() {
+		startedAt = timeutil.UTCTime(game.StartTime.UTC())
+	}
+	var eco string
+	if e, ok := opening.ClassifyECO(game.Game); ok {
+		eco = e.Code
+	}
+	return &Game{
+		JobID:      job.Job.ID,
+		ContestID:  job.ContestID,
+		Index:      job.Index,
+		White:      job.Job.White.Name,
+		Black:      job.Job.Black.Name,
+		Result:     job.GameResult,
+		Verdict:    game.Game.Outcome().Verdict(),
+		StartFEN:   startFEN,
+		Opening:    strings.Join(openingMoves, " "),
+		ECO:        eco,
+		BookPlies:  int64(len(job.Job.StartMoves)),
+		Plies:      int64(game.Game.Len()),
+		StartedAt:  startedAt,
+		FinishedAt: finishedAt,
+	}
+}
+
+// GameFromPGN builds the game from the PGN stored in the finished job. It is used for the jobs which
+// finished before the games were recorded. The finish time is estimated from the job start time and
+// duration if they are known.
+func GameFromPGN(job *FinishedJob) (*Game, error) {
+	if job.PGN == nil {
+		return nil, fmt.Errorf("no pgn")
+	}
+	game, err := battle.GameExtFromPGN(*job.PGN)
+	if err != nil {
+		return nil, fmt.Errorf("parse pgn: %w", err)
+	}
+	finishedAt := timeutil.NowUTC()
+	switch {
+	case job.StartedAt != nil:
+		finishedAt = job.StartedAt.Add(job.Duration)
+	case !game.StartTime.IsZero():
+		finishedAt = timeutil.UTCTime(game.StartTime.UTC())
+	}
+	return buildGame(job, game, finishedAt), nil
+}
+
+type GameEngineResult int
+
+const (
+	GameEngineAnyResult GameEngineResult = iota
+	GameEngineWin
+	GameEngineDraw
+	GameEngineLoss
+)
+
+type GameFilter struct {
+	ContestID    string
+	Engine       string
+	EngineResult GameEngineResult
+	Result       maybe.Maybe[chess.Status]
+	Verdict      maybe.Maybe[chess.Verdict]
+	MinPlies     int64
+	MaxPlies     int64
+	Offset       int
+	Limit        int
+	Viewer       Viewer
+}
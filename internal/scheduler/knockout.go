@@ -0,0 +1,259 @@
+package scheduler
+
+import (
+	"slices"
+
+	"github.com/alex65536/day20/internal/util/sliceutil"
+)
+
+type KnockoutTiebreak int
+
+const (
+	// KnockoutTiebreakSeed lets the higher seeded player advance if the tie is level.
+	KnockoutTiebreakSeed KnockoutTiebreak = iota
+	// KnockoutTiebreakPairs plays extra pairs of games with alternating colors.
+	KnockoutTiebreakPairs
+	// KnockoutTiebreakSuddenDeath plays extra games until the first decisive one.
+	KnockoutTiebreakSuddenDeath
+	KnockoutTiebreakMax
+)
+
+func (t KnockoutTiebreak) String() string {
+	switch t {
+	case KnockoutTiebreakSeed:
+		return "seed"
+	case KnockoutTiebreakPairs:
+		return "pairs"
+	case KnockoutTiebreakSuddenDeath:
+		return "sudden_death"
+	default:
+		return "?"
+	}
+}
+
+func (t KnockoutTiebreak) PrettyString() string {
+	switch t {
+	case KnockoutTiebreakSeed:
+		return "Higher seed advances"
+	case KnockoutTiebreakPairs:
+		return "Extra pairs of games"
+	case KnockoutTiebreakSuddenDeath:
+		return "Sudden death"
+	default:
+		return "?"
+	}
+}
+
+func KnockoutTiebreakFromString(s string) (KnockoutTiebreak, bool) {
+	for t := range KnockoutTiebreakMax {
+		if t.String() == s {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+type KnockoutSettings struct {
+	// GamesPerTie is the length of the mini-match played in each tie.
+	GamesPerTie int64
+	Tiebreak    KnockoutTiebreak
+	// TiebreakGames limits the number of extra games in a tie. If the tie is still level after
+	// them, the higher seeded player advances.
+	TiebreakGames int64
+}
+
+func (s KnockoutSettings) Clone() KnockoutSettings {
+	return s
+}
+
+// KnockoutTie is a mini-match between two players in the bracket. The players are seeded in the
+// order they are listed in the contest settings.
+type KnockoutTie struct {
+	// First and Second are the indices in the player list, or -1 if the player is not known yet.
+	// Once both are known, First is the higher seeded one.
+	First  int `json:"first"`
+	Second int `json:"second"`
+	// Scores are in half-points.
+	FirstScore  int64 `json:"first_score"`
+	SecondScore int64 `json:"second_score"`
+	Played      int64 `json:"played"`
+	// Inverted is the number of played games in which Second had White.
+	Inverted int64 `json:"inverted"`
+	// Extra is the number of tiebreak games scheduled so far.
+	Extra int64 `json:"extra,omitempty"`
+	// Winner is the player who advances, or -1 if the tie is not decided yet.
+	Winner int `json:"winner"`
+	// Bye is set if First advances without playing, as there is no opponent.
+	Bye bool `json:"bye,omitempty"`
+}
+
+// IsReady reports whether the tie has both players known and is not decided yet.
+func (t KnockoutTie) IsReady() bool {
+	return t.First >= 0 && t.Second >= 0 && t.Winner < 0
+}
+
+// addToSchedule adds the games of the tie which are not played yet. The colors alternate, starting
+// with First having White.
+func (t KnockoutTie) addToSchedule(s *Schedule, settings *KnockoutSettings) {
+	total := settings.GamesPerTie + t.Extra
+	_ = s.Add(ScheduleKey{WhiteID: t.First, BlackID: t.Second}, (total+1)/2-(t.Played-t.Inverted))
+	_ = s.Add(ScheduleKey{WhiteID: t.Second, BlackID: t.First}, total/2-t.Inverted)
+}
+
+type KnockoutData struct {
+	// Bracket contains the ties of each round, the last round being the final.
+	Bracket [][]KnockoutTie `gorm:"serializer:json"`
+}
+
+func newKnockoutData(players int, settings *KnockoutSettings) KnockoutData {
+	size := 1
+	for size < players {
+		size *= 2
+	}
+	// Standard seeding, so the top seeds meet as late as possible.
+	order := []int{0}
+	for len(order) < size {
+		m := 2 * len(order)
+		next := make([]int, 0, m)
+		for _, s := range order {
+			next = append(next, s, m-1-s)
+		}
+		order = next
+	}
+
+	var d KnockoutData
+	for n := size / 2; n >= 1; n /= 2 {
+		round := make([]KnockoutTie, n)
+		for i := range round {
+			round[i] = KnockoutTie{First: -1, Second: -1, Winner: -1}
+		}
+		d.Bracket = append(d.Bracket, round)
+	}
+	for i := range d.Bracket[0] {
+		t := &d.Bracket[0][i]
+		t.First = order[2*i]
+		if order[2*i+1] < players {
+			t.Second = order[2*i+1]
+			continue
+		}
+		t.Bye = true
+		t.Winner = t.First
+		d.advance(0, i, nil, settings)
+	}
+	return d
+}
+
+func (d KnockoutData) Clone() KnockoutData {
+	d.Bracket = sliceutil.Map(d.Bracket, func(r []KnockoutTie) []KnockoutTie {
+		return slices.Clone(r)
+	})
+	return d
+}
+
+// Winner returns the winner of the tournament, or -1 if the final is not decided yet.
+func (d KnockoutData) Winner() int {
+	if len(d.Bracket) == 0 {
+		return -1
+	}
+	return d.Bracket[len(d.Bracket)-1][0].Winner
+}
+
+// Decided returns the number of ties which are decided over the board.
+func (d KnockoutData) Decided() int64 {
+	decided := int64(0)
+	for _, round := range d.Bracket {
+		for _, t := range round {
+			if t.Winner >= 0 && !t.Bye {
+				decided++
+			}
+		}
+	}
+	return decided
+}
+
+func (d KnockoutData) addToSchedule(s *Schedule, settings *KnockoutSettings) {
+	for _, round := range d.Bracket {
+		for _, t := range round {
+			if t.IsReady() {
+				t.addToSchedule(s, settings)
+			}
+		}
+	}
+}
+
+// advance moves the winner of the tie to the next round. If the next tie becomes ready, its games
+// are added to the schedule s, unless it is nil.
+func (d *KnockoutData) advance(round, idx int, s *Schedule, settings *KnockoutSettings) {
+	if round+1 >= len(d.Bracket) {
+		return
+	}
+	winner := d.Bracket[round][idx].Winner
+	next := &d.Bracket[round+1][idx/2]
+	if idx%2 == 0 {
+		next.First = winner
+	} else {
+		next.Second = winner
+	}
+	if next.First < 0 || next.Second < 0 {
+		return
+	}
+	if next.First > next.Second {
+		next.First, next.Second = next.Second, next.First
+	}
+	if s != nil {
+		next.addToSchedule(s, settings)
+	}
+}
+
+// addResult records the result of the game between white and black. Score is the score of White in
+// half-points. Once all the games in the tie are played, either the winner advances or the tiebreak
+// games are scheduled. New games are added to the schedule s. It returns false if there is no such
+// tie in progress.
+func (d *KnockoutData) addResult(white, black int, score int64, s *Schedule, settings *KnockoutSettings) bool {
+	for r := range d.Bracket {
+		for i := range d.Bracket[r] {
+			t := &d.Bracket[r][i]
+			if !t.IsReady() {
+				continue
+			}
+			switch {
+			case t.First == white && t.Second == black:
+				t.FirstScore += score
+				t.SecondScore += 2 - score
+			case t.First == black && t.Second == white:
+				t.FirstScore += 2 - score
+				t.SecondScore += score
+				t.Inverted++
+			default:
+				continue
+			}
+			t.Played++
+			if t.Played < settings.GamesPerTie+t.Extra {
+				return true
+			}
+			switch {
+			case t.FirstScore > t.SecondScore:
+				t.Winner = t.First
+			case t.FirstScore < t.SecondScore:
+				t.Winner = t.Second
+			default:
+				var more int64
+				switch settings.Tiebreak {
+				case KnockoutTiebreakPairs:
+					more = 2
+				case KnockoutTiebreakSuddenDeath:
+					more = 1
+				}
+				if more != 0 && t.Extra+more <= settings.TiebreakGames {
+					t.Extra += more
+					t.addToSchedule(s, settings)
+					return true
+				}
+				t.Winner = t.First
+			}
+			d.advance(r, i, s, settings)
+			return true
+		}
+	}
+	return false
+}
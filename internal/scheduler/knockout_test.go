@@ -0,0 +1,184 @@
+package scheduler
+
+import (
+	"slices"
+	"testing"
+)
+
+// playKnockout plays all the games of the knockout. The result function returns the score of White
+// in half-points. It returns the final data and the number of games played.
+func playKnockout(
+	t *testing.T,
+	players int,
+	settings KnockoutSettings,
+	result func(white, black int) int64,
+) (KnockoutData, int) {
+	t.Helper()
+	d := newKnockoutData(players, &settings)
+	s := NewSchedule()
+	d.addToSchedule(&s, &settings)
+	games := 0
+	for {
+		k, ok := s.Peek()
+		if !ok {
+			return d, games
+		}
+		s.Dec(k)
+		if !d.addResult(k.WhiteID, k.BlackID, result(k.WhiteID, k.BlackID), &s, &settings) {
+			t.Fatalf("cannot add result for %v-%v", k.WhiteID, k.BlackID)
+		}
+		games++
+		if games > 1000 {
+			t.Fatalf("too many games")
+		}
+	}
+}
+
+// lowerWins makes the player with the lower index win each game.
+func lowerWins(white, black int) int64 {
+	if white < black {
+		return 2
+	}
+	return 0
+}
+
+func allDraws(_, _ int) int64 {
+	return 1
+}
+
+func TestKnockoutBracket(t *testing.T) {
+	settings := KnockoutSettings{GamesPerTie: 2}
+	d := newKnockoutData(5, &settings)
+	if got := len(d.Bracket); got != 3 {
+		t.Fatalf("bad number of rounds: expected = 3, got = %v", got)
+	}
+	type tie struct{ first, second, winner int }
+	for i, expected := range [][]tie{
+		// The top seeds get the byes and meet as late as possible.
+		{{0, -1, 0}, {3, 4, -1}, {1, -1, 1}, {2, -1, 2}},
+		{{0, -1, -1}, {1, 2, -1}},
+		{{-1, -1, -1}},
+	} {
+		var got []tie
+		for _, k := range d.Bracket[i] {
+			got = append(got, tie{k.First, k.Second, k.Winner})
+		}
+		if !slices.Equal(got, expected) {
+			t.Fatalf("bad round %v: expected = %v, got = %v", i+1, expected, got)
+		}
+	}
+
+	s := NewSchedule()
+	d.addToSchedule(&s, &settings)
+	for _, k := range []ScheduleKey{{3, 4}, {4, 3}, {1, 2}, {2, 1}} {
+		if got := s.Count(k); got != 1 {
+			t.Fatalf("bad count for %v: expected = 1, got = %v", k, got)
+		}
+	}
+	if got := s.Total(); got != 4 {
+		t.Fatalf("bad total: expected = 4, got = %v", got)
+	}
+}
+
+func TestKnockoutPlay(t *testing.T) {
+	for _, tc := range []struct {
+		players int
+		games   int
+		decided int64
+	}{
+		{players: 2, games: 2, decided: 1},
+		{players: 4, games: 6, decided: 3},
+		{players: 5, games: 8, decided: 4},
+		{players: 8, games: 14, decided: 7},
+	} {
+		d, games := playKnockout(t, tc.players, KnockoutSettings{GamesPerTie: 2}, lowerWins)
+		if got := d.Winner(); got != 0 {
+			t.Fatalf("bad winner with %v players: expected = 0, got = %v", tc.players, got)
+		}
+		if games != tc.games {
+			t.Fatalf("bad number of games with %v players: expected = %v, got = %v", tc.players, tc.games, games)
+		}
+		if got := d.Decided(); got != tc.decided {
+			t.Fatalf("bad number of decided ties with %v players: expected = %v, got = %v", tc.players, tc.decided, got)
+		}
+		for _, round := range d.Bracket {
+			for _, tie := range round {
+				if !tie.Bye && tie.Inverted != tie.Played/2 {
+					t.Fatalf("colors not balanced in tie %+v", tie)
+				}
+			}
+		}
+	}
+}
+
+func TestKnockoutUpset(t *testing.T) {
+	// The higher index always wins, so the lowest seed wins the tournament.
+	d, _ := playKnockout(t, 4, KnockoutSettings{GamesPerTie: 2}, func(white, black int) int64 {
+		return 2 - lowerWins(white, black)
+	})
+	if got := d.Winner(); got != 3 {
+		t.Fatalf("bad winner: expected = 3, got = %v", got)
+	}
+	final := d.Bracket[1][0]
+	// The higher seeded player is listed first.
+	if final.First != 2 || final.Second != 3 {
+		t.Fatalf("bad final: %+v", final)
+	}
+}
+
+func TestKnockoutTiebreak(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		settings KnockoutSettings
+		result   func(white, black int) int64
+		games    int
+		winner   int
+	}{
+		{
+			name:     "seed",
+			settings: KnockoutSettings{GamesPerTie: 2, Tiebreak: KnockoutTiebreakSeed, TiebreakGames: 4},
+			result:   allDraws,
+			games:    2,
+			winner:   0,
+		},
+		{
+			name:     "pairs",
+			settings: KnockoutSettings{GamesPerTie: 2, Tiebreak: KnockoutTiebreakPairs, TiebreakGames: 4},
+			result:   allDraws,
+			games:    6,
+			winner:   0,
+		},
+		{
+			name:     "sudden death",
+			settings: KnockoutSettings{GamesPerTie: 2, Tiebreak: KnockoutTiebreakSuddenDeath, TiebreakGames: 4},
+			// The match games are drawn, and the first tiebreak game is won by Black.
+			result: func() func(white, black int) int64 {
+				played := 0
+				return func(_, _ int) int64 {
+					played++
+					if played <= 2 {
+						return 1
+					}
+					return 0
+				}
+			}(),
+			games:  3,
+			winner: 1,
+		},
+		{
+			name:     "sudden death limit",
+			settings: KnockoutSettings{GamesPerTie: 2, Tiebreak: KnockoutTiebreakSuddenDeath, TiebreakGames: 3},
+			result:   allDraws,
+			games:    5,
+			winner:   0,
+		},
+	} {
+		d, games := playKnockout(t, 2, tc.settings, tc.result)
+		if games != tc.games {
+			t.Fatalf("%v: bad number of games: expected = %v, got = %v", tc.name, tc.games, games)
+		}
+		if got := d.Winner(); got != tc.winner {
+			t.Fatalf("%v: bad winner: expected = %v, got = %v", tc.name, tc.winner, got)
+		}
+	}
+}
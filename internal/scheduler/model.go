@@ -2,6 +2,8 @@ package scheduler
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"time"
 	"unicode/utf8"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/alex65536/day20/internal/stat"
 	"github.com/alex65536/day20/internal/util/clone"
 	"github.com/alex65536/day20/internal/util/randutil"
+	"github.com/alex65536/day20/internal/util/timeutil"
 	"github.com/alex65536/go-chess/chess"
 	"github.com/alex65536/go-chess/clock"
 )
@@ -21,12 +24,18 @@ type ContestKind int
 const (
 	ContestUnknownKind ContestKind = iota
 	ContestMatch
+	ContestSwiss
+	ContestKnockout
 )
 
 func (k ContestKind) PrettyString() string {
 	switch k {
 	case ContestMatch:
 		return "Match"
+	case ContestSwiss:
+		return "Swiss"
+	case ContestKnockout:
+		return "Knockout"
 	default:
 		return "?"
 	}
@@ -76,6 +85,50 @@ func (k ContestStatusKind) IsFinished() bool {
 	return k == ContestSucceeded || k == ContestAborted || k == ContestFailed
 }
 
+type ContestVisibility int
+
+const (
+	ContestPublic ContestVisibility = iota
+	ContestUnlisted
+	ContestPrivate
+	ContestVisibilityMax
+)
+
+func (v ContestVisibility) String() string {
+	switch v {
+	case ContestPublic:
+		return "public"
+	case ContestUnlisted:
+		return "unlisted"
+	case ContestPrivate:
+		return "private"
+	default:
+		return "?"
+	}
+}
+
+func (v ContestVisibility) PrettyString() string {
+	switch v {
+	case ContestPublic:
+		return "Public"
+	case ContestUnlisted:
+		return "Unlisted"
+	case ContestPrivate:
+		return "Private"
+	default:
+		return "?"
+	}
+}
+
+func ContestVisibilityFromString(s string) (ContestVisibility, bool) {
+	for v := range ContestVisibilityMax {
+		if v.String() == s {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
 type ContestStatus struct {
 	Kind   ContestStatusKind `gorm:"index"`
 	Reason string
@@ -105,9 +158,14 @@ type ContestSettings struct {
 	OpeningBook    OpeningBook    `gorm:"embedded;embeddedPrefix:opening_"`
 	ScoreThreshold int32
 	TimeMargin     *time.Duration
+	MoveOverhead   *time.Duration
 	Kind           ContestKind
 	Players        []roomapi.JobEngine `gorm:"serializer:json"`
 	Match          *MatchSettings      `gorm:"-"`
+	Swiss          *SwissSettings      `gorm:"-"`
+	Knockout       *KnockoutSettings   `gorm:"-"`
+	EventID        *string             `gorm:"index"`
+	Visibility     ContestVisibility   `gorm:"index"`
 }
 
 func (s *ContestSettings) Validate() error {
@@ -127,15 +185,27 @@ func (s *ContestSettings) Validate() error {
 			return fmt.Errorf("time control: %w", err)
 		}
 	}
-	_, err := s.OpeningBook.Book(randutil.DefaultSource())
-	if err != nil {
-		return fmt.Errorf("opening book: %w", err)
+	if s.OpeningBook.Kind == OpeningsStored {
+		// Stored books are checked on contest creation, as they reside in the database.
+		if s.OpeningBook.Data == "" {
+			return fmt.Errorf("opening book: no stored book id")
+		}
+	} else {
+		_, err := s.OpeningBook.Book(randutil.DefaultSource())
+		if err != nil {
+			return fmt.Errorf("opening book: %w", err)
+		}
 	}
 	if s.TimeMargin != nil {
 		if *s.TimeMargin < 0 {
 			return fmt.Errorf("non-positive time margin")
 		}
 	}
+	if s.MoveOverhead != nil {
+		if *s.MoveOverhead < 0 {
+			return fmt.Errorf("negative move overhead")
+		}
+	}
 	switch s.Kind {
 	case ContestMatch:
 		if len(s.Players) != 2 {
@@ -144,26 +214,137 @@ func (s *ContestSettings) Validate() error {
 		if s.Match == nil {
 			return fmt.Errorf("no match data")
 		}
-		if s.Match.Games <= 0 {
+		if s.Match.Wins < 0 {
+			return fmt.Errorf("bad number of wins")
+		}
+		if !s.Match.IsFirstTo() && s.Match.Games <= 0 {
 			return fmt.Errorf("bad number of games")
 		}
+	case ContestSwiss:
+		if len(s.Players) < 3 {
+			return fmt.Errorf("bad player count")
+		}
+		if s.Swiss == nil {
+			return fmt.Errorf("no swiss data")
+		}
+		if s.Swiss.Rounds <= 0 {
+			return fmt.Errorf("bad number of rounds")
+		}
+	case ContestKnockout:
+		if len(s.Players) < 2 {
+			return fmt.Errorf("bad player count")
+		}
+		if s.Knockout == nil {
+			return fmt.Errorf("no knockout data")
+		}
+		if s.Knockout.GamesPerTie <= 0 {
+			return fmt.Errorf("bad number of games per tie")
+		}
+		if s.Knockout.Tiebreak < 0 || s.Knockout.Tiebreak >= KnockoutTiebreakMax {
+			return fmt.Errorf("bad tiebreak")
+		}
+		if s.Knockout.TiebreakGames < 0 {
+			return fmt.Errorf("bad number of tiebreak games")
+		}
 	default:
 		return fmt.Errorf("bad contest type")
 	}
+	if s.Visibility < 0 || s.Visibility >= ContestVisibilityMax {
+		return fmt.Errorf("bad contest visibility")
+	}
 	return nil
 }
 
+// EstimatedGames returns the number of games used to account the contest in quotas.
+func (s *ContestSettings) EstimatedGames() int64 {
+	switch {
+	case s.Kind == ContestMatch && s.Match != nil:
+		return s.Match.EstimatedGames()
+	case s.Kind == ContestSwiss && s.Swiss != nil:
+		return s.Swiss.Rounds * int64(len(s.Players)/2)
+	case s.Kind == ContestKnockout && s.Knockout != nil:
+		return int64(len(s.Players)-1) * s.Knockout.GamesPerTie
+	default:
+		return 0
+	}
+}
+
+// nominalMoves is the number of moves used to estimate the duration of the game.
+const nominalMoves = 40
+
+// NominalTime returns the thinking time of one side in the first nominalMoves moves. It is used to
+// tell the long time control contests from the short ones. Zero is returned if the contest has no
+// time limit.
+func (s *ContestSettings) NominalTime() time.Duration {
+	switch {
+	case s.FixedTime != nil:
+		return nominalMoves * *s.FixedTime
+	case s.TimeControl != nil:
+		return max(nominalSideTime(s.TimeControl.White), nominalSideTime(s.TimeControl.Black))
+	default:
+		return 0
+	}
+}
+
+func nominalSideTime(c clock.ControlSide) time.Duration {
+	var total time.Duration
+	moves := 0
+	for i := 0; moves < nominalMoves && len(c) != 0; i++ {
+		// The last item repeats if it has a move limit.
+		item := c[min(i, len(c)-1)]
+		n := nominalMoves - moves
+		if item.Moves > 0 {
+			n = min(n, item.Moves)
+		}
+		total += item.Time + time.Duration(n)*item.Inc
+		moves += n
+	}
+	return total
+}
+
 func (s ContestSettings) Clone() ContestSettings {
 	s.FixedTime = clone.TrivialPtr(s.FixedTime)
 	s.TimeControl = clone.Ptr(s.TimeControl)
 	s.TimeMargin = clone.TrivialPtr(s.TimeMargin)
+	s.MoveOverhead = clone.TrivialPtr(s.MoveOverhead)
 	s.Players = clone.DeepSlice(s.Players)
 	s.Match = clone.Ptr(s.Match)
+	s.Swiss = clone.Ptr(s.Swiss)
+	s.Knockout = clone.Ptr(s.Knockout)
+	s.EventID = clone.TrivialPtr(s.EventID)
 	return s
 }
 
 type MatchSettings struct {
 	Games int64
+
+	// Wins is the number of wins required to finish the match. If it is positive, the match goes on
+	// until one of the players reaches Wins wins, draws are not counted, and Games is ignored.
+	Wins int64
+}
+
+// IsFirstTo reports whether the match is played until one of the players reaches Wins wins.
+func (s MatchSettings) IsFirstTo() bool {
+	return s.Wins > 0
+}
+
+// Progress returns the progress of the match. For matches with a fixed number of games, these are the
+// numbers of games played and total games. For first-to-N matches, the leader's wins and the target
+// number of wins are returned instead.
+func (s MatchSettings) Progress(d MatchData) (done, total int64) {
+	if s.IsFirstTo() {
+		return d.MaxWins(), s.Wins
+	}
+	return d.Played(), s.Games
+}
+
+// EstimatedGames returns the number of games used to account the match in quotas. First-to-N matches
+// have no upper bound, so the number of games needed to finish them without draws is used.
+func (s MatchSettings) EstimatedGames() int64 {
+	if s.IsFirstTo() {
+		return 2*s.Wins - 1
+	}
+	return s.Games
 }
 
 func (s MatchSettings) Clone() MatchSettings {
@@ -171,7 +352,11 @@ func (s MatchSettings) Clone() MatchSettings {
 }
 
 type ContestInfo struct {
-	ID string `gorm:"primaryKey"`
+	ID      string `gorm:"primaryKey"`
+	OwnerID string `gorm:"index"`
+	// GroupID links the sub-contests of one logical contest, e.g. the same match played at several
+	// time controls. It is the ID of the first sub-contest, or nil if the contest is standalone.
+	GroupID *string `gorm:"index"`
 	ContestSettings
 	PosInQueue uint64
 }
@@ -190,12 +375,44 @@ func (i *ContestInfo) NewData() ContestData {
 				Inverted:  0,
 			},
 		}
+	case ContestSwiss:
+		swiss := newSwissData(len(i.Players))
+		return ContestData{
+			Status:     NewStatusRunning(),
+			LastIndex:  0,
+			FailedJobs: 0,
+			Swiss:      &swiss,
+		}
+	case ContestKnockout:
+		knockout := newKnockoutData(len(i.Players), i.Knockout)
+		return ContestData{
+			Status:     NewStatusRunning(),
+			LastIndex:  0,
+			FailedJobs: 0,
+			Knockout:   &knockout,
+		}
 	default:
 		panic("must not happen")
 	}
 }
 
+// Progress returns the progress of the contest as the amount of work done and the total amount of
+// work. The units depend on the contest kind.
+func (i *ContestInfo) Progress(d *ContestData) (done, total int64) {
+	switch i.Kind {
+	case ContestMatch:
+		return i.Match.Progress(*d.Match)
+	case ContestSwiss:
+		return d.LastIndex, i.EstimatedGames()
+	case ContestKnockout:
+		return d.Knockout.Decided(), int64(len(i.Players) - 1)
+	default:
+		return 0, 0
+	}
+}
+
 func (i ContestInfo) Clone() ContestInfo {
+	i.GroupID = clone.TrivialPtr(i.GroupID)
 	i.ContestSettings = i.ContestSettings.Clone()
 	return i
 }
@@ -204,11 +421,43 @@ type ContestData struct {
 	Status     ContestStatus `gorm:"embedded;embeddedPrefix:status_"`
 	LastIndex  int64
 	FailedJobs int64
-	Match      *MatchData `gorm:"-"`
+	FinishedAt *timeutil.UTCTime `gorm:"index"`
+	ArchivedAt *timeutil.UTCTime `gorm:"index"`
+	PGNPruned  bool
+	Match      *MatchData    `gorm:"-"`
+	Swiss      *SwissData    `gorm:"-"`
+	Knockout   *KnockoutData `gorm:"-"`
+
+	// IllegalMoves counts the games lost because of an illegal move. Such games are not failed jobs.
+	IllegalMoves int64
+
+	// OpeningSlots is the number of game slots handed out so far in the contests other than
+	// matches. The slots of aborted and failed jobs are put into FreeOpeningSlots to be reused by
+	// their retries.
+	OpeningSlots     int64
+	FreeOpeningSlots []FreeOpeningSlot `gorm:"serializer:json"`
+
+	// Retries contains the history of attempts for each schedule key, so the flaky engines and rooms
+	// can be spotted.
+	Retries []RetryStats `gorm:"serializer:json"`
+}
+
+func (d *ContestData) SetStatus(status ContestStatus) {
+	d.Status = status
+	if status.Kind.IsFinished() && d.FinishedAt == nil {
+		now := timeutil.NowUTC()
+		d.FinishedAt = &now
+	}
 }
 
 func (d ContestData) Clone() ContestData {
+	d.FinishedAt = clone.TrivialPtr(d.FinishedAt)
+	d.ArchivedAt = clone.TrivialPtr(d.ArchivedAt)
 	d.Match = clone.Ptr(d.Match)
+	d.Swiss = clone.Ptr(d.Swiss)
+	d.Knockout = clone.Ptr(d.Knockout)
+	d.FreeOpeningSlots = slices.Clone(d.FreeOpeningSlots)
+	d.Retries = clone.DeepSlice(d.Retries)
 	return d
 }
 
@@ -217,6 +466,59 @@ type MatchData struct {
 	Draw      int64 `gorm:"column:draw"`
 	SecondWin int64 `gorm:"column:w2"`
 	Inverted  int64
+
+	// A game pair consists of the games in slots 2N and 2N+1, which are played on the same opening
+	// with colors reversed. Penta0..Penta4 count the pairs where both games are finished by the score
+	// of the first player, and PendingPairs maps the pairs with only one finished game to the score
+	// of the first player in it. All scores are in half-points.
+	Penta0       int64           `gorm:"column:penta0"`
+	Penta1       int64           `gorm:"column:penta1"`
+	Penta2       int64           `gorm:"column:penta2"`
+	Penta3       int64           `gorm:"column:penta3"`
+	Penta4       int64           `gorm:"column:penta4"`
+	PendingPairs map[int64]int64 `gorm:"serializer:json"`
+
+	// DirectSlots and InvertedSlots are the numbers of game slots handed out for the games where the
+	// first player has White and Black respectively.
+	DirectSlots   int64
+	InvertedSlots int64
+}
+
+func (d *MatchData) addPairGame(pair int64, score int64) {
+	other, ok := d.PendingPairs[pair]
+	if !ok {
+		if d.PendingPairs == nil {
+			d.PendingPairs = make(map[int64]int64)
+		}
+		d.PendingPairs[pair] = score
+		return
+	}
+	delete(d.PendingPairs, pair)
+	switch other + score {
+	case 0:
+		d.Penta0++
+	case 1:
+		d.Penta1++
+	case 2:
+		d.Penta2++
+	case 3:
+		d.Penta3++
+	case 4:
+		d.Penta4++
+	default:
+		panic("must not happen")
+	}
+}
+
+// Pentanomial returns pentanomial statistics of the finished game pairs, provided that all the other
+// games are waiting for their pair. This may not hold for contests which started before pentanomial
+// statistics were introduced.
+func (d MatchData) Pentanomial() (stat.Pentanomial, bool) {
+	p := stat.Pentanomial{int(d.Penta0), int(d.Penta1), int(d.Penta2), int(d.Penta3), int(d.Penta4)}
+	if 2*int64(p.Pairs())+int64(len(d.PendingPairs)) != d.Played() {
+		return stat.Pentanomial{}, false
+	}
+	return p, true
 }
 
 func (d MatchData) Status() stat.Status {
@@ -228,6 +530,7 @@ func (d MatchData) Status() stat.Status {
 }
 
 func (d MatchData) Clone() MatchData {
+	d.PendingPairs = maps.Clone(d.PendingPairs)
 	return d
 }
 
@@ -235,20 +538,62 @@ func (d MatchData) Played() int64 {
 	return d.FirstWin + d.Draw + d.SecondWin
 }
 
+// MaxWins returns the number of wins of the leading player.
+func (d MatchData) MaxWins() int64 {
+	return max(d.FirstWin, d.SecondWin)
+}
+
 type ContestFullData struct {
 	Info ContestInfo
 	Data ContestData
 }
 
+type ContestSort int
+
+const (
+	// ContestSortCreated puts the newest contests first.
+	ContestSortCreated ContestSort = iota
+	// ContestSortFinished puts the recently finished contests first, and the running ones last.
+	ContestSortFinished
+)
+
+// ContestFilter selects the contests to list. Only the contests which can be listed by Viewer are
+// returned.
+type ContestFilter struct {
+	// Statuses are the allowed statuses. Empty means any status.
+	Statuses []ContestStatusKind
+	// Name is the substring to search in contest names.
+	Name    string
+	OwnerID string
+	// Time ranges, the lower bounds are inclusive and the upper ones are exclusive. Zero means no
+	// bound. Contests which are not finished never match the finish time range.
+	CreatedSince   time.Time
+	CreatedBefore  time.Time
+	FinishedSince  time.Time
+	FinishedBefore time.Time
+	Sort           ContestSort
+	Offset         int
+	Limit          int
+	Viewer         Viewer
+}
+
 type JobInfo struct {
 	Job       roomapi.Job `gorm:"embedded"`
 	ContestID string      `gorm:"index"`
 	WhiteID   int
 	BlackID   int
+	// StartedAt is the time when the job was given to a room.
+	StartedAt *timeutil.UTCTime
+	// OpeningSlot is the index of the game in the contest, which determines the opening if the
+	// openings are pinned. The retry of an unfinished game keeps its slot. It is nil for the jobs
+	// created before the slots were introduced.
+	OpeningSlot *int64
 }
 
 func (i JobInfo) Clone() JobInfo {
 	i.Job = i.Job.Clone()
+	i.StartedAt = clone.TrivialPtr(i.StartedAt)
+	i.OpeningSlot = clone.TrivialPtr(i.OpeningSlot)
 	return i
 }
 
@@ -267,10 +612,44 @@ type FinishedJob struct {
 	GameResult chess.Status         `gorm:"serializer:chess"`
 	Index      int64                `gorm:"index"`
 	PGN        *string
+	Game       *Game `gorm:"foreignKey:JobID;constraint:OnDelete:CASCADE"`
+
+	// RoomID is the room which played the job. Duration is the time passed since the job was given
+	// to the room. WhiteEngine and BlackEngine are the names reported by the engines via "id name".
+	// All these are empty for the jobs finished before they were recorded.
+	RoomID      string `gorm:"index"`
+	Duration    time.Duration
+	WhiteEngine string
+	BlackEngine string
 }
 
 func (j FinishedJob) Clone() FinishedJob {
 	j.JobInfo = j.JobInfo.Clone()
 	j.PGN = clone.TrivialPtr(j.PGN)
+	j.Game = clone.Ptr(j.Game)
 	return j
 }
+
+type Game struct {
+	JobID     string        `gorm:"primaryKey"`
+	ContestID string        `gorm:"index"`
+	Index     int64         `gorm:"index"`
+	White     string        `gorm:"index"`
+	Black     string        `gorm:"index"`
+	Result    chess.Status  `gorm:"serializer:chess;index"`
+	Verdict   chess.Verdict `gorm:"index"`
+	StartFEN  *string       `gorm:"column:start_fen"`
+	Opening   string        `gorm:"index"`
+	// ECO is the code of the opening by the Encyclopaedia of Chess Openings, or empty if the opening
+	// is not recognized.
+	ECO        string           `gorm:"column:eco;index"`
+	BookPlies  int64            `gorm:"index"`
+	Plies      int64            `gorm:"index"`
+	StartedAt  timeutil.UTCTime `gorm:"index"`
+	FinishedAt timeutil.UTCTime `gorm:"index"`
+}
+
+func (g Game) Clone() Game {
+	g.StartFEN = clone.TrivialPtr(g.StartFEN)
+	return g
+}
@@ -1,11 +1,16 @@
 package scheduler
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"hash/fnv"
 	"math/rand/v2"
+	"slices"
 	"strings"
 
 	"github.com/alex65536/day20/internal/opening"
+	"github.com/alex65536/day20/internal/util/randutil"
 )
 
 type OpeningBookKind string
@@ -15,6 +20,9 @@ const (
 	OpeningsPGNLine OpeningBookKind = "pgn_line"
 	OpeningsFEN     OpeningBookKind = "fen"
 	OpeningsBuiltin OpeningBookKind = "builtin"
+	// OpeningsStored refers to a StoredBook, with Data containing its ID. Such books must be resolved
+	// via Scheduler.ResolveBook before use.
+	OpeningsStored OpeningBookKind = "stored"
 
 	BuiltinBookGraham20141F = "graham_2014_1f"
 	BuiltinBookGBSelect2020 = "gb_select_2020"
@@ -23,12 +31,28 @@ const (
 type OpeningBook struct {
 	Kind OpeningBookKind
 	Data string
+	// MaxPlies and Dedup apply only to the books with PGN lines, i.e. to OpeningsPGNLine,
+	// OpeningsBuiltin and stored books with PGN lines.
+	MaxPlies int
+	Dedup    bool
+	// Pinned maps each game slot of the contest to a fixed book entry instead of picking a random
+	// one, so the aborted and retried games replay the same opening. Matches always map the slots
+	// this way, as both games of a pair must be played on the same opening, so for them Pinned only
+	// makes the linked sub-contests share the openings.
+	Pinned bool
+}
+
+func (b OpeningBook) lineOptions() opening.PGNLineBookOptions {
+	return opening.PGNLineBookOptions{
+		MaxPlies: b.MaxPlies,
+		Dedup:    b.Dedup,
+	}
 }
 
 func (b OpeningBook) Book(rnd rand.Source) (opening.Book, error) {
 	switch b.Kind {
 	case OpeningsPGNLine:
-		book, err := opening.NewPGNLineBook(strings.NewReader(b.Data), rnd)
+		book, err := opening.NewPGNLineBook(strings.NewReader(b.Data), rnd, b.lineOptions())
 		if err != nil {
 			return nil, fmt.Errorf("build pgn line book: %w", err)
 		}
@@ -42,13 +66,131 @@ func (b OpeningBook) Book(rnd rand.Source) (opening.Book, error) {
 	case OpeningsBuiltin:
 		switch b.Data {
 		case BuiltinBookGraham20141F:
-			return opening.Graham20141FBook(), nil
+			return opening.Graham20141FBook(rnd, b.lineOptions())
 		case BuiltinBookGBSelect2020:
-			return opening.GBSelect2020Book(), nil
+			return opening.GBSelect2020Book(rnd, b.lineOptions())
 		default:
 			return nil, fmt.Errorf("unknown builtin opening book: %q", b.Data)
 		}
+	case OpeningsStored:
+		return nil, fmt.Errorf("stored book not resolved")
 	default:
 		return nil, fmt.Errorf("bad book kind %q", b.Kind)
 	}
 }
+
+// Filter keeps only the positions in the book which are balanced according to the evaluator.
+// Built-in books are converted into PGN line books containing the remaining positions.
+func (b OpeningBook) Filter(
+	ctx context.Context,
+	ev opening.Evaluator,
+	o opening.FilterOptions,
+) (OpeningBook, opening.FilterStats, error) {
+	var (
+		format opening.Format
+		src    string
+	)
+	switch b.Kind {
+	case OpeningsPGNLine:
+		format, src = opening.FormatPGNLine, b.Data
+	case OpeningsFEN:
+		format, src = opening.FormatFEN, b.Data
+	case OpeningsBuiltin:
+		format = opening.FormatPGNLine
+		switch b.Data {
+		case BuiltinBookGraham20141F:
+			src = opening.Graham20141FData()
+		case BuiltinBookGBSelect2020:
+			src = opening.GBSelect2020Data()
+		default:
+			return OpeningBook{}, opening.FilterStats{}, fmt.Errorf("unknown builtin opening book: %q", b.Data)
+		}
+	default:
+		return OpeningBook{}, opening.FilterStats{}, fmt.Errorf("cannot filter book kind %q", b.Kind)
+	}
+	o.Lines = b.lineOptions()
+	data, stats, err := opening.Filter(ctx, format, src, ev, o)
+	if err != nil {
+		return OpeningBook{}, stats, fmt.Errorf("filter: %w", err)
+	}
+	kind := OpeningsPGNLine
+	if format == opening.FormatFEN {
+		kind = OpeningsFEN
+	}
+	// The lines are already truncated and deduplicated, so keeping the options is harmless.
+	return OpeningBook{Kind: kind, Data: data, MaxPlies: b.MaxPlies, Dedup: b.Dedup, Pinned: b.Pinned}, stats, nil
+}
+
+// slotOpeningKey maps the game slot to the key of the book entry. Both games of a match pair get the
+// same key, so they are played on the same opening with colors reversed. With pinned openings, the
+// linked sub-contests share the keys, so the same slot is played with the same opening at all the
+// time controls.
+func slotOpeningKey(info *ContestInfo, slot int64) uint64 {
+	id := info.ID
+	if info.OpeningBook.Pinned && info.GroupID != nil {
+		id = *info.GroupID
+	}
+	if info.Kind == ContestMatch {
+		slot /= 2
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(id))
+	return randutil.NewSeededSource(h.Sum64() ^ uint64(slot)).Uint64()
+}
+
+// FreeOpeningSlot is the slot of an unfinished game together with its schedule key, so the retry
+// of the game gets both the same opening and the same colors.
+type FreeOpeningSlot struct {
+	Key  ScheduleKey
+	Slot int64
+}
+
+// takeOpeningSlot returns the game slot for a new job with the given schedule key. The slot freed by
+// an unfinished game with the same key is reused first, so the retry replaces the game exactly. In
+// matches, the slots 2N and 2N+1 are the N-th game pair, where the first player has White and Black
+// respectively.
+func (d *ContestData) takeOpeningSlot(kind ContestKind, k ScheduleKey) int64 {
+	if i := slices.IndexFunc(d.FreeOpeningSlots, func(s FreeOpeningSlot) bool { return s.Key == k }); i >= 0 {
+		slot := d.FreeOpeningSlots[i].Slot
+		d.FreeOpeningSlots = slices.Delete(d.FreeOpeningSlots, i, i+1)
+		return slot
+	}
+	if kind == ContestMatch && d.Match != nil {
+		if k.WhiteID == 0 {
+			slot := 2 * d.Match.DirectSlots
+			d.Match.DirectSlots++
+			return slot
+		}
+		slot := 2*d.Match.InvertedSlots + 1
+		d.Match.InvertedSlots++
+		return slot
+	}
+	slot := d.OpeningSlots
+	d.OpeningSlots++
+	return slot
+}
+
+// freeOpeningSlot returns the slot of an unfinished job, so it can be taken by its retry.
+func (d *ContestData) freeOpeningSlot(k ScheduleKey, slot int64) {
+	pos, found := slices.BinarySearchFunc(d.FreeOpeningSlots, slot, func(s FreeOpeningSlot, slot int64) int {
+		return cmp.Compare(s.Slot, slot)
+	})
+	if !found {
+		d.FreeOpeningSlots = slices.Insert(d.FreeOpeningSlots, pos, FreeOpeningSlot{Key: k, Slot: slot})
+	}
+}
+
+// reserveOpeningSlot marks the slot of a running job as taken. It is needed on restart, as the
+// contest data may be saved before the job took the slot.
+func (d *ContestData) reserveOpeningSlot(kind ContestKind, slot int64) {
+	if kind == ContestMatch && d.Match != nil {
+		if slot%2 == 0 {
+			d.Match.DirectSlots = max(d.Match.DirectSlots, slot/2+1)
+		} else {
+			d.Match.InvertedSlots = max(d.Match.InvertedSlots, slot/2+1)
+		}
+	} else {
+		d.OpeningSlots = max(d.OpeningSlots, slot+1)
+	}
+	d.FreeOpeningSlots = slices.DeleteFunc(d.FreeOpeningSlots, func(s FreeOpeningSlot) bool { return s.Slot == slot })
+}
@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alex65536/go-chess/chess"
+
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/util/randutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+const testBookLines = "1. e4\n1. d4\n1. c4\n1. Nf3\n1. g3\n1. b3\n1. f4\n1. Nc3\n"
+
+func newTestMatch(t *testing.T, games int64, book OpeningBook) *contestScheduler {
+	t.Helper()
+	info := &ContestInfo{
+		ID: "test-contest",
+		ContestSettings: ContestSettings{
+			Name:        "test",
+			OpeningBook: book,
+			Kind:        ContestMatch,
+			Players:     []roomapi.JobEngine{{Name: "first"}, {Name: "second"}},
+			Match:       &MatchSettings{Games: games},
+		},
+	}
+	var opts atomic.Pointer[Options]
+	opts.Store(&Options{})
+	s, err := newContestScheduler(slogx.DiscardLogger(), &opts, info, info.NewData(), nil, book)
+	if err != nil {
+		t.Fatalf("create scheduler: %v", err)
+	}
+	return s
+}
+
+func nextTestJob(t *testing.T, s *contestScheduler) *RunningJob {
+	t.Helper()
+	job, ok, err := s.getJob()
+	if err != nil || !ok {
+		t.Fatalf("no job: ok = %v, err = %v", ok, err)
+	}
+	return job
+}
+
+func TestPinnedOpeningRetry(t *testing.T) {
+	book := OpeningBook{Kind: OpeningsPGNLine, Data: testBookLines, Pinned: true}
+	s := newTestMatch(t, 6, book)
+
+	var jobs []*RunningJob
+	for range 3 {
+		jobs = append(jobs, nextTestJob(t, s))
+	}
+	aborted := jobs[1]
+	if _, err := s.FinalizeJob("room", aborted.Job.ID, roomkeeper.NewStatusAborted("test"), nil); err != nil {
+		t.Fatalf("abort job: %v", err)
+	}
+	jobs = slices.Delete(jobs, 1, 2)
+	for range 4 {
+		jobs = append(jobs, nextTestJob(t, s))
+	}
+	if _, ok, _ := s.getJob(); ok {
+		t.Fatalf("too many jobs")
+	}
+
+	// The retry gets the slot of the aborted game, together with its opening and colors.
+	var retry *RunningJob
+	for _, j := range jobs {
+		if *j.OpeningSlot == *aborted.OpeningSlot {
+			if retry != nil {
+				t.Fatalf("slot %v taken twice", *j.OpeningSlot)
+			}
+			retry = j
+		}
+	}
+	if retry == nil {
+		t.Fatalf("slot %v not retried", *aborted.OpeningSlot)
+	}
+	if retry.ScheduleKey() != aborted.ScheduleKey() {
+		t.Fatalf("bad colors: expected = %v, got = %v", aborted.ScheduleKey(), retry.ScheduleKey())
+	}
+	if !slices.Equal(retry.Job.StartMoves, aborted.Job.StartMoves) {
+		t.Fatalf("bad opening: expected = %v, got = %v", aborted.Job.StartMoves, retry.Job.StartMoves)
+	}
+
+	// Each slot is the index of the game, which determines both the colors and the opening.
+	b, err := book.Book(randutil.DefaultSource())
+	if err != nil {
+		t.Fatalf("build book: %v", err)
+	}
+	var slots []int64
+	for _, j := range jobs {
+		slot := *j.OpeningSlot
+		slots = append(slots, slot)
+		if expected := (ScheduleKey{WhiteID: int(slot % 2), BlackID: int(1 - slot%2)}); j.ScheduleKey() != expected {
+			t.Fatalf("bad colors for slot %v: expected = %v, got = %v", slot, expected, j.ScheduleKey())
+		}
+		opening := b.OpeningAt(slotOpeningKey(s.info, slot))
+		var expected []chess.UCIMove
+		for i := range opening.Len() {
+			expected = append(expected, opening.MoveAt(i).UCIMove())
+		}
+		if !slices.Equal(j.Job.StartMoves, expected) {
+			t.Fatalf("bad opening for slot %v: expected = %v, got = %v", slot, expected, j.Job.StartMoves)
+		}
+	}
+	slices.Sort(slots)
+	if expected := []int64{0, 1, 2, 3, 4, 5}; !slices.Equal(slots, expected) {
+		t.Fatalf("bad slots: expected = %v, got = %v", expected, slots)
+	}
+}
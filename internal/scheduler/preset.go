@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alex65536/day20/internal/util/clone"
+	"github.com/alex65536/day20/internal/util/idgen"
+	"github.com/alex65536/day20/internal/util/randutil"
+	"github.com/alex65536/day20/internal/util/timeutil"
+	"github.com/alex65536/go-chess/clock"
+)
+
+const ContestPresetNameMaxLen = 128
+
+// ContestPreset is a named bundle of contest settings, which can be used to fill the contest creation
+// form quickly.
+type ContestPreset struct {
+	ID             string `gorm:"primaryKey"`
+	Name           string
+	OwnerID        string `gorm:"index"`
+	FixedTime      *time.Duration
+	TimeControl    *clock.Control `gorm:"serializer:chess"`
+	OpeningBook    OpeningBook    `gorm:"embedded;embeddedPrefix:opening_"`
+	ScoreThreshold int32
+	Games          int64
+	CreatedAt      timeutil.UTCTime
+}
+
+func (p *ContestPreset) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("no preset name")
+	}
+	if utf8.RuneCountInString(p.Name) > ContestPresetNameMaxLen {
+		return fmt.Errorf("preset name exceeds %v runes", ContestPresetNameMaxLen)
+	}
+	if p.FixedTime != nil && *p.FixedTime <= 0 {
+		return fmt.Errorf("non-positive fixed time")
+	}
+	if p.TimeControl != nil {
+		if err := p.TimeControl.Validate(); err != nil {
+			return fmt.Errorf("time control: %w", err)
+		}
+	}
+	if p.OpeningBook.Kind == OpeningsStored {
+		if p.OpeningBook.Data == "" {
+			return fmt.Errorf("opening book: no stored book id")
+		}
+	} else if _, err := p.OpeningBook.Book(randutil.DefaultSource()); err != nil {
+		return fmt.Errorf("opening book: %w", err)
+	}
+	if p.Games <= 0 {
+		return fmt.Errorf("bad number of games")
+	}
+	return nil
+}
+
+func (p ContestPreset) Clone() ContestPreset {
+	p.FixedTime = clone.TrivialPtr(p.FixedTime)
+	p.TimeControl = clone.Ptr(p.TimeControl)
+	return p
+}
+
+// Apply overwrites the settings stored in the preset. The contest must be a match.
+func (p *ContestPreset) Apply(s *ContestSettings) {
+	s.FixedTime = clone.TrivialPtr(p.FixedTime)
+	s.TimeControl = clone.Ptr(p.TimeControl)
+	s.OpeningBook = p.OpeningBook
+	s.ScoreThreshold = p.ScoreThreshold
+	if s.Match == nil {
+		s.Match = &MatchSettings{}
+	}
+	s.Match.Games = p.Games
+	s.Match.Wins = 0
+}
+
+func (s *Scheduler) CreateContestPreset(ctx context.Context, preset ContestPreset) (ContestPreset, error) {
+	preset = preset.Clone()
+	preset.ID = idgen.ID()
+	preset.CreatedAt = timeutil.NowUTC()
+	if err := preset.Validate(); err != nil {
+		return ContestPreset{}, fmt.Errorf("invalid preset: %w", err)
+	}
+	if preset.OpeningBook.Kind == OpeningsStored {
+		if _, err := s.db.GetStoredBook(ctx, preset.OpeningBook.Data); err != nil {
+			return ContestPreset{}, fmt.Errorf("get stored book: %w", err)
+		}
+	}
+	if err := s.db.CreateContestPreset(ctx, preset); err != nil {
+		return ContestPreset{}, fmt.Errorf("create preset: %w", err)
+	}
+	return preset, nil
+}
+
+func (s *Scheduler) GetContestPreset(ctx context.Context, presetID string) (ContestPreset, error) {
+	return s.db.GetContestPreset(ctx, presetID)
+}
+
+func (s *Scheduler) ListContestPresets(ctx context.Context) ([]ContestPreset, error) {
+	presets, err := s.db.ListContestPresets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list presets: %w", err)
+	}
+	return presets, nil
+}
+
+func (s *Scheduler) DeleteContestPreset(ctx context.Context, presetID string) error {
+	return s.db.DeleteContestPreset(ctx, presetID)
+}
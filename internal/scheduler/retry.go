@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"slices"
+	"time"
+
+	"github.com/alex65536/day20/internal/roomkeeper"
+)
+
+// maxRecentRetryFailures limits the number of failures kept in the history of each schedule key.
+const maxRecentRetryFailures = 10
+
+// RetryFailure is an unsuccessful attempt to play a game, after which the game is retried.
+type RetryFailure struct {
+	JobID  string                   `json:"job_id"`
+	RoomID string                   `json:"room_id,omitempty"`
+	Kind   roomkeeper.JobStatusKind `json:"kind"`
+	Reason string                   `json:"reason,omitempty"`
+	At     time.Time                `json:"at"`
+}
+
+// RetryStats is the history of attempts to play the games with the same schedule key.
+type RetryStats struct {
+	WhiteID int `json:"white"`
+	BlackID int `json:"black"`
+	// Attempts counts all the finished jobs, including the successful ones.
+	Attempts int64 `json:"attempts"`
+	Aborted  int64 `json:"aborted"`
+	Failed   int64 `json:"failed"`
+	// Recent contains the latest failures, the most recent one being the last.
+	Recent []RetryFailure `json:"recent,omitempty"`
+}
+
+func (r RetryStats) Clone() RetryStats {
+	r.Recent = slices.Clone(r.Recent)
+	return r
+}
+
+func (r RetryStats) ScheduleKey() ScheduleKey {
+	return ScheduleKey{
+		WhiteID: r.WhiteID,
+		BlackID: r.BlackID,
+	}
+}
+
+// HasFailures reports whether any of the attempts was unsuccessful.
+func (r RetryStats) HasFailures() bool {
+	return r.Aborted != 0 || r.Failed != 0
+}
+
+// addRetryAttempt records the finished job played in the room roomID into the retry history.
+func (d *ContestData) addRetryAttempt(job *FinishedJob, roomID string) {
+	key := job.ScheduleKey()
+	idx := slices.IndexFunc(d.Retries, func(r RetryStats) bool {
+		return r.ScheduleKey() == key
+	})
+	if idx < 0 {
+		d.Retries = append(d.Retries, RetryStats{WhiteID: key.WhiteID, BlackID: key.BlackID})
+		idx = len(d.Retries) - 1
+	}
+	r := &d.Retries[idx]
+	r.Attempts++
+	switch job.Status.Kind {
+	case roomkeeper.JobAborted:
+		r.Aborted++
+	case roomkeeper.JobFailed:
+		r.Failed++
+	default:
+		return
+	}
+	r.Recent = append(r.Recent, RetryFailure{
+		JobID:  job.Job.ID,
+		RoomID: roomID,
+		Kind:   job.Status.Kind,
+		Reason: job.Status.Reason,
+		At:     time.Now().UTC(),
+	})
+	if len(r.Recent) > maxRecentRetryFailures {
+		r.Recent = slices.Delete(r.Recent, 0, len(r.Recent)-maxRecentRetryFailures)
+	}
+}
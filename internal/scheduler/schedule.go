@@ -31,6 +31,20 @@ func (s Schedule) Empty() bool {
 	return len(s.mp) == 0
 }
 
+// Count returns the number of scheduled games for the key k.
+func (s Schedule) Count(k ScheduleKey) int64 {
+	return s.mp[k]
+}
+
+// Total returns the total number of scheduled games.
+func (s Schedule) Total() int64 {
+	total := int64(0)
+	for _, v := range s.mp {
+		total += v
+	}
+	return total
+}
+
 func (s *Schedule) Inc(k ScheduleKey)      { _ = s.Add(k, 1) }
 func (s *Schedule) Dec(k ScheduleKey) bool { return s.Add(k, -1) }
 
@@ -83,6 +97,14 @@ func (i *ContestInfo) BuildSchedule(d *ContestData) (Schedule, error) {
 	s := NewSchedule()
 	switch i.Kind {
 	case ContestMatch:
+		if i.Match.IsFirstTo() {
+			// First-to-N matches are open-ended, so their schedule is extended by the contest
+			// scheduler as the games are played.
+			if d.Match.Played() < 0 || d.Match.Inverted < 0 || d.Match.Inverted > d.Match.Played() {
+				return Schedule{}, fmt.Errorf("negative number of games played")
+			}
+			break
+		}
 		total := i.Match.Games
 		if total < 0 {
 			return Schedule{}, fmt.Errorf("total number of games is negative")
@@ -101,6 +123,23 @@ func (i *ContestInfo) BuildSchedule(d *ContestData) (Schedule, error) {
 		if !s.Add(ScheduleKey{WhiteID: 1, BlackID: 0}, -playedInv) {
 			return Schedule{}, fmt.Errorf("too many games played")
 		}
+	case ContestSwiss:
+		if len(d.Swiss.History) == 0 {
+			return Schedule{}, fmt.Errorf("no swiss rounds")
+		}
+		for _, p := range d.Swiss.Current().Pairings {
+			if p.White < 0 || p.White >= len(i.Players) || p.Black < 0 || p.Black >= len(i.Players) {
+				return Schedule{}, fmt.Errorf("bad swiss pairing")
+			}
+			if p.Result == 0 {
+				s.Inc(ScheduleKey{WhiteID: p.White, BlackID: p.Black})
+			}
+		}
+	case ContestKnockout:
+		if len(d.Knockout.Bracket) == 0 {
+			return Schedule{}, fmt.Errorf("no knockout bracket")
+		}
+		d.Knockout.addToSchedule(&s, i.Knockout)
 	default:
 		panic("bad contest kind")
 	}
@@ -1,12 +1,16 @@
 package scheduler
 
 import (
+	"cmp"
 	"container/heap"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/alex65536/day20/internal/battle"
 	"github.com/alex65536/day20/internal/roomapi"
@@ -15,17 +19,53 @@ import (
 	"github.com/alex65536/day20/internal/util/idgen"
 	"github.com/alex65536/day20/internal/util/sliceutil"
 	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/writeq"
 )
 
 type Options struct {
 	MaxRunningContests int   `toml:"max-running-contests"`
 	MaxFailedJobs      int64 `toml:"max-failed-jobs"`
+
+	// Per-user quotas on contest creation. Zero means no limit.
+	MaxQueuedContestsPerUser int   `toml:"max-queued-contests-per-user"`
+	MaxGamesPerDayPerUser    int64 `toml:"max-games-per-day-per-user"`
+
+	// ContestsCacheTTL is how long the list of all contests is cached. The cache is also invalidated
+	// when contests are created or finished, so only the changes made outside the scheduler (e.g. by
+	// the archiver) are delayed. Negative value disables the cache.
+	ContestsCacheTTL time.Duration `toml:"contests-cache-ttl"`
+
+	// LTCThreshold is the nominal time per side (see ContestSettings.NominalTime) starting from
+	// which the contest is considered long time control. Jobs from such contests are not assigned
+	// to the rooms with less than LTCMinCores cores or LTCMinNPS nodes per second. The hardware
+	// values not reported by the room are not checked. Zero threshold disables the restriction.
+	LTCThreshold time.Duration `toml:"ltc-threshold"`
+	LTCMinCores  int           `toml:"ltc-min-cores"`
+	LTCMinNPS    int64         `toml:"ltc-min-nps"`
+
+	// DBQueue configures the queue which saves the finished jobs into the database in background. It
+	// cannot be changed at runtime.
+	DBQueue writeq.Options `toml:"db-queue"`
 }
 
 func (o Options) Clone() Options {
 	return o
 }
 
+// roomAccepts reports whether the room is powerful enough to run jobs from the contest.
+func (o *Options) roomAccepts(info *ContestInfo, room roomkeeper.RoomInfo) bool {
+	if o.LTCThreshold <= 0 || info.NominalTime() < o.LTCThreshold {
+		return true
+	}
+	if room.Cores > 0 && room.Cores < o.LTCMinCores {
+		return false
+	}
+	if room.NPS > 0 && room.NPS < o.LTCMinNPS {
+		return false
+	}
+	return true
+}
+
 func (o *Options) FillDefaults() {
 	if o.MaxRunningContests == 0 {
 		o.MaxRunningContests = 100
@@ -33,12 +73,17 @@ func (o *Options) FillDefaults() {
 	if o.MaxFailedJobs == 0 {
 		o.MaxFailedJobs = 10
 	}
+	if o.ContestsCacheTTL == 0 {
+		o.ContestsCacheTTL = time.Minute
+	}
+	o.DBQueue.FillDefaults()
 }
 
 type contestExt struct {
-	s     *Scheduler
-	sched *contestScheduler
-	dbMu  sync.Mutex
+	s        *Scheduler
+	sched    *contestScheduler
+	dbMu     sync.Mutex
+	notified atomic.Bool
 }
 
 func newContestExt(s *Scheduler, sched *contestScheduler) *contestExt {
@@ -58,11 +103,23 @@ func (c *contestExt) Synchronized(f func() error) error {
 func (c *contestExt) Save() {
 	c.dbMu.Lock()
 	defer c.dbMu.Unlock()
-	err := c.s.db.UpdateContest(context.Background(), c.sched.Info().ID, c.sched.Data())
+	// The queued job results contain older contest state, so they must be written first.
+	ctx, cancel := context.WithTimeout(context.Background(), c.s.o.Load().DBQueue.Timeout)
+	defer cancel()
+	if err := c.s.dbq.Flush(ctx); err != nil {
+		c.s.log.Warn("could not flush finished jobs", slogx.Err(err))
+	}
+	c.s.dataMu.Lock()
+	defer c.s.dataMu.Unlock()
+	seq := c.s.dbq.LastSeq()
+	contestID := c.sched.Info().ID
+	err := c.s.db.UpdateContest(context.Background(), contestID, c.sched.Data())
 	if err != nil {
 		c.s.log.Error("could not save contest state", slogx.Err(err))
 		return
 	}
+	c.s.dataSeq[contestID] = max(c.s.dataSeq[contestID], seq)
+	c.s.cache.Invalidate()
 }
 
 type contestHeapItem struct {
@@ -89,52 +146,76 @@ func (h *contestHeap) Pop() any {
 }
 
 type Scheduler struct {
-	o   *Options
-	db  DB
-	log *slog.Logger
+	o        *atomic.Pointer[Options]
+	db       DB
+	dbq      *writeq.Queue[string, JobFinish]
+	log      *slog.Logger
+	notifier Notifier
+	cache    contestsCache
+
+	// dataSeq is the position in dbq of the latest contest state written into the database for each
+	// contest. The job results retried after the failed writes contain older contest states, which
+	// must not overwrite the newer ones.
+	dataMu  sync.Mutex
+	dataSeq map[string]uint64
 
 	mu           sync.RWMutex
 	jobs         map[string]*RunningJob
 	contests     map[string]*contestExt
 	heap         contestHeap
 	lastQueuePos uint64
-	notify       chan struct{}
+	// heapChanged is closed and replaced each time the heap is updated, waking up all the rooms
+	// waiting for a contest.
+	heapChanged chan struct{}
 }
 
 func (s *Scheduler) onHeapUpdatedUnlocked() {
-	if len(s.heap) != 0 {
-		select {
-		case s.notify <- struct{}{}:
-		default:
-		}
-	}
+	close(s.heapChanged)
+	s.heapChanged = make(chan struct{})
 }
 
-func (s *Scheduler) acquireContest(ctx context.Context) (*contestExt, error) {
+// acquireContest returns the first contest in the queue which the room is allowed to run.
+func (s *Scheduler) acquireContest(ctx context.Context, room roomkeeper.RoomInfo) (*contestExt, error) {
 	for {
-		contest, ok := func() (*contestExt, bool) {
+		contest, changed := func() (*contestExt, <-chan struct{}) {
 			s.mu.Lock()
 			defer s.mu.Unlock()
-			for {
-				if len(s.heap) == 0 {
-					return nil, false
-				}
+			for len(s.heap) != 0 {
 				contestID := s.heap[0].ContestID
 				contest, ok := s.contests[contestID]
-				if !ok || contest.sched.IsFinished() {
-					heap.Pop(&s.heap)
-					delete(s.contests, contestID)
+				if ok && !contest.sched.IsFinished() {
+					break
+				}
+				heap.Pop(&s.heap)
+				delete(s.contests, contestID)
+			}
+			o := s.o.Load()
+			if len(s.heap) != 0 {
+				if top := s.contests[s.heap[0].ContestID]; o.roomAccepts(top.sched.Info(), room) {
+					return top, nil
+				}
+			}
+			// The heap is ordered only partially, so the rest of the contests must be scanned.
+			var (
+				best    *contestExt
+				bestPos uint64
+			)
+			for _, item := range s.heap {
+				contest, ok := s.contests[item.ContestID]
+				if !ok || contest.sched.IsFinished() || !o.roomAccepts(contest.sched.Info(), room) {
 					continue
 				}
-				s.onHeapUpdatedUnlocked()
-				return contest, true
+				if best == nil || item.PosInQueue < bestPos {
+					best, bestPos = contest, item.PosInQueue
+				}
 			}
+			return best, s.heapChanged
 		}()
-		if ok {
+		if contest != nil {
 			return contest, nil
 		}
 		select {
-		case <-s.notify:
+		case <-changed:
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		}
@@ -146,6 +227,9 @@ func (s *Scheduler) delContestIfFinished(contest *contestExt) {
 		s.mu.Lock()
 		delete(s.contests, contest.sched.Info().ID)
 		s.mu.Unlock()
+		if s.notifier != nil && !contest.notified.Swap(true) {
+			s.notifier.OnContestFinished(contest.sched.Info().Clone(), contest.sched.Data())
+		}
 	}
 }
 
@@ -163,9 +247,9 @@ func (s *Scheduler) IsJobAborted(jobID string) (string, bool) {
 	return contest.sched.IsJobAborted(jobID)
 }
 
-func (s *Scheduler) NextJob(ctx context.Context) (*roomapi.Job, error) {
+func (s *Scheduler) NextJob(ctx context.Context, room roomkeeper.RoomInfo) (*roomapi.Job, error) {
 	for {
-		contest, err := s.acquireContest(ctx)
+		contest, err := s.acquireContest(ctx, room)
 		if err != nil {
 			return nil, err
 		}
@@ -186,7 +270,7 @@ func (s *Scheduler) NextJob(ctx context.Context) (*roomapi.Job, error) {
 	}
 }
 
-func (s *Scheduler) OnJobFinished(jobID string, status roomkeeper.JobStatus, game *battle.GameExt) {
+func (s *Scheduler) OnJobFinished(roomID, jobID string, status roomkeeper.JobStatus, game *battle.GameExt) {
 	if !status.Kind.IsFinished() {
 		panic("must not happen")
 	}
@@ -224,7 +308,7 @@ func (s *Scheduler) OnJobFinished(jobID string, status roomkeeper.JobStatus, gam
 				s.log.Info("got job after contest finished", slog.String("job_id", jobID), slog.String("status", status.String()))
 				return nil, nil, fmt.Errorf("got job after contest finished")
 			}
-			job, err := contest.sched.FinalizeJob(jobID, status, game)
+			job, err := contest.sched.FinalizeJob(roomID, jobID, status, game)
 			s.delContestIfFinished(contest)
 			data := contest.sched.Data()
 			return job, &data, err
@@ -240,56 +324,280 @@ func (s *Scheduler) OnJobFinished(jobID string, status roomkeeper.JobStatus, gam
 			}
 			addPGNToJobOrAbort(s.log, finishedJob, game)
 		}
-
-		if err := s.db.FinishRunningJob(context.Background(), contestData, finishedJob); err != nil {
-			s.log.Error("could not finish running job", slog.String("job_id", jobID), slogx.Err(err))
+		finishedJob.RoomID = roomID
+		if finishedJob.StartedAt != nil {
+			finishedJob.Duration = time.Since(finishedJob.StartedAt.UTC())
+		}
+		if game != nil {
+			finishedJob.WhiteEngine = game.WhiteEngine
+			finishedJob.BlackEngine = game.BlackEngine
 		}
 
+		s.dbq.Put(jobID, JobFinish{Data: contestData, Job: finishedJob})
+
 		return nil
 	})
 }
 
-func (s *Scheduler) CreateContest(ctx context.Context, settings ContestSettings) (ContestInfo, error) {
+func (s *Scheduler) checkSettings(ctx context.Context, settings *ContestSettings) (OpeningBook, error) {
 	if err := settings.Validate(); err != nil {
-		return ContestInfo{}, fmt.Errorf("invalid contest settings: %w", err)
+		return OpeningBook{}, fmt.Errorf("invalid contest settings: %w", err)
+	}
+	if settings.EventID != nil {
+		if _, err := s.db.GetEvent(ctx, *settings.EventID); err != nil {
+			return OpeningBook{}, fmt.Errorf("get event: %w", err)
+		}
 	}
+	book, err := s.ResolveBook(ctx, settings.OpeningBook)
+	if err != nil {
+		return OpeningBook{}, fmt.Errorf("resolve opening book: %w", err)
+	}
+	return book, nil
+}
 
-	contest, err := func() (*contestExt, error) {
-		s.mu.Lock()
-		s.lastQueuePos++
-		queuePos := s.lastQueuePos
-		s.mu.Unlock()
-		info := ContestInfo{
-			ContestSettings: settings.Clone(),
-			ID:              idgen.ID(),
-			PosInQueue:      queuePos,
+// checkQuota checks whether the user is allowed to create the given contests.
+func (s *Scheduler) checkQuota(ctx context.Context, ownerID string, settings []ContestSettings) error {
+	if limit := s.o.Load().MaxQueuedContestsPerUser; limit > 0 {
+		queued := 0
+		s.mu.RLock()
+		for _, c := range s.contests {
+			if c.sched.Info().OwnerID == ownerID && !c.sched.IsFinished() {
+				queued++
+			}
+		}
+		s.mu.RUnlock()
+		if queued+len(settings) > limit {
+			return fmt.Errorf("%w: at most %v queued contests per user allowed", ErrQuotaExceeded, limit)
 		}
-		data := info.NewData()
-		sched, err := newContestScheduler(s.log, s.o, &info, data, nil)
+	}
+	if limit := s.o.Load().MaxGamesPerDayPerUser; limit > 0 {
+		contests, err := s.db.ListContestsFiltered(ctx, ContestFilter{
+			OwnerID:      ownerID,
+			CreatedSince: time.Now().Add(-24 * time.Hour),
+			// Private contests must be counted as well.
+			Viewer: Viewer{Admin: true},
+		})
 		if err != nil {
-			return nil, fmt.Errorf("create contest scheduler: %w", err)
+			return fmt.Errorf("list user contests: %w", err)
 		}
-		if err := s.db.CreateContest(ctx, info, data); err != nil {
-			s.log.Warn("could not create contest in db", slogx.Err(err))
-			sched.Abort("contest not created in db")
-			return nil, fmt.Errorf("create contest in db: %w", err)
+		games := int64(0)
+		for i := range settings {
+			games += settings[i].EstimatedGames()
 		}
-		contest := newContestExt(s, sched)
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		s.contests[info.ID] = contest
-		heap.Push(&s.heap, contestHeapItem{
-			ContestID:  info.ID,
-			PosInQueue: info.PosInQueue,
+		for _, c := range contests {
+			games += c.Info.EstimatedGames()
+		}
+		if games > limit {
+			return fmt.Errorf("%w: at most %v games per day per user allowed", ErrQuotaExceeded, limit)
+		}
+	}
+	return nil
+}
+
+// CreateContest creates a new contest owned by ownerID. Unless ignoreQuota is set, the per-user quotas
+// from Options are enforced.
+func (s *Scheduler) CreateContest(ctx context.Context, ownerID string, settings ContestSettings, ignoreQuota bool) (ContestInfo, error) {
+	infos, err := s.createContests(ctx, ownerID, []ContestSettings{settings}, ignoreQuota, false)
+	if err != nil {
+		return ContestInfo{}, err
+	}
+	return infos[0], nil
+}
+
+// CreateContestGroup creates the linked sub-contests of one logical contest, which is usually played
+// at several time controls. The sub-contests share the group ID, which is the ID of the first one.
+func (s *Scheduler) CreateContestGroup(ctx context.Context, ownerID string, settings []ContestSettings, ignoreQuota bool) ([]ContestInfo, error) {
+	if len(settings) < 2 {
+		return nil, fmt.Errorf("at least two sub-contests required")
+	}
+	return s.createContests(ctx, ownerID, settings, ignoreQuota, true)
+}
+
+func (s *Scheduler) createContests(
+	ctx context.Context,
+	ownerID string,
+	settings []ContestSettings,
+	ignoreQuota bool,
+	grouped bool,
+) ([]ContestInfo, error) {
+	books := make([]OpeningBook, len(settings))
+	for i := range settings {
+		book, err := s.checkSettings(ctx, &settings[i])
+		if err != nil {
+			return nil, err
+		}
+		books[i] = book
+	}
+	if !ignoreQuota {
+		if err := s.checkQuota(ctx, ownerID, settings); err != nil {
+			return nil, err
+		}
+	}
+
+	var groupID *string
+	infos := make([]ContestInfo, 0, len(settings))
+	for i := range settings {
+		contest, err := func() (*contestExt, error) {
+			s.mu.Lock()
+			s.lastQueuePos++
+			queuePos := s.lastQueuePos
+			s.mu.Unlock()
+			info := ContestInfo{
+				ContestSettings: settings[i].Clone(),
+				ID:              idgen.ID(),
+				OwnerID:         ownerID,
+				PosInQueue:      queuePos,
+			}
+			if grouped {
+				if groupID == nil {
+					groupID = &info.ID
+				}
+				info.GroupID = clone.TrivialPtr(groupID)
+			}
+			data := info.NewData()
+			sched, err := newContestScheduler(s.log, s.o, &info, data, nil, books[i])
+			if err != nil {
+				return nil, fmt.Errorf("create contest scheduler: %w", err)
+			}
+			if err := s.db.CreateContest(ctx, info, data); err != nil {
+				s.log.Warn("could not create contest in db", slogx.Err(err))
+				sched.Abort("contest not created in db")
+				return nil, fmt.Errorf("create contest in db: %w", err)
+			}
+			s.cache.Invalidate()
+			contest := newContestExt(s, sched)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.contests[info.ID] = contest
+			heap.Push(&s.heap, contestHeapItem{
+				ContestID:  info.ID,
+				PosInQueue: info.PosInQueue,
+			})
+			s.onHeapUpdatedUnlocked()
+			return contest, nil
+		}()
+		if err != nil {
+			// Do not leave an incomplete group running.
+			for _, info := range infos {
+				s.AbortContest(info.ID, "sub-contest not created")
+			}
+			return nil, err
+		}
+		infos = append(infos, contest.sched.Info().Clone())
+	}
+
+	return infos, nil
+}
+
+// SetOptions replaces the options of the running scheduler. The limits apply to the subsequent
+// contest creations and job results.
+func (s *Scheduler) SetOptions(o Options) {
+	o = o.Clone()
+	o.FillDefaults()
+	s.o.Store(&o)
+}
+
+// EditContest replaces the settings of the contest which has not played any games yet.
+func (s *Scheduler) EditContest(ctx context.Context, contestID string, settings ContestSettings) (ContestInfo, error) {
+	book, err := s.checkSettings(ctx, &settings)
+	if err != nil {
+		return ContestInfo{}, err
+	}
+
+	s.mu.RLock()
+	contest, ok := s.contests[contestID]
+	s.mu.RUnlock()
+	if !ok {
+		if _, _, err := s.db.GetContest(ctx, contestID); err != nil {
+			return ContestInfo{}, err
+		}
+		return ContestInfo{}, ErrContestStarted
+	}
+
+	var info *ContestInfo
+	err = contest.Synchronized(func() error {
+		var err error
+		info, err = contest.sched.Edit(settings, book, func(info *ContestInfo) error {
+			if err := s.db.UpdateContestSettings(ctx, contestID, info.ContestSettings); err != nil {
+				return fmt.Errorf("update contest settings: %w", err)
+			}
+			return nil
 		})
-		s.onHeapUpdatedUnlocked()
-		return contest, nil
-	}()
+		return err
+	})
 	if err != nil {
+		if errors.Is(err, errContestFinished) {
+			return ContestInfo{}, ErrContestStarted
+		}
 		return ContestInfo{}, err
 	}
+	return info.Clone(), nil
+}
+
+// MoveContest swaps the contest with the previous (if up is true) or the next running contest in the
+// queue. Nothing happens if the contest is already the first or the last one.
+func (s *Scheduler) MoveContest(ctx context.Context, contestID string, up bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return contest.sched.Info().Clone(), nil
+	idx, otherIdx := -1, -1
+	for i, item := range s.heap {
+		if item.ContestID == contestID {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return ErrNoSuchContest
+	}
+	pos := s.heap[idx].PosInQueue
+	for i, item := range s.heap {
+		contest, ok := s.contests[item.ContestID]
+		if !ok || contest.sched.IsFinished() || i == idx {
+			continue
+		}
+		if up && item.PosInQueue < pos && (otherIdx < 0 || item.PosInQueue > s.heap[otherIdx].PosInQueue) {
+			otherIdx = i
+		}
+		if !up && item.PosInQueue > pos && (otherIdx < 0 || item.PosInQueue < s.heap[otherIdx].PosInQueue) {
+			otherIdx = i
+		}
+	}
+	if otherIdx < 0 {
+		return nil
+	}
+
+	a, b := &s.heap[idx], &s.heap[otherIdx]
+	if err := s.db.UpdateContestQueuePositions(ctx, map[string]uint64{
+		a.ContestID: b.PosInQueue,
+		b.ContestID: a.PosInQueue,
+	}); err != nil {
+		return fmt.Errorf("update queue positions: %w", err)
+	}
+	a.PosInQueue, b.PosInQueue = b.PosInQueue, a.PosInQueue
+	s.contests[a.ContestID].sched.SetPosInQueue(a.PosInQueue)
+	s.contests[b.ContestID].sched.SetPosInQueue(b.PosInQueue)
+	heap.Fix(&s.heap, idx)
+	heap.Fix(&s.heap, otherIdx)
+	s.onHeapUpdatedUnlocked()
+	return nil
+}
+
+// ContestQueue returns the IDs of running contests in the order they are going to be run.
+func (s *Scheduler) ContestQueue() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]contestHeapItem, 0, len(s.heap))
+	for _, item := range s.heap {
+		if contest, ok := s.contests[item.ContestID]; ok && !contest.sched.IsFinished() {
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, func(a, b contestHeapItem) int {
+		return cmp.Compare(a.PosInQueue, b.PosInQueue)
+	})
+	return sliceutil.Map(items, func(item contestHeapItem) string {
+		return item.ContestID
+	})
 }
 
 func (s *Scheduler) AbortContest(contestID string, reason string) {
@@ -304,6 +612,17 @@ func (s *Scheduler) AbortContest(contestID string, reason string) {
 	s.delContestIfFinished(contest)
 }
 
+// ListGroupContests returns the sub-contests linked together with the given group ID.
+func (s *Scheduler) ListGroupContests(ctx context.Context, groupID string, viewer Viewer) ([]ContestFullData, error) {
+	contests, err := s.db.ListGroupContests(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("list contests: %w", err)
+	}
+	s.refreshRunning(contests)
+	// The sub-contests are linked from each other, so they are shown even if they are not listed.
+	return filterViewable(contests, viewer), nil
+}
+
 func (s *Scheduler) GetContest(ctx context.Context, contestID string) (ContestInfo, ContestData, error) {
 	s.mu.RLock()
 	contest, ok := s.contests[contestID]
@@ -311,11 +630,42 @@ func (s *Scheduler) GetContest(ctx context.Context, contestID string) (ContestIn
 	if !ok {
 		return s.db.GetContest(ctx, contestID)
 	}
-	return contest.sched.info.Clone(), contest.sched.Data(), nil
+	return contest.sched.Info().Clone(), contest.sched.Data(), nil
+}
+
+func (s *Scheduler) ListAllContests(ctx context.Context, viewer Viewer) ([]ContestFullData, error) {
+	contests, err := s.cache.Get(ctx, s.o.Load().ContestsCacheTTL, s.db.ListContests)
+	if err != nil {
+		return nil, err
+	}
+	// The cached state of running contests may be outdated, so take the actual one.
+	s.refreshRunning(contests)
+	return filterListed(contests, viewer), nil
 }
 
-func (s *Scheduler) ListAllContests(ctx context.Context) ([]ContestFullData, error) {
-	return s.db.ListContests(ctx)
+// ListContests returns the contests matching the filter.
+func (s *Scheduler) ListContests(ctx context.Context, filter ContestFilter) ([]ContestFullData, error) {
+	contests, err := s.db.ListContestsFiltered(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	s.refreshRunning(contests)
+	return contests, nil
+}
+
+// refreshRunning replaces the state of the running contests with the actual one, as the state
+// stored in the database is updated lazily.
+func (s *Scheduler) refreshRunning(contests []ContestFullData) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range contests {
+		if c, ok := s.contests[contests[i].Info.ID]; ok {
+			contests[i] = ContestFullData{
+				Info: c.sched.Info().Clone(),
+				Data: c.sched.Data(),
+			}
+		}
+	}
 }
 
 func (s *Scheduler) ListContestSucceededJobs(ctx context.Context, contestID string) ([]FinishedJob, error) {
@@ -332,7 +682,55 @@ func (s *Scheduler) ListContestSucceededJobs(ctx context.Context, contestID stri
 	return jobs, nil
 }
 
-func (s *Scheduler) ListRunningContests() []ContestFullData {
+func (s *Scheduler) ListContestFinishedJobs(ctx context.Context, contestID string, offset, limit int) ([]FinishedJob, error) {
+	jobs, err := s.db.ListContestFinishedJobs(ctx, contestID, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (s *Scheduler) GetContestFinishedJob(ctx context.Context, contestID string, jobID string) (FinishedJob, error) {
+	return s.db.GetContestFinishedJob(ctx, contestID, jobID)
+}
+
+func (s *Scheduler) GetContestSucceededJob(ctx context.Context, contestID string, index int64) (FinishedJob, error) {
+	return s.db.GetContestSucceededJob(ctx, contestID, index)
+}
+
+func (s *Scheduler) GetFinishedJob(ctx context.Context, jobID string) (FinishedJob, error) {
+	return s.db.GetFinishedJob(ctx, jobID)
+}
+
+// ListFailedJobs returns the aborted and failed jobs across all the contests, most recent first. If
+// roomID is not empty, only the jobs played by this room are returned.
+func (s *Scheduler) ListFailedJobs(ctx context.Context, roomID string, offset, limit int) ([]FinishedJob, error) {
+	jobs, err := s.db.ListFailedJobs(ctx, roomID, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (s *Scheduler) ListGames(ctx context.Context, filter GameFilter) ([]Game, error) {
+	games, err := s.db.ListGames(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list games: %w", err)
+	}
+	return games, nil
+}
+
+func (s *Scheduler) GetRunningJob(jobID string) (RunningJob, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return RunningJob{}, false
+	}
+	return job.Clone(), true
+}
+
+func (s *Scheduler) ListRunningContests(viewer Viewer) []ContestFullData {
 	contests := func() []*contestScheduler {
 		s.mu.RLock()
 		defer s.mu.RUnlock()
@@ -344,7 +742,7 @@ func (s *Scheduler) ListRunningContests() []ContestFullData {
 	}()
 	res := sliceutil.FilterMap(contests, func(sched *contestScheduler) (ContestFullData, bool) {
 		data := sched.Data()
-		if data.Status.Kind.IsFinished() {
+		if data.Status.Kind.IsFinished() || !viewer.CanList(sched.Info()) {
 			return ContestFullData{}, false
 		}
 		return ContestFullData{
@@ -355,9 +753,11 @@ func (s *Scheduler) ListRunningContests() []ContestFullData {
 	return res
 }
 
-func New(ctx context.Context, log *slog.Logger, db DB, o Options) (*Scheduler, error) {
+func New(ctx context.Context, log *slog.Logger, db DB, notifier Notifier, o Options) (*Scheduler, error) {
 	o = o.Clone()
 	o.FillDefaults()
+	opts := &atomic.Pointer[Options]{}
+	opts.Store(&o)
 
 	rooms, err := db.ListActiveRooms(ctx)
 	if err != nil {
@@ -407,11 +807,17 @@ func New(ctx context.Context, log *slog.Logger, db DB, o Options) (*Scheduler, e
 	for _, dbContest := range dbContests {
 		info := clone.Ptr(&dbContest.Info)
 		data := dbContest.Data.Clone()
-		sched, err := newContestScheduler(log, &o, info, data, jobsByContestID[info.ID])
+		sched, err := func() (*contestScheduler, error) {
+			book, err := resolveBook(ctx, db, info.OpeningBook)
+			if err != nil {
+				return nil, fmt.Errorf("resolve opening book: %w", err)
+			}
+			return newContestScheduler(log, opts, info, data, jobsByContestID[info.ID], book)
+		}()
 		if err != nil {
 			log.Warn("could not create contest scheduler, aborting",
 				slog.String("contest_id", info.ID), slogx.Err(err))
-			data.Status = NewStatusAborted("could not schedule contest")
+			data.SetStatus(NewStatusAborted("could not schedule contest"))
 			if err := db.UpdateContest(ctx, info.ID, data); err != nil {
 				log.Warn("could not abort contest", slog.String("contest_id", info.ID), slogx.Err(err))
 				return nil, fmt.Errorf("abort contest: %w", err)
@@ -434,18 +840,56 @@ func New(ctx context.Context, log *slog.Logger, db DB, o Options) (*Scheduler, e
 	}
 
 	s := &Scheduler{
-		o:            &o,
+		o:            opts,
 		db:           db,
 		log:          log,
+		notifier:     notifier,
 		jobs:         jobs,
 		contests:     make(map[string]*contestExt, len(contests)),
 		heap:         cHeap,
 		lastQueuePos: lastQueuePos,
-		notify:       make(chan struct{}, 1),
+		heapChanged:  make(chan struct{}),
+		dataSeq:      make(map[string]uint64),
+	}
+	s.dbq, err = writeq.New(log, o.DBQueue, s.finishJobsDB)
+	if err != nil {
+		return nil, fmt.Errorf("create db queue: %w", err)
 	}
 	for k, sched := range contests {
 		s.contests[k] = newContestExt(s, sched)
 	}
-	s.onHeapUpdatedUnlocked()
 	return s, nil
 }
+
+func (s *Scheduler) finishJobsDB(ctx context.Context, items []writeq.Item[string, JobFinish]) error {
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+	jobs := make([]JobFinish, 0, len(items))
+	for _, it := range items {
+		job := it.Value
+		if job.Data != nil && s.dataSeq[job.Job.ContestID] >= it.Seq {
+			job.Data = nil
+		}
+		jobs = append(jobs, job)
+	}
+	if err := s.db.FinishRunningJobs(ctx, jobs); err != nil {
+		return fmt.Errorf("finish running jobs: %w", err)
+	}
+	for _, it := range items {
+		if it.Value.Data != nil {
+			contestID := it.Value.Job.ContestID
+			s.dataSeq[contestID] = max(s.dataSeq[contestID], it.Seq)
+		}
+	}
+	if slices.ContainsFunc(jobs, func(j JobFinish) bool {
+		return j.Data != nil && j.Data.Status.Kind.IsFinished()
+	}) {
+		s.cache.Invalidate()
+	}
+	return nil
+}
+
+// Close writes the pending job results into the database.
+func (s *Scheduler) Close() {
+	s.dbq.Close()
+}
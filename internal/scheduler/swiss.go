@@ -0,0 +1,306 @@
+package scheduler
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/alex65536/day20/internal/util/clone"
+	"github.com/alex65536/day20/internal/util/sliceutil"
+)
+
+// swissPairingBudget limits the number of steps done by the pairing search before rematches are
+// allowed.
+const swissPairingBudget = 100_000
+
+type SwissSettings struct {
+	Rounds int64
+}
+
+func (s SwissSettings) Clone() SwissSettings {
+	return s
+}
+
+// SwissPairing is a game of a Swiss round. White and Black are the indices in the player list.
+// Result is the score of White in half-points plus one, or zero if the game is not finished yet.
+type SwissPairing struct {
+	White  int `json:"white"`
+	Black  int `json:"black"`
+	Result int `json:"result,omitempty"`
+}
+
+type SwissRound struct {
+	Pairings []SwissPairing `json:"pairings"`
+	// Bye is the player who sits out the round and gets a full point, or -1 if there is no such
+	// player.
+	Bye int `json:"bye"`
+}
+
+func (r SwissRound) Clone() SwissRound {
+	r.Pairings = slices.Clone(r.Pairings)
+	return r
+}
+
+func (r SwissRound) IsFinished() bool {
+	for _, p := range r.Pairings {
+		if p.Result == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SwissStanding is the standing of a player after a round. Scores are in half-points, and the bye
+// counts as a win.
+type SwissStanding struct {
+	Player   int   `json:"player"`
+	Score    int64 `json:"score"`
+	Buchholz int64 `json:"buchholz"`
+	Wins     int64 `json:"wins"`
+	Draws    int64 `json:"draws"`
+	Losses   int64 `json:"losses"`
+}
+
+type SwissData struct {
+	// History contains all the rounds started so far, the last one being the current round.
+	History []SwissRound `gorm:"serializer:json"`
+	// Standings contains the standings after each finished round, sorted by rank.
+	Standings [][]SwissStanding `gorm:"serializer:json"`
+}
+
+func newSwissData(players int) SwissData {
+	return SwissData{
+		History: []SwissRound{pairSwissRound(players, nil)},
+	}
+}
+
+func (d SwissData) Clone() SwissData {
+	d.History = clone.DeepSlice(d.History)
+	d.Standings = sliceutil.Map(d.Standings, func(s []SwissStanding) []SwissStanding {
+		return slices.Clone(s)
+	})
+	return d
+}
+
+// Round returns the number of the current round, starting from one.
+func (d SwissData) Round() int {
+	return len(d.History)
+}
+
+// Current returns the current round.
+func (d SwissData) Current() SwissRound {
+	return d.History[len(d.History)-1]
+}
+
+// LastStandings returns the standings after the last finished round, or nil if no rounds are
+// finished yet.
+func (d SwissData) LastStandings() []SwissStanding {
+	if len(d.Standings) == 0 {
+		return nil
+	}
+	return d.Standings[len(d.Standings)-1]
+}
+
+// addResult records the result of the game in the current round. Score is the score of White in
+// half-points. It returns false if there is no such unfinished game in the current round.
+func (d *SwissData) addResult(white, black int, score int) bool {
+	round := &d.History[len(d.History)-1]
+	for i := range round.Pairings {
+		p := &round.Pairings[i]
+		if p.White == white && p.Black == black && p.Result == 0 {
+			p.Result = score + 1
+			return true
+		}
+	}
+	return false
+}
+
+// nextRound records the standings after the current round, which must be finished, and pairs the
+// next one. It returns false if all the rounds are already played.
+func (d *SwissData) nextRound(players int, rounds int64) bool {
+	if !d.Current().IsFinished() {
+		panic("must not happen")
+	}
+	if len(d.Standings) < len(d.History) {
+		d.Standings = append(d.Standings, buildSwissStandings(players, d.History))
+	}
+	if int64(len(d.History)) >= rounds {
+		return false
+	}
+	d.History = append(d.History, pairSwissRound(players, d.History))
+	return true
+}
+
+type swissPlayerState struct {
+	score     int64
+	colorDiff int
+	lastColor int
+	hadBye    bool
+	opponents map[int]struct{}
+}
+
+func buildSwissPlayerStates(players int, history []SwissRound) []swissPlayerState {
+	st := make([]swissPlayerState, players)
+	for i := range st {
+		st[i].opponents = make(map[int]struct{})
+	}
+	for _, r := range history {
+		if r.Bye >= 0 {
+			st[r.Bye].score += 2
+			st[r.Bye].hadBye = true
+		}
+		for _, p := range r.Pairings {
+			w, b := &st[p.White], &st[p.Black]
+			w.opponents[p.Black] = struct{}{}
+			b.opponents[p.White] = struct{}{}
+			w.colorDiff++
+			b.colorDiff--
+			w.lastColor = 1
+			b.lastColor = -1
+			if p.Result != 0 {
+				w.score += int64(p.Result - 1)
+				b.score += int64(3 - p.Result)
+			}
+		}
+	}
+	return st
+}
+
+func buildSwissStandings(players int, history []SwissRound) []SwissStanding {
+	st := buildSwissPlayerStates(players, history)
+	res := make([]SwissStanding, players)
+	for i := range res {
+		res[i].Player = i
+		res[i].Score = st[i].score
+		for op := range st[i].opponents {
+			res[i].Buchholz += st[op].score
+		}
+	}
+	for _, r := range history {
+		if r.Bye >= 0 {
+			res[r.Bye].Wins++
+		}
+		for _, p := range r.Pairings {
+			switch p.Result {
+			case 1:
+				res[p.White].Losses++
+				res[p.Black].Wins++
+			case 2:
+				res[p.White].Draws++
+				res[p.Black].Draws++
+			case 3:
+				res[p.White].Wins++
+				res[p.Black].Losses++
+			}
+		}
+	}
+	slices.SortFunc(res, func(a, b SwissStanding) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.Buchholz, a.Buchholz); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Player, b.Player)
+	})
+	return res
+}
+
+// pairSwissRound pairs the players with equal or close scores, avoiding rematches if possible. Within
+// a score group, the upper half plays against the lower half. The colors are balanced, so each player
+// has roughly the same number of games with White and Black.
+func pairSwissRound(players int, history []SwissRound) SwissRound {
+	st := buildSwissPlayerStates(players, history)
+	order := make([]int, players)
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(st[b].score, st[a].score)
+	})
+
+	bye := -1
+	if players%2 != 0 {
+		bye = order[len(order)-1]
+		for i := len(order) - 1; i >= 0; i-- {
+			if !st[order[i]].hadBye {
+				bye = order[i]
+				break
+			}
+		}
+		order = slices.DeleteFunc(order, func(p int) bool { return p == bye })
+	}
+
+	pairs, ok := findSwissPairs(st, order, false)
+	if !ok {
+		pairs, _ = findSwissPairs(st, order, true)
+	}
+
+	round := SwissRound{
+		Pairings: make([]SwissPairing, 0, len(pairs)),
+		Bye:      bye,
+	}
+	for _, pair := range pairs {
+		white, black := swissColors(st, pair[0], pair[1], len(history))
+		round.Pairings = append(round.Pairings, SwissPairing{White: white, Black: black})
+	}
+	return round
+}
+
+func findSwissPairs(st []swissPlayerState, order []int, allowRematch bool) ([][2]int, bool) {
+	budget := swissPairingBudget
+	pairs := make([][2]int, 0, len(order)/2)
+	var search func(rest []int) bool
+	search = func(rest []int) bool {
+		if len(rest) == 0 {
+			return true
+		}
+		budget--
+		if budget < 0 {
+			return false
+		}
+		p, rest := rest[0], rest[1:]
+		group := 0
+		for group < len(rest) && st[rest[group]].score == st[p].score {
+			group++
+		}
+		// Try the opponent from the lower half of the score group first.
+		shift := max((group+1)/2-1, 0)
+		candidates := slices.Concat(rest[shift:group], rest[:shift], rest[group:])
+		for _, op := range candidates {
+			if _, ok := st[p].opponents[op]; ok && !allowRematch {
+				continue
+			}
+			pairs = append(pairs, [2]int{p, op})
+			others := slices.DeleteFunc(slices.Clone(rest), func(x int) bool { return x == op })
+			if search(others) {
+				return true
+			}
+			pairs = pairs[:len(pairs)-1]
+		}
+		return false
+	}
+	if !search(order) {
+		return nil, false
+	}
+	return pairs, true
+}
+
+// swissColors assigns the colors to the players a and b, where a is ranked higher.
+func swissColors(st []swissPlayerState, a, b int, round int) (white, black int) {
+	switch {
+	case st[a].colorDiff != st[b].colorDiff:
+		if st[a].colorDiff < st[b].colorDiff {
+			return a, b
+		}
+		return b, a
+	case st[a].lastColor != st[b].lastColor:
+		if st[a].lastColor < st[b].lastColor {
+			return a, b
+		}
+		return b, a
+	case round%2 == 0:
+		return a, b
+	default:
+		return b, a
+	}
+}
@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"slices"
+	"testing"
+)
+
+// playSwiss plays all the rounds, where the player with the lower index always wins.
+func playSwiss(t *testing.T, players int, rounds int64) SwissData {
+	t.Helper()
+	d := newSwissData(players)
+	for {
+		for _, p := range d.Current().Pairings {
+			score := 0
+			if p.White < p.Black {
+				score = 2
+			}
+			if !d.addResult(p.White, p.Black, score) {
+				t.Fatalf("cannot add result for %v-%v", p.White, p.Black)
+			}
+		}
+		if !d.nextRound(players, rounds) {
+			return d
+		}
+	}
+}
+
+func checkSwissRound(t *testing.T, players int, r SwissRound) {
+	t.Helper()
+	seen := make([]int, players)
+	for _, p := range r.Pairings {
+		if p.White == p.Black {
+			t.Fatalf("player %v plays against themselves", p.White)
+		}
+		seen[p.White]++
+		seen[p.Black]++
+	}
+	if r.Bye >= 0 {
+		seen[r.Bye]++
+	}
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("player %v appears %v times in the round", i, n)
+		}
+	}
+	if expected := players%2 != 0; (r.Bye >= 0) != expected {
+		t.Fatalf("bad bye: %v", r.Bye)
+	}
+}
+
+func TestSwissFirstRound(t *testing.T) {
+	for _, tc := range []struct {
+		players  int
+		expected SwissRound
+	}{
+		{
+			players: 4,
+			expected: SwissRound{
+				Pairings: []SwissPairing{{White: 0, Black: 2}, {White: 1, Black: 3}},
+				Bye:      -1,
+			},
+		},
+		{
+			players: 5,
+			expected: SwissRound{
+				Pairings: []SwissPairing{{White: 0, Black: 2}, {White: 1, Black: 3}},
+				Bye:      4,
+			},
+		},
+	} {
+		got := newSwissData(tc.players).Current()
+		if !slices.Equal(got.Pairings, tc.expected.Pairings) || got.Bye != tc.expected.Bye {
+			t.Fatalf("bad round for %v players: expected = %+v, got = %+v", tc.players, tc.expected, got)
+		}
+	}
+}
+
+func TestSwissByes(t *testing.T) {
+	const players = 7
+	d := playSwiss(t, players, players)
+	byes := make(map[int]int)
+	for _, r := range d.History {
+		checkSwissRound(t, players, r)
+		byes[r.Bye]++
+	}
+	// Each player sits out exactly once.
+	for p := range players {
+		if byes[p] != 1 {
+			t.Fatalf("player %v got %v byes", p, byes[p])
+		}
+	}
+}
+
+func TestSwissNoRematches(t *testing.T) {
+	for _, players := range []int{6, 8, 9} {
+		rounds := int64(players - 1)
+		d := playSwiss(t, players, rounds)
+		if int64(d.Round()) != rounds {
+			t.Fatalf("bad number of rounds: expected = %v, got = %v", rounds, d.Round())
+		}
+		met := make(map[[2]int]struct{})
+		for _, r := range d.History {
+			checkSwissRound(t, players, r)
+			for _, p := range r.Pairings {
+				key := [2]int{min(p.White, p.Black), max(p.White, p.Black)}
+				if _, ok := met[key]; ok {
+					t.Fatalf("rematch between %v and %v with %v players", key[0], key[1], players)
+				}
+				met[key] = struct{}{}
+			}
+		}
+	}
+}
+
+func TestSwissRematchWhenUnavoidable(t *testing.T) {
+	d := playSwiss(t, 2, 3)
+	if d.Round() != 3 {
+		t.Fatalf("bad number of rounds: expected = 3, got = %v", d.Round())
+	}
+	for i, r := range d.History {
+		checkSwissRound(t, 2, r)
+		// The colors alternate.
+		if expected := i % 2; r.Pairings[0].White != expected {
+			t.Fatalf("bad white in round %v: expected = %v, got = %v", i+1, expected, r.Pairings[0].White)
+		}
+	}
+}
+
+func TestSwissColorBalance(t *testing.T) {
+	const players = 10
+	d := playSwiss(t, players, 9)
+	diff := make([]int, players)
+	for i, r := range d.History {
+		for _, p := range r.Pairings {
+			diff[p.White]++
+			diff[p.Black]--
+		}
+		for p, v := range diff {
+			if v < -2 || v > 2 {
+				t.Fatalf("player %v has color difference %v after round %v", p, v, i+1)
+			}
+		}
+	}
+	for p, v := range diff {
+		if v < -1 || v > 1 {
+			t.Fatalf("player %v has color difference %v at the end", p, v)
+		}
+	}
+}
+
+func TestSwissStandings(t *testing.T) {
+	history := []SwissRound{
+		{
+			Pairings: []SwissPairing{{White: 0, Black: 1, Result: 3}},
+			Bye:      2,
+		},
+		{
+			Pairings: []SwissPairing{{White: 2, Black: 0, Result: 2}},
+			Bye:      1,
+		},
+	}
+	// Equal scores are sorted by Buchholz, and the bye counts as a win.
+	expected := []SwissStanding{
+		{Player: 0, Score: 3, Buchholz: 5, Wins: 1, Draws: 1},
+		{Player: 2, Score: 3, Buchholz: 3, Wins: 1, Draws: 1},
+		{Player: 1, Score: 2, Buchholz: 3, Wins: 1, Losses: 1},
+	}
+	if got := buildSwissStandings(3, history); !slices.Equal(got, expected) {
+		t.Fatalf("bad standings: expected = %+v, got = %+v", expected, got)
+	}
+}
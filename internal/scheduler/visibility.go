@@ -0,0 +1,41 @@
+package scheduler
+
+// Viewer is the user on whose behalf contests are accessed. Zero value means an anonymous user.
+type Viewer struct {
+	UserID string
+	Admin  bool
+}
+
+func (v Viewer) isOwner(info *ContestInfo) bool {
+	return v.UserID != "" && v.UserID == info.OwnerID
+}
+
+// CanView reports whether the contest can be opened by its ID.
+func (v Viewer) CanView(info *ContestInfo) bool {
+	return v.Admin || info.Visibility != ContestPrivate || v.isOwner(info)
+}
+
+// CanList reports whether the contest can be shown in contest lists.
+func (v Viewer) CanList(info *ContestInfo) bool {
+	return v.Admin || info.Visibility == ContestPublic || v.isOwner(info)
+}
+
+func filterListed(contests []ContestFullData, viewer Viewer) []ContestFullData {
+	res := contests[:0]
+	for _, c := range contests {
+		if viewer.CanList(&c.Info) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func filterViewable(contests []ContestFullData, viewer Viewer) []ContestFullData {
+	res := contests[:0]
+	for _, c := range contests {
+		if viewer.CanView(&c.Info) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
@@ -0,0 +1,72 @@
+package stat
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+func bootstrapEloDiff(avg float64, p float64, rates []float64) EloDiff {
+	slices.Sort(rates)
+	quantile := func(q float64) float64 {
+		i := int(math.Round(q * float64(len(rates)-1)))
+		return rates[max(0, min(len(rates)-1, i))]
+	}
+	return EloDiff{
+		Low:  EloDifferenceFromRate(quantile((1.0 - p) / 2.0)),
+		Avg:  avg,
+		High: EloDifferenceFromRate(quantile((1.0 + p) / 2.0)),
+	}
+}
+
+// EloDiffBootstrap estimates the confidence interval for Elo difference by resampling the games
+// iters times. Status does not retain the order of games, so they are resampled one by one. Use
+// Pentanomial.EloDiffBootstrap to resample game pairs.
+func (s Status) EloDiffBootstrap(p float64, iters int, source rand.Source) EloDiff {
+	total := s.Total()
+	if total == 0 || iters <= 0 {
+		return s.EloDiff(p)
+	}
+	rnd := rand.New(source)
+	rates := make([]float64, iters)
+	for i := range rates {
+		points := 0
+		for range total {
+			x := rnd.IntN(total)
+			switch {
+			case x < s.Win:
+				points += 2
+			case x < s.Win+s.Draw:
+				points += 1
+			}
+		}
+		rates[i] = float64(points) / float64(2*total)
+	}
+	return bootstrapEloDiff(EloDifferenceFromRate(s.WinRate()), p, rates)
+}
+
+// EloDiffBootstrap estimates the confidence interval for Elo difference by resampling the game pairs
+// iters times.
+func (p Pentanomial) EloDiffBootstrap(prob float64, iters int, source rand.Source) EloDiff {
+	pairs := p.Pairs()
+	if pairs == 0 || iters <= 0 {
+		return p.EloDiff(prob)
+	}
+	rnd := rand.New(source)
+	rates := make([]float64, iters)
+	for i := range rates {
+		points := 0
+		for range pairs {
+			x := rnd.IntN(pairs)
+			for score, v := range p {
+				if x < v {
+					points += score
+					break
+				}
+				x -= v
+			}
+		}
+		rates[i] = float64(points) / float64(4*pairs)
+	}
+	return bootstrapEloDiff(EloDifferenceFromRate(p.WinRate()), prob, rates)
+}
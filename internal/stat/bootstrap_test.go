@@ -0,0 +1,51 @@
+package stat
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestEloDiffBootstrapFixedSeed(t *testing.T) {
+	p := Pentanomial{5, 20, 50, 30, 10}
+	s := Status{Win: 55, Draw: 120, Lose: 55}
+	for _, seed := range []uint64{1, 42, 1 << 40} {
+		a := p.EloDiffBootstrap(0.95, 1000, rand.NewPCG(seed, 0))
+		b := p.EloDiffBootstrap(0.95, 1000, rand.NewPCG(seed, 0))
+		if a != b {
+			t.Fatalf("pentanomial bootstrap not stable with seed %v: %v != %v", seed, a, b)
+		}
+		a = s.EloDiffBootstrap(0.95, 1000, rand.NewPCG(seed, 0))
+		b = s.EloDiffBootstrap(0.95, 1000, rand.NewPCG(seed, 0))
+		if a != b {
+			t.Fatalf("status bootstrap not stable with seed %v: %v != %v", seed, a, b)
+		}
+	}
+}
+
+func TestPentanomialEloDiffBootstrap(t *testing.T) {
+	p := Pentanomial{5, 20, 50, 30, 10}
+	expected := p.EloDiff(0.95)
+	for _, seed := range []uint64{1, 42, 1 << 40} {
+		got := p.EloDiffBootstrap(0.95, 5000, rand.NewPCG(seed, 0))
+		if !approxEqual(got.Avg, expected.Avg, 1e-9) {
+			t.Fatalf("bad avg with seed %v: expected = %v, got = %v", seed, expected.Avg, got.Avg)
+		}
+		if !approxEqual(got.Low, expected.Low, 5.0) || !approxEqual(got.High, expected.High, 5.0) {
+			t.Fatalf("bad interval with seed %v: expected = %v, got = %v", seed, expected, got)
+		}
+	}
+}
+
+func TestPentanomialEloDiffBootstrapPairs(t *testing.T) {
+	// Each pair is one win and one loss, so the pairs are always even, while the single games are not.
+	p := Pentanomial{0, 0, 100, 0, 0}
+	s := Status{Win: 100, Lose: 100}
+	pe := p.EloDiffBootstrap(0.95, 1000, rand.NewPCG(1, 0))
+	if pe.Low != 0 || pe.High != 0 {
+		t.Fatalf("bad pair interval: expected = (0, 0), got = (%v, %v)", pe.Low, pe.High)
+	}
+	se := s.EloDiffBootstrap(0.95, 1000, rand.NewPCG(1, 0))
+	if se.Low >= -10 || se.High <= 10 {
+		t.Fatalf("game interval too narrow: got = (%v, %v)", se.Low, se.High)
+	}
+}
@@ -0,0 +1,86 @@
+package stat
+
+import (
+	"math"
+)
+
+func (s Status) Add(t Status) Status {
+	return Status{
+		Win:  s.Win + t.Win,
+		Draw: s.Draw + t.Draw,
+		Lose: s.Lose + t.Lose,
+	}
+}
+
+func (s Status) Inv() Status {
+	return Status{
+		Win:  s.Lose,
+		Draw: s.Draw,
+		Lose: s.Win,
+	}
+}
+
+func RateFromEloDifference(elo float64) float64 {
+	return 1.0 / (1.0 + math.Pow(10.0, -elo/400.0))
+}
+
+// LLR returns the log-likelihood ratio of hypothesis "Elo difference is elo1" against "Elo
+// difference is elo0", using normal approximation of the trinomial model.
+func (s Status) LLR(elo0, elo1 float64) float64 {
+	if s.Total() == 0 {
+		return 0.0
+	}
+	sigma := s.GameStdDev()
+	if sigma == 0.0 {
+		return 0.0
+	}
+	s0, s1 := RateFromEloDifference(elo0), RateFromEloDifference(elo1)
+	return float64(s.Total()) * (s1 - s0) * (2*s.WinRate() - s0 - s1) / (2 * sigma * sigma)
+}
+
+// SPRTBounds returns lower and upper LLR bounds for sequential probability ratio test with error
+// probabilities alpha and beta.
+func SPRTBounds(alpha, beta float64) (float64, float64) {
+	return math.Log(beta / (1 - alpha)), math.Log((1 - beta) / alpha)
+}
+
+// EloStdDev returns the standard deviation of the Elo difference estimate.
+func (s Status) EloStdDev() float64 {
+	mu := s.WinRate()
+	if s.Total() == 0 || mu <= 0.0 || mu >= 1.0 {
+		return math.Inf(+1)
+	}
+	return s.WinRateStdDev() * 400.0 / (math.Ln10 * mu * (1.0 - mu))
+}
+
+type Comparison struct {
+	// EloDelta is the difference between Elo differences in b and a.
+	EloDelta EloDiff
+	Z        float64
+	PValue   float64
+}
+
+// Compare tests whether the Elo difference between two independent matches differs significantly.
+// Confidence interval for EloDelta is computed with probability p.
+func Compare(a, b Status, p float64) Comparison {
+	delta := b.EloDiff(p).Avg - a.EloDiff(p).Avg
+	sigma := math.Hypot(a.EloStdDev(), b.EloStdDev())
+	if math.IsNaN(delta) || math.IsInf(delta, 0) || math.IsInf(sigma, 0) || sigma == 0.0 {
+		return Comparison{
+			EloDelta: EloDiff{Low: math.Inf(-1), Avg: delta, High: math.Inf(+1)},
+			Z:        0.0,
+			PValue:   1.0,
+		}
+	}
+	c := confidence(p)
+	z := delta / sigma
+	return Comparison{
+		EloDelta: EloDiff{
+			Low:  delta - c*sigma,
+			Avg:  delta,
+			High: delta + c*sigma,
+		},
+		Z:      z,
+		PValue: math.Erfc(math.Abs(z) / math.Sqrt2),
+	}
+}
@@ -0,0 +1,62 @@
+package stat
+
+import (
+	"math"
+)
+
+const nEloScale = 800.0 / math.Ln10
+
+// GameStdDev returns the standard deviation of a single game score.
+func (s Status) GameStdDev() float64 {
+	if s.Total() == 0 {
+		return math.NaN()
+	}
+	total := float64(s.Total())
+	mu := s.WinRate()
+	d := (float64(s.Win)+0.25*float64(s.Draw))/total - mu*mu
+	if d <= 0.0 {
+		return 0.0
+	}
+	return math.Sqrt(d)
+}
+
+// NormalizedEloDiff returns normalized Elo difference, i.e. Elo difference scaled by the variance of
+// game results, which makes it independent of draw rate.
+func (s Status) NormalizedEloDiff(p float64) EloDiff {
+	sigma := s.GameStdDev()
+	if s.Total() == 0 || sigma == 0.0 || math.IsNaN(sigma) {
+		return EloDiff{Low: math.Inf(-1), Avg: math.NaN(), High: math.Inf(+1)}
+	}
+	nt := (s.WinRate() - 0.5) / sigma
+	delta := confidence(p) / math.Sqrt(float64(s.Total()))
+	return EloDiff{
+		Low:  (nt - delta) * nEloScale,
+		Avg:  nt * nEloScale,
+		High: (nt + delta) * nEloScale,
+	}
+}
+
+// BayesEloFit fits results into BayesElo draw model, returning Elo difference and draw Elo. The
+// latter measures how drawish the games are.
+func (s Status) BayesEloFit() (elo float64, drawElo float64) {
+	if s.Win == 0 || s.Lose == 0 {
+		return math.NaN(), math.NaN()
+	}
+	total := float64(s.Total())
+	w, l := float64(s.Win)/total, float64(s.Lose)/total
+	elo = 200.0 * math.Log10(w/l*(1.0-l)/(1.0-w))
+	drawElo = 200.0 * math.Log10((1.0-l)/l*(1.0-w)/w)
+	return elo, drawElo
+}
+
+// DavidsonFit fits results into Davidson draw model, returning Elo difference and draw parameter
+// nu, such that probability of a draw is nu*sqrt(pWin*pLose).
+func (s Status) DavidsonFit() (elo float64, nu float64) {
+	if s.Win == 0 || s.Lose == 0 {
+		return math.NaN(), math.NaN()
+	}
+	w, l := float64(s.Win), float64(s.Lose)
+	elo = 400.0 * math.Log10(w/l)
+	nu = float64(s.Draw) / math.Sqrt(w*l)
+	return elo, nu
+}
@@ -0,0 +1,65 @@
+package stat
+
+import (
+	"math"
+	"testing"
+)
+
+func approxEqual(a, b, eps float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return math.Abs(a-b) <= eps
+}
+
+func TestDavidsonFit(t *testing.T) {
+	for _, tc := range []struct {
+		s   Status
+		elo float64
+		nu  float64
+	}{
+		{Status{Win: 10, Draw: 20, Lose: 10}, 0.0, 2.0},
+		{Status{Win: 30, Draw: 40, Lose: 10}, 190.849, 2.309},
+		{Status{Win: 10, Draw: 0, Lose: 100}, -400.0, 0.0},
+		{Status{Win: 50, Draw: 10, Lose: 0}, math.NaN(), math.NaN()},
+	} {
+		elo, nu := tc.s.DavidsonFit()
+		if !approxEqual(elo, tc.elo, 1e-3) || !approxEqual(nu, tc.nu, 1e-3) {
+			t.Fatalf("bad fit for %+v: expected = (%v, %v), got = (%v, %v)", tc.s, tc.elo, tc.nu, elo, nu)
+		}
+	}
+}
+
+func TestBayesEloFit(t *testing.T) {
+	for _, tc := range []struct {
+		s       Status
+		elo     float64
+		drawElo float64
+	}{
+		{Status{Win: 25, Draw: 50, Lose: 25}, 0.0, 190.849},
+		{Status{Win: 40, Draw: 40, Lose: 20}, 85.194, 155.630},
+		{Status{Win: 0, Draw: 10, Lose: 10}, math.NaN(), math.NaN()},
+	} {
+		elo, drawElo := tc.s.BayesEloFit()
+		if !approxEqual(elo, tc.elo, 1e-3) || !approxEqual(drawElo, tc.drawElo, 1e-3) {
+			t.Fatalf("bad fit for %+v: expected = (%v, %v), got = (%v, %v)", tc.s, tc.elo, tc.drawElo, elo, drawElo)
+		}
+	}
+}
+
+func TestEloDiff(t *testing.T) {
+	for _, tc := range []struct {
+		s   Status
+		elo float64
+	}{
+		{Status{Win: 10, Draw: 20, Lose: 10}, 0.0},
+		{Status{Win: 30, Draw: 40, Lose: 10}, 88.739},
+		{Status{Win: 75, Draw: 0, Lose: 25}, 190.849},
+		{Status{Win: 10, Draw: 0, Lose: 0}, math.Inf(+1)},
+	} {
+		elo := tc.s.EloDiff(0.95).Avg
+		if !(approxEqual(elo, tc.elo, 1e-3) || elo == tc.elo) {
+			t.Fatalf("bad elo for %+v: expected = %v, got = %v", tc.s, tc.elo, elo)
+		}
+	}
+}
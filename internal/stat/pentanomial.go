@@ -0,0 +1,73 @@
+package stat
+
+import (
+	"math"
+)
+
+// Pentanomial holds the number of game pairs by the total score of the first player in a pair,
+// from 0 (two losses) to 4 (two wins), in half-points.
+type Pentanomial [5]int
+
+func (p Pentanomial) Pairs() int {
+	res := 0
+	for _, v := range p {
+		res += v
+	}
+	return res
+}
+
+func (p Pentanomial) WinRate() float64 {
+	sum := 0
+	for i, v := range p {
+		sum += i * v
+	}
+	return float64(sum) / float64(4*p.Pairs())
+}
+
+// WinRateStdDev returns standard deviation of the WinRate() estimate. If there are too few pairs to
+// estimate it, NaN is returned.
+func (p Pentanomial) WinRateStdDev() float64 {
+	n := float64(p.Pairs())
+	if p.Pairs() <= 2 {
+		return math.NaN()
+	}
+	mu := p.WinRate()
+	d := 0.0
+	for i, v := range p {
+		x := float64(i)/4.0 - mu
+		d += float64(v) * x * x
+	}
+	d /= n
+	return math.Sqrt(d) / math.Sqrt(n)
+}
+
+func (p Pentanomial) EloDiff(prob float64) EloDiff {
+	if p.Pairs() == 0 {
+		return EloDiff{Low: math.Inf(-1), Avg: 0, High: math.Inf(+1)}
+	}
+	mu := p.WinRate()
+	delta := p.WinRateStdDev() * confidence(prob)
+	if math.IsNaN(delta) {
+		return EloDiff{Low: math.Inf(-1), Avg: EloDifferenceFromRate(mu), High: math.Inf(+1)}
+	}
+	return EloDiff{
+		Low:  EloDifferenceFromRate(mu - delta),
+		Avg:  EloDifferenceFromRate(mu),
+		High: EloDifferenceFromRate(mu + delta),
+	}
+}
+
+func (p Pentanomial) NormalizedEloDiff(prob float64) EloDiff {
+	n := float64(p.Pairs())
+	sigma := p.WinRateStdDev() * math.Sqrt(n)
+	if p.Pairs() <= 2 || sigma == 0.0 {
+		return EloDiff{Low: math.Inf(-1), Avg: math.NaN(), High: math.Inf(+1)}
+	}
+	nt := (p.WinRate() - 0.5) / (math.Sqrt2 * sigma)
+	delta := confidence(prob) / math.Sqrt(2*n)
+	return EloDiff{
+		Low:  (nt - delta) * nEloScale,
+		Avg:  nt * nEloScale,
+		High: (nt + delta) * nEloScale,
+	}
+}
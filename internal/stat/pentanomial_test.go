@@ -0,0 +1,33 @@
+package stat
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPentanomialWinRateStdDev(t *testing.T) {
+	for _, tc := range []struct {
+		p      Pentanomial
+		stdDev float64
+	}{
+		{Pentanomial{}, math.NaN()},
+		{Pentanomial{0, 1, 1, 0, 0}, math.NaN()},
+		{Pentanomial{0, 0, 10, 0, 0}, 0.0},
+		{Pentanomial{5, 0, 0, 0, 5}, 0.5 / math.Sqrt(10)},
+		{Pentanomial{1, 2, 4, 2, 1}, math.Sqrt(0.075) / math.Sqrt(10)},
+	} {
+		if got := tc.p.WinRateStdDev(); !approxEqual(got, tc.stdDev, 1e-9) {
+			t.Fatalf("bad stddev for %v: expected = %v, got = %v", tc.p, tc.stdDev, got)
+		}
+	}
+}
+
+func TestPentanomialEloDiffFewPairs(t *testing.T) {
+	e := Pentanomial{0, 0, 1, 1, 0}.EloDiff(0.95)
+	if !math.IsInf(e.Low, -1) || !math.IsInf(e.High, +1) {
+		t.Fatalf("bad interval: expected = (-Inf, +Inf), got = (%v, %v)", e.Low, e.High)
+	}
+	if !approxEqual(e.Avg, EloDifferenceFromRate(0.625), 1e-9) {
+		t.Fatalf("bad elo: expected = %v, got = %v", EloDifferenceFromRate(0.625), e.Avg)
+	}
+}
@@ -12,11 +12,19 @@ var (
 	ErrUserAlreadyExists = errors.New("user with such username already exists")
 	ErrUserNotFound      = errors.New("user not found")
 	ErrRoomTokenNotFound = errors.New("room token not found")
+	ErrAPITokenNotFound  = errors.New("api token not found")
+	ErrEmailTokenInvalid = errors.New("email token is invalid or expired")
+	ErrEmailTaken        = errors.New("email is already used by another user")
+	ErrMailNotConfigured = errors.New("mail is not configured")
+	ErrSessionNotFound   = errors.New("session not found")
+	ErrExternalNotFound  = errors.New("external account not found")
+	ErrExternalTaken     = errors.New("external account is already linked")
 )
 
 type GetUserOptions struct {
 	WithInviteLinks bool
 	WithRoomTokens  bool
+	WithAPITokens   bool
 }
 
 type UpdateUserOptions struct {
@@ -25,10 +33,14 @@ type UpdateUserOptions struct {
 
 type DB interface {
 	CreateUser(ctx context.Context, user User, link InviteLink) error
+	CreateUserWithoutInvite(ctx context.Context, user User) error
+	DeleteUser(ctx context.Context, userID string) error
 	GetUser(ctx context.Context, userID string, o ...GetUserOptions) (User, error)
 	GetUserByUsername(ctx context.Context, username string, o ...GetUserOptions) (User, error)
+	GetUserByVerifiedEmail(ctx context.Context, email string) (User, error)
 	ListUsers(ctx context.Context) ([]User, error)
 	UpdateUser(ctx context.Context, user User, o ...UpdateUserOptions) error
+	UpdateUsers(ctx context.Context, users []User, o ...UpdateUserOptions) error
 	HasOwnerUser(ctx context.Context) (bool, error)
 	CreateInviteLink(ctx context.Context, link InviteLink) error
 	GetInviteLink(ctx context.Context, linkHash string, now timeutil.UTCTime) (InviteLink, error)
@@ -37,4 +49,21 @@ type DB interface {
 	CreateRoomToken(ctx context.Context, token RoomToken) error
 	GetRoomToken(ctx context.Context, hash string) (RoomToken, error)
 	DeleteRoomToken(ctx context.Context, tokenHash string, userID string) error
+	CreateAPIToken(ctx context.Context, token APIToken) error
+	GetAPIToken(ctx context.Context, hash string) (APIToken, error)
+	DeleteAPIToken(ctx context.Context, tokenHash string, userID string) error
+	CreateEmailToken(ctx context.Context, token EmailToken) error
+	GetEmailToken(ctx context.Context, hash string, now timeutil.UTCTime) (EmailToken, error)
+	DeleteEmailTokens(ctx context.Context, userID string, kind EmailTokenKind) error
+	PruneEmailTokens(ctx context.Context, now timeutil.UTCTime) error
+	CreateSession(ctx context.Context, session Session) error
+	GetSession(ctx context.Context, sessionID string) (Session, error)
+	TouchSession(ctx context.Context, sessionID string, now timeutil.UTCTime, ip string) error
+	ListUserSessions(ctx context.Context, userID string) ([]Session, error)
+	DeleteSession(ctx context.Context, sessionID string, userID string) error
+	PruneSessions(ctx context.Context, lastSeenBefore timeutil.UTCTime) error
+	CreateExternalAccount(ctx context.Context, account ExternalAccount) error
+	GetExternalAccount(ctx context.Context, provider string, subject string) (ExternalAccount, error)
+	ListUserExternalAccounts(ctx context.Context, userID string) ([]ExternalAccount, error)
+	DeleteExternalAccount(ctx context.Context, provider string, userID string) error
 }
@@ -0,0 +1,233 @@
+package userauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alex65536/day20/internal/mailer"
+	"github.com/alex65536/day20/internal/util/idgen"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+const EmailMaxLen = 254
+
+func ValidateEmail(email string) error {
+	if utf8.RuneCountInString(email) > EmailMaxLen {
+		return fmt.Errorf("email must have at most %v characters", EmailMaxLen)
+	}
+	if err := mailer.ValidateAddress(email); err != nil {
+		return err
+	}
+	return nil
+}
+
+type EmailTokenKind int
+
+const (
+	EmailTokenUnknown EmailTokenKind = iota
+	EmailTokenVerify
+	EmailTokenReset
+)
+
+// EmailToken is a one-time secret sent to the user by email. Only its hash is stored.
+type EmailToken struct {
+	Hash      string         `gorm:"primaryKey"`
+	UserID    string         `gorm:"index"`
+	Kind      EmailTokenKind `gorm:"index"`
+	Email     string
+	CreatedAt timeutil.UTCTime
+	ExpiresAt timeutil.UTCTime `gorm:"index"`
+}
+
+func HashEmailToken(tok string) string {
+	hash := sha256.Sum256([]byte(tok))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func (t *EmailToken) GenerateNew() (string, error) {
+	tok, err := idgen.SecureLinkValue()
+	if err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	t.Hash = HashEmailToken(tok)
+	return tok, nil
+}
+
+func (m *Manager) CanSendMail() bool {
+	return m.mailer != nil
+}
+
+func (m *Manager) sendEmailToken(ctx context.Context, u *User, kind EmailTokenKind) error {
+	if m.mailer == nil {
+		return ErrMailNotConfigured
+	}
+	if err := m.DeleteEmailTokens(ctx, u.ID, kind); err != nil {
+		return fmt.Errorf("delete old tokens: %w", err)
+	}
+	now := timeutil.NowUTC()
+	token := EmailToken{
+		UserID:    u.ID,
+		Kind:      kind,
+		Email:     u.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.o.EmailTokenExpiry),
+	}
+	tok, err := token.GenerateNew()
+	if err != nil {
+		return fmt.Errorf("generate: %w", err)
+	}
+	if err := m.CreateEmailToken(ctx, token); err != nil {
+		return fmt.Errorf("save to db: %w", err)
+	}
+	var subject, text string
+	switch kind {
+	case EmailTokenVerify:
+		subject = "Verify your email"
+		text = fmt.Sprintf("Hello, %v!\n\nFollow the link below to verify your email:\n%v\n",
+			u.Username, m.o.VerifyLinkPrefix+tok)
+	case EmailTokenReset:
+		subject = "Reset your password"
+		text = fmt.Sprintf("Hello, %v!\n\nFollow the link below to reset your password:\n%v\n\n"+
+			"If you did not request password reset, just ignore this message.\n",
+			u.Username, m.o.ResetLinkPrefix+tok)
+	default:
+		panic("bad email token kind")
+	}
+	if err := m.mailer.Send(ctx, u.Email, subject, text); err != nil {
+		return fmt.Errorf("send mail: %w", err)
+	}
+	return nil
+}
+
+// SetEmail changes the user's email and sends the verification link to the new address. Empty
+// email removes the address.
+func (m *Manager) SetEmail(ctx context.Context, u *User, email string) error {
+	email = strings.TrimSpace(email)
+	if email == u.Email {
+		return nil
+	}
+	if email != "" {
+		if err := ValidateEmail(email); err != nil {
+			return err
+		}
+		if m.mailer == nil {
+			return ErrMailNotConfigured
+		}
+		other, err := m.GetUserByVerifiedEmail(ctx, email)
+		if err == nil && other.ID != u.ID {
+			return ErrEmailTaken
+		}
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			return fmt.Errorf("check email: %w", err)
+		}
+	}
+	u.Email = email
+	u.EmailVerified = false
+	if err := m.UpdateUser(ctx, *u); err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+	if err := m.DeleteEmailTokens(ctx, u.ID, EmailTokenReset); err != nil {
+		return fmt.Errorf("delete reset tokens: %w", err)
+	}
+	if email == "" {
+		if err := m.DeleteEmailTokens(ctx, u.ID, EmailTokenVerify); err != nil {
+			return fmt.Errorf("delete verify tokens: %w", err)
+		}
+		return nil
+	}
+	return m.sendEmailToken(ctx, u, EmailTokenVerify)
+}
+
+func (m *Manager) SendEmailVerification(ctx context.Context, u *User) error {
+	if u.Email == "" {
+		return fmt.Errorf("no email")
+	}
+	if u.EmailVerified {
+		return fmt.Errorf("email already verified")
+	}
+	return m.sendEmailToken(ctx, u, EmailTokenVerify)
+}
+
+func (m *Manager) useEmailToken(ctx context.Context, tok string, kind EmailTokenKind) (User, error) {
+	token, err := m.GetEmailToken(ctx, HashEmailToken(tok), timeutil.NowUTC())
+	if err != nil {
+		return User{}, err
+	}
+	if token.Kind != kind {
+		return User{}, ErrEmailTokenInvalid
+	}
+	user, err := m.GetUser(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return User{}, ErrEmailTokenInvalid
+		}
+		return User{}, fmt.Errorf("get user: %w", err)
+	}
+	if user.Email != token.Email || user.Perms.IsBlocked {
+		return User{}, ErrEmailTokenInvalid
+	}
+	return user, nil
+}
+
+func (m *Manager) VerifyEmail(ctx context.Context, tok string) (User, error) {
+	user, err := m.useEmailToken(ctx, tok, EmailTokenVerify)
+	if err != nil {
+		return User{}, err
+	}
+	other, err := m.GetUserByVerifiedEmail(ctx, user.Email)
+	if err == nil && other.ID != user.ID {
+		return User{}, ErrEmailTaken
+	}
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return User{}, fmt.Errorf("check email: %w", err)
+	}
+	user.EmailVerified = true
+	if err := m.UpdateUser(ctx, user); err != nil {
+		return User{}, fmt.Errorf("update user: %w", err)
+	}
+	if err := m.DeleteEmailTokens(ctx, user.ID, EmailTokenVerify); err != nil {
+		return User{}, fmt.Errorf("delete tokens: %w", err)
+	}
+	return user, nil
+}
+
+// RequestPasswordReset sends the password reset link if there is a user with such verified email.
+// To avoid disclosing registered emails, it doesn't report that no such user exists.
+func (m *Manager) RequestPasswordReset(ctx context.Context, email string) error {
+	if m.mailer == nil {
+		return ErrMailNotConfigured
+	}
+	user, err := m.GetUserByVerifiedEmail(ctx, strings.TrimSpace(email))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return fmt.Errorf("get user: %w", err)
+	}
+	if user.Perms.IsBlocked {
+		return nil
+	}
+	return m.sendEmailToken(ctx, &user, EmailTokenReset)
+}
+
+func (m *Manager) ResetPassword(ctx context.Context, tok string, password []byte) (User, error) {
+	user, err := m.useEmailToken(ctx, tok, EmailTokenReset)
+	if err != nil {
+		return User{}, err
+	}
+	if err := m.SetPassword(&user, password); err != nil {
+		return User{}, fmt.Errorf("set password: %w", err)
+	}
+	if err := m.UpdateUser(ctx, user); err != nil {
+		return User{}, fmt.Errorf("update user: %w", err)
+	}
+	if err := m.DeleteEmailTokens(ctx, user.ID, EmailTokenReset); err != nil {
+		return User{}, fmt.Errorf("delete tokens: %w", err)
+	}
+	return user, nil
+}
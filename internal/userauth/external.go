@@ -0,0 +1,15 @@
+package userauth
+
+import (
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+// ExternalAccount links the user to the identity from an external provider (e.g. GitHub or any
+// OpenID Connect provider), so the user can log in via this provider. Each user can have at most
+// one linked account per provider.
+type ExternalAccount struct {
+	Provider  string `gorm:"primaryKey"`
+	Subject   string `gorm:"primaryKey"`
+	UserID    string `gorm:"index"`
+	CreatedAt timeutil.UTCTime
+}
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/alex65536/day20/internal/mailer"
 	"github.com/alex65536/day20/internal/util/clone"
 	"github.com/alex65536/day20/internal/util/slogx"
 	"github.com/alex65536/day20/internal/util/timeutil"
@@ -24,6 +25,12 @@ type ManagerOptions struct {
 	LinkPrefix       string           `toml:"link-prefix"`
 	Password         *PasswordOptions `toml:"password"`
 	InviteLinkExpiry time.Duration    `toml:"invite-link-expiry"`
+	InviteMaxExpiry  time.Duration    `toml:"invite-max-expiry"`
+	InviteMaxUses    int              `toml:"invite-max-uses"`
+	VerifyLinkPrefix string           `toml:"verify-link-prefix"`
+	ResetLinkPrefix  string           `toml:"reset-link-prefix"`
+	EmailTokenExpiry time.Duration    `toml:"email-token-expiry"`
+	SessionExpiry    time.Duration    `toml:"session-expiry"`
 }
 
 func (o ManagerOptions) Clone() ManagerOptions {
@@ -38,18 +45,33 @@ func (o *ManagerOptions) FillDefaults() {
 	if o.InviteLinkExpiry == 0 {
 		o.InviteLinkExpiry = 12 * time.Hour
 	}
+	if o.InviteMaxExpiry == 0 {
+		o.InviteMaxExpiry = 30 * 24 * time.Hour
+	}
+	if o.InviteMaxUses == 0 {
+		o.InviteMaxUses = 100
+	}
+	if o.EmailTokenExpiry == 0 {
+		o.EmailTokenExpiry = 2 * time.Hour
+	}
+	if o.SessionExpiry == 0 {
+		o.SessionExpiry = 42 * 24 * time.Hour
+	}
 }
 
 type Manager struct {
 	DB
 	o      *ManagerOptions
 	log    *slog.Logger
+	mailer *mailer.Mailer
 	ctx    context.Context
 	cancel func()
 	done   chan struct{}
 }
 
-func NewManager(log *slog.Logger, db DB, o ManagerOptions) (*Manager, error) {
+// NewManager creates a user manager. If mailer is nil, email verification and password reset are
+// not available.
+func NewManager(log *slog.Logger, db DB, mailer *mailer.Mailer, o ManagerOptions) (*Manager, error) {
 	o = o.Clone()
 	o.FillDefaults()
 	ctx, cancel := context.WithCancel(context.Background())
@@ -62,12 +84,13 @@ func NewManager(log *slog.Logger, db DB, o ManagerOptions) (*Manager, error) {
 		DB:     db,
 		o:      &o,
 		log:    log,
+		mailer: mailer,
 		ctx:    ctx,
 		cancel: cancel,
 		done:   make(chan struct{}),
 	}
 	if !hasOwner {
-		link, err := m.doGenerateInviteLink(m.ctx, "invite for owner", nil, OwnerPerms(), false)
+		link, err := m.doGenerateInviteLink(m.ctx, "invite for owner", nil, OwnerPerms(), InviteLinkOptions{}, false)
 		if err != nil {
 			cancel()
 			return nil, fmt.Errorf("create first invite: %w", err)
@@ -84,7 +107,45 @@ func (m *Manager) Close() {
 	<-m.done
 }
 
-func (m *Manager) doGenerateInviteLink(ctx context.Context, label string, creator *User, perms Perms, verify bool) (InviteLink, error) {
+// InviteLinkOptions specify how long the invite link is valid and how many users can register
+// with it. Zero values mean the defaults: single use and expiry from the manager options.
+type InviteLinkOptions struct {
+	Expiry  time.Duration
+	MaxUses int
+}
+
+func (m *Manager) InviteMaxExpiry() time.Duration {
+	return m.o.InviteMaxExpiry
+}
+
+func (m *Manager) InviteMaxUses() int {
+	return m.o.InviteMaxUses
+}
+
+func (m *Manager) doGenerateInviteLink(
+	ctx context.Context,
+	label string,
+	creator *User,
+	perms Perms,
+	lo InviteLinkOptions,
+	verify bool,
+) (InviteLink, error) {
+	if lo.Expiry == 0 {
+		lo.Expiry = m.o.InviteLinkExpiry
+	}
+	if lo.MaxUses == 0 {
+		lo.MaxUses = 1
+	}
+	if lo.Expiry < 0 || lo.Expiry > m.o.InviteMaxExpiry {
+		return InviteLink{}, &ErrorInviteLinkVerify{
+			e: fmt.Errorf("expiry must be positive and at most %v", m.o.InviteMaxExpiry),
+		}
+	}
+	if lo.MaxUses < 0 || lo.MaxUses > m.o.InviteMaxUses {
+		return InviteLink{}, &ErrorInviteLinkVerify{
+			e: fmt.Errorf("number of uses must be between 1 and %v", m.o.InviteMaxUses),
+		}
+	}
 	now := timeutil.NowUTC()
 	var ownerUserID *string
 	if creator != nil {
@@ -94,8 +155,9 @@ func (m *Manager) doGenerateInviteLink(ctx context.Context, label string, creato
 		OwnerUserID: ownerUserID,
 		Perms:       perms,
 		Label:       label,
+		UsesLeft:    lo.MaxUses,
 		CreatedAt:   now,
-		ExpiresAt:   now.Add(m.o.InviteLinkExpiry),
+		ExpiresAt:   now.Add(lo.Expiry),
 	}
 	if verify {
 		if ownerUserID == nil {
@@ -116,8 +178,14 @@ func (m *Manager) doGenerateInviteLink(ctx context.Context, label string, creato
 	return link, nil
 }
 
-func (m *Manager) GenerateInviteLink(ctx context.Context, label string, creator *User, perms Perms) (InviteLink, error) {
-	return m.doGenerateInviteLink(ctx, label, creator, perms, true)
+func (m *Manager) GenerateInviteLink(
+	ctx context.Context,
+	label string,
+	creator *User,
+	perms Perms,
+	lo InviteLinkOptions,
+) (InviteLink, error) {
+	return m.doGenerateInviteLink(ctx, label, creator, perms, lo, true)
 }
 
 func (m *Manager) GenerateRoomToken(ctx context.Context, label string, creator *User) (string, error) {
@@ -139,6 +207,45 @@ func (m *Manager) GenerateRoomToken(ctx context.Context, label string, creator *
 	return tok, nil
 }
 
+func (m *Manager) GenerateAPIToken(ctx context.Context, label string, creator *User) (string, error) {
+	if creator == nil || !creator.Perms.Get(PermRunContests) {
+		return "", fmt.Errorf("operation not permitted")
+	}
+	token := APIToken{
+		Label:     label,
+		UserID:    creator.ID,
+		CreatedAt: timeutil.NowUTC(),
+	}
+	tok, err := token.GenerateNew()
+	if err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	if err := m.CreateAPIToken(ctx, token); err != nil {
+		return "", fmt.Errorf("save token to db: %w", err)
+	}
+	return tok, nil
+}
+
+// GetUserByAPIToken returns the owner of the API token. Returns ErrAPITokenNotFound if the token is
+// invalid or the owner is not allowed to use it anymore.
+func (m *Manager) GetUserByAPIToken(ctx context.Context, tok string) (User, error) {
+	token, err := m.GetAPIToken(ctx, HashAPIToken(tok))
+	if err != nil {
+		return User{}, err
+	}
+	user, err := m.GetUser(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return User{}, ErrAPITokenNotFound
+		}
+		return User{}, fmt.Errorf("get user: %w", err)
+	}
+	if user.Perms.IsBlocked || !user.Perms.Get(PermRunContests) {
+		return User{}, ErrAPITokenNotFound
+	}
+	return user, nil
+}
+
 func (m *Manager) InviteLinkURL(l InviteLink) string {
 	return m.o.LinkPrefix + l.Value
 }
@@ -164,6 +271,14 @@ func (m *Manager) loop() {
 			if err != nil && !errors.Is(err, context.Canceled) {
 				m.log.Warn("could not prune invite links", slogx.Err(err))
 			}
+			err = m.DB.PruneEmailTokens(m.ctx, timeutil.NowUTC())
+			if err != nil && !errors.Is(err, context.Canceled) {
+				m.log.Warn("could not prune email tokens", slogx.Err(err))
+			}
+			err = m.DB.PruneSessions(m.ctx, timeutil.NowUTC().Add(-m.o.SessionExpiry))
+			if err != nil && !errors.Is(err, context.Canceled) {
+				m.log.Warn("could not prune sessions", slogx.Err(err))
+			}
 			select {
 			case <-m.ctx.Done():
 				return
@@ -37,6 +37,7 @@ const (
 	PermRunContests
 	PermHostRooms
 	PermAdmin
+	PermPrioritize
 	PermMax
 )
 
@@ -52,6 +53,8 @@ func (k PermKind) String() string {
 		return "host-rooms"
 	case PermAdmin:
 		return "admin"
+	case PermPrioritize:
+		return "prioritize"
 	default:
 		panic("bad perm")
 	}
@@ -69,6 +72,8 @@ func (k PermKind) PrettyString() string {
 		return "Host rooms"
 	case PermAdmin:
 		return "Admin"
+	case PermPrioritize:
+		return "Prioritize contests"
 	default:
 		panic("bad perm")
 	}
@@ -83,6 +88,7 @@ type Perms struct {
 	CanRunContests bool
 	CanHostRooms   bool
 	CanAdmin       bool
+	CanPrioritize  bool
 }
 
 func (p *Perms) GetMut(k PermKind) *bool {
@@ -97,6 +103,8 @@ func (p *Perms) GetMut(k PermKind) *bool {
 		return &p.CanHostRooms
 	case PermAdmin:
 		return &p.CanAdmin
+	case PermPrioritize:
+		return &p.CanPrioritize
 	default:
 		panic("bad perm to get")
 	}
@@ -120,6 +128,7 @@ func OwnerPerms() Perms {
 		CanRunContests: true,
 		CanHostRooms:   true,
 		CanAdmin:       true,
+		CanPrioritize:  true,
 	}
 }
 
@@ -142,15 +151,20 @@ func (p Perms) LessEq(q Perms) bool {
 }
 
 type User struct {
-	ID           string  `gorm:"primaryKey"`
-	Username     string  `gorm:"index"`
-	InviterID    *string `gorm:"index"`
-	PasswordHash []byte
-	PasswordSalt []byte
-	Epoch        int
-	Perms        Perms        `gorm:"embedded"`
-	RoomTokens   []RoomToken  `gorm:"foreignKey:UserID"`
-	InviteLinks  []InviteLink `gorm:"foreignKey:OwnerUserID"`
+	ID               string  `gorm:"primaryKey"`
+	Username         string  `gorm:"index"`
+	InviterID        *string `gorm:"index"`
+	PasswordHash     []byte
+	PasswordSalt     []byte
+	Epoch            int
+	Email            string `gorm:"index"`
+	EmailVerified    bool
+	Perms            Perms             `gorm:"embedded"`
+	Prefs            Prefs             `gorm:"embedded;embeddedPrefix:pref_"`
+	RoomTokens       []RoomToken       `gorm:"foreignKey:UserID"`
+	APITokens        []APIToken        `gorm:"foreignKey:UserID"`
+	InviteLinks      []InviteLink      `gorm:"foreignKey:OwnerUserID"`
+	ExternalAccounts []ExternalAccount `gorm:"foreignKey:UserID"`
 }
 
 func (u *User) doHash(password []byte, o *PasswordOptions) []byte {
@@ -188,6 +202,7 @@ type InviteLink struct {
 	Label       string
 	Value       string
 	Perms       Perms `gorm:"embedded"`
+	UsesLeft    int   `gorm:"default:1"`
 	CreatedAt   timeutil.UTCTime
 	ExpiresAt   timeutil.UTCTime `gorm:"index"`
 }
@@ -228,6 +243,28 @@ func (t *RoomToken) GenerateNew() (string, error) {
 	return tok, nil
 }
 
+// APIToken allows to manage contests of the user via JSON API without logging in.
+type APIToken struct {
+	Hash      string `gorm:"primaryKey"`
+	Label     string
+	UserID    string `gorm:"index"`
+	CreatedAt timeutil.UTCTime
+}
+
+func HashAPIToken(tok string) string {
+	hash := sha256.Sum256([]byte(tok))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func (t *APIToken) GenerateNew() (string, error) {
+	tok, err := idgen.SecureToken()
+	if err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	t.Hash = HashAPIToken(tok)
+	return tok, nil
+}
+
 func (u *User) CanChangePerms(initiator *User, newPerms Perms) error {
 	// Reset all the other perms if we are going to block the user.
 	if newPerms.IsBlocked {
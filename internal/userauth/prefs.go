@@ -0,0 +1,47 @@
+package userauth
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/alex65536/go-chess/clock"
+)
+
+// BoardThemes are the color themes of the chess board. The first one is the default.
+var BoardThemes = []string{"brown", "blue", "green", "gray"}
+
+// Themes are the color themes of the web UI. The first one is the default.
+var Themes = []string{"light", "dark"}
+
+const MaxGamesPerPage = 500
+
+// Prefs are the personal defaults of the user in the web UI. Zero values mean the site defaults.
+type Prefs struct {
+	BoardTheme string
+	Theme      string
+	// TimeControl is the default time control for new contests, in the same format as in the
+	// contest creation form.
+	TimeControl  string
+	GamesPerPage int
+	// Language is the language of the web UI. The set of supported languages is known only to the
+	// web UI, so it's not validated here.
+	Language string
+}
+
+func (p *Prefs) Validate() error {
+	if p.BoardTheme != "" && !slices.Contains(BoardThemes, p.BoardTheme) {
+		return fmt.Errorf("unknown board theme %q", p.BoardTheme)
+	}
+	if p.Theme != "" && !slices.Contains(Themes, p.Theme) {
+		return fmt.Errorf("unknown theme %q", p.Theme)
+	}
+	if p.TimeControl != "" {
+		if _, err := clock.ControlFromString(p.TimeControl); err != nil {
+			return fmt.Errorf("bad time control: %w", err)
+		}
+	}
+	if p.GamesPerPage < 0 || p.GamesPerPage > MaxGamesPerPage {
+		return fmt.Errorf("games per page must be between 1 and %v", MaxGamesPerPage)
+	}
+	return nil
+}
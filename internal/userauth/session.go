@@ -0,0 +1,18 @@
+package userauth
+
+import (
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+const UserAgentMaxLen = 256
+
+// Session holds the metadata of a web session, so the user can see where they are logged in and
+// revoke the sessions remotely.
+type Session struct {
+	ID         string `gorm:"primaryKey"`
+	UserID     string `gorm:"index"`
+	CreatedAt  timeutil.UTCTime
+	LastSeenAt timeutil.UTCTime `gorm:"index"`
+	IP         string
+	UserAgent  string
+}
@@ -0,0 +1,205 @@
+package userauth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LoginThrottlerOptions configures the throttler. MaxUserFailures limits the failures for the same
+// username from the same IP, and MaxUsernameFailures limits the failures for the same username from
+// all the IPs. The latter is locked out for UsernameLockout instead of Lockout.
+type LoginThrottlerOptions struct {
+	Window              time.Duration `toml:"window"`
+	MaxIPFailures       int           `toml:"max-ip-failures"`
+	MaxUserFailures     int           `toml:"max-user-failures"`
+	MaxUsernameFailures int           `toml:"max-username-failures"`
+	Lockout             time.Duration `toml:"lockout"`
+	UsernameLockout     time.Duration `toml:"username-lockout"`
+}
+
+func (o LoginThrottlerOptions) Clone() LoginThrottlerOptions {
+	return o
+}
+
+func (o *LoginThrottlerOptions) FillDefaults() {
+	if o.Window == 0 {
+		o.Window = 15 * time.Minute
+	}
+	if o.MaxIPFailures == 0 {
+		o.MaxIPFailures = 30
+	}
+	if o.MaxUserFailures == 0 {
+		o.MaxUserFailures = 5
+	}
+	if o.MaxUsernameFailures == 0 {
+		o.MaxUsernameFailures = 50
+	}
+	if o.Lockout == 0 {
+		o.Lockout = 15 * time.Minute
+	}
+	if o.UsernameLockout == 0 {
+		o.UsernameLockout = 5 * time.Minute
+	}
+}
+
+type userKey struct {
+	ip       string
+	username string
+}
+
+type throttleEntry struct {
+	failures    []time.Time
+	lockedUntil time.Time
+}
+
+func (e *throttleEntry) prune(now time.Time, window time.Duration) {
+	i := 0
+	for i < len(e.failures) && now.Sub(e.failures[i]) > window {
+		i++
+	}
+	e.failures = e.failures[i:]
+}
+
+func (e *throttleEntry) isEmpty(now time.Time) bool {
+	return len(e.failures) == 0 && !now.Before(e.lockedUntil)
+}
+
+// LoginThrottler counts failed logins per IP, per pair of IP and username and per username in a
+// sliding window and locks out the IP, the pair or the username for some time after too many
+// failures. The username alone has a higher limit and a shorter lockout, as anyone can lock out any
+// user by guessing their password on purpose, but it still slows down the guessing from many IPs.
+// State is kept in memory only.
+type LoginThrottler struct {
+	o         LoginThrottlerOptions
+	mu        sync.Mutex
+	ips       map[string]*throttleEntry
+	users     map[userKey]*throttleEntry
+	usernames map[string]*throttleEntry
+	ctx       context.Context
+	cancel func()
+	done   chan struct{}
+}
+
+func NewLoginThrottler(o LoginThrottlerOptions) *LoginThrottler {
+	o = o.Clone()
+	o.FillDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &LoginThrottler{
+		o:         o,
+		ips:       make(map[string]*throttleEntry),
+		users:     make(map[userKey]*throttleEntry),
+		usernames: make(map[string]*throttleEntry),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// SetOptions replaces the throttler options. The failures recorded so far are kept, while the
+// lockouts already in effect are not changed.
+func (t *LoginThrottler) SetOptions(o LoginThrottlerOptions) {
+	o = o.Clone()
+	o.FillDefaults()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.o = o
+}
+
+func (t *LoginThrottler) Close() {
+	t.cancel()
+	<-t.done
+}
+
+func lockedFor[K comparable](m map[K]*throttleEntry, key K, now time.Time) time.Duration {
+	e, ok := m[key]
+	if !ok || !now.Before(e.lockedUntil) {
+		return 0
+	}
+	return e.lockedUntil.Sub(now)
+}
+
+// Check returns zero if the login attempt is allowed. Otherwise, it returns the time after which
+// the attempt can be retried.
+func (t *LoginThrottler) Check(ip, username string) time.Duration {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return max(
+		lockedFor(t.ips, ip, now),
+		lockedFor(t.users, userKey{ip: ip, username: username}, now),
+		lockedFor(t.usernames, username, now),
+	)
+}
+
+func addFailure[K comparable](m map[K]*throttleEntry, key K, limit int, window, lockout time.Duration, now time.Time) bool {
+	e, ok := m[key]
+	if !ok {
+		e = &throttleEntry{}
+		m[key] = e
+	}
+	e.prune(now, window)
+	e.failures = append(e.failures, now)
+	if len(e.failures) < limit {
+		return false
+	}
+	e.failures = nil
+	e.lockedUntil = now.Add(lockout)
+	return true
+}
+
+// OnFailure records a failed login attempt. It returns true if the IP, the username on this IP or
+// the username itself got locked out after this attempt.
+func (t *LoginThrottler) OnFailure(ip, username string) bool {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ipLocked := addFailure(t.ips, ip, t.o.MaxIPFailures, t.o.Window, t.o.Lockout, now)
+	userLocked := addFailure(t.users, userKey{ip: ip, username: username}, t.o.MaxUserFailures, t.o.Window, t.o.Lockout, now)
+	usernameLocked := addFailure(t.usernames, username, t.o.MaxUsernameFailures, t.o.Window, t.o.UsernameLockout, now)
+	return ipLocked || userLocked || usernameLocked
+}
+
+func (t *LoginThrottler) OnSuccess(ip, username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.users, userKey{ip: ip, username: username})
+	delete(t.usernames, username)
+}
+
+func gcEntries[K comparable](m map[K]*throttleEntry, now time.Time, window time.Duration) {
+	for k, e := range m {
+		e.prune(now, window)
+		if e.isEmpty(now) {
+			delete(m, k)
+		}
+	}
+}
+
+func (t *LoginThrottler) gc() {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	gcEntries(t.ips, now, t.o.Window)
+	gcEntries(t.users, now, t.o.Window)
+	gcEntries(t.usernames, now, t.o.Window)
+}
+
+func (t *LoginThrottler) loop() {
+	defer close(t.done)
+	t.mu.Lock()
+	window := t.o.Window
+	t.mu.Unlock()
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+			t.gc()
+		}
+	}
+}
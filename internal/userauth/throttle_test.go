@@ -0,0 +1,86 @@
+package userauth
+
+import (
+	"testing"
+)
+
+func newTestThrottler(t *testing.T) *LoginThrottler {
+	t.Helper()
+	th := NewLoginThrottler(LoginThrottlerOptions{MaxIPFailures: 5, MaxUserFailures: 3, MaxUsernameFailures: 4})
+	t.Cleanup(th.Close)
+	return th
+}
+
+func TestLoginThrottlerUser(t *testing.T) {
+	th := newTestThrottler(t)
+	for i := range 3 {
+		if retry := th.Check("1.1.1.1", "alice"); retry != 0 {
+			t.Fatalf("attempt #%v throttled", i+1)
+		}
+		locked := th.OnFailure("1.1.1.1", "alice")
+		if expected := i == 2; locked != expected {
+			t.Fatalf("bad lock after attempt #%v: expected = %v, got = %v", i+1, expected, locked)
+		}
+	}
+	if retry := th.Check("1.1.1.1", "alice"); retry == 0 {
+		t.Fatalf("user not locked out")
+	}
+	// The lockout must not affect the user logging in from another IP, otherwise the attacker can
+	// lock out any user.
+	if retry := th.Check("2.2.2.2", "alice"); retry != 0 {
+		t.Fatalf("user locked out from another ip")
+	}
+	if retry := th.Check("1.1.1.1", "bob"); retry != 0 {
+		t.Fatalf("another user locked out")
+	}
+}
+
+func TestLoginThrottlerIP(t *testing.T) {
+	th := newTestThrottler(t)
+	for i, user := range []string{"a", "b", "c", "d", "e"} {
+		locked := th.OnFailure("1.1.1.1", user)
+		if expected := i == 4; locked != expected {
+			t.Fatalf("bad lock after attempt #%v: expected = %v, got = %v", i+1, expected, locked)
+		}
+	}
+	if retry := th.Check("1.1.1.1", "f"); retry == 0 {
+		t.Fatalf("ip not locked out")
+	}
+	if retry := th.Check("2.2.2.2", "a"); retry != 0 {
+		t.Fatalf("another ip locked out")
+	}
+}
+
+func TestLoginThrottlerUsername(t *testing.T) {
+	th := newTestThrottler(t)
+	for i, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"} {
+		locked := th.OnFailure(ip, "alice")
+		if expected := i == 3; locked != expected {
+			t.Fatalf("bad lock after attempt #%v: expected = %v, got = %v", i+1, expected, locked)
+		}
+	}
+	if retry := th.Check("5.5.5.5", "alice"); retry == 0 {
+		t.Fatalf("username not locked out")
+	}
+	if retry := th.Check("5.5.5.5", "bob"); retry != 0 {
+		t.Fatalf("another user locked out")
+	}
+}
+
+func TestLoginThrottlerSuccess(t *testing.T) {
+	th := newTestThrottler(t)
+	th.OnFailure("1.1.1.1", "alice")
+	th.OnFailure("1.1.1.1", "alice")
+	th.OnSuccess("1.1.1.1", "alice")
+	if th.OnFailure("1.1.1.1", "alice") {
+		t.Fatalf("failures not reset after success")
+	}
+
+	for _, ip := range []string{"2.2.2.2", "3.3.3.3", "4.4.4.4"} {
+		th.OnFailure(ip, "bob")
+	}
+	th.OnSuccess("5.5.5.5", "bob")
+	if th.OnFailure("6.6.6.6", "bob") {
+		t.Fatalf("username failures not reset after success")
+	}
+}
@@ -0,0 +1,78 @@
+package httputil
+
+import (
+	"context"
+	"sync"
+)
+
+// Drainer notifies long-lived handlers (such as websockets and event streams) that the server is
+// going to stop, so they can ask their clients to reconnect instead of being cut off abruptly.
+type Drainer struct {
+	ch   chan struct{}
+	once sync.Once
+
+	mu     sync.Mutex
+	active int
+	idle   chan struct{}
+}
+
+type drainerKey struct{}
+
+func NewDrainer() *Drainer {
+	return &Drainer{ch: make(chan struct{})}
+}
+
+// WrapContext attaches the drainer to the context, so the handlers can find it via TrackDrain.
+func (d *Drainer) WrapContext(parent context.Context) context.Context {
+	return context.WithValue(parent, drainerKey{}, d)
+}
+
+// Drain notifies all the tracked handlers. It is safe to call Drain multiple times.
+func (d *Drainer) Drain() {
+	d.once.Do(func() { close(d.ch) })
+}
+
+// Wait waits until all the tracked handlers finish or ctx is done.
+func (d *Drainer) Wait(ctx context.Context) error {
+	d.mu.Lock()
+	if d.active == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Drainer) release() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active--
+	if d.active == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// TrackDrain returns a channel which is closed when the server starts draining. The caller must
+// call release after the handler finishes. If there is no drainer in the context, the returned
+// channel is never closed.
+func TrackDrain(ctx context.Context) (drainCh <-chan struct{}, release func()) {
+	d, ok := ctx.Value(drainerKey{}).(*Drainer)
+	if !ok {
+		return nil, func() {}
+	}
+	d.mu.Lock()
+	d.active++
+	d.mu.Unlock()
+	var once sync.Once
+	return d.ch, func() { once.Do(d.release) }
+}
@@ -0,0 +1,120 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies is a list of networks from which forwarded headers are accepted.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses a list of IP addresses or CIDR networks.
+func ParseTrustedProxies(ss []string) (TrustedProxies, error) {
+	res := make(TrustedProxies, 0, len(ss))
+	for _, s := range ss {
+		if strings.Contains(s, "/") {
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("parse %q: %w", s, err)
+			}
+			res = append(res, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %w", s, err)
+		}
+		res = append(res, netip.PrefixFrom(a, a.BitLen()))
+	}
+	return res, nil
+}
+
+func (t TrustedProxies) containsStr(s string) bool {
+	a, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+	a = a.Unmap()
+	for _, p := range t {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// IsTrusted reports whether the request came directly from a trusted proxy.
+func (t TrustedProxies) IsTrusted(req *http.Request) bool {
+	return len(t) != 0 && t.containsStr(splitHost(req.RemoteAddr))
+}
+
+// ClientIP returns the IP address of the client. If the request came from a trusted proxy, then
+// X-Forwarded-For is walked from right to left, and the first untrusted address is returned.
+func (t TrustedProxies) ClientIP(req *http.Request) string {
+	host := splitHost(req.RemoteAddr)
+	if !t.IsTrusted(req) {
+		return host
+	}
+	var hops []string
+	for _, h := range req.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// Garbage in the header, don't trust anything to the left of it.
+			break
+		}
+		host = hop
+		if !t.containsStr(hop) {
+			break
+		}
+	}
+	return host
+}
+
+type secureKey struct{}
+
+func (t TrustedProxies) isForwardedHTTPS(req *http.Request) bool {
+	if !t.IsTrusted(req) {
+		return false
+	}
+	proto, _, _ := strings.Cut(req.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// Wrap returns a handler which replaces the remote address with the real client address if the
+// request came from a trusted proxy. Whether the original request used HTTPS is remembered and can
+// be queried with IsSecureRequest.
+func (t TrustedProxies) Wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		secure := req.TLS != nil || t.isForwardedHTTPS(req)
+		trusted := t.IsTrusted(req)
+		clientIP := t.ClientIP(req)
+		req = req.WithContext(context.WithValue(req.Context(), secureKey{}, secure))
+		if trusted {
+			req.RemoteAddr = net.JoinHostPort(clientIP, "0")
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// IsSecureRequest reports whether the client used HTTPS, either directly or via a trusted proxy.
+func IsSecureRequest(req *http.Request) bool {
+	if secure, ok := req.Context().Value(secureKey{}).(bool); ok {
+		return secure
+	}
+	return req.TLS != nil
+}
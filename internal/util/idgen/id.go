@@ -33,13 +33,17 @@ func init() {
 	}
 }
 
-func ID() string {
-	// This ID generator follows https://github.com/ulid/spec, but is lowercase and not monotonic.
-	var b strings.Builder
-	ts := uint64(time.Now().UnixMilli()) & ((1 << 48) - 1)
+func writeTimestamp(b *strings.Builder, t time.Time) {
+	ts := uint64(t.UnixMilli()) & ((1 << 48) - 1)
 	for i := 45; i >= 0; i -= 5 {
 		_ = b.WriteByte(idAlphabet[(ts>>i)&31])
 	}
+}
+
+func ID() string {
+	// This ID generator follows https://github.com/ulid/spec, but is lowercase and not monotonic.
+	var b strings.Builder
+	writeTimestamp(&b, time.Now())
 	for range 2 {
 		r := rand.Uint64()
 		for range 8 {
@@ -50,6 +54,14 @@ func ID() string {
 	return b.String()
 }
 
+// TimePrefix returns the prefix of IDs generated at time t. As IDs are sorted by time, all the IDs
+// generated at t or later compare greater than the returned prefix.
+func TimePrefix(t time.Time) string {
+	var b strings.Builder
+	writeTimestamp(&b, t)
+	return b.String()
+}
+
 func SecureLinkValue() (string, error) {
 	var b strings.Builder
 	var bigLen = big.NewInt(int64(len(idAlphabet)))
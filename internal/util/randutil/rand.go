@@ -41,3 +41,8 @@ func NewConcurrentSource(s rand.Source) ConcurrentSource {
 	}
 	return &concurrentSource{s: s}
 }
+
+// NewSeededSource returns a deterministic source which yields the same sequence for the same seed.
+func NewSeededSource(seed uint64) ConcurrentSource {
+	return NewConcurrentSource(rand.NewPCG(seed, 0))
+}
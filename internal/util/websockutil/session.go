@@ -27,7 +27,7 @@ type Session struct {
 	recv ReceiverFunc
 
 	writeCh chan msg
-	closeCh chan struct{}
+	closeCh chan []byte
 	wg      sync.WaitGroup
 
 	ctx    context.Context
@@ -66,7 +66,7 @@ func (f *SessionFactory) NewSession(
 		o:       &f.o,
 		recv:    recv,
 		writeCh: make(chan msg),
-		closeCh: make(chan struct{}, 1),
+		closeCh: make(chan []byte, 1),
 		ctx:     ctx,
 		cancel:  cancel,
 	}
@@ -127,8 +127,8 @@ func (s *Session) WriteLoop() {
 		var cur msg
 		shutdown := false
 		select {
-		case <-s.closeCh:
-			cur = msg{kind: websocket.CloseMessage, data: []byte{}}
+		case data := <-s.closeCh:
+			cur = msg{kind: websocket.CloseMessage, data: data}
 			shutdown = true
 		case cur = <-s.writeCh:
 		case <-ticker.C:
@@ -147,14 +147,24 @@ func (s *Session) WriteLoop() {
 	}
 }
 
-func (s *Session) Shutdown() {
+func (s *Session) shutdown(data []byte) {
 	select {
-	case s.closeCh <- struct{}{}:
+	case s.closeCh <- data:
 	default:
 	}
 	<-s.ctx.Done()
 }
 
+func (s *Session) Shutdown() {
+	s.shutdown([]byte{})
+}
+
+// Restart closes the session, telling the client that the server is restarting. Well-behaved
+// clients reconnect after receiving such close message.
+func (s *Session) Restart() {
+	s.shutdown(websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restart"))
+}
+
 func (s *Session) WriteMsg(kind int, data []byte) error {
 	select {
 	case s.writeCh <- msg{kind: kind, data: data}:
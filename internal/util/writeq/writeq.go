@@ -0,0 +1,379 @@
+// Package writeq implements a write-behind queue. The writes are accumulated in memory and flushed
+// to the storage in batches by a background goroutine, so the callers don't wait for the storage.
+package writeq
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alex65536/day20/internal/util/backoff"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type Options struct {
+	// FlushInterval is how long the writes are accumulated before being flushed.
+	FlushInterval time.Duration `toml:"flush-interval"`
+	// MaxBatch is the maximum number of writes flushed at once. The queue is flushed immediately
+	// once it has that many writes.
+	MaxBatch int `toml:"max-batch"`
+	// Timeout is the timeout of a single flush attempt.
+	Timeout time.Duration `toml:"timeout"`
+	// MaxAttempts is the number of attempts to flush a batch. If all of them fail, the writes from
+	// the batch are flushed one by one, and the failed ones are put back into the queue. A write which
+	// fails in MaxAttempts flushes is dropped.
+	MaxAttempts int64 `toml:"max-attempts"`
+}
+
+func (o *Options) Validate() error {
+	if o.FlushInterval < 0 {
+		return fmt.Errorf("negative flush interval")
+	}
+	if o.MaxBatch < 0 {
+		return fmt.Errorf("negative max batch")
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("negative timeout")
+	}
+	if o.MaxAttempts < 0 {
+		return fmt.Errorf("negative max attempts")
+	}
+	return nil
+}
+
+func (o *Options) FillDefaults() {
+	if o.FlushInterval == 0 {
+		o.FlushInterval = 100 * time.Millisecond
+	}
+	if o.MaxBatch == 0 {
+		o.MaxBatch = 256
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.MaxAttempts == 0 {
+		o.MaxAttempts = 5
+	}
+}
+
+type Item[K comparable, V any] struct {
+	Key   K
+	Value V
+	// Seq is the position of the write in the queue. Later writes have larger Seq, even if they
+	// are flushed earlier due to retries.
+	Seq uint64
+	// Attempts is the number of failed flushes of the write.
+	Attempts int64
+}
+
+type entry[V any] struct {
+	seq      uint64
+	attempts int64
+	value    V
+}
+
+// Queue is a write-behind queue. Writes with the same key are coalesced, so only the latest one is
+// flushed. Otherwise, the writes are flushed in the order they were put. Failed writes are kept in
+// the queue and retried later, so a single bad write doesn't prevent the others from being flushed.
+// The writes are dropped if they fail too many times or still cannot be flushed when the queue is
+// closed.
+type Queue[K comparable, V any] struct {
+	o     Options
+	log   *slog.Logger
+	write func(ctx context.Context, items []Item[K, V]) error
+
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+	wakeCh chan struct{}
+	urgent chan struct{}
+
+	mu          sync.Mutex
+	closed      bool
+	pending     map[K]entry[V]
+	seq         uint64
+	inflightMin uint64
+	inflight    bool
+	progress    chan struct{}
+}
+
+// New creates a queue, which calls write to flush the batches. Batches are never written
+// concurrently.
+func New[K comparable, V any](
+	log *slog.Logger,
+	o Options,
+	write func(ctx context.Context, items []Item[K, V]) error,
+) (*Queue[K, V], error) {
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("bad options: %w", err)
+	}
+	o.FillDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue[K, V]{
+		o:        o,
+		log:      log,
+		write:    write,
+		ctx:      ctx,
+		cancel:   cancel,
+		wakeCh:   make(chan struct{}, 1),
+		urgent:   make(chan struct{}, 1),
+		pending:  make(map[K]entry[V]),
+		progress: make(chan struct{}),
+	}
+	q.wg.Add(1)
+	go q.loop()
+	return q, nil
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Put enqueues the write. If there is a pending write with the same key, it is replaced. After
+// the queue is closed, the write is done synchronously.
+func (q *Queue[K, V]) Put(key K, value V) {
+	q.mu.Lock()
+	if q.closed {
+		q.seq++
+		seq := q.seq
+		q.mu.Unlock()
+		// Wait for the pending writes, so the order is preserved.
+		q.wg.Wait()
+		item := Item[K, V]{Key: key, Value: value, Seq: seq}
+		if failed := q.flushBatch([]Item[K, V]{item}); len(failed) != 0 {
+			q.log.Error("could not flush write after close, dropping it")
+		}
+		return
+	}
+	q.seq++
+	q.pending[key] = entry[V]{seq: q.seq, value: value}
+	size := len(q.pending)
+	q.mu.Unlock()
+
+	if size == 1 {
+		notify(q.wakeCh)
+	}
+	if size >= q.o.MaxBatch {
+		notify(q.urgent)
+	}
+}
+
+func (q *Queue[K, V]) flushedUnlocked(target uint64) bool {
+	if q.inflight && q.inflightMin <= target {
+		return false
+	}
+	for _, e := range q.pending {
+		if e.seq <= target {
+			return false
+		}
+	}
+	return true
+}
+
+// LastSeq returns the position of the latest write put into the queue.
+func (q *Queue[K, V]) LastSeq() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.seq
+}
+
+// Flush waits until all the writes put before the call are flushed or dropped. If some of them keep
+// failing, Flush waits until they are dropped or ctx is done.
+func (q *Queue[K, V]) Flush(ctx context.Context) error {
+	q.mu.Lock()
+	target := q.seq
+	q.mu.Unlock()
+	for {
+		q.mu.Lock()
+		flushed := q.flushedUnlocked(target)
+		progress := q.progress
+		q.mu.Unlock()
+		if flushed {
+			return nil
+		}
+		notify(q.urgent)
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// takeBatch takes the oldest writes from the queue. The failed writes which are not put back into
+// the queue yet are still considered in flight.
+func (q *Queue[K, V]) takeBatch(failed []Item[K, V]) []Item[K, V] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return nil
+	}
+	items := make([]Item[K, V], 0, len(q.pending))
+	for k, e := range q.pending {
+		items = append(items, Item[K, V]{Key: k, Value: e.value, Seq: e.seq, Attempts: e.attempts})
+	}
+	slices.SortFunc(items, func(a, b Item[K, V]) int {
+		return cmp.Compare(a.Seq, b.Seq)
+	})
+	items = items[:min(len(items), q.o.MaxBatch)]
+	for _, it := range items {
+		delete(q.pending, it.Key)
+	}
+	q.inflight = true
+	q.inflightMin = items[0].Seq
+	if len(failed) != 0 {
+		// Batches are taken in order, so the failed writes are older.
+		q.inflightMin = failed[0].Seq
+	}
+	return items
+}
+
+// requeue puts the failed writes back into the queue, unless they were superseded by the newer
+// writes with the same key. The writes keep their original position in the queue.
+func (q *Queue[K, V]) requeue(items []Item[K, V]) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, it := range items {
+		if _, ok := q.pending[it.Key]; ok {
+			continue
+		}
+		q.pending[it.Key] = entry[V]{seq: it.Seq, attempts: it.Attempts, value: it.Value}
+	}
+	q.inflight = false
+}
+
+func (q *Queue[K, V]) writeItems(items []Item[K, V]) error {
+	ctx, cancel := context.WithTimeout(context.Background(), q.o.Timeout)
+	defer cancel()
+	return q.write(ctx, items)
+}
+
+// flushBatch writes the batch and returns the writes which could not be flushed. If the batch fails
+// to be written, the writes are retried one by one, so the bad write doesn't fail the others.
+func (q *Queue[K, V]) flushBatch(batch []Item[K, V]) []Item[K, V] {
+	b, err := backoff.New(backoff.Options{
+		Min:         100 * time.Millisecond,
+		Max:         5 * time.Second,
+		MaxAttempts: q.o.MaxAttempts,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("must not happen: %v", err))
+	}
+	for {
+		err := q.writeItems(batch)
+		if err == nil {
+			return nil
+		}
+		wait, ok := b.Next()
+		if !ok {
+			if len(batch) == 1 {
+				q.log.Error("could not flush write", slogx.Err(err))
+				return batch
+			}
+			q.log.Warn("could not flush writes, flushing them one by one",
+				slog.Int("count", len(batch)),
+				slogx.Err(err),
+			)
+			break
+		}
+		q.log.Warn("could not flush writes, retrying", slog.Int("count", len(batch)), slogx.Err(err))
+		// Do not sleep when closing, so the shutdown is not delayed too much.
+		select {
+		case <-time.After(wait):
+		case <-q.ctx.Done():
+		}
+	}
+	var failed []Item[K, V]
+	for _, it := range batch {
+		if err := q.writeItems([]Item[K, V]{it}); err != nil {
+			q.log.Error("could not flush write", slogx.Err(err))
+			failed = append(failed, it)
+		}
+	}
+	return failed
+}
+
+// flushAll flushes the pending writes. The failed writes are put back into the queue after all the
+// other writes are flushed, so they are retried in the next round, unless they have already failed
+// too many times.
+func (q *Queue[K, V]) flushAll() {
+	var failed []Item[K, V]
+	for {
+		batch := q.takeBatch(failed)
+		if len(batch) == 0 {
+			break
+		}
+		// The failed writes are superseded by the newer writes with the same key.
+		failed = slices.DeleteFunc(failed, func(f Item[K, V]) bool {
+			return slices.ContainsFunc(batch, func(it Item[K, V]) bool { return it.Key == f.Key })
+		})
+		for _, it := range q.flushBatch(batch) {
+			it.Attempts++
+			if it.Attempts >= q.o.MaxAttempts {
+				q.log.Error("could not flush write, dropping it", slog.Int64("attempts", it.Attempts))
+				continue
+			}
+			failed = append(failed, it)
+		}
+		q.mu.Lock()
+		q.inflight = len(failed) != 0
+		if q.inflight {
+			q.inflightMin = failed[0].Seq
+		}
+		close(q.progress)
+		q.progress = make(chan struct{})
+		q.mu.Unlock()
+	}
+	if len(failed) != 0 {
+		q.requeue(failed)
+		notify(q.wakeCh)
+	}
+}
+
+func (q *Queue[K, V]) loop() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.wakeCh:
+			timer := time.NewTimer(q.o.FlushInterval)
+			select {
+			case <-timer.C:
+			case <-q.urgent:
+			case <-q.ctx.Done():
+			}
+			timer.Stop()
+		case <-q.urgent:
+		case <-q.ctx.Done():
+		}
+		q.flushAll()
+		if q.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Close flushes all the pending writes and stops the queue. The writes which still cannot be flushed
+// are dropped.
+func (q *Queue[K, V]) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.mu.Unlock()
+	q.cancel()
+	q.wg.Wait()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) != 0 {
+		q.log.Error("could not flush writes before close, dropping them", slog.Int("count", len(q.pending)))
+	}
+}
@@ -0,0 +1,240 @@
+package writeq
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type testStorage struct {
+	mu      sync.Mutex
+	batches [][]Item[string, int]
+	values  map[string]int
+	// fail returns true if the batch must fail.
+	fail func(batch []Item[string, int]) bool
+}
+
+func newTestStorage() *testStorage {
+	return &testStorage{values: make(map[string]int)}
+}
+
+func (s *testStorage) write(_ context.Context, batch []Item[string, int]) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil && s.fail(batch) {
+		return errors.New("write failed")
+	}
+	s.batches = append(s.batches, slices.Clone(batch))
+	for _, it := range batch {
+		s.values[it.Key] = it.Value
+	}
+	return nil
+}
+
+func (s *testStorage) setFail(fail func(batch []Item[string, int]) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func (s *testStorage) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []string
+	for _, b := range s.batches {
+		for _, it := range b {
+			res = append(res, it.Key)
+		}
+	}
+	return res
+}
+
+func (s *testStorage) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]int, len(s.batches))
+	for i, b := range s.batches {
+		res[i] = len(b)
+	}
+	return res
+}
+
+func newTestQueue(t *testing.T, s *testStorage, o Options) *Queue[string, int] {
+	t.Helper()
+	q, err := New(slogx.DiscardLogger(), o, s.write)
+	if err != nil {
+		t.Fatalf("create queue: %v", err)
+	}
+	t.Cleanup(q.Close)
+	return q
+}
+
+func flush(t *testing.T, q *Queue[string, int]) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+}
+
+func TestBatching(t *testing.T) {
+	s := newTestStorage()
+	q := newTestQueue(t, s, Options{FlushInterval: time.Hour, MaxBatch: 3})
+	for i, key := range []string{"a", "b", "a", "c", "d", "e", "f"} {
+		q.Put(key, i)
+	}
+	flush(t, q)
+
+	// Writes with the same key are coalesced, and the latest one keeps the position in the queue.
+	if got, expected := s.keys(), []string{"b", "a", "c", "d", "e", "f"}; !slices.Equal(got, expected) {
+		t.Fatalf("bad keys: expected = %v, got = %v", expected, got)
+	}
+	for _, size := range s.batchSizes() {
+		if size > 3 {
+			t.Fatalf("batch too large: %v", size)
+		}
+	}
+	if got := s.values["a"]; got != 2 {
+		t.Fatalf("bad value: expected = 2, got = %v", got)
+	}
+	var last uint64
+	for _, b := range s.batches {
+		for _, it := range b {
+			if it.Seq <= last {
+				t.Fatalf("seq not increasing: %v after %v", it.Seq, last)
+			}
+			last = it.Seq
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	s := newTestStorage()
+	failures := 2
+	s.setFail(func([]Item[string, int]) bool {
+		failures--
+		return failures >= 0
+	})
+	q := newTestQueue(t, s, Options{FlushInterval: time.Millisecond, MaxAttempts: 5})
+	q.Put("a", 1)
+	q.Put("b", 2)
+	flush(t, q)
+	if got, expected := s.batchSizes(), []int{2}; !slices.Equal(got, expected) {
+		t.Fatalf("bad batches: expected = %v, got = %v", expected, got)
+	}
+}
+
+func TestRetryOneByOne(t *testing.T) {
+	s := newTestStorage()
+	// The bad write fails in the first flush, i.e. twice in the batch and once alone.
+	badFailures := 3
+	s.setFail(func(batch []Item[string, int]) bool {
+		if !slices.ContainsFunc(batch, func(it Item[string, int]) bool { return it.Key == "bad" }) {
+			return false
+		}
+		badFailures--
+		return badFailures >= 0
+	})
+	q := newTestQueue(t, s, Options{FlushInterval: time.Millisecond, MaxAttempts: 2})
+	q.Put("a", 1)
+	q.Put("bad", 2)
+	q.Put("b", 3)
+	flush(t, q)
+
+	// The good writes are flushed despite the bad one, and the bad one is flushed in the next round.
+	if got, expected := s.keys(), []string{"a", "b", "bad"}; !slices.Equal(got, expected) {
+		t.Fatalf("bad keys: expected = %v, got = %v", expected, got)
+	}
+}
+
+func TestDropAfterMaxAttempts(t *testing.T) {
+	s := newTestStorage()
+	s.setFail(func(batch []Item[string, int]) bool {
+		return slices.ContainsFunc(batch, func(it Item[string, int]) bool { return it.Key == "bad" })
+	})
+	q := newTestQueue(t, s, Options{FlushInterval: time.Millisecond, MaxAttempts: 2})
+	q.Put("a", 1)
+	q.Put("bad", 2)
+	q.Put("b", 3)
+
+	// The write which always fails is dropped, so the flush doesn't wait for it forever.
+	flush(t, q)
+	if got, expected := s.keys(), []string{"a", "b"}; !slices.Equal(got, expected) {
+		t.Fatalf("bad keys: expected = %v, got = %v", expected, got)
+	}
+
+	// The newer writes with the same key are not affected.
+	s.setFail(nil)
+	q.Put("bad", 4)
+	flush(t, q)
+	if got, expected := s.keys(), []string{"a", "b", "bad"}; !slices.Equal(got, expected) {
+		t.Fatalf("bad keys: expected = %v, got = %v", expected, got)
+	}
+}
+
+func TestRequeueKeepsNewer(t *testing.T) {
+	s := newTestStorage()
+	block := make(chan struct{})
+	failed := false
+	s.setFail(func(batch []Item[string, int]) bool {
+		if failed {
+			return false
+		}
+		failed = true
+		// Let the newer write with the same key arrive while the older one is being flushed.
+		<-block
+		return true
+	})
+	q := newTestQueue(t, s, Options{FlushInterval: time.Millisecond, MaxAttempts: 1})
+	q.Put("a", 1)
+	time.Sleep(10 * time.Millisecond)
+	q.Put("a", 2)
+	close(block)
+	flush(t, q)
+	if got := s.values["a"]; got != 2 {
+		t.Fatalf("bad value: expected = 2, got = %v", got)
+	}
+}
+
+func TestCloseFlushes(t *testing.T) {
+	s := newTestStorage()
+	q, err := New(slogx.DiscardLogger(), Options{FlushInterval: time.Hour}, s.write)
+	if err != nil {
+		t.Fatalf("create queue: %v", err)
+	}
+	q.Put("a", 1)
+	q.Put("b", 2)
+	q.Close()
+	if got, expected := s.keys(), []string{"a", "b"}; !slices.Equal(got, expected) {
+		t.Fatalf("bad keys: expected = %v, got = %v", expected, got)
+	}
+
+	// After close, the writes are done synchronously.
+	q.Put("c", 3)
+	if got, expected := s.keys(), []string{"a", "b", "c"}; !slices.Equal(got, expected) {
+		t.Fatalf("bad keys: expected = %v, got = %v", expected, got)
+	}
+}
+
+func TestCloseFlushesAfterFailure(t *testing.T) {
+	s := newTestStorage()
+	s.setFail(func(batch []Item[string, int]) bool { return len(batch) > 1 })
+	q, err := New(slogx.DiscardLogger(), Options{FlushInterval: time.Hour, MaxBatch: 2, MaxAttempts: 3}, s.write)
+	if err != nil {
+		t.Fatalf("create queue: %v", err)
+	}
+	for i, key := range []string{"a", "b", "c", "d", "e"} {
+		q.Put(key, i)
+	}
+	// The retries don't sleep on close, so it doesn't take long.
+	q.Close()
+	if got, expected := s.keys(), []string{"a", "b", "c", "d", "e"}; !slices.Equal(got, expected) {
+		t.Fatalf("bad keys: expected = %v, got = %v", expected, got)
+	}
+}
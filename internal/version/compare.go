@@ -0,0 +1,71 @@
+package version
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+)
+
+type parsed struct {
+	nums   []int
+	suffix string
+}
+
+func parse(s string) (parsed, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, suffix, _ := strings.Cut(s, "-")
+	if s == "" {
+		return parsed{}, false
+	}
+	var nums []int
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed{}, false
+		}
+		nums = append(nums, n)
+	}
+	return parsed{nums: nums, suffix: suffix}, true
+}
+
+// IsValid reports whether the version can be compared with Compare.
+func IsValid(v string) bool {
+	_, ok := parse(v)
+	return ok
+}
+
+// Compare compares two versions in "X.Y.Z" format, optionally prefixed with "v" and followed by
+// "-suffix". Versions with suffix are older than the same versions without it, e.g. "1.0-beta" <
+// "1.0". Returns false if any of the versions cannot be parsed.
+func Compare(a, b string) (int, bool) {
+	pa, ok := parse(a)
+	if !ok {
+		return 0, false
+	}
+	pb, ok := parse(b)
+	if !ok {
+		return 0, false
+	}
+	for i := range max(len(pa.nums), len(pb.nums)) {
+		var x, y int
+		if i < len(pa.nums) {
+			x = pa.nums[i]
+		}
+		if i < len(pb.nums) {
+			y = pb.nums[i]
+		}
+		if c := cmp.Compare(x, y); c != 0 {
+			return c, true
+		}
+	}
+	switch {
+	case pa.suffix == pb.suffix:
+		return 0, true
+	case pa.suffix == "":
+		return 1, true
+	case pb.suffix == "":
+		return -1, true
+	default:
+		return strings.Compare(pa.suffix, pb.suffix), true
+	}
+}
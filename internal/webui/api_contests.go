@@ -0,0 +1,353 @@
+package webui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type contestJSON struct {
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind"`
+	OwnerID    string                 `json:"owner_id,omitempty"`
+	GroupID    string                 `json:"group_id,omitempty"`
+	Visibility string                 `json:"visibility"`
+	Status     string                 `json:"status"`
+	Reason     string                 `json:"reason,omitempty"`
+	Players    []string               `json:"players"`
+	Summary    *contestResultsSummary `json:"summary,omitempty"`
+}
+
+func buildContestJSON(info *scheduler.ContestInfo, data *scheduler.ContestData) contestJSON {
+	c := contestJSON{
+		ID:         info.ID,
+		Name:       info.Name,
+		Kind:       strings.ToLower(info.Kind.PrettyString()),
+		OwnerID:    info.OwnerID,
+		Visibility: info.Visibility.String(),
+		Status:     data.Status.Kind.String(),
+		Reason:     data.Status.Reason,
+		Players:    make([]string, 0, len(info.Players)),
+	}
+	if info.GroupID != nil {
+		c.GroupID = *info.GroupID
+	}
+	for _, p := range info.Players {
+		c.Players = append(c.Players, p.Name)
+	}
+	if info.Kind == scheduler.ContestMatch && data.Match != nil {
+		summary := buildContestResultsSummary(info, data)
+		c.Summary = &summary
+	}
+	return c
+}
+
+func writeAPIResponse(log *slog.Logger, w http.ResponseWriter, code int, resp any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Info("could not write response", slogx.Err(err))
+	}
+}
+
+// requireAPIUser returns the owner of the API token. Modifying requests must always use API tokens,
+// as the API is not protected from CSRF.
+func requireAPIUser(log *slog.Logger, cfg *Config, req *http.Request) (*userauth.User, error) {
+	user, err := requestAPIUser(req.Context(), log, cfg, req)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, httputil.MakeAuthError("api token required", "Bearer")
+	}
+	return user, nil
+}
+
+// parseAPIForm reads the JSON object from the request body and stores it into the request form, so
+// the same parsing code can be used for the web UI forms and the API. Field names are the same as
+// in the web UI form.
+func parseAPIForm(req *http.Request) error {
+	var fields map[string]any
+	dec := json.NewDecoder(req.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return httputil.MakeError(
+				http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("request too large, at most %v bytes allowed", maxErr.Limit),
+			)
+		}
+		return httputil.MakeError(http.StatusBadRequest, "bad json: "+err.Error())
+	}
+	form := make(url.Values, len(fields))
+	for k, v := range fields {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			form.Set(k, v)
+		case json.Number, bool:
+			form.Set(k, fmt.Sprint(v))
+		default:
+			return httputil.MakeError(http.StatusBadRequest, fmt.Sprintf("field %q must be scalar", k))
+		}
+	}
+	req.Form = form
+	req.PostForm = form
+	// Files cannot be uploaded via API, pass their contents in text fields instead.
+	req.MultipartForm = &multipart.Form{}
+	return nil
+}
+
+const (
+	apiContestsDefaultLimit = 100
+	apiContestsMaxLimit     = 1000
+)
+
+// parseAPIContestFilter builds the contest filter from the query of the contest list API request.
+func parseAPIContestFilter(v url.Values, viewer scheduler.Viewer) (scheduler.ContestFilter, error) {
+	f := scheduler.ContestFilter{
+		Name:   v.Get("name"),
+		Limit:  apiContestsDefaultLimit,
+		Viewer: viewer,
+	}
+	if v.Get("mine") == "true" {
+		if viewer.UserID == "" {
+			return scheduler.ContestFilter{}, httputil.MakeAuthError("api token required", "Bearer")
+		}
+		f.OwnerID = viewer.UserID
+	}
+	for _, s := range v["status"] {
+		for _, status := range strings.Split(s, ",") {
+			idx := slices.IndexFunc(contestStatusOptions, func(k scheduler.ContestStatusKind) bool {
+				return k.String() == status
+			})
+			if idx < 0 {
+				return scheduler.ContestFilter{}, httputil.MakeError(http.StatusBadRequest, fmt.Sprintf("bad status %q", status))
+			}
+			f.Statuses = append(f.Statuses, contestStatusOptions[idx])
+		}
+	}
+	for _, t := range []struct {
+		key string
+		dst *time.Time
+	}{
+		{"created-since", &f.CreatedSince},
+		{"created-before", &f.CreatedBefore},
+		{"finished-since", &f.FinishedSince},
+		{"finished-before", &f.FinishedBefore},
+	} {
+		if s := v.Get(t.key); s != "" {
+			var err error
+			*t.dst, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				return scheduler.ContestFilter{}, httputil.MakeError(http.StatusBadRequest, fmt.Sprintf("bad %v: %v", t.key, err))
+			}
+		}
+	}
+	switch v.Get("sort") {
+	case "", "created":
+		f.Sort = scheduler.ContestSortCreated
+	case "finished":
+		f.Sort = scheduler.ContestSortFinished
+	default:
+		return scheduler.ContestFilter{}, httputil.MakeError(http.StatusBadRequest, "bad sort order")
+	}
+	if s := v.Get("offset"); s != "" {
+		offset, err := strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return scheduler.ContestFilter{}, httputil.MakeError(http.StatusBadRequest, "bad offset")
+		}
+		f.Offset = offset
+	}
+	if s := v.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > apiContestsMaxLimit {
+			return scheduler.ContestFilter{}, httputil.MakeError(
+				http.StatusBadRequest,
+				fmt.Sprintf("bad limit, must be between 1 and %v", apiContestsMaxLimit),
+			)
+		}
+		f.Limit = limit
+	}
+	return f, nil
+}
+
+type contestsAPIAttachImpl struct {
+	log *slog.Logger
+	cfg *Config
+}
+
+func (a *contestsAPIAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle contests api request",
+		slog.String("method", req.Method),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	switch req.Method {
+	case http.MethodGet:
+		filter, err := parseAPIContestFilter(req.URL.Query(), requestViewer(ctx, log, a.cfg, req))
+		if err != nil {
+			writeHTTPErr(log, w, err)
+			return
+		}
+		// Request one more contest to find out whether there are more of them.
+		limit := filter.Limit
+		filter.Limit++
+		contests, err := a.cfg.Scheduler.ListContests(ctx, filter)
+		if err != nil {
+			log.Warn("could not list contests", slogx.Err(err))
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+			return
+		}
+		resp := struct {
+			Contests   []contestJSON `json:"contests"`
+			NextOffset *int          `json:"next_offset,omitempty"`
+		}{
+			Contests: []contestJSON{},
+		}
+		if len(contests) > limit {
+			contests = contests[:limit]
+			nextOffset := filter.Offset + limit
+			resp.NextOffset = &nextOffset
+		}
+		for _, c := range contests {
+			resp.Contests = append(resp.Contests, buildContestJSON(&c.Info, &c.Data))
+		}
+		writeAPIResponse(log, w, http.StatusOK, &resp)
+	case http.MethodPost:
+		user, err := requireAPIUser(log, a.cfg, req)
+		if err != nil {
+			writeHTTPErr(log, w, err)
+			return
+		}
+		if err := parseAPIForm(req); err != nil {
+			writeHTTPErr(log, w, err)
+			return
+		}
+		log.Info("creating contest via api", slog.String("user", user.Username))
+		info, errs := createContestFromForm(ctx, builderCtx{
+			Log:      log,
+			Config:   a.cfg,
+			FullUser: user,
+			Req:      req,
+		})
+		if len(errs) != 0 {
+			writeAPIResponse(log, w, http.StatusBadRequest, &struct {
+				Errors []string `json:"errors"`
+			}{Errors: errs})
+			return
+		}
+		data := info.NewData()
+		resp := buildContestJSON(&info, &data)
+		writeAPIResponse(log, w, http.StatusCreated, &resp)
+	default:
+		log.Warn("method not allowed")
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+	}
+}
+
+func contestsAPIAttach(log *slog.Logger, cfg *Config) http.Handler {
+	return &contestsAPIAttachImpl{
+		log: log,
+		cfg: cfg,
+	}
+}
+
+type contestAPIAttachImpl struct {
+	log *slog.Logger
+	cfg *Config
+}
+
+func (a *contestAPIAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	action := req.PathValue("action")
+	log.Info("handle contest api request",
+		slog.String("method", req.Method),
+		slog.String("action", action),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	contestID := req.PathValue("contestID")
+	getContest := func(viewer scheduler.Viewer) (scheduler.ContestInfo, scheduler.ContestData, bool) {
+		info, data, err := a.cfg.Scheduler.GetContest(ctx, contestID)
+		if err != nil {
+			if errors.Is(err, scheduler.ErrNoSuchContest) {
+				writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+				return info, data, false
+			}
+			log.Warn("could not get contest", slogx.Err(err))
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+			return info, data, false
+		}
+		if !viewer.CanView(&info) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+			return info, data, false
+		}
+		return info, data, true
+	}
+
+	switch {
+	case action == "" && req.Method == http.MethodGet:
+		info, data, ok := getContest(requestViewer(ctx, log, a.cfg, req))
+		if !ok {
+			return
+		}
+		resp := buildContestJSON(&info, &data)
+		writeAPIResponse(log, w, http.StatusOK, &resp)
+	case action == "abort" && req.Method == http.MethodPost:
+		user, err := requireAPIUser(log, a.cfg, req)
+		if err != nil {
+			writeHTTPErr(log, w, err)
+			return
+		}
+		info, data, ok := getContest(buildViewer(user))
+		if !ok {
+			return
+		}
+		if !canManageContest(user, &info) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusForbidden, "operation not permitted"))
+			return
+		}
+		if data.Status.Kind.IsFinished() {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusConflict, "contest already finished"))
+			return
+		}
+		a.cfg.Scheduler.AbortContest(info.ID, "canceled by user "+user.Username)
+		info, data, ok = getContest(buildViewer(user))
+		if !ok {
+			return
+		}
+		resp := buildContestJSON(&info, &data)
+		writeAPIResponse(log, w, http.StatusOK, &resp)
+	case action == "" || action == "abort":
+		log.Warn("method not allowed")
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+	default:
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "unknown action"))
+	}
+}
+
+func contestAPIAttach(log *slog.Logger, cfg *Config) http.Handler {
+	return &contestAPIAttachImpl{
+		log: log,
+		cfg: cfg,
+	}
+}
@@ -0,0 +1,111 @@
+package webui
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/alex65536/day20/internal/delta"
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+// roomStateJSON is the live state of the room for external tools, such as stream overlays. If the
+// cursor is passed in the request, State contains only the changes since this cursor, in the same
+// format as delta.RoomState.ApplyDelta expects.
+type roomStateJSON struct {
+	ID        string           `json:"id"`
+	Name      string           `json:"name"`
+	ContestID string           `json:"contest_id,omitempty"`
+	Cursor    delta.RoomCursor `json:"cursor"`
+	State     *delta.RoomState `json:"state"`
+}
+
+type roomAPIAttachImpl struct {
+	log *slog.Logger
+	cfg *Config
+}
+
+func (a *roomAPIAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle room state api request",
+		slog.String("method", req.Method),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	if req.Method != http.MethodGet {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+	var cursor delta.RoomCursor
+	rawCursor := req.URL.Query().Get("cursor")
+	if rawCursor != "" {
+		if err := json.Unmarshal([]byte(rawCursor), &cursor); err != nil {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusBadRequest, "bad cursor"))
+			return
+		}
+	}
+
+	roomID := req.PathValue("roomID")
+	info, err := a.cfg.Keeper.RoomInfo(roomID)
+	if err != nil {
+		if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "room not found"))
+			return
+		}
+		log.Warn("could not get room info", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	state, newCursor, err := a.cfg.Keeper.RoomStateDelta(roomID, cursor)
+	if err != nil {
+		if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "room not found"))
+			return
+		}
+		if rawCursor != "" {
+			// The cursor may be stale, for example after the server restart. The client must
+			// request the full state again.
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusConflict, "cursor is not applicable, request full state"))
+			return
+		}
+		log.Warn("could not get room state", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+
+	resp := roomStateJSON{
+		ID:     info.ID,
+		Name:   info.Name,
+		Cursor: newCursor,
+		State:  state,
+	}
+	if job, ok := a.cfg.Scheduler.GetRunningJob(newCursor.JobID); ok {
+		contestInfo, _, err := a.cfg.Scheduler.GetContest(ctx, job.ContestID)
+		switch {
+		case errors.Is(err, scheduler.ErrNoSuchContest):
+		case err != nil:
+			log.Warn("could not get contest", slogx.Err(err))
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+			return
+		case !requestViewer(ctx, log, a.cfg, req).CanView(&contestInfo):
+			// Hide the room along with the contest, as its state reveals the game.
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "room not found"))
+			return
+		default:
+			resp.ContestID = contestInfo.ID
+		}
+	}
+	writeAPIResponse(log, w, http.StatusOK, &resp)
+}
+
+func roomAPIAttach(log *slog.Logger, cfg *Config) http.Handler {
+	return &roomAPIAttachImpl{
+		log: log,
+		cfg: cfg,
+	}
+}
@@ -0,0 +1,285 @@
+package webui
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+type compressWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+	Flush() error
+}
+
+type compressEncoder struct {
+	name string
+	pool sync.Pool
+}
+
+func newCompressEncoder(name string, newWriter func() compressWriter) *compressEncoder {
+	return &compressEncoder{
+		name: name,
+		pool: sync.Pool{New: func() any { return newWriter() }},
+	}
+}
+
+func (e *compressEncoder) get(w io.Writer) compressWriter {
+	cw := e.pool.Get().(compressWriter)
+	cw.Reset(w)
+	return cw
+}
+
+func (e *compressEncoder) put(cw compressWriter) {
+	cw.Reset(io.Discard)
+	e.pool.Put(cw)
+}
+
+// compressEncoders lists the supported content encodings. New encodings can be added here, as long
+// as their writers can be reset and flushed.
+var compressEncoders = map[string]func() *compressEncoder{
+	"br": func() *compressEncoder {
+		return newCompressEncoder("br", func() compressWriter {
+			// The default level is too slow to compress the pages on the fly.
+			return brotli.NewWriterLevel(io.Discard, 4)
+		})
+	},
+	"zstd": func() *compressEncoder {
+		return newCompressEncoder("zstd", func() compressWriter {
+			// Browsers limit the window size, so the large windows are not used.
+			w, err := zstd.NewWriter(io.Discard,
+				zstd.WithEncoderLevel(zstd.SpeedDefault),
+				zstd.WithEncoderConcurrency(1),
+				zstd.WithWindowSize(1<<20),
+			)
+			if err != nil {
+				panic(fmt.Sprintf("create zstd writer: %v", err))
+			}
+			return w
+		})
+	},
+	"gzip": func() *compressEncoder {
+		return newCompressEncoder("gzip", func() compressWriter {
+			return gzip.NewWriter(io.Discard)
+		})
+	},
+	"deflate": func() *compressEncoder {
+		return newCompressEncoder("deflate", func() compressWriter {
+			w, err := flate.NewWriter(io.Discard, flate.DefaultCompression)
+			if err != nil {
+				panic(fmt.Sprintf("create flate writer: %v", err))
+			}
+			return w
+		})
+	},
+}
+
+// negotiateEncoding picks the encoding from supported (which is ordered by server preference)
+// that has the highest quality value in the Accept-Encoding header.
+func negotiateEncoding(header string, supported []*compressEncoder) *compressEncoder {
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(param, "=")
+			if !ok || strings.TrimSpace(k) != "q" {
+				continue
+			}
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = f
+			}
+		}
+		quality[name] = q
+	}
+	var (
+		best  *compressEncoder
+		bestQ float64
+	)
+	for _, enc := range supported {
+		q, ok := quality[enc.name]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+func isCompressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/json", "application/xml", "image/svg+xml",
+		"application/x-chess-pgn", "application/vnd.chess-pgn":
+		return true
+	default:
+		return false
+	}
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	enc     *compressEncoder
+	minSize int
+	status  int
+	buf     []byte
+	decided bool
+	cw      compressWriter
+}
+
+func (w *compressResponseWriter) shouldCompress() bool {
+	h := w.Header()
+	switch w.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	return w.status >= 200 &&
+		h.Get("Content-Encoding") == "" &&
+		h.Get("Content-Range") == "" &&
+		isCompressibleType(h.Get("Content-Type"))
+}
+
+func (w *compressResponseWriter) decide(large bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) != 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if large && w.shouldCompress() {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.enc.name)
+		w.cw = w.enc.get(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.cw != nil {
+		_, err = w.cw.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = status
+}
+
+func (w *compressResponseWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.cw != nil {
+			return w.cw.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < w.minSize {
+		return len(p), nil
+	}
+	if err := w.decide(true); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush is used for streaming, so the response is compressed regardless of its size.
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if w.cw != nil {
+		_ = w.cw.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack not supported")
+	}
+	return h.Hijack()
+}
+
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressResponseWriter) finish() error {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			return nil
+		}
+		if err := w.decide(false); err != nil {
+			return err
+		}
+	}
+	if w.cw != nil {
+		err := w.cw.Close()
+		w.enc.put(w.cw)
+		w.cw = nil
+		return err
+	}
+	return nil
+}
+
+type compressHandler struct {
+	h        http.Handler
+	encoders []*compressEncoder
+	minSize  int
+}
+
+func (c *compressHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Upgrade") != "" {
+		c.h.ServeHTTP(w, req)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	enc := negotiateEncoding(req.Header.Get("Accept-Encoding"), c.encoders)
+	if enc == nil {
+		c.h.ServeHTTP(w, req)
+		return
+	}
+	cw := &compressResponseWriter{
+		ResponseWriter: w,
+		enc:            enc,
+		minSize:        c.minSize,
+	}
+	c.h.ServeHTTP(cw, req)
+	_ = cw.finish()
+}
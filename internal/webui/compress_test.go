@@ -0,0 +1,216 @@
+package webui
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func testEncoders(t *testing.T, names ...string) []*compressEncoder {
+	t.Helper()
+	res := make([]*compressEncoder, len(names))
+	for i, name := range names {
+		newEncoder, ok := compressEncoders[name]
+		if !ok {
+			t.Fatalf("unknown encoder %q", name)
+		}
+		res[i] = newEncoder()
+	}
+	return res
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	encoders := testEncoders(t, "zstd", "br", "gzip", "deflate")
+	for _, tc := range []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"GZIP", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=0.5, gzip;q=0.5", "br"},
+		{"gzip;q=0", ""},
+		{"gzip;q=0, deflate", "deflate"},
+		{"*", "zstd"},
+		{"*;q=0.1, gzip;q=0.5", "gzip"},
+		{"*, zstd;q=0", "br"},
+		{"gzip ; q=0.8 , deflate ; q=0.9", "deflate"},
+		{"gzip;q=bad", "gzip"},
+		{"compress", ""},
+	} {
+		enc := negotiateEncoding(tc.header, encoders)
+		got := ""
+		if enc != nil {
+			got = enc.name
+		}
+		if got != tc.expected {
+			t.Fatalf("bad encoding for %q: expected = %q, got = %q", tc.header, tc.expected, got)
+		}
+	}
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var (
+		r   io.Reader
+		err error
+	)
+	switch encoding {
+	case "":
+		return string(body)
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(body))
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		var d *zstd.Decoder
+		d, err = zstd.NewReader(bytes.NewReader(body))
+		if err == nil {
+			defer d.Close()
+			r = d
+		}
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+	if err != nil {
+		t.Fatalf("create reader: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decode %v: %v", encoding, err)
+	}
+	return string(data)
+}
+
+func serveCompressed(h http.Handler, acceptEncoding string, header http.Header) *httptest.ResponseRecorder {
+	c := &compressHandler{h: h, minSize: 1024}
+	for _, name := range []string{"zstd", "br", "gzip", "deflate"} {
+		c.encoders = append(c.encoders, compressEncoders[name]())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompressHandler(t *testing.T) {
+	large := strings.Repeat("<p>Hello, world!</p>\n", 200)
+	small := "<p>Hello, world!</p>\n"
+	textHandler := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = io.WriteString(w, body)
+		})
+	}
+
+	for _, tc := range []struct {
+		name           string
+		handler        http.Handler
+		acceptEncoding string
+		header         http.Header
+		body           string
+		encoding       string
+	}{
+		{"zstd", textHandler(large), "gzip, br, zstd", nil, large, "zstd"},
+		{"br", textHandler(large), "gzip, br", nil, large, "br"},
+		{"gzip", textHandler(large), "gzip", nil, large, "gzip"},
+		{"deflate", textHandler(large), "deflate", nil, large, "deflate"},
+		{"no accept encoding", textHandler(large), "", nil, large, ""},
+		{"small", textHandler(small), "gzip", nil, small, ""},
+		{
+			name: "already compressed",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Header().Set("Content-Encoding", "gzip")
+				_, _ = io.WriteString(w, large)
+			}),
+			acceptEncoding: "gzip",
+			body:           large,
+			encoding:       "gzip",
+		},
+		{
+			name: "incompressible type",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = io.WriteString(w, large)
+			}),
+			acceptEncoding: "gzip",
+			body:           large,
+		},
+		{
+			name: "not modified",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(http.StatusNotModified)
+			}),
+			acceptEncoding: "gzip",
+		},
+		{
+			name:           "upgrade",
+			handler:        textHandler(large),
+			acceptEncoding: "gzip",
+			header:         http.Header{"Upgrade": {"websocket"}},
+			body:           large,
+		},
+	} {
+		w := serveCompressed(tc.handler, tc.acceptEncoding, tc.header)
+		if got := w.Header().Get("Content-Encoding"); got != tc.encoding {
+			t.Fatalf("%v: bad encoding: expected = %q, got = %q", tc.name, tc.encoding, got)
+		}
+		if tc.header.Get("Upgrade") == "" {
+			if got := w.Header().Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+				t.Fatalf("%v: bad vary: expected = [Accept-Encoding], got = %v", tc.name, got)
+			}
+		}
+		body := w.Body.Bytes()
+		if tc.name != "already compressed" {
+			if got := decodeBody(t, tc.encoding, body); got != tc.body {
+				t.Fatalf("%v: bad body: expected %v bytes, got %v bytes", tc.name, len(tc.body), len(got))
+			}
+		} else if string(body) != tc.body {
+			t.Fatalf("%v: body must be passed as is", tc.name)
+		}
+	}
+}
+
+func TestCompressHandlerFlush(t *testing.T) {
+	// The streams are flushed before reaching the minimum size, and must be compressed anyway.
+	h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for range 3 {
+			_, _ = io.WriteString(w, "data: hello\n\n")
+			w.(http.Flusher).Flush()
+		}
+	})
+	for _, encoding := range []string{"zstd", "br", "gzip", "deflate"} {
+		w := serveCompressed(h, encoding, nil)
+		if got := w.Header().Get("Content-Encoding"); got != encoding {
+			t.Fatalf("bad encoding: expected = %q, got = %q", encoding, got)
+		}
+		expected := strings.Repeat("data: hello\n\n", 3)
+		if got := decodeBody(t, encoding, w.Body.Bytes()); got != expected {
+			t.Fatalf("bad body for %v: expected = %q, got = %q", encoding, expected, got)
+		}
+	}
+}
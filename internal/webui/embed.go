@@ -16,8 +16,13 @@ var ourStaticData embed.FS
 //go:embed template
 var templates embed.FS
 
+//go:embed locale
+var localeFiles embed.FS
+
 var staticData fs.FS
 
+var localeData fs.FS
+
 func init() {
 	contrib, err := fs.Sub(contribStaticData, "static_contrib")
 	if err != nil {
@@ -28,4 +33,8 @@ func init() {
 		panic(err)
 	}
 	staticData = mergefs.New(contrib, our)
+	localeData, err = fs.Sub(localeFiles, "locale")
+	if err != nil {
+		panic(err)
+	}
 }
@@ -1,15 +1,20 @@
 package webui
 
 import (
-	"compress/gzip"
 	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"slices"
+	"strings"
 	"time"
 
-	"github.com/NYTimes/gziphandler"
+	"github.com/alex65536/day20/internal/broadcast"
+	"github.com/alex65536/day20/internal/discuss"
+	"github.com/alex65536/day20/internal/extauth"
+	"github.com/alex65536/day20/internal/notify"
+	"github.com/alex65536/day20/internal/opening"
+	"github.com/alex65536/day20/internal/rater"
 	"github.com/alex65536/day20/internal/roomkeeper"
 	"github.com/alex65536/day20/internal/scheduler"
 	"github.com/alex65536/day20/internal/userauth"
@@ -23,14 +28,30 @@ type SessionStoreFactory interface {
 	NewSessionStore(ctx context.Context, opts SessionOptions) sessions.Store
 }
 
+// BookEvalConfig allows filtering the opening books by engine evaluation on contest creation.
+type BookEvalConfig struct {
+	Evaluator opening.Evaluator
+	Jobs      int
+}
+
 type Config struct {
 	Keeper              *roomkeeper.Keeper
 	UserManager         *userauth.Manager
 	SessionStoreFactory SessionStoreFactory
 	Scheduler           *scheduler.Scheduler
+	Rater               *rater.Rater
+	Notifier            *notify.Notifier
+	Broadcaster         *broadcast.Watcher
+	Discussion          *discuss.Board
+	LoginThrottler      *userauth.LoginThrottler
+	ExternalAuth        []*extauth.Provider
+	AuditLog            *slog.Logger
+	BookEval            *BookEvalConfig // Optional.
 	sessionStore        sessions.Store
 	prefix              string
 	opts                *Options
+	staticHasher        *staticHasher
+	locales             *locales
 }
 
 type SessionOptions struct {
@@ -62,29 +83,47 @@ func (o SessionOptions) Clone() SessionOptions {
 }
 
 type Options struct {
-	WebSocket         websockutil.Options `toml:"websocket"`
-	ReadCursorTimeout time.Duration       `toml:"read-cursor-timeout"`
-	RoomRPSLimit      float64             `toml:"room-rps-limit"`
-	RoomRPSBurst      int                 `toml:"room-rps-burst"`
-	ServerID          string              `toml:"server-id"`
-	Session           SessionOptions      `toml:"session"`
-	CSRFKey           []byte              `toml:"-"`
-	Compression       string              `toml:"compression"`
+	WebSocket          websockutil.Options    `toml:"websocket"`
+	ReadCursorTimeout  time.Duration          `toml:"read-cursor-timeout"`
+	RoomRPSLimit       float64                `toml:"room-rps-limit"`
+	RoomRPSBurst       int                    `toml:"room-rps-burst"`
+	ServerID           string                 `toml:"server-id"`
+	Session            SessionOptions         `toml:"session"`
+	CSRFKey            []byte                 `toml:"-"`
+	Compression        string                 `toml:"compression"`
+	CompressionMinSize int                    `toml:"compression-min-size"`
+	ImpersonationTTL   time.Duration          `toml:"impersonation-ttl"`
+	RateLimit          RateLimitOptions       `toml:"rate-limit"`
+	SecurityHeaders    SecurityHeadersOptions `toml:"security-headers"`
+	// MaxUploadSize limits the size of POST request bodies on pages, including uploaded files.
+	MaxUploadSize int64 `toml:"max-upload-size"`
+	// TrustedProxies is deprecated, the top-level option of the server is used instead. It is kept
+	// so the older options files still load.
+	TrustedProxies []string `toml:"trusted-proxies"`
 }
 
+// makeCompressor creates compression middleware. Compression is either "none" or a comma-separated
+// list of content encodings in order of preference.
 func (o *Options) makeCompressor() (func(http.Handler) http.Handler, error) {
-	switch o.Compression {
-	case "none":
+	if o.Compression == "none" {
 		return func(h http.Handler) http.Handler { return h }, nil
-	case "gzip":
-		h, err := gziphandler.NewGzipLevelHandler(gzip.DefaultCompression)
-		if err != nil {
-			return nil, fmt.Errorf("create gzip handler: %w", err)
+	}
+	var encoders []*compressEncoder
+	for _, name := range strings.Split(o.Compression, ",") {
+		name = strings.TrimSpace(name)
+		newEncoder, ok := compressEncoders[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown compression %q", name)
 		}
-		return h, nil
-	default:
-		return nil, fmt.Errorf("unknown compression %q", o.Compression)
+		encoders = append(encoders, newEncoder())
 	}
+	return func(h http.Handler) http.Handler {
+		return &compressHandler{
+			h:        h,
+			encoders: encoders,
+			minSize:  o.CompressionMinSize,
+		}
+	}, nil
 }
 
 func (o *Options) FillDefaults() {
@@ -100,13 +139,25 @@ func (o *Options) FillDefaults() {
 	}
 	o.Session.FillDefaults()
 	if o.Compression == "" {
-		o.Compression = "gzip"
+		o.Compression = "zstd,br,gzip,deflate"
+	}
+	if o.CompressionMinSize == 0 {
+		o.CompressionMinSize = 1024
+	}
+	if o.ImpersonationTTL == 0 {
+		o.ImpersonationTTL = 1 * time.Hour
+	}
+	o.RateLimit.FillDefaults()
+	o.SecurityHeaders.FillDefaults()
+	if o.MaxUploadSize == 0 {
+		o.MaxUploadSize = 32 << 20
 	}
 }
 
 func (o Options) Clone() Options {
 	o.Session = o.Session.Clone()
 	o.CSRFKey = slices.Clone(o.CSRFKey)
+	o.TrustedProxies = slices.Clone(o.TrustedProxies)
 	return o
 }
 
@@ -117,7 +168,9 @@ func must[T any](t T, err error) T {
 	return t
 }
 
-func Handle(ctx context.Context, log *slog.Logger, mux *http.ServeMux, prefix string, cfg Config, o Options) {
+// Handle registers the web UI handlers in mux. The returned rate limiter can be used to change the
+// rate limits without restarting the server.
+func Handle(ctx context.Context, log *slog.Logger, mux *http.ServeMux, prefix string, cfg Config, o Options) *RateLimiter {
 	o = o.Clone()
 	o.FillDefaults()
 	if len(o.Session.Key) == 0 {
@@ -130,15 +183,29 @@ func Handle(ctx context.Context, log *slog.Logger, mux *http.ServeMux, prefix st
 		panic("bad csrf key")
 	}
 
-	cfg.sessionStore = cfg.SessionStoreFactory.NewSessionStore(ctx, o.Session)
+	if cfg.AuditLog == nil {
+		cfg.AuditLog = log
+	}
+
+	cfg.sessionStore = &secureAwareStore{
+		Store:    cfg.SessionStoreFactory.NewSessionStore(ctx, o.Session),
+		insecure: o.Session.Insecure,
+	}
 	cfg.prefix = prefix
 	cfg.opts = &o
+	cfg.staticHasher = newStaticHasher(staticData)
+	cfg.locales = must(loadLocales(localeData))
 	b := middlewareBuilder{
 		Log:         log,
 		Prefix:      prefix,
 		CSRFProtect: csrf.Protect(o.CSRFKey),
 		Compress:    must(o.makeCompressor()),
+		Security:    &o.SecurityHeaders,
+		Static:      cfg.staticHasher,
+		MaxUpload:   o.MaxUploadSize,
 	}
+	b.Limiter = newIPRateLimiter(ctx, o.RateLimit.RPS, o.RateLimit.Burst, o.RateLimit.IdleTTL, o.RateLimit.Disable)
+	b.AuthLimiter = newIPRateLimiter(ctx, o.RateLimit.AuthRPS, o.RateLimit.AuthBurst, o.RateLimit.IdleTTL, o.RateLimit.Disable)
 	templ := must(newTemplator(&cfg))
 
 	// Static.
@@ -153,22 +220,65 @@ func Handle(ctx context.Context, log *slog.Logger, mux *http.ServeMux, prefix st
 	// Pages, attaches & websockets.
 	mux.Handle(prefix+"/{$}", b.WrapPage(must(mainPage(log, &cfg, templ))))
 	mux.Handle(prefix+"/room/{roomID}", b.WrapPage(must(roomPage(log, &cfg, templ))))
-	mux.Handle(prefix+"/room/{roomID}/ws", b.WrapWebSocket(must(roomWebSocket(log, &cfg, templ))))
+	mux.Handle(prefix+"/room/{roomID}/ws", b.WrapWebSocket(must(roomWebSocket(log, &cfg, templ, false))))
+	mux.Handle(prefix+"/room/{roomID}/events", b.WrapEvents(must(roomSSE(log, &cfg, templ, false))))
+	mux.Handle(prefix+"/room/{roomID}/overlay", b.WrapPage(must(roomOverlayPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/room/{roomID}/overlay/ws", b.WrapWebSocket(must(roomWebSocket(log, &cfg, templ, true))))
+	mux.Handle(prefix+"/room/{roomID}/overlay/events", b.WrapEvents(must(roomSSE(log, &cfg, templ, true))))
+	mux.Handle(prefix+"/embed/room/{roomID}", b.WrapEmbed(must(embedRoomPage(log, &cfg, templ))))
 	mux.Handle(prefix+"/room/{roomID}/pgn", b.WrapAttach(roomPGNAttach(log, &cfg)))
-	mux.Handle(prefix+"/invite/{inviteVal}", b.WrapPage(must(invitePage(log, &cfg, templ))))
-	mux.Handle(prefix+"/login", b.WrapPage(must(loginPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/room/{roomID}/last/pgn", b.WrapAttach(roomLastPGNAttach(log, &cfg)))
+	mux.Handle(prefix+"/invite/{inviteVal}", b.WrapAuthPage(must(invitePage(log, &cfg, templ))))
+	mux.Handle(prefix+"/login", b.WrapAuthPage(must(loginPage(log, &cfg, templ))))
 	mux.Handle(prefix+"/logout", b.WrapPage(must(logoutPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/verify-email/{token}", b.WrapPage(must(verifyEmailPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/reset-password", b.WrapAuthPage(must(resetPasswordPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/reset-password/{token}", b.WrapAuthPage(must(resetPasswordTokenPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/theme", b.WrapPage(must(themePage(log, &cfg, templ))))
 	mux.Handle(prefix+"/profile", b.WrapPage(must(profilePage(log, &cfg, templ))))
 	mux.Handle(prefix+"/user/{username}", b.WrapPage(must(userPage(log, &cfg, templ))))
 	mux.Handle(prefix+"/invites", b.WrapPage(must(invitesPage(log, &cfg, templ))))
 	mux.Handle(prefix+"/users", b.WrapPage(must(usersPage(log, &cfg, templ))))
 	mux.Handle(prefix+"/contests", b.WrapPage(must(contestsPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/contests/compare", b.WrapPage(must(contestsComparePage(log, &cfg, templ))))
 	mux.Handle(prefix+"/contests/new", b.WrapPage(must(contestsNewPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/events", b.WrapPage(must(eventsPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/event/{eventID}", b.WrapPage(must(eventPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/event/{eventID}/pgn", b.WrapAttach(eventPGNAttach(log, &cfg)))
+	mux.Handle(prefix+"/books", b.WrapPage(must(booksPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/presets", b.WrapPage(must(presetsPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/book/{bookID}/data", b.WrapAttach(bookDataAttach(log, &cfg)))
 	mux.Handle(prefix+"/contest/{contestID}", b.WrapPage(must(contestPage(log, &cfg, templ))))
 	mux.Handle(prefix+"/contest/{contestID}/pgn", b.WrapAttach(contestPGNAttach(log, &cfg)))
+	mux.Handle(prefix+"/contest/{contestID}/sgs", b.WrapAttach(contestSGSAttach(log, &cfg)))
+	mux.Handle(prefix+"/contest/{contestID}/results.csv", b.WrapAttach(contestResultsAttach(log, &cfg, contestResultsCSV)))
+	mux.Handle(prefix+"/contest/{contestID}/results.json", b.WrapAttach(contestResultsAttach(log, &cfg, contestResultsJSON)))
+	mux.Handle(prefix+"/contest/{contestID}/summary.csv", b.WrapAttach(contestResultsAttach(log, &cfg, contestResultsSummaryCSV)))
+	mux.Handle(prefix+"/contest/{contestID}/openings", b.WrapPage(must(contestOpeningsPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/contest/{contestID}/edit", b.WrapPage(must(contestEditPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/contest/{contestID}/game/{index}", b.WrapPage(must(gamePage(log, &cfg, templ))))
+	mux.Handle(prefix+"/job/{jobID}", b.WrapPage(must(jobPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/jobs/failed", b.WrapPage(must(failedJobsPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/contest/{contestID}/job/{jobID}/pgn", b.WrapAttach(contestJobPGNAttach(log, &cfg)))
+	mux.Handle(prefix+"/games", b.WrapPage(must(gamesPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/api/games", b.WrapAttach(gamesAPIAttach(log, &cfg)))
+	mux.Handle(prefix+"/api/contests", b.WrapAPI(contestsAPIAttach(log, &cfg)))
+	mux.Handle(prefix+"/api/contest/{contestID}", b.WrapAPI(contestAPIAttach(log, &cfg)))
+	mux.Handle(prefix+"/api/contest/{contestID}/{action}", b.WrapAPI(contestAPIAttach(log, &cfg)))
+	mux.Handle(prefix+"/api/room/{roomID}/state", b.WrapAPI(roomAPIAttach(log, &cfg)))
+	mux.Handle(prefix+"/ratings", b.WrapPage(must(ratingsPage(log, &cfg, templ))))
 	mux.Handle(prefix+"/roomtokens", b.WrapPage(must(roomtokensPage(log, &cfg, templ))))
 	mux.Handle(prefix+"/roomtokens/new", b.WrapPage(must(roomtokensNewPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/apitokens", b.WrapPage(must(apitokensPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/apitokens/new", b.WrapPage(must(apitokensNewPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/sessions", b.WrapPage(must(sessionsPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/impersonate/stop", b.WrapPage(must(stopImpersonationPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/oauth/{provider}/login", b.WrapPage(must(oauthLoginPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/oauth/{provider}/callback", b.WrapPage(must(oauthCallbackPage(log, &cfg, templ))))
+	mux.Handle(prefix+"/oauth/register", b.WrapAuthPage(must(oauthRegisterPage(log, &cfg, templ))))
 
 	// 404.
 	mux.Handle(prefix+"/", b.WrapPage(must(e404Page(log, &cfg, templ))))
+
+	return &RateLimiter{limiter: b.Limiter, authLimiter: b.AuthLimiter}
 }
@@ -0,0 +1,151 @@
+package webui
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// defaultLang is the language in which the templates are written. It doesn't need a catalog.
+const defaultLang = "en"
+
+// msgCatalog maps the messages as they are written in the templates to their translations.
+type msgCatalog struct {
+	Name     string            `toml:"name"`
+	Messages map[string]string `toml:"messages"`
+}
+
+// Translate returns the translation of msg. If args are given, the translation is used as a format
+// string. Messages without translation are returned as is.
+func (c *msgCatalog) Translate(msg string, args ...any) string {
+	if c != nil {
+		if t, ok := c.Messages[msg]; ok && t != "" {
+			msg = t
+		}
+	}
+	if len(args) != 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+type langItem struct {
+	Code string
+	Name string
+}
+
+// locales holds the message catalogs for all the supported languages.
+type locales struct {
+	catalogs map[string]*msgCatalog
+	langs    []langItem
+}
+
+// loadLocales reads the catalogs from "<lang>.toml" files in fsys.
+func loadLocales(fsys fs.FS) (*locales, error) {
+	l := &locales{
+		catalogs: map[string]*msgCatalog{defaultLang: nil},
+		langs:    []langItem{{Code: defaultLang, Name: "English"}},
+	}
+	names, err := fs.Glob(fsys, "*.toml")
+	if err != nil {
+		return nil, fmt.Errorf("glob: %w", err)
+	}
+	for _, name := range names {
+		lang := strings.TrimSuffix(name, ".toml")
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("read %q: %w", name, err)
+		}
+		var c msgCatalog
+		if err := toml.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("parse %q: %w", name, err)
+		}
+		if c.Name == "" {
+			c.Name = lang
+		}
+		l.catalogs[lang] = &c
+		l.langs = append(l.langs, langItem{Code: lang, Name: c.Name})
+	}
+	return l, nil
+}
+
+func (l *locales) Langs() []langItem {
+	return l.langs
+}
+
+func (l *locales) Has(lang string) bool {
+	_, ok := l.catalogs[lang]
+	return ok
+}
+
+// Match picks the language for the request. The language chosen by the user takes precedence over
+// the Accept-Language header.
+func (l *locales) Match(req *http.Request, user *userInfo) string {
+	if user != nil && l.Has(user.Lang) {
+		return user.Lang
+	}
+	for _, lang := range parseAcceptLanguage(req.Header.Get("Accept-Language")) {
+		if l.Has(lang) {
+			return lang
+		}
+		// Fall back from regional variants, like "en-US", to the base language.
+		if base, _, ok := strings.Cut(lang, "-"); ok && l.Has(base) {
+			return base
+		}
+	}
+	return defaultLang
+}
+
+// parseAcceptLanguage returns the language tags from Accept-Language header, ordered by
+// preference. The tags are lowercased.
+func parseAcceptLanguage(h string) []string {
+	type item struct {
+		lang string
+		q    float64
+	}
+	var items []item
+	for _, part := range strings.Split(h, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		items = append(items, item{lang: lang, q: q})
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].q > items[j].q })
+	langs := make([]string, 0, len(items))
+	for _, it := range items {
+		if !slices.Contains(langs, it.lang) {
+			langs = append(langs, it.lang)
+		}
+	}
+	return langs
+}
+
+// sessionLang returns the language for requests which don't track the session fully, like room
+// streams.
+func sessionLang(cfg *Config, req *http.Request) string {
+	var user *userInfo
+	session, _ := cfg.sessionStore.Get(req, sessionName)
+	if u, ok := session.Values["user"].(userInfo); ok {
+		user = &u
+	}
+	return cfg.locales.Match(req, user)
+}
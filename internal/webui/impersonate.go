@@ -0,0 +1,124 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/gorilla/sessions"
+)
+
+func canImpersonate(actor *userauth.User, actorInfo *userInfo, target *userauth.User) error {
+	if actorInfo.Impersonator != nil {
+		return errors.New("already impersonating")
+	}
+	if !actor.Perms.IsOwner {
+		return errors.New("only owners can impersonate")
+	}
+	if actor.ID == target.ID {
+		return errors.New("cannot impersonate yourself")
+	}
+	if target.Perms.IsOwner || target.Perms.Get(userauth.PermAdmin) {
+		return errors.New("cannot impersonate admins")
+	}
+	if target.Perms.IsBlocked {
+		return errors.New("cannot impersonate blocked users")
+	}
+	return nil
+}
+
+func (bc *builderCtx) IsImpersonating() bool {
+	return bc.UserInfo != nil && bc.UserInfo.Impersonator != nil
+}
+
+// Impersonate makes the current session act on behalf of target. The caller must check
+// canImpersonate first.
+func (bc *builderCtx) Impersonate(target *userauth.User) {
+	actor := *bc.UserInfo
+	info := makeUserInfo(target)
+	info.SessionID = actor.SessionID
+	info.Impersonator = &actor
+	info.ImpersonationExpiry = time.Now().Add(bc.Config.opts.ImpersonationTTL)
+	bc.Config.AuditLog.Warn("impersonation started",
+		slog.String("username", actor.Username),
+		slog.String("target", target.Username),
+		slog.String("ip", remoteIP(bc.Req)),
+	)
+	bc.saveSessionValue("user", info)
+	bc.UserInfo = info
+	bc.FullUser = target
+}
+
+func stopImpersonation(
+	log *slog.Logger,
+	cfg *Config,
+	req *http.Request,
+	w http.ResponseWriter,
+	session *sessions.Session,
+	info *userInfo,
+	reason string,
+) *userInfo {
+	actor := *info.Impersonator
+	actor.SessionID = info.SessionID
+	cfg.AuditLog.Warn("impersonation stopped",
+		slog.String("username", actor.Username),
+		slog.String("target", info.Username),
+		slog.String("reason", reason),
+		slog.String("ip", remoteIP(req)),
+	)
+	session.Values["user"] = actor
+	if err := session.Save(req, w); err != nil {
+		log.Error("could not save session", slogx.Err(err))
+	}
+	return &actor
+}
+
+// checkImpersonation stops the impersonation once it expires and writes all the modifying requests
+// made on behalf of another user into the audit log.
+func checkImpersonation(
+	log *slog.Logger,
+	cfg *Config,
+	req *http.Request,
+	w http.ResponseWriter,
+	session *sessions.Session,
+	info *userInfo,
+) *userInfo {
+	if time.Now().After(info.ImpersonationExpiry) {
+		return stopImpersonation(log, cfg, req, w, session, info, "expired")
+	}
+	if req.Method != http.MethodGet {
+		cfg.AuditLog.Info("impersonated request",
+			slog.String("username", info.Impersonator.Username),
+			slog.String("target", info.Username),
+			slog.String("method", req.Method),
+			slog.String("uri", req.RequestURI),
+			slog.String("ip", remoteIP(req)),
+		)
+	}
+	return info
+}
+
+type stopImpersonationDataBuilder struct{}
+
+func (stopImpersonationDataBuilder) Build(_ context.Context, bc builderCtx) (any, error) {
+	// The request changes the session, so it must be POST to be protected from CSRF.
+	if bc.Req.Method != http.MethodPost {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	if !bc.IsImpersonating() {
+		return nil, bc.Redirect("/")
+	}
+	session, _ := bc.Config.sessionStore.Get(bc.Req, sessionName)
+	target := bc.UserInfo.Username
+	stopImpersonation(bc.Log, bc.Config, bc.Req, bc.writer, session, bc.UserInfo, "stopped by user")
+	return nil, bc.Redirect("/user/" + target)
+}
+
+func stopImpersonationPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{}, templ, stopImpersonationDataBuilder{}, "")
+}
@@ -1,8 +1,11 @@
 package webui
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/alex65536/day20/internal/util/httputil"
 )
@@ -12,12 +15,40 @@ type middlewareBuilder struct {
 	Prefix      string
 	CSRFProtect func(http.Handler) http.Handler
 	Compress    func(http.Handler) http.Handler
+	Limiter     *ipRateLimiter
+	AuthLimiter *ipRateLimiter
+	Security    *SecurityHeadersOptions
+	Static      *staticHasher
+	MaxUpload   int64
 }
 
 type middleware struct {
 	b    *middlewareBuilder
 	h    http.Handler
 	kind string
+	auth bool
+}
+
+func (m *middleware) checkRateLimit(w http.ResponseWriter, req *http.Request) bool {
+	limiter := m.b.Limiter
+	if m.auth && req.Method == http.MethodPost {
+		limiter = m.b.AuthLimiter
+	}
+	if limiter == nil {
+		return true
+	}
+	ip := remoteIP(req)
+	ok, retry := limiter.Allow(ip)
+	if ok {
+		return true
+	}
+	tagLogWithReq(m.b.Log, req).Info("rate limit exceeded",
+		slog.String("client_ip", ip),
+		slog.String("kind", m.kind),
+	)
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(retry.Seconds()), 10))
+	writeHTTPErr(m.b.Log, w, httputil.MakeError(http.StatusTooManyRequests, "too many requests"))
+	return false
 }
 
 func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -26,8 +57,9 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		slog.String("rid", httputil.ExtractReqID(req.Context())),
 		slog.String("kind", m.kind),
 	)
+	m.b.Security.apply(w, req, m.kind == "embed")
 	switch m.kind {
-	case "page":
+	case "page", "embed":
 		if len(w.Header().Values("Cache-Control")) == 0 {
 			w.Header().Set("Cache-Control", "max-age=0, private, must-revalidate")
 		}
@@ -35,36 +67,81 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		if len(w.Header().Values("Cache-Control")) == 0 {
 			w.Header().Set("Cache-Control", "max-age=0, private, must-revalidate")
 		}
+	case "api":
+		w.Header().Set("Cache-Control", "no-store")
 	case "websocket":
+	case "events":
+		w.Header().Set("Cache-Control", "no-cache")
 	case "static":
-		w.Header().Set("Cache-Control", "max-age=86400, public")
+		path := strings.TrimPrefix(req.URL.Path, m.b.Prefix)
+		if m.b.Static.IsFingerprinted(path, req.URL.Query().Get("v")) {
+			w.Header().Set("Cache-Control", "max-age=31536000, public, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=86400, public")
+		}
 	default:
 		panic("must not happen")
 	}
+	if m.kind != "static" && !m.checkRateLimit(w, req) {
+		return
+	}
+	if (m.kind == "page" || m.kind == "api") && req.Method == http.MethodPost {
+		// Check the body size here, as CSRF protection reads the form before the page handler.
+		if req.ContentLength > m.b.MaxUpload {
+			writeHTTPErr(m.b.Log, w, httputil.MakeError(
+				http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("request too large, at most %v bytes allowed", m.b.MaxUpload),
+			))
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, m.b.MaxUpload)
+	}
 	m.h.ServeHTTP(w, req)
 }
 
-func (b *middlewareBuilder) wrap(h http.Handler, kind string) http.Handler {
+func (b *middlewareBuilder) wrap(h http.Handler, kind string, auth bool) http.Handler {
 	if kind == "page" {
 		h = b.CSRFProtect(h)
 	}
-	h = &middleware{b: b, h: h, kind: kind}
+	h = &middleware{b: b, h: h, kind: kind, auth: auth}
 	h = b.Compress(h)
 	return h
 }
 
 func (b *middlewareBuilder) WrapPage(h http.Handler) http.Handler {
-	return b.wrap(h, "page")
+	return b.wrap(h, "page", false)
+}
+
+// WrapAuthPage is the same as WrapPage, but applies stricter rate limits to POST requests. It must
+// be used for pages which accept credentials.
+func (b *middlewareBuilder) WrapAuthPage(h http.Handler) http.Handler {
+	return b.wrap(h, "page", true)
+}
+
+// WrapEmbed wraps the widgets which are allowed to be embedded into frames on other sites. They
+// are not protected from CSRF, so they must not modify anything.
+func (b *middlewareBuilder) WrapEmbed(h http.Handler) http.Handler {
+	return b.wrap(h, "embed", false)
 }
 
 func (b *middlewareBuilder) WrapAttach(h http.Handler) http.Handler {
-	return b.wrap(h, "attach")
+	return b.wrap(h, "attach", false)
+}
+
+// WrapAPI wraps the JSON API handlers. Unlike pages, they are not protected from CSRF, so they must
+// authenticate the modifying requests via API tokens only.
+func (b *middlewareBuilder) WrapAPI(h http.Handler) http.Handler {
+	return b.wrap(h, "api", false)
 }
 
 func (b *middlewareBuilder) WrapStatic(h http.Handler) http.Handler {
-	return b.wrap(h, "static")
+	return b.wrap(h, "static", false)
+}
+
+func (b *middlewareBuilder) WrapEvents(h http.Handler) http.Handler {
+	return b.wrap(h, "events", false)
 }
 
 func (b *middlewareBuilder) WrapWebSocket(h http.Handler) http.Handler {
-	return b.wrap(h, "websocket")
+	return b.wrap(h, "websocket", false)
 }
@@ -9,20 +9,41 @@ import (
 	"html/template"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/alex65536/day20/internal/userauth"
 	"github.com/alex65536/day20/internal/util/clone"
 	"github.com/alex65536/day20/internal/util/httputil"
 	"github.com/alex65536/day20/internal/util/slogx"
 	"github.com/alex65536/go-chess/util/maybe"
+	"github.com/gorilla/csrf"
 )
 
 const sessionName = "day20_session"
 
 type userInfo struct {
-	ID       string
-	Username string
-	Epoch    int
+	ID        string
+	Username  string
+	Epoch     int
+	SessionID string
+	// Lang is the language chosen by the user. Empty means that the language is picked from the
+	// request headers.
+	Lang string
+	// Theme is the color theme chosen by the user. Empty means that the theme is taken from the
+	// cookie.
+	Theme string
+
+	// Impersonator is set if an owner is currently acting on behalf of this user.
+	Impersonator        *userInfo
+	ImpersonationExpiry time.Time
+}
+
+// sessionOwnerID returns the ID of the user to whom the session record belongs.
+func (u *userInfo) sessionOwnerID() string {
+	if u.Impersonator != nil {
+		return u.Impersonator.ID
+	}
+	return u.ID
 }
 
 func makeUserInfo(user *userauth.User) *userInfo {
@@ -33,6 +54,8 @@ func makeUserInfo(user *userauth.User) *userInfo {
 		ID:       user.ID,
 		Username: user.Username,
 		Epoch:    user.Epoch,
+		Lang:     user.Prefs.Language,
+		Theme:    user.Prefs.Theme,
 	}
 }
 
@@ -53,15 +76,18 @@ type page struct {
 	pageOpts pageOptions
 	log      *slog.Logger
 	b        dataBuilder
-	tmpl     *template.Template
-	errTmpl  *template.Template
+	tmpl     localizedTemplate
+	errTmpl  localizedTemplate
 }
 
 type pageData struct {
-	Data     any
-	User     *userInfo
-	WithNav  bool
-	WithAuth bool
+	Data      any
+	User      *userInfo
+	Lang      string
+	Theme     string
+	CSRFField template.HTML
+	WithNav   bool
+	WithAuth  bool
 }
 
 type builderCtx struct {
@@ -70,6 +96,7 @@ type builderCtx struct {
 	UserInfo *userInfo
 	FullUser *userauth.User
 	Req      *http.Request
+	Lang     string
 	writer   http.ResponseWriter
 }
 
@@ -90,6 +117,11 @@ func (bc *builderCtx) UpgradeSession(newUser *userInfo) {
 	session, _ := bc.Config.sessionStore.Get(bc.Req, sessionName)
 	delete(session.Values, "user")
 	if newUser != nil {
+		if bc.UserInfo != nil {
+			newUser.SessionID = bc.UserInfo.SessionID
+			newUser.Impersonator = bc.UserInfo.Impersonator
+			newUser.ImpersonationExpiry = bc.UserInfo.ImpersonationExpiry
+		}
 		session.Values["user"] = &newUser
 	}
 	if err := session.Save(bc.Req, bc.writer); err != nil {
@@ -118,7 +150,7 @@ func (bc *builderCtx) ResetSession(newUser *userInfo) {
 	bc.FullUser = nil
 }
 
-func (p *page) renderHTMXError(log *slog.Logger, w http.ResponseWriter, httpErr *httputil.Error) {
+func (p *page) renderHTMXError(log *slog.Logger, lang string, w http.ResponseWriter, httpErr *httputil.Error) {
 	if 300 <= httpErr.Code() && httpErr.Code() <= 399 {
 		log.Info("send htmx redirect", slog.String("msg", httpErr.Message()))
 		w.Header().Add("HX-Redirect", httpErr.RedirLocation())
@@ -131,7 +163,7 @@ func (p *page) renderHTMXError(log *slog.Logger, w http.ResponseWriter, httpErr
 		slog.String("msg", httpErr.Message()),
 	)
 	var b bytes.Buffer
-	if err := p.errTmpl.ExecuteTemplate(&b, "part/errors", errorsPartData{
+	if err := p.errTmpl.For(lang).ExecuteTemplate(&b, "part/errors", errorsPartData{
 		Errors: []string{httpErr.Message()},
 	}); err != nil {
 		log.Error("error rendering page", slogx.Err(err))
@@ -147,7 +179,7 @@ func (p *page) renderHTMXError(log *slog.Logger, w http.ResponseWriter, httpErr
 	}
 }
 
-func (p *page) renderError(log *slog.Logger, req *http.Request, w http.ResponseWriter, httpErr *httputil.Error) {
+func (p *page) renderError(log *slog.Logger, lang string, req *http.Request, w http.ResponseWriter, httpErr *httputil.Error) {
 	if 300 <= httpErr.Code() && httpErr.Code() <= 399 {
 		log.Info("send http redirect",
 			slog.Int("code", httpErr.Code()),
@@ -163,7 +195,9 @@ func (p *page) renderError(log *slog.Logger, req *http.Request, w http.ResponseW
 		slog.String("msg", httpErr.Message()),
 	)
 	var b bytes.Buffer
-	if err := p.errTmpl.Execute(&b, pageData{
+	if err := p.errTmpl.For(lang).Execute(&b, pageData{
+		Lang:  lang,
+		Theme: requestTheme(req, nil),
 		Data: struct {
 			Code    int
 			CodeMsg string
@@ -202,6 +236,7 @@ func (p *page) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	var userInf *userInfo
+	resetSession := false
 	if !p.pageOpts.NoUserInfo {
 		session, _ := p.cfg.sessionStore.Get(req, sessionName)
 		userInfoAny := session.Values["user"]
@@ -209,6 +244,13 @@ func (p *page) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			rawUserInfo := userInfoAny.(userInfo)
 			userInf = &rawUserInfo
 		}
+		if userInf != nil && !trackSession(ctx, log, p.cfg, req, w, session, userInf) {
+			userInf = nil
+			resetSession = true
+		}
+		if userInf != nil && userInf.Impersonator != nil {
+			userInf = checkImpersonation(log, p.cfg, req, w, session, userInf)
+		}
 		if session.IsNew {
 			if err := session.Save(req, w); err != nil {
 				log.Error("could not save session", slogx.Err(err))
@@ -217,7 +259,6 @@ func (p *page) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	var fullUser *userauth.User
-	resetSession := false
 	if p.pageOpts.FullUser && userInf != nil {
 		var opts []userauth.GetUserOptions
 		if o, ok := p.pageOpts.GetUserOptions.TryGet(); ok {
@@ -245,6 +286,7 @@ func (p *page) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		UserInfo: userInf,
 		FullUser: fullUser,
 		Req:      req,
+		Lang:     p.cfg.locales.Match(req, userInf),
 		writer:   w,
 	}
 	if resetSession {
@@ -255,9 +297,9 @@ func (p *page) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if err != nil {
 		if httpErr := (*httputil.Error)(nil); errors.As(err, &httpErr) {
 			if bc.IsHTMX() {
-				p.renderHTMXError(log, w, httpErr)
+				p.renderHTMXError(log, bc.Lang, w, httpErr)
 			} else {
-				p.renderError(log, req, w, httpErr)
+				p.renderError(log, bc.Lang, req, w, httpErr)
 			}
 			return
 		}
@@ -268,14 +310,20 @@ func (p *page) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	var b bytes.Buffer
 	if fr, ok := data.(interface{ Fragment() string }); ok {
-		err = p.tmpl.ExecuteTemplate(&b, fr.Fragment(), data)
+		err = p.tmpl.For(bc.Lang).ExecuteTemplate(&b, fr.Fragment(), data)
 	} else {
-		err = p.tmpl.Execute(&b, pageData{
+		pd := pageData{
 			Data:     data,
 			User:     bc.UserInfo,
+			Lang:     bc.Lang,
+			Theme:    requestTheme(req, bc.UserInfo),
 			WithNav:  !p.pageOpts.NoNav,
 			WithAuth: !p.pageOpts.NoNav && !p.pageOpts.NoUserInfo,
-		})
+		}
+		if pd.WithNav || bc.IsImpersonating() {
+			pd.CSRFField = csrf.TemplateField(req)
+		}
+		err = p.tmpl.For(bc.Lang).Execute(&b, pd)
 	}
 	if err != nil {
 		log.Error("error rendering page", slogx.Err(err))
@@ -323,4 +371,6 @@ func newPage(
 
 func init() {
 	gob.Register(userInfo{})
+	gob.Register(oauthState{})
+	gob.Register(oauthPending{})
 }
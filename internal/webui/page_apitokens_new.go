@@ -0,0 +1,57 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type apitokensNewDataBuilder struct{}
+
+func (apitokensNewDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	type data struct {
+		Token string
+	}
+
+	bc.SetCacheControl("no-store")
+
+	if bc.FullUser == nil {
+		return nil, httputil.MakeError(http.StatusForbidden, "not logged in")
+	}
+	if !bc.FullUser.Perms.Get(userauth.PermRunContests) {
+		return nil, httputil.MakeError(http.StatusForbidden, "api tokens not allowed")
+	}
+
+	switch req.Method {
+	case http.MethodPost:
+		err := req.ParseForm()
+		if err != nil {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
+		}
+		label := req.FormValue("token-label")
+		if label == "" {
+			return nil, httputil.MakeError(http.StatusBadRequest, "no label")
+		}
+		tok, err := cfg.UserManager.GenerateAPIToken(ctx, label, bc.FullUser)
+		if err != nil {
+			log.Warn("could not generate api token", slogx.Err(err))
+			return nil, fmt.Errorf("generate api token: %w", err)
+		}
+		return &data{Token: tok}, nil
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func apitokensNewPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, apitokensNewDataBuilder{}, "apitokens_new")
+}
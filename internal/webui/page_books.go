@@ -0,0 +1,164 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/gorilla/csrf"
+)
+
+type booksDataBuilder struct{}
+
+func (booksDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	type item struct {
+		ID          string
+		Name        string
+		Description string
+		Kind        scheduler.OpeningBookKind
+		Positions   int
+		CreatedAt   *humanTimePartData
+	}
+
+	type data struct {
+		CSRFField     template.HTML
+		CanAddBooks   bool
+		NameMaxLen    int
+		MaxUploadSize int64
+		Books         []item
+	}
+
+	canAddBooks := bc.FullUser != nil && bc.FullUser.Perms.Get(userauth.PermRunContests)
+
+	switch req.Method {
+	case http.MethodGet:
+		books, err := cfg.Scheduler.ListStoredBooks(ctx)
+		if err != nil {
+			log.Warn("could not list books", slogx.Err(err))
+			return nil, fmt.Errorf("list books: %w", err)
+		}
+		now := time.Now()
+		return &data{
+			CSRFField:     csrf.TemplateField(req),
+			CanAddBooks:   canAddBooks,
+			NameMaxLen:    scheduler.StoredBookNameMaxLen,
+			MaxUploadSize: cfg.opts.MaxUploadSize,
+			Books: sliceutil.Map(books, func(b scheduler.StoredBook) item {
+				return item{
+					ID:          b.ID,
+					Name:        b.Name,
+					Description: b.Description,
+					Kind:        b.Kind,
+					Positions:   b.Positions,
+					CreatedAt:   buildHumanTimePartData(now, b.CreatedAt.UTC()),
+				}
+			}),
+		}, nil
+	case http.MethodPost:
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		if !canAddBooks {
+			return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+		}
+		err := parseUploadForm(req)
+		if err != nil {
+			return nil, err
+		}
+		data, ok, err := readUploadedText(req, "file")
+		if err != nil {
+			return &errorsPartData{Errors: []string{"bad book file: " + err.Error()}}, nil
+		}
+		if !ok {
+			data = req.FormValue("data")
+		}
+		book, err := cfg.Scheduler.CreateStoredBook(
+			ctx,
+			bc.FullUser.ID,
+			req.FormValue("name"),
+			req.FormValue("description"),
+			scheduler.StoredBookFormat(req.FormValue("format")),
+			data,
+		)
+		if err != nil {
+			return &errorsPartData{Errors: []string{err.Error()}}, nil
+		}
+		log.Info("created stored book",
+			slog.String("book_id", book.ID),
+			slog.Int("positions", book.Positions),
+		)
+		return nil, bc.Redirect("/books")
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func booksPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, booksDataBuilder{}, "books")
+}
+
+type bookDataAttachImpl struct {
+	log *slog.Logger
+	cfg *Config
+}
+
+func (a *bookDataAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle book data request",
+		slog.String("method", req.Method),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	if req.Method != http.MethodGet {
+		log.Warn("method not allowed")
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	book, err := a.cfg.Scheduler.GetStoredBook(ctx, req.PathValue("bookID"))
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchBook) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "book not found"))
+			return
+		}
+		log.Warn("could not get book", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+
+	ext := "txt"
+	switch book.Kind {
+	case scheduler.OpeningsFEN:
+		ext = "fen"
+	case scheduler.OpeningsPGNLine:
+		ext = "pgn"
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"book_%v.%v\"", book.ID, ext))
+	if _, err := io.WriteString(w, book.Data); err != nil {
+		log.Info("could not write response", slogx.Err(err))
+		return
+	}
+}
+
+func bookDataAttach(log *slog.Logger, cfg *Config) http.Handler {
+	return &bookDataAttachImpl{
+		log: log,
+		cfg: cfg,
+	}
+}
@@ -9,17 +9,26 @@ import (
 	"log/slog"
 	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/broadcast"
+	"github.com/alex65536/day20/internal/roomkeeper"
 	"github.com/alex65536/day20/internal/scheduler"
 	"github.com/alex65536/day20/internal/stat"
 	"github.com/alex65536/day20/internal/userauth"
 	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
 	"github.com/alex65536/day20/internal/util/slogx"
 	"github.com/alex65536/go-chess/clock"
 	"github.com/gorilla/csrf"
 )
 
+const contestJobsPageSize = 50
+
 type contestDataBuilder struct{}
 
 func (contestDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
@@ -27,24 +36,68 @@ func (contestDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 	req := bc.Req
 	log := bc.Log
 
+	type jobItem struct {
+		ID          string
+		Index       int64
+		White       string
+		Black       string
+		Status      roomkeeper.JobStatus
+		Result      string
+		Termination string
+		HasPGN      bool
+		RoomID      string
+		Duration    time.Duration
+		WhiteEngine string
+		BlackEngine string
+	}
+
+	type broadcastData struct {
+		RoundID  string
+		RoundURL string
+		HasToken bool
+	}
+
 	type builtData struct {
 		ID   string
 		Name string
 
-		CanCancel bool
-		CSRFField template.HTML
+		CanCancel     bool
+		CanEdit       bool
+		CanDuplicate  bool
+		CanPrioritize bool
+		QueuePos      int
+		QueueLen      int
+		CSRFField     template.HTML
+		Notify        *notifyTargetsPartData
+		Broadcast     *broadcastData
+		Comments      *commentsPartData
 
 		Kind           scheduler.ContestKind
+		Visibility     scheduler.ContestVisibility
+		Owner          string
+		EventID        string
+		EventName      string
+		Group          *contestGroupPartData
 		First          string
 		Second         string
+		Swiss          *swissPartData
+		Knockout       *knockoutPartData
 		Status         scheduler.ContestStatus
+		ArchivedAt     *humanTimePartData
+		PGNPruned      bool
 		Progress       *progressPartData
 		Played         int64
 		Total          int64
+		Wins           int64
+		FailedJobs     int64
+		Retries        *retriesPartData
+		IllegalMoves   int64
 		FixedTime      *time.Duration
 		TimeControl    *clock.Control
 		ScoreThreshold int32
+		MoveOverhead   *time.Duration
 		OpeningBook    scheduler.OpeningBook
+		BookName       string
 
 		FirstWin         int64
 		Draw             int64
@@ -54,6 +107,19 @@ func (contestDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 		Winner           stat.Winner
 		WinnerConfidence string
 		EloDiff          stat.EloDiff
+		NEloDiff         stat.EloDiff
+		BayesElo         float64
+		DrawElo          float64
+		DavidsonElo      float64
+		DavidsonNu       float64
+		HasPentanomial   bool
+		Pentanomial      stat.Pentanomial
+		PentaEloDiff     stat.EloDiff
+		PentaNEloDiff    stat.EloDiff
+
+		Jobs    []jobItem
+		PrevURL string
+		NextURL string
 	}
 
 	info, data, err := cfg.Scheduler.GetContest(ctx, req.PathValue("contestID"))
@@ -61,37 +127,185 @@ func (contestDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 		log.Info("could not get contest", slogx.Err(err))
 		return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
 	}
-	canCancel := bc.FullUser != nil && bc.FullUser.Perms.Get(userauth.PermRunContests)
+	if !bc.Viewer().CanView(&info) {
+		return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
+	}
+	canCancel := canManageContest(bc.FullUser, &info)
+	canPrioritize := canPrioritizeContests(bc.FullUser) && !data.Status.Kind.IsFinished()
 
 	switch req.Method {
 	case http.MethodGet:
-		if info.Kind != scheduler.ContestMatch {
+		var (
+			ms            stat.Status
+			penta         stat.Pentanomial
+			hasPenta      bool
+			first, second string
+			swiss         *swissPartData
+			knockout      *knockoutPartData
+
+			played, total, wins int64
+		)
+		switch info.Kind {
+		case scheduler.ContestMatch:
+			ms = data.Match.Status()
+			penta, hasPenta = data.Match.Pentanomial()
+			first, second = info.Players[0].Name, info.Players[1].Name
+			played, total, wins = data.Match.Played(), info.Match.Games, info.Match.Wins
+		case scheduler.ContestSwiss:
+			swiss = buildSwissPartData(&info, &data)
+			played, total = info.Progress(&data)
+		case scheduler.ContestKnockout:
+			knockout = buildKnockoutPartData(&info, &data)
+			played = data.LastIndex
+		default:
 			panic("unknown contest kind")
 		}
-		ms := data.Match.Status()
 		confidence, winner := ms.Winner(0.9, 0.95, 0.97, 0.99)
+		var archivedAt *humanTimePartData
+		if data.ArchivedAt != nil {
+			archivedAt = buildHumanTimePartData(time.Now(), data.ArchivedAt.UTC())
+		}
 		confidenceStr := ""
 		if confidence != 0.0 {
 			confidenceStr = fmt.Sprintf("%02v", math.Round(confidence*100))
 		}
+		bayesElo, drawElo := ms.BayesEloFit()
+		davidsonElo, davidsonNu := ms.DavidsonFit()
+		page := 1
+		if s := req.URL.Query().Get("page"); s != "" {
+			page, err = strconv.Atoi(s)
+			if err != nil || page <= 0 {
+				return nil, httputil.MakeError(http.StatusBadRequest, "bad page")
+			}
+		}
+		jobs, err := cfg.Scheduler.ListContestFinishedJobs(ctx, info.ID, (page-1)*contestJobsPageSize, contestJobsPageSize+1)
+		if err != nil {
+			log.Warn("could not list contest jobs", slogx.Err(err))
+			return nil, fmt.Errorf("list contest jobs: %w", err)
+		}
+		var prevURL, nextURL string
+		if page > 1 {
+			prevURL = fmt.Sprintf("/contest/%v?page=%v#games", info.ID, page-1)
+		}
+		if len(jobs) > contestJobsPageSize {
+			jobs = jobs[:contestJobsPageSize]
+			nextURL = fmt.Sprintf("/contest/%v?page=%v#games", info.ID, page+1)
+		}
+		var eventID, eventName string
+		if info.EventID != nil {
+			event, err := cfg.Scheduler.GetEvent(ctx, *info.EventID)
+			if err != nil && !errors.Is(err, scheduler.ErrNoSuchEvent) {
+				log.Warn("could not get event", slogx.Err(err))
+				return nil, fmt.Errorf("get event: %w", err)
+			}
+			if err == nil {
+				eventID, eventName = event.ID, event.Name
+			}
+		}
+		var group *contestGroupPartData
+		if info.GroupID != nil {
+			contests, err := cfg.Scheduler.ListGroupContests(ctx, *info.GroupID, bc.Viewer())
+			if err != nil {
+				log.Warn("could not list group contests", slogx.Err(err))
+				return nil, fmt.Errorf("list group contests: %w", err)
+			}
+			group = buildContestGroupPartData(info.ID, contests)
+		}
+		var bookName string
+		if info.OpeningBook.Kind == scheduler.OpeningsStored {
+			book, err := cfg.Scheduler.GetStoredBook(ctx, info.OpeningBook.Data)
+			if err != nil && !errors.Is(err, scheduler.ErrNoSuchBook) {
+				log.Warn("could not get opening book", slogx.Err(err))
+				return nil, fmt.Errorf("get book: %w", err)
+			}
+			if err == nil {
+				bookName = book.Name
+			}
+		}
+		var owner string
+		if info.OwnerID != "" {
+			user, err := cfg.UserManager.GetUser(ctx, info.OwnerID)
+			if err != nil && !errors.Is(err, userauth.ErrUserNotFound) {
+				log.Warn("could not get contest owner", slogx.Err(err))
+				return nil, fmt.Errorf("get owner: %w", err)
+			}
+			if err == nil {
+				owner = user.Username
+			}
+		}
+		var notifyTargets *notifyTargetsPartData
+		if canEditNotifyTargets(bc.FullUser) && !data.Status.Kind.IsFinished() {
+			targets, err := cfg.Notifier.ListContestTargets(ctx, info.ID)
+			if err != nil {
+				log.Warn("could not list notify targets", slogx.Err(err))
+				return nil, fmt.Errorf("list notify targets: %w", err)
+			}
+			notifyTargets = buildNotifyTargetsPartData(bc, "/contest/"+info.ID, targets)
+		}
+		var bcast *broadcastData
+		if canCancel && !data.Status.Kind.IsFinished() {
+			bcast = &broadcastData{}
+			b, err := cfg.Broadcaster.Get(ctx, info.ID)
+			if err == nil {
+				bcast.RoundID = b.RoundID
+				bcast.RoundURL = cfg.Broadcaster.RoundURL(b.RoundID)
+			} else if !errors.Is(err, broadcast.ErrNoBroadcast) {
+				log.Warn("could not get broadcast", slogx.Err(err))
+				return nil, fmt.Errorf("get broadcast: %w", err)
+			}
+			bcast.HasToken, err = cfg.Broadcaster.HasToken(ctx, bc.FullUser.ID)
+			if err != nil {
+				log.Warn("could not check lichess token", slogx.Err(err))
+				return nil, fmt.Errorf("check lichess token: %w", err)
+			}
+		}
+		comments, err := buildCommentsPartData(ctx, bc, "/contest/"+info.ID, info.ID)
+		if err != nil {
+			log.Warn("could not build comments", slogx.Err(err))
+			return nil, fmt.Errorf("build comments: %w", err)
+		}
+		queue := cfg.Scheduler.ContestQueue()
 		return &builtData{
 			ID:   info.ID,
 			Name: info.Name,
 
-			CanCancel: canCancel && !data.Status.Kind.IsFinished(),
-			CSRFField: csrf.TemplateField(req),
+			CanCancel:     canCancel && !data.Status.Kind.IsFinished(),
+			CanEdit:       canCancel && canEditContest(&data),
+			CanDuplicate:  bc.FullUser != nil && bc.FullUser.Perms.Get(userauth.PermRunContests),
+			CanPrioritize: canPrioritize,
+			QueuePos:      slices.Index(queue, info.ID) + 1,
+			QueueLen:      len(queue),
+			CSRFField:     csrf.TemplateField(req),
+			Notify:        notifyTargets,
+			Broadcast:     bcast,
+			Comments:      comments,
 
 			Kind:           info.Kind,
-			First:          info.Players[0].Name,
-			Second:         info.Players[1].Name,
+			Visibility:     info.Visibility,
+			Owner:          owner,
+			EventID:        eventID,
+			EventName:      eventName,
+			Group:          group,
+			First:          first,
+			Second:         second,
+			Swiss:          swiss,
+			Knockout:       knockout,
 			Status:         data.Status,
-			Progress:       buildProgressPartData(data.Match.Played(), info.Match.Games),
-			Played:         data.Match.Played(),
-			Total:          info.Match.Games,
+			ArchivedAt:     archivedAt,
+			PGNPruned:      data.PGNPruned,
+			Progress:       buildProgressPartData(info.Progress(&data)),
+			Played:         played,
+			Total:          total,
+			Wins:           wins,
+			FailedJobs:     data.FailedJobs,
+			Retries:        buildRetriesPartData(&info, &data),
+			IllegalMoves:   data.IllegalMoves,
 			FixedTime:      info.FixedTime,
 			TimeControl:    info.TimeControl,
 			ScoreThreshold: info.ScoreThreshold,
+			MoveOverhead:   info.MoveOverhead,
 			OpeningBook:    info.OpeningBook,
+			BookName:       bookName,
 
 			FirstWin:         data.Match.FirstWin,
 			Draw:             data.Match.Draw,
@@ -101,6 +315,43 @@ func (contestDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 			Winner:           winner,
 			WinnerConfidence: confidenceStr,
 			EloDiff:          ms.EloDiff(0.95),
+			NEloDiff:         ms.NormalizedEloDiff(0.95),
+			BayesElo:         bayesElo,
+			DrawElo:          drawElo,
+			DavidsonElo:      davidsonElo,
+			DavidsonNu:       davidsonNu,
+			HasPentanomial:   hasPenta && penta.Pairs() != 0,
+			Pentanomial:      penta,
+			PentaEloDiff:     penta.EloDiff(0.95),
+			PentaNEloDiff:    penta.NormalizedEloDiff(0.95),
+
+			Jobs: sliceutil.Map(jobs, func(j scheduler.FinishedJob) jobItem {
+				result := ""
+				termination := j.Status.Reason
+				if j.Status.Kind == roomkeeper.JobSucceeded {
+					result = j.GameResult.String()
+					termination = ""
+				}
+				if j.Game != nil {
+					termination = gameVerdictName(j.Game.Verdict)
+				}
+				return jobItem{
+					ID:          j.Job.ID,
+					Index:       j.Index,
+					White:       j.Job.White.Name,
+					Black:       j.Job.Black.Name,
+					Status:      j.Status,
+					Result:      result,
+					Termination: termination,
+					HasPGN:      j.PGN != nil,
+					RoomID:      j.RoomID,
+					Duration:    j.Duration.Round(time.Second),
+					WhiteEngine: j.WhiteEngine,
+					BlackEngine: j.BlackEngine,
+				}
+			}),
+			PrevURL: prevURL,
+			NextURL: nextURL,
 		}, nil
 	case http.MethodPost:
 		if !bc.IsHTMX() {
@@ -117,6 +368,48 @@ func (contestDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 			}
 			cfg.Scheduler.AbortContest(info.ID, "canceled by user "+bc.FullUser.Username)
 			return nil, bc.Redirect("/contest/" + info.ID)
+		case "queue-up", "queue-down":
+			if !canPrioritize {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			up := req.FormValue("action") == "queue-up"
+			if err := cfg.Scheduler.MoveContest(ctx, info.ID, up); err != nil {
+				if errors.Is(err, scheduler.ErrNoSuchContest) {
+					return &errorsPartData{Errors: []string{"contest is not in the queue"}}, nil
+				}
+				log.Warn("could not move contest", slogx.Err(err))
+				return nil, fmt.Errorf("move contest: %w", err)
+			}
+			return nil, bc.Redirect("/contest/" + info.ID)
+		case "notify-add", "notify-delete":
+			return handleNotifyTargetAction(ctx, bc, &info.ID, "/contest/"+info.ID)
+		case "comment-post", "comment-edit", "comment-delete", "comment-hide", "comment-unhide":
+			return handleCommentAction(ctx, bc, info.ID, "/contest/"+info.ID+"#comments")
+		case "broadcast-link":
+			if !canCancel {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			roundID := strings.TrimSpace(req.FormValue("round-id"))
+			if err := broadcast.ValidateRoundID(roundID); err != nil {
+				return &errorsPartData{Errors: []string{err.Error()}}, nil
+			}
+			if err := cfg.Broadcaster.Link(ctx, bc.FullUser.ID, info.ID, roundID); err != nil {
+				if errors.Is(err, broadcast.ErrNoToken) {
+					return &errorsPartData{Errors: []string{"set lichess token in your profile first"}}, nil
+				}
+				log.Warn("could not link broadcast", slogx.Err(err))
+				return nil, fmt.Errorf("link broadcast: %w", err)
+			}
+			return nil, bc.Redirect("/contest/" + info.ID)
+		case "broadcast-unlink":
+			if !canCancel {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			if err := cfg.Broadcaster.Unlink(ctx, info.ID); err != nil {
+				log.Warn("could not unlink broadcast", slogx.Err(err))
+				return nil, fmt.Errorf("unlink broadcast: %w", err)
+			}
+			return nil, bc.Redirect("/contest/" + info.ID)
 		default:
 			return nil, httputil.MakeError(http.StatusBadRequest, "unknown action")
 		}
@@ -125,6 +418,42 @@ func (contestDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 	}
 }
 
+// canManageContest reports whether the user can cancel the contest or change its settings. Only the
+// owner and the admins are allowed to do so.
+func canManageContest(user *userauth.User, info *scheduler.ContestInfo) bool {
+	if user == nil || !user.Perms.Get(userauth.PermRunContests) {
+		return false
+	}
+	return user.Perms.Get(userauth.PermAdmin) || (info.OwnerID != "" && info.OwnerID == user.ID)
+}
+
+// contestResultString returns a short summary of the contest results, suitable for contest lists.
+func contestResultString(info *scheduler.ContestInfo, data *scheduler.ContestData) string {
+	switch info.Kind {
+	case scheduler.ContestMatch:
+		return data.Match.Status().ScoreString()
+	case scheduler.ContestSwiss:
+		standings := data.Swiss.LastStandings()
+		if len(standings) == 0 {
+			return ""
+		}
+		top := standings[0]
+		return fmt.Sprintf("%v: %v", info.Players[top.Player].Name, halfPointsString(top.Score))
+	case scheduler.ContestKnockout:
+		if w := data.Knockout.Winner(); w >= 0 {
+			return info.Players[w].Name
+		}
+		return ""
+	default:
+		return ""
+	}
+}
+
+// canPrioritizeContests reports whether the user can reorder the queue of running contests.
+func canPrioritizeContests(user *userauth.User) bool {
+	return user != nil && (user.Perms.Get(userauth.PermPrioritize) || user.Perms.Get(userauth.PermAdmin))
+}
+
 func contestPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
 	return newPage(log, cfg, pageOptions{FullUser: true}, templ, contestDataBuilder{}, "contest")
 }
@@ -149,6 +478,25 @@ func (a *contestPGNAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Reques
 	}
 
 	contestID := req.PathValue("contestID")
+	info, data, err := a.cfg.Scheduler.GetContest(ctx, contestID)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchContest) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+			return
+		}
+		log.Warn("could not get contest", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	if !requestViewer(ctx, log, a.cfg, req).CanView(&info) {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+		return
+	}
+	if data.PGNPruned {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusGone, "contest games were archived"))
+		return
+	}
+
 	jobs, err := a.cfg.Scheduler.ListContestSucceededJobs(ctx, contestID)
 	if err != nil {
 		if errors.Is(err, scheduler.ErrNoSuchContest) {
@@ -191,3 +539,159 @@ func contestPGNAttach(log *slog.Logger, cfg *Config) http.Handler {
 		cfg: cfg,
 	}
 }
+
+type contestSGSAttachImpl struct {
+	log *slog.Logger
+	cfg *Config
+}
+
+func (a *contestSGSAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle contest sgs request",
+		slog.String("method", req.Method),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	if req.Method != http.MethodGet {
+		log.Warn("method not allowed")
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	contestID := req.PathValue("contestID")
+	info, data, err := a.cfg.Scheduler.GetContest(ctx, contestID)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchContest) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+			return
+		}
+		log.Warn("could not get contest", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	if !requestViewer(ctx, log, a.cfg, req).CanView(&info) {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+		return
+	}
+	if data.PGNPruned {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusGone, "contest games were archived"))
+		return
+	}
+
+	jobs, err := a.cfg.Scheduler.ListContestSucceededJobs(ctx, contestID)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchContest) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+			return
+		}
+		log.Warn("could not list finished jobs", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"contest_%v.sgs\"", contestID))
+	first := true
+	for _, job := range jobs {
+		if job.PGN == nil {
+			log.Error("pgn missing for succeeded job",
+				slog.String("contest_id", contestID),
+				slog.String("job_id", job.Job.ID),
+			)
+			continue
+		}
+		game, err := battle.GameExtFromPGN(*job.PGN)
+		if err != nil {
+			log.Error("could not parse stored pgn",
+				slog.String("contest_id", contestID),
+				slog.String("job_id", job.Job.ID),
+				slogx.Err(err),
+			)
+			continue
+		}
+		if !first {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				log.Info("could not write response", slogx.Err(err))
+				return
+			}
+		}
+		first = false
+		if _, err := io.WriteString(w, game.SGS()); err != nil {
+			log.Info("could not write response", slogx.Err(err))
+			return
+		}
+	}
+}
+
+func contestSGSAttach(log *slog.Logger, cfg *Config) http.Handler {
+	return &contestSGSAttachImpl{
+		log: log,
+		cfg: cfg,
+	}
+}
+
+type contestJobPGNAttachImpl struct {
+	log *slog.Logger
+	cfg *Config
+}
+
+func (a *contestJobPGNAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle contest job pgn request",
+		slog.String("method", req.Method),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	if req.Method != http.MethodGet {
+		log.Warn("method not allowed")
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	contestID := req.PathValue("contestID")
+	jobID := req.PathValue("jobID")
+	info, _, err := a.cfg.Scheduler.GetContest(ctx, contestID)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchContest) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+			return
+		}
+		log.Warn("could not get contest", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	if !requestViewer(ctx, log, a.cfg, req).CanView(&info) {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+		return
+	}
+	job, err := a.cfg.Scheduler.GetContestFinishedJob(ctx, contestID, jobID)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchJob) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "job not found"))
+			return
+		}
+		log.Warn("could not get finished job", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	if job.PGN == nil {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "pgn not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.chess-pgn")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"game_%v.pgn\"", jobID))
+	if _, err := io.WriteString(w, *job.PGN); err != nil {
+		log.Info("could not write response", slogx.Err(err))
+		return
+	}
+}
+
+func contestJobPGNAttach(log *slog.Logger, cfg *Config) http.Handler {
+	return &contestJobPGNAttachImpl{
+		log: log,
+		cfg: cfg,
+	}
+}
@@ -0,0 +1,190 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/gorilla/csrf"
+)
+
+type contestEditDataBuilder struct{}
+
+func (contestEditDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	type bookItem struct {
+		ID        string
+		Name      string
+		Positions int
+	}
+
+	type data struct {
+		CSRFField     template.HTML
+		ID            string
+		Name          string
+		FixedTime     int64
+		TimeControl   string
+		HasFixedTime  bool
+		Games         int64
+		HasWins       bool
+		Wins          int64
+		IsSwiss       bool
+		Rounds        int64
+		IsKnockout    bool
+		GamesPerTie   int64
+		Tiebreak      scheduler.KnockoutTiebreak
+		TiebreakGames int64
+		Tiebreaks     []scheduler.KnockoutTiebreak
+		Books         []bookItem
+		MaxUploadSize int64
+	}
+
+	info, contestData, err := cfg.Scheduler.GetContest(ctx, req.PathValue("contestID"))
+	if err != nil {
+		log.Info("could not get contest", slogx.Err(err))
+		return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
+	}
+	if !bc.Viewer().CanView(&info) {
+		return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
+	}
+	if !canManageContest(bc.FullUser, &info) {
+		return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+	}
+	if !canEditContest(&contestData) {
+		return nil, httputil.MakeError(http.StatusConflict, "contest already started")
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		books, err := cfg.Scheduler.ListStoredBooks(ctx)
+		if err != nil {
+			log.Warn("could not list books", slogx.Err(err))
+			return nil, fmt.Errorf("list books: %w", err)
+		}
+		d := &data{
+			CSRFField:     csrf.TemplateField(req),
+			ID:            info.ID,
+			Name:          info.Name,
+			Games:         defaultContestFormData().Games,
+			Wins:          defaultContestFormData().Wins,
+			MaxUploadSize: cfg.opts.MaxUploadSize,
+			Books: sliceutil.Map(books, func(b scheduler.StoredBook) bookItem {
+				return bookItem{
+					ID:        b.ID,
+					Name:      b.Name,
+					Positions: b.Positions,
+				}
+			}),
+		}
+		if info.FixedTime != nil {
+			d.HasFixedTime = true
+			d.FixedTime = info.FixedTime.Milliseconds()
+		}
+		if info.TimeControl != nil {
+			d.TimeControl = info.TimeControl.String()
+		}
+		switch info.Kind {
+		case scheduler.ContestMatch:
+			if info.Match.IsFirstTo() {
+				d.HasWins = true
+				d.Wins = info.Match.Wins
+			} else {
+				d.Games = info.Match.Games
+			}
+		case scheduler.ContestSwiss:
+			d.IsSwiss = true
+			d.Rounds = info.Swiss.Rounds
+		case scheduler.ContestKnockout:
+			d.IsKnockout = true
+			d.GamesPerTie = info.Knockout.GamesPerTie
+			d.Tiebreak = info.Knockout.Tiebreak
+			d.TiebreakGames = info.Knockout.TiebreakGames
+			for t := range scheduler.KnockoutTiebreakMax {
+				d.Tiebreaks = append(d.Tiebreaks, t)
+			}
+		}
+		return d, nil
+	case http.MethodPost:
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		if err := parseUploadForm(req); err != nil {
+			return nil, err
+		}
+		errs := func() []string {
+			var errs []string
+			settings := info.ContestSettings.Clone()
+
+			settings.Name = req.FormValue("name")
+			if settings.Name == "" {
+				errs = append(errs, "name not specified")
+			} else if utf8.RuneCountInString(settings.Name) > scheduler.ContestNameMaxLen {
+				errs = append(errs, fmt.Sprintf("name exceeds %v runes", scheduler.ContestNameMaxLen))
+			}
+
+			settings.FixedTime = nil
+			settings.TimeControl = nil
+			errs = append(errs, parseContestTimeForm(req, &settings)...)
+
+			if req.FormValue("openings") != "keep" {
+				errs = append(errs, parseContestOpeningsForm(ctx, bc, &settings)...)
+			}
+
+			switch settings.Kind {
+			case scheduler.ContestMatch:
+				errs = append(errs, parseContestLengthForm(req, settings.Match)...)
+			case scheduler.ContestSwiss:
+				errs = append(errs, parseSwissRoundsForm(req, settings.Swiss)...)
+			case scheduler.ContestKnockout:
+				errs = append(errs, parseKnockoutForm(req, settings.Knockout)...)
+			}
+
+			if len(errs) != 0 {
+				return errs
+			}
+
+			if err := settings.Validate(); err != nil {
+				return []string{err.Error()}
+			}
+
+			if _, err := cfg.Scheduler.EditContest(ctx, info.ID, settings); err != nil {
+				if errors.Is(err, scheduler.ErrContestStarted) {
+					return []string{"contest already started"}
+				}
+				if errors.Is(err, scheduler.ErrNoSuchBook) {
+					return []string{"opening book not found"}
+				}
+				log.Warn("failed to edit contest", slogx.Err(err))
+				return []string{"failed to edit contest"}
+			}
+			return nil
+		}()
+		if len(errs) != 0 {
+			return &errorsPartData{Errors: errs}, nil
+		}
+		return nil, bc.Redirect("/contest/" + info.ID)
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// canEditContest reports whether the contest settings can still be changed, i.e. the contest is running
+// and no games have been played yet. The scheduler additionally checks that no games are in progress.
+func canEditContest(data *scheduler.ContestData) bool {
+	return !data.Status.Kind.IsFinished() && data.LastIndex == 0 && data.FailedJobs == 0
+}
+
+func contestEditPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, contestEditDataBuilder{}, "contest_edit")
+}
@@ -0,0 +1,291 @@
+package webui
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alex65536/day20/internal/opening"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/go-chess/chess"
+)
+
+type openingStats struct {
+	Opening   string
+	StartFEN  string
+	ECO       string
+	ECOName   string
+	Games     int64
+	FirstWin  int64
+	Draw      int64
+	SecondWin int64
+	Score     string
+}
+
+func (st *openingStats) add(g *scheduler.Game, first string) {
+	st.Games++
+	switch g.Result {
+	case chess.StatusDraw:
+		st.Draw++
+	case chess.StatusWhiteWins, chess.StatusBlackWins:
+		winner := g.White
+		if g.Result == chess.StatusBlackWins {
+			winner = g.Black
+		}
+		if winner == first {
+			st.FirstWin++
+		} else {
+			st.SecondWin++
+		}
+	}
+}
+
+func (st *openingStats) finish() {
+	if st.Games != 0 {
+		st.Score = fmt.Sprintf("%.1f%%", (float64(st.FirstWin)+0.5*float64(st.Draw))/float64(st.Games)*100)
+	}
+}
+
+type duplicatePosition struct {
+	FEN     string
+	Indices []int64
+}
+
+type openingLine struct {
+	startFEN string
+	moves    []string
+	game     *chess.Game
+}
+
+// buildOpeningLine replays the first plies of the book line. If plies is zero, the entire line is
+// used.
+func buildOpeningLine(g *scheduler.Game, plies int) (*openingLine, error) {
+	startFEN := ""
+	raw := chess.InitialRawBoard()
+	if g.StartFEN != nil {
+		startFEN = *g.StartFEN
+		var err error
+		raw, err = chess.RawBoardFromFEN(startFEN)
+		if err != nil {
+			return nil, fmt.Errorf("bad start fen: %w", err)
+		}
+	}
+	board, err := chess.NewBoard(raw)
+	if err != nil {
+		return nil, fmt.Errorf("bad start position: %w", err)
+	}
+	game := chess.NewGameWithPosition(board)
+	moves := strings.Fields(g.Opening)
+	if plies != 0 && len(moves) > plies {
+		moves = moves[:plies]
+	}
+	for i, m := range moves {
+		if err := game.PushMoveUCI(m); err != nil {
+			return nil, fmt.Errorf("bad move #%v: %w", i+1, err)
+		}
+	}
+	return &openingLine{
+		startFEN: startFEN,
+		moves:    moves,
+		game:     game,
+	}, nil
+}
+
+func (l *openingLine) Key() string {
+	return l.startFEN + "|" + strings.Join(l.moves, " ")
+}
+
+// PositionKey identifies the position after the opening, ignoring move counters.
+func (l *openingLine) PositionKey() string {
+	fields := strings.Fields(l.game.CurBoard().FEN())
+	return strings.Join(fields[:min(4, len(fields))], " ")
+}
+
+func (l *openingLine) SAN() (string, error) {
+	return l.game.Styled(chess.GameStyle{
+		Move:       chess.MoveStyleSAN,
+		MoveNumber: chess.MoveNumberStyle{Enabled: true},
+		Outcome:    chess.GameOutcomeHide,
+	})
+}
+
+type contestOpeningsDataBuilder struct{}
+
+func (contestOpeningsDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	type data struct {
+		ID         string
+		Name       string
+		First      string
+		Second     string
+		Plies      int
+		Games      int64
+		Openings   []openingStats
+		ECOs       []openingStats
+		Duplicates []duplicatePosition
+	}
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	info, _, err := cfg.Scheduler.GetContest(ctx, req.PathValue("contestID"))
+	if err != nil {
+		log.Info("could not get contest", slogx.Err(err))
+		return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
+	}
+	viewer := bc.Viewer()
+	if !viewer.CanView(&info) {
+		return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
+	}
+	plies := 0
+	if s := req.URL.Query().Get("plies"); s != "" {
+		plies, err = strconv.Atoi(s)
+		if err != nil || plies < 0 {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad plies")
+		}
+	}
+
+	games, err := cfg.Scheduler.ListGames(ctx, scheduler.GameFilter{
+		ContestID: info.ID,
+		Viewer:    viewer,
+	})
+	if err != nil {
+		log.Warn("could not list games", slogx.Err(err))
+		return nil, fmt.Errorf("list games: %w", err)
+	}
+	slices.SortFunc(games, func(a, b scheduler.Game) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+
+	first := info.Players[0].Name
+	openings := make(map[string]*openingStats)
+	ecos := make(map[string]*openingStats)
+	lines := make(map[string]*openingLine)
+	positions := make(map[string]*duplicatePosition)
+	var positionOrder []string
+	for i := range games {
+		g := &games[i]
+		line, err := buildOpeningLine(g, plies)
+		if err != nil {
+			log.Warn("could not replay opening", slog.String("job_id", g.JobID), slogx.Err(err))
+			continue
+		}
+		key := line.Key()
+		st, ok := openings[key]
+		if !ok {
+			st = &openingStats{StartFEN: line.startFEN}
+			openings[key] = st
+			lines[key] = line
+		}
+		st.add(g, first)
+
+		// The games are classified by the moves actually played, so the games which left the book
+		// line early get the right code.
+		eco, ok := ecos[g.ECO]
+		if !ok {
+			eco = &openingStats{ECO: g.ECO}
+			if e, found := opening.ECOByCode(g.ECO); found {
+				eco.ECOName = e.Name
+			}
+			ecos[g.ECO] = eco
+		}
+		eco.add(g, first)
+
+		// Duplicates are detected using the entire book line, regardless of grouping. Games without
+		// any book are all expected to start from the same position, so they are skipped.
+		full := line
+		if plies != 0 {
+			full, err = buildOpeningLine(g, 0)
+			if err != nil {
+				log.Warn("could not replay opening", slog.String("job_id", g.JobID), slogx.Err(err))
+				continue
+			}
+		}
+		if full.startFEN == "" && len(full.moves) == 0 {
+			continue
+		}
+		posKey := full.PositionKey()
+		pos, ok := positions[posKey]
+		if !ok {
+			pos = &duplicatePosition{FEN: posKey}
+			positions[posKey] = pos
+			positionOrder = append(positionOrder, posKey)
+		}
+		pos.Indices = append(pos.Indices, g.Index)
+	}
+
+	res := make([]openingStats, 0, len(openings))
+	for key, st := range openings {
+		san, err := lines[key].SAN()
+		if err != nil {
+			log.Warn("could not style opening", slogx.Err(err))
+			san = lines[key].Key()
+		}
+		st.Opening = san
+		if eco, ok := opening.ClassifyECO(lines[key].game); ok {
+			st.ECO = eco.Code
+			st.ECOName = eco.Name
+		}
+		st.finish()
+		res = append(res, *st)
+	}
+	slices.SortFunc(res, func(a, b openingStats) int {
+		if c := cmp.Compare(b.Games, a.Games); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.StartFEN, b.StartFEN); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Opening, b.Opening)
+	})
+
+	ecoRes := make([]openingStats, 0, len(ecos))
+	for _, st := range ecos {
+		st.finish()
+		ecoRes = append(ecoRes, *st)
+	}
+	slices.SortFunc(ecoRes, func(a, b openingStats) int {
+		// Unclassified games go last.
+		if (a.ECO == "") != (b.ECO == "") {
+			if a.ECO == "" {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(a.ECO, b.ECO)
+	})
+
+	var duplicates []duplicatePosition
+	for _, key := range positionOrder {
+		if pos := positions[key]; len(pos.Indices) > 1 {
+			duplicates = append(duplicates, *pos)
+		}
+	}
+
+	return &data{
+		ID:         info.ID,
+		Name:       info.Name,
+		First:      first,
+		Second:     info.Players[1].Name,
+		Plies:      plies,
+		Games:      int64(len(games)),
+		Openings:   res,
+		ECOs:       ecoRes,
+		Duplicates: duplicates,
+	}, nil
+}
+
+func contestOpeningsPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, contestOpeningsDataBuilder{}, "contest_openings")
+}
@@ -0,0 +1,399 @@
+package webui
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type contestResultsFormat int
+
+const (
+	contestResultsCSV contestResultsFormat = iota
+	contestResultsJSON
+	// contestResultsSummaryCSV contains the aggregate results instead of the games. The columns
+	// depend on the contest kind.
+	contestResultsSummaryCSV
+)
+
+type contestResultGame struct {
+	Index       int64      `json:"index"`
+	JobID       string     `json:"job_id"`
+	White       string     `json:"white"`
+	Black       string     `json:"black"`
+	Result      string     `json:"result"`
+	Verdict     string     `json:"verdict,omitempty"`
+	Plies       *int64     `json:"plies,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	OpeningSlot *int64     `json:"opening_slot,omitempty"`
+}
+
+type contestResultsSummary struct {
+	FirstWins    int64    `json:"first_wins"`
+	Draws        int64    `json:"draws"`
+	SecondWins   int64    `json:"second_wins"`
+	Played       int64    `json:"played"`
+	Total        int64    `json:"total"`
+	Wins         int64    `json:"wins,omitempty"`
+	FailedJobs   int64    `json:"failed_jobs"`
+	IllegalMoves int64    `json:"illegal_moves"`
+	Score        string   `json:"score"`
+	LOS          *float64 `json:"los,omitempty"`
+	EloLow       *float64 `json:"elo_low,omitempty"`
+	EloAvg       *float64 `json:"elo_avg,omitempty"`
+	EloHigh      *float64 `json:"elo_high,omitempty"`
+}
+
+type contestResultStanding struct {
+	Player   string  `json:"player"`
+	Score    float64 `json:"score"`
+	Buchholz float64 `json:"buchholz"`
+	Wins     int64   `json:"wins"`
+	Draws    int64   `json:"draws"`
+	Losses   int64   `json:"losses"`
+}
+
+type contestResultTie struct {
+	First       string  `json:"first,omitempty"`
+	Second      string  `json:"second,omitempty"`
+	FirstScore  float64 `json:"first_score"`
+	SecondScore float64 `json:"second_score"`
+	Played      int64   `json:"played"`
+	Winner      string  `json:"winner,omitempty"`
+	Bye         bool    `json:"bye,omitempty"`
+}
+
+type contestResultRetryFailure struct {
+	JobID  string    `json:"job_id"`
+	RoomID string    `json:"room_id,omitempty"`
+	Status string    `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+type contestResultRetries struct {
+	White    string                      `json:"white"`
+	Black    string                      `json:"black"`
+	Attempts int64                       `json:"attempts"`
+	Aborted  int64                       `json:"aborted"`
+	Failed   int64                       `json:"failed"`
+	Recent   []contestResultRetryFailure `json:"recent,omitempty"`
+}
+
+type contestResults struct {
+	ContestID string                  `json:"contest_id"`
+	Name      string                  `json:"name"`
+	Status    string                  `json:"status"`
+	First     string                  `json:"first,omitempty"`
+	Second    string                  `json:"second,omitempty"`
+	Summary   *contestResultsSummary  `json:"summary,omitempty"`
+	Standings []contestResultStanding `json:"standings,omitempty"`
+	Winner    string                  `json:"winner,omitempty"`
+	Bracket   [][]contestResultTie    `json:"bracket,omitempty"`
+	Retries   []contestResultRetries  `json:"retries,omitempty"`
+	Games     []contestResultGame     `json:"games"`
+}
+
+func finiteOrNil(f float64) *float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return &f
+}
+
+func buildContestResultsSummary(info *scheduler.ContestInfo, data *scheduler.ContestData) contestResultsSummary {
+	ms := data.Match.Status()
+	elo := ms.EloDiff(0.95)
+	return contestResultsSummary{
+		FirstWins:    data.Match.FirstWin,
+		Draws:        data.Match.Draw,
+		SecondWins:   data.Match.SecondWin,
+		Played:       data.Match.Played(),
+		Total:        info.Match.Games,
+		Wins:         info.Match.Wins,
+		FailedJobs:   data.FailedJobs,
+		IllegalMoves: data.IllegalMoves,
+		Score:        ms.ScoreString(),
+		LOS:          finiteOrNil(ms.LOS()),
+		EloLow:       finiteOrNil(elo.Low),
+		EloAvg:       finiteOrNil(elo.Avg),
+		EloHigh:      finiteOrNil(elo.High),
+	}
+}
+
+func buildContestResults(info scheduler.ContestInfo, data scheduler.ContestData, jobs []scheduler.FinishedJob) *contestResults {
+	jobs = slices.DeleteFunc(jobs, func(j scheduler.FinishedJob) bool {
+		return j.Status.Kind != roomkeeper.JobSucceeded
+	})
+	slices.SortFunc(jobs, func(a, b scheduler.FinishedJob) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+	res := &contestResults{
+		ContestID: info.ID,
+		Name:      info.Name,
+		Status:    data.Status.Kind.String(),
+		Games: sliceutil.Map(jobs, func(j scheduler.FinishedJob) contestResultGame {
+			g := contestResultGame{
+				Index:       j.Index,
+				JobID:       j.Job.ID,
+				White:       j.Job.White.Name,
+				Black:       j.Job.Black.Name,
+				Result:      j.GameResult.String(),
+				OpeningSlot: j.OpeningSlot,
+			}
+			if j.Game != nil {
+				plies := j.Game.Plies
+				startedAt := j.Game.StartedAt.UTC()
+				finishedAt := j.Game.FinishedAt.UTC()
+				g.Verdict = j.Game.Verdict.String()
+				g.Plies = &plies
+				g.StartedAt = &startedAt
+				g.FinishedAt = &finishedAt
+			}
+			return g
+		}),
+	}
+	for _, r := range data.Retries {
+		if !r.HasFailures() {
+			continue
+		}
+		res.Retries = append(res.Retries, contestResultRetries{
+			White:    info.Players[r.WhiteID].Name,
+			Black:    info.Players[r.BlackID].Name,
+			Attempts: r.Attempts,
+			Aborted:  r.Aborted,
+			Failed:   r.Failed,
+			Recent: sliceutil.Map(r.Recent, func(f scheduler.RetryFailure) contestResultRetryFailure {
+				return contestResultRetryFailure{
+					JobID:  f.JobID,
+					RoomID: f.RoomID,
+					Status: f.Kind.String(),
+					Reason: f.Reason,
+					At:     f.At,
+				}
+			}),
+		})
+	}
+	switch info.Kind {
+	case scheduler.ContestMatch:
+		summary := buildContestResultsSummary(&info, &data)
+		res.First = info.Players[0].Name
+		res.Second = info.Players[1].Name
+		res.Summary = &summary
+	case scheduler.ContestSwiss:
+		res.Standings = sliceutil.Map(data.Swiss.LastStandings(), func(s scheduler.SwissStanding) contestResultStanding {
+			return contestResultStanding{
+				Player:   info.Players[s.Player].Name,
+				Score:    float64(s.Score) / 2,
+				Buchholz: float64(s.Buchholz) / 2,
+				Wins:     s.Wins,
+				Draws:    s.Draws,
+				Losses:   s.Losses,
+			}
+		})
+	case scheduler.ContestKnockout:
+		playerName := func(p int) string {
+			if p < 0 {
+				return ""
+			}
+			return info.Players[p].Name
+		}
+		res.Winner = playerName(data.Knockout.Winner())
+		res.Bracket = sliceutil.Map(data.Knockout.Bracket, func(r []scheduler.KnockoutTie) []contestResultTie {
+			return sliceutil.Map(r, func(t scheduler.KnockoutTie) contestResultTie {
+				return contestResultTie{
+					First:       playerName(t.First),
+					Second:      playerName(t.Second),
+					FirstScore:  float64(t.FirstScore) / 2,
+					SecondScore: float64(t.SecondScore) / 2,
+					Played:      t.Played,
+					Winner:      playerName(t.Winner),
+					Bye:         t.Bye,
+				}
+			})
+		})
+	default:
+		panic("unknown contest kind")
+	}
+	return res
+}
+
+func writeContestResultsCSV(w *csv.Writer, r *contestResults) error {
+	if err := w.Write([]string{
+		"index", "job_id", "white", "black", "result", "verdict", "plies", "started_at", "finished_at",
+	}); err != nil {
+		return err
+	}
+	for _, g := range r.Games {
+		plies, startedAt, finishedAt := "", "", ""
+		if g.Plies != nil {
+			plies = strconv.FormatInt(*g.Plies, 10)
+		}
+		if g.StartedAt != nil {
+			startedAt = g.StartedAt.Format(time.RFC3339)
+		}
+		if g.FinishedAt != nil {
+			finishedAt = g.FinishedAt.Format(time.RFC3339)
+		}
+		if err := w.Write([]string{
+			strconv.FormatInt(g.Index, 10), g.JobID, g.White, g.Black, g.Result, g.Verdict, plies, startedAt, finishedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func formatOptFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', 2, 64)
+}
+
+func formatHalfPoints(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func writeContestSummaryCSV(w *csv.Writer, r *contestResults) error {
+	switch {
+	case r.Summary != nil:
+		s := r.Summary
+		if err := w.Write([]string{
+			"first", "second", "first_wins", "draws", "second_wins", "played", "total", "score",
+			"los", "elo_low", "elo_avg", "elo_high", "failed_jobs", "illegal_moves",
+		}); err != nil {
+			return err
+		}
+		if err := w.Write([]string{
+			r.First, r.Second,
+			strconv.FormatInt(s.FirstWins, 10), strconv.FormatInt(s.Draws, 10), strconv.FormatInt(s.SecondWins, 10),
+			strconv.FormatInt(s.Played, 10), strconv.FormatInt(s.Total, 10), s.Score,
+			formatOptFloat(s.LOS), formatOptFloat(s.EloLow), formatOptFloat(s.EloAvg), formatOptFloat(s.EloHigh),
+			strconv.FormatInt(s.FailedJobs, 10), strconv.FormatInt(s.IllegalMoves, 10),
+		}); err != nil {
+			return err
+		}
+	case r.Standings != nil:
+		if err := w.Write([]string{"rank", "player", "score", "buchholz", "wins", "draws", "losses"}); err != nil {
+			return err
+		}
+		for i, st := range r.Standings {
+			if err := w.Write([]string{
+				strconv.Itoa(i + 1), st.Player, formatHalfPoints(st.Score), formatHalfPoints(st.Buchholz),
+				strconv.FormatInt(st.Wins, 10), strconv.FormatInt(st.Draws, 10), strconv.FormatInt(st.Losses, 10),
+			}); err != nil {
+				return err
+			}
+		}
+	case r.Bracket != nil:
+		if err := w.Write([]string{
+			"round", "first", "second", "first_score", "second_score", "played", "winner", "bye",
+		}); err != nil {
+			return err
+		}
+		for i, round := range r.Bracket {
+			for _, t := range round {
+				if err := w.Write([]string{
+					strconv.Itoa(i + 1), t.First, t.Second, formatHalfPoints(t.FirstScore), formatHalfPoints(t.SecondScore),
+					strconv.FormatInt(t.Played, 10), t.Winner, strconv.FormatBool(t.Bye),
+				}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+type contestResultsAttachImpl struct {
+	log    *slog.Logger
+	cfg    *Config
+	format contestResultsFormat
+}
+
+func (a *contestResultsAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle contest results request",
+		slog.String("method", req.Method),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	if req.Method != http.MethodGet {
+		log.Warn("method not allowed")
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	contestID := req.PathValue("contestID")
+	info, data, err := a.cfg.Scheduler.GetContest(ctx, contestID)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchContest) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+			return
+		}
+		log.Warn("could not get contest", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	if !requestViewer(ctx, log, a.cfg, req).CanView(&info) {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "contest not found"))
+		return
+	}
+	jobs, err := a.cfg.Scheduler.ListContestFinishedJobs(ctx, contestID, 0, 0)
+	if err != nil {
+		log.Warn("could not list finished jobs", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	results := buildContestResults(info, data, jobs)
+
+	switch a.format {
+	case contestResultsCSV:
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"contest_%v.csv\"", contestID))
+		if err := writeContestResultsCSV(csv.NewWriter(w), results); err != nil {
+			log.Info("could not write response", slogx.Err(err))
+		}
+	case contestResultsSummaryCSV:
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"contest_%v_summary.csv\"", contestID))
+		if err := writeContestSummaryCSV(csv.NewWriter(w), results); err != nil {
+			log.Info("could not write response", slogx.Err(err))
+		}
+	case contestResultsJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"contest_%v.json\"", contestID))
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			log.Info("could not write response", slogx.Err(err))
+		}
+	default:
+		panic("must not happen")
+	}
+}
+
+func contestResultsAttach(log *slog.Logger, cfg *Config, format contestResultsFormat) http.Handler {
+	return &contestResultsAttachImpl{
+		log:    log,
+		cfg:    cfg,
+		format: format,
+	}
+}
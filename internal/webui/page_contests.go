@@ -5,15 +5,113 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/alex65536/day20/internal/scheduler"
 	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
 	"github.com/alex65536/day20/internal/util/sliceutil"
 	"github.com/alex65536/day20/internal/util/slogx"
 )
 
+const contestsPageSize = 50
+
+var contestStatusOptions = []scheduler.ContestStatusKind{
+	scheduler.ContestRunning,
+	scheduler.ContestSucceeded,
+	scheduler.ContestAborted,
+	scheduler.ContestFailed,
+}
+
+type contestsQuery struct {
+	Name   string
+	Status string
+	Sort   string
+	Mine   bool
+	Page   int
+}
+
+func (q *contestsQuery) Values(page int) url.Values {
+	v := make(url.Values)
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("name", q.Name)
+	set("status", q.Status)
+	set("sort", q.Sort)
+	if q.Mine {
+		v.Set("mine", "true")
+	}
+	if page != 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	return v
+}
+
+func (q *contestsQuery) URL(page int) string {
+	v := q.Values(page)
+	if len(v) == 0 {
+		return "/contests"
+	}
+	return "/contests?" + v.Encode()
+}
+
+func parseContestsQuery(v url.Values, user *userauth.User) (contestsQuery, scheduler.ContestFilter, error) {
+	q := contestsQuery{
+		Name:   strings.TrimSpace(v.Get("name")),
+		Status: v.Get("status"),
+		Sort:   v.Get("sort"),
+		Mine:   user != nil && v.Get("mine") == "true",
+		Page:   1,
+	}
+	f := scheduler.ContestFilter{
+		Name: q.Name,
+	}
+	if q.Mine {
+		f.OwnerID = user.ID
+	}
+
+	// Support the old "running" flag, so the existing links don't break.
+	if q.Status == "" && v.Get("running") == "true" {
+		q.Status = scheduler.ContestRunning.String()
+	}
+	if q.Status != "" {
+		idx := slices.IndexFunc(contestStatusOptions, func(k scheduler.ContestStatusKind) bool {
+			return k.String() == q.Status
+		})
+		if idx < 0 {
+			return contestsQuery{}, scheduler.ContestFilter{}, fmt.Errorf("bad status")
+		}
+		f.Statuses = []scheduler.ContestStatusKind{contestStatusOptions[idx]}
+	}
+
+	switch q.Sort {
+	case "":
+		f.Sort = scheduler.ContestSortCreated
+	case "finished":
+		f.Sort = scheduler.ContestSortFinished
+	default:
+		return contestsQuery{}, scheduler.ContestFilter{}, fmt.Errorf("bad sort order")
+	}
+
+	if s := v.Get("page"); s != "" {
+		page, err := strconv.Atoi(s)
+		if err != nil || page <= 0 {
+			return contestsQuery{}, scheduler.ContestFilter{}, fmt.Errorf("bad page")
+		}
+		q.Page = page
+	}
+	f.Offset = (q.Page - 1) * contestsPageSize
+	f.Limit = contestsPageSize + 1
+
+	return q, f, nil
+}
+
 type contestsDataBuilder struct{}
 
 func (contestsDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
@@ -22,55 +120,94 @@ func (contestsDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error
 	log := bc.Log
 
 	type item struct {
-		ID       string
-		Name     string
-		Kind     scheduler.ContestKind
-		Status   scheduler.ContestStatusKind
-		Progress *progressPartData
-		Result   string
+		ID         string
+		Name       string
+		Kind       scheduler.ContestKind
+		Visibility scheduler.ContestVisibility
+		Owner      string
+		Status     scheduler.ContestStatusKind
+		Archived   bool
+		PGNPruned  bool
+		Progress   *progressPartData
+		Result     string
+		QueuePos   int
 	}
 
 	type data struct {
-		RunningOnly      bool
+		Query            contestsQuery
+		Statuses         []scheduler.ContestStatusKind
+		LoggedIn         bool
 		CanStartContests bool
+		ShowOwners       bool
 		Contests         []item
+		PrevURL          string
+		NextURL          string
 	}
 
-	var contests []scheduler.ContestFullData
-	runningOnly := req.URL.Query().Get("running") == "true"
-	if runningOnly {
-		contests = cfg.Scheduler.ListRunningContests()
-	} else {
-		var err error
-		contests, err = cfg.Scheduler.ListAllContests(ctx)
-		if err != nil {
-			log.Warn("could not list all contests", slogx.Err(err))
-			return nil, fmt.Errorf("list all contests: %w", err)
-		}
+	q, filter, err := parseContestsQuery(req.URL.Query(), bc.FullUser)
+	if err != nil {
+		return nil, httputil.MakeError(http.StatusBadRequest, err.Error())
+	}
+	viewer := bc.Viewer()
+	filter.Viewer = viewer
+	contests, err := cfg.Scheduler.ListContests(ctx, filter)
+	if err != nil {
+		log.Warn("could not list contests", slogx.Err(err))
+		return nil, fmt.Errorf("list contests: %w", err)
+	}
+	hasNext := len(contests) > contestsPageSize
+	if hasNext {
+		contests = contests[:contestsPageSize]
+	}
+	var prevURL, nextURL string
+	if q.Page > 1 {
+		prevURL = q.URL(q.Page - 1)
+	}
+	if hasNext {
+		nextURL = q.URL(q.Page + 1)
 	}
-	slices.SortFunc(contests, func(a, b scheduler.ContestFullData) int {
-		return strings.Compare(b.Info.ID, a.Info.ID)
-	})
+
+	queue := cfg.Scheduler.ContestQueue()
 
 	canStartContests := false
 	if bc.FullUser != nil && bc.FullUser.Perms.Get(userauth.PermRunContests) {
 		canStartContests = true
 	}
 
+	var usernames map[string]string
+	if viewer.Admin {
+		users, err := cfg.UserManager.ListUsers(ctx)
+		if err != nil {
+			log.Warn("could not list users", slogx.Err(err))
+			return nil, fmt.Errorf("list users: %w", err)
+		}
+		usernames = make(map[string]string, len(users))
+		for _, u := range users {
+			usernames[u.ID] = u.Username
+		}
+	}
+
 	return &data{
-		RunningOnly:      runningOnly,
+		Query:            q,
+		Statuses:         contestStatusOptions,
+		LoggedIn:         bc.FullUser != nil,
+		PrevURL:          prevURL,
+		NextURL:          nextURL,
 		CanStartContests: canStartContests,
+		ShowOwners:       viewer.Admin,
 		Contests: sliceutil.Map(contests, func(c scheduler.ContestFullData) item {
-			if c.Info.Kind != scheduler.ContestMatch {
-				panic("unknown contest kind")
-			}
 			return item{
-				ID:       c.Info.ID,
-				Name:     c.Info.Name,
-				Kind:     c.Info.Kind,
-				Status:   c.Data.Status.Kind,
-				Progress: buildProgressPartData(c.Data.Match.Played(), c.Info.Match.Games),
-				Result:   c.Data.Match.Status().ScoreString(),
+				ID:         c.Info.ID,
+				Name:       c.Info.Name,
+				Kind:       c.Info.Kind,
+				Visibility: c.Info.Visibility,
+				Owner:      usernames[c.Info.OwnerID],
+				Status:     c.Data.Status.Kind,
+				Archived:   c.Data.ArchivedAt != nil,
+				PGNPruned:  c.Data.PGNPruned,
+				Progress:   buildProgressPartData(c.Info.Progress(&c.Data)),
+				Result:     contestResultString(&c.Info, &c.Data),
+				QueuePos:   slices.Index(queue, c.Info.ID) + 1,
 			}
 		}),
 	}, nil
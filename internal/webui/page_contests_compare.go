@@ -0,0 +1,144 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/stat"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+const (
+	compareConfidence = 0.95
+	compareSPRTAlpha  = 0.05
+	compareSPRTBeta   = 0.05
+)
+
+type contestsCompareDataBuilder struct{}
+
+func (contestsCompareDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	type side struct {
+		Label   string
+		ID      string
+		Name    string
+		First   string
+		Second  string
+		Status  stat.Status
+		Score   string
+		EloDiff stat.EloDiff
+		LLR     float64
+	}
+
+	type data struct {
+		A          string
+		B          string
+		Elo0       string
+		Elo1       string
+		Has        bool
+		Sides      []*side
+		SamePair   bool
+		Combined   stat.Status
+		LLR        float64
+		LowerBound float64
+		UpperBound float64
+		SPRT       string
+		Comparison stat.Comparison
+	}
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	q := req.URL.Query()
+	d := &data{
+		A:    q.Get("a"),
+		B:    q.Get("b"),
+		Elo0: q.Get("elo0"),
+		Elo1: q.Get("elo1"),
+	}
+	if d.Elo0 == "" {
+		d.Elo0 = "0"
+	}
+	if d.Elo1 == "" {
+		d.Elo1 = "5"
+	}
+	if d.A == "" || d.B == "" {
+		return d, nil
+	}
+	elo0, err := strconv.ParseFloat(d.Elo0, 64)
+	if err != nil {
+		return nil, httputil.MakeError(http.StatusBadRequest, "bad elo0")
+	}
+	elo1, err := strconv.ParseFloat(d.Elo1, 64)
+	if err != nil || elo1 == elo0 {
+		return nil, httputil.MakeError(http.StatusBadRequest, "bad elo1")
+	}
+
+	getSide := func(label, contestID string) (*side, error) {
+		info, data, err := cfg.Scheduler.GetContest(ctx, contestID)
+		if err != nil {
+			if errors.Is(err, scheduler.ErrNoSuchContest) {
+				return nil, httputil.MakeError(http.StatusNotFound, fmt.Sprintf("contest %q not found", contestID))
+			}
+			log.Warn("could not get contest", slogx.Err(err))
+			return nil, fmt.Errorf("get contest: %w", err)
+		}
+		if !bc.Viewer().CanView(&info) {
+			return nil, httputil.MakeError(http.StatusNotFound, fmt.Sprintf("contest %q not found", contestID))
+		}
+		if info.Kind != scheduler.ContestMatch {
+			return nil, httputil.MakeError(http.StatusBadRequest, fmt.Sprintf("contest %q is not a match", contestID))
+		}
+		ms := data.Match.Status()
+		return &side{
+			Label:   label,
+			ID:      info.ID,
+			Name:    info.Name,
+			First:   info.Players[0].Name,
+			Second:  info.Players[1].Name,
+			Status:  ms,
+			Score:   ms.ScoreString(),
+			EloDiff: ms.EloDiff(compareConfidence),
+			LLR:     ms.LLR(elo0, elo1),
+		}, nil
+	}
+	a, err := getSide("A", d.A)
+	if err != nil {
+		return nil, err
+	}
+	b, err := getSide("B", d.B)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Has = true
+	d.Sides = []*side{a, b}
+	d.SamePair = a.First == b.First && a.Second == b.Second
+	d.Combined = a.Status.Add(b.Status)
+	d.LLR = d.Combined.LLR(elo0, elo1)
+	d.LowerBound, d.UpperBound = stat.SPRTBounds(compareSPRTAlpha, compareSPRTBeta)
+	switch {
+	case d.LLR >= d.UpperBound:
+		d.SPRT = fmt.Sprintf("H1 accepted (Elo difference is %v)", d.Elo1)
+	case d.LLR <= d.LowerBound:
+		d.SPRT = fmt.Sprintf("H0 accepted (Elo difference is %v)", d.Elo0)
+	default:
+		d.SPRT = "Inconclusive"
+	}
+	d.Comparison = stat.Compare(a.Status, b.Status, compareConfidence)
+	return d, nil
+}
+
+func contestsComparePage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, contestsCompareDataBuilder{}, "contests_compare")
+}
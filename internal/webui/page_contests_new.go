@@ -2,19 +2,23 @@ package webui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 	"unicode/utf8"
 
+	"github.com/alex65536/day20/internal/opening"
 	"github.com/alex65536/day20/internal/roomapi"
 	"github.com/alex65536/day20/internal/scheduler"
 	"github.com/alex65536/day20/internal/userauth"
 	"github.com/alex65536/day20/internal/util/httputil"
 	"github.com/alex65536/day20/internal/util/randutil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
 	"github.com/alex65536/day20/internal/util/slogx"
 	"github.com/alex65536/go-chess/clock"
 	"github.com/gorilla/csrf"
@@ -28,8 +32,34 @@ func (contestsNewDataBuilder) Build(ctx context.Context, bc builderCtx) (any, er
 	log := bc.Log
 	user := bc.FullUser
 
+	type eventItem struct {
+		ID       string
+		Name     string
+		Selected bool
+	}
+
+	type bookItem struct {
+		ID        string
+		Name      string
+		Positions int
+	}
+
+	type presetItem struct {
+		ID       string
+		Name     string
+		Selected bool
+	}
+
 	type data struct {
-		CSRFField template.HTML
+		CSRFField     template.HTML
+		Events        []eventItem
+		Books         []bookItem
+		Presets       []presetItem
+		Visibilities  []scheduler.ContestVisibility
+		Tiebreaks     []scheduler.KnockoutTiebreak
+		BookEval      bool
+		MaxUploadSize int64
+		Form          contestFormData
 	}
 
 	if user == nil || !user.Perms.Get(userauth.PermRunContests) {
@@ -38,141 +68,587 @@ func (contestsNewDataBuilder) Build(ctx context.Context, bc builderCtx) (any, er
 
 	switch req.Method {
 	case http.MethodGet:
+		events, err := cfg.Scheduler.ListEvents(ctx)
+		if err != nil {
+			log.Warn("could not list events", slogx.Err(err))
+			return nil, fmt.Errorf("list events: %w", err)
+		}
+		books, err := cfg.Scheduler.ListStoredBooks(ctx)
+		if err != nil {
+			log.Warn("could not list books", slogx.Err(err))
+			return nil, fmt.Errorf("list books: %w", err)
+		}
+		selectedEvent := req.URL.Query().Get("event")
+		form := defaultContestFormData()
+		form.TimeControl = userPrefs(user).TimeControl
+		if fromID := req.URL.Query().Get("from"); fromID != "" {
+			info, _, err := cfg.Scheduler.GetContest(ctx, fromID)
+			if err != nil {
+				if !errors.Is(err, scheduler.ErrNoSuchContest) {
+					log.Warn("could not get contest", slogx.Err(err))
+				}
+				return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
+			}
+			if !bc.Viewer().CanView(&info) {
+				return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
+			}
+			form = contestFormDataFromSettings(&info.ContestSettings)
+			if selectedEvent == "" && info.EventID != nil {
+				selectedEvent = *info.EventID
+			}
+		}
+		presets, err := cfg.Scheduler.ListContestPresets(ctx)
+		if err != nil {
+			log.Warn("could not list presets", slogx.Err(err))
+			return nil, fmt.Errorf("list presets: %w", err)
+		}
+		selectedPreset := req.URL.Query().Get("preset")
+		if selectedPreset != "" {
+			preset, err := cfg.Scheduler.GetContestPreset(ctx, selectedPreset)
+			if err != nil {
+				if !errors.Is(err, scheduler.ErrNoSuchPreset) {
+					log.Warn("could not get preset", slogx.Err(err))
+				}
+				return nil, httputil.MakeError(http.StatusNotFound, "preset not found")
+			}
+			settings := scheduler.ContestSettings{
+				Name:       form.Name,
+				Visibility: form.Visibility,
+				Players: []roomapi.JobEngine{
+					{Name: form.First},
+					{Name: form.Second},
+				},
+			}
+			preset.Apply(&settings)
+			form = contestFormDataFromSettings(&settings)
+		}
+		visibilities := make([]scheduler.ContestVisibility, 0, scheduler.ContestVisibilityMax)
+		for v := range scheduler.ContestVisibilityMax {
+			visibilities = append(visibilities, v)
+		}
+		tiebreaks := make([]scheduler.KnockoutTiebreak, 0, scheduler.KnockoutTiebreakMax)
+		for t := range scheduler.KnockoutTiebreakMax {
+			tiebreaks = append(tiebreaks, t)
+		}
 		return &data{
-			CSRFField: csrf.TemplateField(req),
+			CSRFField:     csrf.TemplateField(req),
+			Visibilities:  visibilities,
+			Tiebreaks:     tiebreaks,
+			BookEval:      cfg.BookEval != nil,
+			MaxUploadSize: cfg.opts.MaxUploadSize,
+			Form:          form,
+			Presets: sliceutil.Map(presets, func(p scheduler.ContestPreset) presetItem {
+				return presetItem{
+					ID:       p.ID,
+					Name:     p.Name,
+					Selected: p.ID == selectedPreset,
+				}
+			}),
+			Events: sliceutil.Map(events, func(e scheduler.Event) eventItem {
+				return eventItem{
+					ID:       e.ID,
+					Name:     e.Name,
+					Selected: e.ID == selectedEvent,
+				}
+			}),
+			Books: sliceutil.Map(books, func(b scheduler.StoredBook) bookItem {
+				return bookItem{
+					ID:        b.ID,
+					Name:      b.Name,
+					Positions: b.Positions,
+				}
+			}),
 		}, nil
 	case http.MethodPost:
 		if !bc.IsHTMX() {
 			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
 		}
-		err := req.ParseForm()
+		err := parseUploadForm(req)
 		if err != nil {
-			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
-		}
-		var info scheduler.ContestInfo
-		errs := func() []string {
-			var errs []string
-			var settings scheduler.ContestSettings
-
-			settings.Name = req.FormValue("name")
-			if settings.Name == "" {
-				errs = append(errs, "name not specified")
-			} else if utf8.RuneCountInString(settings.Name) > scheduler.ContestNameMaxLen {
-				errs = append(errs, fmt.Sprintf("name exceeds %v runes", scheduler.ContestNameMaxLen))
-			}
+			return nil, err
+		}
+		info, errs := createContestFromForm(ctx, bc)
+		if len(errs) != 0 {
+			return &errorsPartData{Errors: errs}, nil
+		}
+		return nil, bc.Redirect("/contest/" + info.ID)
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
 
-			switch req.FormValue("time") {
-			case "fixed":
-				ms, err := strconv.ParseInt(req.FormValue("time-fixed-value"), 10, 64)
-				if err != nil {
-					errs = append(errs, "no fixed time")
-					break
-				}
-				if ms > 1e9 {
-					errs = append(errs, "fixed time too large")
-					break
-				}
-				fixedTime := time.Duration(ms) * time.Millisecond
-				settings.FixedTime = &fixedTime
-			case "control":
-				c, err := clock.ControlFromString(req.FormValue("time-control-value"))
-				if err != nil {
-					errs = append(errs, "bad time control: "+err.Error())
-					break
-				}
-				settings.TimeControl = &c
-			default:
-				errs = append(errs, "bad choice for time")
-			}
+// createContestFromForm creates the contest using the settings from the contest creation form. It
+// is shared between the web UI and the JSON API.
+func createContestFromForm(ctx context.Context, bc builderCtx) (scheduler.ContestInfo, []string) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+	user := bc.FullUser
 
-			hasBook := true
-			switch req.FormValue("openings") {
-			case "gb20":
-				settings.OpeningBook = scheduler.OpeningBook{
-					Kind: scheduler.OpeningsBuiltin,
-					Data: scheduler.BuiltinBookGBSelect2020,
-				}
-			case "gb14":
-				settings.OpeningBook = scheduler.OpeningBook{
-					Kind: scheduler.OpeningsBuiltin,
-					Data: scheduler.BuiltinBookGraham20141F,
-				}
-			case "fen":
-				settings.OpeningBook = scheduler.OpeningBook{
-					Kind: scheduler.OpeningsFEN,
-					Data: req.FormValue("openings-value"),
-				}
-			case "pgn-line":
-				settings.OpeningBook = scheduler.OpeningBook{
-					Kind: scheduler.OpeningsPGNLine,
-					Data: req.FormValue("openings-value"),
-				}
-			default:
-				errs = append(errs, "bad opening kind")
-				hasBook = false
-			}
-			if hasBook {
-				if _, err := settings.OpeningBook.Book(randutil.DefaultSource()); err != nil {
-					errs = append(errs, "bad opening book: "+err.Error())
-				}
-			}
+	var errs []string
+	var settings scheduler.ContestSettings
 
-			if t := req.FormValue("score-threshold"); t != "" {
-				tv, err := strconv.ParseInt(t, 10, 32)
-				if err != nil {
-					errs = append(errs, "bad score threshold")
-				} else {
-					settings.ScoreThreshold = int32(tv)
-				}
-			}
+	settings.Name = req.FormValue("name")
+	if settings.Name == "" {
+		errs = append(errs, "name not specified")
+	} else if utf8.RuneCountInString(settings.Name) > scheduler.ContestNameMaxLen {
+		errs = append(errs, fmt.Sprintf("name exceeds %v runes", scheduler.ContestNameMaxLen))
+	}
 
-			settings.Kind = scheduler.ContestMatch
-			settings.Match = &scheduler.MatchSettings{}
+	errs = append(errs, parseContestTimeForm(req, &settings)...)
+	extraControls, extraErrs := parseContestExtraTimeForm(req)
+	errs = append(errs, extraErrs...)
+	errs = append(errs, parseContestOpeningsForm(ctx, bc, &settings)...)
 
-			settings.Players = []roomapi.JobEngine{
-				{Name: req.FormValue("first")},
-				{Name: req.FormValue("second")},
-			}
-			for i, p := range settings.Players {
-				if len(p.Name) == 0 {
-					errs = append(errs, fmt.Sprintf("no name for engine #%v", i+1))
-				}
-			}
+	if t := req.FormValue("score-threshold"); t != "" {
+		tv, err := strconv.ParseInt(t, 10, 32)
+		if err != nil {
+			errs = append(errs, "bad score threshold")
+		} else {
+			settings.ScoreThreshold = int32(tv)
+		}
+	}
 
-			games, err := strconv.ParseInt(req.FormValue("games"), 10, 64)
-			if err != nil {
-				errs = append(errs, "invalid number of games")
-			} else if games <= 0 {
-				errs = append(errs, "non-positive number of games")
-			} else {
-				settings.Match.Games = games
-			}
+	if o := req.FormValue("move-overhead"); o != "" {
+		ms, err := strconv.ParseInt(o, 10, 64)
+		if err != nil || ms < 0 || ms > 1e9 {
+			errs = append(errs, "bad move overhead")
+		} else if ms != 0 {
+			overhead := time.Duration(ms) * time.Millisecond
+			settings.MoveOverhead = &overhead
+		}
+	}
 
-			if len(errs) != 0 {
-				return errs
-			}
+	if eventID := req.FormValue("event"); eventID != "" {
+		settings.EventID = &eventID
+	}
 
-			err = settings.Validate()
-			if err != nil {
-				return []string{err.Error()}
+	if v, ok := scheduler.ContestVisibilityFromString(req.FormValue("visibility")); ok {
+		settings.Visibility = v
+	} else {
+		errs = append(errs, "bad visibility")
+	}
+
+	switch req.FormValue("kind") {
+	case "", "match":
+		settings.Kind = scheduler.ContestMatch
+		settings.Match = &scheduler.MatchSettings{}
+		settings.Players = []roomapi.JobEngine{
+			{Name: req.FormValue("first")},
+			{Name: req.FormValue("second")},
+		}
+		for i, p := range settings.Players {
+			if len(p.Name) == 0 {
+				errs = append(errs, fmt.Sprintf("no name for engine #%v", i+1))
 			}
+		}
+		errs = append(errs, parseContestLengthForm(req, settings.Match)...)
+	case "swiss":
+		settings.Kind = scheduler.ContestSwiss
+		settings.Swiss = &scheduler.SwissSettings{}
+		settings.Players = parsePlayersForm(req)
+		if len(settings.Players) < 3 {
+			errs = append(errs, "at least 3 players required")
+		}
+		errs = append(errs, parseSwissRoundsForm(req, settings.Swiss)...)
+	case "knockout":
+		settings.Kind = scheduler.ContestKnockout
+		settings.Knockout = &scheduler.KnockoutSettings{}
+		settings.Players = parsePlayersForm(req)
+		if len(settings.Players) < 2 {
+			errs = append(errs, "at least 2 players required")
+		}
+		errs = append(errs, parseKnockoutForm(req, settings.Knockout)...)
+	default:
+		errs = append(errs, "bad contest kind")
+	}
 
-			info, err = cfg.Scheduler.CreateContest(ctx, settings)
-			if err != nil {
-				log.Warn("failed to create contest", slogx.Err(err))
-				return []string{"failed to create contest"}
+	if len(errs) != 0 {
+		return scheduler.ContestInfo{}, errs
+	}
+
+	if w := req.FormValue("openings-eval"); w != "" {
+		if cfg.BookEval == nil {
+			return scheduler.ContestInfo{}, []string{"opening evaluation is not available on this server"}
+		}
+		window, err := opening.EvalWindowFromString(w)
+		if err != nil {
+			return scheduler.ContestInfo{}, []string{"bad evaluation window: " + err.Error()}
+		}
+		// Stored books are inlined, as the filtered book differs from the stored one.
+		book, err := cfg.Scheduler.ResolveBook(ctx, settings.OpeningBook)
+		if err != nil {
+			log.Warn("could not resolve opening book", slogx.Err(err))
+			return scheduler.ContestInfo{}, []string{"could not resolve opening book"}
+		}
+		book, stats, err := book.Filter(ctx, cfg.BookEval.Evaluator, opening.FilterOptions{
+			Window: window,
+			Jobs:   cfg.BookEval.Jobs,
+		})
+		if err != nil {
+			log.Info("could not evaluate opening book", slogx.Err(err))
+			return scheduler.ContestInfo{}, []string{"could not evaluate opening book: " + err.Error()}
+		}
+		log.Info("filtered opening book",
+			slog.Int("kept", stats.Kept),
+			slog.Int("dropped", stats.Dropped),
+		)
+		settings.OpeningBook = book
+	}
+
+	if err := settings.Validate(); err != nil {
+		return scheduler.ContestInfo{}, []string{err.Error()}
+	}
+
+	ignoreQuota := user.Perms.Get(userauth.PermAdmin)
+	var info scheduler.ContestInfo
+	var err error
+	if len(extraControls) == 0 {
+		info, err = cfg.Scheduler.CreateContest(ctx, user.ID, settings, ignoreQuota)
+	} else {
+		group := make([]scheduler.ContestSettings, 0, len(extraControls)+1)
+		for _, c := range append([]clock.Control{*settings.TimeControl}, extraControls...) {
+			sub := settings.Clone()
+			sub.Name = fmt.Sprintf("%v (%v)", settings.Name, c.String())
+			sub.TimeControl = &c
+			if err := sub.Validate(); err != nil {
+				return scheduler.ContestInfo{}, []string{err.Error()}
 			}
-			return nil
-		}()
-		if len(errs) != 0 {
-			return &errorsPartData{Errors: errs}, nil
+			group = append(group, sub)
+		}
+		var infos []scheduler.ContestInfo
+		infos, err = cfg.Scheduler.CreateContestGroup(ctx, user.ID, group, ignoreQuota)
+		if err == nil {
+			info = infos[0]
+		}
+	}
+	if err != nil {
+		if errors.Is(err, scheduler.ErrQuotaExceeded) {
+			return scheduler.ContestInfo{}, []string{err.Error()}
+		}
+		if errors.Is(err, scheduler.ErrNoSuchEvent) {
+			return scheduler.ContestInfo{}, []string{"event not found"}
+		}
+		if errors.Is(err, scheduler.ErrNoSuchBook) {
+			return scheduler.ContestInfo{}, []string{"opening book not found"}
+		}
+		log.Warn("failed to create contest", slogx.Err(err))
+		return scheduler.ContestInfo{}, []string{"failed to create contest"}
+	}
+	return info, nil
+}
+
+// contestFormData contains the initial values of the fields in the contest creation form.
+type contestFormData struct {
+	Name             string
+	Visibility       scheduler.ContestVisibility
+	HasFixedTime     bool
+	FixedTime        int64
+	TimeControl      string
+	Openings         string
+	OpeningsValue    string
+	OpeningsStored   string
+	OpeningsMaxPlies int
+	OpeningsDedup    bool
+	OpeningsPinned   bool
+	ScoreThreshold   int32
+	MoveOverhead     int64
+	Kind             string
+	First            string
+	Second           string
+	Players          string
+	Rounds           int64
+	GamesPerTie      int64
+	Tiebreak         scheduler.KnockoutTiebreak
+	TiebreakGames    int64
+	Games            int64
+	HasWins          bool
+	Wins             int64
+}
+
+func defaultContestFormData() contestFormData {
+	return contestFormData{
+		Visibility:    scheduler.ContestPublic,
+		Openings:      "gb20",
+		Kind:          "match",
+		Rounds:        5,
+		GamesPerTie:   2,
+		Tiebreak:      scheduler.KnockoutTiebreakPairs,
+		TiebreakGames: 2,
+		Games:         100,
+		Wins:          10,
+	}
+}
+
+// contestFormDataFromSettings converts the contest settings back into the form, so they can be used
+// to create a similar contest.
+func contestFormDataFromSettings(s *scheduler.ContestSettings) contestFormData {
+	f := defaultContestFormData()
+	f.Name = s.Name
+	f.Visibility = s.Visibility
+	if s.FixedTime != nil {
+		f.HasFixedTime = true
+		f.FixedTime = s.FixedTime.Milliseconds()
+	}
+	if s.TimeControl != nil {
+		f.TimeControl = s.TimeControl.String()
+	}
+	switch s.OpeningBook.Kind {
+	case scheduler.OpeningsBuiltin:
+		switch s.OpeningBook.Data {
+		case scheduler.BuiltinBookGBSelect2020:
+			f.Openings = "gb20"
+		case scheduler.BuiltinBookGraham20141F:
+			f.Openings = "gb14"
+		}
+	case scheduler.OpeningsFEN:
+		f.Openings = "fen"
+		f.OpeningsValue = s.OpeningBook.Data
+	case scheduler.OpeningsPGNLine:
+		f.Openings = "pgn-line"
+		f.OpeningsValue = s.OpeningBook.Data
+	case scheduler.OpeningsStored:
+		f.Openings = "stored"
+		f.OpeningsStored = s.OpeningBook.Data
+	}
+	f.OpeningsMaxPlies = s.OpeningBook.MaxPlies
+	f.OpeningsDedup = s.OpeningBook.Dedup
+	f.OpeningsPinned = s.OpeningBook.Pinned
+	f.ScoreThreshold = s.ScoreThreshold
+	if s.MoveOverhead != nil {
+		f.MoveOverhead = s.MoveOverhead.Milliseconds()
+	}
+	switch s.Kind {
+	case scheduler.ContestSwiss, scheduler.ContestKnockout:
+		f.Kind = strings.ToLower(s.Kind.PrettyString())
+		f.Players = strings.Join(sliceutil.Map(s.Players, func(p roomapi.JobEngine) string {
+			return p.Name
+		}), "\n")
+		if s.Swiss != nil {
+			f.Rounds = s.Swiss.Rounds
+		}
+		if s.Knockout != nil {
+			f.GamesPerTie = s.Knockout.GamesPerTie
+			f.Tiebreak = s.Knockout.Tiebreak
+			f.TiebreakGames = s.Knockout.TiebreakGames
 		}
-		return nil, bc.Redirect("/contest/" + info.ID)
 	default:
-		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+		if len(s.Players) >= 2 {
+			f.First = s.Players[0].Name
+			f.Second = s.Players[1].Name
+		}
+	}
+	if s.Match != nil {
+		if s.Match.IsFirstTo() {
+			f.HasWins = true
+			f.Wins = s.Match.Wins
+		} else {
+			f.Games = s.Match.Games
+		}
 	}
+	return f
 }
 
 func contestsNewPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
 	return newPage(log, cfg, pageOptions{FullUser: true}, templ, contestsNewDataBuilder{}, "contests_new")
 }
+
+func parseContestTimeForm(req *http.Request, settings *scheduler.ContestSettings) []string {
+	var errs []string
+	switch req.FormValue("time") {
+	case "fixed":
+		ms, err := strconv.ParseInt(req.FormValue("time-fixed-value"), 10, 64)
+		if err != nil {
+			errs = append(errs, "no fixed time")
+			break
+		}
+		if ms > 1e9 {
+			errs = append(errs, "fixed time too large")
+			break
+		}
+		fixedTime := time.Duration(ms) * time.Millisecond
+		settings.FixedTime = &fixedTime
+	case "control":
+		c, err := clock.ControlFromString(req.FormValue("time-control-value"))
+		if err != nil {
+			errs = append(errs, "bad time control: "+err.Error())
+			break
+		}
+		settings.TimeControl = &c
+	default:
+		errs = append(errs, "bad choice for time")
+	}
+	return errs
+}
+
+// parseContestExtraTimeForm parses the additional time controls. The contest is played at each of
+// them in a separate linked sub-contest.
+func parseContestExtraTimeForm(req *http.Request) ([]clock.Control, []string) {
+	fields := strings.Fields(req.FormValue("time-control-extra"))
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	if req.FormValue("time") != "control" {
+		return nil, []string{"additional time controls require a time control"}
+	}
+	controls := make([]clock.Control, 0, len(fields))
+	for _, f := range fields {
+		c, err := clock.ControlFromString(f)
+		if err != nil {
+			return nil, []string{"bad additional time control: " + err.Error()}
+		}
+		controls = append(controls, c)
+	}
+	return controls, nil
+}
+
+// parseContestLengthForm parses the match length. The match either has a fixed number of games, or
+// goes on until one of the players reaches the given number of wins. If the length kind is not
+// specified, a fixed number of games is assumed.
+func parseContestLengthForm(req *http.Request, settings *scheduler.MatchSettings) []string {
+	var errs []string
+	switch req.FormValue("length") {
+	case "", "games":
+		games, err := strconv.ParseInt(req.FormValue("games"), 10, 64)
+		if err != nil {
+			errs = append(errs, "invalid number of games")
+		} else if games <= 0 {
+			errs = append(errs, "non-positive number of games")
+		} else {
+			settings.Games = games
+			settings.Wins = 0
+		}
+	case "wins":
+		wins, err := strconv.ParseInt(req.FormValue("wins"), 10, 64)
+		if err != nil {
+			errs = append(errs, "invalid number of wins")
+		} else if wins <= 0 {
+			errs = append(errs, "non-positive number of wins")
+		} else {
+			settings.Games = 0
+			settings.Wins = wins
+		}
+	default:
+		errs = append(errs, "bad choice for match length")
+	}
+	return errs
+}
+
+func parseSwissRoundsForm(req *http.Request, settings *scheduler.SwissSettings) []string {
+	rounds, err := strconv.ParseInt(req.FormValue("rounds"), 10, 64)
+	if err != nil {
+		return []string{"invalid number of rounds"}
+	}
+	if rounds <= 0 {
+		return []string{"non-positive number of rounds"}
+	}
+	settings.Rounds = rounds
+	return nil
+}
+
+// parsePlayersForm parses the list of players, one per line. Empty lines are ignored.
+func parsePlayersForm(req *http.Request) []roomapi.JobEngine {
+	var players []roomapi.JobEngine
+	for _, name := range strings.Split(req.FormValue("players"), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			players = append(players, roomapi.JobEngine{Name: name})
+		}
+	}
+	return players
+}
+
+// parseKnockoutForm parses the length of ties in the knockout bracket and the tiebreak rules.
+func parseKnockoutForm(req *http.Request, settings *scheduler.KnockoutSettings) []string {
+	var errs []string
+	if games, err := strconv.ParseInt(req.FormValue("games-per-tie"), 10, 64); err != nil {
+		errs = append(errs, "invalid number of games per tie")
+	} else if games <= 0 {
+		errs = append(errs, "non-positive number of games per tie")
+	} else {
+		settings.GamesPerTie = games
+	}
+	if t, ok := scheduler.KnockoutTiebreakFromString(req.FormValue("tiebreak")); ok {
+		settings.Tiebreak = t
+	} else {
+		errs = append(errs, "bad tiebreak")
+	}
+	if settings.Tiebreak != scheduler.KnockoutTiebreakSeed {
+		if games, err := strconv.ParseInt(req.FormValue("tiebreak-games"), 10, 64); err != nil {
+			errs = append(errs, "invalid number of tiebreak games")
+		} else if games < 0 {
+			errs = append(errs, "negative number of tiebreak games")
+		} else {
+			settings.TiebreakGames = games
+		}
+	}
+	return errs
+}
+
+func parseContestOpeningsForm(ctx context.Context, bc builderCtx, settings *scheduler.ContestSettings) []string {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+	var errs []string
+	hasBook := true
+	switch req.FormValue("openings") {
+	case "gb20":
+		settings.OpeningBook = scheduler.OpeningBook{
+			Kind: scheduler.OpeningsBuiltin,
+			Data: scheduler.BuiltinBookGBSelect2020,
+		}
+	case "gb14":
+		settings.OpeningBook = scheduler.OpeningBook{
+			Kind: scheduler.OpeningsBuiltin,
+			Data: scheduler.BuiltinBookGraham20141F,
+		}
+	case "fen", "pgn-line":
+		kind := scheduler.OpeningsFEN
+		if req.FormValue("openings") == "pgn-line" {
+			kind = scheduler.OpeningsPGNLine
+		}
+		// Uploaded file takes precedence over the text field.
+		data, ok, err := readUploadedText(req, "openings-file")
+		if err != nil {
+			errs = append(errs, "bad opening book file: "+err.Error())
+			hasBook = false
+			break
+		}
+		if !ok {
+			data = req.FormValue("openings-value")
+		}
+		settings.OpeningBook = scheduler.OpeningBook{
+			Kind: kind,
+			Data: data,
+		}
+	case "stored":
+		settings.OpeningBook = scheduler.OpeningBook{
+			Kind: scheduler.OpeningsStored,
+			Data: req.FormValue("openings-stored"),
+		}
+	default:
+		errs = append(errs, "bad opening kind")
+		hasBook = false
+	}
+	if hasBook {
+		if p := req.FormValue("openings-max-plies"); p != "" {
+			pv, err := strconv.ParseInt(p, 10, 32)
+			if err != nil || pv < 0 {
+				errs = append(errs, "bad number of plies for openings")
+			} else {
+				settings.OpeningBook.MaxPlies = int(pv)
+			}
+		}
+		settings.OpeningBook.Dedup = req.FormValue("openings-dedup") == "true"
+		settings.OpeningBook.Pinned = req.FormValue("openings-pinned") == "true"
+		book, err := cfg.Scheduler.ResolveBook(ctx, settings.OpeningBook)
+		if err != nil {
+			if !errors.Is(err, scheduler.ErrNoSuchBook) {
+				log.Warn("could not resolve opening book", slogx.Err(err))
+			}
+			errs = append(errs, "bad opening book: "+err.Error())
+		} else if _, err := book.Book(randutil.DefaultSource()); err != nil {
+			errs = append(errs, "bad opening book: "+err.Error())
+		}
+	}
+	return errs
+}
@@ -0,0 +1,267 @@
+package webui
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/alex65536/day20/internal/rater"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/stat"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+)
+
+type eventPair struct {
+	First  string
+	Second string
+	Status stat.Status
+}
+
+// buildEventPairs sums up the results of all the matches between the same engines. In each pair,
+// First is lexicographically less than Second, and Status is from the point of view of First.
+func buildEventPairs(contests []scheduler.ContestFullData) []eventPair {
+	type key struct{ first, second string }
+	res := make(map[key]*eventPair)
+	var order []key
+	for _, c := range contests {
+		if c.Info.Kind != scheduler.ContestMatch || c.Data.Match == nil || len(c.Info.Players) != 2 {
+			continue
+		}
+		first, second := c.Info.Players[0].Name, c.Info.Players[1].Name
+		st := c.Data.Match.Status()
+		if first == second || st.Total() == 0 {
+			continue
+		}
+		if first > second {
+			first, second = second, first
+			st = st.Inv()
+		}
+		k := key{first: first, second: second}
+		p, ok := res[k]
+		if !ok {
+			p = &eventPair{First: first, Second: second}
+			res[k] = p
+			order = append(order, k)
+		}
+		p.Status = p.Status.Add(st)
+	}
+	pairs := make([]eventPair, 0, len(order))
+	for _, k := range order {
+		pairs = append(pairs, *res[k])
+	}
+	slices.SortFunc(pairs, func(a, b eventPair) int {
+		return cmp.Or(cmp.Compare(a.First, b.First), cmp.Compare(a.Second, b.Second))
+	})
+	return pairs
+}
+
+// eventContestPlayers describes the players of the contest in one line. The matches name both
+// players, while the tournaments are too large for that.
+func eventContestPlayers(info *scheduler.ContestInfo) string {
+	if info.Kind == scheduler.ContestMatch && len(info.Players) == 2 {
+		return fmt.Sprintf("%v vs %v", info.Players[0].Name, info.Players[1].Name)
+	}
+	return fmt.Sprintf("%v players", len(info.Players))
+}
+
+type eventDataBuilder struct{}
+
+func (eventDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	type contestItem struct {
+		ID       string
+		Name     string
+		Kind     scheduler.ContestKind
+		Players  string
+		Status   scheduler.ContestStatusKind
+		Progress *progressPartData
+		Result   string
+	}
+
+	type pairItem struct {
+		First   string
+		Second  string
+		Win     int
+		Draw    int
+		Lose    int
+		Score   string
+		LOS     float64
+		EloDiff stat.EloDiff
+	}
+
+	type ratingItem struct {
+		Rank   int
+		Engine string
+		Elo    string
+		Error  string
+		Games  int64
+	}
+
+	type data struct {
+		ID               string
+		Name             string
+		Description      string
+		CanStartContests bool
+		Contests         []contestItem
+		Pairs            []pairItem
+		Ratings          []ratingItem
+	}
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	event, err := cfg.Scheduler.GetEvent(ctx, req.PathValue("eventID"))
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchEvent) {
+			return nil, httputil.MakeError(http.StatusNotFound, "event not found")
+		}
+		log.Warn("could not get event", slogx.Err(err))
+		return nil, fmt.Errorf("get event: %w", err)
+	}
+	contests, err := cfg.Scheduler.ListEventContests(ctx, event.ID, bc.Viewer())
+	if err != nil {
+		log.Warn("could not list event contests", slogx.Err(err))
+		return nil, fmt.Errorf("list event contests: %w", err)
+	}
+	pairs := buildEventPairs(contests)
+	ratings := rater.ComputeRatings(sliceutil.Map(pairs, func(p eventPair) rater.PairResult {
+		return rater.PairResult{
+			First:  p.First,
+			Second: p.Second,
+			Win:    int64(p.Status.Win),
+			Draw:   int64(p.Status.Draw),
+			Lose:   int64(p.Status.Lose),
+		}
+	}), timeutil.NowUTC())
+
+	d := &data{
+		ID:               event.ID,
+		Name:             event.Name,
+		Description:      event.Description,
+		CanStartContests: bc.FullUser != nil && bc.FullUser.Perms.Get(userauth.PermRunContests),
+		Contests: sliceutil.Map(contests, func(c scheduler.ContestFullData) contestItem {
+			return contestItem{
+				ID:       c.Info.ID,
+				Name:     c.Info.Name,
+				Kind:     c.Info.Kind,
+				Players:  eventContestPlayers(&c.Info),
+				Status:   c.Data.Status.Kind,
+				Progress: buildProgressPartData(c.Info.Progress(&c.Data)),
+				Result:   contestResultString(&c.Info, &c.Data),
+			}
+		}),
+		Pairs: sliceutil.Map(pairs, func(p eventPair) pairItem {
+			return pairItem{
+				First:   p.First,
+				Second:  p.Second,
+				Win:     p.Status.Win,
+				Draw:    p.Status.Draw,
+				Lose:    p.Status.Lose,
+				Score:   p.Status.ScoreString(),
+				LOS:     p.Status.LOS(),
+				EloDiff: p.Status.EloDiff(0.95),
+			}
+		}),
+	}
+	for i, r := range ratings {
+		d.Ratings = append(d.Ratings, ratingItem{
+			Rank:   i + 1,
+			Engine: r.Engine,
+			Elo:    fmt.Sprintf("%+.1f", r.Elo),
+			Error:  fmt.Sprintf("%.1f", r.Error),
+			Games:  r.Games(),
+		})
+	}
+	return d, nil
+}
+
+func eventPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, eventDataBuilder{}, "event")
+}
+
+type eventPGNAttachImpl struct {
+	log *slog.Logger
+	cfg *Config
+}
+
+func (a *eventPGNAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle event pgn request",
+		slog.String("method", req.Method),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	if req.Method != http.MethodGet {
+		log.Warn("method not allowed")
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	eventID := req.PathValue("eventID")
+	if _, err := a.cfg.Scheduler.GetEvent(ctx, eventID); err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchEvent) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "event not found"))
+			return
+		}
+		log.Warn("could not get event", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	contests, err := a.cfg.Scheduler.ListEventContests(ctx, eventID, requestViewer(ctx, log, a.cfg, req))
+	if err != nil {
+		log.Warn("could not list event contests", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.chess-pgn")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"event_%v.pgn\"", eventID))
+	first := true
+	for _, c := range contests {
+		if c.Data.PGNPruned {
+			continue
+		}
+		jobs, err := a.cfg.Scheduler.ListContestSucceededJobs(ctx, c.Info.ID)
+		if err != nil {
+			log.Warn("could not list succeeded jobs", slog.String("contest_id", c.Info.ID), slogx.Err(err))
+			return
+		}
+		for _, job := range jobs {
+			if job.PGN == nil {
+				continue
+			}
+			if !first {
+				if _, err := io.WriteString(w, "\n"); err != nil {
+					log.Info("could not write response", slogx.Err(err))
+					return
+				}
+			}
+			first = false
+			if _, err := io.WriteString(w, *job.PGN); err != nil {
+				log.Info("could not write response", slogx.Err(err))
+				return
+			}
+		}
+	}
+}
+
+func eventPGNAttach(log *slog.Logger, cfg *Config) http.Handler {
+	return &eventPGNAttachImpl{
+		log: log,
+		cfg: cfg,
+	}
+}
@@ -0,0 +1,84 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/gorilla/csrf"
+)
+
+type eventsDataBuilder struct{}
+
+func (eventsDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	type item struct {
+		ID        string
+		Name      string
+		CreatedAt *humanTimePartData
+	}
+
+	type data struct {
+		CSRFField    template.HTML
+		CanAddEvents bool
+		NameMaxLen   int
+		Events       []item
+	}
+
+	canAddEvents := bc.FullUser != nil && bc.FullUser.Perms.Get(userauth.PermRunContests)
+
+	switch req.Method {
+	case http.MethodGet:
+		events, err := cfg.Scheduler.ListEvents(ctx)
+		if err != nil {
+			log.Warn("could not list events", slogx.Err(err))
+			return nil, fmt.Errorf("list events: %w", err)
+		}
+		now := time.Now()
+		return &data{
+			CSRFField:    csrf.TemplateField(req),
+			CanAddEvents: canAddEvents,
+			NameMaxLen:   scheduler.EventNameMaxLen,
+			Events: sliceutil.Map(events, func(e scheduler.Event) item {
+				return item{
+					ID:        e.ID,
+					Name:      e.Name,
+					CreatedAt: buildHumanTimePartData(now, e.CreatedAt.UTC()),
+				}
+			}),
+		}, nil
+	case http.MethodPost:
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		if !canAddEvents {
+			return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+		}
+		err := req.ParseForm()
+		if err != nil {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
+		}
+		event, err := cfg.Scheduler.CreateEvent(ctx, req.FormValue("name"), req.FormValue("description"))
+		if err != nil {
+			return &errorsPartData{Errors: []string{err.Error()}}, nil
+		}
+		return nil, bc.Redirect("/event/" + event.ID)
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func eventsPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, eventsDataBuilder{}, "events")
+}
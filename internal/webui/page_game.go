@@ -0,0 +1,173 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/go-chess/chess"
+)
+
+type gamePly struct {
+	FEN    string `json:"fen"`
+	Move   string `json:"move,omitempty"`
+	MoveNo string `json:"move_no,omitempty"`
+	Score  string `json:"score,omitempty"`
+}
+
+func buildGamePlies(g *battle.GameExt) ([]gamePly, error) {
+	b, err := chess.NewBoard(g.Game.StartPos())
+	if err != nil {
+		return nil, fmt.Errorf("bad start position: %w", err)
+	}
+	scores := g.WhiteScores()
+	plies := make([]gamePly, 0, g.Game.Len()+1)
+	plies = append(plies, gamePly{FEN: b.FEN()})
+	for i := range g.Game.Len() {
+		mv := g.Game.MoveAt(i)
+		moveNo := ""
+		if b.Side() == chess.ColorWhite {
+			moveNo = fmt.Sprintf("%v.", b.MoveNumber())
+		} else if i == 0 {
+			moveNo = fmt.Sprintf("%v...", b.MoveNumber())
+		}
+		styled, err := mv.Styled(b, chess.MoveStyleFancySAN)
+		if err != nil {
+			return nil, fmt.Errorf("style move %v: %w", i+1, err)
+		}
+		score := ""
+		if i < len(scores) {
+			if sc, ok := scores[i].TryGet(); ok {
+				score = sc.String()
+			}
+		}
+		if _, err := b.MakeMove(mv); err != nil {
+			return nil, fmt.Errorf("make move %v: %w", i+1, err)
+		}
+		plies = append(plies, gamePly{
+			FEN:    b.FEN(),
+			Move:   styled,
+			MoveNo: moveNo,
+			Score:  score,
+		})
+	}
+	return plies, nil
+}
+
+type gamePageData struct {
+	ContestID   string
+	ContestName string
+	JobID       string
+	Index       int64
+	// Status is set only for the jobs which did not succeed.
+	Status      *roomkeeper.JobStatus
+	White       string
+	Black       string
+	Result      string
+	Termination string
+	Plies       []gamePly
+	Eval        *evalGraphPartData
+	TimeChart   *timeChartPartData
+	PrevIndex   int64
+	NextIndex   int64
+	BoardTheme  string
+}
+
+func buildGamePageData(log *slog.Logger, info *scheduler.ContestInfo, job *scheduler.FinishedJob) (*gamePageData, error) {
+	if job.PGN == nil {
+		return nil, httputil.MakeError(http.StatusGone, "game was archived")
+	}
+	game, err := battle.GameExtFromPGN(*job.PGN)
+	if err != nil {
+		log.Warn("could not parse game pgn", slog.String("job_id", job.Job.ID), slogx.Err(err))
+		return nil, fmt.Errorf("parse pgn: %w", err)
+	}
+	plies, err := buildGamePlies(game)
+	if err != nil {
+		log.Warn("could not replay game", slog.String("job_id", job.Job.ID), slogx.Err(err))
+		return nil, fmt.Errorf("replay game: %w", err)
+	}
+
+	termination := ""
+	if job.Game != nil {
+		termination = gameVerdictName(job.Game.Verdict)
+	}
+	var status *roomkeeper.JobStatus
+	if job.Status.Kind != roomkeeper.JobSucceeded {
+		status = &job.Status
+	}
+
+	return &gamePageData{
+		ContestID:   info.ID,
+		ContestName: info.Name,
+		JobID:       job.Job.ID,
+		Index:       job.Index,
+		Status:      status,
+		White:       job.Job.White.Name,
+		Black:       job.Job.Black.Name,
+		Result:      job.GameResult.String(),
+		Termination: termination,
+		Plies:       plies,
+		Eval:        buildEvalGraphPartData(game.Game.StartPos().Side, game.Scores),
+		TimeChart:   buildTimeChartPartData(game),
+	}, nil
+}
+
+type gameDataBuilder struct{}
+
+func (gameDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	contestID := req.PathValue("contestID")
+	index, err := strconv.ParseInt(req.PathValue("index"), 10, 64)
+	if err != nil || index <= 0 {
+		return nil, httputil.MakeError(http.StatusNotFound, "game not found")
+	}
+	info, contestData, err := cfg.Scheduler.GetContest(ctx, contestID)
+	if err != nil {
+		log.Info("could not get contest", slogx.Err(err))
+		return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
+	}
+	if !bc.Viewer().CanView(&info) {
+		return nil, httputil.MakeError(http.StatusNotFound, "contest not found")
+	}
+	job, err := cfg.Scheduler.GetContestSucceededJob(ctx, contestID, index)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchJob) {
+			return nil, httputil.MakeError(http.StatusNotFound, "game not found")
+		}
+		log.Warn("could not get game", slogx.Err(err))
+		return nil, fmt.Errorf("get game: %w", err)
+	}
+
+	data, err := buildGamePageData(log, &info, &job)
+	if err != nil {
+		return nil, err
+	}
+	data.BoardTheme = boardThemeClass(bc.FullUser)
+	if index > 1 {
+		data.PrevIndex = index - 1
+	}
+	if index < contestData.LastIndex {
+		data.NextIndex = index + 1
+	}
+	return data, nil
+}
+
+func gamePage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, gameDataBuilder{}, "game")
+}
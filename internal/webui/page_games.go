@@ -0,0 +1,338 @@
+package webui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/util/maybe"
+)
+
+const gamesPageSize = 50
+
+type gameVerdictOption struct {
+	Value   string
+	Name    string
+	Verdict chess.Verdict
+}
+
+var gameVerdictOptions = []gameVerdictOption{
+	{Value: "checkmate", Name: "Checkmate", Verdict: chess.VerdictCheckmate},
+	{Value: "time-forfeit", Name: "Time forfeit", Verdict: chess.VerdictTimeForfeit},
+	{Value: "resign", Name: "Resign", Verdict: chess.VerdictResign},
+	{Value: "invalid-move", Name: "Invalid move", Verdict: chess.VerdictInvalidMove},
+	{Value: "engine-error", Name: "Engine error", Verdict: chess.VerdictEngineError},
+	{Value: "stalemate", Name: "Stalemate", Verdict: chess.VerdictStalemate},
+	{Value: "insufficient-material", Name: "Insufficient material", Verdict: chess.VerdictInsufficientMaterial},
+	{Value: "repeat3", Name: "Threefold repetition", Verdict: chess.VerdictRepeat3},
+	{Value: "repeat5", Name: "Fivefold repetition", Verdict: chess.VerdictRepeat5},
+	{Value: "moves50", Name: "50 move rule", Verdict: chess.VerdictMoves50},
+	{Value: "moves75", Name: "75 move rule", Verdict: chess.VerdictMoves75},
+	{Value: "draw-agreement", Name: "Draw agreement", Verdict: chess.VerdictDrawAgreement},
+}
+
+func gameVerdictName(v chess.Verdict) string {
+	for _, o := range gameVerdictOptions {
+		if o.Verdict == v {
+			return o.Name
+		}
+	}
+	return v.String()
+}
+
+type gamesQuery struct {
+	Engine       string
+	EngineResult string
+	ContestID    string
+	Result       string
+	Verdict      string
+	MinPlies     string
+	MaxPlies     string
+	Page         int
+}
+
+func (q *gamesQuery) Values(page int) url.Values {
+	v := make(url.Values)
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("engine", q.Engine)
+	set("engine-result", q.EngineResult)
+	set("contest", q.ContestID)
+	set("result", q.Result)
+	set("verdict", q.Verdict)
+	set("min-plies", q.MinPlies)
+	set("max-plies", q.MaxPlies)
+	if page != 1 {
+		v.Set("page", strconv.Itoa(page))
+	}
+	return v
+}
+
+func parseGamesQuery(v url.Values, pageSize int) (gamesQuery, scheduler.GameFilter, error) {
+	q := gamesQuery{
+		Engine:       v.Get("engine"),
+		EngineResult: v.Get("engine-result"),
+		ContestID:    v.Get("contest"),
+		Result:       v.Get("result"),
+		Verdict:      v.Get("verdict"),
+		MinPlies:     v.Get("min-plies"),
+		MaxPlies:     v.Get("max-plies"),
+		Page:         1,
+	}
+	f := scheduler.GameFilter{
+		ContestID: q.ContestID,
+		Engine:    q.Engine,
+	}
+
+	switch q.EngineResult {
+	case "":
+		f.EngineResult = scheduler.GameEngineAnyResult
+	case "win":
+		f.EngineResult = scheduler.GameEngineWin
+	case "draw":
+		f.EngineResult = scheduler.GameEngineDraw
+	case "loss":
+		f.EngineResult = scheduler.GameEngineLoss
+	default:
+		return gamesQuery{}, scheduler.GameFilter{}, fmt.Errorf("bad engine result")
+	}
+
+	if q.Result != "" {
+		status, err := chess.StatusFromString(q.Result)
+		if err != nil || !status.IsFinished() {
+			return gamesQuery{}, scheduler.GameFilter{}, fmt.Errorf("bad result")
+		}
+		f.Result = maybe.Some(status)
+	}
+
+	if q.Verdict != "" {
+		found := false
+		for _, o := range gameVerdictOptions {
+			if o.Value == q.Verdict {
+				f.Verdict = maybe.Some(o.Verdict)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return gamesQuery{}, scheduler.GameFilter{}, fmt.Errorf("bad verdict")
+		}
+	}
+
+	parsePlies := func(s string) (int64, error) {
+		if s == "" {
+			return 0, nil
+		}
+		p, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || p <= 0 {
+			return 0, fmt.Errorf("bad number of plies")
+		}
+		return p, nil
+	}
+	var err error
+	if f.MinPlies, err = parsePlies(q.MinPlies); err != nil {
+		return gamesQuery{}, scheduler.GameFilter{}, err
+	}
+	if f.MaxPlies, err = parsePlies(q.MaxPlies); err != nil {
+		return gamesQuery{}, scheduler.GameFilter{}, err
+	}
+
+	if s := v.Get("page"); s != "" {
+		page, err := strconv.Atoi(s)
+		if err != nil || page <= 0 {
+			return gamesQuery{}, scheduler.GameFilter{}, fmt.Errorf("bad page")
+		}
+		q.Page = page
+	}
+	f.Offset = (q.Page - 1) * pageSize
+	f.Limit = pageSize + 1
+
+	return q, f, nil
+}
+
+type gamesDataBuilder struct{}
+
+func (gamesDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	type item struct {
+		ContestID  string
+		Index      int64
+		White      string
+		Black      string
+		Result     string
+		Verdict    string
+		ECO        string
+		Plies      int64
+		FinishedAt *humanTimePartData
+	}
+
+	type data struct {
+		Query    gamesQuery
+		Verdicts []gameVerdictOption
+		Games    []item
+		PrevURL  string
+		NextURL  string
+	}
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	pageSize := userGamesPageSize(bc.FullUser)
+	q, filter, err := parseGamesQuery(req.URL.Query(), pageSize)
+	if err != nil {
+		return nil, httputil.MakeError(http.StatusBadRequest, err.Error())
+	}
+	filter.Viewer = bc.Viewer()
+	games, err := cfg.Scheduler.ListGames(ctx, filter)
+	if err != nil {
+		log.Warn("could not list games", slogx.Err(err))
+		return nil, fmt.Errorf("list games: %w", err)
+	}
+
+	hasNext := len(games) > pageSize
+	if hasNext {
+		games = games[:pageSize]
+	}
+	var prevURL, nextURL string
+	if q.Page > 1 {
+		prevURL = "/games?" + q.Values(q.Page-1).Encode()
+	}
+	if hasNext {
+		nextURL = "/games?" + q.Values(q.Page+1).Encode()
+	}
+
+	now := time.Now()
+	return &data{
+		Query:    q,
+		Verdicts: gameVerdictOptions,
+		Games: sliceutil.Map(games, func(g scheduler.Game) item {
+			return item{
+				ContestID:  g.ContestID,
+				Index:      g.Index,
+				White:      g.White,
+				Black:      g.Black,
+				Result:     g.Result.String(),
+				Verdict:    gameVerdictName(g.Verdict),
+				ECO:        g.ECO,
+				Plies:      g.Plies,
+				FinishedAt: buildHumanTimePartData(now, g.FinishedAt.UTC()),
+			}
+		}),
+		PrevURL: prevURL,
+		NextURL: nextURL,
+	}, nil
+}
+
+func gamesPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, gamesDataBuilder{}, "games")
+}
+
+type gamesAPIAttachImpl struct {
+	log *slog.Logger
+	cfg *Config
+}
+
+type gameJSON struct {
+	JobID      string    `json:"job_id"`
+	ContestID  string    `json:"contest_id"`
+	Index      int64     `json:"index"`
+	White      string    `json:"white"`
+	Black      string    `json:"black"`
+	Result     string    `json:"result"`
+	Verdict    string    `json:"verdict"`
+	StartFEN   *string   `json:"start_fen,omitempty"`
+	Opening    string    `json:"opening,omitempty"`
+	ECO        string    `json:"eco,omitempty"`
+	BookPlies  int64     `json:"book_plies"`
+	Plies      int64     `json:"plies"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+func (a *gamesAPIAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle games api request",
+		slog.String("method", req.Method),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	if req.Method != http.MethodGet {
+		log.Warn("method not allowed")
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	q, filter, err := parseGamesQuery(req.URL.Query(), gamesPageSize)
+	if err != nil {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	filter.Viewer = requestViewer(ctx, log, a.cfg, req)
+	games, err := a.cfg.Scheduler.ListGames(ctx, filter)
+	if err != nil {
+		log.Warn("could not list games", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	hasNext := len(games) > gamesPageSize
+	if hasNext {
+		games = games[:gamesPageSize]
+	}
+
+	resp := struct {
+		Page    int        `json:"page"`
+		HasNext bool       `json:"has_next"`
+		Games   []gameJSON `json:"games"`
+	}{
+		Page:    q.Page,
+		HasNext: hasNext,
+		Games: sliceutil.Map(games, func(g scheduler.Game) gameJSON {
+			return gameJSON{
+				JobID:      g.JobID,
+				ContestID:  g.ContestID,
+				Index:      g.Index,
+				White:      g.White,
+				Black:      g.Black,
+				Result:     g.Result.String(),
+				Verdict:    g.Verdict.String(),
+				StartFEN:   g.StartFEN,
+				Opening:    g.Opening,
+				ECO:        g.ECO,
+				BookPlies:  g.BookPlies,
+				Plies:      g.Plies,
+				StartedAt:  g.StartedAt.UTC(),
+				FinishedAt: g.FinishedAt.UTC(),
+			}
+		}),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		log.Info("could not write response", slogx.Err(err))
+	}
+}
+
+func gamesAPIAttach(log *slog.Logger, cfg *Config) http.Handler {
+	return &gamesAPIAttachImpl{
+		log: log,
+		cfg: cfg,
+	}
+}
@@ -28,6 +28,7 @@ func (inviteDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 		InviteVal string
 		Errors    []string
 		CSRFField template.HTML
+		Providers []externalProviderPartData
 	}
 
 	if bc.UserInfo != nil {
@@ -48,6 +49,7 @@ func (inviteDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 			InviteVal: inviteVal,
 			Errors:    nil,
 			CSRFField: csrf.TemplateField(req),
+			Providers: buildExternalProviders(cfg),
 		}, nil
 	case http.MethodPost:
 		if !bc.IsHTMX() {
@@ -99,7 +101,7 @@ func (inviteDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 				Errors: errs,
 			}, nil
 		}
-		bc.ResetSession(makeUserInfo(&user))
+		bc.LogIn(ctx, &user)
 		return nil, bc.Redirect("/")
 	default:
 		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
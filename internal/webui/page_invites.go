@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	"net/http"
 	"slices"
+	"strconv"
 	"time"
 
 	"github.com/alex65536/day20/internal/userauth"
@@ -19,6 +20,36 @@ import (
 	"github.com/gorilla/csrf"
 )
 
+type inviteExpiryChoice struct {
+	Value  string
+	Pretty string
+}
+
+var inviteExpiryChoices = []struct {
+	d      time.Duration
+	pretty string
+}{
+	{1 * time.Hour, "1 hour"},
+	{12 * time.Hour, "12 hours"},
+	{24 * time.Hour, "1 day"},
+	{7 * 24 * time.Hour, "1 week"},
+	{30 * 24 * time.Hour, "30 days"},
+}
+
+func buildInviteExpiryChoices(maxExpiry time.Duration) []inviteExpiryChoice {
+	var res []inviteExpiryChoice
+	for _, c := range inviteExpiryChoices {
+		if c.d > maxExpiry {
+			break
+		}
+		res = append(res, inviteExpiryChoice{
+			Value:  c.d.String(),
+			Pretty: c.pretty,
+		})
+	}
+	return res
+}
+
 type invitesDataBuilder struct{}
 
 func (invitesDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
@@ -33,13 +64,16 @@ func (invitesDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 		Link      string
 		Perms     *permsData
 		ExpiresAt *humanTimePartData
+		UsesLeft  int
 		Hash      string
 	}
 
 	type data struct {
-		CSRFField template.HTML
-		Perms     *permsData
-		Invites   []item
+		CSRFField     template.HTML
+		Perms         *permsData
+		ExpiryChoices []inviteExpiryChoice
+		MaxUses       int
+		Invites       []item
 	}
 
 	if bc.FullUser == nil {
@@ -62,6 +96,7 @@ func (invitesDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 				Link:      cfg.UserManager.InviteLinkURL(l),
 				Perms:     buildPermsData(l.Perms),
 				ExpiresAt: buildHumanTimePartData(now, l.ExpiresAt.UTC()),
+				UsesLeft:  l.UsesLeft,
 				Hash:      l.Hash,
 			})
 		}
@@ -73,9 +108,11 @@ func (invitesDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 		})
 
 		return &data{
-			CSRFField: csrf.TemplateField(req),
-			Perms:     buildPermsData(bc.FullUser.Perms),
-			Invites:   invites,
+			CSRFField:     csrf.TemplateField(req),
+			Perms:         buildPermsData(bc.FullUser.Perms),
+			ExpiryChoices: buildInviteExpiryChoices(cfg.UserManager.InviteMaxExpiry()),
+			MaxUses:       cfg.UserManager.InviteMaxUses(),
+			Invites:       invites,
 		}, nil
 	case http.MethodPost:
 		if !bc.IsHTMX() {
@@ -99,7 +136,22 @@ func (invitesDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error)
 					*perms.GetMut(p) = true
 				}
 			}
-			_, err := cfg.UserManager.GenerateInviteLink(ctx, label, bc.FullUser, perms)
+			var lo userauth.InviteLinkOptions
+			if s := req.FormValue("invite-expiry"); s != "" {
+				lo.Expiry, err = time.ParseDuration(s)
+				if err != nil || lo.Expiry <= 0 || lo.Expiry > cfg.UserManager.InviteMaxExpiry() {
+					return &errorsPartData{Errors: []string{"bad expiry"}}, nil
+				}
+			}
+			if s := req.FormValue("invite-uses"); s != "" {
+				lo.MaxUses, err = strconv.Atoi(s)
+				if err != nil || lo.MaxUses <= 0 || lo.MaxUses > cfg.UserManager.InviteMaxUses() {
+					return &errorsPartData{Errors: []string{
+						fmt.Sprintf("number of uses must be between 1 and %v", cfg.UserManager.InviteMaxUses()),
+					}}, nil
+				}
+			}
+			_, err := cfg.UserManager.GenerateInviteLink(ctx, label, bc.FullUser, perms, lo)
 			if err != nil {
 				var verifyErr *userauth.ErrorInviteLinkVerify
 				if errors.As(err, &verifyErr) {
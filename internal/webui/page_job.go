@@ -0,0 +1,70 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type jobDataBuilder struct{}
+
+func (jobDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	jobID := req.PathValue("jobID")
+	if running, ok := cfg.Scheduler.GetRunningJob(jobID); ok {
+		info, _, err := cfg.Scheduler.GetContest(ctx, running.ContestID)
+		if err != nil || !bc.Viewer().CanView(&info) {
+			return nil, httputil.MakeError(http.StatusNotFound, "job not found")
+		}
+		for _, room := range cfg.Keeper.ListRooms() {
+			if id, ok := room.JobID.TryGet(); ok && id == jobID {
+				return nil, bc.Redirect("/room/" + room.Info.ID)
+			}
+		}
+		return nil, bc.Redirect("/contest/" + info.ID)
+	}
+
+	job, err := cfg.Scheduler.GetFinishedJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchJob) {
+			return nil, httputil.MakeError(http.StatusNotFound, "job not found")
+		}
+		log.Warn("could not get job", slogx.Err(err))
+		return nil, fmt.Errorf("get job: %w", err)
+	}
+	info, _, err := cfg.Scheduler.GetContest(ctx, job.ContestID)
+	if err != nil {
+		log.Info("could not get contest", slogx.Err(err))
+		return nil, httputil.MakeError(http.StatusNotFound, "job not found")
+	}
+	if !bc.Viewer().CanView(&info) {
+		return nil, httputil.MakeError(http.StatusNotFound, "job not found")
+	}
+	if job.Status.Kind == roomkeeper.JobSucceeded && job.Index > 0 {
+		return nil, bc.Redirect(fmt.Sprintf("/contest/%v/game/%v", info.ID, job.Index))
+	}
+	data, err := buildGamePageData(log, &info, &job)
+	if err != nil {
+		return nil, err
+	}
+	data.BoardTheme = boardThemeClass(bc.FullUser)
+	return data, nil
+}
+
+func jobPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, jobDataBuilder{}, "game")
+}
@@ -0,0 +1,184 @@
+package webui
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+const failedJobsPageSize = 50
+
+type failedJobsDataBuilder struct{}
+
+func (failedJobsDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	type jobItem struct {
+		ID          string
+		ContestID   string
+		ContestName string
+		White       string
+		Black       string
+		WhiteEngine string
+		BlackEngine string
+		Status      roomkeeper.JobStatus
+		HasPGN      bool
+		RoomID      string
+		StartedAt   *humanTimePartData
+		Duration    time.Duration
+	}
+
+	type roomItem struct {
+		RoomID string
+		Count  int
+	}
+
+	type data struct {
+		RoomID  string
+		Jobs    []jobItem
+		Rooms   []roomItem
+		PrevURL string
+		NextURL string
+	}
+
+	if bc.FullUser == nil {
+		return nil, httputil.MakeError(http.StatusForbidden, "not logged in")
+	}
+	if !bc.FullUser.Perms.Get(userauth.PermHostRooms) {
+		return nil, httputil.MakeError(http.StatusForbidden, "viewing failed jobs not allowed")
+	}
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	query := req.URL.Query()
+	roomID := query.Get("room")
+	page := 1
+	if s := query.Get("page"); s != "" {
+		var err error
+		page, err = strconv.Atoi(s)
+		if err != nil || page <= 0 {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad page")
+		}
+	}
+	jobs, err := cfg.Scheduler.ListFailedJobs(ctx, roomID, (page-1)*failedJobsPageSize, failedJobsPageSize+1)
+	if err != nil {
+		log.Warn("could not list failed jobs", slogx.Err(err))
+		return nil, fmt.Errorf("list failed jobs: %w", err)
+	}
+	pageURL := func(page int) string {
+		v := make(url.Values)
+		if roomID != "" {
+			v.Set("room", roomID)
+		}
+		if page != 1 {
+			v.Set("page", strconv.Itoa(page))
+		}
+		if len(v) == 0 {
+			return "/jobs/failed"
+		}
+		return "/jobs/failed?" + v.Encode()
+	}
+	var prevURL, nextURL string
+	if page > 1 {
+		prevURL = pageURL(page - 1)
+	}
+	if len(jobs) > failedJobsPageSize {
+		jobs = jobs[:failedJobsPageSize]
+		nextURL = pageURL(page + 1)
+	}
+
+	// The page may contain jobs from the contests which the user cannot see. Such jobs are skipped.
+	viewer := bc.Viewer()
+	contestNames := make(map[string]string)
+	contestVisible := make(map[string]bool)
+	checkContest := func(contestID string) (bool, error) {
+		if ok, found := contestVisible[contestID]; found {
+			return ok, nil
+		}
+		info, _, err := cfg.Scheduler.GetContest(ctx, contestID)
+		if err != nil && !errors.Is(err, scheduler.ErrNoSuchContest) {
+			return false, err
+		}
+		ok := err == nil && viewer.CanView(&info)
+		contestVisible[contestID] = ok
+		if ok {
+			contestNames[contestID] = info.Name
+		}
+		return ok, nil
+	}
+
+	now := time.Now()
+	items := make([]jobItem, 0, len(jobs))
+	roomCounts := make(map[string]int)
+	for _, j := range jobs {
+		ok, err := checkContest(j.ContestID)
+		if err != nil {
+			log.Warn("could not get contest", slogx.Err(err))
+			return nil, fmt.Errorf("get contest: %w", err)
+		}
+		if !ok {
+			continue
+		}
+		item := jobItem{
+			ID:          j.Job.ID,
+			ContestID:   j.ContestID,
+			ContestName: contestNames[j.ContestID],
+			White:       j.Job.White.Name,
+			Black:       j.Job.Black.Name,
+			WhiteEngine: j.WhiteEngine,
+			BlackEngine: j.BlackEngine,
+			Status:      j.Status,
+			HasPGN:      j.PGN != nil,
+			RoomID:      j.RoomID,
+			Duration:    j.Duration.Round(time.Second),
+		}
+		if j.StartedAt != nil {
+			item.StartedAt = buildHumanTimePartData(now, j.StartedAt.UTC())
+		}
+		items = append(items, item)
+		if j.RoomID != "" {
+			roomCounts[j.RoomID]++
+		}
+	}
+
+	var rooms []roomItem
+	if roomID == "" {
+		for id, count := range roomCounts {
+			rooms = append(rooms, roomItem{RoomID: id, Count: count})
+		}
+		slices.SortFunc(rooms, func(a, b roomItem) int {
+			return cmp.Or(
+				cmp.Compare(b.Count, a.Count),
+				cmp.Compare(a.RoomID, b.RoomID),
+			)
+		})
+	}
+
+	return &data{
+		RoomID:  roomID,
+		Jobs:    items,
+		Rooms:   rooms,
+		PrevURL: prevURL,
+		NextURL: nextURL,
+	}, nil
+}
+
+func failedJobsPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, failedJobsDataBuilder{}, "jobs_failed")
+}
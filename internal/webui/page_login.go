@@ -3,8 +3,10 @@ package webui
 import (
 	"context"
 	"errors"
+	"fmt"
 	"html/template"
 	"log/slog"
+	"math"
 	"net/http"
 
 	"github.com/alex65536/day20/internal/userauth"
@@ -21,7 +23,9 @@ func (loginDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 	log := bc.Log
 
 	type data struct {
-		CSRFField template.HTML
+		CSRFField        template.HTML
+		CanResetPassword bool
+		Providers        []externalProviderPartData
 	}
 
 	if bc.UserInfo != nil {
@@ -31,7 +35,9 @@ func (loginDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 	switch req.Method {
 	case http.MethodGet:
 		return &data{
-			CSRFField: csrf.TemplateField(req),
+			CSRFField:        csrf.TemplateField(req),
+			CanResetPassword: cfg.UserManager.CanSendMail(),
+			Providers:        buildExternalProviders(cfg),
 		}, nil
 	case http.MethodPost:
 		if !bc.IsHTMX() {
@@ -41,8 +47,20 @@ func (loginDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 		if err != nil {
 			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
 		}
+		username, password := req.FormValue("username"), req.FormValue("password")
+		ip := remoteIP(req)
+		audit := cfg.AuditLog.With(
+			slog.String("username", username),
+			slog.String("ip", ip),
+			slog.String("user_agent", req.UserAgent()),
+		)
+		if retry := cfg.LoginThrottler.Check(ip, username); retry > 0 {
+			audit.Warn("login rejected by throttler")
+			return &errorsPartData{Errors: []string{
+				fmt.Sprintf("too many failed attempts, try again in %v min", int(math.Ceil(retry.Minutes()))),
+			}}, nil
+		}
 		user, strErr := func() (userauth.User, string) {
-			username, password := req.FormValue("username"), req.FormValue("password")
 			user, err := cfg.UserManager.GetUserByUsername(ctx, username)
 			if err != nil {
 				if errors.Is(err, userauth.ErrUserNotFound) {
@@ -60,9 +78,17 @@ func (loginDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 			return user, ""
 		}()
 		if strErr != "" {
+			if strErr != "internal server error" {
+				audit.Warn("login failed", slog.String("reason", strErr))
+				if cfg.LoginThrottler.OnFailure(ip, username) {
+					audit.Warn("login locked out after too many failures")
+				}
+			}
 			return &errorsPartData{Errors: []string{strErr}}, nil
 		}
-		bc.ResetSession(makeUserInfo(&user))
+		cfg.LoginThrottler.OnSuccess(ip, username)
+		audit.Info("login succeeded")
+		bc.LogIn(ctx, &user)
 		return nil, bc.Redirect("/")
 	default:
 		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
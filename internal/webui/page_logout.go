@@ -8,8 +8,8 @@ import (
 
 type logoutDataBuilder struct{}
 
-func (logoutDataBuilder) Build(_ context.Context, bc builderCtx) (any, error) {
-	bc.ResetSession(nil)
+func (logoutDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	bc.LogOut(ctx)
 	return nil, bc.Redirect("/")
 }
 
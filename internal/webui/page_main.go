@@ -2,35 +2,114 @@ package webui
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
 	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
 )
 
 type mainDataBuilder struct{}
 
-func (mainDataBuilder) Build(_ context.Context, bc builderCtx) (any, error) {
+func (mainDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 	cfg := bc.Config
+	viewer := bc.Viewer()
 
-	type item struct {
-		ID     string
-		Name   string
-		Active bool
+	type roomItem struct {
+		ID          string
+		Name        string
+		Active      bool
+		White       string
+		Black       string
+		ContestID   string
+		ContestName string
+		Version     string
+		Outdated    bool
+		Hardware    string
+	}
+
+	type contestItem struct {
+		ID       string
+		Name     string
+		Progress *progressPartData
+		Result   string
 	}
 
 	type data struct {
-		Rooms []item
+		Rooms    []roomItem
+		Contests []contestItem
+	}
+
+	contests := cfg.Scheduler.ListRunningContests(viewer)
+	slices.SortFunc(contests, func(a, b scheduler.ContestFullData) int {
+		return strings.Compare(b.Info.ID, a.Info.ID)
+	})
+	contestNames := make(map[string]string, len(contests))
+	for _, c := range contests {
+		contestNames[c.Info.ID] = c.Info.Name
 	}
 
 	d := &data{}
-	d.Rooms = sliceutil.Map(cfg.Keeper.ListRooms(), func(s roomkeeper.RoomState) item {
-		return item{ID: s.Info.ID, Name: s.Info.Name, Active: s.JobID.IsSome()}
+	d.Rooms = sliceutil.Map(cfg.Keeper.ListRooms(), func(s roomkeeper.RoomState) roomItem {
+		item := roomItem{
+			ID:       s.Info.ID,
+			Name:     s.Info.Name,
+			Version:  s.Info.ClientVersion,
+			Outdated: cfg.Keeper.ClientOutdated(s.Info.ClientVersion),
+			Hardware: roomHardwareString(s.Info),
+		}
+		jobID, ok := s.JobID.TryGet()
+		if !ok {
+			return item
+		}
+		item.Active = true
+		job, ok := cfg.Scheduler.GetRunningJob(jobID)
+		if !ok {
+			return item
+		}
+		canView, err := canViewRunningJob(ctx, cfg, viewer, jobID)
+		if err != nil {
+			bc.Log.Warn("could not check job visibility", slogx.Err(err))
+			return item
+		}
+		if canView {
+			item.White = job.Job.White.Name
+			item.Black = job.Job.Black.Name
+			item.ContestID = job.ContestID
+			item.ContestName = contestNames[job.ContestID]
+		}
+		return item
+	})
+	d.Contests = sliceutil.Map(contests, func(c scheduler.ContestFullData) contestItem {
+		return contestItem{
+			ID:       c.Info.ID,
+			Name:     c.Info.Name,
+			Progress: buildProgressPartData(c.Info.Progress(&c.Data)),
+			Result:   contestResultString(&c.Info, &c.Data),
+		}
 	})
 	return d, nil
 }
 
+func roomHardwareString(info roomkeeper.RoomInfo) string {
+	var parts []string
+	if info.Cores > 0 {
+		parts = append(parts, fmt.Sprintf("%v cores", info.Cores))
+	}
+	if info.NPS > 0 {
+		parts = append(parts, fmt.Sprintf("%v knps", info.NPS/1000))
+	}
+	if info.TimeScale > 0 {
+		parts = append(parts, fmt.Sprintf("time x%.2f", info.TimeScale))
+	}
+	return strings.Join(parts, ", ")
+}
+
 func mainPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
-	return newPage(log, cfg, pageOptions{}, templ, mainDataBuilder{}, "main")
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, mainDataBuilder{}, "main")
 }
@@ -0,0 +1,358 @@
+package webui
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"github.com/alex65536/day20/internal/extauth"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/clone"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/idgen"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+	"github.com/gorilla/csrf"
+)
+
+// oauthState is kept in the session between the redirect to the provider and the callback.
+type oauthState struct {
+	Provider   string
+	State      string
+	Verifier   string
+	Invite     string
+	LinkUserID string
+}
+
+// oauthPending is kept in the session until the user picks a username for the new account.
+type oauthPending struct {
+	Provider string
+	Subject  string
+	Username string
+	Invite   string
+}
+
+type externalProviderPartData struct {
+	Name  string
+	Title string
+}
+
+func buildExternalProviders(cfg *Config) []externalProviderPartData {
+	res := make([]externalProviderPartData, 0, len(cfg.ExternalAuth))
+	for _, p := range cfg.ExternalAuth {
+		res = append(res, externalProviderPartData{
+			Name:  p.Name(),
+			Title: p.Title(),
+		})
+	}
+	return res
+}
+
+func findExternalProvider(cfg *Config, name string) *extauth.Provider {
+	for _, p := range cfg.ExternalAuth {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (bc *builderCtx) saveSessionValue(key string, value any) {
+	session, _ := bc.Config.sessionStore.Get(bc.Req, sessionName)
+	if value == nil {
+		delete(session.Values, key)
+	} else {
+		session.Values[key] = value
+	}
+	if err := session.Save(bc.Req, bc.writer); err != nil {
+		bc.Log.Error("could not save session", slogx.Err(err))
+	}
+}
+
+func (bc *builderCtx) sessionValue(key string) any {
+	session, _ := bc.Config.sessionStore.Get(bc.Req, sessionName)
+	return session.Values[key]
+}
+
+type externalAccountItem struct {
+	Name   string
+	Title  string
+	Linked bool
+}
+
+func buildExternalAccountItems(ctx context.Context, cfg *Config, userID string) ([]externalAccountItem, error) {
+	accounts, err := cfg.UserManager.ListUserExternalAccounts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	linked := make(map[string]struct{}, len(accounts))
+	for _, a := range accounts {
+		linked[a.Provider] = struct{}{}
+	}
+	res := make([]externalAccountItem, 0, len(cfg.ExternalAuth))
+	for _, p := range cfg.ExternalAuth {
+		_, ok := linked[p.Name()]
+		res = append(res, externalAccountItem{
+			Name:   p.Name(),
+			Title:  p.Title(),
+			Linked: ok,
+		})
+	}
+	return res, nil
+}
+
+var errLastLoginMethod = errors.New("cannot unlink the only way to log in, set a password first")
+
+func unlinkExternalAccount(ctx context.Context, cfg *Config, user *userauth.User, provider string) error {
+	if len(user.PasswordHash) == 0 {
+		accounts, err := cfg.UserManager.ListUserExternalAccounts(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("list accounts: %w", err)
+		}
+		if len(accounts) <= 1 {
+			return errLastLoginMethod
+		}
+	}
+	return cfg.UserManager.DeleteExternalAccount(ctx, provider, user.ID)
+}
+
+type oauthLoginDataBuilder struct{}
+
+func (oauthLoginDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	provider := findExternalProvider(cfg, req.PathValue("provider"))
+	if provider == nil {
+		return nil, httputil.MakeError(http.StatusNotFound, "provider not found")
+	}
+
+	state := oauthState{
+		Provider: provider.Name(),
+		State:    extauth.NewSecret(),
+		Verifier: extauth.NewSecret(),
+	}
+	if bc.IsImpersonating() {
+		return nil, httputil.MakeError(http.StatusForbidden, "not allowed while impersonating")
+	}
+	if bc.UserInfo != nil {
+		state.LinkUserID = bc.UserInfo.ID
+	} else {
+		state.Invite = req.URL.Query().Get("invite")
+	}
+	target, err := provider.AuthCodeURL(ctx, state.State, state.Verifier)
+	if err != nil {
+		log.Warn("could not build auth url", slogx.Err(err))
+		return nil, httputil.MakeError(http.StatusBadGateway, "identity provider is unavailable")
+	}
+	// The registration left unfinished must not be picked up after the new login.
+	bc.saveSessionValue("oauth-pending", nil)
+	bc.saveSessionValue("oauth", state)
+	return nil, httputil.MakeRedirectError(http.StatusFound, "redirect", target)
+}
+
+func oauthLoginPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{}, templ, oauthLoginDataBuilder{}, "")
+}
+
+type oauthCallbackDataBuilder struct{}
+
+func (oauthCallbackDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	provider := findExternalProvider(cfg, req.PathValue("provider"))
+	if provider == nil {
+		return nil, httputil.MakeError(http.StatusNotFound, "provider not found")
+	}
+
+	state, ok := bc.sessionValue("oauth").(oauthState)
+	if !ok {
+		return nil, httputil.MakeError(http.StatusBadRequest, "no login in progress")
+	}
+	bc.saveSessionValue("oauth", nil)
+	query := req.URL.Query()
+	if state.Provider != provider.Name() ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) == 0 {
+		return nil, httputil.MakeError(http.StatusBadRequest, "state mismatch")
+	}
+	if e := query.Get("error"); e != "" {
+		return nil, httputil.MakeError(http.StatusForbidden, "identity provider denied login: "+e)
+	}
+	ident, err := provider.Identify(ctx, query.Get("code"), state.Verifier)
+	if err != nil {
+		log.Warn("could not identify user", slogx.Err(err))
+		return nil, httputil.MakeError(http.StatusBadGateway, "could not get identity from provider")
+	}
+
+	ip := remoteIP(req)
+	audit := cfg.AuditLog.With(
+		slog.String("provider", provider.Name()),
+		slog.String("subject", ident.Subject),
+		slog.String("ip", ip),
+		slog.String("user_agent", req.UserAgent()),
+	)
+
+	if state.LinkUserID != "" {
+		if bc.UserInfo == nil || bc.UserInfo.ID != state.LinkUserID {
+			return nil, httputil.MakeError(http.StatusBadRequest, "user changed during login")
+		}
+		err := cfg.UserManager.CreateExternalAccount(ctx, userauth.ExternalAccount{
+			Provider:  provider.Name(),
+			Subject:   ident.Subject,
+			UserID:    bc.UserInfo.ID,
+			CreatedAt: timeutil.NowUTC(),
+		})
+		if err != nil {
+			if errors.Is(err, userauth.ErrExternalTaken) {
+				return nil, httputil.MakeError(http.StatusConflict, "account is already linked")
+			}
+			log.Warn("could not link external account", slogx.Err(err))
+			return nil, fmt.Errorf("link external account: %w", err)
+		}
+		audit.Info("external account linked", slog.String("username", bc.UserInfo.Username))
+		return nil, bc.Redirect("/user/" + bc.UserInfo.Username)
+	}
+
+	acc, err := cfg.UserManager.GetExternalAccount(ctx, provider.Name(), ident.Subject)
+	if err != nil {
+		if !errors.Is(err, userauth.ErrExternalNotFound) {
+			log.Warn("could not get external account", slogx.Err(err))
+			return nil, fmt.Errorf("get external account: %w", err)
+		}
+		if state.Invite == "" {
+			audit.Warn("login failed", slog.String("reason", "no linked account"))
+			return nil, httputil.MakeError(http.StatusForbidden, "no user is linked to this account")
+		}
+		bc.saveSessionValue("oauth-pending", oauthPending{
+			Provider: provider.Name(),
+			Subject:  ident.Subject,
+			Username: ident.Username,
+			Invite:   state.Invite,
+		})
+		return nil, bc.Redirect("/oauth/register")
+	}
+	user, err := cfg.UserManager.GetUser(ctx, acc.UserID)
+	if err != nil {
+		log.Warn("could not get user", slogx.Err(err))
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	audit = audit.With(slog.String("username", user.Username))
+	if user.Perms.IsBlocked {
+		audit.Warn("login failed", slog.String("reason", "user is blocked"))
+		return nil, httputil.MakeError(http.StatusForbidden, "user is blocked")
+	}
+	audit.Info("login succeeded")
+	bc.saveSessionValue("oauth-pending", nil)
+	bc.LogIn(ctx, &user)
+	return nil, bc.Redirect("/")
+}
+
+func oauthCallbackPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{}, templ, oauthCallbackDataBuilder{}, "")
+}
+
+type oauthRegisterDataBuilder struct{}
+
+func (oauthRegisterDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	type data struct {
+		CSRFField template.HTML
+		Provider  string
+		Username  string
+	}
+
+	if bc.UserInfo != nil {
+		return nil, httputil.MakeError(http.StatusBadRequest, "already logged in")
+	}
+	pending, ok := bc.sessionValue("oauth-pending").(oauthPending)
+	if !ok {
+		return nil, httputil.MakeError(http.StatusBadRequest, "no registration in progress")
+	}
+	provider := findExternalProvider(cfg, pending.Provider)
+	if provider == nil {
+		return nil, httputil.MakeError(http.StatusNotFound, "provider not found")
+	}
+	lnk, err := cfg.UserManager.GetInviteLink(ctx, userauth.HashInviteValue(pending.Invite), timeutil.NowUTC())
+	if err != nil || subtle.ConstantTimeCompare([]byte(lnk.Value), []byte(pending.Invite)) == 0 {
+		log.Info("could not get invite link", slogx.Err(err))
+		bc.saveSessionValue("oauth-pending", nil)
+		return nil, httputil.MakeError(http.StatusNotFound, "invite link not found")
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		return &data{
+			CSRFField: csrf.TemplateField(req),
+			Provider:  provider.Title(),
+			Username:  pending.Username,
+		}, nil
+	case http.MethodPost:
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		err := req.ParseForm()
+		if err != nil {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
+		}
+		username := req.FormValue("username")
+		if err := userauth.ValidateUsername(username); err != nil {
+			return &errorsPartData{Errors: []string{err.Error()}}, nil
+		}
+		user := userauth.User{
+			ID:        idgen.ID(),
+			Username:  username,
+			InviterID: clone.TrivialPtr(lnk.OwnerUserID),
+			Perms:     lnk.Perms,
+			ExternalAccounts: []userauth.ExternalAccount{{
+				Provider:  pending.Provider,
+				Subject:   pending.Subject,
+				CreatedAt: timeutil.NowUTC(),
+			}},
+		}
+		if err := cfg.UserManager.CreateUser(ctx, user, lnk); err != nil {
+			switch {
+			case errors.Is(err, userauth.ErrInviteLinkUsed):
+				bc.saveSessionValue("oauth-pending", nil)
+				return &errorsPartData{Errors: []string{"invite link already used"}}, nil
+			case errors.Is(err, userauth.ErrUserAlreadyExists):
+				return &errorsPartData{Errors: []string{"given username is already taken"}}, nil
+			case errors.Is(err, userauth.ErrExternalTaken):
+				return &errorsPartData{Errors: []string{"account is already linked to another user"}}, nil
+			}
+			log.Warn("could not create user in db", slogx.Err(err))
+			return &errorsPartData{Errors: []string{"internal server error"}}, nil
+		}
+		cfg.AuditLog.Info("user registered via external account",
+			slog.String("provider", pending.Provider),
+			slog.String("subject", pending.Subject),
+			slog.String("username", username),
+			slog.String("ip", remoteIP(req)),
+		)
+		// The registration is done, so it cannot be repeated with the same external account.
+		bc.saveSessionValue("oauth-pending", nil)
+		bc.LogIn(ctx, &user)
+		return nil, bc.Redirect("/")
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func oauthRegisterPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{}, templ, oauthRegisterDataBuilder{}, "oauth_register")
+}
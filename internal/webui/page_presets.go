@@ -0,0 +1,211 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/gorilla/csrf"
+)
+
+type presetsDataBuilder struct{}
+
+func (presetsDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	type item struct {
+		ID             string
+		Name           string
+		FixedTime      *time.Duration
+		TimeControl    string
+		Book           string
+		ScoreThreshold int32
+		Games          int64
+		CanDelete      bool
+	}
+
+	type bookItem struct {
+		ID        string
+		Name      string
+		Positions int
+	}
+
+	type data struct {
+		CSRFField     template.HTML
+		CanAddPresets bool
+		NameMaxLen    int
+		MaxUploadSize int64
+		Books         []bookItem
+		Presets       []item
+	}
+
+	user := bc.FullUser
+	canAddPresets := user != nil && user.Perms.Get(userauth.PermRunContests)
+	canDelete := func(p *scheduler.ContestPreset) bool {
+		return canAddPresets && (user.Perms.Get(userauth.PermAdmin) || p.OwnerID == user.ID)
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		presets, err := cfg.Scheduler.ListContestPresets(ctx)
+		if err != nil {
+			log.Warn("could not list presets", slogx.Err(err))
+			return nil, fmt.Errorf("list presets: %w", err)
+		}
+		books, err := cfg.Scheduler.ListStoredBooks(ctx)
+		if err != nil {
+			log.Warn("could not list books", slogx.Err(err))
+			return nil, fmt.Errorf("list books: %w", err)
+		}
+		bookNames := make(map[string]string, len(books))
+		for _, b := range books {
+			bookNames[b.ID] = b.Name
+		}
+		return &data{
+			CSRFField:     csrf.TemplateField(req),
+			CanAddPresets: canAddPresets,
+			NameMaxLen:    scheduler.ContestPresetNameMaxLen,
+			MaxUploadSize: cfg.opts.MaxUploadSize,
+			Books: sliceutil.Map(books, func(b scheduler.StoredBook) bookItem {
+				return bookItem{
+					ID:        b.ID,
+					Name:      b.Name,
+					Positions: b.Positions,
+				}
+			}),
+			Presets: sliceutil.Map(presets, func(p scheduler.ContestPreset) item {
+				timeControl := ""
+				if p.TimeControl != nil {
+					timeControl = p.TimeControl.String()
+				}
+				return item{
+					ID:             p.ID,
+					Name:           p.Name,
+					FixedTime:      p.FixedTime,
+					TimeControl:    timeControl,
+					Book:           presetBookName(&p.OpeningBook, bookNames),
+					ScoreThreshold: p.ScoreThreshold,
+					Games:          p.Games,
+					CanDelete:      canDelete(&p),
+				}
+			}),
+		}, nil
+	case http.MethodPost:
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		if !canAddPresets {
+			return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+		}
+		if err := parseUploadForm(req); err != nil {
+			return nil, err
+		}
+		switch req.FormValue("action") {
+		case "create":
+			errs := func() []string {
+				var settings scheduler.ContestSettings
+				errs := parseContestTimeForm(req, &settings)
+				errs = append(errs, parseContestOpeningsForm(ctx, bc, &settings)...)
+				preset := scheduler.ContestPreset{
+					Name:        req.FormValue("name"),
+					OwnerID:     user.ID,
+					FixedTime:   settings.FixedTime,
+					TimeControl: settings.TimeControl,
+					OpeningBook: settings.OpeningBook,
+				}
+				if t := req.FormValue("score-threshold"); t != "" {
+					tv, err := strconv.ParseInt(t, 10, 32)
+					if err != nil {
+						errs = append(errs, "bad score threshold")
+					} else {
+						preset.ScoreThreshold = int32(tv)
+					}
+				}
+				games, err := strconv.ParseInt(req.FormValue("games"), 10, 64)
+				if err != nil {
+					errs = append(errs, "invalid number of games")
+				} else {
+					preset.Games = games
+				}
+				if len(errs) != 0 {
+					return errs
+				}
+				preset, err = cfg.Scheduler.CreateContestPreset(ctx, preset)
+				if err != nil {
+					if errors.Is(err, scheduler.ErrNoSuchBook) {
+						return []string{"opening book not found"}
+					}
+					return []string{err.Error()}
+				}
+				log.Info("created contest preset", slog.String("preset_id", preset.ID))
+				return nil
+			}()
+			if len(errs) != 0 {
+				return &errorsPartData{Errors: errs}, nil
+			}
+			return nil, bc.Redirect("/presets")
+		case "delete":
+			preset, err := cfg.Scheduler.GetContestPreset(ctx, req.FormValue("preset-id"))
+			if err != nil {
+				if errors.Is(err, scheduler.ErrNoSuchPreset) {
+					return nil, httputil.MakeError(http.StatusNotFound, "preset not found")
+				}
+				log.Warn("could not get preset", slogx.Err(err))
+				return nil, fmt.Errorf("get preset: %w", err)
+			}
+			if !canDelete(&preset) {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			if err := cfg.Scheduler.DeleteContestPreset(ctx, preset.ID); err != nil && !errors.Is(err, scheduler.ErrNoSuchPreset) {
+				log.Warn("could not delete preset", slogx.Err(err))
+				return nil, fmt.Errorf("delete preset: %w", err)
+			}
+			return nil, bc.Redirect("/presets")
+		default:
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad action")
+		}
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func presetBookName(b *scheduler.OpeningBook, storedNames map[string]string) string {
+	switch b.Kind {
+	case scheduler.OpeningsBuiltin:
+		switch b.Data {
+		case scheduler.BuiltinBookGBSelect2020:
+			return "GBSelect2020"
+		case scheduler.BuiltinBookGraham20141F:
+			return "Graham2024-1F"
+		default:
+			return "Unknown built-in"
+		}
+	case scheduler.OpeningsStored:
+		if name, ok := storedNames[b.Data]; ok {
+			return name
+		}
+		return "Unknown stored book"
+	case scheduler.OpeningsFEN:
+		return "FEN list"
+	case scheduler.OpeningsPGNLine:
+		return "PGN line list"
+	default:
+		return "Unknown"
+	}
+}
+
+func presetsPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, presetsDataBuilder{}, "presets")
+}
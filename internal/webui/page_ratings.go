@@ -0,0 +1,69 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type ratingsDataBuilder struct{}
+
+func (ratingsDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+
+	type item struct {
+		Rank      int
+		Engine    string
+		GamesURL  string
+		Elo       string
+		Error     string
+		Games     int64
+		Win       int64
+		Draw      int64
+		Lose      int64
+		ScoreRate string
+	}
+
+	type data struct {
+		Ratings []item
+	}
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	ratings, err := cfg.Rater.List(ctx)
+	if err != nil {
+		log.Warn("could not list ratings", slogx.Err(err))
+		return nil, fmt.Errorf("list ratings: %w", err)
+	}
+
+	d := &data{Ratings: make([]item, 0, len(ratings))}
+	for i, r := range ratings {
+		d.Ratings = append(d.Ratings, item{
+			Rank:      i + 1,
+			Engine:    r.Engine,
+			GamesURL:  "/games?" + url.Values{"engine": {r.Engine}}.Encode(),
+			Elo:       fmt.Sprintf("%+.1f", r.Elo),
+			Error:     fmt.Sprintf("%.1f", r.Error),
+			Games:     r.Games(),
+			Win:       r.Win,
+			Draw:      r.Draw,
+			Lose:      r.Lose,
+			ScoreRate: fmt.Sprintf("%.1f%%", math.Round(r.ScoreRate()*1000)/10),
+		})
+	}
+	return d, nil
+}
+
+func ratingsPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{}, templ, ratingsDataBuilder{}, "ratings")
+}
@@ -0,0 +1,126 @@
+package webui
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+	"github.com/gorilla/csrf"
+)
+
+type resetPasswordDataBuilder struct{}
+
+func (resetPasswordDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	type data struct {
+		CSRFField template.HTML
+		Sent      bool
+	}
+
+	if bc.UserInfo != nil {
+		return nil, bc.Redirect("/")
+	}
+	if !cfg.UserManager.CanSendMail() {
+		return nil, httputil.MakeError(http.StatusNotFound, "password reset is not available")
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		return &data{
+			CSRFField: csrf.TemplateField(req),
+			Sent:      req.URL.Query().Get("sent") == "true",
+		}, nil
+	case http.MethodPost:
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		err := req.ParseForm()
+		if err != nil {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
+		}
+		if err := cfg.UserManager.RequestPasswordReset(ctx, req.FormValue("email")); err != nil {
+			log.Warn("could not request password reset", slogx.Err(err))
+			return &errorsPartData{Errors: []string{"could not send email"}}, nil
+		}
+		return nil, bc.Redirect("/reset-password?sent=true")
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func resetPasswordPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{}, templ, resetPasswordDataBuilder{}, "reset_password")
+}
+
+type resetPasswordTokenDataBuilder struct{}
+
+func (resetPasswordTokenDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	type data struct {
+		Token     string
+		CSRFField template.HTML
+	}
+
+	token := req.PathValue("token")
+	if _, err := cfg.UserManager.GetEmailToken(ctx, userauth.HashEmailToken(token), timeutil.NowUTC()); err != nil {
+		if !errors.Is(err, userauth.ErrEmailTokenInvalid) {
+			log.Warn("could not get email token", slogx.Err(err))
+		}
+		return nil, httputil.MakeError(http.StatusNotFound, "reset link is invalid or expired")
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		return &data{
+			Token:     token,
+			CSRFField: csrf.TemplateField(req),
+		}, nil
+	case http.MethodPost:
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		err := req.ParseForm()
+		if err != nil {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
+		}
+		password, password2 := req.FormValue("password"), req.FormValue("password2")
+		if subtle.ConstantTimeCompare([]byte(password), []byte(password2)) == 0 {
+			return &errorsPartData{Errors: []string{"passwords mismatch"}}, nil
+		}
+		if err := userauth.ValidatePassword(password); err != nil {
+			return &errorsPartData{Errors: []string{err.Error()}}, nil
+		}
+		user, err := cfg.UserManager.ResetPassword(ctx, token, []byte(password))
+		if err != nil {
+			if errors.Is(err, userauth.ErrEmailTokenInvalid) {
+				return &errorsPartData{Errors: []string{"reset link is invalid or expired"}}, nil
+			}
+			log.Warn("could not reset password", slogx.Err(err))
+			return &errorsPartData{Errors: []string{"internal server error"}}, nil
+		}
+		if err := revokeOtherSessions(ctx, cfg, user.ID, ""); err != nil {
+			log.Warn("could not revoke sessions", slogx.Err(err))
+		}
+		bc.LogIn(ctx, &user)
+		return nil, bc.Redirect("/")
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func resetPasswordTokenPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{}, templ, resetPasswordTokenDataBuilder{}, "reset_password_token")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"log/slog"
 	"net/http"
@@ -11,17 +12,162 @@ import (
 	"github.com/alex65536/day20/internal/delta"
 	"github.com/alex65536/day20/internal/roomapi"
 	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
 	"github.com/alex65536/day20/internal/util/httputil"
 	"github.com/alex65536/day20/internal/util/slogx"
 	"github.com/alex65536/go-chess/chess"
 	"github.com/alex65536/go-chess/util/maybe"
+	"github.com/gorilla/csrf"
 )
 
 type roomDataBuilder struct{}
 
-func (roomDataBuilder) Build(_ context.Context, bc builderCtx) (any, error) {
+func (roomDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 	cfg := bc.Config
 	log := bc.Log
+	req := bc.Req
+
+	type data struct {
+		ID         string
+		Name       string
+		Cursor     *cursorPartData
+		FEN        *fenPartData
+		Summary    *positionSummaryPartData
+		White      *playerPartData
+		Black      *playerPartData
+		Eval       *evalGraphPartData
+		EvalBar    *evalBarPartData
+		Buttons    *roomButtonsPartData
+		Spectators *spectatorsPartData
+		CSRFField  template.HTML
+		JobID      string
+		CanAbort   bool
+		BoardTheme string
+	}
+
+	roomID := req.PathValue("roomID")
+	info, err := cfg.Keeper.RoomInfo(roomID)
+	if err != nil {
+		if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
+			return nil, httputil.MakeError(http.StatusNotFound, "room not found")
+		}
+		return nil, fmt.Errorf("get room info: %w", err)
+	}
+
+	canAbortJob := func(jobID string) (bool, error) {
+		job, ok := cfg.Scheduler.GetRunningJob(jobID)
+		if !ok {
+			return false, nil
+		}
+		contestInfo, _, err := cfg.Scheduler.GetContest(ctx, job.ContestID)
+		if err != nil {
+			if errors.Is(err, scheduler.ErrNoSuchContest) {
+				return false, nil
+			}
+			return false, fmt.Errorf("get contest: %w", err)
+		}
+		return canManageContest(bc.FullUser, &contestInfo), nil
+	}
+
+	if req.Method == http.MethodPost {
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		if err := req.ParseForm(); err != nil {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
+		}
+		switch req.FormValue("action") {
+		case "abort-job":
+			jobID := req.FormValue("job-id")
+			canAbort, err := canAbortJob(jobID)
+			if err != nil {
+				log.Warn("could not check job permissions", slogx.Err(err))
+				return nil, fmt.Errorf("check job permissions: %w", err)
+			}
+			if !canAbort {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			if err := cfg.Keeper.AbortJob(jobID, "aborted by user "+bc.FullUser.Username); err != nil {
+				if roomapi.MatchesError(err, roomapi.ErrNoJobRunning) {
+					return nil, httputil.MakeError(http.StatusConflict, "game already finished")
+				}
+				if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
+					return nil, httputil.MakeError(http.StatusNotFound, "room not found")
+				}
+				if roomapi.MatchesError(err, roomapi.ErrLocked) {
+					return nil, httputil.MakeError(http.StatusConflict, "room is busy, try again")
+				}
+				log.Warn("could not abort job", slogx.Err(err))
+				return nil, fmt.Errorf("abort job: %w", err)
+			}
+			return nil, bc.Redirect("/room/" + roomID)
+		default:
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad action")
+		}
+	}
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	state := delta.NewRoomState()
+	delta, _, err := cfg.Keeper.RoomStateDelta(roomID, delta.RoomCursor{})
+	if err != nil {
+		if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
+			return nil, httputil.MakeError(http.StatusNotFound, "room not found")
+		}
+		return nil, fmt.Errorf("compute delta: %w", err)
+	}
+	if err := state.ApplyDelta(delta); err != nil {
+		return nil, fmt.Errorf("apply delta: %w", err)
+	}
+	if err := checkRoomJobVisible(ctx, log, cfg, bc.Viewer(), state.JobID); err != nil {
+		return nil, err
+	}
+	var board *chess.Board
+	if state.State != nil {
+		board = state.State.Position.Board
+	}
+	canAbort := false
+	if state.JobID != "" {
+		canAbort, err = canAbortJob(state.JobID)
+		if err != nil {
+			log.Warn("could not check job permissions", slogx.Err(err))
+			return nil, fmt.Errorf("check job permissions: %w", err)
+		}
+	}
+
+	return &data{
+		ID:      info.ID,
+		Name:    info.Name,
+		Cursor:  buildCursorPartData(log, maybe.Some(state.Cursor()), false),
+		FEN:     buildFENPartData(board),
+		Summary: buildPositionSummaryPartData(state.State),
+		White:   buildPlayerPartData(chess.ColorWhite, state.State),
+		Black:   buildPlayerPartData(chess.ColorBlack, state.State),
+		Eval:    buildRoomEvalGraphPartData(state.State),
+		EvalBar: buildEvalBarPartData(state.State),
+		Buttons: &roomButtonsPartData{
+			RoomID:    roomID,
+			Active:    state.JobID != "",
+			LastJobID: state.LastJobID,
+		},
+		Spectators: &spectatorsPartData{Count: state.Spectators},
+		CSRFField:  csrf.TemplateField(req),
+		JobID:      state.JobID,
+		CanAbort:   canAbort,
+		BoardTheme: boardThemeClass(bc.FullUser),
+	}, nil
+}
+
+func roomPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, roomDataBuilder{}, "room")
+}
+
+type roomOverlayDataBuilder struct{}
+
+func (roomOverlayDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
 
 	type data struct {
 		ID      string
@@ -30,10 +176,14 @@ func (roomDataBuilder) Build(_ context.Context, bc builderCtx) (any, error) {
 		FEN     *fenPartData
 		White   *playerPartData
 		Black   *playerPartData
-		Buttons *roomButtonsPartData
+		EvalBar *evalBarPartData
 	}
 
-	roomID := bc.Req.PathValue("roomID")
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	roomID := req.PathValue("roomID")
 	info, err := cfg.Keeper.RoomInfo(roomID)
 	if err != nil {
 		if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
@@ -52,27 +202,35 @@ func (roomDataBuilder) Build(_ context.Context, bc builderCtx) (any, error) {
 	if err := state.ApplyDelta(delta); err != nil {
 		return nil, fmt.Errorf("apply delta: %w", err)
 	}
+	// The overlay pages don't load the user, so the viewer is taken from the request directly.
+	if err := checkRoomJobVisible(ctx, bc.Log, cfg, requestViewer(ctx, bc.Log, cfg, req), state.JobID); err != nil {
+		return nil, err
+	}
 	var board *chess.Board
 	if state.State != nil {
 		board = state.State.Position.Board
 	}
 
 	return &data{
-		ID:     info.ID,
-		Name:   info.Name,
-		Cursor: buildCursorPartData(log, maybe.Some(state.Cursor()), false),
-		FEN:    buildFENPartData(board),
-		White:  buildPlayerPartData(chess.ColorWhite, state.State),
-		Black:  buildPlayerPartData(chess.ColorBlack, state.State),
-		Buttons: &roomButtonsPartData{
-			RoomID: roomID,
-			Active: state.JobID != "",
-		},
+		ID:      info.ID,
+		Name:    info.Name,
+		Cursor:  buildCursorPartData(bc.Log, maybe.Some(state.Cursor()), false),
+		FEN:     buildFENPartData(board),
+		White:   buildPlayerPartData(chess.ColorWhite, state.State),
+		Black:   buildPlayerPartData(chess.ColorBlack, state.State),
+		EvalBar: buildEvalBarPartData(state.State),
 	}, nil
 }
 
-func roomPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
-	return newPage(log, cfg, pageOptions{}, templ, roomDataBuilder{}, "room")
+// roomOverlayPage is the page without any decorations, to be embedded into stream broadcasts.
+func roomOverlayPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{NoNav: true, NoUserInfo: true}, templ, roomOverlayDataBuilder{}, "room_overlay")
+}
+
+// embedRoomPage is the compact widget which can be embedded into other sites via iframe. It uses the
+// same stream as the overlay page.
+func embedRoomPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{NoNav: true, NoUserInfo: true}, templ, roomOverlayDataBuilder{}, "embed_room")
 }
 
 type roomPGNAttachImpl struct {
@@ -95,6 +253,11 @@ func (a *roomPGNAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request)
 	}
 
 	roomID := req.PathValue("roomID")
+	viewer := requestViewer(ctx, log, a.cfg, req)
+	if err := checkRoomVisible(ctx, log, a.cfg, viewer, roomID); err != nil {
+		writeHTTPErr(log, w, err)
+		return
+	}
 	game, err := a.cfg.Keeper.RoomGameExt(roomID)
 	if err != nil {
 		if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
@@ -113,6 +276,11 @@ func (a *roomPGNAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request)
 		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "error building game"))
 		return
 	}
+	// The job could change while the game was being built, so check the new one as well.
+	if err := checkRoomVisible(ctx, log, a.cfg, viewer, roomID); err != nil {
+		writeHTTPErr(log, w, err)
+		return
+	}
 	pgn, err := game.PGN()
 	if err != nil {
 		log.Warn("could not convert game", slogx.Err(err))
@@ -133,3 +301,77 @@ func roomPGNAttach(log *slog.Logger, cfg *Config) http.Handler {
 		cfg: cfg,
 	}
 }
+
+type roomLastPGNAttachImpl struct {
+	log *slog.Logger
+	cfg *Config
+}
+
+func (a *roomLastPGNAttachImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := a.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle room last pgn request",
+		slog.String("method", req.Method),
+		slog.String("addr", req.RemoteAddr),
+	)
+
+	if req.Method != http.MethodGet {
+		log.Warn("method not allowed")
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	roomID := req.PathValue("roomID")
+	maybeJobID, err := a.cfg.Keeper.RoomLastJobID(roomID)
+	if err != nil {
+		if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "room not found"))
+			return
+		}
+		log.Warn("could not get last job", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	jobID, ok := maybeJobID.TryGet()
+	if !ok {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "job not found"))
+		return
+	}
+	job, err := a.cfg.Scheduler.GetFinishedJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchJob) {
+			writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "job not found"))
+			return
+		}
+		log.Warn("could not get finished job", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusInternalServerError, "internal server error"))
+		return
+	}
+	info, _, err := a.cfg.Scheduler.GetContest(ctx, job.ContestID)
+	if err != nil {
+		log.Warn("could not get contest", slogx.Err(err))
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "job not found"))
+		return
+	}
+	if !requestViewer(ctx, log, a.cfg, req).CanView(&info) {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "job not found"))
+		return
+	}
+	if job.PGN == nil {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusNotFound, "pgn not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.chess-pgn")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"game_%v.pgn\"", jobID))
+	if _, err := io.WriteString(w, *job.PGN); err != nil {
+		log.Info("could not write response", slogx.Err(err))
+	}
+}
+
+func roomLastPGNAttach(log *slog.Logger, cfg *Config) http.Handler {
+	return &roomLastPGNAttachImpl{
+		log: log,
+		cfg: cfg,
+	}
+}
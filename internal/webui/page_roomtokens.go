@@ -19,6 +19,16 @@ import (
 	"github.com/gorilla/csrf"
 )
 
+// shortTokenHash returns the abbreviated token hash, which is enough to distinguish the tokens in
+// the list.
+func shortTokenHash(hash string) string {
+	rawHash, err := base64.RawURLEncoding.DecodeString(hash)
+	if err != nil || len(rawHash) < 8 {
+		return "<invalid>"
+	}
+	return hex.EncodeToString(rawHash[len(rawHash)-8:])
+}
+
 type roomtokensDataBuilder struct{}
 
 func (roomtokensDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
@@ -49,15 +59,10 @@ func (roomtokensDataBuilder) Build(ctx context.Context, bc builderCtx) (any, err
 	case http.MethodGet:
 		var tokens []item
 		for _, t := range bc.FullUser.RoomTokens {
-			hash := "<invalid>"
-			rawHash, err := base64.RawURLEncoding.DecodeString(t.Hash)
-			if err == nil && len(rawHash) >= 8 {
-				hash = hex.EncodeToString(rawHash[len(rawHash)-8:])
-			}
 			tokens = append(tokens, item{
 				CreatedAt: t.CreatedAt,
 				FullHash:  t.Hash,
-				ShortHash: hash,
+				ShortHash: shortTokenHash(t.Hash),
 				Label:     t.Label,
 			})
 		}
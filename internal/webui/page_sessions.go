@@ -0,0 +1,108 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/gorilla/csrf"
+)
+
+type sessionsDataBuilder struct{}
+
+func (sessionsDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	type item struct {
+		ID         string
+		CreatedAt  *humanTimePartData
+		LastSeenAt *humanTimePartData
+		IP         string
+		UserAgent  string
+		Current    bool
+	}
+
+	type data struct {
+		CSRFField template.HTML
+		Sessions  []item
+		HasOthers bool
+	}
+
+	if bc.FullUser == nil {
+		return nil, httputil.MakeError(http.StatusForbidden, "not logged in")
+	}
+	if bc.IsImpersonating() {
+		return nil, httputil.MakeError(http.StatusForbidden, "not allowed while impersonating")
+	}
+	currentID := bc.UserInfo.SessionID
+
+	switch req.Method {
+	case http.MethodGet:
+		records, err := cfg.UserManager.ListUserSessions(ctx, bc.FullUser.ID)
+		if err != nil {
+			log.Warn("could not list sessions", slogx.Err(err))
+			return nil, fmt.Errorf("list sessions: %w", err)
+		}
+		now := time.Now()
+		sessions := make([]item, 0, len(records))
+		hasOthers := false
+		for _, r := range records {
+			current := r.ID == currentID
+			hasOthers = hasOthers || !current
+			sessions = append(sessions, item{
+				ID:         r.ID,
+				CreatedAt:  buildHumanTimePartData(now, r.CreatedAt.UTC()),
+				LastSeenAt: buildHumanTimePartData(now, r.LastSeenAt.UTC()),
+				IP:         r.IP,
+				UserAgent:  r.UserAgent,
+				Current:    current,
+			})
+		}
+		return &data{
+			CSRFField: csrf.TemplateField(req),
+			Sessions:  sessions,
+			HasOthers: hasOthers,
+		}, nil
+	case http.MethodPost:
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		err := req.ParseForm()
+		if err != nil {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
+		}
+		switch req.FormValue("action") {
+		case "revoke":
+			sessionID := req.FormValue("session-id")
+			if sessionID == currentID {
+				return nil, httputil.MakeError(http.StatusBadRequest, "cannot revoke current session")
+			}
+			if err := cfg.UserManager.DeleteSession(ctx, sessionID, bc.FullUser.ID); err != nil {
+				log.Warn("could not revoke session", slogx.Err(err))
+				return nil, fmt.Errorf("revoke session: %w", err)
+			}
+			return nil, bc.Redirect("/sessions")
+		case "revoke-others":
+			if err := revokeOtherSessions(ctx, cfg, bc.FullUser.ID, currentID); err != nil {
+				log.Warn("could not revoke other sessions", slogx.Err(err))
+				return nil, fmt.Errorf("revoke other sessions: %w", err)
+			}
+			return nil, bc.Redirect("/sessions")
+		default:
+			return nil, httputil.MakeError(http.StatusBadRequest, "unknown action")
+		}
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func sessionsPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, sessionsDataBuilder{}, "sessions")
+}
@@ -8,7 +8,10 @@ import (
 	"html/template"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/alex65536/day20/internal/broadcast"
 	"github.com/alex65536/day20/internal/userauth"
 	"github.com/alex65536/day20/internal/util/httputil"
 	"github.com/alex65536/day20/internal/util/slogx"
@@ -27,9 +30,23 @@ func (userDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 		User              *userPartData
 		CSRFField         template.HTML
 		CanChangePassword bool
+		CanChangeEmail    bool
+		Email             string
+		EmailVerified     bool
 		CanChangePerms    bool
 		CanInvite         bool
 		CanHostRooms      bool
+		CanUseAPI         bool
+		Notify            *notifyTargetsPartData
+		CanBroadcast      bool
+		HasLichessToken   bool
+		External          []externalAccountItem
+		CanImpersonate    bool
+		Prefs             *userauth.Prefs
+		Langs             []langItem
+		BoardThemes       []string
+		Themes            []string
+		MaxGamesPerPage   int
 	}
 
 	targetUsername := req.PathValue("username")
@@ -48,17 +65,73 @@ func (userDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 		canChangePerms = err == nil
 	}
 	isOurOwnPage := ourUser != nil && ourUser.ID == targetUser.ID
-	canChangePassword := isOurOwnPage && !ourUser.Perms.IsBlocked
+	// Credentials and linked accounts cannot be changed while impersonating.
+	canChangePassword := isOurOwnPage && !ourUser.Perms.IsBlocked && !bc.IsImpersonating()
+	canChangeEmail := canChangePassword && (cfg.UserManager.CanSendMail() || ourUser.Email != "")
 
 	switch req.Method {
 	case http.MethodGet:
+		var notifyTargets *notifyTargetsPartData
+		if isOurOwnPage && canEditNotifyTargets(ourUser) {
+			targets, err := cfg.Notifier.ListUserTargets(ctx, ourUser.ID)
+			if err != nil {
+				log.Warn("could not list notify targets", slogx.Err(err))
+				return nil, fmt.Errorf("list notify targets: %w", err)
+			}
+			notifyTargets = buildNotifyTargetsPartData(bc, "/user/"+targetUsername, targets)
+		}
+		canBroadcast := isOurOwnPage && ourUser.Perms.Get(userauth.PermRunContests)
+		hasLichessToken := false
+		if canBroadcast {
+			hasLichessToken, err = cfg.Broadcaster.HasToken(ctx, ourUser.ID)
+			if err != nil {
+				log.Warn("could not check lichess token", slogx.Err(err))
+				return nil, fmt.Errorf("check lichess token: %w", err)
+			}
+		}
+		var external []externalAccountItem
+		if canChangePassword && len(cfg.ExternalAuth) != 0 {
+			external, err = buildExternalAccountItems(ctx, cfg, ourUser.ID)
+			if err != nil {
+				log.Warn("could not list external accounts", slogx.Err(err))
+				return nil, fmt.Errorf("list external accounts: %w", err)
+			}
+		}
+		var prefs *userauth.Prefs
+		if isOurOwnPage {
+			p := ourUser.Prefs
+			if p.BoardTheme == "" {
+				p.BoardTheme = userauth.BoardThemes[0]
+			}
+			if p.Theme == "" {
+				p.Theme = requestTheme(req, nil)
+			}
+			if p.GamesPerPage == 0 {
+				p.GamesPerPage = gamesPageSize
+			}
+			prefs = &p
+		}
 		return &data{
 			User:              buildUserPartData(targetUser),
 			CSRFField:         csrf.TemplateField(req),
 			CanChangePassword: canChangePassword,
+			CanChangeEmail:    canChangeEmail,
+			Email:             targetUser.Email,
+			EmailVerified:     targetUser.EmailVerified,
 			CanChangePerms:    canChangePerms,
 			CanInvite:         isOurOwnPage && ourUser.Perms.Get(userauth.PermInvite),
 			CanHostRooms:      isOurOwnPage && ourUser.Perms.Get(userauth.PermHostRooms),
+			CanUseAPI:         isOurOwnPage && ourUser.Perms.Get(userauth.PermRunContests),
+			Notify:            notifyTargets,
+			CanBroadcast:      canBroadcast,
+			HasLichessToken:   hasLichessToken,
+			External:          external,
+			CanImpersonate:    ourUser != nil && canImpersonate(ourUser, bc.UserInfo, &targetUser) == nil,
+			Prefs:             prefs,
+			Langs:             cfg.locales.Langs(),
+			BoardThemes:       userauth.BoardThemes,
+			Themes:            userauth.Themes,
+			MaxGamesPerPage:   userauth.MaxGamesPerPage,
 		}, nil
 	case http.MethodPost:
 		if !bc.IsHTMX() {
@@ -97,6 +170,9 @@ func (userDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 					return "internal server error"
 				}
 				bc.UpgradeSession(makeUserInfo(ourUser))
+				if err := revokeOtherSessions(ctx, cfg, ourUser.ID, bc.UserInfo.SessionID); err != nil {
+					log.Warn("could not revoke other sessions", slogx.Err(err))
+				}
 				return ""
 			}()
 			if serr != "" {
@@ -105,6 +181,27 @@ func (userDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 				}, nil
 			}
 			return nil, bc.Redirect("/user/" + targetUsername)
+		case "email":
+			if !canChangeEmail {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			if err := cfg.UserManager.SetEmail(ctx, ourUser, req.FormValue("email")); err != nil {
+				if errors.Is(err, userauth.ErrEmailTaken) || errors.Is(err, userauth.ErrMailNotConfigured) {
+					return &errorsPartData{Errors: []string{err.Error()}}, nil
+				}
+				log.Warn("could not set email", slogx.Err(err))
+				return &errorsPartData{Errors: []string{"could not set email"}}, nil
+			}
+			return nil, bc.Redirect("/user/" + targetUsername)
+		case "email-verify":
+			if !canChangeEmail {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			if err := cfg.UserManager.SendEmailVerification(ctx, ourUser); err != nil {
+				log.Warn("could not send email verification", slogx.Err(err))
+				return &errorsPartData{Errors: []string{"could not send verification email"}}, nil
+			}
+			return nil, bc.Redirect("/user/" + targetUsername)
 		case "perms":
 			serr := func() string {
 				var perms userauth.Perms
@@ -131,6 +228,83 @@ func (userDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
 				}, nil
 			}
 			return nil, bc.Redirect("/user/" + targetUsername)
+		case "notify-add", "notify-delete":
+			if !isOurOwnPage {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			return handleNotifyTargetAction(ctx, bc, nil, "/user/"+targetUsername)
+		case "external-unlink":
+			if !canChangePassword {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			if err := unlinkExternalAccount(ctx, cfg, ourUser, req.FormValue("provider")); err != nil {
+				if errors.Is(err, errLastLoginMethod) {
+					return &errorsPartData{Errors: []string{err.Error()}}, nil
+				}
+				log.Warn("could not unlink external account", slogx.Err(err))
+				return nil, fmt.Errorf("unlink external account: %w", err)
+			}
+			return nil, bc.Redirect("/user/" + targetUsername)
+		case "prefs":
+			if !isOurOwnPage {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			prefs := userauth.Prefs{
+				BoardTheme:  req.FormValue("board-theme"),
+				Theme:       req.FormValue("theme"),
+				TimeControl: strings.TrimSpace(req.FormValue("time-control")),
+				Language:    req.FormValue("language"),
+			}
+			if prefs.Language != "" && !cfg.locales.Has(prefs.Language) {
+				return &errorsPartData{Errors: []string{"unknown language"}}, nil
+			}
+			if s := req.FormValue("games-per-page"); s != "" {
+				n, err := strconv.Atoi(s)
+				if err != nil || n <= 0 {
+					return &errorsPartData{Errors: []string{"bad number of games per page"}}, nil
+				}
+				prefs.GamesPerPage = n
+			}
+			if err := prefs.Validate(); err != nil {
+				return &errorsPartData{Errors: []string{err.Error()}}, nil
+			}
+			ourUser.Prefs = prefs
+			if err := cfg.UserManager.UpdateUser(ctx, *ourUser); err != nil {
+				log.Warn("could not save user", slogx.Err(err))
+				return &errorsPartData{Errors: []string{"internal server error"}}, nil
+			}
+			// The language and the theme are stored in the session, so it must be updated as well.
+			bc.UpgradeSession(makeUserInfo(ourUser))
+			if prefs.Theme != "" {
+				bc.SetThemeCookie(prefs.Theme)
+			}
+			return nil, bc.Redirect("/user/" + targetUsername)
+		case "impersonate":
+			if err := canImpersonate(ourUser, bc.UserInfo, &targetUser); err != nil {
+				return &errorsPartData{Errors: []string{err.Error()}}, nil
+			}
+			bc.Impersonate(&targetUser)
+			return nil, bc.Redirect("/")
+		case "lichess-token":
+			if !isOurOwnPage || !ourUser.Perms.Get(userauth.PermRunContests) {
+				return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+			}
+			token := strings.TrimSpace(req.FormValue("token"))
+			if token == "" {
+				if err := cfg.Broadcaster.DeleteToken(ctx, ourUser.ID); err != nil {
+					log.Warn("could not delete lichess token", slogx.Err(err))
+					return nil, fmt.Errorf("delete lichess token: %w", err)
+				}
+				return nil, bc.Redirect("/user/" + targetUsername)
+			}
+			if err := broadcast.ValidateToken(token); err != nil {
+				return &errorsPartData{Errors: []string{err.Error()}}, nil
+			}
+			if err := cfg.Broadcaster.SetToken(ctx, ourUser.ID, token); err != nil {
+				log.Warn("could not set lichess token", slogx.Err(err))
+				return nil, fmt.Errorf("set lichess token: %w", err)
+			}
+			return nil, bc.Redirect("/user/" + targetUsername)
 		default:
 			return nil, httputil.MakeError(http.StatusBadRequest, "unknown action")
 		}
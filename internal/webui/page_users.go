@@ -3,31 +3,205 @@ package webui
 import (
 	"context"
 	"fmt"
+	"html/template"
 	"log/slog"
 	"net/http"
+	"slices"
 
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
 	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/gorilla/csrf"
 )
 
+type bulkUserAction struct {
+	Name   string
+	Pretty string
+	apply  func(p userauth.Perms) userauth.Perms
+}
+
+var bulkUserActions = []bulkUserAction{
+	{
+		Name:   "block",
+		Pretty: "Block",
+		apply: func(userauth.Perms) userauth.Perms {
+			return userauth.BlockedPerms()
+		},
+	},
+	{
+		Name:   "unblock",
+		Pretty: "Unblock",
+		apply: func(p userauth.Perms) userauth.Perms {
+			if !p.IsBlocked {
+				return p
+			}
+			return userauth.Perms{}
+		},
+	},
+	{
+		Name:   "strip-host-rooms",
+		Pretty: "Strip host rooms permission",
+		apply: func(p userauth.Perms) userauth.Perms {
+			p.CanHostRooms = false
+			return p
+		},
+	},
+}
+
+func findBulkUserAction(name string) *bulkUserAction {
+	for i := range bulkUserActions {
+		if bulkUserActions[i].Name == name {
+			return &bulkUserActions[i]
+		}
+	}
+	return nil
+}
+
+type usersBulkConfirmPartData struct {
+	CSRFField template.HTML
+	Action    string
+	Pretty    string
+	IDs       []string
+	Changed   []*userPartData
+	Unchanged []*userPartData
+}
+
+func (usersBulkConfirmPartData) Fragment() string { return "part/users_bulk_confirm" }
+
+// planBulkUserAction returns the users whose permissions will change after applying the action. If
+// any of the selected users cannot be changed by the initiator, the whole operation is rejected.
+func planBulkUserAction(
+	initiator *userauth.User,
+	users []userauth.User,
+	ids []string,
+	action *bulkUserAction,
+) (changed []userauth.User, unchanged []userauth.User, errs []string) {
+	for _, id := range ids {
+		idx := slices.IndexFunc(users, func(u userauth.User) bool { return u.ID == id })
+		if idx < 0 {
+			errs = append(errs, fmt.Sprintf("user %q not found", id))
+			continue
+		}
+		user := users[idx]
+		newPerms := action.apply(user.Perms)
+		if newPerms == user.Perms {
+			unchanged = append(unchanged, user)
+			continue
+		}
+		if err := user.TryChangePerms(initiator, newPerms); err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", user.Username, err))
+			continue
+		}
+		changed = append(changed, user)
+	}
+	return changed, unchanged, errs
+}
+
 type usersDataBuilder struct{}
 
 func (usersDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
 	cfg := bc.Config
+	log := bc.Log
+
+	type item struct {
+		ID         string
+		User       *userPartData
+		Selectable bool
+	}
 
 	type data struct {
-		Users []*userPartData
+		CSRFField   template.HTML
+		Users       []item
+		CanBulkEdit bool
+		Actions     []bulkUserAction
 	}
 
+	ourUser := bc.FullUser
+	canBulkEdit := ourUser != nil && ourUser.Perms.Get(userauth.PermAdmin)
+
 	users, err := cfg.UserManager.ListUsers(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("list users: %w", err)
 	}
 
-	return &data{
-		Users: sliceutil.Map(users, buildUserPartData),
-	}, nil
+	switch req.Method {
+	case http.MethodGet:
+		items := make([]item, 0, len(users))
+		for _, u := range users {
+			items = append(items, item{
+				ID:         u.ID,
+				User:       buildUserPartData(u),
+				Selectable: canBulkEdit && u.CanChangePerms(ourUser, u.Perms) == nil && u.ID != ourUser.ID,
+			})
+		}
+		return &data{
+			CSRFField:   csrf.TemplateField(req),
+			Users:       items,
+			CanBulkEdit: canBulkEdit,
+			Actions:     bulkUserActions,
+		}, nil
+	case http.MethodPost:
+		if !bc.IsHTMX() {
+			return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+		}
+		if !canBulkEdit {
+			return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+		}
+		err := req.ParseForm()
+		if err != nil {
+			return nil, httputil.MakeError(http.StatusBadRequest, "bad form data")
+		}
+		action := findBulkUserAction(req.FormValue("bulk-action"))
+		if action == nil {
+			return &errorsPartData{Errors: []string{"no action selected"}}, nil
+		}
+		ids := slices.Clone(req.Form["user"])
+		slices.Sort(ids)
+		ids = slices.Compact(ids)
+		if len(ids) == 0 {
+			return &errorsPartData{Errors: []string{"no users selected"}}, nil
+		}
+		changed, unchanged, errs := planBulkUserAction(ourUser, users, ids, action)
+		if len(errs) != 0 {
+			return &errorsPartData{Errors: errs}, nil
+		}
+		switch req.FormValue("action") {
+		case "bulk-preview":
+			return &usersBulkConfirmPartData{
+				CSRFField: csrf.TemplateField(req),
+				Action:    action.Name,
+				Pretty:    action.Pretty,
+				IDs:       ids,
+				Changed:   sliceutil.Map(changed, buildUserPartData),
+				Unchanged: sliceutil.Map(unchanged, buildUserPartData),
+			}, nil
+		case "bulk-apply":
+			if len(changed) != 0 {
+				if err := cfg.UserManager.UpdateUsers(ctx, changed, userauth.UpdateUserOptions{
+					InvalidatePerms: true,
+				}); err != nil {
+					log.Warn("could not update users", slogx.Err(err))
+					return &errorsPartData{Errors: []string{"internal server error"}}, nil
+				}
+			}
+			for _, u := range changed {
+				cfg.AuditLog.Info("user perms changed in bulk",
+					slog.String("username", ourUser.Username),
+					slog.String("target", u.Username),
+					slog.String("bulk_action", action.Name),
+				)
+			}
+			return nil, bc.Redirect("/users")
+		default:
+			return nil, httputil.MakeError(http.StatusBadRequest, "unknown action")
+		}
+	default:
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
 }
 
 func usersPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
-	return newPage(log, cfg, pageOptions{}, templ, usersDataBuilder{}, "users")
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, usersDataBuilder{}, "users")
 }
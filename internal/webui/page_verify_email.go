@@ -0,0 +1,50 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+type verifyEmailDataBuilder struct{}
+
+func (verifyEmailDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	type data struct {
+		Username string
+		Email    string
+	}
+
+	if req.Method != http.MethodGet {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+
+	user, err := cfg.UserManager.VerifyEmail(ctx, req.PathValue("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, userauth.ErrEmailTokenInvalid):
+			return nil, httputil.MakeError(http.StatusNotFound, "verification link is invalid or expired")
+		case errors.Is(err, userauth.ErrEmailTaken):
+			return nil, httputil.MakeError(http.StatusConflict, "email is already used by another user")
+		}
+		log.Warn("could not verify email", slogx.Err(err))
+		return nil, fmt.Errorf("verify email: %w", err)
+	}
+	return &data{
+		Username: user.Username,
+		Email:    user.Email,
+	}, nil
+}
+
+func verifyEmailPage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{}, templ, verifyEmailDataBuilder{}, "verify_email")
+}
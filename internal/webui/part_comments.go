@@ -0,0 +1,165 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alex65536/day20/internal/discuss"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/gorilla/csrf"
+)
+
+type commentItem struct {
+	ID        string
+	Author    string
+	Text      string
+	Hidden    bool
+	CreatedAt *humanTimePartData
+	EditedAt  *humanTimePartData
+	CanEdit   bool
+	CanDelete bool
+}
+
+type commentsPartData struct {
+	URL         string
+	CSRFField   template.HTML
+	CanPost     bool
+	CanModerate bool
+	Comments    []commentItem
+}
+
+func buildCommentsPartData(ctx context.Context, bc builderCtx, url string, contestID string) (*commentsPartData, error) {
+	cfg := bc.Config
+	user := bc.FullUser
+	canModerate := discuss.CanModerate(user)
+	comments, err := cfg.Discussion.List(ctx, contestID, canModerate)
+	if err != nil {
+		return nil, fmt.Errorf("list comments: %w", err)
+	}
+	authors := make(map[string]string)
+	now := time.Now()
+	items := make([]commentItem, 0, len(comments))
+	for _, c := range comments {
+		author, ok := authors[c.AuthorID]
+		if !ok {
+			u, err := cfg.UserManager.GetUser(ctx, c.AuthorID)
+			if err != nil && !errors.Is(err, userauth.ErrUserNotFound) {
+				return nil, fmt.Errorf("get author: %w", err)
+			}
+			author = u.Username
+			authors[c.AuthorID] = author
+		}
+		var editedAt *humanTimePartData
+		if c.EditedAt != nil {
+			editedAt = buildHumanTimePartData(now, c.EditedAt.UTC())
+		}
+		items = append(items, commentItem{
+			ID:        c.ID,
+			Author:    author,
+			Text:      c.Text,
+			Hidden:    c.Hidden,
+			CreatedAt: buildHumanTimePartData(now, c.CreatedAt.UTC()),
+			EditedAt:  editedAt,
+			CanEdit:   discuss.CanEdit(user, &c),
+			CanDelete: discuss.CanDelete(user, &c),
+		})
+	}
+	return &commentsPartData{
+		URL:         url,
+		CSRFField:   csrf.TemplateField(bc.Req),
+		CanPost:     discuss.CanPost(user),
+		CanModerate: canModerate,
+		Comments:    items,
+	}, nil
+}
+
+// handleCommentAction handles "comment-*" form actions for the contest discussion thread.
+func handleCommentAction(ctx context.Context, bc builderCtx, contestID string, redirect string) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+	user := bc.FullUser
+
+	action := req.FormValue("action")
+	if action == "comment-post" {
+		if !discuss.CanPost(user) {
+			return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+		}
+		text := req.FormValue("text")
+		if err := discuss.ValidateText(text); err != nil {
+			return &errorsPartData{Errors: []string{err.Error()}}, nil
+		}
+		if _, err := cfg.Discussion.Post(ctx, contestID, user.ID, text); err != nil {
+			log.Warn("could not post comment", slogx.Err(err))
+			return &errorsPartData{Errors: []string{"could not post comment"}}, nil
+		}
+		return nil, bc.Redirect(redirect)
+	}
+
+	comment, err := cfg.Discussion.Get(ctx, req.FormValue("comment-id"))
+	if err != nil {
+		if errors.Is(err, discuss.ErrNoSuchComment) {
+			return nil, httputil.MakeError(http.StatusNotFound, "comment not found")
+		}
+		log.Warn("could not get comment", slogx.Err(err))
+		return nil, fmt.Errorf("get comment: %w", err)
+	}
+	if comment.ContestID != contestID {
+		return nil, httputil.MakeError(http.StatusNotFound, "comment not found")
+	}
+
+	switch action {
+	case "comment-edit":
+		if !discuss.CanEdit(user, &comment) {
+			return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+		}
+		text := req.FormValue("text")
+		if err := discuss.ValidateText(text); err != nil {
+			return &errorsPartData{Errors: []string{err.Error()}}, nil
+		}
+		if err := cfg.Discussion.Edit(ctx, comment, text); err != nil {
+			log.Warn("could not edit comment", slogx.Err(err))
+			return &errorsPartData{Errors: []string{"could not edit comment"}}, nil
+		}
+	case "comment-delete":
+		if !discuss.CanDelete(user, &comment) {
+			return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+		}
+		if err := cfg.Discussion.Delete(ctx, comment.ID); err != nil {
+			log.Warn("could not delete comment", slogx.Err(err))
+			return nil, fmt.Errorf("delete comment: %w", err)
+		}
+		if comment.AuthorID != user.ID {
+			cfg.AuditLog.Info("comment deleted by moderator",
+				slog.String("username", user.Username),
+				slog.String("comment_id", comment.ID),
+				slog.String("author_id", comment.AuthorID),
+			)
+		}
+	case "comment-hide", "comment-unhide":
+		if !discuss.CanModerate(user) {
+			return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+		}
+		hidden := action == "comment-hide"
+		if err := cfg.Discussion.SetHidden(ctx, comment, hidden); err != nil {
+			log.Warn("could not hide comment", slogx.Err(err))
+			return nil, fmt.Errorf("hide comment: %w", err)
+		}
+		cfg.AuditLog.Info("comment moderated",
+			slog.String("username", user.Username),
+			slog.String("comment_id", comment.ID),
+			slog.String("author_id", comment.AuthorID),
+			slog.Bool("hidden", hidden),
+		)
+	default:
+		return nil, httputil.MakeError(http.StatusBadRequest, "unknown action")
+	}
+	return nil, bc.Redirect(redirect)
+}
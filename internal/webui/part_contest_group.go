@@ -0,0 +1,104 @@
+package webui
+
+import (
+	"fmt"
+
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/stat"
+)
+
+type contestGroupResult struct {
+	Win     int
+	Draw    int
+	Lose    int
+	Score   string
+	LOS     float64
+	EloDiff stat.EloDiff
+}
+
+func buildContestGroupResult(st stat.Status) *contestGroupResult {
+	return &contestGroupResult{
+		Win:     st.Win,
+		Draw:    st.Draw,
+		Lose:    st.Lose,
+		Score:   st.ScoreString(),
+		LOS:     st.LOS(),
+		EloDiff: st.EloDiff(0.95),
+	}
+}
+
+type contestGroupItem struct {
+	ID          string
+	Name        string
+	TimeControl string
+	Current     bool
+	Status      scheduler.ContestStatusKind
+	Progress    *progressPartData
+	// Result is set for matches, Summary is set for other contest kinds.
+	Result  *contestGroupResult
+	Summary string
+}
+
+type contestGroupPartData struct {
+	Contests []contestGroupItem
+	// Combined sums up the results of all the sub-contests. It is set only if all of them are matches
+	// between the same players.
+	Combined *contestGroupResult
+}
+
+func contestTimeControlString(info *scheduler.ContestInfo) string {
+	switch {
+	case info.TimeControl != nil:
+		return info.TimeControl.String()
+	case info.FixedTime != nil:
+		return fmt.Sprintf("%v ms/move", info.FixedTime.Milliseconds())
+	default:
+		return "?"
+	}
+}
+
+// buildContestGroupPartData builds the summary of the sub-contests linked with the contest
+// currentID. The results are given from the point of view of the first player of that contest.
+func buildContestGroupPartData(currentID string, contests []scheduler.ContestFullData) *contestGroupPartData {
+	var current *scheduler.ContestInfo
+	for i := range contests {
+		if contests[i].Info.ID == currentID {
+			current = &contests[i].Info
+		}
+	}
+	d := &contestGroupPartData{}
+	var combined stat.Status
+	canCombine := current != nil && current.Kind == scheduler.ContestMatch
+	for _, c := range contests {
+		item := contestGroupItem{
+			ID:          c.Info.ID,
+			Name:        c.Info.Name,
+			TimeControl: contestTimeControlString(&c.Info),
+			Current:     c.Info.ID == currentID,
+			Status:      c.Data.Status.Kind,
+			Progress:    buildProgressPartData(c.Info.Progress(&c.Data)),
+		}
+		if c.Info.Kind == scheduler.ContestMatch && c.Data.Match != nil {
+			st := c.Data.Match.Status()
+			if canCombine {
+				switch {
+				case c.Info.Players[0].Name == current.Players[0].Name && c.Info.Players[1].Name == current.Players[1].Name:
+				case c.Info.Players[0].Name == current.Players[1].Name && c.Info.Players[1].Name == current.Players[0].Name:
+					st = st.Inv()
+				default:
+					canCombine = false
+				}
+			}
+			combined = combined.Add(st)
+			item.Result = buildContestGroupResult(st)
+		} else {
+			canCombine = false
+			item.Summary = contestResultString(&c.Info, &c.Data)
+		}
+		d.Contests = append(d.Contests, item)
+	}
+	if canCombine && len(d.Contests) > 1 {
+		d.Combined = buildContestGroupResult(combined)
+	}
+	return d
+}
@@ -0,0 +1,56 @@
+package webui
+
+import (
+	"html/template"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/delta"
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/uci"
+	"github.com/alex65536/go-chess/util/maybe"
+)
+
+type evalBarPartData struct {
+	Has bool
+	// WhitePercent is the part of the bar filled with white, from 0 to 100.
+	WhitePercent int
+	Score        string
+	AJAXAttrs    template.HTMLAttr
+}
+
+// buildEvalBarPartData shows the score of the engine which is thinking now. If there is no such
+// score yet, the score of the last move is shown.
+func buildEvalBarPartData(state *delta.JobState) *evalBarPartData {
+	data := &evalBarPartData{
+		Has:          false,
+		WhitePercent: 50,
+	}
+	if state == nil || state.Info == nil {
+		return data
+	}
+	var score maybe.Maybe[uci.Score]
+	if state.Moves != nil {
+		scores := battle.WhiteScores(state.Info.StartPos.Side, state.Moves.Scores)
+		for i := len(scores) - 1; i >= 0; i-- {
+			if scores[i].IsSome() {
+				score = scores[i]
+				break
+			}
+		}
+	}
+	for col := range chess.ColorMax {
+		p := state.Player(col)
+		if p == nil || !p.Active || p.Score.IsNone() {
+			continue
+		}
+		score = battle.WhiteScores(col, []maybe.Maybe[uci.Score]{p.Score})[0]
+	}
+	s, ok := score.TryGet()
+	if !ok {
+		return data
+	}
+	data.Has = true
+	data.WhitePercent = int(100 - evalGraphY(s)/evalGraphHeight*100)
+	data.Score = s.String()
+	return data
+}
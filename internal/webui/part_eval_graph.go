@@ -0,0 +1,85 @@
+package webui
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/day20/internal/delta"
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/uci"
+	"github.com/alex65536/go-chess/util/maybe"
+)
+
+const (
+	evalGraphWidth  = 1000
+	evalGraphHeight = 200
+	evalGraphClamp  = 1000 // centipawns
+)
+
+type evalGraphPartData struct {
+	Has       bool
+	Width     int
+	Height    int
+	ZeroY     int
+	WhitePath string
+	BlackPath string
+	AJAXAttrs template.HTMLAttr
+}
+
+func evalGraphY(sc uci.Score) float64 {
+	var v float64
+	if sc.IsMate() {
+		v = evalGraphClamp
+		if sc.IsLoseMate() {
+			v = -evalGraphClamp
+		}
+	} else {
+		cp, _ := sc.Centipawns()
+		v = max(-evalGraphClamp, min(evalGraphClamp, float64(cp)))
+	}
+	half := float64(evalGraphHeight) / 2
+	return half - v/evalGraphClamp*half
+}
+
+func buildEvalGraphPartData(startSide chess.Color, scores []maybe.Maybe[uci.Score]) *evalGraphPartData {
+	data := &evalGraphPartData{
+		Has:    false,
+		Width:  evalGraphWidth,
+		Height: evalGraphHeight,
+		ZeroY:  evalGraphHeight / 2,
+	}
+	if len(scores) == 0 {
+		return data
+	}
+
+	whiteScores := battle.WhiteScores(startSide, scores)
+	var paths [chess.ColorMax]strings.Builder
+	var started [chess.ColorMax]bool
+	side := startSide
+	for i, sc := range whiteScores {
+		b := &paths[side]
+		if s, ok := sc.TryGet(); ok {
+			cmd := "L"
+			if !started[side] {
+				cmd = "M"
+				started[side] = true
+			}
+			x := float64(i+1) / float64(len(whiteScores)) * evalGraphWidth
+			fmt.Fprintf(b, "%v%.1f %.1f ", cmd, x, evalGraphY(s))
+			data.Has = true
+		}
+		side = side.Inv()
+	}
+	data.WhitePath = strings.TrimSpace(paths[chess.ColorWhite].String())
+	data.BlackPath = strings.TrimSpace(paths[chess.ColorBlack].String())
+	return data
+}
+
+func buildRoomEvalGraphPartData(state *delta.JobState) *evalGraphPartData {
+	if state == nil || state.Info == nil || state.Moves == nil {
+		return buildEvalGraphPartData(chess.ColorWhite, nil)
+	}
+	return buildEvalGraphPartData(state.Info.StartPos.Side, state.Moves.Scores)
+}
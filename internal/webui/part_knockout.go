@@ -0,0 +1,89 @@
+package webui
+
+import (
+	"strconv"
+
+	"github.com/alex65536/day20/internal/scheduler"
+)
+
+type knockoutTieItem struct {
+	First       string
+	Second      string
+	FirstScore  string
+	SecondScore string
+	Played      int64
+	Extra       int64
+	FirstWon    bool
+	SecondWon   bool
+	Bye         bool
+}
+
+type knockoutRoundItem struct {
+	Name string
+	Ties []knockoutTieItem
+}
+
+type knockoutPartData struct {
+	Players []string
+	Winner  string
+	Rounds  []knockoutRoundItem
+}
+
+func knockoutRoundName(round, rounds int) string {
+	switch rounds - round {
+	case 1:
+		return "Final"
+	case 2:
+		return "Semifinals"
+	case 3:
+		return "Quarterfinals"
+	default:
+		return "Round " + strconv.Itoa(round+1)
+	}
+}
+
+func buildKnockoutPartData(info *scheduler.ContestInfo, data *scheduler.ContestData) *knockoutPartData {
+	playerName := func(p int) string {
+		if p < 0 {
+			return "TBD"
+		}
+		return info.Players[p].Name
+	}
+	bracket := data.Knockout.Bracket
+	d := &knockoutPartData{
+		Players: make([]string, len(info.Players)),
+		Rounds:  make([]knockoutRoundItem, len(bracket)),
+	}
+	for i, p := range info.Players {
+		d.Players[i] = p.Name
+	}
+	if w := data.Knockout.Winner(); w >= 0 {
+		d.Winner = info.Players[w].Name
+	}
+	for r, round := range bracket {
+		item := knockoutRoundItem{
+			Name: knockoutRoundName(r, len(bracket)),
+			Ties: make([]knockoutTieItem, len(round)),
+		}
+		for i, t := range round {
+			tie := knockoutTieItem{
+				First:  playerName(t.First),
+				Second: playerName(t.Second),
+				Played: t.Played,
+				Extra:  t.Extra,
+				Bye:    t.Bye,
+			}
+			if t.Played != 0 {
+				tie.FirstScore = halfPointsString(t.FirstScore)
+				tie.SecondScore = halfPointsString(t.SecondScore)
+			}
+			if t.Winner >= 0 && !t.Bye {
+				tie.FirstWon = t.Winner == t.First
+				tie.SecondWon = t.Winner == t.Second
+			}
+			item.Ties[i] = tie
+		}
+		d.Rounds[r] = item
+	}
+	return d
+}
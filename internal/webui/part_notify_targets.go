@@ -0,0 +1,118 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/alex65536/day20/internal/notify"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/sliceutil"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/gorilla/csrf"
+)
+
+type notifyTargetItem struct {
+	ID        string
+	Kind      notify.TargetKind
+	Address   string
+	CanDelete bool
+}
+
+type notifyTargetsPartData struct {
+	URL       string
+	CSRFField template.HTML
+	Kinds     []notify.TargetKind
+	Targets   []notifyTargetItem
+}
+
+func canEditNotifyTargets(user *userauth.User) bool {
+	return user != nil && user.Perms.Get(userauth.PermRunContests)
+}
+
+func canDeleteNotifyTarget(user *userauth.User, target *notify.Target) bool {
+	return canEditNotifyTargets(user) && (target.UserID == user.ID || user.Perms.Get(userauth.PermAdmin))
+}
+
+func buildNotifyTargetsPartData(bc builderCtx, url string, targets []notify.Target) *notifyTargetsPartData {
+	return &notifyTargetsPartData{
+		URL:       url,
+		CSRFField: csrf.TemplateField(bc.Req),
+		Kinds:     bc.Config.Notifier.Kinds(),
+		Targets: sliceutil.Map(targets, func(t notify.Target) notifyTargetItem {
+			return notifyTargetItem{
+				ID:        t.ID,
+				Kind:      t.Kind,
+				Address:   t.Address,
+				CanDelete: canDeleteNotifyTarget(bc.FullUser, &t),
+			}
+		}),
+	}
+}
+
+// handleNotifyTargetAction handles "notify-add" and "notify-delete" form actions. If contestID is
+// nil, then the target is added for all the contests.
+func handleNotifyTargetAction(ctx context.Context, bc builderCtx, contestID *string, redirect string) (any, error) {
+	cfg := bc.Config
+	req := bc.Req
+	log := bc.Log
+	user := bc.FullUser
+
+	if !canEditNotifyTargets(user) {
+		return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+	}
+	switch req.FormValue("action") {
+	case "notify-add":
+		kind, ok := notify.TargetKindFromString(req.FormValue("kind"))
+		if !ok {
+			return &errorsPartData{Errors: []string{"unknown notification kind"}}, nil
+		}
+		address := strings.TrimSpace(req.FormValue("address"))
+		if kind == notify.TargetEmail {
+			// Emails are sent only to the user's own verified address, so no one can be spammed.
+			if user.Email == "" || !user.EmailVerified {
+				return &errorsPartData{Errors: []string{"verify your email in profile first"}}, nil
+			}
+			if address == "" {
+				address = user.Email
+			}
+			if address != user.Email {
+				return &errorsPartData{Errors: []string{"only your verified email can be used"}}, nil
+			}
+		}
+		if err := kind.ValidateAddress(address); err != nil {
+			return &errorsPartData{Errors: []string{err.Error()}}, nil
+		}
+		if err := cfg.Notifier.AddTarget(ctx, user.ID, contestID, kind, address); err != nil {
+			log.Warn("could not add notify target", slogx.Err(err))
+			return &errorsPartData{Errors: []string{"could not add notification"}}, nil
+		}
+		return nil, bc.Redirect(redirect)
+	case "notify-delete":
+		target, err := cfg.Notifier.GetTarget(ctx, req.FormValue("target-id"))
+		if err != nil {
+			if errors.Is(err, notify.ErrNoSuchTarget) {
+				return nil, httputil.MakeError(http.StatusNotFound, "notification not found")
+			}
+			log.Warn("could not get notify target", slogx.Err(err))
+			return nil, fmt.Errorf("get notify target: %w", err)
+		}
+		if (target.ContestID == nil) != (contestID == nil) || (contestID != nil && *target.ContestID != *contestID) {
+			return nil, httputil.MakeError(http.StatusNotFound, "notification not found")
+		}
+		if !canDeleteNotifyTarget(user, &target) {
+			return nil, httputil.MakeError(http.StatusForbidden, "operation not permitted")
+		}
+		if err := cfg.Notifier.DeleteTarget(ctx, target.ID); err != nil {
+			log.Warn("could not delete notify target", slogx.Err(err))
+			return nil, fmt.Errorf("delete notify target: %w", err)
+		}
+		return nil, bc.Redirect(redirect)
+	default:
+		return nil, httputil.MakeError(http.StatusBadRequest, "unknown action")
+	}
+}
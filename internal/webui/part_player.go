@@ -1,6 +1,7 @@
 package webui
 
 import (
+	"fmt"
 	"html/template"
 
 	"github.com/alex65536/day20/internal/delta"
@@ -21,12 +22,24 @@ type playerPartData struct {
 	Clock     *playerClockData
 	Score     string
 	PV        string
+	Lines     []playerLineData
 	Depth     int64
+	SelDepth  int64
 	Nodes     int64
 	NPS       int64
+	HashFull  string
+	TBHits    int64
+	CurMove   string
+	// BestMove is the first move of PV in UCI notation. It is drawn as an arrow on the board.
+	BestMove  string
 	AJAXAttrs template.HTMLAttr
 }
 
+type playerLineData struct {
+	Score string
+	PV    string
+}
+
 func colorText(col chess.Color) string {
 	if col == chess.ColorWhite {
 		return "White"
@@ -70,8 +83,37 @@ func buildPlayerPartData(col chess.Color, state *delta.JobState) *playerPartData
 		data.Score = s.String()
 	}
 	data.PV = player.PVS
+	if len(player.PV) != 0 {
+		data.BestMove = player.PV[0].String()
+	}
+	if len(player.Lines) > 1 {
+		data.Lines = make([]playerLineData, len(player.Lines))
+		for i, l := range player.Lines {
+			line := playerLineData{Score: "-", PV: l.PVS}
+			if i == 0 && l.PVS == "" {
+				// The first line may be not received yet, but it is the same as the main one.
+				line.PV = player.PVS
+				l.Score = player.Score
+			}
+			if s, ok := l.Score.TryGet(); ok {
+				line.Score = s.String()
+			}
+			data.Lines[i] = line
+		}
+	}
 	data.Depth = player.Depth
+	data.SelDepth = player.SelDepth
 	data.Nodes = player.Nodes
 	data.NPS = player.NPS
+	if h, ok := player.HashFull.TryGet(); ok {
+		data.HashFull = fmt.Sprintf("%.1f%%", h*100)
+	}
+	data.TBHits = player.TBHits
+	if player.CurMove != "" {
+		data.CurMove = player.CurMove
+		if player.CurMoveNumber != 0 {
+			data.CurMove = fmt.Sprintf("%v (#%v)", player.CurMove, player.CurMoveNumber)
+		}
+	}
 	return data
 }
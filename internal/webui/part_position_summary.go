@@ -0,0 +1,37 @@
+package webui
+
+import (
+	"fmt"
+	"html/template"
+
+	"github.com/alex65536/day20/internal/delta"
+)
+
+type positionSummaryPartData struct {
+	MoveNumber int
+	Material   string
+	AJAXAttrs  template.HTMLAttr
+}
+
+func formatMaterial(m int) string {
+	switch {
+	case m == 0:
+		return "equal material"
+	case m == 1:
+		return "+1 pawn"
+	case m == -1:
+		return "-1 pawn"
+	default:
+		return fmt.Sprintf("%+d pawns", m)
+	}
+}
+
+func buildPositionSummaryPartData(state *delta.JobState) *positionSummaryPartData {
+	data := &positionSummaryPartData{}
+	if state == nil || state.Position == nil || state.Position.Board == nil {
+		return data
+	}
+	data.MoveNumber = state.Position.MoveNumber()
+	data.Material = formatMaterial(state.Position.Material())
+	return data
+}
@@ -0,0 +1,64 @@
+package webui
+
+import (
+	"time"
+
+	"github.com/alex65536/day20/internal/roomkeeper"
+	"github.com/alex65536/day20/internal/scheduler"
+)
+
+type retryFailureItem struct {
+	JobID  string
+	RoomID string
+	Kind   roomkeeper.JobStatusKind
+	Reason string
+	At     *humanTimePartData
+}
+
+type retryItem struct {
+	White    string
+	Black    string
+	Attempts int64
+	Aborted  int64
+	Failed   int64
+	Recent   []retryFailureItem
+}
+
+type retriesPartData struct {
+	Items []retryItem
+}
+
+// buildRetriesPartData lists the schedule keys for which some of the attempts were unsuccessful.
+// It returns nil if there are no such keys.
+func buildRetriesPartData(info *scheduler.ContestInfo, data *scheduler.ContestData) *retriesPartData {
+	now := time.Now()
+	var items []retryItem
+	for _, r := range data.Retries {
+		if !r.HasFailures() {
+			continue
+		}
+		item := retryItem{
+			White:    info.Players[r.WhiteID].Name,
+			Black:    info.Players[r.BlackID].Name,
+			Attempts: r.Attempts,
+			Aborted:  r.Aborted,
+			Failed:   r.Failed,
+		}
+		// Show the latest failures first.
+		for i := len(r.Recent) - 1; i >= 0; i-- {
+			f := r.Recent[i]
+			item.Recent = append(item.Recent, retryFailureItem{
+				JobID:  f.JobID,
+				RoomID: f.RoomID,
+				Kind:   f.Kind,
+				Reason: f.Reason,
+				At:     buildHumanTimePartData(now, f.At),
+			})
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return &retriesPartData{Items: items}
+}
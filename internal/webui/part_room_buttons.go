@@ -7,5 +7,6 @@ import (
 type roomButtonsPartData struct {
 	RoomID    string
 	Active    bool
+	LastJobID string
 	AJAXAttrs template.HTMLAttr
 }
@@ -0,0 +1,10 @@
+package webui
+
+import (
+	"html/template"
+)
+
+type spectatorsPartData struct {
+	Count     int64
+	AJAXAttrs template.HTMLAttr
+}
@@ -0,0 +1,104 @@
+package webui
+
+import (
+	"strconv"
+
+	"github.com/alex65536/day20/internal/scheduler"
+)
+
+type swissStandingItem struct {
+	Rank     int
+	Name     string
+	Score    string
+	Buchholz string
+	Wins     int64
+	Draws    int64
+	Losses   int64
+}
+
+type swissGameItem struct {
+	White  string
+	Black  string
+	Result string
+}
+
+type swissRoundItem struct {
+	Round     int
+	Games     []swissGameItem
+	Bye       string
+	Standings []swissStandingItem
+}
+
+type swissPartData struct {
+	Round     int
+	Rounds    int64
+	Players   []string
+	Standings []swissStandingItem
+	History   []swissRoundItem
+}
+
+// halfPointsString formats the score given in half-points.
+func halfPointsString(v int64) string {
+	return strconv.FormatFloat(float64(v)/2, 'f', -1, 64)
+}
+
+func swissResultString(result int) string {
+	switch result {
+	case 1:
+		return "0-1"
+	case 2:
+		return "1/2-1/2"
+	case 3:
+		return "1-0"
+	default:
+		return "*"
+	}
+}
+
+func buildSwissStandingItems(info *scheduler.ContestInfo, standings []scheduler.SwissStanding) []swissStandingItem {
+	res := make([]swissStandingItem, len(standings))
+	for i, st := range standings {
+		res[i] = swissStandingItem{
+			Rank:     i + 1,
+			Name:     info.Players[st.Player].Name,
+			Score:    halfPointsString(st.Score),
+			Buchholz: halfPointsString(st.Buchholz),
+			Wins:     st.Wins,
+			Draws:    st.Draws,
+			Losses:   st.Losses,
+		}
+	}
+	return res
+}
+
+func buildSwissPartData(info *scheduler.ContestInfo, data *scheduler.ContestData) *swissPartData {
+	d := &swissPartData{
+		Round:     data.Swiss.Round(),
+		Rounds:    info.Swiss.Rounds,
+		Players:   make([]string, len(info.Players)),
+		Standings: buildSwissStandingItems(info, data.Swiss.LastStandings()),
+	}
+	for i, p := range info.Players {
+		d.Players[i] = p.Name
+	}
+	// Show the latest rounds first.
+	for i := len(data.Swiss.History) - 1; i >= 0; i-- {
+		r := data.Swiss.History[i]
+		item := swissRoundItem{Round: i + 1}
+		for _, p := range r.Pairings {
+			item.Games = append(item.Games, swissGameItem{
+				White:  info.Players[p.White].Name,
+				Black:  info.Players[p.Black].Name,
+				Result: swissResultString(p.Result),
+			})
+		}
+		if r.Bye >= 0 {
+			item.Bye = info.Players[r.Bye].Name
+		}
+		if i < len(data.Swiss.Standings) {
+			item.Standings = buildSwissStandingItems(info, data.Swiss.Standings[i])
+		}
+		d.History = append(d.History, item)
+	}
+	return d
+}
@@ -0,0 +1,152 @@
+package webui
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/alex65536/day20/internal/battle"
+	"github.com/alex65536/go-chess/chess"
+)
+
+const (
+	timeChartWidth  = 1000
+	timeChartHeight = 100
+	// A move is considered unusual if the engine spent on it a fraction of its remaining time
+	// which is much larger than its typical fraction during the game.
+	timeChartUnusualFactor  = 3.0
+	timeChartUnusualMinFrac = 0.1
+)
+
+type timeChartBar struct {
+	X       float64
+	Y       float64
+	Width   float64
+	Height  float64
+	Unusual bool
+	Title   string
+}
+
+type timeChartSide struct {
+	Name    string
+	Color   string
+	Total   string
+	MaxTime string
+	Bars    []timeChartBar
+}
+
+type timeChartPartData struct {
+	Has    bool
+	Width  int
+	Height int
+	Sides  []timeChartSide
+}
+
+type timeChartMove struct {
+	ply   int
+	spent time.Duration
+	// frac is the fraction of the available time spent on the move, or negative if unknown.
+	frac float64
+}
+
+func timeChartMedian(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	xs = slices.Clone(xs)
+	slices.Sort(xs)
+	return xs[(len(xs)-1)/2]
+}
+
+func formatMoveTime(d time.Duration) string {
+	if d >= time.Minute {
+		return d.Round(time.Second).String()
+	}
+	return d.Round(10 * time.Millisecond).String()
+}
+
+func buildTimeChartPartData(g *battle.GameExt) *timeChartPartData {
+	data := &timeChartPartData{
+		Width:  timeChartWidth,
+		Height: timeChartHeight,
+	}
+	startPos := g.Game.StartPos()
+	var moves [chess.ColorMax][]timeChartMove
+	var lastClock [chess.ColorMax]time.Duration
+	var hasLastClock [chess.ColorMax]bool
+	side := startPos.Side
+	for i, maybeSpent := range g.Times {
+		spent, ok := maybeSpent.TryGet()
+		if ok {
+			frac := -1.0
+			if clk, ok := g.Clocks[i].TryGet(); ok {
+				avail := clk + spent
+				if hasLastClock[side] {
+					avail = lastClock[side]
+				}
+				if avail > 0 {
+					frac = min(1.0, float64(spent)/float64(avail))
+				}
+			}
+			moves[side] = append(moves[side], timeChartMove{ply: i, spent: spent, frac: frac})
+		}
+		if clk, ok := g.Clocks[i].TryGet(); ok {
+			lastClock[side] = clk
+			hasLastClock[side] = true
+		} else {
+			hasLastClock[side] = false
+		}
+		side = side.Inv()
+	}
+
+	plies := len(g.Times)
+	names := [chess.ColorMax]string{chess.ColorWhite: g.WhiteName, chess.ColorBlack: g.BlackName}
+	for _, col := range []chess.Color{chess.ColorWhite, chess.ColorBlack} {
+		sideMoves := moves[col]
+		if len(sideMoves) == 0 {
+			continue
+		}
+		data.Has = true
+
+		var maxSpent, total time.Duration
+		var fracs []float64
+		for _, m := range sideMoves {
+			maxSpent = max(maxSpent, m.spent)
+			total += m.spent
+			if m.frac >= 0 {
+				fracs = append(fracs, m.frac)
+			}
+		}
+		threshold := max(timeChartUnusualMinFrac, timeChartMedian(fracs)*timeChartUnusualFactor)
+
+		barWidth := float64(timeChartWidth) / float64(plies)
+		bars := make([]timeChartBar, 0, len(sideMoves))
+		for _, m := range sideMoves {
+			h := 0.0
+			if maxSpent > 0 {
+				h = float64(m.spent) / float64(maxSpent) * timeChartHeight
+			}
+			moveNo := int(startPos.MoveNumber) + (m.ply+int(startPos.Side))/2
+			title := fmt.Sprintf("Move %v: %v", moveNo, formatMoveTime(m.spent))
+			if m.frac >= 0 {
+				title += fmt.Sprintf(" (%.0f%% of remaining time)", m.frac*100)
+			}
+			bars = append(bars, timeChartBar{
+				X:       float64(m.ply) * barWidth,
+				Y:       timeChartHeight - h,
+				Width:   barWidth,
+				Height:  h,
+				Unusual: m.frac >= 0 && m.frac >= threshold,
+				Title:   title,
+			})
+		}
+		data.Sides = append(data.Sides, timeChartSide{
+			Name:    names[col],
+			Color:   colorText(col),
+			Total:   formatMoveTime(total),
+			MaxTime: formatMoveTime(maxSpent),
+			Bars:    bars,
+		})
+	}
+	return data
+}
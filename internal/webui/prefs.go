@@ -0,0 +1,29 @@
+package webui
+
+import (
+	"github.com/alex65536/day20/internal/userauth"
+)
+
+func userPrefs(u *userauth.User) userauth.Prefs {
+	if u == nil {
+		return userauth.Prefs{}
+	}
+	return u.Prefs
+}
+
+// boardThemeClass returns the CSS class which colors the chess boards according to the user
+// preferences.
+func boardThemeClass(u *userauth.User) string {
+	theme := userPrefs(u).BoardTheme
+	if theme == "" {
+		theme = userauth.BoardThemes[0]
+	}
+	return "board-theme-" + theme
+}
+
+func userGamesPageSize(u *userauth.User) int {
+	if n := userPrefs(u).GamesPerPage; n != 0 {
+		return n
+	}
+	return gamesPageSize
+}
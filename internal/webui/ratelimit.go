@@ -0,0 +1,138 @@
+package webui
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type RateLimitOptions struct {
+	Disable   bool          `toml:"disable"`
+	RPS       float64       `toml:"rps"`
+	Burst     int           `toml:"burst"`
+	AuthRPS   float64       `toml:"auth-rps"`
+	AuthBurst int           `toml:"auth-burst"`
+	IdleTTL   time.Duration `toml:"idle-ttl"`
+}
+
+func (o *RateLimitOptions) FillDefaults() {
+	if o.RPS == 0.0 {
+		o.RPS = 20
+	}
+	if o.Burst == 0 {
+		o.Burst = 40
+	}
+	if o.AuthRPS == 0.0 {
+		o.AuthRPS = 0.2
+	}
+	if o.AuthBurst == 0 {
+		o.AuthBurst = 5
+	}
+	if o.IdleTTL == 0 {
+		o.IdleTTL = 10 * time.Minute
+	}
+}
+
+type ipLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipRateLimiter keeps a separate token bucket for each client IP. Buckets that were not used for
+// a while are garbage collected.
+type ipRateLimiter struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	disabled bool
+	entries  map[string]*ipLimiterEntry
+}
+
+func newIPRateLimiter(ctx context.Context, limit float64, burst int, ttl time.Duration, disabled bool) *ipRateLimiter {
+	l := &ipRateLimiter{
+		limit:    rate.Limit(limit),
+		burst:    burst,
+		ttl:      ttl,
+		disabled: disabled,
+		entries:  make(map[string]*ipLimiterEntry),
+	}
+	go l.gcLoop(ctx)
+	return l
+}
+
+// SetLimit changes the limits, including the ones for the clients already seen.
+func (l *ipRateLimiter) SetLimit(limit float64, burst int, disabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = rate.Limit(limit)
+	l.burst = burst
+	l.disabled = disabled
+	now := time.Now()
+	for _, e := range l.entries {
+		e.limiter.SetLimitAt(now, l.limit)
+		e.limiter.SetBurstAt(now, l.burst)
+	}
+}
+
+// RateLimiter allows changing the rate limits of the running web UI.
+type RateLimiter struct {
+	limiter     *ipRateLimiter
+	authLimiter *ipRateLimiter
+}
+
+func (r *RateLimiter) SetOptions(o RateLimitOptions) {
+	o.FillDefaults()
+	r.limiter.SetLimit(o.RPS, o.Burst, o.Disable)
+	r.authLimiter.SetLimit(o.AuthRPS, o.AuthBurst, o.Disable)
+}
+
+func (l *ipRateLimiter) gcLoop(ctx context.Context) {
+	ticker := time.NewTicker(l.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.gc()
+		}
+	}
+}
+
+func (l *ipRateLimiter) gc() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for ip, e := range l.entries {
+		if now.Sub(e.lastSeen) > l.ttl {
+			delete(l.entries, ip)
+		}
+	}
+}
+
+// Allow reports whether the request from the given IP may proceed. If not, it also returns the
+// time after which the client may retry.
+func (l *ipRateLimiter) Allow(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.disabled {
+		return true, 0
+	}
+	now := time.Now()
+	e, ok := l.entries[ip]
+	if !ok {
+		e = &ipLimiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.entries[ip] = e
+	}
+	e.lastSeen = now
+	if e.limiter.AllowN(now, 1) {
+		return true, 0
+	}
+	retry := time.Duration(math.Ceil(1.0/float64(l.limit))) * time.Second
+	return false, retry
+}
@@ -0,0 +1,230 @@
+package webui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+
+	"github.com/alex65536/day20/internal/delta"
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/go-chess/chess"
+	"github.com/alex65536/go-chess/util/maybe"
+	"golang.org/x/time/rate"
+)
+
+// roomStream renders the updates of the room as HTMX fragments and sends them to the client. It
+// doesn't depend on the transport, so it is shared by websocket and SSE handlers.
+type roomStream struct {
+	ctx    context.Context
+	log    *slog.Logger
+	cfg    *Config
+	tmpl   *template.Template
+	roomID string
+	viewer scheduler.Viewer
+	// overlay means that the stream renders the fragments of the stream overlay page instead of
+	// the full room page.
+	overlay bool
+
+	// send sends one message to the client.
+	send func(msg []byte) error
+	// shutdown gracefully closes the connection after an error.
+	shutdown func()
+}
+
+func parseRoomCursor(msg []byte) (delta.RoomCursor, error) {
+	var data struct {
+		C delta.RoomCursor `json:"c"`
+	}
+	if err := json.Unmarshal(msg, &data); err != nil {
+		return delta.RoomCursor{}, fmt.Errorf("unmarshal cursor: %w", err)
+	}
+	return data.C, nil
+}
+
+func (s *roomStream) shutdownWithPageRefresh() {
+	var b bytes.Buffer
+	cursorData := buildCursorPartData(s.log, maybe.None[delta.RoomCursor](), true)
+	cursorData.AJAXAttrs = template.HTMLAttr(`hx-swap-oob="outerHTML"`)
+	if err := s.tmpl.ExecuteTemplate(&b, "part/cursor", cursorData); err != nil {
+		s.log.Error("could not render cursor", slogx.Err(err))
+		s.shutdown()
+		return
+	}
+	if err := s.send(b.Bytes()); err != nil {
+		s.log.Info("could not write message", slogx.Err(err))
+		return
+	}
+	s.shutdown()
+}
+
+func (s *roomStream) renderAndSend(fragment string, cursor delta.RoomCursor, data any) bool {
+	var b bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&b, fragment, data); err != nil {
+		s.log.Error("could not render fragment", slogx.Err(err))
+		s.shutdown()
+		return false
+	}
+	_ = b.WriteByte('\n')
+	cursorData := buildCursorPartData(s.log, maybe.Some(cursor), false)
+	cursorData.AJAXAttrs = template.HTMLAttr(`hx-swap-oob="outerHTML"`)
+	if err := s.tmpl.ExecuteTemplate(&b, "part/cursor", cursorData); err != nil {
+		s.log.Error("could not render cursor", slogx.Err(err))
+		s.shutdown()
+		return false
+	}
+	if err := s.send(b.Bytes()); err != nil {
+		s.log.Info("could not write message", slogx.Err(err))
+		return false
+	}
+	return true
+}
+
+func (s *roomStream) Run(clientCursor delta.RoomCursor) {
+	log := s.log
+	roomID := s.roomID
+
+	sub, unsub, ok := s.cfg.Keeper.Subscribe(roomID)
+	if !ok {
+		s.shutdownWithPageRefresh()
+		return
+	}
+	defer unsub()
+
+	limit := rate.NewLimiter(rate.Limit(s.cfg.opts.RoomRPSLimit), s.cfg.opts.RoomRPSBurst)
+	state := delta.NewRoomState()
+	visibleJobID := ""
+	for {
+		ourDelta, _, err := s.cfg.Keeper.RoomStateDelta(roomID, state.Cursor())
+		if err != nil {
+			if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
+				s.shutdownWithPageRefresh()
+				return
+			}
+			log.Warn("could not get room state delta", slogx.Err(err))
+			s.shutdown()
+			return
+		}
+		if err := state.ApplyDelta(ourDelta); err != nil {
+			log.Warn("could not apply room state delta", slogx.Err(err))
+			s.shutdown()
+			return
+		}
+
+		// The room may start the job of the contest hidden from the viewer. Then the page is
+		// refreshed, so the viewer gets the not found error instead of the game.
+		if jobID := state.Cursor().JobID; jobID != "" && jobID != visibleJobID {
+			canView, err := canViewRunningJob(s.ctx, s.cfg, s.viewer, jobID)
+			if err != nil {
+				log.Warn("could not check job visibility", slogx.Err(err))
+				s.shutdown()
+				return
+			}
+			if !canView {
+				s.shutdownWithPageRefresh()
+				return
+			}
+			visibleJobID = jobID
+		}
+
+		oldClientCursor := clientCursor
+		clientCursor = state.Cursor()
+
+		if !s.overlay && (oldClientCursor.JobID != clientCursor.JobID ||
+			oldClientCursor.LastJobID != clientCursor.LastJobID) {
+			roomButtonsData := &roomButtonsPartData{
+				RoomID:    roomID,
+				Active:    clientCursor.JobID != "",
+				LastJobID: clientCursor.LastJobID,
+				AJAXAttrs: template.HTMLAttr(`hx-swap-oob="outerHTML"`),
+			}
+			if !s.renderAndSend("part/room_buttons", clientCursor, roomButtonsData) {
+				return
+			}
+		}
+
+		if oldClientCursor.JobID != clientCursor.JobID ||
+			oldClientCursor.State.Position != clientCursor.State.Position {
+			var board *chess.Board
+			if state.State != nil {
+				board = state.State.Position.Board
+			}
+			fenData := buildFENPartData(board)
+			fenData.AJAXAttrs = template.HTMLAttr(`hx-swap-oob="outerHTML"`)
+			if !s.renderAndSend("part/fen", clientCursor, fenData) {
+				return
+			}
+		}
+
+		if !s.overlay && (oldClientCursor.JobID != clientCursor.JobID ||
+			oldClientCursor.State.Position != clientCursor.State.Position) {
+			summaryData := buildPositionSummaryPartData(state.State)
+			summaryData.AJAXAttrs = template.HTMLAttr(`hx-swap-oob="outerHTML"`)
+			if !s.renderAndSend("part/position_summary", clientCursor, summaryData) {
+				return
+			}
+		}
+
+		if !s.overlay && (oldClientCursor.JobID != clientCursor.JobID ||
+			oldClientCursor.State.Moves != clientCursor.State.Moves ||
+			oldClientCursor.State.HasInfo != clientCursor.State.HasInfo) {
+			evalData := buildRoomEvalGraphPartData(state.State)
+			evalData.AJAXAttrs = template.HTMLAttr(`hx-swap-oob="outerHTML"`)
+			if !s.renderAndSend("part/eval_graph", clientCursor, evalData) {
+				return
+			}
+		}
+
+		if !s.overlay && oldClientCursor.Spectators != clientCursor.Spectators {
+			spectatorsData := &spectatorsPartData{
+				Count:     clientCursor.Spectators,
+				AJAXAttrs: template.HTMLAttr(`hx-swap-oob="outerHTML"`),
+			}
+			if !s.renderAndSend("part/spectators", clientCursor, spectatorsData) {
+				return
+			}
+		}
+
+		for col := range chess.ColorMax {
+			if oldClientCursor.JobID == clientCursor.JobID &&
+				oldClientCursor.State.Player(col) == clientCursor.State.Player(col) &&
+				oldClientCursor.State.HasInfo == clientCursor.State.HasInfo {
+				continue
+			}
+			playerData := buildPlayerPartData(col, state.State)
+			playerData.AJAXAttrs = template.HTMLAttr(`hx-swap-oob="outerHTML"`)
+			fragment := "part/player"
+			if s.overlay {
+				fragment = "part/overlay_player"
+			}
+			if !s.renderAndSend(fragment, clientCursor, playerData) {
+				return
+			}
+		}
+
+		if oldClientCursor.JobID != clientCursor.JobID ||
+			oldClientCursor.State.Moves != clientCursor.State.Moves ||
+			oldClientCursor.State.HasInfo != clientCursor.State.HasInfo ||
+			oldClientCursor.State.White != clientCursor.State.White ||
+			oldClientCursor.State.Black != clientCursor.State.Black {
+			evalBarData := buildEvalBarPartData(state.State)
+			evalBarData.AJAXAttrs = template.HTMLAttr(`hx-swap-oob="outerHTML"`)
+			if !s.renderAndSend("part/eval_bar", clientCursor, evalBarData) {
+				return
+			}
+		}
+
+		if err := limit.Wait(s.ctx); err != nil {
+			return
+		}
+		select {
+		case <-sub:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package webui
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex65536/day20/internal/util/httputil"
+)
+
+// defaultCSP allows inline scripts and eval, as templates contain inline scripts and HTMX evaluates
+// hx-on attributes. 'self' in connect-src also covers same-origin websockets.
+const defaultCSP = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' 'unsafe-eval'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data:; " +
+	"connect-src 'self'; " +
+	"object-src 'none'; " +
+	"base-uri 'self'; " +
+	"form-action 'self'; " +
+	"frame-ancestors 'none'"
+
+type SecurityHeadersOptions struct {
+	Disable               bool          `toml:"disable"`
+	ContentSecurityPolicy string        `toml:"content-security-policy"`
+	ReferrerPolicy        string        `toml:"referrer-policy"`
+	HSTSMaxAge            time.Duration `toml:"hsts-max-age"`
+	HSTSIncludeSubdomains bool          `toml:"hsts-include-subdomains"`
+	DisableHSTS           bool          `toml:"disable-hsts"`
+	// EmbedFrameAncestors are the sources which may embed the widgets from /embed/ into frames.
+	// Other pages can never be framed. Any site may embed the widgets by default, and empty list
+	// forbids embedding at all.
+	EmbedFrameAncestors []string `toml:"embed-frame-ancestors"`
+}
+
+func (o *SecurityHeadersOptions) FillDefaults() {
+	if o.ContentSecurityPolicy == "" {
+		o.ContentSecurityPolicy = defaultCSP
+	}
+	if o.ReferrerPolicy == "" {
+		o.ReferrerPolicy = "strict-origin-when-cross-origin"
+	}
+	if o.HSTSMaxAge == 0 {
+		o.HSTSMaxAge = 365 * 24 * time.Hour
+	}
+	if o.EmbedFrameAncestors == nil {
+		o.EmbedFrameAncestors = []string{"*"}
+	}
+}
+
+// embedCSP replaces frame-ancestors directive in the policy, so the embeddable widgets are allowed
+// to be framed.
+func (o *SecurityHeadersOptions) embedCSP() string {
+	var directives []string
+	for _, d := range strings.Split(o.ContentSecurityPolicy, ";") {
+		d = strings.TrimSpace(d)
+		if d == "" || strings.HasPrefix(d, "frame-ancestors") {
+			continue
+		}
+		directives = append(directives, d)
+	}
+	ancestors := "'none'"
+	if len(o.EmbedFrameAncestors) != 0 {
+		ancestors = strings.Join(o.EmbedFrameAncestors, " ")
+	}
+	directives = append(directives, "frame-ancestors "+ancestors)
+	return strings.Join(directives, "; ")
+}
+
+func (o *SecurityHeadersOptions) hstsValue() string {
+	val := "max-age=" + strconv.FormatInt(int64(o.HSTSMaxAge.Seconds()), 10)
+	if o.HSTSIncludeSubdomains {
+		val += "; includeSubDomains"
+	}
+	return val
+}
+
+func (o *SecurityHeadersOptions) apply(w http.ResponseWriter, req *http.Request, embed bool) {
+	if o.Disable {
+		return
+	}
+	h := w.Header()
+	if embed {
+		// X-Frame-Options cannot allow arbitrary origins, so rely on CSP only.
+		h.Set("Content-Security-Policy", o.embedCSP())
+	} else {
+		h.Set("Content-Security-Policy", o.ContentSecurityPolicy)
+		h.Set("X-Frame-Options", "DENY")
+	}
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Referrer-Policy", o.ReferrerPolicy)
+	// Browsers ignore HSTS over plain HTTP, so send it only for HTTPS requests.
+	if !o.DisableHSTS && httputil.IsSecureRequest(req) {
+		h.Set("Strict-Transport-Security", o.hstsValue())
+	}
+}
@@ -0,0 +1,161 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/idgen"
+	"github.com/alex65536/day20/internal/util/slogx"
+	"github.com/alex65536/day20/internal/util/timeutil"
+	"github.com/gorilla/sessions"
+)
+
+// Last seen time is not updated more frequently than this to avoid writing into DB on every request.
+const sessionTouchInterval = 1 * time.Minute
+
+func newSessionRecord(req *http.Request, userID string) userauth.Session {
+	now := timeutil.NowUTC()
+	userAgent := req.UserAgent()
+	if len(userAgent) > userauth.UserAgentMaxLen {
+		userAgent = userAgent[:userauth.UserAgentMaxLen]
+	}
+	return userauth.Session{
+		ID:         idgen.ID(),
+		UserID:     userID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		IP:         remoteIP(req),
+		UserAgent:  userAgent,
+	}
+}
+
+// trackSession checks that the session was not revoked and updates its last seen time. Sessions
+// created before session tracking was introduced get a new record.
+func trackSession(
+	ctx context.Context,
+	log *slog.Logger,
+	cfg *Config,
+	req *http.Request,
+	w http.ResponseWriter,
+	session *sessions.Session,
+	info *userInfo,
+) bool {
+	if info.SessionID == "" {
+		record := newSessionRecord(req, info.sessionOwnerID())
+		if err := cfg.UserManager.CreateSession(ctx, record); err != nil {
+			log.Error("could not create session record", slogx.Err(err))
+			return true
+		}
+		info.SessionID = record.ID
+		session.Values["user"] = *info
+		if err := session.Save(req, w); err != nil {
+			log.Error("could not save session", slogx.Err(err))
+		}
+		return true
+	}
+	record, err := cfg.UserManager.GetSession(ctx, info.SessionID)
+	if err != nil {
+		if errors.Is(err, userauth.ErrSessionNotFound) {
+			return false
+		}
+		log.Error("could not get session record", slogx.Err(err))
+		return true
+	}
+	if record.UserID != info.sessionOwnerID() {
+		return false
+	}
+	now := timeutil.NowUTC()
+	ip := remoteIP(req)
+	if now.UTC().Sub(record.LastSeenAt.UTC()) >= sessionTouchInterval || ip != record.IP {
+		if err := cfg.UserManager.TouchSession(ctx, record.ID, now, ip); err != nil {
+			log.Warn("could not update session record", slogx.Err(err))
+		}
+	}
+	return true
+}
+
+func isSessionRevoked(ctx context.Context, log *slog.Logger, cfg *Config, info *userInfo) bool {
+	if info.SessionID == "" {
+		return false
+	}
+	record, err := cfg.UserManager.GetSession(ctx, info.SessionID)
+	if err != nil {
+		if errors.Is(err, userauth.ErrSessionNotFound) {
+			return true
+		}
+		log.Error("could not get session record", slogx.Err(err))
+		return false
+	}
+	return record.UserID != info.sessionOwnerID()
+}
+
+// LogIn starts a new session for the user.
+func (bc *builderCtx) LogIn(ctx context.Context, user *userauth.User) {
+	info := makeUserInfo(user)
+	record := newSessionRecord(bc.Req, user.ID)
+	if err := bc.Config.UserManager.CreateSession(ctx, record); err != nil {
+		// The session will get a new record on the next request.
+		bc.Log.Error("could not create session record", slogx.Err(err))
+	} else {
+		info.SessionID = record.ID
+	}
+	bc.ResetSession(info)
+}
+
+// LogOut ends the current session and revokes it.
+func (bc *builderCtx) LogOut(ctx context.Context) {
+	session, _ := bc.Config.sessionStore.Get(bc.Req, sessionName)
+	if info, ok := session.Values["user"].(userInfo); ok && info.SessionID != "" {
+		if err := bc.Config.UserManager.DeleteSession(ctx, info.SessionID, info.sessionOwnerID()); err != nil {
+			bc.Log.Warn("could not delete session record", slogx.Err(err))
+		}
+	}
+	bc.ResetSession(nil)
+}
+
+func revokeOtherSessions(ctx context.Context, cfg *Config, userID string, keepID string) error {
+	records, err := cfg.UserManager.ListUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if r.ID == keepID {
+			continue
+		}
+		if err := cfg.UserManager.DeleteSession(ctx, r.ID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// secureAwareStore marks the session cookies as secure if the client uses HTTPS, even if the
+// cookies are configured as insecure. This matters when the server is behind a reverse proxy
+// which terminates TLS.
+type secureAwareStore struct {
+	sessions.Store
+	insecure bool
+}
+
+func (s *secureAwareStore) adjust(req *http.Request, session *sessions.Session) {
+	if session != nil && session.Options != nil {
+		session.Options.Secure = !s.insecure || httputil.IsSecureRequest(req)
+	}
+}
+
+func (s *secureAwareStore) Get(req *http.Request, name string) (*sessions.Session, error) {
+	session, err := s.Store.Get(req, name)
+	s.adjust(req, session)
+	return session, err
+}
+
+func (s *secureAwareStore) New(req *http.Request, name string) (*sessions.Session, error) {
+	session, err := s.Store.New(req, name)
+	s.adjust(req, session)
+	return session, err
+}
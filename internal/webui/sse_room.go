@@ -0,0 +1,148 @@
+package webui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+// Some proxies close idle connections, so we periodically send comments to keep the stream alive.
+const sseKeepAliveInterval = 30 * time.Second
+
+type sseWriter struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (w *sseWriter) write(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.w.Write(data); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := w.rc.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	return nil
+}
+
+func (w *sseWriter) SendEvent(msg []byte) error {
+	var b bytes.Buffer
+	for _, line := range bytes.Split(msg, []byte("\n")) {
+		_, _ = b.WriteString("data: ")
+		_, _ = b.Write(line)
+		_ = b.WriteByte('\n')
+	}
+	_ = b.WriteByte('\n')
+	return w.write(b.Bytes())
+}
+
+func (w *sseWriter) SendKeepAlive() error {
+	return w.write([]byte(": keep-alive\n\n"))
+}
+
+type roomSSEImpl struct {
+	log     *slog.Logger
+	cfg     *Config
+	tmpl    localizedTemplate
+	overlay bool
+}
+
+func roomSSE(log *slog.Logger, cfg *Config, templator *templator, overlay bool) (http.Handler, error) {
+	tmpl, err := templator.Get("")
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	return &roomSSEImpl{
+		log:     log,
+		cfg:     cfg,
+		tmpl:    tmpl,
+		overlay: overlay,
+	}, nil
+}
+
+func (s *roomSSEImpl) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := s.log.With(slog.String("rid", httputil.ExtractReqID(ctx)))
+	log.Info("handle room sse", slog.String("addr", req.RemoteAddr))
+
+	if req.Method != http.MethodGet {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+	rawCursor := req.URL.Query().Get("cursor")
+	if rawCursor == "" {
+		rawCursor = "{}"
+	}
+	clientCursor, err := parseRoomCursor([]byte(rawCursor))
+	if err != nil {
+		writeHTTPErr(log, w, httputil.MakeError(http.StatusBadRequest, "bad cursor"))
+		return
+	}
+
+	roomID := req.PathValue("roomID")
+	viewer := requestViewer(ctx, log, s.cfg, req)
+	if err := checkRoomVisible(ctx, log, s.cfg, viewer, roomID); err != nil {
+		writeHTTPErr(log, w, err)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	sw := &sseWriter{w: w, rc: http.NewResponseController(w)}
+	if err := sw.SendKeepAlive(); err != nil {
+		log.Info("could not start event stream", slogx.Err(err))
+		return
+	}
+
+	drainCh, release := httputil.TrackDrain(ctx)
+	defer release()
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(sseKeepAliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-drainCh:
+				// Finish the response, so the client reconnects to the restarted server.
+				cancel()
+				return
+			case <-ticker.C:
+				if err := sw.SendKeepAlive(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	stream := &roomStream{
+		ctx:     ctx,
+		log:     log,
+		cfg:     s.cfg,
+		tmpl:    s.tmpl.For(sessionLang(s.cfg, req)),
+		roomID:  roomID,
+		viewer:  viewer,
+		overlay: s.overlay,
+		send:    sw.SendEvent,
+		// Just finish the response, the client will reconnect by itself.
+		shutdown: func() {},
+	}
+	stream.Run(clientCursor)
+}
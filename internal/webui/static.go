@@ -0,0 +1,49 @@
+package webui
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// staticHasher computes content hashes of static files. The hashes are used to fingerprint static
+// URLs, so such URLs can be cached forever.
+type staticHasher struct {
+	fsys   fs.FS
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+func newStaticHasher(fsys fs.FS) *staticHasher {
+	return &staticHasher{
+		fsys:   fsys,
+		hashes: make(map[string]string),
+	}
+}
+
+// Hash returns the hash of the file with the given URL path. Empty string is returned if there is
+// no such file.
+func (h *staticHasher) Hash(path string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hash, ok := h.hashes[path]; ok {
+		return hash
+	}
+	hash := ""
+	data, err := fs.ReadFile(h.fsys, strings.TrimPrefix(path, "/"))
+	if err == nil {
+		sum := sha256.Sum256(data)
+		hash = hex.EncodeToString(sum[:8])
+	}
+	h.hashes[path] = hash
+	return hash
+}
+
+func (h *staticHasher) IsFingerprinted(path string, version string) bool {
+	if version == "" {
+		return false
+	}
+	return h.Hash(path) == version
+}
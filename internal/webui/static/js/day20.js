@@ -42,6 +42,146 @@ function newClock(id) {
   }
 }
 
+// Draws an arrow for the move in UCI notation over the board. Any previous arrow is removed. The
+// arrow must be redrawn after the board is resized.
+function drawBoardArrow(id, move) {
+  var elt = document.getElementById(id)
+  var old = elt.querySelector('svg.board-arrow')
+  if (old) {
+    old.remove()
+  }
+  if (!move || move.length < 4) {
+    return
+  }
+  var from = elt.querySelector('[data-square="' + move.slice(0, 2) + '"]')
+  var to = elt.querySelector('[data-square="' + move.slice(2, 4) + '"]')
+  if (!from || !to) {
+    return
+  }
+
+  var base = elt.getBoundingClientRect()
+  function center(sq) {
+    var r = sq.getBoundingClientRect()
+    return {x: r.left - base.left + r.width / 2, y: r.top - base.top + r.height / 2, size: r.width}
+  }
+  var a = center(from)
+  var b = center(to)
+  var width = a.size * 0.15
+  // Stop the line before the target, so it doesn't stick out of the arrow head.
+  var len = Math.hypot(b.x - a.x, b.y - a.y)
+  if (len == 0) {
+    return
+  }
+  var head = width * 3
+  var k = Math.max(0, len - head) / len
+
+  var ns = 'http://www.w3.org/2000/svg'
+  var svg = document.createElementNS(ns, 'svg')
+  svg.setAttribute('class', 'board-arrow')
+  svg.setAttribute('width', base.width)
+  svg.setAttribute('height', base.height)
+  var line = document.createElementNS(ns, 'line')
+  line.setAttribute('x1', a.x)
+  line.setAttribute('y1', a.y)
+  line.setAttribute('x2', a.x + (b.x - a.x) * k)
+  line.setAttribute('y2', a.y + (b.y - a.y) * k)
+  line.setAttribute('stroke-width', width)
+  svg.appendChild(line)
+  var ux = (b.x - a.x) / len
+  var uy = (b.y - a.y) / len
+  var bx = b.x - ux * head
+  var by = b.y - uy * head
+  var poly = document.createElementNS(ns, 'polygon')
+  poly.setAttribute('points', [
+    b.x + ',' + b.y,
+    (bx - uy * head * 0.6) + ',' + (by + ux * head * 0.6),
+    (bx + uy * head * 0.6) + ',' + (by - ux * head * 0.6),
+  ].join(' '))
+  svg.appendChild(poly)
+  elt.appendChild(svg)
+}
+
+function newGameViewer(opts) {
+  var plies = opts.plies
+  var cur = plies.length - 1
+  var board = Chessboard(opts.board, {
+    draggable: false,
+    showNotation: true,
+    position: plies[cur].fen,
+    pieceTheme: '/img/piece/cburnett/{piece}.svg',
+  })
+  var fen = document.getElementById(opts.fen)
+  var moves = document.getElementById(opts.moves)
+
+  var moveElts = [null]
+  for (var i = 1; i < plies.length; ++i) {
+    var ply = plies[i]
+    if (ply.move_no) {
+      var no = document.createElement('span')
+      no.className = 'game-move-no'
+      no.textContent = ply.move_no
+      moves.appendChild(no)
+    }
+    var elt = document.createElement('span')
+    elt.className = 'game-move'
+    elt.textContent = ply.move
+    if (ply.score) {
+      var score = document.createElement('span')
+      score.className = 'game-move-score'
+      score.textContent = ply.score
+      elt.appendChild(score)
+    }
+    elt.addEventListener('click', (function(i) {
+      return function() { jump(i) }
+    })(i))
+    moves.appendChild(elt)
+    moveElts.push(elt)
+  }
+
+  function jump(pos) {
+    if (pos < 0 || pos >= plies.length) {
+      return
+    }
+    if (moveElts[cur]) {
+      moveElts[cur].classList.remove('active')
+    }
+    cur = pos
+    if (moveElts[cur]) {
+      moveElts[cur].classList.add('active')
+      moveElts[cur].scrollIntoView({block: 'nearest'})
+    }
+    board.position(plies[cur].fen)
+    fen.textContent = plies[cur].fen
+  }
+
+  document.getElementById(opts.first).addEventListener('click', function() { jump(0) })
+  document.getElementById(opts.prev).addEventListener('click', function() { jump(cur - 1) })
+  document.getElementById(opts.next).addEventListener('click', function() { jump(cur + 1) })
+  document.getElementById(opts.last).addEventListener('click', function() { jump(plies.length - 1) })
+  document.addEventListener('keydown', function(e) {
+    if (e.target.matches('input, textarea, select')) {
+      return
+    }
+    switch (e.key) {
+      case 'ArrowLeft': jump(cur - 1); break
+      case 'ArrowRight': jump(cur + 1); break
+      case 'Home': jump(0); break
+      case 'End': jump(plies.length - 1); break
+      default: return
+    }
+    e.preventDefault()
+  })
+  window.addEventListener('load', function() { board.resize() })
+  window.addEventListener('resize', function() { board.resize() })
+
+  jump(cur)
+
+  return {
+    jump: jump,
+    board: board,
+  }
+}
+
 function formToggle(data, opts) {
   data = data.map(function(item) {
     return item.map(function(sub) { return document.getElementById(sub) })
@@ -134,3 +274,97 @@ function toggleHTMXFormSubmit(elt, disabled) {
 // Disable submit buttons on forms while the request is in-flight.
 htmx.on('htmx:beforeSend', function(e) { toggleHTMXFormSubmit(e.detail.elt, true) })
 htmx.on('htmx:afterRequest', function(e) { toggleHTMXFormSubmit(e.detail.elt, false) })
+
+// Show upload progress on forms containing <progress class="upload-progress">.
+function uploadProgress(elt) {
+  if (!elt.matches('form.htmx-form')) {
+    return null
+  }
+  return elt.querySelector('progress.upload-progress')
+}
+
+htmx.on('htmx:xhr:progress', function(e) {
+  var progress = uploadProgress(e.target)
+  if (!progress || !e.detail.lengthComputable) {
+    return
+  }
+  progress.hidden = false
+  progress.max = e.detail.total
+  progress.value = e.detail.loaded
+})
+htmx.on('htmx:afterRequest', function(e) {
+  var progress = uploadProgress(e.detail.elt)
+  if (progress) {
+    progress.hidden = true
+  }
+})
+
+// Reject files larger than data-max-size before uploading them.
+document.addEventListener('change', function(e) {
+  var elt = e.target
+  if (!elt.matches || !elt.matches('input[type=file][data-max-size]')) {
+    return
+  }
+  var maxSize = parseInt(elt.getAttribute('data-max-size'))
+  var tooLarge = Array.from(elt.files).some(function(f) { return f.size > maxSize })
+  elt.setCustomValidity(tooLarge ? 'File is too large, at most ' + maxSize + ' bytes allowed' : '')
+  elt.reportValidity()
+})
+
+// Some proxies break websockets. If the websocket fails before receiving anything, stop reconnecting
+// and receive the same fragments via Server-Sent Events instead.
+function setupRoomEventsFallback(id) {
+  var elt = document.getElementById(id)
+  var eventsURL = elt.getAttribute('data-events-url')
+  var received = false
+  var failures = 0
+  var source = null
+
+  function connect() {
+    var holder = document.getElementById('cursor-holder')
+    var cursor = holder ? holder.getAttribute('hx-vals') : '{}'
+    source = new EventSource(eventsURL + '?cursor=' + encodeURIComponent(cursor))
+    source.onmessage = function(e) {
+      htmx.swap(elt, e.data, {swapStyle: 'none'})
+    }
+    source.onerror = function() {
+      // Reconnect with the fresh cursor instead of relying on EventSource retries.
+      source.close()
+      setTimeout(connect, 3000)
+    }
+  }
+
+  elt.addEventListener('htmx:wsAfterMessage', function() { received = true })
+  elt.addEventListener('htmx:wsError', function(e) {
+    if (received || source) {
+      return
+    }
+    failures++
+    if (failures < 2) {
+      return
+    }
+    var wrapper = e.detail.socketWrapper
+    wrapper.init = function() {}
+    wrapper.close()
+    connect()
+  })
+}
+
+// Keep <details> with ids expanded when they are replaced by HTMX swaps.
+var openDetails = {}
+document.addEventListener('toggle', function(e) {
+  if (e.target.matches && e.target.matches('details[id]')) {
+    openDetails[e.target.id] = e.target.open
+  }
+}, true)
+htmx.onLoad(function(content) {
+  var elts = Array.from(content.querySelectorAll('details[id]'))
+  if (content.matches('details[id]')) {
+    elts.push(content)
+  }
+  elts.forEach(function(elt) {
+    if (openDetails[elt.id]) {
+      elt.open = true
+    }
+  })
+})
@@ -13,8 +13,20 @@ import (
 )
 
 type templator struct {
-	tmpl   map[string]*template.Template
-	common *template.Template
+	tmpl    map[string]localizedTemplate
+	common  *template.Template
+	locales *locales
+}
+
+// localizedTemplate contains a copy of the same template for each supported language.
+type localizedTemplate map[string]*template.Template
+
+// For returns the template for the given language, falling back to the default one.
+func (t localizedTemplate) For(lang string) *template.Template {
+	if tmpl, ok := t[lang]; ok {
+		return tmpl
+	}
+	return t[defaultLang]
 }
 
 func parseTemplate(t *template.Template, fileName string) error {
@@ -34,6 +46,9 @@ func parseCommonTemplate(cfg *Config) (*template.Template, error) {
 			return cfg.prefix + s
 		},
 		"asStaticURL": func(s string) string {
+			if hash := cfg.staticHasher.Hash(s); hash != "" {
+				return cfg.prefix + s + "?v=" + hash
+			}
 			return cfg.prefix + s + "?" + cfg.opts.ServerID
 		},
 		"mixColors": func(ha, hb string, ratio float64) (string, error) {
@@ -54,11 +69,16 @@ func parseCommonTemplate(cfg *Config) (*template.Template, error) {
 			if math.IsInf(f, -1) {
 				return "-∞"
 			}
+			if math.IsNaN(f) {
+				return "N/A"
+			}
 			return strconv.FormatFloat(f, 'f', prec, 64)
 		},
 		"humanInt64": func(prec int, v int64) string {
 			return human.Int(v, prec)
 		},
+		// Replaced with the actual translations in templator.Get.
+		"tr": (*msgCatalog)(nil).Translate,
 	})
 	if err := parseTemplate(t, "template/layout/base.html"); err != nil {
 		return nil, err
@@ -87,25 +107,31 @@ func newTemplator(cfg *Config) (*templator, error) {
 		return nil, fmt.Errorf("parse common template: %w", err)
 	}
 	return &templator{
-		tmpl:   make(map[string]*template.Template),
-		common: common,
+		tmpl:    make(map[string]localizedTemplate),
+		common:  common,
+		locales: cfg.locales,
 	}, nil
 }
 
-func (t *templator) Get(name string) (*template.Template, error) {
+func (t *templator) Get(name string) (localizedTemplate, error) {
 	if tmpl, ok := t.tmpl[name]; ok {
 		return tmpl, nil
 	}
-	tmpl, err := t.common.Clone()
-	if err != nil {
-		return nil, fmt.Errorf("clone: %w", err)
-	}
-	if name != "" {
-		subT := tmpl.New(name)
-		if err := parseTemplate(subT, "template/"+name+".html"); err != nil {
-			return nil, fmt.Errorf("parse: %w", err)
+	res := make(localizedTemplate)
+	for lang, catalog := range t.locales.catalogs {
+		tmpl, err := t.common.Clone()
+		if err != nil {
+			return nil, fmt.Errorf("clone: %w", err)
+		}
+		tmpl.Funcs(template.FuncMap{"tr": catalog.Translate})
+		if name != "" {
+			subT := tmpl.New(name)
+			if err := parseTemplate(subT, "template/"+name+".html"); err != nil {
+				return nil, fmt.Errorf("parse: %w", err)
+			}
 		}
+		res[lang] = tmpl
 	}
-	t.tmpl[name] = tmpl
-	return tmpl, nil
+	t.tmpl[name] = res
+	return res, nil
 }
@@ -0,0 +1,87 @@
+package webui
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+// The theme is kept in a cookie, so it also works for anonymous visitors.
+const (
+	themeCookieName   = "day20_theme"
+	themeCookieMaxAge = 365 * 24 * time.Hour
+)
+
+// requestTheme returns the color theme for the request. The theme from the user preferences takes
+// precedence over the cookie.
+func requestTheme(req *http.Request, user *userInfo) string {
+	if user != nil && slices.Contains(userauth.Themes, user.Theme) {
+		return user.Theme
+	}
+	if c, err := req.Cookie(themeCookieName); err == nil && slices.Contains(userauth.Themes, c.Value) {
+		return c.Value
+	}
+	return userauth.Themes[0]
+}
+
+func (bc *builderCtx) SetThemeCookie(theme string) {
+	http.SetCookie(bc.writer, &http.Cookie{
+		Name:     themeCookieName,
+		Value:    theme,
+		Path:     bc.Config.prefix + "/",
+		MaxAge:   int(themeCookieMaxAge.Seconds()),
+		Secure:   !bc.Config.opts.Session.Insecure || httputil.IsSecureRequest(bc.Req),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+type themeDataBuilder struct{}
+
+func (themeDataBuilder) Build(ctx context.Context, bc builderCtx) (any, error) {
+	req := bc.Req
+	cfg := bc.Config
+	log := bc.Log
+
+	if req.Method != http.MethodPost {
+		return nil, httputil.MakeError(http.StatusMethodNotAllowed, "method not allowed")
+	}
+	if !bc.IsHTMX() {
+		return nil, httputil.MakeError(http.StatusBadRequest, "must use htmx request")
+	}
+	theme := req.FormValue("theme")
+	if !slices.Contains(userauth.Themes, theme) {
+		return nil, httputil.MakeError(http.StatusBadRequest, "unknown theme")
+	}
+	bc.SetThemeCookie(theme)
+	if user := bc.FullUser; user != nil && !user.Perms.IsBlocked && !bc.IsImpersonating() {
+		user.Prefs.Theme = theme
+		if err := cfg.UserManager.UpdateUser(ctx, *user); err != nil {
+			log.Warn("could not save user", slogx.Err(err))
+			return nil, httputil.MakeError(http.StatusInternalServerError, "internal server error")
+		}
+		bc.UpgradeSession(makeUserInfo(user))
+	}
+
+	// Return to the page where the theme was switched. Only the path is taken from the header, and
+	// the leading slashes are collapsed, so we cannot redirect to other sites.
+	target := "/"
+	if u, err := url.Parse(req.Header.Get("HX-Current-URL")); err == nil {
+		if path, ok := strings.CutPrefix(u.RequestURI(), cfg.prefix+"/"); ok {
+			target = "/" + strings.TrimLeft(path, "/\\")
+		}
+	}
+	return nil, bc.Redirect(target)
+}
+
+func themePage(log *slog.Logger, cfg *Config, templ *templator) (http.Handler, error) {
+	return newPage(log, cfg, pageOptions{FullUser: true}, templ, themeDataBuilder{}, "")
+}
@@ -1,8 +1,13 @@
 package webui
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"unicode/utf8"
 
 	"github.com/alex65536/day20/internal/util/httputil"
 	"github.com/alex65536/day20/internal/util/slogx"
@@ -14,6 +19,15 @@ func writeHTTPErr(log *slog.Logger, w http.ResponseWriter, err error) {
 	}
 }
 
+// remoteIP returns the IP address of the client without port.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
 func tagLogWithReq(log *slog.Logger, req *http.Request) *slog.Logger {
 	return log.With(
 		slog.String("uri", req.RequestURI),
@@ -22,3 +36,47 @@ func tagLogWithReq(log *slog.Logger, req *http.Request) *slog.Logger {
 		slog.String("user_agent", req.UserAgent()),
 	)
 }
+
+// uploadMemory is the part of multipart form kept in memory, the rest is stored in temporary files.
+const uploadMemory = 1 << 20
+
+// parseUploadForm parses the form which may contain uploaded files. Forms without files are
+// accepted as well.
+func parseUploadForm(req *http.Request) error {
+	err := req.ParseMultipartForm(uploadMemory)
+	if err == nil || errors.Is(err, http.ErrNotMultipart) {
+		return nil
+	}
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return httputil.MakeError(
+			http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("request too large, at most %v bytes allowed", maxErr.Limit),
+		)
+	}
+	return httputil.MakeError(http.StatusBadRequest, "bad form data")
+}
+
+// readUploadedText reads the text file uploaded in the multipart form field. If no file is
+// uploaded, it returns false.
+func readUploadedText(req *http.Request, field string) (string, bool, error) {
+	f, hdr, err := req.FormFile(field)
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("get file: %w", err)
+	}
+	defer f.Close()
+	if hdr.Size == 0 {
+		return "", false, nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", false, fmt.Errorf("read file: %w", err)
+	}
+	if !utf8.Valid(data) {
+		return "", false, fmt.Errorf("file %q is not a valid UTF-8 text", hdr.Filename)
+	}
+	return string(data), true, nil
+}
@@ -0,0 +1,132 @@
+package webui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/alex65536/day20/internal/roomapi"
+	"github.com/alex65536/day20/internal/scheduler"
+	"github.com/alex65536/day20/internal/userauth"
+	"github.com/alex65536/day20/internal/util/httputil"
+	"github.com/alex65536/day20/internal/util/slogx"
+)
+
+func buildViewer(user *userauth.User) scheduler.Viewer {
+	if user == nil {
+		return scheduler.Viewer{}
+	}
+	return scheduler.Viewer{
+		UserID: user.ID,
+		Admin:  user.Perms.Get(userauth.PermAdmin),
+	}
+}
+
+func (bc *builderCtx) Viewer() scheduler.Viewer {
+	return buildViewer(bc.FullUser)
+}
+
+// requestAPIUser returns the owner of the API token passed in the Authorization header. If there is
+// no such header, returns nil user and nil error.
+func requestAPIUser(ctx context.Context, log *slog.Logger, cfg *Config, req *http.Request) (*userauth.User, error) {
+	auth := req.Header.Get("Authorization")
+	if auth == "" {
+		return nil, nil
+	}
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return nil, httputil.MakeAuthError("bad auth", "Bearer")
+	}
+	user, err := cfg.UserManager.GetUserByAPIToken(ctx, token)
+	if err != nil {
+		if !errors.Is(err, userauth.ErrAPITokenNotFound) {
+			log.Error("could not get user by api token", slogx.Err(err))
+			return nil, fmt.Errorf("get user by api token: %w", err)
+		}
+		return nil, httputil.MakeAuthError("bad auth", "Bearer")
+	}
+	return &user, nil
+}
+
+// requestViewer is used by the handlers that are not pages and thus don't get the user from
+// builderCtx. The user is taken from the API token if it's present, and from the session otherwise.
+// On any failure, the request is treated as anonymous.
+func requestViewer(ctx context.Context, log *slog.Logger, cfg *Config, req *http.Request) scheduler.Viewer {
+	if req.Header.Get("Authorization") != "" {
+		user, err := requestAPIUser(ctx, log, cfg, req)
+		if err != nil {
+			return scheduler.Viewer{}
+		}
+		return buildViewer(user)
+	}
+	session, _ := cfg.sessionStore.Get(req, sessionName)
+	userInf, ok := session.Values["user"].(userInfo)
+	if !ok {
+		return scheduler.Viewer{}
+	}
+	user, err := cfg.UserManager.GetUser(ctx, userInf.ID)
+	if err != nil {
+		if !errors.Is(err, userauth.ErrUserNotFound) {
+			log.Error("could not fetch full user", slogx.Err(err))
+		}
+		return scheduler.Viewer{}
+	}
+	if user.Perms.IsBlocked || user.Epoch != userInf.Epoch || isSessionRevoked(ctx, log, cfg, &userInf) {
+		return scheduler.Viewer{}
+	}
+	return buildViewer(&user)
+}
+
+// canViewRunningJob reports whether the viewer can see the contest of the running job. The jobs
+// unknown to the scheduler have just finished, so there is nothing to hide about them.
+func canViewRunningJob(ctx context.Context, cfg *Config, viewer scheduler.Viewer, jobID string) (bool, error) {
+	job, ok := cfg.Scheduler.GetRunningJob(jobID)
+	if !ok {
+		return true, nil
+	}
+	info, _, err := cfg.Scheduler.GetContest(ctx, job.ContestID)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrNoSuchContest) {
+			return false, nil
+		}
+		return false, fmt.Errorf("get contest: %w", err)
+	}
+	return viewer.CanView(&info), nil
+}
+
+// checkRoomVisible returns the not found error if the viewer cannot see the contest of the job
+// running in the room, so the rooms running hidden contests look like they don't exist.
+func checkRoomVisible(ctx context.Context, log *slog.Logger, cfg *Config, viewer scheduler.Viewer, roomID string) error {
+	jobID, err := cfg.Keeper.RoomJobID(roomID)
+	if err != nil {
+		if roomapi.MatchesError(err, roomapi.ErrNoSuchRoom) {
+			return httputil.MakeError(http.StatusNotFound, "room not found")
+		}
+		log.Warn("could not get room job", slogx.Err(err))
+		return fmt.Errorf("get room job: %w", err)
+	}
+	id, ok := jobID.TryGet()
+	if !ok {
+		return nil
+	}
+	return checkRoomJobVisible(ctx, log, cfg, viewer, id)
+}
+
+// checkRoomJobVisible is the same as checkRoomVisible, but for the already known job.
+func checkRoomJobVisible(ctx context.Context, log *slog.Logger, cfg *Config, viewer scheduler.Viewer, jobID string) error {
+	if jobID == "" {
+		return nil
+	}
+	canView, err := canViewRunningJob(ctx, cfg, viewer, jobID)
+	if err != nil {
+		log.Warn("could not check job visibility", slogx.Err(err))
+		return fmt.Errorf("check job visibility: %w", err)
+	}
+	if !canView {
+		return httputil.MakeError(http.StatusNotFound, "room not found")
+	}
+	return nil
+}